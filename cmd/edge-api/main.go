@@ -28,7 +28,7 @@ func main() {
 	var app = apps.NewAppCmd()
 	app.Version(teaconst.Version)
 	app.Product(teaconst.ProductName)
-	app.Usage(teaconst.ProcessName + " [-h|-v|start|stop|restart|setup|upgrade|service|daemon|issues]")
+	app.Usage(teaconst.ProcessName + " [-h|-v|start|stop|restart|setup|upgrade [--plan [--json]]|backup|restore|service|daemon|issues]")
 
 	// 短版本号
 	app.On("-V", func() {
@@ -55,19 +55,150 @@ func main() {
 		_, _ = os.Stdout.Write(resultJSON)
 	})
 	app.On("upgrade", func() {
-		fmt.Println("start ...")
+		var flagSet = flag.NewFlagSet("upgrade", flag.ExitOnError)
+		var onlyPlan = false
+		var formatJSON = false
+		flagSet.BoolVar(&onlyPlan, "plan", false, "print upgrade plan without executing")
+		flagSet.BoolVar(&formatJSON, "json", false, "print plan in json format")
+		_ = flagSet.Parse(os.Args[2:])
+
 		executor, err := setup.NewSQLExecutorFromCmd()
 		if err != nil {
 			fmt.Println("ERROR: " + err.Error())
 			return
 		}
-		err = executor.Run(true)
+
+		// 只打印升级计划
+		if onlyPlan {
+			plan, err := executor.Plan()
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			if formatJSON {
+				planJSON, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					fmt.Println("ERROR: " + err.Error())
+					return
+				}
+				fmt.Println(string(planJSON))
+			} else {
+				fmt.Print(plan.String())
+			}
+			return
+		}
+
+		fmt.Println("start ...")
+		result, err := executor.RunResumable(true)
+		if result != nil {
+			fmt.Println("operations: " + types.String(result.CountOps) + ", done: " + types.String(result.CountDone) + ", skipped: " + types.String(result.CountSkipped) + ", failed: " + types.String(len(result.FailedOps)))
+			for _, failedOp := range result.FailedOps {
+				fmt.Println("  FAILED [" + failedOp.Op.Id + "] " + failedOp.Op.Description + ": " + failedOp.Error)
+			}
+		}
 		if err != nil {
 			fmt.Println("ERROR: " + err.Error())
+			fmt.Println("you can fix the problem and run 'upgrade' again, completed operations will be skipped")
 			return
 		}
 		fmt.Println("finished!")
 	})
+	app.On("backup", func() {
+		var flagSet = flag.NewFlagSet("backup", flag.ExitOnError)
+		var output = ""
+		var options = &setup.SQLBackupOptions{}
+		var excludeTables = ""
+		flagSet.StringVar(&output, "output", "", "backup file path")
+		flagSet.BoolVar(&options.ExcludeStats, "exclude-stats", false, "exclude stats tables")
+		flagSet.BoolVar(&options.ExcludeLogs, "exclude-logs", false, "exclude log tables")
+		flagSet.StringVar(&excludeTables, "exclude", "", "other tables to exclude, separated by comma")
+		_ = flagSet.Parse(os.Args[2:])
+
+		for _, tableName := range strings.Split(excludeTables, ",") {
+			tableName = strings.TrimSpace(tableName)
+			if len(tableName) > 0 {
+				options.ExcludeTables = append(options.ExcludeTables, tableName)
+			}
+		}
+
+		if len(output) == 0 {
+			dir, err := setup.MakeSQLBackupDir()
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			output = dir + "/" + setup.SQLBackupFilename()
+		}
+
+		executor, err := setup.NewSQLExecutorFromCmd()
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		executor.SetLogWriter(os.Stdout)
+
+		// 先写入临时文件，防止失败时留下不完整的备份
+		var tmpOutput = output + ".tmp"
+		fp, err := setup.CreateSQLBackupFile(tmpOutput)
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		manifest, err := executor.Backup(fp, options)
+		_ = fp.Close()
+		if err != nil {
+			_ = os.Remove(tmpOutput)
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		err = os.Rename(tmpOutput, output)
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		fmt.Println("backup finished: " + output + ", version: " + manifest.Version + ", tables: " + types.String(len(manifest.Tables)) + ", rows: " + types.String(manifest.CountRows()))
+	})
+	app.On("restore", func() {
+		var flagSet = flag.NewFlagSet("restore", flag.ExitOnError)
+		var onlyVerify = false
+		flagSet.BoolVar(&onlyVerify, "verify", false, "only verify the backup file")
+		_ = flagSet.Parse(os.Args[2:])
+
+		if flagSet.NArg() == 0 {
+			fmt.Println("usage: " + teaconst.ProcessName + " restore [--verify] BACKUP_FILE")
+			return
+		}
+		var archiveFile = flagSet.Arg(0)
+
+		if onlyVerify {
+			fp, err := os.Open(archiveFile)
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			manifest, err := setup.NewSQLBackup(nil).Verify(fp)
+			_ = fp.Close()
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			fmt.Println("ok, version: " + manifest.Version + ", tables: " + types.String(len(manifest.Tables)) + ", rows: " + types.String(manifest.CountRows()))
+			return
+		}
+
+		executor, err := setup.NewSQLExecutorFromCmd()
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		executor.SetLogWriter(os.Stdout)
+		manifest, err := executor.Restore(archiveFile)
+		if err != nil {
+			fmt.Println("ERROR: " + err.Error())
+			return
+		}
+		fmt.Println("restore finished, version: " + manifest.Version + ", tables: " + types.String(len(manifest.Tables)) + ", rows: " + types.String(manifest.CountRows()))
+	})
 	app.On("daemon", func() {
 		nodes.NewAPINode().Daemon()
 	})
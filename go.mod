@@ -20,6 +20,7 @@ require (
 	github.com/iwind/gosock v0.0.0-20220505115348-f88412125a62
 	github.com/miekg/dns v1.1.59
 	github.com/mozillazg/go-pinyin v0.18.0
+	github.com/oschwald/maxminddb-golang v1.12.0
 	github.com/pkg/sftp v1.12.0
 	github.com/shirou/gopsutil/v3 v3.24.2
 	github.com/smartwalle/alipay/v3 v3.2.20
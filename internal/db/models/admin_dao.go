@@ -1,8 +1,12 @@
 package models
 
 import (
+	"encoding/json"
+
 	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ldaputils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/systemconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -55,7 +59,13 @@ func (this *AdminDAO) DisableAdmin(tx *dbs.Tx, adminId int64) error {
 	}
 
 	// 删除AccessTokens
-	return SharedAPIAccessTokenDAO.DeleteAccessTokens(tx, adminId, 0)
+	err = SharedAPIAccessTokenDAO.DeleteAccessTokens(tx, adminId, 0)
+	if err != nil {
+		return err
+	}
+
+	// 退出所有登录
+	return SharedLoginSessionDAO.DeleteAllSessions(tx, adminId, 0, "")
 }
 
 // FindEnabledAdmin 查找启用中的条目
@@ -148,11 +158,20 @@ func (this *AdminDAO) UpdateAdminPassword(tx *dbs.Tx, adminId int64, password st
 	if adminId <= 0 {
 		return errors.New("invalid adminId")
 	}
+	passwordHash, err := this.prepareNewPassword(tx, adminId, "", password)
+	if err != nil {
+		return err
+	}
 	var op = NewAdminOperator()
 	op.Id = adminId
-	op.Password = stringutil.Md5(password)
-	err := this.Save(tx, op)
-	return err
+	op.Password = passwordHash
+	err = this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	// 修改密码后退出所有登录
+	return SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, adminId, 0)
 }
 
 // CreateAdmin 创建管理员
@@ -200,7 +219,11 @@ func (this *AdminDAO) UpdateAdmin(tx *dbs.Tx, adminId int64, username string, ca
 	op.Username = username
 	op.CanLogin = canLogin
 	if len(password) > 0 {
-		op.Password = stringutil.Md5(password)
+		passwordHash, err := this.prepareNewPassword(tx, adminId, username, password)
+		if err != nil {
+			return err
+		}
+		op.Password = passwordHash
 	}
 	op.IsSuper = isSuper
 	if len(modulesJSON) > 0 {
@@ -214,12 +237,26 @@ func (this *AdminDAO) UpdateAdmin(tx *dbs.Tx, adminId int64, username string, ca
 		return err
 	}
 
+	// 修改密码后退出所有登录
+	if len(password) > 0 && isOn {
+		err = SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, adminId, 0)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !isOn {
 		// 删除AccessTokens
 		err = SharedAPIAccessTokenDAO.DeleteAccessTokens(tx, adminId, 0)
 		if err != nil {
 			return err
 		}
+
+		// 退出所有登录
+		err = SharedLoginSessionDAO.DeleteAllSessions(tx, adminId, 0, "")
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -247,10 +284,22 @@ func (this *AdminDAO) UpdateAdminLogin(tx *dbs.Tx, adminId int64, username strin
 	op.Id = adminId
 	op.Username = username
 	if len(password) > 0 {
-		op.Password = stringutil.Md5(password)
+		passwordHash, err := this.prepareNewPassword(tx, adminId, username, password)
+		if err != nil {
+			return err
+		}
+		op.Password = passwordHash
 	}
 	err := this.Save(tx, op)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// 修改密码后退出所有登录
+	if len(password) > 0 {
+		return SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, adminId, 0)
+	}
+	return nil
 }
 
 // UpdateAdminModules 修改管理员可以管理的模块
@@ -268,6 +317,107 @@ func (this *AdminDAO) UpdateAdminModules(tx *dbs.Tx, adminId int64, allowModules
 	return nil
 }
 
+// UpdateAdminIsOn 启用或禁用管理员
+func (this *AdminDAO) UpdateAdminIsOn(tx *dbs.Tx, adminId int64, isOn bool) error {
+	if adminId <= 0 {
+		return errors.New("invalid adminId")
+	}
+	err := this.Query(tx).
+		Pk(adminId).
+		Set("isOn", isOn).
+		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+
+	if !isOn {
+		// 删除AccessTokens
+		err = SharedAPIAccessTokenDAO.DeleteAccessTokens(tx, adminId, 0)
+		if err != nil {
+			return err
+		}
+
+		// 退出所有登录
+		err = SharedLoginSessionDAO.DeleteAllSessions(tx, adminId, 0, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncAdminWithLDAPUser 根据LDAP目录中的用户信息同步管理员的全名和可以管理的模块
+// 返回管理员是否仍然可以登录；如果用户已经不在任何对应的分组中，并且设置了 RequireGroup，则禁用管理员
+// 没有设置 OverwritePermissions 时，只增加分组对应的模块和超级管理员权限，保留管理员已有的权限
+func (this *AdminDAO) SyncAdminWithLDAPUser(tx *dbs.Tx, adminId int64, config *ldaputils.Config, user *ldaputils.User) (isOn bool, err error) {
+	if adminId <= 0 {
+		return false, errors.New("invalid adminId")
+	}
+	if config == nil || user == nil {
+		return false, errors.New("invalid config or user")
+	}
+
+	moduleCodes, isSuper, matched := config.MatchGroups(user.Groups)
+	if !matched && config.RequireGroup {
+		return false, this.UpdateAdminIsOn(tx, adminId, false)
+	}
+
+	admin, err := this.FindEnabledAdmin(tx, adminId)
+	if err != nil {
+		return false, err
+	}
+	if admin == nil {
+		return false, errors.New("admin '" + types.String(adminId) + "' not found")
+	}
+
+	var modules = []*systemconfigs.AdminModule{}
+	if !config.OverwritePermissions {
+		isSuper = isSuper || admin.IsSuper
+		if IsNotNull(admin.Modules) {
+			err = json.Unmarshal(admin.Modules, &modules)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	var existModuleCodes = map[string]bool{}
+	for _, module := range modules {
+		if module != nil {
+			existModuleCodes[module.Code] = true
+		}
+	}
+	for _, code := range moduleCodes {
+		if existModuleCodes[code] {
+			continue
+		}
+		modules = append(modules, &systemconfigs.AdminModule{
+			Code:     code,
+			AllowAll: true,
+			Actions:  []string{},
+		})
+	}
+	modulesJSON, err := json.Marshal(modules)
+	if err != nil {
+		return false, err
+	}
+	err = this.UpdateAdminModules(tx, adminId, modulesJSON)
+	if err != nil {
+		return false, err
+	}
+
+	var op = NewAdminOperator()
+	op.Id = adminId
+	op.IsSuper = isSuper
+	if len(user.Fullname) > 0 {
+		op.Fullname = user.Fullname
+	}
+	err = this.Save(tx, op)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // FindAllAdminModules 查询所有管理的权限
 func (this *AdminDAO) FindAllAdminModules(tx *dbs.Tx) (result []*Admin, err error) {
 	_, err = this.Query(tx).
@@ -345,3 +495,36 @@ func (this *AdminDAO) CheckSuperAdmin(tx *dbs.Tx, adminId int64) (bool, error) {
 		Attr("isSuper", true).
 		Exist()
 }
+
+// 检查新密码是否符合登录安全策略并记录旧密码，返回新密码的哈希值
+func (this *AdminDAO) prepareNewPassword(tx *dbs.Tx, adminId int64, username string, password string) (string, error) {
+	one, err := this.Query(tx).
+		Pk(adminId).
+		Result("username", "password").
+		Find()
+	if err != nil {
+		return "", err
+	}
+	var oldPasswordHash string
+	if one != nil {
+		var admin = one.(*Admin)
+		oldPasswordHash = admin.Password
+		if len(username) == 0 {
+			username = admin.Username
+		}
+	}
+
+	err = SharedLoginDAO.CheckNewPassword(tx, adminId, 0, username, oldPasswordHash, password)
+	if err != nil {
+		return "", err
+	}
+
+	var passwordHash = stringutil.Md5(password)
+	if oldPasswordHash != passwordHash {
+		err = SharedLoginDAO.RecordPasswordHistory(tx, adminId, 0, oldPasswordHash)
+		if err != nil {
+			return "", err
+		}
+	}
+	return passwordHash, nil
+}
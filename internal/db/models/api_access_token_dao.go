@@ -32,7 +32,7 @@ func init() {
 }
 
 // GenerateAccessToken 生成AccessToken
-func (this *APIAccessTokenDAO) GenerateAccessToken(tx *dbs.Tx, adminId int64, userId int64) (token string, expiresAt int64, err error) {
+func (this *APIAccessTokenDAO) GenerateAccessToken(tx *dbs.Tx, adminId int64, userId int64, subUserId int64) (token string, expiresAt int64, err error) {
 	if adminId <= 0 && userId <= 0 {
 		err = errors.New("either 'adminId' or 'userId' should not be zero")
 		return
@@ -43,12 +43,15 @@ func (this *APIAccessTokenDAO) GenerateAccessToken(tx *dbs.Tx, adminId int64, us
 	}
 	if userId > 0 {
 		adminId = 0
+	} else {
+		subUserId = 0
 	}
 
 	// 查询以前的
 	accessToken, err := this.Query(tx).
 		Attr("adminId", adminId).
 		Attr("userId", userId).
+		Attr("subUserId", subUserId).
 		Find()
 	if err != nil {
 		return "", 0, err
@@ -65,6 +68,7 @@ func (this *APIAccessTokenDAO) GenerateAccessToken(tx *dbs.Tx, adminId int64, us
 
 	op.AdminId = adminId
 	op.UserId = userId
+	op.SubUserId = subUserId
 	op.Token = token
 	op.CreatedAt = time.Now().Unix()
 	op.ExpiredAt = expiresAt
@@ -95,3 +99,13 @@ func (this *APIAccessTokenDAO) DeleteAccessTokens(tx *dbs.Tx, adminId int64, use
 	}
 	return query.DeleteQuickly()
 }
+
+// DeleteSubUserAccessTokens 删除子用户的令牌
+func (this *APIAccessTokenDAO) DeleteSubUserAccessTokens(tx *dbs.Tx, subUserId int64) error {
+	if subUserId <= 0 {
+		return nil
+	}
+	return this.Query(tx).
+		Attr("subUserId", subUserId).
+		DeleteQuickly()
+}
@@ -0,0 +1,1169 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipitemutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ipconfigs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPFirewallPolicyDocumentVersion 当前导出文档版本
+const HTTPFirewallPolicyDocumentVersion = 1
+
+// HTTPFirewallPolicyDocumentFormat 导出文档格式
+type HTTPFirewallPolicyDocumentFormat = string
+
+const (
+	HTTPFirewallPolicyDocumentFormatJSON HTTPFirewallPolicyDocumentFormat = "json"
+	HTTPFirewallPolicyDocumentFormatYAML HTTPFirewallPolicyDocumentFormat = "yaml"
+)
+
+// HTTPFirewallPolicyImportMode 导入方式
+type HTTPFirewallPolicyImportMode = string
+
+const (
+	HTTPFirewallPolicyImportModeMerge   HTTPFirewallPolicyImportMode = "merge"   // 合并：添加和更新文档中的分组、规则集和IP，保留已有的其他数据
+	HTTPFirewallPolicyImportModeReplace HTTPFirewallPolicyImportMode = "replace" // 替换：使策略和文档保持一致
+)
+
+// HTTPFirewallPolicyChangeAction 变更类型
+type HTTPFirewallPolicyChangeAction = string
+
+const (
+	HTTPFirewallPolicyChangeActionAdded   HTTPFirewallPolicyChangeAction = "added"
+	HTTPFirewallPolicyChangeActionRemoved HTTPFirewallPolicyChangeAction = "removed"
+	HTTPFirewallPolicyChangeActionChanged HTTPFirewallPolicyChangeAction = "changed"
+	HTTPFirewallPolicyChangeActionMissing HTTPFirewallPolicyChangeAction = "missing" // 文档中引用的公共IP名单在当前系统中不存在，导入时会忽略
+)
+
+// HTTPFirewallPolicyChangeKind 变更对象
+type HTTPFirewallPolicyChangeKind = string
+
+const (
+	HTTPFirewallPolicyChangeKindGroup  HTTPFirewallPolicyChangeKind = "group"
+	HTTPFirewallPolicyChangeKindSet    HTTPFirewallPolicyChangeKind = "set"
+	HTTPFirewallPolicyChangeKindRule   HTTPFirewallPolicyChangeKind = "rule"
+	HTTPFirewallPolicyChangeKindRegion HTTPFirewallPolicyChangeKind = "region"
+	HTTPFirewallPolicyChangeKindIPList HTTPFirewallPolicyChangeKind = "ipList"
+)
+
+// HTTPFirewallPolicyDocument 可以在不同系统之间迁移的WAF策略文档
+// 文档中不包含任何数据库ID，分组和规则集在导入时通过代号或名称匹配
+type HTTPFirewallPolicyDocument struct {
+	Version    int                                 `json:"version"`
+	ExportedAt int64                               `json:"exportedAt"`
+	Policy     *firewallconfigs.HTTPFirewallPolicy `json:"policy"`
+	IPLists    []*HTTPFirewallPolicyDocumentIPList `json:"ipLists"`
+}
+
+// HTTPFirewallPolicyDocumentIPList 策略引用的IP名单
+type HTTPFirewallPolicyDocumentIPList struct {
+	Type     ipconfigs.IPListType                `json:"type"`
+	IsPublic bool                                `json:"isPublic"` // 公共名单只导出名称和代号，导入时在当前系统中查找
+	IsOn     bool                                `json:"isOn"`
+	Name     string                              `json:"name"`
+	Code     string                              `json:"code"`
+	Items    []*HTTPFirewallPolicyDocumentIPItem `json:"items"`
+}
+
+// HTTPFirewallPolicyDocumentIPItem 策略自有IP名单中的条目
+type HTTPFirewallPolicyDocumentIPItem struct {
+	Value     string `json:"value"`
+	ExpiredAt int64  `json:"expiredAt"`
+	Reason    string `json:"reason"`
+}
+
+// HTTPFirewallPolicyChange 导入文档时策略发生的变更
+type HTTPFirewallPolicyChange struct {
+	Action HTTPFirewallPolicyChangeAction `json:"action"`
+	Kind   HTTPFirewallPolicyChangeKind   `json:"kind"`
+	Path   string                         `json:"path"` // 比如 inbound/SQL注入/SQL注入检测
+	Old    string                         `json:"old"`
+	New    string                         `json:"new"`
+}
+
+// ExportFirewallPolicy 导出策略文档
+func (this *HTTPFirewallPolicyDAO) ExportFirewallPolicy(tx *dbs.Tx, policyId int64) (*HTTPFirewallPolicyDocument, error) {
+	config, err := this.ComposeFirewallPolicy(tx, policyId, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrNotFound
+	}
+
+	var document = &HTTPFirewallPolicyDocument{
+		Version:    HTTPFirewallPolicyDocumentVersion,
+		ExportedAt: time.Now().Unix(),
+		Policy:     config,
+		IPLists:    []*HTTPFirewallPolicyDocumentIPList{},
+	}
+
+	config.Id = 0
+	config.ServerId = 0
+
+	if config.Inbound != nil {
+		config.Inbound.GroupRefs = nil
+		for _, group := range config.Inbound.Groups {
+			err = this.exportRuleGroup(tx, group)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// 策略自有的名单
+		for _, listType := range []ipconfigs.IPListType{ipconfigs.IPListTypeWhite, ipconfigs.IPListTypeBlack, ipconfigs.IPListTypeGrey} {
+			var listRef = this.findInboundListRef(config.Inbound, listType)
+			if listRef == nil || listRef.ListId <= 0 {
+				continue
+			}
+			items, err := SharedIPItemDAO.FindAllEnabledItemsWithListId(tx, listRef.ListId)
+			if err != nil {
+				return nil, err
+			}
+			var documentList = &HTTPFirewallPolicyDocumentIPList{
+				Type:  listType,
+				IsOn:  listRef.IsOn,
+				Items: []*HTTPFirewallPolicyDocumentIPItem{},
+			}
+			for _, item := range items {
+				if item.Type == IPItemTypeAll {
+					continue
+				}
+				value, ok := ipitemutils.NormalizeValue(item.ComposeValue())
+				if !ok {
+					continue
+				}
+				documentList.Items = append(documentList.Items, &HTTPFirewallPolicyDocumentIPItem{
+					Value:     value,
+					ExpiredAt: int64(item.ExpiredAt),
+					Reason:    item.Reason,
+				})
+			}
+			document.IPLists = append(document.IPLists, documentList)
+		}
+
+		// 引用的公共名单
+		for _, listType := range []ipconfigs.IPListType{ipconfigs.IPListTypeWhite, ipconfigs.IPListTypeBlack, ipconfigs.IPListTypeGrey} {
+			for _, listRef := range this.findInboundPublicListRefs(config.Inbound, listType) {
+				list, err := SharedIPListDAO.FindEnabledIPList(tx, listRef.ListId, nil)
+				if err != nil {
+					return nil, err
+				}
+				if list == nil {
+					continue
+				}
+				document.IPLists = append(document.IPLists, &HTTPFirewallPolicyDocumentIPList{
+					Type:     listType,
+					IsPublic: true,
+					IsOn:     listRef.IsOn,
+					Name:     list.Name,
+					Code:     list.Code,
+				})
+			}
+		}
+
+		config.Inbound.AllowListRef = nil
+		config.Inbound.DenyListRef = nil
+		config.Inbound.GreyListRef = nil
+		config.Inbound.PublicAllowListRefs = nil
+		config.Inbound.PublicDenyListRefs = nil
+		config.Inbound.PublicGreyListRefs = nil
+	}
+
+	if config.Outbound != nil {
+		config.Outbound.GroupRefs = nil
+		for _, group := range config.Outbound.Groups {
+			err = this.exportRuleGroup(tx, group)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return document, nil
+}
+
+// EncodeFirewallPolicyDocument 将文档编码为JSON或YAML
+func (this *HTTPFirewallPolicyDAO) EncodeFirewallPolicyDocument(document *HTTPFirewallPolicyDocument, format HTTPFirewallPolicyDocumentFormat) ([]byte, error) {
+	switch format {
+	case HTTPFirewallPolicyDocumentFormatJSON, "":
+		return json.MarshalIndent(document, "", "  ")
+	case HTTPFirewallPolicyDocumentFormatYAML:
+		// 先转换为JSON，以便YAML中的字段名和JSON保持一致
+		documentJSON, err := json.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		var decoder = json.NewDecoder(bytes.NewReader(documentJSON))
+		decoder.UseNumber()
+		var value any
+		err = decoder.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(this.normalizeJSONNumbers(value))
+	default:
+		return nil, errors.New("invalid document format '" + format + "'")
+	}
+}
+
+// DecodeFirewallPolicyDocument 解析JSON或YAML格式的文档
+func (this *HTTPFirewallPolicyDAO) DecodeFirewallPolicyDocument(data []byte) (*HTTPFirewallPolicyDocument, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty document")
+	}
+
+	var documentJSON = data
+	if data[0] != '{' {
+		var value any
+		err := yaml.Unmarshal(data, &value)
+		if err != nil {
+			return nil, errors.New("decode yaml failed: " + err.Error())
+		}
+		documentJSON, err = json.Marshal(value)
+		if err != nil {
+			return nil, errors.New("decode yaml failed: " + err.Error())
+		}
+	}
+
+	var document = &HTTPFirewallPolicyDocument{}
+	err := json.Unmarshal(documentJSON, document)
+	if err != nil {
+		return nil, errors.New("decode document failed: " + err.Error())
+	}
+	if document.Version <= 0 || document.Version > HTTPFirewallPolicyDocumentVersion {
+		return nil, errors.New("unsupported document version '" + strconv.Itoa(document.Version) + "'")
+	}
+	if document.Policy == nil {
+		return nil, errors.New("invalid document: 'policy' should not be empty")
+	}
+
+	// 防止使用文档中的ID覆盖当前系统中的数据
+	for _, group := range this.findDocumentGroups(document.Policy) {
+		group.Id = 0
+		group.SetRefs = nil
+		for _, set := range group.Sets {
+			set.Id = 0
+			set.RuleRefs = nil
+			for _, rule := range set.Rules {
+				rule.Id = 0
+			}
+		}
+	}
+
+	return document, nil
+}
+
+// DiffFirewallPolicyDocument 对比文档和当前策略
+func (this *HTTPFirewallPolicyDAO) DiffFirewallPolicyDocument(tx *dbs.Tx, policyId int64, document *HTTPFirewallPolicyDocument, mode HTTPFirewallPolicyImportMode) ([]*HTTPFirewallPolicyChange, error) {
+	err := this.validateImportMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	oldConfig, err := this.ComposeFirewallPolicy(tx, policyId, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if oldConfig == nil {
+		return nil, ErrNotFound
+	}
+
+	var changes = DiffFirewallPolicy(oldConfig, document.Policy, mode)
+
+	// IP名单
+	for _, documentList := range document.IPLists {
+		var path = "inbound/" + documentList.Type
+		if documentList.IsPublic {
+			path += "/" + documentList.Name
+			listId, err := this.findImportingPublicListId(tx, documentList)
+			if err != nil {
+				return nil, err
+			}
+			if listId <= 0 {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionMissing,
+					Kind:   HTTPFirewallPolicyChangeKindIPList,
+					Path:   path,
+				})
+				continue
+			}
+			if !this.containsListRef(this.findInboundPublicListRefs(oldConfig.Inbound, documentList.Type), listId) {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionAdded,
+					Kind:   HTTPFirewallPolicyChangeKindIPList,
+					Path:   path,
+					New:    documentList.Name,
+				})
+			}
+			continue
+		}
+
+		var oldValueMap = map[string]bool{}
+		var listRef = this.findInboundListRef(oldConfig.Inbound, documentList.Type)
+		if listRef != nil && listRef.ListId > 0 {
+			oldValueMap, err = this.findListValueMap(tx, listRef.ListId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var newValueMap = this.findDocumentListValueMap(documentList)
+		var countAdded, countRemoved int
+		for value := range newValueMap {
+			if !oldValueMap[value] {
+				countAdded++
+			}
+		}
+		if mode == HTTPFirewallPolicyImportModeReplace {
+			for value := range oldValueMap {
+				if !newValueMap[value] {
+					countRemoved++
+				}
+			}
+		}
+		if countAdded > 0 || countRemoved > 0 {
+			changes = append(changes, &HTTPFirewallPolicyChange{
+				Action: HTTPFirewallPolicyChangeActionChanged,
+				Kind:   HTTPFirewallPolicyChangeKindIPList,
+				Path:   path,
+				Old:    strconv.Itoa(len(oldValueMap)),
+				New:    strconv.Itoa(len(oldValueMap) + countAdded - countRemoved),
+			})
+		}
+	}
+	if mode == HTTPFirewallPolicyImportModeReplace && oldConfig.Inbound != nil {
+		for _, listType := range []ipconfigs.IPListType{ipconfigs.IPListTypeWhite, ipconfigs.IPListTypeBlack, ipconfigs.IPListTypeGrey} {
+			for _, listRef := range this.findInboundPublicListRefs(oldConfig.Inbound, listType) {
+				var found = false
+				for _, documentList := range document.IPLists {
+					if !documentList.IsPublic || documentList.Type != listType {
+						continue
+					}
+					listId, err := this.findImportingPublicListId(tx, documentList)
+					if err != nil {
+						return nil, err
+					}
+					if listId == listRef.ListId {
+						found = true
+						break
+					}
+				}
+				if !found {
+					listName, err := SharedIPListDAO.FindIPListName(tx, listRef.ListId)
+					if err != nil {
+						return nil, err
+					}
+					changes = append(changes, &HTTPFirewallPolicyChange{
+						Action: HTTPFirewallPolicyChangeActionRemoved,
+						Kind:   HTTPFirewallPolicyChangeKindIPList,
+						Path:   "inbound/" + listType + "/" + listName,
+						Old:    listName,
+					})
+				}
+			}
+		}
+	}
+
+	// 记录IP动作中使用的名单
+	for _, group := range this.findDocumentGroups(document.Policy) {
+		for _, set := range group.Sets {
+			for _, action := range set.Actions {
+				if action.Code != firewallconfigs.HTTPFirewallActionRecordIP || action.Options == nil {
+					continue
+				}
+				var listName = action.Options.GetString("ipListName")
+				if len(listName) == 0 {
+					continue
+				}
+				listId, err := this.findImportingPublicListId(tx, &HTTPFirewallPolicyDocumentIPList{
+					Type: action.Options.GetString("type"),
+					Name: listName,
+					Code: action.Options.GetString("ipListCode"),
+				})
+				if err != nil {
+					return nil, err
+				}
+				if listId <= 0 {
+					changes = append(changes, &HTTPFirewallPolicyChange{
+						Action: HTTPFirewallPolicyChangeActionMissing,
+						Kind:   HTTPFirewallPolicyChangeKindIPList,
+						Path:   group.Name + "/" + set.Name + "/" + listName,
+					})
+				}
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// ImportFirewallPolicyDocument 将文档导入到已有策略中
+func (this *HTTPFirewallPolicyDAO) ImportFirewallPolicyDocument(tx *dbs.Tx, policyId int64, document *HTTPFirewallPolicyDocument, mode HTTPFirewallPolicyImportMode) ([]*HTTPFirewallPolicyChange, error) {
+	changes, err := this.DiffFirewallPolicyDocument(tx, policyId, document, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := this.FindEnabledHTTPFirewallPolicy(tx, policyId)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, ErrNotFound
+	}
+	oldConfig, err := this.ComposeFirewallPolicy(tx, policyId, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if oldConfig == nil {
+		return nil, ErrNotFound
+	}
+
+	// 记录IP动作中的名单
+	for _, group := range this.findDocumentGroups(document.Policy) {
+		for _, set := range group.Sets {
+			err = this.resolveRecordIPActions(tx, set)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var newInbound = document.Policy.Inbound
+	if newInbound == nil {
+		newInbound = &firewallconfigs.HTTPFirewallInboundConfig{}
+	}
+	var newOutbound = document.Policy.Outbound
+	if newOutbound == nil {
+		newOutbound = &firewallconfigs.HTTPFirewallOutboundConfig{}
+	}
+
+	// 入站
+	var inbound = oldConfig.Inbound
+	if len(newInbound.Groups) > 0 || mode == HTTPFirewallPolicyImportModeReplace {
+		inbound.GroupRefs, err = this.importRuleGroups(tx, inbound.GroupRefs, inbound.Groups, newInbound.Groups, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mode == HTTPFirewallPolicyImportModeReplace {
+		inbound.Region = newInbound.Region
+	} else {
+		inbound.Region = mergeFirewallRegion(inbound.Region, newInbound.Region)
+	}
+
+	// 公共名单
+	for _, listType := range []ipconfigs.IPListType{ipconfigs.IPListTypeWhite, ipconfigs.IPListTypeBlack, ipconfigs.IPListTypeGrey} {
+		var listRefs = []*ipconfigs.IPListRef{}
+		if mode == HTTPFirewallPolicyImportModeMerge {
+			listRefs = this.findInboundPublicListRefs(inbound, listType)
+		}
+		for _, documentList := range document.IPLists {
+			if !documentList.IsPublic || documentList.Type != listType {
+				continue
+			}
+			listId, err := this.findImportingPublicListId(tx, documentList)
+			if err != nil {
+				return nil, err
+			}
+			if listId <= 0 || this.containsListRef(listRefs, listId) {
+				continue
+			}
+			listRefs = append(listRefs, &ipconfigs.IPListRef{
+				IsOn:   documentList.IsOn,
+				ListId: listId,
+			})
+		}
+		switch listType {
+		case ipconfigs.IPListTypeWhite:
+			inbound.PublicAllowListRefs = listRefs
+		case ipconfigs.IPListTypeBlack:
+			inbound.PublicDenyListRefs = listRefs
+		case ipconfigs.IPListTypeGrey:
+			inbound.PublicGreyListRefs = listRefs
+		}
+	}
+
+	// 出站
+	var outbound = oldConfig.Outbound
+	if len(newOutbound.Groups) > 0 || mode == HTTPFirewallPolicyImportModeReplace {
+		outbound.GroupRefs, err = this.importRuleGroups(tx, outbound.GroupRefs, outbound.Groups, newOutbound.Groups, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 保存Inbound和Outbound
+	inbound.Groups = nil
+	outbound.Groups = nil
+	inboundJSON, err := json.Marshal(inbound)
+	if err != nil {
+		return nil, err
+	}
+	outboundJSON, err := json.Marshal(outbound)
+	if err != nil {
+		return nil, err
+	}
+	err = this.UpdateFirewallPolicyInboundAndOutbound(tx, policyId, int64(policy.UserId), int64(policy.ServerId), inboundJSON, outboundJSON, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 策略自有名单中的IP，名单可能是在上一步中刚创建的，所以需要重新读取
+	inboundJSON, err = this.Query(tx).
+		Pk(policyId).
+		Result("inbound").
+		FindJSONCol()
+	if err != nil {
+		return nil, err
+	}
+	inbound = &firewallconfigs.HTTPFirewallInboundConfig{}
+	if IsNotNull(inboundJSON) {
+		err = json.Unmarshal(inboundJSON, inbound)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, documentList := range document.IPLists {
+		if documentList.IsPublic {
+			continue
+		}
+		var listRef = this.findInboundListRef(inbound, documentList.Type)
+		if listRef == nil || listRef.ListId <= 0 {
+			continue
+		}
+		err = this.importListItems(tx, listRef.ListId, documentList, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, this.NotifyUpdate(tx, policyId)
+}
+
+// DiffFirewallPolicy 对比两个策略中的分组、规则集、规则和区域封禁设置
+func DiffFirewallPolicy(oldConfig *firewallconfigs.HTTPFirewallPolicy, newConfig *firewallconfigs.HTTPFirewallPolicy, mode HTTPFirewallPolicyImportMode) []*HTTPFirewallPolicyChange {
+	var changes = []*HTTPFirewallPolicyChange{}
+
+	var oldInbound = oldConfig.Inbound
+	if oldInbound == nil {
+		oldInbound = &firewallconfigs.HTTPFirewallInboundConfig{}
+	}
+	var newInbound = newConfig.Inbound
+	if newInbound == nil {
+		newInbound = &firewallconfigs.HTTPFirewallInboundConfig{}
+	}
+	var oldOutbound = oldConfig.Outbound
+	if oldOutbound == nil {
+		oldOutbound = &firewallconfigs.HTTPFirewallOutboundConfig{}
+	}
+	var newOutbound = newConfig.Outbound
+	if newOutbound == nil {
+		newOutbound = &firewallconfigs.HTTPFirewallOutboundConfig{}
+	}
+
+	changes = append(changes, diffFirewallRuleGroups("inbound", oldInbound.Groups, newInbound.Groups, mode)...)
+	changes = append(changes, diffFirewallRuleGroups("outbound", oldOutbound.Groups, newOutbound.Groups, mode)...)
+
+	// 区域封禁
+	var newRegion = newInbound.Region
+	if mode == HTTPFirewallPolicyImportModeMerge {
+		newRegion = mergeFirewallRegion(oldInbound.Region, newRegion)
+	}
+	var oldRegionSummary = summarizeFirewallRegion(oldInbound.Region)
+	var newRegionSummary = summarizeFirewallRegion(newRegion)
+	if oldRegionSummary != newRegionSummary {
+		changes = append(changes, &HTTPFirewallPolicyChange{
+			Action: HTTPFirewallPolicyChangeActionChanged,
+			Kind:   HTTPFirewallPolicyChangeKindRegion,
+			Path:   "inbound/region",
+			Old:    oldRegionSummary,
+			New:    newRegionSummary,
+		})
+	}
+
+	return changes
+}
+
+func diffFirewallRuleGroups(path string, oldGroups []*firewallconfigs.HTTPFirewallRuleGroup, newGroups []*firewallconfigs.HTTPFirewallRuleGroup, mode HTTPFirewallPolicyImportMode) []*HTTPFirewallPolicyChange {
+	var changes = []*HTTPFirewallPolicyChange{}
+	var matchedGroupMap = map[*firewallconfigs.HTTPFirewallRuleGroup]bool{}
+	for _, newGroup := range newGroups {
+		var groupPath = path + "/" + newGroup.Name
+		var oldGroup = findFirewallRuleGroup(oldGroups, newGroup)
+		if oldGroup == nil {
+			changes = append(changes, &HTTPFirewallPolicyChange{
+				Action: HTTPFirewallPolicyChangeActionAdded,
+				Kind:   HTTPFirewallPolicyChangeKindGroup,
+				Path:   groupPath,
+				New:    summarizeFirewallRuleGroup(newGroup),
+			})
+			continue
+		}
+		matchedGroupMap[oldGroup] = true
+
+		var oldSummary = summarizeFirewallRuleGroup(oldGroup)
+		var newSummary = summarizeFirewallRuleGroup(newGroup)
+		if oldSummary != newSummary {
+			changes = append(changes, &HTTPFirewallPolicyChange{
+				Action: HTTPFirewallPolicyChangeActionChanged,
+				Kind:   HTTPFirewallPolicyChangeKindGroup,
+				Path:   groupPath,
+				Old:    oldSummary,
+				New:    newSummary,
+			})
+		}
+
+		changes = append(changes, diffFirewallRuleSets(groupPath, oldGroup.Sets, newGroup.Sets, mode)...)
+	}
+
+	if mode == HTTPFirewallPolicyImportModeReplace {
+		for _, oldGroup := range oldGroups {
+			if !matchedGroupMap[oldGroup] {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionRemoved,
+					Kind:   HTTPFirewallPolicyChangeKindGroup,
+					Path:   path + "/" + oldGroup.Name,
+					Old:    summarizeFirewallRuleGroup(oldGroup),
+				})
+			}
+		}
+	}
+
+	return changes
+}
+
+func diffFirewallRuleSets(path string, oldSets []*firewallconfigs.HTTPFirewallRuleSet, newSets []*firewallconfigs.HTTPFirewallRuleSet, mode HTTPFirewallPolicyImportMode) []*HTTPFirewallPolicyChange {
+	var changes = []*HTTPFirewallPolicyChange{}
+	var matchedSetMap = map[*firewallconfigs.HTTPFirewallRuleSet]bool{}
+	for _, newSet := range newSets {
+		var setPath = path + "/" + newSet.Name
+		var oldSet = findFirewallRuleSet(oldSets, newSet)
+		if oldSet == nil {
+			changes = append(changes, &HTTPFirewallPolicyChange{
+				Action: HTTPFirewallPolicyChangeActionAdded,
+				Kind:   HTTPFirewallPolicyChangeKindSet,
+				Path:   setPath,
+				New:    summarizeFirewallRuleSet(newSet),
+			})
+			continue
+		}
+		matchedSetMap[oldSet] = true
+
+		var oldSummary = summarizeFirewallRuleSet(oldSet)
+		var newSummary = summarizeFirewallRuleSet(newSet)
+		if oldSummary != newSummary {
+			changes = append(changes, &HTTPFirewallPolicyChange{
+				Action: HTTPFirewallPolicyChangeActionChanged,
+				Kind:   HTTPFirewallPolicyChangeKindSet,
+				Path:   setPath,
+				Old:    oldSummary,
+				New:    newSummary,
+			})
+		}
+
+		// 规则没有代号，所以使用规则内容对比；匹配的规则集中的规则总是被文档中的规则替换
+		var oldRuleCountMap = map[string]int{}
+		for _, rule := range oldSet.Rules {
+			oldRuleCountMap[summarizeFirewallRule(rule)]++
+		}
+		var newRuleCountMap = map[string]int{}
+		for _, rule := range newSet.Rules {
+			var ruleSummary = summarizeFirewallRule(rule)
+			newRuleCountMap[ruleSummary]++
+			if newRuleCountMap[ruleSummary] > oldRuleCountMap[ruleSummary] {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionAdded,
+					Kind:   HTTPFirewallPolicyChangeKindRule,
+					Path:   setPath,
+					New:    ruleSummary,
+				})
+			}
+		}
+		var removedRuleCountMap = map[string]int{}
+		for _, rule := range oldSet.Rules {
+			var ruleSummary = summarizeFirewallRule(rule)
+			removedRuleCountMap[ruleSummary]++
+			if removedRuleCountMap[ruleSummary] > newRuleCountMap[ruleSummary] {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionRemoved,
+					Kind:   HTTPFirewallPolicyChangeKindRule,
+					Path:   setPath,
+					Old:    ruleSummary,
+				})
+			}
+		}
+	}
+
+	if mode == HTTPFirewallPolicyImportModeReplace {
+		for _, oldSet := range oldSets {
+			if !matchedSetMap[oldSet] {
+				changes = append(changes, &HTTPFirewallPolicyChange{
+					Action: HTTPFirewallPolicyChangeActionRemoved,
+					Kind:   HTTPFirewallPolicyChangeKindSet,
+					Path:   path + "/" + oldSet.Name,
+					Old:    summarizeFirewallRuleSet(oldSet),
+				})
+			}
+		}
+	}
+
+	return changes
+}
+
+// 先使用代号查找，再使用名称查找
+func findFirewallRuleGroup(groups []*firewallconfigs.HTTPFirewallRuleGroup, group *firewallconfigs.HTTPFirewallRuleGroup) *firewallconfigs.HTTPFirewallRuleGroup {
+	if len(group.Code) > 0 {
+		for _, g := range groups {
+			if g.Code == group.Code {
+				return g
+			}
+		}
+	}
+	if len(group.Name) > 0 {
+		for _, g := range groups {
+			if g.Name == group.Name {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// 先使用代号查找，再使用名称查找
+func findFirewallRuleSet(sets []*firewallconfigs.HTTPFirewallRuleSet, set *firewallconfigs.HTTPFirewallRuleSet) *firewallconfigs.HTTPFirewallRuleSet {
+	if len(set.Code) > 0 {
+		for _, s := range sets {
+			if s.Code == set.Code {
+				return s
+			}
+		}
+	}
+	if len(set.Name) > 0 {
+		for _, s := range sets {
+			if s.Name == set.Name {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+func summarizeFirewallRuleGroup(group *firewallconfigs.HTTPFirewallRuleGroup) string {
+	return fmt.Sprintf("isOn=%t description=%q sets=%d", group.IsOn, group.Description, len(group.Sets))
+}
+
+func summarizeFirewallRuleSet(set *firewallconfigs.HTTPFirewallRuleSet) string {
+	actionsJSON, _ := json.Marshal(set.Actions)
+	return fmt.Sprintf("isOn=%t description=%q connector=%s ignoreLocal=%t ignoreSearchEngine=%t actions=%s", set.IsOn, set.Description, set.Connector, set.IgnoreLocal, set.IgnoreSearchEngine, actionsJSON)
+}
+
+func summarizeFirewallRule(rule *firewallconfigs.HTTPFirewallRule) string {
+	var summary = rule.Param
+	if len(rule.ParamFilters) > 0 {
+		filtersJSON, _ := json.Marshal(rule.ParamFilters)
+		summary += " | " + string(filtersJSON)
+	}
+	summary += " " + rule.Operator + " " + strconv.Quote(rule.Value)
+	if rule.IsCaseInsensitive {
+		summary += " (case insensitive)"
+	}
+	if len(rule.CheckpointOptions) > 0 {
+		optionsJSON, _ := json.Marshal(rule.CheckpointOptions)
+		summary += " " + string(optionsJSON)
+	}
+	if !rule.IsOn {
+		summary += " (off)"
+	}
+	return summary
+}
+
+func summarizeFirewallRegion(region *firewallconfigs.HTTPFirewallRegionConfig) string {
+	if region == nil {
+		return ""
+	}
+	return fmt.Sprintf("isOn=%t countries=%v provinces=%v asns=%v", region.IsOn, region.DenyCountryIds, region.DenyProvinceIds, region.DenyASNs)
+}
+
+// 合并区域封禁设置，封禁的区域取并集
+func mergeFirewallRegion(oldRegion *firewallconfigs.HTTPFirewallRegionConfig, newRegion *firewallconfigs.HTTPFirewallRegionConfig) *firewallconfigs.HTTPFirewallRegionConfig {
+	if newRegion == nil {
+		return oldRegion
+	}
+	if oldRegion == nil {
+		return newRegion
+	}
+
+	var mergeIds = func(oldIds []int64, newIds []int64) []int64 {
+		var result = append([]int64{}, oldIds...)
+		for _, id := range newIds {
+			if !lists.ContainsInt64(result, id) {
+				result = append(result, id)
+			}
+		}
+		return result
+	}
+
+	var result = *newRegion
+	result.DenyCountryIds = mergeIds(oldRegion.DenyCountryIds, newRegion.DenyCountryIds)
+	result.DenyProvinceIds = mergeIds(oldRegion.DenyProvinceIds, newRegion.DenyProvinceIds)
+	result.DenyASNs = mergeIds(oldRegion.DenyASNs, newRegion.DenyASNs)
+	return &result
+}
+
+// 导入分组，返回新的分组引用
+func (this *HTTPFirewallPolicyDAO) importRuleGroups(tx *dbs.Tx, oldGroupRefs []*firewallconfigs.HTTPFirewallRuleGroupRef, oldGroups []*firewallconfigs.HTTPFirewallRuleGroup, newGroups []*firewallconfigs.HTTPFirewallRuleGroup, mode HTTPFirewallPolicyImportMode) ([]*firewallconfigs.HTTPFirewallRuleGroupRef, error) {
+	var resultGroupRefs = []*firewallconfigs.HTTPFirewallRuleGroupRef{}
+	if mode == HTTPFirewallPolicyImportModeMerge {
+		resultGroupRefs = append(resultGroupRefs, oldGroupRefs...)
+	}
+
+	for _, newGroup := range newGroups {
+		var oldGroup = findFirewallRuleGroup(oldGroups, newGroup)
+		if oldGroup == nil {
+			groupId, err := SharedHTTPFirewallRuleGroupDAO.CreateGroupFromConfig(tx, newGroup)
+			if err != nil {
+				return nil, err
+			}
+			resultGroupRefs = append(resultGroupRefs, &firewallconfigs.HTTPFirewallRuleGroupRef{
+				IsOn:    true,
+				GroupId: groupId,
+			})
+			continue
+		}
+
+		// 规则集
+		var setRefs = []*firewallconfigs.HTTPFirewallRuleSetRef{}
+		var importedSetMap = map[*firewallconfigs.HTTPFirewallRuleSet]bool{}
+		for index, oldSet := range oldGroup.Sets {
+			var oldSetRef = &firewallconfigs.HTTPFirewallRuleSetRef{IsOn: true, SetId: oldSet.Id}
+			if index < len(oldGroup.SetRefs) {
+				oldSetRef = oldGroup.SetRefs[index]
+			}
+
+			var newSet = findFirewallRuleSet(newGroup.Sets, oldSet)
+			if newSet == nil || importedSetMap[newSet] {
+				if mode == HTTPFirewallPolicyImportModeMerge {
+					setRefs = append(setRefs, oldSetRef)
+				}
+				continue
+			}
+			importedSetMap[newSet] = true
+
+			newSet.Id = oldSet.Id
+			_, err := SharedHTTPFirewallRuleSetDAO.CreateOrUpdateSetFromConfig(tx, newSet)
+			if err != nil {
+				return nil, err
+			}
+			setRefs = append(setRefs, oldSetRef)
+		}
+		for _, newSet := range newGroup.Sets {
+			if importedSetMap[newSet] {
+				continue
+			}
+			setId, err := SharedHTTPFirewallRuleSetDAO.CreateOrUpdateSetFromConfig(tx, newSet)
+			if err != nil {
+				return nil, err
+			}
+			setRefs = append(setRefs, &firewallconfigs.HTTPFirewallRuleSetRef{
+				IsOn:  true,
+				SetId: setId,
+			})
+		}
+		setRefsJSON, err := json.Marshal(setRefs)
+		if err != nil {
+			return nil, err
+		}
+
+		err = SharedHTTPFirewallRuleGroupDAO.UpdateGroup(tx, oldGroup.Id, newGroup.IsOn, oldGroup.Name, oldGroup.Code, newGroup.Description)
+		if err != nil {
+			return nil, err
+		}
+		err = SharedHTTPFirewallRuleGroupDAO.UpdateGroupSets(tx, oldGroup.Id, setRefsJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		if mode == HTTPFirewallPolicyImportModeReplace {
+			var groupRef = &firewallconfigs.HTTPFirewallRuleGroupRef{IsOn: true, GroupId: oldGroup.Id}
+			for _, oldGroupRef := range oldGroupRefs {
+				if oldGroupRef.GroupId == oldGroup.Id {
+					groupRef = oldGroupRef
+					break
+				}
+			}
+			resultGroupRefs = append(resultGroupRefs, groupRef)
+		}
+	}
+
+	return resultGroupRefs, nil
+}
+
+// 导入策略自有名单中的IP
+func (this *HTTPFirewallPolicyDAO) importListItems(tx *dbs.Tx, listId int64, documentList *HTTPFirewallPolicyDocumentIPList, mode HTTPFirewallPolicyImportMode) error {
+	var rows = []*ipitemutils.Row{}
+	for _, item := range documentList.Items {
+		value, ok := ipitemutils.NormalizeValue(item.Value)
+		if !ok {
+			continue
+		}
+		rows = append(rows, &ipitemutils.Row{
+			Value:     value,
+			ExpiredAt: item.ExpiredAt,
+			Reason:    item.Reason,
+		})
+	}
+	if len(rows) > 0 {
+		_, err := SharedIPItemDAO.ImportIPItems(tx, listId, rows, 0, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mode != HTTPFirewallPolicyImportModeReplace {
+		return nil
+	}
+
+	// 禁用文档中不存在的IP
+	var newValueMap = this.findDocumentListValueMap(documentList)
+	existItems, err := SharedIPItemDAO.FindAllEnabledItemsWithListId(tx, listId)
+	if err != nil {
+		return err
+	}
+	var disablingItemIds = []int64{}
+	for _, item := range existItems {
+		if item.Type == IPItemTypeAll {
+			continue
+		}
+		value, ok := ipitemutils.NormalizeValue(item.ComposeValue())
+		if ok && newValueMap[value] {
+			continue
+		}
+		disablingItemIds = append(disablingItemIds, int64(item.Id))
+	}
+	if len(disablingItemIds) == 0 {
+		return nil
+	}
+	version, err := SharedIPListDAO.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+	err = SharedIPItemDAO.updateItemsState(tx, disablingItemIds, IPItemStateDisabled, version)
+	if err != nil {
+		return err
+	}
+	return SharedIPListDAO.NotifyUpdate(tx, listId, NodeTaskTypeIPItemChanged)
+}
+
+// 去除分组中的ID，并将记录IP动作中的名单ID转换为名单名称和代号
+func (this *HTTPFirewallPolicyDAO) exportRuleGroup(tx *dbs.Tx, group *firewallconfigs.HTTPFirewallRuleGroup) error {
+	group.Id = 0
+	group.SetRefs = nil
+	for _, set := range group.Sets {
+		set.Id = 0
+		set.RuleRefs = nil
+		for _, rule := range set.Rules {
+			rule.Id = 0
+		}
+
+		for _, action := range set.Actions {
+			if action.Code != firewallconfigs.HTTPFirewallActionRecordIP || action.Options == nil {
+				continue
+			}
+			delete(action.Options, "ipListIsDeleted")
+			var ipListId = action.Options.GetInt64("ipListId")
+			if ipListId <= 0 {
+				continue
+			}
+			list, err := SharedIPListDAO.FindEnabledIPList(tx, ipListId, nil)
+			if err != nil {
+				return err
+			}
+			action.Options["ipListId"] = 0
+			if list != nil {
+				action.Options["ipListName"] = list.Name
+				action.Options["ipListCode"] = list.Code
+			}
+		}
+	}
+	return nil
+}
+
+// 将记录IP动作中的名单名称转换为当前系统中的名单ID，找不到时使用默认名单
+func (this *HTTPFirewallPolicyDAO) resolveRecordIPActions(tx *dbs.Tx, set *firewallconfigs.HTTPFirewallRuleSet) error {
+	for _, action := range set.Actions {
+		if action.Code != firewallconfigs.HTTPFirewallActionRecordIP || action.Options == nil {
+			continue
+		}
+		var listName = action.Options.GetString("ipListName")
+		var listCode = action.Options.GetString("ipListCode")
+		delete(action.Options, "ipListName")
+		delete(action.Options, "ipListCode")
+		if len(listName) == 0 && len(listCode) == 0 {
+			continue
+		}
+		listId, err := this.findImportingPublicListId(tx, &HTTPFirewallPolicyDocumentIPList{
+			Type: action.Options.GetString("type"),
+			Name: listName,
+			Code: listCode,
+		})
+		if err != nil {
+			return err
+		}
+		action.Options["ipListId"] = listId
+	}
+	return nil
+}
+
+// 查找文档中引用的公共名单在当前系统中的ID
+func (this *HTTPFirewallPolicyDAO) findImportingPublicListId(tx *dbs.Tx, documentList *HTTPFirewallPolicyDocumentIPList) (int64, error) {
+	if len(documentList.Code) > 0 {
+		listId, err := SharedIPListDAO.FindIPListIdWithCode(tx, documentList.Code)
+		if err != nil || listId > 0 {
+			return listId, err
+		}
+	}
+	if len(documentList.Name) == 0 {
+		return 0, nil
+	}
+	var query = SharedIPListDAO.Query(tx).
+		ResultPk().
+		State(IPListStateEnabled).
+		Attr("isPublic", true).
+		Attr("name", documentList.Name)
+	if len(documentList.Type) > 0 {
+		query.Attr("type", documentList.Type)
+	}
+	return query.
+		AscPk().
+		FindInt64Col(0)
+}
+
+func (this *HTTPFirewallPolicyDAO) findInboundListRef(inbound *firewallconfigs.HTTPFirewallInboundConfig, listType ipconfigs.IPListType) *ipconfigs.IPListRef {
+	if inbound == nil {
+		return nil
+	}
+	switch listType {
+	case ipconfigs.IPListTypeWhite:
+		return inbound.AllowListRef
+	case ipconfigs.IPListTypeBlack:
+		return inbound.DenyListRef
+	case ipconfigs.IPListTypeGrey:
+		return inbound.GreyListRef
+	}
+	return nil
+}
+
+func (this *HTTPFirewallPolicyDAO) findInboundPublicListRefs(inbound *firewallconfigs.HTTPFirewallInboundConfig, listType ipconfigs.IPListType) []*ipconfigs.IPListRef {
+	if inbound == nil {
+		return nil
+	}
+	switch listType {
+	case ipconfigs.IPListTypeWhite:
+		return inbound.PublicAllowListRefs
+	case ipconfigs.IPListTypeBlack:
+		return inbound.PublicDenyListRefs
+	case ipconfigs.IPListTypeGrey:
+		return inbound.PublicGreyListRefs
+	}
+	return nil
+}
+
+func (this *HTTPFirewallPolicyDAO) containsListRef(listRefs []*ipconfigs.IPListRef, listId int64) bool {
+	for _, listRef := range listRefs {
+		if listRef.ListId == listId {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *HTTPFirewallPolicyDAO) findListValueMap(tx *dbs.Tx, listId int64) (map[string]bool, error) {
+	items, err := SharedIPItemDAO.FindAllEnabledItemsWithListId(tx, listId)
+	if err != nil {
+		return nil, err
+	}
+	var valueMap = map[string]bool{}
+	for _, item := range items {
+		if item.Type == IPItemTypeAll {
+			continue
+		}
+		value, ok := ipitemutils.NormalizeValue(item.ComposeValue())
+		if ok {
+			valueMap[value] = true
+		}
+	}
+	return valueMap, nil
+}
+
+func (this *HTTPFirewallPolicyDAO) findDocumentListValueMap(documentList *HTTPFirewallPolicyDocumentIPList) map[string]bool {
+	var valueMap = map[string]bool{}
+	for _, item := range documentList.Items {
+		value, ok := ipitemutils.NormalizeValue(item.Value)
+		if ok {
+			valueMap[value] = true
+		}
+	}
+	return valueMap
+}
+
+func (this *HTTPFirewallPolicyDAO) findDocumentGroups(config *firewallconfigs.HTTPFirewallPolicy) []*firewallconfigs.HTTPFirewallRuleGroup {
+	var groups = []*firewallconfigs.HTTPFirewallRuleGroup{}
+	if config.Inbound != nil {
+		groups = append(groups, config.Inbound.Groups...)
+	}
+	if config.Outbound != nil {
+		groups = append(groups, config.Outbound.Groups...)
+	}
+	return groups
+}
+
+func (this *HTTPFirewallPolicyDAO) validateImportMode(mode HTTPFirewallPolicyImportMode) error {
+	if mode != HTTPFirewallPolicyImportModeMerge && mode != HTTPFirewallPolicyImportModeReplace {
+		return errors.New("invalid import mode '" + mode + "'")
+	}
+	return nil
+}
+
+// 将json.Number转换为整数或浮点数，以便YAML中输出为数字
+func (this *HTTPFirewallPolicyDAO) normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = this.normalizeJSONNumbers(item)
+		}
+		return v
+	case []any:
+		for index, item := range v {
+			v[index] = this.normalizeJSONNumbers(item)
+		}
+		return v
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			i, err := v.Int64()
+			if err == nil {
+				return i
+			}
+		}
+		f, err := v.Float64()
+		if err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return value
+}
@@ -0,0 +1,386 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/regexputils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/wafutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+const (
+	httpFirewallSimulationDefaultMaxRequests = 10_000
+	httpFirewallSimulationMaxRequests        = 100_000
+	httpFirewallSimulationDefaultMaxSamples  = 5
+	httpFirewallSimulationMaxSamples         = 20
+)
+
+// HTTPFirewallSimulationOptions 模拟选项
+// RuleSet、RuleSetId 和 PolicyId 三者选其一：前两者只模拟单个规则集（不管是否启用），PolicyId 模拟策略中所有启用的入站规则集
+type HTTPFirewallSimulationOptions struct {
+	PolicyId    int64
+	RuleSetId   int64
+	RuleSet     *firewallconfigs.HTTPFirewallRuleSet
+	ServerId    int64
+	UserId      int64
+	Day         string // YYYYMMDD
+	HourFrom    string
+	HourTo      string
+	MaxRequests int
+	MaxSamples  int
+}
+
+// HTTPFirewallSimulationResult 模拟结果
+type HTTPFirewallSimulationResult struct {
+	CountRequests int64                                `json:"countRequests"`
+	CountMatched  int64                                `json:"countMatched"`
+	CountBlocked  int64                                `json:"countBlocked"`
+	IsTruncated   bool                                 `json:"isTruncated"` // 是否因为达到最大请求数而提前结束
+	RuleSets      []*HTTPFirewallSimulationRuleSetStat `json:"ruleSets"`
+	Servers       []*HTTPFirewallSimulationServerStat  `json:"servers"`
+}
+
+// HTTPFirewallSimulationRuleSetStat 规则集匹配统计
+type HTTPFirewallSimulationRuleSetStat struct {
+	RuleSetId    int64                             `json:"ruleSetId"`
+	RuleSetName  string                            `json:"ruleSetName"`
+	GroupId      int64                             `json:"groupId"`
+	GroupName    string                            `json:"groupName"`
+	IsBlocking   bool                              `json:"isBlocking"`
+	CountMatched int64                             `json:"countMatched"`
+	Rules        []*HTTPFirewallSimulationRuleStat `json:"rules"`
+}
+
+// HTTPFirewallSimulationRuleStat 规则匹配统计
+type HTTPFirewallSimulationRuleStat struct {
+	RuleId       int64                           `json:"ruleId"`
+	Summary      string                          `json:"summary"`
+	IsSupported  bool                            `json:"isSupported"` // 不支持的规则（比如SQL注入检测、CC统计）无法在API节点上模拟
+	CountMatched int64                           `json:"countMatched"`
+	Samples      []*HTTPFirewallSimulationSample `json:"samples"`
+}
+
+// HTTPFirewallSimulationServerStat 单个网站的统计
+type HTTPFirewallSimulationServerStat struct {
+	ServerId      int64   `json:"serverId"`
+	CountRequests int64   `json:"countRequests"`
+	CountMatched  int64   `json:"countMatched"`
+	CountBlocked  int64   `json:"countBlocked"`
+	BlockRate     float64 `json:"blockRate"` // 预计拦截比例，0-1
+}
+
+// HTTPFirewallSimulationSample 匹配的请求示例
+type HTTPFirewallSimulationSample struct {
+	RequestId  string `json:"requestId"`
+	ServerId   int64  `json:"serverId"`
+	CreatedAt  int64  `json:"createdAt"`
+	RemoteAddr string `json:"remoteAddr"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+}
+
+// SimulateFirewall 使用访问日志中记录的请求模拟WAF规则
+func (this *HTTPFirewallPolicyDAO) SimulateFirewall(tx *dbs.Tx, options *HTTPFirewallSimulationOptions) (*HTTPFirewallSimulationResult, error) {
+	if !regexputils.YYYYMMDD.MatchString(options.Day) {
+		return nil, errors.New("invalid 'day': " + options.Day)
+	}
+
+	var maxRequests = options.MaxRequests
+	if maxRequests <= 0 {
+		maxRequests = httpFirewallSimulationDefaultMaxRequests
+	} else if maxRequests > httpFirewallSimulationMaxRequests {
+		maxRequests = httpFirewallSimulationMaxRequests
+	}
+	var maxSamples = options.MaxSamples
+	if maxSamples <= 0 {
+		maxSamples = httpFirewallSimulationDefaultMaxSamples
+	} else if maxSamples > httpFirewallSimulationMaxSamples {
+		maxSamples = httpFirewallSimulationMaxSamples
+	}
+
+	ruleSets, serverId, err := this.findSimulationRuleSets(tx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// 统计对象
+	var result = &HTTPFirewallSimulationResult{
+		RuleSets: []*HTTPFirewallSimulationRuleSetStat{},
+		Servers:  []*HTTPFirewallSimulationServerStat{},
+	}
+	var ruleStatMap = map[*wafutils.Rule]*HTTPFirewallSimulationRuleStat{}
+	var setStatMap = map[*wafutils.RuleSet]*HTTPFirewallSimulationRuleSetStat{}
+	for _, ruleSet := range ruleSets {
+		var setStat = &HTTPFirewallSimulationRuleSetStat{
+			RuleSetId:   ruleSet.Id,
+			RuleSetName: ruleSet.Name,
+			GroupId:     ruleSet.GroupId,
+			GroupName:   ruleSet.GroupName,
+			IsBlocking:  ruleSet.IsBlocking(),
+			Rules:       []*HTTPFirewallSimulationRuleStat{},
+		}
+		for _, rule := range ruleSet.Rules {
+			var ruleStat = &HTTPFirewallSimulationRuleStat{
+				RuleId:      rule.Id,
+				Summary:     rule.Summary(),
+				IsSupported: rule.IsSupported(),
+				Samples:     []*HTTPFirewallSimulationSample{},
+			}
+			ruleStatMap[rule] = ruleStat
+			setStat.Rules = append(setStat.Rules, ruleStat)
+		}
+		setStatMap[ruleSet] = setStat
+		result.RuleSets = append(result.RuleSets, setStat)
+	}
+	var serverStatMap = map[int64]*HTTPFirewallSimulationServerStat{}
+
+	// 回放访问日志
+	latestPartition, err := SharedHTTPAccessLogManager.FindLatestPartition(options.Day)
+	if err != nil {
+		return nil, err
+	}
+
+	var replay = func(accessLog *HTTPAccessLog) error {
+		req, err := this.composeSimulationRequest(accessLog)
+		if err != nil {
+			return err
+		}
+
+		var serverStat = serverStatMap[req.ServerId]
+		if serverStat == nil {
+			serverStat = &HTTPFirewallSimulationServerStat{ServerId: req.ServerId}
+			serverStatMap[req.ServerId] = serverStat
+		}
+		serverStat.CountRequests++
+		result.CountRequests++
+
+		var isMatched = false
+		var isBlocked = false
+		for _, ruleSet := range ruleSets {
+			matchedRules, ok := ruleSet.Match(req)
+			if !ok {
+				continue
+			}
+			isMatched = true
+			setStatMap[ruleSet].CountMatched++
+			for _, rule := range matchedRules {
+				var ruleStat = ruleStatMap[rule]
+				ruleStat.CountMatched++
+				if len(ruleStat.Samples) < maxSamples {
+					ruleStat.Samples = append(ruleStat.Samples, &HTTPFirewallSimulationSample{
+						RequestId:  req.RequestId,
+						ServerId:   req.ServerId,
+						CreatedAt:  req.CreatedAt,
+						RemoteAddr: req.RemoteAddr,
+						Method:     req.Method,
+						URL:        req.URL(),
+					})
+				}
+			}
+			if ruleSet.IsFinal() {
+				isBlocked = ruleSet.IsBlocking()
+				break
+			}
+		}
+		if isMatched {
+			serverStat.CountMatched++
+			result.CountMatched++
+		}
+		if isBlocked {
+			serverStat.CountBlocked++
+			result.CountBlocked++
+		}
+		return nil
+	}
+
+	const pageSize = 1000
+	for partition := int32(0); partition <= latestPartition && !result.IsTruncated; partition++ {
+		var lastRequestId = ""
+		for {
+			accessLogs, nextLastRequestId, hasMore, err := SharedHTTPAccessLogDAO.ListAccessLogs(tx, partition, lastRequestId, pageSize, options.Day, options.HourFrom, options.HourTo, 0, 0, serverId, false, false, 0, 0, 0, false, options.UserId, "", "", "")
+			if err != nil {
+				return nil, err
+			}
+			for _, accessLog := range accessLogs {
+				if result.CountRequests >= int64(maxRequests) {
+					result.IsTruncated = true
+					break
+				}
+				err = replay(accessLog)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if result.IsTruncated || !hasMore || len(accessLogs) == 0 {
+				break
+			}
+			lastRequestId = nextLastRequestId
+		}
+	}
+
+	// 网站统计，按照匹配数量倒序排列
+	for _, serverStat := range serverStatMap {
+		if serverStat.CountRequests > 0 {
+			serverStat.BlockRate = float64(serverStat.CountBlocked) / float64(serverStat.CountRequests)
+		}
+		result.Servers = append(result.Servers, serverStat)
+	}
+	sort.Slice(result.Servers, func(i, j int) bool {
+		if result.Servers[i].CountMatched != result.Servers[j].CountMatched {
+			return result.Servers[i].CountMatched > result.Servers[j].CountMatched
+		}
+		return result.Servers[i].ServerId < result.Servers[j].ServerId
+	})
+
+	return result, nil
+}
+
+// 查找需要模拟的规则集，同时返回需要回放的网站ID
+func (this *HTTPFirewallPolicyDAO) findSimulationRuleSets(tx *dbs.Tx, options *HTTPFirewallSimulationOptions) (ruleSets []*wafutils.RuleSet, serverId int64, err error) {
+	serverId = options.ServerId
+
+	var setConfig = options.RuleSet
+	if setConfig == nil && options.RuleSetId > 0 {
+		setConfig, err = SharedHTTPFirewallRuleSetDAO.ComposeFirewallRuleSet(tx, options.RuleSetId, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		if setConfig == nil {
+			return nil, 0, errors.New("can not find rule set with id '" + strconv.FormatInt(options.RuleSetId, 10) + "'")
+		}
+	}
+
+	if setConfig != nil {
+		ruleSet, err := this.composeSimulationRuleSet(nil, setConfig)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []*wafutils.RuleSet{ruleSet}, serverId, nil
+	}
+
+	if options.PolicyId <= 0 {
+		return nil, 0, errors.New("'policyId', 'ruleSetId' or 'ruleSet' should be specified")
+	}
+
+	policyConfig, err := this.ComposeFirewallPolicy(tx, options.PolicyId, false, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if policyConfig == nil {
+		return nil, 0, ErrNotFound
+	}
+
+	// 网站自己的策略只回放此网站的日志
+	if serverId <= 0 && policyConfig.ServerId > 0 {
+		serverId = policyConfig.ServerId
+	}
+
+	if policyConfig.Inbound != nil {
+		for _, group := range policyConfig.Inbound.Groups {
+			if !group.IsOn {
+				continue
+			}
+			for _, set := range group.Sets {
+				if !set.IsOn {
+					continue
+				}
+				ruleSet, err := this.composeSimulationRuleSet(group, set)
+				if err != nil {
+					return nil, 0, err
+				}
+				ruleSets = append(ruleSets, ruleSet)
+			}
+		}
+	}
+
+	return ruleSets, serverId, nil
+}
+
+func (this *HTTPFirewallPolicyDAO) composeSimulationRuleSet(group *firewallconfigs.HTTPFirewallRuleGroup, set *firewallconfigs.HTTPFirewallRuleSet) (*wafutils.RuleSet, error) {
+	var ruleSet = &wafutils.RuleSet{
+		Id:        set.Id,
+		Name:      set.Name,
+		Connector: set.Connector,
+	}
+	if group != nil {
+		ruleSet.GroupId = group.Id
+		ruleSet.GroupName = group.Name
+	}
+	for _, ruleConfig := range set.Rules {
+		if !ruleConfig.IsOn {
+			continue
+		}
+		var rule = &wafutils.Rule{
+			Id:                ruleConfig.Id,
+			Param:             ruleConfig.Param,
+			Operator:          ruleConfig.Operator,
+			Value:             ruleConfig.Value,
+			IsCaseInsensitive: ruleConfig.IsCaseInsensitive,
+		}
+		for _, filter := range ruleConfig.ParamFilters {
+			rule.Filters = append(rule.Filters, filter.Code)
+		}
+		ruleSet.Rules = append(ruleSet.Rules, rule)
+	}
+	for _, action := range set.Actions {
+		ruleSet.ActionCodes = append(ruleSet.ActionCodes, action.Code)
+	}
+
+	err := ruleSet.Init()
+	if err != nil {
+		return nil, errors.New("rule set '" + set.Name + "': " + err.Error())
+	}
+	return ruleSet, nil
+}
+
+// 从访问日志中还原请求
+func (this *HTTPFirewallPolicyDAO) composeSimulationRequest(accessLog *HTTPAccessLog) (*wafutils.Request, error) {
+	pbAccessLog, err := accessLog.ToPB()
+	if err != nil {
+		return nil, err
+	}
+
+	var req = &wafutils.Request{
+		RequestId:     accessLog.RequestId,
+		ServerId:      int64(accessLog.ServerId),
+		CreatedAt:     int64(accessLog.CreatedAt),
+		Method:        pbAccessLog.RequestMethod,
+		Scheme:        pbAccessLog.Scheme,
+		Proto:         pbAccessLog.Proto,
+		Host:          pbAccessLog.Host,
+		URI:           pbAccessLog.RequestURI,
+		Path:          pbAccessLog.RequestPath,
+		RemoteAddr:    pbAccessLog.RemoteAddr,
+		RawRemoteAddr: pbAccessLog.RawRemoteAddr,
+		UserAgent:     pbAccessLog.UserAgent,
+		Referer:       pbAccessLog.Referer,
+		ContentType:   pbAccessLog.ContentType,
+		Length:        pbAccessLog.RequestLength,
+		Header:        http.Header{},
+		Body:          accessLog.RequestBody,
+	}
+	for name, values := range pbAccessLog.Header {
+		if values == nil {
+			continue
+		}
+		for _, value := range values.Values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	var info = iplibrary.LookupIP(req.RemoteAddr)
+	if info != nil && info.IsOk() {
+		req.Country = info.CountryName()
+		req.Province = info.ProvinceName()
+		req.City = info.CityName()
+		req.Provider = info.ProviderName()
+	}
+	return req, nil
+}
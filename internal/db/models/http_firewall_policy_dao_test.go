@@ -3,6 +3,7 @@ package models
 import (
 	"testing"
 
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/dbs"
 )
@@ -37,3 +38,123 @@ func TestHTTPFirewallPolicyDAO_FindEnabledFirewallPolicyIdWithRuleGroupId(t *tes
 	}
 	t.Log("policyIds:", policyIds)
 }
+
+func TestDiffFirewallPolicy(t *testing.T) {
+	var oldConfig = &firewallconfigs.HTTPFirewallPolicy{
+		Inbound: &firewallconfigs.HTTPFirewallInboundConfig{
+			Groups: []*firewallconfigs.HTTPFirewallRuleGroup{
+				{
+					Code: "sqlInjection",
+					Name: "SQL注入",
+					IsOn: true,
+					Sets: []*firewallconfigs.HTTPFirewallRuleSet{
+						{
+							Code: "7010",
+							Name: "SQL注入检测",
+							IsOn: true,
+							Rules: []*firewallconfigs.HTTPFirewallRule{
+								{IsOn: true, Param: "${requestAll}", Operator: "contains sql injection"},
+							},
+						},
+					},
+				},
+				{
+					Name: "自定义",
+					IsOn: true,
+				},
+			},
+		},
+	}
+	var newConfig = &firewallconfigs.HTTPFirewallPolicy{
+		Inbound: &firewallconfigs.HTTPFirewallInboundConfig{
+			Groups: []*firewallconfigs.HTTPFirewallRuleGroup{
+				{
+					Code: "sqlInjection",
+					Name: "SQL Injection",
+					IsOn: true,
+					Sets: []*firewallconfigs.HTTPFirewallRuleSet{
+						{
+							Code: "7010",
+							Name: "SQL注入检测",
+							IsOn: true,
+							Rules: []*firewallconfigs.HTTPFirewallRule{
+								{IsOn: true, Param: "${requestAll}", Operator: "contains sql injection"},
+								{IsOn: true, Param: "${requestURI}", Operator: "match", Value: "union.+select"},
+							},
+						},
+					},
+				},
+				{
+					Name: "XSS",
+					IsOn: true,
+				},
+			},
+			Region: &firewallconfigs.HTTPFirewallRegionConfig{
+				IsOn:           true,
+				DenyCountryIds: []int64{1},
+			},
+		},
+	}
+
+	var countChanges = func(changes []*HTTPFirewallPolicyChange, action string, kind string) int {
+		var count = 0
+		for _, change := range changes {
+			if change.Action == action && change.Kind == kind {
+				count++
+			}
+		}
+		return count
+	}
+
+	{
+		var changes = DiffFirewallPolicy(oldConfig, newConfig, HTTPFirewallPolicyImportModeMerge)
+		if countChanges(changes, HTTPFirewallPolicyChangeActionAdded, HTTPFirewallPolicyChangeKindRule) != 1 ||
+			countChanges(changes, HTTPFirewallPolicyChangeActionAdded, HTTPFirewallPolicyChangeKindGroup) != 1 ||
+			countChanges(changes, HTTPFirewallPolicyChangeActionRemoved, HTTPFirewallPolicyChangeKindGroup) != 0 ||
+			countChanges(changes, HTTPFirewallPolicyChangeActionChanged, HTTPFirewallPolicyChangeKindRegion) != 1 {
+			t.Fatal("unexpected merge changes")
+		}
+	}
+
+	{
+		var changes = DiffFirewallPolicy(oldConfig, newConfig, HTTPFirewallPolicyImportModeReplace)
+		if countChanges(changes, HTTPFirewallPolicyChangeActionRemoved, HTTPFirewallPolicyChangeKindGroup) != 1 {
+			t.Fatal("unexpected replace changes")
+		}
+	}
+}
+
+func TestHTTPFirewallPolicyDAO_EncodeFirewallPolicyDocument(t *testing.T) {
+	var dao = &HTTPFirewallPolicyDAO{}
+	var document = &HTTPFirewallPolicyDocument{
+		Version:    HTTPFirewallPolicyDocumentVersion,
+		ExportedAt: 1700000000,
+		Policy: &firewallconfigs.HTTPFirewallPolicy{
+			Id:   1,
+			Name: "test",
+			Inbound: &firewallconfigs.HTTPFirewallInboundConfig{
+				Groups: []*firewallconfigs.HTTPFirewallRuleGroup{
+					{Id: 2, Name: "SQL注入", Sets: []*firewallconfigs.HTTPFirewallRuleSet{{Id: 3, Name: "SQL注入检测"}}},
+				},
+			},
+		},
+	}
+
+	for _, format := range []string{HTTPFirewallPolicyDocumentFormatJSON, HTTPFirewallPolicyDocumentFormatYAML} {
+		data, err := dao.EncodeFirewallPolicyDocument(document, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decodedDocument, err := dao.DecodeFirewallPolicyDocument(data)
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		if decodedDocument.ExportedAt != document.ExportedAt || decodedDocument.Policy.Name != "test" {
+			t.Fatal(format, "unexpected document")
+		}
+		var set = decodedDocument.Policy.Inbound.Groups[0].Sets[0]
+		if set.Name != "SQL注入检测" || set.Id != 0 {
+			t.Fatal(format, "ids should be removed")
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/rulepackutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+const (
+	HTTPFirewallRulePackStateEnabled  = 1 // 已启用
+	HTTPFirewallRulePackStateDisabled = 0 // 已禁用
+)
+
+// SettingCodeHTTPFirewallRulePackConfig 规则包设置代号
+const SettingCodeHTTPFirewallRulePackConfig = "httpFirewallRulePackConfig"
+
+// HTTPFirewallRulePackPayload 规则包内容
+// 分组和规则集必须有代号，升级时通过代号查找策略中对应的分组和规则集
+type HTTPFirewallRulePackPayload struct {
+	rulepackutils.Header
+
+	Inbound  []*firewallconfigs.HTTPFirewallRuleGroup `json:"inbound"`
+	Outbound []*firewallconfigs.HTTPFirewallRuleGroup `json:"outbound"`
+}
+
+// DecodeFirewallRulePackPayload 解析并校验规则包内容
+func DecodeFirewallRulePackPayload(data []byte) (*HTTPFirewallRulePackPayload, error) {
+	var payload = &HTTPFirewallRulePackPayload{}
+	err := json.Unmarshal(data, payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode rule pack payload failed: %w", err)
+	}
+	err = payload.Header.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload.Inbound) == 0 && len(payload.Outbound) == 0 {
+		return nil, errors.New("rule pack should contain at least one group")
+	}
+
+	for _, groups := range [][]*firewallconfigs.HTTPFirewallRuleGroup{payload.Inbound, payload.Outbound} {
+		var groupCodeMap = map[string]bool{}
+		for _, group := range groups {
+			if group == nil {
+				return nil, errors.New("invalid group in rule pack")
+			}
+			if len(group.Code) == 0 {
+				return nil, errors.New("group '" + group.Name + "' in rule pack should have a code")
+			}
+			if groupCodeMap[group.Code] {
+				return nil, errors.New("duplicated group code '" + group.Code + "' in rule pack")
+			}
+			groupCodeMap[group.Code] = true
+
+			// 去除ID，防止修改到当前系统中的数据
+			group.Id = 0
+			group.SetRefs = nil
+			group.IsTemplate = false
+
+			var setCodeMap = map[string]bool{}
+			for _, set := range group.Sets {
+				if set == nil {
+					return nil, errors.New("invalid set in group '" + group.Code + "'")
+				}
+				if len(set.Code) == 0 {
+					return nil, errors.New("set '" + set.Name + "' in group '" + group.Code + "' should have a code")
+				}
+				if setCodeMap[set.Code] {
+					return nil, errors.New("duplicated set code '" + set.Code + "' in group '" + group.Code + "'")
+				}
+				setCodeMap[set.Code] = true
+
+				set.Id = 0
+				set.RuleRefs = nil
+				for _, rule := range set.Rules {
+					if rule == nil {
+						return nil, errors.New("invalid rule in set '" + set.Code + "'")
+					}
+					rule.Id = 0
+				}
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+type HTTPFirewallRulePackDAO dbs.DAO
+
+func NewHTTPFirewallRulePackDAO() *HTTPFirewallRulePackDAO {
+	return dbs.NewDAO(&HTTPFirewallRulePackDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeHTTPFirewallRulePacks",
+			Model:  new(HTTPFirewallRulePack),
+			PkName: "id",
+		},
+	}).(*HTTPFirewallRulePackDAO)
+}
+
+var SharedHTTPFirewallRulePackDAO *HTTPFirewallRulePackDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedHTTPFirewallRulePackDAO = NewHTTPFirewallRulePackDAO()
+	})
+}
+
+// DisableHTTPFirewallRulePack 禁用条目
+func (this *HTTPFirewallRulePackDAO) DisableHTTPFirewallRulePack(tx *dbs.Tx, packId int64) error {
+	pack, err := this.FindEnabledHTTPFirewallRulePack(tx, packId)
+	if err != nil {
+		return err
+	}
+	if pack == nil {
+		return nil
+	}
+
+	// 正在被订阅的版本不能删除
+	countSubscriptions, err := SharedHTTPFirewallRulePackSubscriptionDAO.CountSubscriptionsWithVersion(tx, pack.Code, pack.Version)
+	if err != nil {
+		return err
+	}
+	if countSubscriptions > 0 {
+		return errors.New("the rule pack version is being subscribed by " + fmt.Sprintf("%d", countSubscriptions) + " policies")
+	}
+
+	_, err = this.Query(tx).
+		Pk(packId).
+		Set("state", HTTPFirewallRulePackStateDisabled).
+		Update()
+	return err
+}
+
+// FindEnabledHTTPFirewallRulePack 查找启用中的条目
+func (this *HTTPFirewallRulePackDAO) FindEnabledHTTPFirewallRulePack(tx *dbs.Tx, packId int64) (*HTTPFirewallRulePack, error) {
+	result, err := this.Query(tx).
+		Pk(packId).
+		State(HTTPFirewallRulePackStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*HTTPFirewallRulePack), err
+}
+
+// FindEnabledRulePackWithVersion 根据代号和版本查找规则包
+func (this *HTTPFirewallRulePackDAO) FindEnabledRulePackWithVersion(tx *dbs.Tx, code string, version string) (*HTTPFirewallRulePack, error) {
+	result, err := this.Query(tx).
+		Attr("code", code).
+		Attr("version", version).
+		State(HTTPFirewallRulePackStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*HTTPFirewallRulePack), err
+}
+
+// FindAllEnabledRulePacks 列出所有规则包，同一个代号的规则包按版本从新到旧排列
+// code 为空时列出所有代号的规则包
+func (this *HTTPFirewallRulePackDAO) FindAllEnabledRulePacks(tx *dbs.Tx, code string) (result []*HTTPFirewallRulePack, err error) {
+	var query = this.Query(tx).
+		State(HTTPFirewallRulePackStateEnabled).
+		Result("id", "code", "name", "version", "description", "keyId", "isSigned", "digest", "createdAt")
+	if len(code) > 0 {
+		query.Attr("code", code)
+	}
+	_, err = query.
+		Slice(&result).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Code != result[j].Code {
+			return result[i].Code < result[j].Code
+		}
+		return rulepackutils.CompareVersion(result[i].Version, result[j].Version) > 0
+	})
+	return
+}
+
+// FindLatestRulePack 查找某个代号的最新版本
+func (this *HTTPFirewallRulePackDAO) FindLatestRulePack(tx *dbs.Tx, code string) (*HTTPFirewallRulePack, error) {
+	packs, err := this.FindAllEnabledRulePacks(tx, code)
+	if err != nil || len(packs) == 0 {
+		return nil, err
+	}
+	return this.FindEnabledHTTPFirewallRulePack(tx, int64(packs[0].Id))
+}
+
+// ImportRulePack 导入规则包
+// 同一个版本已经导入时，如果内容一致则返回已有的规则包，否则返回错误
+func (this *HTTPFirewallRulePackDAO) ImportRulePack(tx *dbs.Tx, adminId int64, data []byte) (packId int64, err error) {
+	config, err := this.ReadRulePackConfig(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	bundle, header, err := rulepackutils.ParseBundle(data)
+	if err != nil {
+		return 0, err
+	}
+	if bundle.IsSigned() {
+		err = bundle.Verify(config.PublicKeys)
+		if err != nil {
+			return 0, err
+		}
+	} else if !config.AllowUnsigned {
+		return 0, errors.New("unsigned rule pack is not allowed")
+	}
+
+	// 校验内容
+	_, err = DecodeFirewallRulePackPayload(bundle.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var digest = bundle.Digest()
+	existPack, err := this.FindEnabledRulePackWithVersion(tx, header.Code, header.Version)
+	if err != nil {
+		return 0, err
+	}
+	if existPack != nil {
+		if existPack.Digest != digest {
+			return 0, errors.New("rule pack '" + header.Code + "' version '" + header.Version + "' already exists with different content")
+		}
+		return int64(existPack.Id), nil
+	}
+
+	bundleJSON, err := json.Marshal(bundle)
+	if err != nil {
+		return 0, err
+	}
+
+	var op = NewHTTPFirewallRulePackOperator()
+	op.Code = header.Code
+	op.Name = header.Name
+	op.Version = header.Version
+	op.Description = header.Description
+	op.KeyId = bundle.KeyId
+	op.IsSigned = bundle.IsSigned()
+	op.Digest = digest
+	op.Data = bundleJSON
+	op.AdminId = adminId
+	op.CreatedAt = time.Now().Unix()
+	op.State = HTTPFirewallRulePackStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// ImportRulePackFromFile 从API节点本地文件中导入规则包
+func (this *HTTPFirewallRulePackDAO) ImportRulePackFromFile(tx *dbs.Tx, adminId int64, path string) (packId int64, err error) {
+	data, err := rulepackutils.LoadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return this.ImportRulePack(tx, adminId, data)
+}
+
+// ImportRulePackFromMirror 从内部镜像中导入规则包
+func (this *HTTPFirewallRulePackDAO) ImportRulePackFromMirror(tx *dbs.Tx, adminId int64, code string, version string) (packId int64, err error) {
+	config, err := this.ReadRulePackConfig(tx)
+	if err != nil {
+		return 0, err
+	}
+	data, err := rulepackutils.Fetch(config, code, version)
+	if err != nil {
+		return 0, fmt.Errorf("fetch rule pack from mirror failed: %w", err)
+	}
+
+	_, header, err := rulepackutils.ParseBundle(data)
+	if err != nil {
+		return 0, err
+	}
+	if header.Code != code || header.Version != version {
+		return 0, errors.New("mirror returned rule pack '" + header.Code + "' version '" + header.Version + "', expected '" + code + "' version '" + version + "'")
+	}
+	return this.ImportRulePack(tx, adminId, data)
+}
+
+// ReadRulePackConfig 读取规则包设置
+func (this *HTTPFirewallRulePackDAO) ReadRulePackConfig(tx *dbs.Tx) (*rulepackutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeHTTPFirewallRulePackConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = rulepackutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// UpdateRulePackConfig 修改规则包设置
+func (this *HTTPFirewallRulePackDAO) UpdateRulePackConfig(tx *dbs.Tx, config *rulepackutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeHTTPFirewallRulePackConfig, configJSON)
+}
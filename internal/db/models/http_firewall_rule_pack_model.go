@@ -0,0 +1,40 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import "github.com/iwind/TeaGo/dbs"
+
+// HTTPFirewallRulePack WAF规则包
+type HTTPFirewallRulePack struct {
+	Id          uint32   `field:"id"`          // ID
+	Code        string   `field:"code"`        // 代号
+	Name        string   `field:"name"`        // 名称
+	Version     string   `field:"version"`     // 版本
+	Description string   `field:"description"` // 描述
+	KeyId       string   `field:"keyId"`       // 签名公钥ID
+	IsSigned    bool     `field:"isSigned"`    // 是否已签名
+	Digest      string   `field:"digest"`      // 内容摘要
+	Data        dbs.JSON `field:"data"`        // 规则包内容
+	AdminId     uint32   `field:"adminId"`     // 管理员ID
+	CreatedAt   uint64   `field:"createdAt"`   // 创建时间
+	State       uint8    `field:"state"`       // 状态
+}
+
+type HTTPFirewallRulePackOperator struct {
+	Id          interface{} // ID
+	Code        interface{} // 代号
+	Name        interface{} // 名称
+	Version     interface{} // 版本
+	Description interface{} // 描述
+	KeyId       interface{} // 签名公钥ID
+	IsSigned    interface{} // 是否已签名
+	Digest      interface{} // 内容摘要
+	Data        interface{} // 规则包内容
+	AdminId     interface{} // 管理员ID
+	CreatedAt   interface{} // 创建时间
+	State       interface{} // 状态
+}
+
+func NewHTTPFirewallRulePackOperator() *HTTPFirewallRulePackOperator {
+	return &HTTPFirewallRulePackOperator{}
+}
@@ -0,0 +1,16 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/rulepackutils"
+)
+
+// DecodePayload 解析规则包内容
+func (this *HTTPFirewallRulePack) DecodePayload() (*HTTPFirewallRulePackPayload, error) {
+	bundle, _, err := rulepackutils.ParseBundle(this.Data)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFirewallRulePackPayload(bundle.Payload)
+}
@@ -0,0 +1,548 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+)
+
+const (
+	HTTPFirewallRulePackSubscriptionStateEnabled  = 1 // 已启用
+	HTTPFirewallRulePackSubscriptionStateDisabled = 0 // 已禁用
+)
+
+// HTTPFirewallRulePackOverride 策略中对规则包的修改，升级时会被保留
+type HTTPFirewallRulePackOverride struct {
+	Kind  HTTPFirewallPolicyChangeKind `json:"kind"`  // group|set|rule
+	Path  string                       `json:"path"`  // 比如 inbound/SQL注入/SQL注入检测
+	Field string                       `json:"field"` // isOn|actions|removed
+	Value string                       `json:"value"` // 策略中的值
+}
+
+// HTTPFirewallRulePackUpgrade 规则包升级计划
+type HTTPFirewallRulePackUpgrade struct {
+	FromVersion string                          `json:"fromVersion"`
+	ToVersion   string                          `json:"toVersion"`
+	Changes     []*HTTPFirewallPolicyChange     `json:"changes"`   // 升级后策略的变化
+	Overrides   []*HTTPFirewallRulePackOverride `json:"overrides"` // 保留的策略修改
+
+	subscription *HTTPFirewallRulePackSubscription
+	inbound      []*firewallconfigs.HTTPFirewallRuleGroup // 合并策略修改后的入站分组
+	outbound     []*firewallconfigs.HTTPFirewallRuleGroup // 合并策略修改后的出站分组
+}
+
+type HTTPFirewallRulePackSubscriptionDAO dbs.DAO
+
+func NewHTTPFirewallRulePackSubscriptionDAO() *HTTPFirewallRulePackSubscriptionDAO {
+	return dbs.NewDAO(&HTTPFirewallRulePackSubscriptionDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeHTTPFirewallRulePackSubscriptions",
+			Model:  new(HTTPFirewallRulePackSubscription),
+			PkName: "id",
+		},
+	}).(*HTTPFirewallRulePackSubscriptionDAO)
+}
+
+var SharedHTTPFirewallRulePackSubscriptionDAO *HTTPFirewallRulePackSubscriptionDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedHTTPFirewallRulePackSubscriptionDAO = NewHTTPFirewallRulePackSubscriptionDAO()
+	})
+}
+
+// DisableSubscription 取消订阅
+// 策略中的分组会被保留，但不再跟随规则包升级
+func (this *HTTPFirewallRulePackSubscriptionDAO) DisableSubscription(tx *dbs.Tx, subscriptionId int64) error {
+	_, err := this.Query(tx).
+		Pk(subscriptionId).
+		Set("state", HTTPFirewallRulePackSubscriptionStateDisabled).
+		Update()
+	return err
+}
+
+// FindEnabledSubscription 查找启用中的订阅
+func (this *HTTPFirewallRulePackSubscriptionDAO) FindEnabledSubscription(tx *dbs.Tx, subscriptionId int64) (*HTTPFirewallRulePackSubscription, error) {
+	result, err := this.Query(tx).
+		Pk(subscriptionId).
+		State(HTTPFirewallRulePackSubscriptionStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*HTTPFirewallRulePackSubscription), err
+}
+
+// FindAllEnabledSubscriptionsWithPolicyId 查找策略的所有订阅
+func (this *HTTPFirewallRulePackSubscriptionDAO) FindAllEnabledSubscriptionsWithPolicyId(tx *dbs.Tx, policyId int64) (result []*HTTPFirewallRulePackSubscription, err error) {
+	_, err = this.Query(tx).
+		Attr("policyId", policyId).
+		State(HTTPFirewallRulePackSubscriptionStateEnabled).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CountSubscriptionsWithVersion 计算订阅某个规则包版本的策略数量
+func (this *HTTPFirewallRulePackSubscriptionDAO) CountSubscriptionsWithVersion(tx *dbs.Tx, packCode string, version string) (int64, error) {
+	return this.Query(tx).
+		Attr("packCode", packCode).
+		Attr("version", version).
+		State(HTTPFirewallRulePackSubscriptionStateEnabled).
+		Where("policyId IN (SELECT id FROM " + SharedHTTPFirewallPolicyDAO.Table + " WHERE state=1)").
+		Count()
+}
+
+// Subscribe 策略订阅规则包的某个版本，规则包中的分组会被添加到策略中
+func (this *HTTPFirewallRulePackSubscriptionDAO) Subscribe(tx *dbs.Tx, adminId int64, policyId int64, packCode string, version string) (subscriptionId int64, err error) {
+	existSubscriptionId, err := this.Query(tx).
+		Attr("policyId", policyId).
+		Attr("packCode", packCode).
+		State(HTTPFirewallRulePackSubscriptionStateEnabled).
+		ResultPk().
+		FindInt64Col(0)
+	if err != nil {
+		return 0, err
+	}
+	if existSubscriptionId > 0 {
+		return 0, errors.New("the policy has already subscribed rule pack '" + packCode + "'")
+	}
+
+	payload, err := this.findPackPayload(tx, packCode, version)
+	if err != nil {
+		return 0, err
+	}
+
+	policy, err := SharedHTTPFirewallPolicyDAO.FindEnabledHTTPFirewallPolicy(tx, policyId)
+	if err != nil {
+		return 0, err
+	}
+	if policy == nil {
+		return 0, ErrNotFound
+	}
+	policyConfig, err := SharedHTTPFirewallPolicyDAO.ComposeFirewallPolicy(tx, policyId, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	if policyConfig == nil {
+		return 0, ErrNotFound
+	}
+
+	var subscriptionGroups = []*HTTPFirewallRulePackSubscriptionGroup{}
+	for _, isInbound := range []bool{true, false} {
+		var groups = payload.Outbound
+		if isInbound {
+			groups = payload.Inbound
+		}
+		for _, group := range groups {
+			for _, set := range group.Sets {
+				err = SharedHTTPFirewallPolicyDAO.resolveRecordIPActions(tx, set)
+				if err != nil {
+					return 0, err
+				}
+			}
+			groupId, err := SharedHTTPFirewallRuleGroupDAO.CreateGroupFromConfig(tx, group)
+			if err != nil {
+				return 0, err
+			}
+			var groupRef = &firewallconfigs.HTTPFirewallRuleGroupRef{
+				IsOn:    true,
+				GroupId: groupId,
+			}
+			if isInbound {
+				policyConfig.Inbound.GroupRefs = append(policyConfig.Inbound.GroupRefs, groupRef)
+			} else {
+				policyConfig.Outbound.GroupRefs = append(policyConfig.Outbound.GroupRefs, groupRef)
+			}
+			subscriptionGroups = append(subscriptionGroups, &HTTPFirewallRulePackSubscriptionGroup{
+				Code:      group.Code,
+				GroupId:   groupId,
+				IsInbound: isInbound,
+			})
+		}
+	}
+
+	err = this.updatePolicyGroupRefs(tx, policy, policyConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	groupsJSON, err := json.Marshal(subscriptionGroups)
+	if err != nil {
+		return 0, err
+	}
+	var op = NewHTTPFirewallRulePackSubscriptionOperator()
+	op.PolicyId = policyId
+	op.PackCode = packCode
+	op.Version = version
+	op.Groups = groupsJSON
+	op.AdminId = adminId
+	op.CreatedAt = time.Now().Unix()
+	op.UpdatedAt = time.Now().Unix()
+	op.State = HTTPFirewallRulePackSubscriptionStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// PreviewUpgrade 预览升级到某个版本后策略的变化
+func (this *HTTPFirewallRulePackSubscriptionDAO) PreviewUpgrade(tx *dbs.Tx, subscriptionId int64, version string) (*HTTPFirewallRulePackUpgrade, error) {
+	subscription, err := this.FindEnabledSubscription(tx, subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil {
+		return nil, ErrNotFound
+	}
+
+	pinnedPayload, err := this.findPackPayload(tx, subscription.PackCode, subscription.Version)
+	if err != nil {
+		return nil, err
+	}
+	newPayload, err := this.findPackPayload(tx, subscription.PackCode, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgrade = &HTTPFirewallRulePackUpgrade{
+		FromVersion:  subscription.Version,
+		ToVersion:    version,
+		Changes:      []*HTTPFirewallPolicyChange{},
+		Overrides:    []*HTTPFirewallRulePackOverride{},
+		subscription: subscription,
+	}
+
+	for _, isInbound := range []bool{true, false} {
+		var path = "outbound"
+		var pinnedGroups = pinnedPayload.Outbound
+		var newGroups = newPayload.Outbound
+		if isInbound {
+			path = "inbound"
+			pinnedGroups = pinnedPayload.Inbound
+			newGroups = newPayload.Inbound
+		}
+
+		localGroups, err := this.findLocalGroups(tx, subscription, isInbound)
+		if err != nil {
+			return nil, err
+		}
+
+		mergedGroups, overrides := MergeFirewallRulePackGroups(path, pinnedGroups, localGroups, newGroups)
+		upgrade.Overrides = append(upgrade.Overrides, overrides...)
+		upgrade.Changes = append(upgrade.Changes, diffFirewallRuleGroups(path, localGroups, mergedGroups, HTTPFirewallPolicyImportModeReplace)...)
+		if isInbound {
+			upgrade.inbound = mergedGroups
+		} else {
+			upgrade.outbound = mergedGroups
+		}
+	}
+
+	return upgrade, nil
+}
+
+// Upgrade 升级到某个版本，保留策略中对规则包的修改
+func (this *HTTPFirewallRulePackSubscriptionDAO) Upgrade(tx *dbs.Tx, subscriptionId int64, version string) (*HTTPFirewallRulePackUpgrade, error) {
+	upgrade, err := this.PreviewUpgrade(tx, subscriptionId, version)
+	if err != nil {
+		return nil, err
+	}
+	var subscription = upgrade.subscription
+	var policyId = int64(subscription.PolicyId)
+
+	policy, err := SharedHTTPFirewallPolicyDAO.FindEnabledHTTPFirewallPolicy(tx, policyId)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, ErrNotFound
+	}
+	policyConfig, err := SharedHTTPFirewallPolicyDAO.ComposeFirewallPolicy(tx, policyId, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if policyConfig == nil {
+		return nil, ErrNotFound
+	}
+
+	var subscriptionGroups = []*HTTPFirewallRulePackSubscriptionGroup{}
+	for _, isInbound := range []bool{true, false} {
+		var mergedGroups = upgrade.outbound
+		var policyGroupRefs = policyConfig.Outbound.GroupRefs
+		if isInbound {
+			mergedGroups = upgrade.inbound
+			policyGroupRefs = policyConfig.Inbound.GroupRefs
+		}
+
+		for _, group := range mergedGroups {
+			for _, set := range group.Sets {
+				err = SharedHTTPFirewallPolicyDAO.resolveRecordIPActions(tx, set)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		localGroups, err := this.findLocalGroups(tx, subscription, isInbound)
+		if err != nil {
+			return nil, err
+		}
+		var localGroupIds = []int64{}
+		var localGroupRefs = []*firewallconfigs.HTTPFirewallRuleGroupRef{}
+		for _, group := range localGroups {
+			localGroupIds = append(localGroupIds, group.Id)
+		}
+		for _, groupRef := range policyGroupRefs {
+			if lists.ContainsInt64(localGroupIds, groupRef.GroupId) {
+				localGroupRefs = append(localGroupRefs, groupRef)
+			}
+		}
+
+		newGroupRefs, err := SharedHTTPFirewallPolicyDAO.importRuleGroups(tx, localGroupRefs, localGroups, mergedGroups, HTTPFirewallPolicyImportModeReplace)
+		if err != nil {
+			return nil, err
+		}
+
+		// 替换策略中原有的分组引用，其他分组保持不变
+		var resultGroupRefs = []*firewallconfigs.HTTPFirewallRuleGroupRef{}
+		var inserted = false
+		for _, groupRef := range policyGroupRefs {
+			if !lists.ContainsInt64(localGroupIds, groupRef.GroupId) {
+				resultGroupRefs = append(resultGroupRefs, groupRef)
+				continue
+			}
+			if !inserted {
+				resultGroupRefs = append(resultGroupRefs, newGroupRefs...)
+				inserted = true
+			}
+		}
+		if !inserted {
+			resultGroupRefs = append(resultGroupRefs, newGroupRefs...)
+		}
+		if isInbound {
+			policyConfig.Inbound.GroupRefs = resultGroupRefs
+		} else {
+			policyConfig.Outbound.GroupRefs = resultGroupRefs
+		}
+
+		// importRuleGroups() 按照分组顺序返回分组引用
+		for index, group := range mergedGroups {
+			if index < len(newGroupRefs) {
+				subscriptionGroups = append(subscriptionGroups, &HTTPFirewallRulePackSubscriptionGroup{
+					Code:      group.Code,
+					GroupId:   newGroupRefs[index].GroupId,
+					IsInbound: isInbound,
+				})
+			}
+		}
+	}
+
+	err = this.updatePolicyGroupRefs(tx, policy, policyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	groupsJSON, err := json.Marshal(subscriptionGroups)
+	if err != nil {
+		return nil, err
+	}
+	var op = NewHTTPFirewallRulePackSubscriptionOperator()
+	op.Id = subscription.Id
+	op.Version = version
+	op.Groups = groupsJSON
+	op.UpdatedAt = time.Now().Unix()
+	err = this.Save(tx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return upgrade, nil
+}
+
+// MergeFirewallRulePackGroups 将策略中对规则包的修改合并到新版本中
+// pinnedGroups 为当前锁定版本中的分组，localGroups 为策略中的分组，newGroups 为新版本中的分组
+// 目前保留的修改包括：分组、规则集和规则的启用状态，规则集的动作，以及从策略中移除的分组
+func MergeFirewallRulePackGroups(path string, pinnedGroups []*firewallconfigs.HTTPFirewallRuleGroup, localGroups []*firewallconfigs.HTTPFirewallRuleGroup, newGroups []*firewallconfigs.HTTPFirewallRuleGroup) (mergedGroups []*firewallconfigs.HTTPFirewallRuleGroup, overrides []*HTTPFirewallRulePackOverride) {
+	mergedGroups = []*firewallconfigs.HTTPFirewallRuleGroup{}
+	overrides = []*HTTPFirewallRulePackOverride{}
+
+	// 复制一份，避免修改规则包中的数据
+	var copiedGroups = []*firewallconfigs.HTTPFirewallRuleGroup{}
+	groupsJSON, err := json.Marshal(newGroups)
+	if err == nil {
+		_ = json.Unmarshal(groupsJSON, &copiedGroups)
+	}
+
+	for _, group := range copiedGroups {
+		var groupPath = path + "/" + group.Name
+		var pinnedGroup = findFirewallRuleGroup(pinnedGroups, group)
+		var localGroup = findFirewallRuleGroup(localGroups, group)
+		if pinnedGroup == nil {
+			// 新版本中新增的分组
+			mergedGroups = append(mergedGroups, group)
+			continue
+		}
+		if localGroup == nil {
+			// 已经从策略中移除的分组不再添加
+			overrides = append(overrides, &HTTPFirewallRulePackOverride{
+				Kind:  HTTPFirewallPolicyChangeKindGroup,
+				Path:  groupPath,
+				Field: "removed",
+			})
+			continue
+		}
+
+		if localGroup.IsOn != pinnedGroup.IsOn {
+			group.IsOn = localGroup.IsOn
+			overrides = append(overrides, &HTTPFirewallRulePackOverride{
+				Kind:  HTTPFirewallPolicyChangeKindGroup,
+				Path:  groupPath,
+				Field: "isOn",
+				Value: formatOverrideBool(localGroup.IsOn),
+			})
+		}
+
+		for _, set := range group.Sets {
+			var setPath = groupPath + "/" + set.Name
+			var pinnedSet = findFirewallRuleSet(pinnedGroup.Sets, set)
+			var localSet = findFirewallRuleSet(localGroup.Sets, set)
+			if pinnedSet == nil || localSet == nil {
+				continue
+			}
+
+			if localSet.IsOn != pinnedSet.IsOn {
+				set.IsOn = localSet.IsOn
+				overrides = append(overrides, &HTTPFirewallRulePackOverride{
+					Kind:  HTTPFirewallPolicyChangeKindSet,
+					Path:  setPath,
+					Field: "isOn",
+					Value: formatOverrideBool(localSet.IsOn),
+				})
+			}
+
+			localActionsJSON, _ := json.Marshal(localSet.Actions)
+			pinnedActionsJSON, _ := json.Marshal(pinnedSet.Actions)
+			if string(localActionsJSON) != string(pinnedActionsJSON) {
+				set.Actions = localSet.Actions
+				overrides = append(overrides, &HTTPFirewallRulePackOverride{
+					Kind:  HTTPFirewallPolicyChangeKindSet,
+					Path:  setPath,
+					Field: "actions",
+					Value: string(localActionsJSON),
+				})
+			}
+
+			// 规则没有代号，使用不包含启用状态的规则内容匹配
+			var pinnedRuleMap = map[string]*firewallconfigs.HTTPFirewallRule{}
+			for _, rule := range pinnedSet.Rules {
+				pinnedRuleMap[composeFirewallRuleKey(rule)] = rule
+			}
+			var localRuleMap = map[string]*firewallconfigs.HTTPFirewallRule{}
+			for _, rule := range localSet.Rules {
+				localRuleMap[composeFirewallRuleKey(rule)] = rule
+			}
+			for _, rule := range set.Rules {
+				var ruleKey = composeFirewallRuleKey(rule)
+				pinnedRule, ok := pinnedRuleMap[ruleKey]
+				if !ok {
+					continue
+				}
+				localRule, ok := localRuleMap[ruleKey]
+				if !ok || localRule.IsOn == pinnedRule.IsOn {
+					continue
+				}
+				rule.IsOn = localRule.IsOn
+				overrides = append(overrides, &HTTPFirewallRulePackOverride{
+					Kind:  HTTPFirewallPolicyChangeKindRule,
+					Path:  setPath + "/" + ruleKey,
+					Field: "isOn",
+					Value: formatOverrideBool(localRule.IsOn),
+				})
+			}
+		}
+
+		mergedGroups = append(mergedGroups, group)
+	}
+
+	return
+}
+
+// 查找规则包版本的内容
+func (this *HTTPFirewallRulePackSubscriptionDAO) findPackPayload(tx *dbs.Tx, packCode string, version string) (*HTTPFirewallRulePackPayload, error) {
+	pack, err := SharedHTTPFirewallRulePackDAO.FindEnabledRulePackWithVersion(tx, packCode, version)
+	if err != nil {
+		return nil, err
+	}
+	if pack == nil {
+		return nil, errors.New("rule pack '" + packCode + "' version '" + version + "' not found")
+	}
+	return pack.DecodePayload()
+}
+
+// 查找订阅在策略中对应的分组，已经从策略中移除的分组会被忽略
+func (this *HTTPFirewallRulePackSubscriptionDAO) findLocalGroups(tx *dbs.Tx, subscription *HTTPFirewallRulePackSubscription, isInbound bool) ([]*firewallconfigs.HTTPFirewallRuleGroup, error) {
+	policyConfig, err := SharedHTTPFirewallPolicyDAO.ComposeFirewallPolicy(tx, int64(subscription.PolicyId), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if policyConfig == nil {
+		return nil, ErrNotFound
+	}
+	var policyGroups = policyConfig.Outbound.Groups
+	if isInbound {
+		policyGroups = policyConfig.Inbound.Groups
+	}
+
+	var result = []*firewallconfigs.HTTPFirewallRuleGroup{}
+	for _, subscriptionGroup := range subscription.DecodeGroups() {
+		if subscriptionGroup.IsInbound != isInbound {
+			continue
+		}
+		for _, group := range policyGroups {
+			if group.Id == subscriptionGroup.GroupId {
+				// 分组代号可能在策略中被修改过，这里使用规则包中的代号进行匹配
+				group.Code = subscriptionGroup.Code
+				result = append(result, group)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// 保存策略中的分组引用
+func (this *HTTPFirewallRulePackSubscriptionDAO) updatePolicyGroupRefs(tx *dbs.Tx, policy *HTTPFirewallPolicy, policyConfig *firewallconfigs.HTTPFirewallPolicy) error {
+	var inbound = policyConfig.Inbound
+	var outbound = policyConfig.Outbound
+	inbound.Groups = nil
+	outbound.Groups = nil
+	inboundJSON, err := json.Marshal(inbound)
+	if err != nil {
+		return err
+	}
+	outboundJSON, err := json.Marshal(outbound)
+	if err != nil {
+		return err
+	}
+	return SharedHTTPFirewallPolicyDAO.UpdateFirewallPolicyInboundAndOutbound(tx, int64(policy.Id), int64(policy.UserId), int64(policy.ServerId), inboundJSON, outboundJSON, true)
+}
+
+func composeFirewallRuleKey(rule *firewallconfigs.HTTPFirewallRule) string {
+	var copiedRule = *rule
+	copiedRule.IsOn = true
+	return summarizeFirewallRule(&copiedRule)
+}
+
+func formatOverrideBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestMergeFirewallRulePackGroups(t *testing.T) {
+	var pinnedGroups = []*firewallconfigs.HTTPFirewallRuleGroup{
+		{
+			Code: "sqlInjection",
+			Name: "SQL注入",
+			IsOn: true,
+			Sets: []*firewallconfigs.HTTPFirewallRuleSet{
+				{
+					Code:    "7010",
+					Name:    "SQL注入检测",
+					IsOn:    true,
+					Actions: []*firewallconfigs.HTTPFirewallActionConfig{{Code: "block"}},
+					Rules: []*firewallconfigs.HTTPFirewallRule{
+						{IsOn: true, Param: "${requestAll}", Operator: "contains sql injection"},
+					},
+				},
+			},
+		},
+		{
+			Code: "xss",
+			Name: "XSS",
+			IsOn: true,
+		},
+	}
+
+	// 策略中禁用了规则并修改了动作，移除了XSS分组
+	var localGroups = []*firewallconfigs.HTTPFirewallRuleGroup{
+		{
+			Id:   100,
+			Code: "sqlInjection",
+			Name: "SQL注入",
+			IsOn: true,
+			Sets: []*firewallconfigs.HTTPFirewallRuleSet{
+				{
+					Id:      200,
+					Code:    "7010",
+					Name:    "SQL注入检测",
+					IsOn:    true,
+					Actions: []*firewallconfigs.HTTPFirewallActionConfig{{Code: "tag"}},
+					Rules: []*firewallconfigs.HTTPFirewallRule{
+						{IsOn: false, Param: "${requestAll}", Operator: "contains sql injection"},
+					},
+				},
+			},
+		},
+	}
+
+	var newGroups = []*firewallconfigs.HTTPFirewallRuleGroup{
+		{
+			Code:        "sqlInjection",
+			Name:        "SQL注入",
+			Description: "v2",
+			IsOn:        true,
+			Sets: []*firewallconfigs.HTTPFirewallRuleSet{
+				{
+					Code:    "7010",
+					Name:    "SQL注入检测",
+					IsOn:    true,
+					Actions: []*firewallconfigs.HTTPFirewallActionConfig{{Code: "block"}},
+					Rules: []*firewallconfigs.HTTPFirewallRule{
+						{IsOn: true, Param: "${requestAll}", Operator: "contains sql injection"},
+						{IsOn: true, Param: "${requestURI}", Operator: "match", Value: "union.+select"},
+					},
+				},
+			},
+		},
+		{
+			Code: "xss",
+			Name: "XSS",
+			IsOn: true,
+		},
+		{
+			Code: "scanner",
+			Name: "扫描器",
+			IsOn: true,
+		},
+	}
+
+	mergedGroups, overrides := MergeFirewallRulePackGroups("inbound", pinnedGroups, localGroups, newGroups)
+	for _, override := range overrides {
+		t.Log(override.Kind, override.Path, override.Field, override.Value)
+	}
+	if len(overrides) != 3 {
+		t.Fatal("expected 3 overrides, but got", len(overrides))
+	}
+	if len(mergedGroups) != 2 || mergedGroups[0].Code != "sqlInjection" || mergedGroups[1].Code != "scanner" {
+		t.Fatal("invalid merged groups")
+	}
+
+	var set = mergedGroups[0].Sets[0]
+	if set.Actions[0].Code != "tag" {
+		t.Fatal("set actions should be preserved")
+	}
+	if set.Rules[0].IsOn || !set.Rules[1].IsOn {
+		t.Fatal("rule states should be preserved")
+	}
+	if mergedGroups[0].Description != "v2" {
+		t.Fatal("group should be upgraded")
+	}
+
+	// 规则包中的数据不能被修改
+	if newGroups[0].Sets[0].Actions[0].Code != "block" {
+		t.Fatal("new groups should not be changed")
+	}
+
+	var changes = diffFirewallRuleGroups("inbound", localGroups, mergedGroups, HTTPFirewallPolicyImportModeReplace)
+	for _, change := range changes {
+		t.Log(change.Action, change.Kind, change.Path, change.Old, "=>", change.New)
+	}
+}
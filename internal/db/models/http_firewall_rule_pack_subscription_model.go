@@ -0,0 +1,34 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import "github.com/iwind/TeaGo/dbs"
+
+// HTTPFirewallRulePackSubscription WAF策略订阅的规则包
+type HTTPFirewallRulePackSubscription struct {
+	Id        uint32   `field:"id"`        // ID
+	PolicyId  uint32   `field:"policyId"`  // 策略ID
+	PackCode  string   `field:"packCode"`  // 规则包代号
+	Version   string   `field:"version"`   // 锁定的版本
+	Groups    dbs.JSON `field:"groups"`    // 规则包分组和策略中分组的对应关系
+	AdminId   uint32   `field:"adminId"`   // 管理员ID
+	CreatedAt uint64   `field:"createdAt"` // 创建时间
+	UpdatedAt uint64   `field:"updatedAt"` // 升级时间
+	State     uint8    `field:"state"`     // 状态
+}
+
+type HTTPFirewallRulePackSubscriptionOperator struct {
+	Id        interface{} // ID
+	PolicyId  interface{} // 策略ID
+	PackCode  interface{} // 规则包代号
+	Version   interface{} // 锁定的版本
+	Groups    interface{} // 规则包分组和策略中分组的对应关系
+	AdminId   interface{} // 管理员ID
+	CreatedAt interface{} // 创建时间
+	UpdatedAt interface{} // 升级时间
+	State     interface{} // 状态
+}
+
+func NewHTTPFirewallRulePackSubscriptionOperator() *HTTPFirewallRulePackSubscriptionOperator {
+	return &HTTPFirewallRulePackSubscriptionOperator{}
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+)
+
+// HTTPFirewallRulePackSubscriptionGroup 规则包中的分组在策略中对应的分组
+type HTTPFirewallRulePackSubscriptionGroup struct {
+	Code      string `json:"code"`      // 规则包中的分组代号
+	GroupId   int64  `json:"groupId"`   // 策略中的分组ID
+	IsInbound bool   `json:"isInbound"` // 是否为入站分组
+}
+
+// DecodeGroups 解析分组对应关系
+func (this *HTTPFirewallRulePackSubscription) DecodeGroups() []*HTTPFirewallRulePackSubscriptionGroup {
+	var result = []*HTTPFirewallRulePackSubscriptionGroup{}
+	if IsNotNull(this.Groups) {
+		_ = json.Unmarshal(this.Groups, &result)
+	}
+	return result
+}
+
+// FindGroupIds 策略中对应的所有分组ID
+func (this *HTTPFirewallRulePackSubscription) FindGroupIds(isInbound bool) []int64 {
+	var result = []int64{}
+	for _, group := range this.DecodeGroups() {
+		if group.IsInbound == isInbound && group.GroupId > 0 {
+			result = append(result, group.GroupId)
+		}
+	}
+	return result
+}
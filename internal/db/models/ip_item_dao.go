@@ -9,6 +9,8 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	"github.com/TeaOSLab/EdgeAPI/internal/goman"
 	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipitemutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
@@ -44,6 +46,15 @@ const (
 	IPItemTypeIPv4 IPItemType = "ipv4" // IPv4
 	IPItemTypeIPv6 IPItemType = "ipv6" // IPv6
 	IPItemTypeAll  IPItemType = "all"  // 所有IP
+	IPItemTypeASN  IPItemType = "asn"  // 某个ASN中的所有IP
+)
+
+type IPItemSource = string
+
+const (
+	IPItemSourceManual IPItemSource = ""       // 手动添加或者由节点上报
+	IPItemSourceFeed   IPItemSource = "feed"   // 订阅源
+	IPItemSourceImport IPItemSource = "import" // 批量导入
 )
 
 type IPItemDAO dbs.DAO
@@ -394,6 +405,17 @@ func (this *IPItemDAO) CreateIPItem(tx *dbs.Tx,
 	var autoAdded = firewallconfigs.IsGlobalListId(listId) || sourceNodeId > 0 || sourceServerId > 0 || sourceHTTPFirewallPolicyId > 0
 	if autoAdded {
 		op.IsRead = 0
+
+		// 根据重复违规次数使用名单的封禁阶梯
+		if itemType != IPItemTypeAll {
+			escalatedExpiredAt, ok, err := this.escalate(tx, listId, value, ipFrom, ipTo)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				op.ExpiredAt = escalatedExpiredAt
+			}
+		}
 	}
 
 	op.State = IPItemStateEnabled
@@ -419,6 +441,31 @@ func (this *IPItemDAO) CreateIPItem(tx *dbs.Tx,
 	return itemId, nil
 }
 
+// 记录违规并根据名单的封禁阶梯计算过期时间
+func (this *IPItemDAO) escalate(tx *dbs.Tx, listId int64, value string, ipFrom string, ipTo string) (expiredAt int64, ok bool, err error) {
+	config, err := SharedIPListDAO.FindIPListEscalationCacheable(tx, listId)
+	if err != nil || config == nil {
+		return 0, false, err
+	}
+
+	var ip = value
+	if len(ip) == 0 {
+		ip = ipFrom
+		if len(ipTo) > 0 && ipTo != ipFrom {
+			ip += "-" + ipTo
+		}
+	}
+	if len(ip) == 0 {
+		return 0, false, nil
+	}
+
+	_, expiredAt, err = SharedIPListOffenderDAO.Offend(tx, listId, ip, config)
+	if err != nil {
+		return 0, false, err
+	}
+	return expiredAt, true, nil
+}
+
 // UpdateIPItem 修改IP
 func (this *IPItemDAO) UpdateIPItem(tx *dbs.Tx, itemId int64, value string, ipFrom string, ipTo string, expiredAt int64, reason string, itemType IPItemType, eventLevel string) error {
 	if itemId <= 0 {
@@ -537,9 +584,28 @@ func (this *IPItemDAO) ListIPItemsAfterVersion(tx *dbs.Tx, version int64, size i
 		// 这里不要设置状态参数，因为我们要知道哪些是删除的
 		Gt("version", version).
 		Asc("version").
+		AscPk().
 		Limit(size).
 		Slice(&result).
 		FindAll()
+	if err != nil || size <= 0 || int64(len(result)) < size {
+		return
+	}
+
+	// 批量同步时多个条目会使用同一个版本号，这里需要将最后一个版本号的条目全部返回，防止下次查询时遗漏
+	var lastItem = result[len(result)-1]
+	var moreItems []*IPItem
+	_, err = this.Query(tx).
+		UseIndex("version").
+		Attr("version", lastItem.Version).
+		Gt("id", lastItem.Id).
+		AscPk().
+		Slice(&moreItems).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, moreItems...)
 	return
 }
 
@@ -557,12 +623,15 @@ func (this *IPItemDAO) FindEnabledItemContainsIP(tx *dbs.Tx, listId int64, ip st
 		Attr("listId", listId).
 		State(IPItemStateEnabled)
 
+	var asnValue = this.composeASNValue(ip)
 	if iputils.IsIPv4(ip) {
-		query.Where("(type='all' OR ipFrom =:ip OR INET_ATON(:ip) BETWEEN INET_ATON(ipFrom) AND INET_ATON(ipTo))").
-			Param("ip", ip)
+		query.Where("(type='all' OR (type='asn' AND value=:asnValue) OR ipFrom =:ip OR INET_ATON(:ip) BETWEEN INET_ATON(ipFrom) AND INET_ATON(ipTo))").
+			Param("ip", ip).
+			Param("asnValue", asnValue)
 	} else if iputils.IsIPv6(ip) {
-		query.Where("(type='all' OR ipFrom =:ip OR HEX(INET6_ATON(:ip)) BETWEEN HEX(INET6_ATON(ipFrom)) AND HEX(INET6_ATON(ipTo)))").
-			Param("ip", ip)
+		query.Where("(type='all' OR (type='asn' AND value=:asnValue) OR ipFrom =:ip OR HEX(INET6_ATON(:ip)) BETWEEN HEX(INET6_ATON(ipFrom)) AND HEX(INET6_ATON(ipTo)))").
+			Param("ip", ip).
+			Param("asnValue", asnValue)
 	} else {
 		return nil, nil
 	}
@@ -925,6 +994,19 @@ func (this *IPItemDAO) ParseIPValue(value string) (newValue string, ipFrom strin
 	return
 }
 
+// ParseASNValue 解析 "AS12345" 形式的ASN值
+func (this *IPItemDAO) ParseASNValue(value string) (newValue string, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 3 || !strings.EqualFold(value[:2], "AS") {
+		return
+	}
+	number, ok := iplibraryutils.ParseASN(value)
+	if !ok {
+		return
+	}
+	return iplibraryutils.FormatASN(number), true
+}
+
 // NotifyUpdate 通知更新
 func (this *IPItemDAO) NotifyUpdate(tx *dbs.Tx, itemId int64) error {
 	// 获取ListId
@@ -1023,3 +1105,324 @@ func (this *IPItemDAO) NotifyUpdate(tx *dbs.Tx, itemId int64) error {
 
 	return nil
 }
+
+// SyncFeedItems 将订阅源中的IP同步到名单中
+// 只对比名单中来源为订阅源的条目：新增缺少的条目，禁用订阅源中已经不存在的条目；所有变更使用同一个版本号，只通知一次
+func (this *IPItemDAO) SyncFeedItems(tx *dbs.Tx, listId int64, values []string, reason string) (countCreated int, countDisabled int, err error) {
+	if listId <= 0 {
+		return 0, 0, errors.New("invalid 'listId'")
+	}
+
+	// 当前条目
+	var existValueMap = map[string]bool{}
+	var disablingItemIds = []int64{}
+	var valueMap = map[string]bool{}
+	for _, value := range values {
+		valueMap[value] = true
+	}
+
+	var lastId int64
+	for {
+		var items []*IPItem
+		_, err = this.Query(tx).
+			Result("id", "value").
+			Attr("listId", listId).
+			Attr("source", IPItemSourceFeed).
+			State(IPItemStateEnabled).
+			Gt("id", lastId).
+			AscPk().
+			Limit(10000).
+			Slice(&items).
+			FindAll()
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		for _, item := range items {
+			lastId = int64(item.Id)
+
+			// 删除已经不存在的和重复的
+			if !valueMap[item.Value] || existValueMap[item.Value] {
+				disablingItemIds = append(disablingItemIds, int64(item.Id))
+				continue
+			}
+			existValueMap[item.Value] = true
+		}
+	}
+
+	// 先创建处于禁用状态、版本为0的条目，边缘节点不会读取这些条目，等全部创建完成后再统一启用
+	var creatingItemIds = []int64{}
+	for _, value := range values {
+		if existValueMap[value] {
+			continue
+		}
+		newValue, ipFrom, ipTo, ok := this.ParseIPValue(value)
+		if !ok {
+			continue
+		}
+
+		var itemType = IPItemTypeIPv4
+		if iputils.IsIPv6(ipFrom) {
+			itemType = IPItemTypeIPv6
+		}
+
+		var op = NewIPItemOperator()
+		op.ListId = listId
+		op.Value = newValue
+		op.IpFrom = ipFrom
+		op.IpTo = ipTo
+		op.Type = itemType
+		op.Reason = reason
+		op.Source = IPItemSourceFeed
+		op.IsRead = true
+		op.Version = 0
+		op.State = IPItemStateDisabled
+		op.CreatedAt = time.Now().Unix()
+		op.UpdatedAt = time.Now().Unix()
+		err = this.Save(tx, op)
+		if err != nil {
+			return 0, 0, err
+		}
+		creatingItemIds = append(creatingItemIds, types.Int64(op.Id))
+	}
+
+	if len(creatingItemIds) == 0 && len(disablingItemIds) == 0 {
+		return 0, 0, nil
+	}
+
+	// 使用同一个版本号启用和禁用条目，需要在同一个事务中完成，防止边缘节点只读取到部分条目
+	var updateFunc = func(tx *dbs.Tx) error {
+		version, err := SharedIPListDAO.IncreaseVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		err = this.updateItemsState(tx, creatingItemIds, IPItemStateEnabled, version)
+		if err != nil {
+			return err
+		}
+		err = this.updateItemsState(tx, disablingItemIds, IPItemStateDisabled, version)
+		if err != nil {
+			return err
+		}
+
+		return SharedIPListDAO.NotifyUpdate(tx, listId, NodeTaskTypeIPItemChanged)
+	}
+	if tx != nil {
+		err = updateFunc(tx)
+	} else {
+		err = this.Instance.RunTx(updateFunc)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(creatingItemIds), len(disablingItemIds), nil
+}
+
+// 批量修改条目状态和版本
+func (this *IPItemDAO) updateItemsState(tx *dbs.Tx, itemIds []int64, state int, version int64) error {
+	const batchSize = 1000
+	for len(itemIds) > 0 {
+		var batchIds = itemIds
+		if len(batchIds) > batchSize {
+			batchIds = batchIds[:batchSize]
+		}
+		itemIds = itemIds[len(batchIds):]
+
+		err := this.Query(tx).
+			Attr("id", batchIds).
+			Set("state", state).
+			Set("version", version).
+			Set("updatedAt", time.Now().Unix()).
+			UpdateQuickly()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindAllEnabledItemsWithListId 查找名单中所有未过期的条目
+func (this *IPItemDAO) FindAllEnabledItemsWithListId(tx *dbs.Tx, listId int64) (result []*IPItem, err error) {
+	var lastId int64
+	for {
+		var items []*IPItem
+		_, err = this.Query(tx).
+			Attr("listId", listId).
+			State(IPItemStateEnabled).
+			Where("(expiredAt=0 OR expiredAt>:nowTime)").
+			Param("nowTime", time.Now().Unix()).
+			Gt("id", lastId).
+			AscPk().
+			Limit(10000).
+			Slice(&items).
+			FindAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		lastId = int64(items[len(items)-1].Id)
+		result = append(result, items...)
+	}
+	return
+}
+
+// ImportIPItems 批量导入条目
+// 名单中已经存在的IP只更新过期时间和原因，所以重复导入不会产生重复的条目；
+// 每批数据在一个事务中完成，并且共用一个版本号，以减少边缘节点的更新次数
+func (this *IPItemDAO) ImportIPItems(tx *dbs.Tx, listId int64, rows []*ipitemutils.Row, sourceUserId int64, isDryRun bool) (*IPItemImportResult, error) {
+	if listId <= 0 {
+		return nil, errors.New("invalid 'listId'")
+	}
+
+	// 已有的条目
+	existItems, err := this.FindAllEnabledItemsWithListId(tx, listId)
+	if err != nil {
+		return nil, err
+	}
+	var existItemMap = map[string]*IPItem{} // value => item
+	for _, item := range existItems {
+		if item.Type == IPItemTypeAll {
+			continue
+		}
+		value, ok := ipitemutils.NormalizeValue(item.ComposeValue())
+		if ok {
+			existItemMap[value] = item
+		}
+	}
+
+	var result = &IPItemImportResult{}
+	var creatingRows = []*ipitemutils.Row{}
+	var updatingRows = []*ipitemutils.Row{}
+	for _, row := range rows {
+		existItem, ok := existItemMap[row.Value]
+		if !ok {
+			creatingRows = append(creatingRows, row)
+			continue
+		}
+		if int64(existItem.ExpiredAt) == row.ExpiredAt && existItem.Reason == row.Reason {
+			result.CountUnchanged++
+			continue
+		}
+		updatingRows = append(updatingRows, row)
+	}
+	result.CountCreated = len(creatingRows)
+	result.CountUpdated = len(updatingRows)
+
+	if isDryRun || (len(creatingRows) == 0 && len(updatingRows) == 0) {
+		return result, nil
+	}
+
+	var runBatch = func(batchFunc func(tx *dbs.Tx) error) error {
+		if tx != nil {
+			return batchFunc(tx)
+		}
+		return this.Instance.RunTx(batchFunc)
+	}
+
+	const batchSize = 1000
+	var lastItemId int64
+	for len(creatingRows) > 0 || len(updatingRows) > 0 {
+		var batchCreatingRows = creatingRows
+		if len(batchCreatingRows) > batchSize {
+			batchCreatingRows = batchCreatingRows[:batchSize]
+		}
+		creatingRows = creatingRows[len(batchCreatingRows):]
+
+		var batchUpdatingRows = updatingRows
+		if len(batchUpdatingRows) > batchSize-len(batchCreatingRows) {
+			batchUpdatingRows = batchUpdatingRows[:batchSize-len(batchCreatingRows)]
+		}
+		updatingRows = updatingRows[len(batchUpdatingRows):]
+
+		err = runBatch(func(tx *dbs.Tx) error {
+			version, err := SharedIPListDAO.IncreaseVersion(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range batchCreatingRows {
+				var newValue, ipFrom, ipTo string
+				var itemType IPItemType
+				if asnValue, isASN := this.ParseASNValue(row.Value); isASN {
+					newValue = asnValue
+					itemType = IPItemTypeASN
+				} else {
+					var ok bool
+					newValue, ipFrom, ipTo, ok = this.ParseIPValue(row.Value)
+					if !ok {
+						continue
+					}
+					itemType = IPItemTypeIPv4
+					if iputils.IsIPv6(ipFrom) {
+						itemType = IPItemTypeIPv6
+					}
+				}
+
+				var op = NewIPItemOperator()
+				op.ListId = listId
+				op.Value = newValue
+				op.IpFrom = ipFrom
+				op.IpTo = ipTo
+				op.Type = itemType
+				op.Reason = row.Reason
+				op.ExpiredAt = row.ExpiredAt
+				op.Source = IPItemSourceImport
+				op.SourceUserId = sourceUserId
+				op.IsRead = true
+				op.Version = version
+				op.State = IPItemStateEnabled
+				op.CreatedAt = time.Now().Unix()
+				op.UpdatedAt = time.Now().Unix()
+				err = this.Save(tx, op)
+				if err != nil {
+					return err
+				}
+				lastItemId = types.Int64(op.Id)
+			}
+
+			for _, row := range batchUpdatingRows {
+				var itemId = int64(existItemMap[row.Value].Id)
+				err = this.Query(tx).
+					Pk(itemId).
+					Set("expiredAt", row.ExpiredAt).
+					Set("reason", row.Reason).
+					Set("version", version).
+					Set("updatedAt", time.Now().Unix()).
+					UpdateQuickly()
+				if err != nil {
+					return err
+				}
+				lastItemId = itemId
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 只通知一次
+	if lastItemId > 0 {
+		err = this.NotifyUpdate(tx, lastItemId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// 查找IP所属ASN对应的条目值，找不到时返回空
+func (this *IPItemDAO) composeASNValue(ip string) string {
+	var asn = iplibraryutils.LookupASN(ip)
+	if asn == nil {
+		return ""
+	}
+	return asn.String()
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ipconfigs"
+	"github.com/iwind/TeaGo/dbs"
+	"net"
+	"time"
+)
+
+// IPLookupScope 名单生效范围
+type IPLookupScope = string
+
+const (
+	IPLookupScopeGlobal  IPLookupScope = "global"  // 全局名单
+	IPLookupScopeServer  IPLookupScope = "server"  // 网站WAF策略
+	IPLookupScopeCluster IPLookupScope = "cluster" // 集群WAF策略
+	IPLookupScopeWAF     IPLookupScope = "waf"     // WAF规则集记录IP动作
+)
+
+// IPLookupVerdict 查询结论
+type IPLookupVerdict = string
+
+const (
+	IPLookupVerdictAllow IPLookupVerdict = "allow" // 放行（白名单）
+	IPLookupVerdictDeny  IPLookupVerdict = "deny"  // 拦截（黑名单）
+	IPLookupVerdictNone  IPLookupVerdict = "none"  // 不在任何生效的白名单或黑名单中
+)
+
+// IPLookupList 参与查询的名单
+type IPLookupList struct {
+	ListId    int64         `json:"listId"`
+	ListType  string        `json:"listType"`
+	ListName  string        `json:"listName"`
+	Scope     IPLookupScope `json:"scope"`
+	PolicyId  int64         `json:"policyId"`  // 引用名单的WAF策略ID
+	RuleSetId int64         `json:"ruleSetId"` // 引用名单的WAF规则集ID
+}
+
+// IPLookupMatch 匹配到的IP条目
+type IPLookupMatch struct {
+	List       *IPLookupList `json:"list"`
+	Item       *IPItem       `json:"item"`
+	IsDecisive bool          `json:"isDecisive"` // 是否为决定最终结论的条目
+}
+
+// IPLookupResult IP查询结果
+type IPLookupResult struct {
+	IP       string           `json:"ip"`
+	ServerId int64            `json:"serverId"`
+	Verdict  IPLookupVerdict  `json:"verdict"`
+	Lists    []*IPLookupList  `json:"lists"`   // 按边缘节点检查顺序排列的名单
+	Matches  []*IPLookupMatch `json:"matches"` // 按检查顺序排列的匹配条目
+}
+
+// FindAllEnabledItemsContainsIP 查找某个名单中所有包含某个IP的有效条目
+// serverId 大于0时只返回对该网站生效的条目，否则只返回不限网站的条目
+func (this *IPItemDAO) FindAllEnabledItemsContainsIP(tx *dbs.Tx, listId int64, ip string, serverId int64) (result []*IPItem, err error) {
+	var query = this.Query(tx).
+		Attr("listId", listId).
+		State(IPItemStateEnabled).
+		Where("(expiredAt=0 OR expiredAt>:nowTime)").
+		Param("nowTime", time.Now().Unix())
+
+	if serverId > 0 {
+		query.Where("(serverId=0 OR serverId=:serverId)").
+			Param("serverId", serverId)
+	} else {
+		query.Attr("serverId", 0)
+	}
+
+	var asnValue = this.composeASNValue(ip)
+	if iputils.IsIPv4(ip) {
+		query.Where("(type='all' OR (type='asn' AND value=:asnValue) OR ipFrom =:ip OR INET_ATON(:ip) BETWEEN INET_ATON(ipFrom) AND INET_ATON(ipTo))").
+			Param("ip", ip).
+			Param("asnValue", asnValue)
+	} else if iputils.IsIPv6(ip) {
+		query.Where("(type='all' OR (type='asn' AND value=:asnValue) OR ipFrom =:ip OR HEX(INET6_ATON(:ip)) BETWEEN HEX(INET6_ATON(ipFrom)) AND HEX(INET6_ATON(ipTo)))").
+			Param("ip", ip).
+			Param("asnValue", asnValue)
+	} else {
+		return nil, nil
+	}
+
+	_, err = query.
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// LookupIP 在所有对某个网站生效的名单中查找IP，并按照边缘节点的检查顺序给出最终结论
+// 检查顺序：全局名单 -> 网站WAF策略 -> 集群WAF策略 -> WAF规则集记录IP动作使用的名单；
+// 同一层级中依次为白名单、黑名单、灰名单，第一个匹配的白名单或黑名单条目决定结论
+func (this *IPItemDAO) LookupIP(tx *dbs.Tx, ip string, serverId int64) (*IPLookupResult, error) {
+	if net.ParseIP(ip) == nil {
+		return nil, errors.New("invalid ip '" + ip + "'")
+	}
+
+	lists, err := this.findLookupLists(tx, serverId)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = &IPLookupResult{
+		IP:       ip,
+		ServerId: serverId,
+		Verdict:  IPLookupVerdictNone,
+		Lists:    lists,
+	}
+
+	var hasVerdict = false
+	for _, list := range lists {
+		items, err := this.FindAllEnabledItemsContainsIP(tx, list.ListId, ip, serverId)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var match = &IPLookupMatch{
+				List: list,
+				Item: item,
+			}
+			if !hasVerdict {
+				switch list.ListType {
+				case ipconfigs.IPListTypeWhite:
+					result.Verdict = IPLookupVerdictAllow
+					match.IsDecisive = true
+					hasVerdict = true
+				case ipconfigs.IPListTypeBlack:
+					result.Verdict = IPLookupVerdictDeny
+					match.IsDecisive = true
+					hasVerdict = true
+				}
+			}
+			result.Matches = append(result.Matches, match)
+		}
+	}
+
+	return result, nil
+}
+
+// 按检查顺序列出对某个网站生效的名单
+func (this *IPItemDAO) findLookupLists(tx *dbs.Tx, serverId int64) ([]*IPLookupList, error) {
+	var cacheMap = utils.NewCacheMap()
+	var result = []*IPLookupList{}
+	var listIdMap = map[int64]bool{} // listId => bool
+
+	var addList = func(listId int64, scope IPLookupScope, policyId int64, ruleSetId int64) error {
+		if listId <= 0 || listIdMap[listId] {
+			return nil
+		}
+
+		list, err := SharedIPListDAO.FindEnabledIPList(tx, listId, cacheMap)
+		if err != nil {
+			return err
+		}
+		if list == nil || !list.IsOn {
+			return nil
+		}
+		listIdMap[listId] = true
+
+		result = append(result, &IPLookupList{
+			ListId:    listId,
+			ListType:  list.Type,
+			ListName:  list.Name,
+			Scope:     scope,
+			PolicyId:  policyId,
+			RuleSetId: ruleSetId,
+		})
+		return nil
+	}
+
+	// 全局名单
+	for _, listId := range []int64{firewallconfigs.GlobalWhiteListId, firewallconfigs.GlobalBlackListId, firewallconfigs.GlobalGreyListId} {
+		err := addList(listId, IPLookupScopeGlobal, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if serverId <= 0 {
+		return result, nil
+	}
+
+	// 网站和集群的WAF策略
+	var policies = []*firewallconfigs.HTTPFirewallPolicy{}
+	var policyScopes = []IPLookupScope{}
+	var clusterPolicyIsOn = true
+
+	webId, err := SharedServerDAO.FindServerWebId(tx, serverId)
+	if err != nil {
+		return nil, err
+	}
+	if webId > 0 {
+		web, err := SharedHTTPWebDAO.FindEnabledHTTPWeb(tx, webId)
+		if err != nil {
+			return nil, err
+		}
+		if web != nil && IsNotNull(web.Firewall) {
+			var firewallRef = &firewallconfigs.HTTPFirewallRef{}
+			err = json.Unmarshal(web.Firewall, firewallRef)
+			if err != nil {
+				return nil, err
+			}
+			if firewallRef.IsPrior && !firewallRef.IsOn {
+				// 网站关闭了WAF，集群策略也不会生效
+				clusterPolicyIsOn = false
+			}
+			if firewallRef.IsOn && firewallRef.FirewallPolicyId > 0 {
+				policy, err := SharedHTTPFirewallPolicyDAO.ComposeFirewallPolicy(tx, firewallRef.FirewallPolicyId, false, cacheMap)
+				if err != nil {
+					return nil, err
+				}
+				if policy != nil {
+					policies = append(policies, policy)
+					policyScopes = append(policyScopes, IPLookupScopeServer)
+				}
+			}
+		}
+	}
+
+	if clusterPolicyIsOn {
+		clusterId, err := SharedServerDAO.FindServerClusterId(tx, serverId)
+		if err != nil {
+			return nil, err
+		}
+		if clusterId > 0 {
+			policyId, err := SharedNodeClusterDAO.FindClusterHTTPFirewallPolicyId(tx, clusterId, cacheMap)
+			if err != nil {
+				return nil, err
+			}
+			if policyId > 0 {
+				policy, err := SharedHTTPFirewallPolicyDAO.ComposeFirewallPolicy(tx, policyId, false, cacheMap)
+				if err != nil {
+					return nil, err
+				}
+				if policy != nil {
+					policies = append(policies, policy)
+					policyScopes = append(policyScopes, IPLookupScopeCluster)
+				}
+			}
+		}
+	}
+
+	for index, policy := range policies {
+		if !policy.IsOn || policy.Inbound == nil || !policy.Inbound.IsOn {
+			continue
+		}
+
+		var inbound = policy.Inbound
+		var refGroups = [][]*ipconfigs.IPListRef{
+			append([]*ipconfigs.IPListRef{inbound.AllowListRef}, inbound.PublicAllowListRefs...),
+			append([]*ipconfigs.IPListRef{inbound.DenyListRef}, inbound.PublicDenyListRefs...),
+			append([]*ipconfigs.IPListRef{inbound.GreyListRef}, inbound.PublicGreyListRefs...),
+		}
+		for _, refs := range refGroups {
+			for _, ref := range refs {
+				if ref == nil || !ref.IsOn {
+					continue
+				}
+				err = addList(ref.ListId, policyScopes[index], policy.Id, 0)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// WAF规则集记录IP动作使用的名单
+	for _, policy := range policies {
+		if !policy.IsOn || policy.Inbound == nil || !policy.Inbound.IsOn {
+			continue
+		}
+		for _, group := range policy.Inbound.Groups {
+			if !group.IsOn {
+				continue
+			}
+			for _, set := range group.Sets {
+				if !set.IsOn {
+					continue
+				}
+				for _, action := range set.Actions {
+					if action.Code != firewallconfigs.HTTPFirewallActionRecordIP || action.Options == nil {
+						continue
+					}
+					err = addList(action.Options.GetInt64("ipListId"), IPLookupScopeWAF, policy.Id, set.Id)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
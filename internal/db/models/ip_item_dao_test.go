@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipitemutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/dbs"
@@ -89,3 +90,73 @@ func TestIPItemDAO_ParseIPValue(t *testing.T) {
 	t.Log(dao.ParseIPValue("192.168.1.200/256"))
 	t.Log(dao.ParseIPValue("192.168.1.200-"))
 }
+
+func TestIPItemDAO_SyncFeedItems(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	countCreated, countDisabled, err := models.SharedIPItemDAO.SyncFeedItems(tx, 1, []string{"192.168.100.1", "192.168.101.0/24", "192.168.102.1-192.168.102.10"}, "test feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("created:", countCreated, "disabled:", countDisabled)
+
+	// 再次同步时不应该有变化
+	countCreated, countDisabled, err = models.SharedIPItemDAO.SyncFeedItems(tx, 1, []string{"192.168.100.1", "192.168.101.0/24"}, "test feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countCreated != 0 || countDisabled != 1 {
+		t.Fatal("expected 0 created and 1 disabled, but got", countCreated, countDisabled)
+	}
+}
+
+func TestIPItemDAO_ImportIPItems(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var rows = []*ipitemutils.Row{
+		{Value: "192.168.200.1"},
+		{Value: "192.168.201.0/24", Reason: "import test"},
+	}
+	result, err := models.SharedIPItemDAO.ImportIPItems(tx, 1, rows, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("dry run: %+v", result)
+
+	_, err = models.SharedIPItemDAO.ImportIPItems(tx, 1, rows, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复导入
+	result, err = models.SharedIPItemDAO.ImportIPItems(tx, 1, rows, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CountCreated != 0 || result.CountUnchanged != len(rows) {
+		t.Fatalf("should not create items again: %+v", result)
+	}
+}
+
+func TestIPItemDAO_LookupIP(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	for _, serverId := range []int64{0, 1} {
+		result, err := models.SharedIPItemDAO.LookupIP(tx, "192.168.1.100", serverId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log("server:", serverId, "verdict:", result.Verdict, "lists:", len(result.Lists))
+		for _, match := range result.Matches {
+			t.Log("  ", match.List.Scope, match.List.ListId, match.List.ListType, match.Item.ComposeValue(), match.IsDecisive)
+		}
+	}
+
+	_, err := models.SharedIPItemDAO.LookupIP(tx, "abc", 0)
+	if err == nil {
+		t.Fatal("should fail with invalid ip")
+	}
+}
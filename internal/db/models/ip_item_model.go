@@ -27,6 +27,7 @@ const (
 	IPItemField_SourceHTTPFirewallRuleSetId   dbs.FieldName = "sourceHTTPFirewallRuleSetId"   // 来源规则集ID
 	IPItemField_SourceUserId                  dbs.FieldName = "sourceUserId"                  // 用户ID
 	IPItemField_IsRead                        dbs.FieldName = "isRead"                        // 是否已读
+	IPItemField_Source                        dbs.FieldName = "source"                        // 来源类型
 )
 
 // IPItem IP
@@ -55,6 +56,7 @@ type IPItem struct {
 	SourceHTTPFirewallRuleSetId   uint32 `field:"sourceHTTPFirewallRuleSetId"`   // 来源规则集ID
 	SourceUserId                  uint64 `field:"sourceUserId"`                  // 用户ID
 	IsRead                        bool   `field:"isRead"`                        // 是否已读
+	Source                        string `field:"source"`                        // 来源类型
 }
 
 type IPItemOperator struct {
@@ -82,6 +84,7 @@ type IPItemOperator struct {
 	SourceHTTPFirewallRuleSetId   any // 来源规则集ID
 	SourceUserId                  any // 用户ID
 	IsRead                        any // 是否已读
+	Source                        any // 来源类型
 }
 
 func NewIPItemOperator() *IPItemOperator {
@@ -13,3 +13,10 @@ func (this *IPItem) ComposeValue() string {
 
 	return this.IpFrom
 }
+
+// IPItemImportResult 批量导入结果
+type IPItemImportResult struct {
+	CountCreated   int // 新增的条目数
+	CountUpdated   int // 修改了过期时间或原因的条目数
+	CountUnchanged int // 已存在并且没有变化的条目数
+}
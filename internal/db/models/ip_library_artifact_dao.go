@@ -87,6 +87,14 @@ func (this *IPLibraryArtifactDAO) CreateArtifact(tx *dbs.Tx, name string, fileId
 	return this.SaveInt64(tx, op)
 }
 
+// UpdateArtifactASNFile 设置制品的ASN文件
+func (this *IPLibraryArtifactDAO) UpdateArtifactASNFile(tx *dbs.Tx, artifactId int64, asnFileId int64) error {
+	return this.Query(tx).
+		Pk(artifactId).
+		Set("asnFileId", asnFileId).
+		UpdateQuickly()
+}
+
 // FindAllArtifacts 查找制品列表
 func (this *IPLibraryArtifactDAO) FindAllArtifacts(tx *dbs.Tx) (result []*IPLibraryArtifact, err error) {
 	_, err = this.Query(tx).
@@ -102,7 +110,7 @@ func (this *IPLibraryArtifactDAO) FindPublicArtifact(tx *dbs.Tx) (*IPLibraryArti
 	one, err := this.Query(tx).
 		State(IPLibraryArtifactStateEnabled).
 		Attr("isPublic", true).
-		Result("id", "fileId", "code").
+		Result("id", "fileId", "asnFileId", "code").
 		Find()
 	if err != nil || one == nil {
 		return nil, err
@@ -10,6 +10,7 @@ type IPLibraryArtifact struct {
 	LibraryFileId uint32   `field:"libraryFileId"` // IP库文件ID
 	CreatedAt     uint64   `field:"createdAt"`     // 创建时间
 	Meta          dbs.JSON `field:"meta"`          // 元数据
+	AsnFileId     uint64   `field:"asnFileId"`     // ASN文件ID
 	IsPublic      bool     `field:"isPublic"`      // 是否为公用
 	Code          string   `field:"code"`          // 代号
 	State         uint8    `field:"state"`         // 状态
@@ -22,6 +23,7 @@ type IPLibraryArtifactOperator struct {
 	LibraryFileId any // IP库文件ID
 	CreatedAt     any // 创建时间
 	Meta          any // 元数据
+	AsnFileId     any // ASN文件ID
 	IsPublic      any // 是否为公用
 	Code          any // 代号
 	State         any // 状态
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/regions"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
@@ -143,6 +145,57 @@ func (this *IPLibraryFileDAO) CreateLibraryFile(tx *dbs.Tx, name string, templat
 	return this.SaveInt64(tx, op)
 }
 
+// CreateLibraryFileWithFormat 从MMDB、xdb等二进制IP库创建文件
+// 文件中的国家/地区、省份、城市等信息由API节点直接读取，不需要模板
+func (this *IPLibraryFileDAO) CreateLibraryFileWithFormat(tx *dbs.Tx, name string, format iplibraryutils.Format, password string, fileId int64) (int64, error) {
+	if !iplibraryutils.IsBinaryFormat(format) {
+		return 0, errors.New("unsupported library file format '" + format + "'")
+	}
+	if fileId <= 0 {
+		return 0, errors.New("the library file has not been uploaded yet")
+	}
+
+	dir, err := this.prepareDir()
+	if err != nil {
+		return 0, err
+	}
+
+	var sourcePath = dir + "/ip-library-source-" + utils.Sha1RandomString() + "." + format
+	err = this.writeSourceFile(tx, fileId, sourcePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = os.Remove(sourcePath)
+	}()
+
+	summary, err := iplibraryutils.Summarize(format, sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("read '%s' file failed: %w", format, err)
+	}
+
+	libraryFileId, err := this.CreateLibraryFile(tx, name, "", nil, password, fileId, summary.Countries(), summary.Provinces(), summary.Cities(), summary.Towns(), summary.Providers())
+	if err != nil {
+		return 0, err
+	}
+
+	asnsJSON, err := json.Marshal(summary.ASNs())
+	if err != nil {
+		return 0, err
+	}
+
+	err = this.Query(tx).
+		Pk(libraryFileId).
+		Set("format", format).
+		Set("asns", asnsJSON).
+		UpdateQuickly()
+	if err != nil {
+		return 0, err
+	}
+
+	return libraryFileId, nil
+}
+
 // FindAllFinishedLibraryFiles 查找所有已完成的文件
 func (this *IPLibraryFileDAO) FindAllFinishedLibraryFiles(tx *dbs.Tx) (result []*IPLibraryFile, err error) {
 	_, err = this.Query(tx).
@@ -300,9 +353,19 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 	}
 
 	var libraryFile = one.(*IPLibraryFile)
-	template, err := iplibrary.NewTemplate(libraryFile.Template)
-	if err != nil {
-		return fmt.Errorf("create template from '%s' failed: %w", libraryFile.Template, err)
+	var format = libraryFile.Format
+	if len(format) == 0 {
+		format = iplibraryutils.FormatTemplate
+	}
+
+	var template *iplibrary.Template
+	if format == iplibraryutils.FormatTemplate {
+		template, err = iplibrary.NewTemplate(libraryFile.Template)
+		if err != nil {
+			return fmt.Errorf("create template from '%s' failed: %w", libraryFile.Template, err)
+		}
+	} else if !iplibraryutils.IsBinaryFormat(format) {
+		return errors.New("unsupported library file format '" + format + "'")
 	}
 
 	var fileId = int64(libraryFile.FileId)
@@ -310,25 +373,9 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 		return errors.New("the library file has not been uploaded yet")
 	}
 
-	var dir = Tea.Root + "/data"
-	stat, err := os.Stat(dir)
-
+	dir, err := this.prepareDir()
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.Mkdir(dir, 0777)
-			if err != nil {
-				return fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
-			}
-		} else {
-			return fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
-		}
-	} else if !stat.IsDir() {
-		_ = os.Remove(dir)
-
-		err = os.Mkdir(dir, 0777)
-		if err != nil {
-			return fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
-		}
+		return err
 	}
 
 	// TODO 删除以往生成的文件，但要考虑到文件正在被别的任务所使用
@@ -434,11 +481,6 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 		return fmt.Errorf("write meta failed: %w", err)
 	}
 
-	chunkIds, err := SharedFileChunkDAO.FindAllFileChunkIds(tx, fileId)
-	if err != nil {
-		return err
-	}
-
 	// countries etc ...
 	var countryMap = map[string]int64{} // countryName => countryId
 	for _, country := range dbCountries {
@@ -483,60 +525,94 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 		}
 	}
 
-	dataParser, err := iplibrary.NewParser(&iplibrary.ParserConfig{
-		Template:    template,
-		EmptyValues: libraryFile.DecodeEmptyValues(),
-		Iterator: func(values map[string]string) error {
-			var ipFrom = values["ipFrom"]
-			var ipTo = values["ipTo"]
-
-			var countryName = values["country"]
-			var provinceName = values["province"]
-			var cityName = values["city"]
-			var townName = values["town"]
-			var providerName = values["provider"]
-
-			var countryId = countryMap[countryName]
-			var provinceId int64
-			var cityId int64 = 0
-			var townId int64 = 0
-			var providerId = providerMap[providerName]
-
-			if countryId > 0 {
-				provinceId = provinceMap[types.String(countryId)+"_"+provinceName]
-				if provinceId > 0 {
-					cityId = cityMap[types.String(provinceId)+"_"+cityName]
-					if cityId > 0 {
-						townId = townMap[types.String(cityId)+"_"+townName]
-					}
-				}
-			}
+	// ASN数据单独存放，不影响原有的IP库文件格式
+	var asnLibrary = iplibraryutils.NewASNLibrary()
 
-			err = writer.Write(ipFrom, ipTo, countryId, provinceId, cityId, townId, providerId)
+	var writeRecord = func(record *iplibraryutils.Record) error {
+		if record.ASN > 0 {
+			err := asnLibrary.Add(record.IPFrom, record.IPTo, record.ASN, record.Organization)
 			if err != nil {
-				return fmt.Errorf("write failed: %w", err)
+				return err
 			}
+		}
 
-			return nil
-		},
-	})
-	if err != nil {
-		return err
+		var countryId = countryMap[record.Country]
+		var provinceId int64
+		var cityId int64 = 0
+		var townId int64 = 0
+		var providerId = providerMap[record.Provider]
+
+		if countryId > 0 {
+			provinceId = provinceMap[types.String(countryId)+"_"+record.Province]
+			if provinceId > 0 {
+				cityId = cityMap[types.String(provinceId)+"_"+record.City]
+				if cityId > 0 {
+					townId = townMap[types.String(cityId)+"_"+record.Town]
+				}
+			}
+		}
+
+		err := writer.Write(record.IPFrom, record.IPTo, countryId, provinceId, cityId, townId, providerId)
+		if err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+
+		return nil
 	}
 
-	for _, chunkId := range chunkIds {
-		chunk, err := SharedFileChunkDAO.FindFileChunk(tx, chunkId)
+	if iplibraryutils.IsBinaryFormat(format) {
+		// MMDB、xdb等二进制文件需要完整写入本地后再读取
+		var sourcePath = dir + "/ip-library-source-" + types.String(libraryFileId) + "-" + libraryCode + "." + format
+		err = this.writeSourceFile(tx, fileId, sourcePath)
 		if err != nil {
 			return err
 		}
-		if chunk == nil {
-			return errors.New("invalid chunk file, please upload again")
+		err = iplibraryutils.Read(format, sourcePath, writeRecord)
+		_ = os.Remove(sourcePath)
+		if err != nil {
+			return err
+		}
+	} else {
+		dataParser, err := iplibrary.NewParser(&iplibrary.ParserConfig{
+			Template:    template,
+			EmptyValues: libraryFile.DecodeEmptyValues(),
+			Iterator: func(values map[string]string) error {
+				asn, _ := iplibraryutils.ParseASN(values["asn"])
+				return writeRecord(&iplibraryutils.Record{
+					IPFrom:       values["ipFrom"],
+					IPTo:         values["ipTo"],
+					Country:      values["country"],
+					Province:     values["province"],
+					City:         values["city"],
+					Town:         values["town"],
+					Provider:     values["provider"],
+					ASN:          asn,
+					Organization: values["org"],
+				})
+			},
+		})
+		if err != nil {
+			return err
 		}
-		dataParser.Write(chunk.Data)
-		err = dataParser.Parse()
+
+		chunkIds, err := SharedFileChunkDAO.FindAllFileChunkIds(tx, fileId)
 		if err != nil {
 			return err
 		}
+		for _, chunkId := range chunkIds {
+			chunk, err := SharedFileChunkDAO.FindFileChunk(tx, chunkId)
+			if err != nil {
+				return err
+			}
+			if chunk == nil {
+				return errors.New("invalid chunk file, please upload again")
+			}
+			dataParser.Write(chunk.Data)
+			err = dataParser.Parse()
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	err = writer.Close()
@@ -545,7 +621,7 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 	}
 
 	// 将生成的内容写入到文件
-	stat, err = os.Stat(filePath)
+	stat, err := os.Stat(filePath)
 	if err != nil {
 		return fmt.Errorf("stat generated file failed: %w", err)
 	}
@@ -592,11 +668,38 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 	}
 
 	// 添加制品
-	_, err = SharedIPLibraryArtifactDAO.CreateArtifact(tx, libraryFile.Name, generatedFileId, libraryFileId, meta)
+	artifactId, err := SharedIPLibraryArtifactDAO.CreateArtifact(tx, libraryFile.Name, generatedFileId, libraryFileId, meta)
 	if err != nil {
 		return err
 	}
 
+	// ASN
+	if asnLibrary.Len() > 0 {
+		var asnBuffer = &bytes.Buffer{}
+		err = asnLibrary.Encode(asnBuffer)
+		if err != nil {
+			return fmt.Errorf("encode asn library failed: %w", err)
+		}
+		asnFileId, err := SharedFileDAO.CreateFile(tx, 0, 0, "ipLibraryASNFile", "", libraryCode+".asn.gz", int64(asnBuffer.Len()), "", false)
+		if err != nil {
+			return err
+		}
+		for asnBuffer.Len() > 0 {
+			_, err = SharedFileChunkDAO.CreateFileChunk(tx, asnFileId, asnBuffer.Next(256*1024))
+			if err != nil {
+				return err
+			}
+		}
+		err = SharedFileDAO.UpdateFileIsFinished(tx, asnFileId)
+		if err != nil {
+			return err
+		}
+		err = SharedIPLibraryArtifactDAO.UpdateArtifactASNFile(tx, artifactId, asnFileId)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -604,3 +707,71 @@ func (this *IPLibraryFileDAO) GenerateIPLibrary(tx *dbs.Tx, libraryFileId int64)
 func (this *IPLibraryFileDAO) composeFilename(libraryFileId int64, code string) string {
 	return "ip-library-" + types.String(libraryFileId) + "-" + code + ".db"
 }
+
+// 准备用来存放临时文件的目录
+func (this *IPLibraryFileDAO) prepareDir() (string, error) {
+	var dir = Tea.Root + "/data"
+	stat, err := os.Stat(dir)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = os.Mkdir(dir, 0777)
+			if err != nil {
+				return "", fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
+			}
+		} else {
+			return "", fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
+		}
+	} else if !stat.IsDir() {
+		_ = os.Remove(dir)
+
+		err = os.Mkdir(dir, 0777)
+		if err != nil {
+			return "", fmt.Errorf("can not open dir '%s' to write: %w", dir, err)
+		}
+	}
+	return dir, nil
+}
+
+// 将上传的原始文件写入到本地
+func (this *IPLibraryFileDAO) writeSourceFile(tx *dbs.Tx, fileId int64, path string) error {
+	chunkIds, err := SharedFileChunkDAO.FindAllFileChunkIds(tx, fileId)
+	if err != nil {
+		return err
+	}
+	if len(chunkIds) == 0 {
+		return errors.New("the library file has not been uploaded yet")
+	}
+
+	fp, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create file '%s' failed: %w", path, err)
+	}
+
+	for _, chunkId := range chunkIds {
+		chunk, err := SharedFileChunkDAO.FindFileChunk(tx, chunkId)
+		if err != nil {
+			_ = fp.Close()
+			_ = os.Remove(path)
+			return err
+		}
+		if chunk == nil {
+			_ = fp.Close()
+			_ = os.Remove(path)
+			return errors.New("invalid chunk file, please upload again")
+		}
+		_, err = fp.Write(chunk.Data)
+		if err != nil {
+			_ = fp.Close()
+			_ = os.Remove(path)
+			return fmt.Errorf("write file '%s' failed: %w", path, err)
+		}
+	}
+
+	err = fp.Close()
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
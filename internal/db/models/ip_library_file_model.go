@@ -7,6 +7,7 @@ type IPLibraryFile struct {
 	Id              uint64   `field:"id"`              // ID
 	Name            string   `field:"name"`            // IP库名称
 	FileId          uint64   `field:"fileId"`          // 原始文件ID
+	Format          string   `field:"format"`          // 文件格式
 	Template        string   `field:"template"`        // 模板
 	EmptyValues     dbs.JSON `field:"emptyValues"`     // 空值列表
 	GeneratedFileId uint64   `field:"generatedFileId"` // 生成的文件ID
@@ -17,6 +18,7 @@ type IPLibraryFile struct {
 	Cities          dbs.JSON `field:"cities"`          // 城市
 	Towns           dbs.JSON `field:"towns"`           // 区县
 	Providers       dbs.JSON `field:"providers"`       // ISP服务商
+	Asns            dbs.JSON `field:"asns"`            // ASN列表
 	Code            string   `field:"code"`            // 文件代号
 	Password        string   `field:"password"`        // 密码
 	CreatedAt       uint64   `field:"createdAt"`       // 上传时间
@@ -27,6 +29,7 @@ type IPLibraryFileOperator struct {
 	Id              any // ID
 	Name            any // IP库名称
 	FileId          any // 原始文件ID
+	Format          any // 文件格式
 	Template        any // 模板
 	EmptyValues     any // 空值列表
 	GeneratedFileId any // 生成的文件ID
@@ -37,6 +40,7 @@ type IPLibraryFileOperator struct {
 	Cities          any // 城市
 	Towns           any // 区县
 	Providers       any // ISP服务商
+	Asns            any // ASN列表
 	Code            any // 文件代号
 	Password        any // 密码
 	CreatedAt       any // 上传时间
@@ -1,6 +1,10 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
+)
 
 func (this *IPLibraryFile) DecodeCountries() []string {
 	var countries = []string{}
@@ -57,6 +61,17 @@ func (this *IPLibraryFile) DecodeProviders() []string {
 	return providers
 }
 
+func (this *IPLibraryFile) DecodeASNs() []*iplibraryutils.ASN {
+	var asns = []*iplibraryutils.ASN{}
+	if IsNotNull(this.Asns) {
+		err := json.Unmarshal(this.Asns, &asns)
+		if err != nil {
+			// ignore error
+		}
+	}
+	return asns
+}
+
 func (this *IPLibraryFile) DecodeEmptyValues() []string {
 	var result = []string{}
 	if IsNotNull(this.EmptyValues) {
@@ -1,11 +1,16 @@
 package models
 
 import (
+	"encoding/json"
 	"regexp"
+	"time"
 
 	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ttlcache"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ipconfigs"
@@ -22,6 +27,16 @@ const (
 	IPListStateDisabled = 0 // 已禁用
 )
 
+type IPListSource = string
+
+const (
+	IPListSourceManual IPListSource = ""     // 手动维护
+	IPListSourceFeed   IPListSource = "feed" // 订阅源
+)
+
+// SettingCodeGlobalIPListEscalation 全局名单封禁阶梯设置代号，全局名单没有对应的数据记录，所以保存在系统设置中
+const SettingCodeGlobalIPListEscalation = "globalIPListEscalation%d"
+
 var listTypeCacheMap = map[int64]*IPList{} // listId => *IPList
 var DefaultGlobalBlackIPList = &IPList{
 	Id:       uint32(firewallconfigs.GlobalBlackListId),
@@ -409,6 +424,213 @@ func (this *IPListDAO) ValidateIPListCode(code string) bool {
 	return ipListCodeRegexp.MatchString(code)
 }
 
+// UpdateIPListFeed 修改名单订阅源设置
+// config为nil时表示取消订阅，已经同步的条目会保留
+func (this *IPListDAO) UpdateIPListFeed(tx *dbs.Tx, listId int64, config *ipfeedutils.FeedConfig) error {
+	if listId <= 0 || firewallconfigs.IsGlobalListId(listId) {
+		return errors.New("invalid 'listId'")
+	}
+
+	var op = NewIPListOperator()
+	op.Id = listId
+	if config == nil {
+		op.Source = IPListSourceManual
+		op.Feed = "null"
+	} else {
+		err := config.Init()
+		if err != nil {
+			return err
+		}
+		feedJSON, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		op.Source = IPListSourceFeed
+		op.Feed = feedJSON
+	}
+
+	// 重置同步状态，以便尽快重新同步
+	op.FeedStatus = "null"
+	return this.Save(tx, op)
+}
+
+// UpdateIPListFeedStatus 修改订阅源同步状态
+func (this *IPListDAO) UpdateIPListFeedStatus(tx *dbs.Tx, listId int64, status *IPListFeedStatus) error {
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return this.Query(tx).
+		Pk(listId).
+		Set("feedStatus", statusJSON).
+		UpdateQuickly()
+}
+
+// FindAllFeedListIdsToSync 查找需要同步的订阅源名单
+func (this *IPListDAO) FindAllFeedListIdsToSync(tx *dbs.Tx, now int64) (listIds []int64, err error) {
+	ones, err := this.Query(tx).
+		Result("id", "feed", "feedStatus").
+		State(IPListStateEnabled).
+		Attr("isOn", true).
+		Attr("source", IPListSourceFeed).
+		AscPk().
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		var list = one.(*IPList)
+		config, err := list.DecodeFeed()
+		if err != nil || config == nil {
+			continue
+		}
+		if list.DecodeFeedStatus().IsDue(config, now) {
+			listIds = append(listIds, int64(list.Id))
+		}
+	}
+	return
+}
+
+// SyncIPListFeed 下载订阅源并同步到名单
+// 同步结果会记录到名单的同步状态中，下载或解析失败时不会修改已有的条目
+func (this *IPListDAO) SyncIPListFeed(tx *dbs.Tx, listId int64) (*IPListFeedStatus, error) {
+	list, err := this.FindEnabledIPList(tx, listId, nil)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil || !list.IsFeed() {
+		return nil, errors.New("feed list '" + types.String(listId) + "' not found")
+	}
+	config, err := list.DecodeFeed()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, errors.New("feed of list '" + types.String(listId) + "' has not been configured")
+	}
+
+	var status = list.DecodeFeedStatus()
+	status.CheckedAt = time.Now().Unix()
+
+	var syncErr = func() error {
+		result, err := ipfeedutils.Fetch(config, status.ETag, status.LastModified)
+		if err != nil {
+			return err
+		}
+		status.ETag = result.ETag
+		status.LastModified = result.LastModified
+		if result.NotModified {
+			status.CountCreated = 0
+			status.CountDisabled = 0
+			return nil
+		}
+
+		// 防止源暂时返回空内容而清空整个名单
+		if len(result.Values) == 0 && status.CountItems > 0 {
+			return errors.New("feed returns no valid items")
+		}
+
+		countCreated, countDisabled, err := SharedIPItemDAO.SyncFeedItems(tx, listId, result.Values, "订阅源："+list.Name)
+		if err != nil {
+			return err
+		}
+		status.CountItems = len(result.Values)
+		status.CountCreated = countCreated
+		status.CountDisabled = countDisabled
+		status.CountInvalid = result.CountInvalid
+		return nil
+	}()
+	if syncErr != nil {
+		status.IsOk = false
+		status.Error = syncErr.Error()
+	} else {
+		status.IsOk = true
+		status.Error = ""
+		status.SyncedAt = status.CheckedAt
+	}
+
+	err = this.UpdateIPListFeedStatus(tx, listId, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, syncErr
+}
+
+// UpdateIPListEscalation 修改名单封禁阶梯设置
+// config为nil时表示取消封禁阶梯，已有的违规记录会保留
+func (this *IPListDAO) UpdateIPListEscalation(tx *dbs.Tx, listId int64, config *ipescalationutils.Config) error {
+	if listId <= 0 {
+		return errors.New("invalid 'listId'")
+	}
+
+	var escalationJSON = []byte("null")
+	if config != nil {
+		err := config.Init()
+		if err != nil {
+			return err
+		}
+		escalationJSON, err = json.Marshal(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer ttlcache.SharedCache.Delete(this.composeEscalationCacheKey(listId))
+
+	if firewallconfigs.IsGlobalListId(listId) {
+		return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeGlobalIPListEscalation, escalationJSON, listId)
+	}
+
+	return this.Query(tx).
+		Pk(listId).
+		Set("escalation", escalationJSON).
+		UpdateQuickly()
+}
+
+// FindIPListEscalation 查找名单封禁阶梯设置
+func (this *IPListDAO) FindIPListEscalation(tx *dbs.Tx, listId int64) (*ipescalationutils.Config, error) {
+	if firewallconfigs.IsGlobalListId(listId) {
+		escalationJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeGlobalIPListEscalation, listId)
+		if err != nil {
+			return nil, err
+		}
+		return (&IPList{Escalation: escalationJSON}).DecodeEscalation()
+	}
+
+	escalationJSON, err := this.Query(tx).
+		Pk(listId).
+		State(IPListStateEnabled).
+		Result("escalation").
+		FindJSONCol()
+	if err != nil {
+		return nil, err
+	}
+	return (&IPList{Escalation: escalationJSON}).DecodeEscalation()
+}
+
+// FindIPListEscalationCacheable 查找启用的封禁阶梯设置，节点上报IP时频繁调用，所以使用缓存
+func (this *IPListDAO) FindIPListEscalationCacheable(tx *dbs.Tx, listId int64) (*ipescalationutils.Config, error) {
+	var cacheKey = this.composeEscalationCacheKey(listId)
+	var item = ttlcache.SharedCache.Read(cacheKey)
+	if item != nil {
+		return item.Value.(*ipescalationutils.Config), nil
+	}
+
+	config, err := this.FindIPListEscalation(tx, listId)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && !config.IsOn {
+		config = nil
+	}
+	ttlcache.SharedCache.Write(cacheKey, config, time.Now().Unix()+60)
+	return config, nil
+}
+
+func (this *IPListDAO) composeEscalationCacheKey(listId int64) string {
+	return "ipListEscalation@" + types.String(listId)
+}
+
 // 查找ID对应的全局名单
 func (this *IPListDAO) findGlobalList(id int64) (list *IPList, ok bool) {
 	switch id {
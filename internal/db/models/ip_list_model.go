@@ -19,6 +19,10 @@ type IPList struct {
 	Description string   `field:"description"` // 描述
 	IsPublic    bool     `field:"isPublic"`    // 是否公用
 	IsGlobal    bool     `field:"isGlobal"`    // 是否全局
+	Source      string   `field:"source"`      // 来源类型
+	Feed        dbs.JSON `field:"feed"`        // 订阅源设置
+	FeedStatus  dbs.JSON `field:"feedStatus"`  // 订阅源同步状态
+	Escalation  dbs.JSON `field:"escalation"`  // 封禁阶梯设置
 }
 
 type IPListOperator struct {
@@ -37,6 +41,10 @@ type IPListOperator struct {
 	Description interface{} // 描述
 	IsPublic    interface{} // 是否公用
 	IsGlobal    interface{} // 是否全局
+	Source      interface{} // 来源类型
+	Feed        interface{} // 订阅源设置
+	FeedStatus  interface{} // 订阅源同步状态
+	Escalation  interface{} // 封禁阶梯设置
 }
 
 func NewIPListOperator() *IPListOperator {
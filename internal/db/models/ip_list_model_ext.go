@@ -1 +1,71 @@
 package models
+
+import (
+	"encoding/json"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
+)
+
+// IsFeed 是否为订阅源名单
+func (this *IPList) IsFeed() bool {
+	return this.Source == IPListSourceFeed
+}
+
+// DecodeFeed 解析订阅源设置
+func (this *IPList) DecodeFeed() (*ipfeedutils.FeedConfig, error) {
+	if !IsNotNull(this.Feed) {
+		return nil, nil
+	}
+	var config = &ipfeedutils.FeedConfig{}
+	err := json.Unmarshal(this.Feed, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DecodeFeedStatus 解析订阅源同步状态
+func (this *IPList) DecodeFeedStatus() *IPListFeedStatus {
+	var status = &IPListFeedStatus{}
+	if IsNotNull(this.FeedStatus) {
+		_ = json.Unmarshal(this.FeedStatus, status)
+	}
+	return status
+}
+
+// IPListFeedStatus 订阅源同步状态
+type IPListFeedStatus struct {
+	CheckedAt     int64  `json:"checkedAt"`     // 最后一次尝试同步的时间
+	SyncedAt      int64  `json:"syncedAt"`      // 最后一次同步成功的时间
+	IsOk          bool   `json:"isOk"`          // 最后一次同步是否成功
+	Error         string `json:"error"`         // 错误信息
+	CountItems    int    `json:"countItems"`    // 订阅源中的条目数
+	CountCreated  int    `json:"countCreated"`  // 最后一次同步新增的条目数
+	CountDisabled int    `json:"countDisabled"` // 最后一次同步禁用的条目数
+	CountInvalid  int    `json:"countInvalid"`  // 无法识别的行数
+	ETag          string `json:"etag"`
+	LastModified  string `json:"lastModified"`
+}
+
+// IsDue 是否需要同步
+func (this *IPListFeedStatus) IsDue(config *ipfeedutils.FeedConfig, now int64) bool {
+	var refreshSeconds = int64(config.RefreshSeconds)
+	if refreshSeconds <= 0 {
+		refreshSeconds = ipfeedutils.DefaultRefreshSeconds
+	}
+	return this.CheckedAt+refreshSeconds <= now
+}
+
+// DecodeEscalation 解析封禁阶梯设置
+func (this *IPList) DecodeEscalation() (*ipescalationutils.Config, error) {
+	if !IsNotNull(this.Escalation) {
+		return nil, nil
+	}
+	var config = &ipescalationutils.Config{}
+	err := json.Unmarshal(this.Escalation, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
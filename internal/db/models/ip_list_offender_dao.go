@@ -0,0 +1,170 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"time"
+
+	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// 违规次数重置后违规记录保留的天数，以便查看累计违规次数
+const ipListOffenderKeepDays = 30
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedIPListOffenderDAO.CleanExpiredOffenders(nil)
+				if err != nil {
+					remotelogs.Error("IPListOffenderDAO", "clean expired offenders failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+type IPListOffenderDAO dbs.DAO
+
+func NewIPListOffenderDAO() *IPListOffenderDAO {
+	return dbs.NewDAO(&IPListOffenderDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeIPListOffenders",
+			Model:  new(IPListOffender),
+			PkName: "id",
+		},
+	}).(*IPListOffenderDAO)
+}
+
+var SharedIPListOffenderDAO *IPListOffenderDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedIPListOffenderDAO = NewIPListOffenderDAO()
+	})
+}
+
+// Offend 记录一次违规，并根据封禁阶梯计算过期时间
+// 返回当前连续违规次数和过期时间，过期时间为0表示永久封禁
+func (this *IPListOffenderDAO) Offend(tx *dbs.Tx, listId int64, ip string, config *ipescalationutils.Config) (count int, expiredAt int64, err error) {
+	var now = time.Now().Unix()
+
+	offender, err := this.FindOffenderWithIP(tx, listId, ip)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count = 1
+	var totalCount = 1
+	if offender != nil {
+		totalCount = int(offender.TotalCount) + 1
+		if offender.IsRepeatAt(now) {
+			count = int(offender.Count) + 1
+		}
+	}
+
+	expiredAt = config.ComputeExpiredAt(count, now)
+
+	var op = NewIPListOffenderOperator()
+	if offender != nil {
+		op.Id = offender.Id
+	} else {
+		op.ListId = listId
+		op.Ip = ip
+		op.CreatedAt = now
+	}
+	op.Count = count
+	op.TotalCount = totalCount
+	op.ExpiredAt = expiredAt
+	op.ResetAt = config.ComputeResetAt(expiredAt)
+	op.UpdatedAt = now
+	err = this.Save(tx, op)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, expiredAt, nil
+}
+
+// FindOffenderWithIP 查找某个IP在名单中的违规记录
+func (this *IPListOffenderDAO) FindOffenderWithIP(tx *dbs.Tx, listId int64, ip string) (*IPListOffender, error) {
+	one, err := this.Query(tx).
+		Attr("listId", listId).
+		Attr("ip", ip).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*IPListOffender), nil
+}
+
+// FindOffender 查找违规记录
+func (this *IPListOffenderDAO) FindOffender(tx *dbs.Tx, offenderId int64) (*IPListOffender, error) {
+	one, err := this.Query(tx).
+		Pk(offenderId).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*IPListOffender), nil
+}
+
+// CountOffenders 计算违规记录数量
+func (this *IPListOffenderDAO) CountOffenders(tx *dbs.Tx, listId int64, keyword string) (int64, error) {
+	var query = this.Query(tx).
+		Attr("listId", listId)
+	if len(keyword) > 0 {
+		query.Like("ip", dbutils.QuoteLike(keyword))
+	}
+	return query.Count()
+}
+
+// ListOffenders 列出违规记录，连续违规次数多的排在前面
+func (this *IPListOffenderDAO) ListOffenders(tx *dbs.Tx, listId int64, keyword string, offset int64, size int64) (result []*IPListOffender, err error) {
+	var query = this.Query(tx).
+		Attr("listId", listId)
+	if len(keyword) > 0 {
+		query.Like("ip", dbutils.QuoteLike(keyword))
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		Desc("count").
+		Desc("updatedAt").
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// DeleteOffender 删除违规记录，下次违规时重新计数
+func (this *IPListOffenderDAO) DeleteOffender(tx *dbs.Tx, offenderId int64) error {
+	_, err := this.Query(tx).
+		Pk(offenderId).
+		Delete()
+	return err
+}
+
+// DeleteOffendersWithListId 删除名单中所有违规记录
+func (this *IPListOffenderDAO) DeleteOffendersWithListId(tx *dbs.Tx, listId int64) error {
+	_, err := this.Query(tx).
+		Attr("listId", listId).
+		Delete()
+	return err
+}
+
+// CleanExpiredOffenders 清除已经重置很久的违规记录
+func (this *IPListOffenderDAO) CleanExpiredOffenders(tx *dbs.Tx) error {
+	_, err := this.Query(tx).
+		Where("(resetAt>0 AND resetAt<:timestamp)").
+		Param("timestamp", time.Now().Unix()-ipListOffenderKeepDays*86400).
+		Limit(10000). // 限制条数，防止数量过多导致超时
+		Delete()
+	return err
+}
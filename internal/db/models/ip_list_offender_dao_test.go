@@ -0,0 +1,53 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestIPListOffender_IsRepeatAt(t *testing.T) {
+	var offender = &models.IPListOffender{ResetAt: 100}
+	if !offender.IsRepeatAt(100) || offender.IsRepeatAt(101) {
+		t.Fatal("invalid repeat checking")
+	}
+
+	// 永久封禁
+	offender.ResetAt = 0
+	if !offender.IsRepeatAt(1 << 40) {
+		t.Fatal("permanent offender should always repeat")
+	}
+}
+
+func TestIPListOffenderDAO_Offend(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewIPListOffenderDAO()
+	var config = &ipescalationutils.Config{
+		IsOn: true,
+		Steps: []*ipescalationutils.Step{
+			{Timeout: 600},
+			{Timeout: 3600},
+			{Timeout: 0},
+		},
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		count, expiredAt, err := dao.Offend(tx, 1, "192.168.100.1", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log("count:", count, "expiredAt:", expiredAt)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+// IPListOffender IP名单违规记录
+type IPListOffender struct {
+	Id         uint64 `field:"id"`         // ID
+	ListId     uint32 `field:"listId"`     // 名单ID
+	Ip         string `field:"ip"`         // IP或IP范围
+	Count      uint32 `field:"count"`      // 当前连续违规次数
+	TotalCount uint32 `field:"totalCount"` // 累计违规次数
+	ExpiredAt  uint64 `field:"expiredAt"`  // 最后一次封禁过期时间，0表示永久
+	ResetAt    uint64 `field:"resetAt"`    // 违规次数重置时间，0表示不重置
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	UpdatedAt  uint64 `field:"updatedAt"`  // 最后一次违规时间
+}
+
+type IPListOffenderOperator struct {
+	Id         interface{} // ID
+	ListId     interface{} // 名单ID
+	Ip         interface{} // IP或IP范围
+	Count      interface{} // 当前连续违规次数
+	TotalCount interface{} // 累计违规次数
+	ExpiredAt  interface{} // 最后一次封禁过期时间，0表示永久
+	ResetAt    interface{} // 违规次数重置时间，0表示不重置
+	CreatedAt  interface{} // 创建时间
+	UpdatedAt  interface{} // 最后一次违规时间
+}
+
+func NewIPListOffenderOperator() *IPListOffenderOperator {
+	return &IPListOffenderOperator{}
+}
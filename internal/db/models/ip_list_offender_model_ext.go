@@ -0,0 +1,8 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+// IsRepeatAt 在某个时间再次违规时是否为重复违规
+func (this *IPListOffender) IsRepeatAt(now int64) bool {
+	return this.ResetAt == 0 || int64(this.ResetAt) >= now
+}
@@ -0,0 +1,413 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+// SettingCodeLoginSecurityPolicy 登录安全策略设置代号
+const SettingCodeLoginSecurityPolicy = "loginSecurityPolicy"
+
+type LoginAttemptRole = string
+
+const (
+	LoginAttemptRoleAdmin   LoginAttemptRole = "admin"
+	LoginAttemptRoleUser    LoginAttemptRole = "user"
+	LoginAttemptRoleSubUser LoginAttemptRole = "subUser"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedLoginAttemptDAO.CleanExpiredAttempts(nil)
+				if err != nil {
+					remotelogs.Error("LoginAttemptDAO", "clean expired attempts failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+type LoginAttemptDAO dbs.DAO
+
+func NewLoginAttemptDAO() *LoginAttemptDAO {
+	return dbs.NewDAO(&LoginAttemptDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeLoginAttempts",
+			Model:  new(LoginAttempt),
+			PkName: "id",
+		},
+	}).(*LoginAttemptDAO)
+}
+
+var SharedLoginAttemptDAO *LoginAttemptDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedLoginAttemptDAO = NewLoginAttemptDAO()
+	})
+}
+
+// CheckLogin 检查是否允许尝试登录，返回需要等待的秒数，0表示允许
+func (this *LoginAttemptDAO) CheckLogin(tx *dbs.Tx, role LoginAttemptRole, username string, ip string) (retryAfter int64, err error) {
+	policy, err := this.ReadLoginSecurityPolicy(tx)
+	if err != nil {
+		return 0, err
+	}
+	var throttle = policy.Throttle
+	if !throttle.IsOn {
+		return 0, nil
+	}
+
+	var targets = []string{}
+	if len(username) > 0 {
+		targets = append(targets, this.accountTarget(role, username))
+	}
+	if len(ip) > 0 {
+		targets = append(targets, this.ipTarget(ip))
+	}
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	var now = time.Now().Unix()
+	ones, err := this.Query(tx).
+		Attr("target", targets).
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var attempt = one.(*LoginAttempt)
+
+		// 锁定中
+		var lockedUntil = int64(attempt.LockedUntil)
+		if lockedUntil > now {
+			if lockedUntil-now > retryAfter {
+				retryAfter = lockedUntil - now
+			}
+			continue
+		}
+
+		// 统计周期已过
+		if int64(attempt.FirstFailedAt) < now-int64(throttle.WindowSeconds) || lockedUntil > 0 {
+			continue
+		}
+
+		// 渐进式等待
+		var delay = int64(throttle.ComputeDelay(int(attempt.CountFails)))
+		var nextTime = int64(attempt.LastFailedAt) + delay
+		if nextTime > now && nextTime-now > retryAfter {
+			retryAfter = nextTime - now
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// RecordLoginFailure 记录登录失败，达到限制时锁定并发送消息
+func (this *LoginAttemptDAO) RecordLoginFailure(tx *dbs.Tx, role LoginAttemptRole, username string, ip string) error {
+	policy, err := this.ReadLoginSecurityPolicy(tx)
+	if err != nil {
+		return err
+	}
+	var throttle = policy.Throttle
+	if !throttle.IsOn {
+		return nil
+	}
+
+	// 账号
+	username = strings.TrimSpace(username)
+	if len(username) > 0 {
+		lockedUntil, err := this.recordFailure(tx, throttle, this.accountTarget(role, username), throttle.MaxAccountFails)
+		if err != nil {
+			return err
+		}
+		if lockedUntil > 0 {
+			err = this.notifyAccountLocked(tx, throttle, role, username, ip, lockedUntil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// IP
+	if len(ip) > 0 {
+		lockedUntil, err := this.recordFailure(tx, throttle, this.ipTarget(ip), throttle.MaxIPFails)
+		if err != nil {
+			return err
+		}
+		if lockedUntil > 0 {
+			var subject = "IP \"" + ip + "\" 登录失败次数过多，已被暂时锁定"
+			var body = "IP \"" + ip + "\" 在" + types.String(throttle.WindowSeconds) + "秒内登录失败" + types.String(throttle.MaxIPFails) + "次，已被锁定到 " + timeutil.FormatTime("Y-m-d H:i:s", lockedUntil) + "，可能正在遭受撞库攻击。"
+			err = SharedMessageDAO.CreateMessage(tx, 0, 0, MessageTypeLoginLocked, MessageLevelWarning, subject, body, maps.Map{
+				"role":        role,
+				"ip":          ip,
+				"lockedUntil": lockedUntil,
+			}.AsJSON())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RecordLoginSuccess 登录成功后清除账号的失败记录
+// IP的失败记录不清除，以免攻击者使用自己的账号重置计数
+func (this *LoginAttemptDAO) RecordLoginSuccess(tx *dbs.Tx, role LoginAttemptRole, username string) error {
+	username = strings.TrimSpace(username)
+	if len(username) == 0 {
+		return nil
+	}
+	return this.Query(tx).
+		Attr("target", this.accountTarget(role, username)).
+		DeleteQuickly()
+}
+
+// RecordPasswordSuccess 密码验证成功
+// 如果设置了第二认证因素，需要在第二认证因素验证成功后再调用 RecordLoginSuccess，以免攻击者在已知密码时重置计数
+func (this *LoginAttemptDAO) RecordPasswordSuccess(tx *dbs.Tx, role LoginAttemptRole, username string, adminId int64, userId int64) error {
+	hasOTP, hasWebAuthn, err := SharedLoginDAO.CheckSecondFactor(tx, adminId, userId)
+	if err != nil {
+		return err
+	}
+	if hasOTP || hasWebAuthn {
+		return nil
+	}
+	return this.RecordLoginSuccess(tx, role, username)
+}
+
+// CheckSecondFactorLogin 验证第二认证因素之前检查是否允许尝试，返回需要等待的秒数
+func (this *LoginAttemptDAO) CheckSecondFactorLogin(tx *dbs.Tx, adminId int64, userId int64, ip string) (retryAfter int64, err error) {
+	role, username, err := this.findAccount(tx, adminId, userId)
+	if err != nil || len(username) == 0 {
+		return 0, err
+	}
+	return this.CheckLogin(tx, role, username, ip)
+}
+
+// RecordSecondFactorFailure 记录第二认证因素（OTP、恢复码等）验证失败
+func (this *LoginAttemptDAO) RecordSecondFactorFailure(tx *dbs.Tx, adminId int64, userId int64, ip string) error {
+	role, username, err := this.findAccount(tx, adminId, userId)
+	if err != nil || len(username) == 0 {
+		return err
+	}
+	return this.RecordLoginFailure(tx, role, username, ip)
+}
+
+// RecordSecondFactorSuccess 第二认证因素验证成功后清除账号的失败记录
+func (this *LoginAttemptDAO) RecordSecondFactorSuccess(tx *dbs.Tx, adminId int64, userId int64) error {
+	role, username, err := this.findAccount(tx, adminId, userId)
+	if err != nil || len(username) == 0 {
+		return err
+	}
+	return this.RecordLoginSuccess(tx, role, username)
+}
+
+// UnlockAccount 解除账号锁定
+func (this *LoginAttemptDAO) UnlockAccount(tx *dbs.Tx, role LoginAttemptRole, username string) error {
+	return this.RecordLoginSuccess(tx, role, username)
+}
+
+// UnlockIP 解除IP锁定
+func (this *LoginAttemptDAO) UnlockIP(tx *dbs.Tx, ip string) error {
+	if len(ip) == 0 {
+		return nil
+	}
+	return this.Query(tx).
+		Attr("target", this.ipTarget(ip)).
+		DeleteQuickly()
+}
+
+// CleanExpiredAttempts 清理过期的失败记录
+func (this *LoginAttemptDAO) CleanExpiredAttempts(tx *dbs.Tx) error {
+	// 保留一天，以便统计周期较长时仍然有效
+	var now = time.Now().Unix()
+	return this.Query(tx).
+		Lt("lastFailedAt", now-86400).
+		Lt("lockedUntil", now).
+		DeleteQuickly()
+}
+
+// ReadLoginSecurityPolicy 读取登录安全策略
+func (this *LoginAttemptDAO) ReadLoginSecurityPolicy(tx *dbs.Tx) (*passwordutils.Policy, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeLoginSecurityPolicy)
+	if err != nil {
+		return nil, err
+	}
+	var policy = passwordutils.DefaultPolicy()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = policy.Init()
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// UpdateLoginSecurityPolicy 修改登录安全策略
+func (this *LoginAttemptDAO) UpdateLoginSecurityPolicy(tx *dbs.Tx, policy *passwordutils.Policy) error {
+	if policy == nil {
+		return errors.New("invalid policy")
+	}
+	err := policy.Init()
+	if err != nil {
+		return err
+	}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeLoginSecurityPolicy, policyJSON)
+}
+
+// 增加失败次数，如果此次失败导致锁定，则返回锁定截止时间
+func (this *LoginAttemptDAO) recordFailure(tx *dbs.Tx, throttle *passwordutils.ThrottlePolicy, target string, maxFails int) (lockedUntil int64, err error) {
+	var now = time.Now().Unix()
+	var lockUntil int64
+	if maxFails > 0 {
+		lockUntil = now + int64(throttle.LockSeconds)
+	}
+
+	// 统计周期已过或者锁定已过期时重新计数
+	// 生成SQL语句时字段按名称排序，所以 lockedUntil 中的 countFails 为更新后的值
+	err = this.Query(tx).
+		Param("now", now).
+		Param("windowStart", now-int64(throttle.WindowSeconds)).
+		Param("maxFails", maxFails).
+		Param("lockUntil", lockUntil).
+		InsertOrUpdateQuickly(maps.Map{
+			"target":        target,
+			"countFails":    1,
+			"firstFailedAt": now,
+			"lastFailedAt":  now,
+			"lockedUntil":   this.lockedUntilWith(1, maxFails, lockUntil),
+		}, maps.Map{
+			"countFails":    dbs.SQL("IF(firstFailedAt<:windowStart OR (lockedUntil>0 AND lockedUntil<=:now), 1, countFails+1)"),
+			"firstFailedAt": dbs.SQL("IF(firstFailedAt<:windowStart OR (lockedUntil>0 AND lockedUntil<=:now), :now, firstFailedAt)"),
+			"lastFailedAt":  now,
+			"lockedUntil":   dbs.SQL("IF(lockedUntil>:now, lockedUntil, IF(:maxFails>0 AND countFails>=:maxFails, :lockUntil, 0))"),
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	if maxFails <= 0 {
+		return 0, nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("target", target).
+		Find()
+	if err != nil || one == nil {
+		return 0, err
+	}
+	var attempt = one.(*LoginAttempt)
+
+	// 只有恰好达到限制的那次失败才算作新的锁定，避免重复发送消息
+	if int(attempt.CountFails) == maxFails && int64(attempt.LockedUntil) > now {
+		return int64(attempt.LockedUntil), nil
+	}
+	return 0, nil
+}
+
+func (this *LoginAttemptDAO) lockedUntilWith(countFails int, maxFails int, lockUntil int64) int64 {
+	if maxFails > 0 && countFails >= maxFails {
+		return lockUntil
+	}
+	return 0
+}
+
+// 发送账号锁定消息
+func (this *LoginAttemptDAO) notifyAccountLocked(tx *dbs.Tx, throttle *passwordutils.ThrottlePolicy, role LoginAttemptRole, username string, ip string, lockedUntil int64) error {
+	var accountName = "账号"
+	var userTip = "如果不是你本人的操作，请及时修改密码。"
+	if role == LoginAttemptRoleSubUser {
+		accountName = "子用户账号"
+		userTip = "如果不是子用户本人的操作，请及时修改子用户密码。"
+	}
+	var subject = accountName + " \"" + username + "\" 登录失败次数过多，已被暂时锁定"
+	var body = accountName + " \"" + username + "\" 在" + types.String(throttle.WindowSeconds) + "秒内登录失败" + types.String(throttle.MaxAccountFails) + "次，已被锁定到 " + timeutil.FormatTime("Y-m-d H:i:s", lockedUntil) + "，最后一次尝试的IP为 \"" + ip + "\"。"
+	var paramsJSON = maps.Map{
+		"role":        role,
+		"username":    username,
+		"ip":          ip,
+		"lockedUntil": lockedUntil,
+	}.AsJSON()
+
+	// 通知管理员
+	err := SharedMessageDAO.CreateMessage(tx, 0, 0, MessageTypeLoginLocked, MessageLevelWarning, subject, body, paramsJSON)
+	if err != nil {
+		return err
+	}
+
+	// 通知用户本人，子用户通知所属的主用户
+	var userId int64
+	switch role {
+	case LoginAttemptRoleUser:
+		userId, err = SharedUserDAO.FindEnabledUserIdWithUsername(tx, username)
+	case LoginAttemptRoleSubUser:
+		userId, err = SharedSubUserDAO.FindEnabledSubUserUserIdWithUsername(tx, username)
+	}
+	if err != nil {
+		return err
+	}
+	if userId > 0 {
+		err = SharedMessageDAO.CreateMessage(tx, 0, userId, MessageTypeLoginLocked, MessageLevelWarning, subject, body+userTip, paramsJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 查找管理员或用户的登录用户名
+func (this *LoginAttemptDAO) findAccount(tx *dbs.Tx, adminId int64, userId int64) (role LoginAttemptRole, username string, err error) {
+	if adminId > 0 {
+		admin, err := SharedAdminDAO.FindEnabledAdmin(tx, adminId)
+		if err != nil || admin == nil {
+			return "", "", err
+		}
+		return LoginAttemptRoleAdmin, admin.Username, nil
+	}
+	if userId > 0 {
+		user, err := SharedUserDAO.FindEnabledBasicUser(tx, userId)
+		if err != nil || user == nil {
+			return "", "", err
+		}
+		return LoginAttemptRoleUser, user.Username, nil
+	}
+	return "", "", nil
+}
+
+func (this *LoginAttemptDAO) accountTarget(role LoginAttemptRole, username string) string {
+	return role + "@" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func (this *LoginAttemptDAO) ipTarget(ip string) string {
+	return "ip@" + ip
+}
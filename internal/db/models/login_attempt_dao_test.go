@@ -0,0 +1,79 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestLoginAttemptDAO_RecordLoginFailure(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewLoginAttemptDAO()
+	const username = "login-attempt-test"
+	const ip = "192.168.100.100"
+
+	defer func() {
+		_ = dao.UnlockAccount(tx, models.LoginAttemptRoleUser, username)
+		_ = dao.UnlockIP(tx, ip)
+	}()
+
+	policy, err := dao.ReadLoginSecurityPolicy(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Throttle.IsOn || policy.Throttle.MaxAccountFails <= 0 {
+		t.Log("throttle is off, skip")
+		return
+	}
+
+	for i := 0; i < policy.Throttle.MaxAccountFails; i++ {
+		err = dao.RecordLoginFailure(tx, models.LoginAttemptRoleUser, username, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retryAfter, err := dao.CheckLogin(tx, models.LoginAttemptRoleUser, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("retryAfter:", retryAfter)
+	if retryAfter <= 0 {
+		t.Fatal("account should be locked")
+	}
+
+	// 其他角色不受影响
+	retryAfter, err = dao.CheckLogin(tx, models.LoginAttemptRoleAdmin, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter > 0 {
+		t.Fatal("admin account should not be locked")
+	}
+	retryAfter, err = dao.CheckLogin(tx, models.LoginAttemptRoleSubUser, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter > 0 {
+		t.Fatal("sub user account should not be locked")
+	}
+
+	err = dao.UnlockAccount(tx, models.LoginAttemptRoleUser, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryAfter, err = dao.CheckLogin(tx, models.LoginAttemptRoleUser, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter > 0 {
+		t.Fatal("account should be unlocked")
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+// LoginAttempt 登录失败记录
+type LoginAttempt struct {
+	Id            uint64 `field:"id"`            // ID
+	Target        string `field:"target"`        // 对象：admin@用户名、user@用户名、ip@IP
+	CountFails    uint32 `field:"countFails"`    // 统计周期内失败次数
+	FirstFailedAt uint64 `field:"firstFailedAt"` // 统计周期内第一次失败时间
+	LastFailedAt  uint64 `field:"lastFailedAt"`  // 最后一次失败时间
+	LockedUntil   uint64 `field:"lockedUntil"`   // 锁定截止时间
+}
+
+type LoginAttemptOperator struct {
+	Id            interface{} // ID
+	Target        interface{} // 对象：admin@用户名、user@用户名、ip@IP
+	CountFails    interface{} // 统计周期内失败次数
+	FirstFailedAt interface{} // 统计周期内第一次失败时间
+	LastFailedAt  interface{} // 最后一次失败时间
+	LockedUntil   interface{} // 锁定截止时间
+}
+
+func NewLoginAttemptOperator() *LoginAttemptOperator {
+	return &LoginAttemptOperator{}
+}
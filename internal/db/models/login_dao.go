@@ -1,11 +1,20 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
+	"time"
+
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ldaputils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/webauthnutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
 )
 
 const (
@@ -16,9 +25,19 @@ const (
 type LoginType = string
 
 const (
-	LoginTypeOTP LoginType = "otp"
+	LoginTypeOTP  LoginType = "otp"
+	LoginTypeOIDC LoginType = "oidc"
+	LoginTypeLDAP LoginType = "ldap"
+
+	LoginTypeWebAuthn      LoginType = "webauthn"      // 每个凭证一条记录
+	LoginTypeRecoveryCodes LoginType = "recoveryCodes" // 第二认证因素的恢复码
+
+	LoginTypePasswordHistory LoginType = "passwordHistory" // 最近使用过的密码
 )
 
+// SettingCodeLDAPConfig LDAP登录设置代号
+const SettingCodeLDAPConfig = "ldapConfig"
+
 type LoginDAO dbs.DAO
 
 func NewLoginDAO() *LoginDAO {
@@ -179,3 +198,432 @@ func (this *LoginDAO) CheckLoginIsOn(tx *dbs.Tx, adminId int64, userId int64, lo
 
 	return query.Exist()
 }
+
+// FindOIDCIdentity 根据OIDC身份查找绑定的管理员或用户
+func (this *LoginDAO) FindOIDCIdentity(tx *dbs.Tx, isAdmin bool, issuer string, subject string) (adminId int64, userId int64, err error) {
+	if len(issuer) == 0 || len(subject) == 0 {
+		return 0, 0, nil
+	}
+
+	var query = this.Query(tx).
+		Attr("type", LoginTypeOIDC).
+		State(LoginStateEnabled).
+		Attr("isOn", true).
+		Where("JSON_UNQUOTE(JSON_EXTRACT(params, '$.issuer'))=:issuer").
+		Where("JSON_UNQUOTE(JSON_EXTRACT(params, '$.subject'))=:subject").
+		Param("issuer", issuer).
+		Param("subject", subject).
+		Result("adminId", "userId")
+	if isAdmin {
+		query.Gt("adminId", 0)
+	} else {
+		query.Gt("userId", 0)
+	}
+
+	one, err := query.Find()
+	if err != nil || one == nil {
+		return 0, 0, err
+	}
+	var login = one.(*Login)
+	return int64(login.AdminId), int64(login.UserId), nil
+}
+
+// BindOIDCIdentity 绑定OIDC身份到管理员或用户
+func (this *LoginDAO) BindOIDCIdentity(tx *dbs.Tx, adminId int64, userId int64, issuer string, subject string) error {
+	if len(issuer) == 0 || len(subject) == 0 {
+		return errors.New("'issuer' and 'subject' should not be empty")
+	}
+
+	// 同一个身份只能绑定一个账号
+	boundAdminId, boundUserId, err := this.FindOIDCIdentity(tx, adminId > 0, issuer, subject)
+	if err != nil {
+		return err
+	}
+	if (boundAdminId > 0 && boundAdminId != adminId) || (boundUserId > 0 && boundUserId != userId) {
+		return errors.New("the identity has been bound to another account")
+	}
+
+	return this.UpdateLogin(tx, adminId, userId, LoginTypeOIDC, maps.Map{
+		"issuer":  issuer,
+		"subject": subject,
+	}, true)
+}
+
+// FindLDAPAdminLogin 根据LDAP用户名查找绑定的管理员认证
+func (this *LoginDAO) FindLDAPAdminLogin(tx *dbs.Tx, username string) (*Login, error) {
+	if len(username) == 0 {
+		return nil, nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("type", LoginTypeLDAP).
+		State(LoginStateEnabled).
+		Attr("isOn", true).
+		Gt("adminId", 0).
+		Where("LOWER(JSON_UNQUOTE(JSON_EXTRACT(params, '$.username')))=:username").
+		Param("username", strings.ToLower(username)).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*Login), nil
+}
+
+// FindAllLDAPAdminLogins 查找所有绑定了LDAP用户的管理员认证
+func (this *LoginDAO) FindAllLDAPAdminLogins(tx *dbs.Tx) (result []*Login, err error) {
+	_, err = this.Query(tx).
+		Attr("type", LoginTypeLDAP).
+		State(LoginStateEnabled).
+		Attr("isOn", true).
+		Gt("adminId", 0).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// BindLDAPIdentity 绑定LDAP用户到管理员
+// disabledBySync 表示管理员是否因为已从目录中删除而被自动禁用，用户重新出现在目录中时可以自动启用
+func (this *LoginDAO) BindLDAPIdentity(tx *dbs.Tx, adminId int64, username string, dn string, disabledBySync bool) error {
+	if adminId <= 0 {
+		return errors.New("invalid adminId")
+	}
+	if len(username) == 0 {
+		return errors.New("'username' should not be empty")
+	}
+
+	// 同一个LDAP用户只能绑定一个管理员
+	login, err := this.FindLDAPAdminLogin(tx, username)
+	if err != nil {
+		return err
+	}
+	if login != nil && int64(login.AdminId) != adminId {
+		return errors.New("the ldap user has been bound to another admin")
+	}
+
+	return this.UpdateLogin(tx, adminId, 0, LoginTypeLDAP, maps.Map{
+		"username":       username,
+		"dn":             dn,
+		"disabledBySync": disabledBySync,
+	}, true)
+}
+
+// ReadLDAPConfig 读取LDAP登录设置
+func (this *LoginDAO) ReadLDAPConfig(tx *dbs.Tx) (*ldaputils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeLDAPConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = ldaputils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateLDAPConfig 修改LDAP登录设置
+func (this *LoginDAO) UpdateLDAPConfig(tx *dbs.Tx, config *ldaputils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeLDAPConfig, configJSON)
+}
+
+// SyncLDAPAdmin 根据目录中的用户信息同步绑定的管理员，user为nil时表示用户已从目录中删除
+// 返回管理员是否可以登录
+func (this *LoginDAO) SyncLDAPAdmin(tx *dbs.Tx, config *ldaputils.Config, login *Login, user *ldaputils.User) (isOn bool, err error) {
+	if login == nil || login.AdminId == 0 {
+		return false, errors.New("invalid login")
+	}
+	var adminId = int64(login.AdminId)
+	var params = login.DecodeParams()
+	var username = params.GetString("username")
+	var disabledBySync = params.GetBool("disabledBySync")
+
+	// 已从目录中删除
+	if user == nil {
+		if disabledBySync {
+			return false, nil
+		}
+		err = SharedAdminDAO.UpdateAdminIsOn(tx, adminId, false)
+		if err != nil {
+			return false, err
+		}
+		return false, this.BindLDAPIdentity(tx, adminId, username, params.GetString("dn"), true)
+	}
+
+	admin, err := SharedAdminDAO.FindEnabledAdmin(tx, adminId)
+	if err != nil || admin == nil {
+		return false, err
+	}
+
+	// 被手动禁用的管理员不自动启用
+	if !admin.IsOn && !disabledBySync {
+		return false, nil
+	}
+
+	isOn, err = SharedAdminDAO.SyncAdminWithLDAPUser(tx, adminId, config, user)
+	if err != nil {
+		return false, err
+	}
+	if isOn && !admin.IsOn {
+		err = SharedAdminDAO.UpdateAdminIsOn(tx, adminId, true)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return isOn, this.BindLDAPIdentity(tx, adminId, username, user.DN, !isOn)
+}
+
+// CreateWebAuthnCredential 添加WebAuthn凭证，每个管理员或用户可以有多个凭证
+func (this *LoginDAO) CreateWebAuthnCredential(tx *dbs.Tx, adminId int64, userId int64, name string, credential *webauthnutils.Credential) (int64, error) {
+	if adminId <= 0 && userId <= 0 {
+		return 0, errors.New("invalid adminId and userId")
+	}
+	if credential == nil || len(credential.Id) == 0 {
+		return 0, errors.New("invalid credential")
+	}
+
+	// 凭证ID不能重复
+	exists, err := this.Query(tx).
+		Attr("type", LoginTypeWebAuthn).
+		State(LoginStateEnabled).
+		Where("JSON_UNQUOTE(JSON_EXTRACT(params, '$.credentialId'))=:credentialId").
+		Param("credentialId", webauthnutils.EncodeBase64URL(credential.Id)).
+		Exist()
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, errors.New("the credential has been registered")
+	}
+
+	var op = NewLoginOperator()
+	op.AdminId = adminId
+	op.UserId = userId
+	op.Type = LoginTypeWebAuthn
+	op.Params = maps.Map{
+		"name":         name,
+		"credentialId": webauthnutils.EncodeBase64URL(credential.Id),
+		"credential":   credential,
+		"createdAt":    time.Now().Unix(),
+		"lastUsedAt":   0,
+	}.AsJSON()
+	op.IsOn = true
+	op.State = LoginStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// FindAllWebAuthnCredentials 查找管理员或用户的所有WebAuthn凭证
+func (this *LoginDAO) FindAllWebAuthnCredentials(tx *dbs.Tx, adminId int64, userId int64) (result []*Login, err error) {
+	if adminId <= 0 && userId <= 0 {
+		return
+	}
+	_, err = this.Query(tx).
+		Attr("type", LoginTypeWebAuthn).
+		Attr("adminId", adminId).
+		Attr("userId", userId).
+		State(LoginStateEnabled).
+		Attr("isOn", true).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindWebAuthnCredential 根据凭证ID查找管理员或用户的WebAuthn凭证
+func (this *LoginDAO) FindWebAuthnCredential(tx *dbs.Tx, adminId int64, userId int64, credentialId []byte) (*Login, error) {
+	if (adminId <= 0 && userId <= 0) || len(credentialId) == 0 {
+		return nil, nil
+	}
+	one, err := this.Query(tx).
+		Attr("type", LoginTypeWebAuthn).
+		Attr("adminId", adminId).
+		Attr("userId", userId).
+		State(LoginStateEnabled).
+		Attr("isOn", true).
+		Where("JSON_UNQUOTE(JSON_EXTRACT(params, '$.credentialId'))=:credentialId").
+		Param("credentialId", webauthnutils.EncodeBase64URL(credentialId)).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*Login), nil
+}
+
+// UpdateWebAuthnCredentialUsage 认证成功后更新凭证的计数器和备份状态
+func (this *LoginDAO) UpdateWebAuthnCredentialUsage(tx *dbs.Tx, login *Login, signCount uint32, backupState bool) error {
+	if login == nil {
+		return errors.New("invalid login")
+	}
+	credential, err := login.DecodeWebAuthnCredential()
+	if err != nil {
+		return err
+	}
+	credential.SignCount = signCount
+	credential.BackupState = backupState
+
+	var params = login.DecodeParams()
+	params["credential"] = credential
+	params["lastUsedAt"] = time.Now().Unix()
+
+	var op = NewLoginOperator()
+	op.Id = login.Id
+	op.Params = params.AsJSON()
+	return this.Save(tx, op)
+}
+
+// DeleteWebAuthnCredential 删除管理员或用户的WebAuthn凭证
+func (this *LoginDAO) DeleteWebAuthnCredential(tx *dbs.Tx, adminId int64, userId int64, loginId int64) error {
+	if adminId <= 0 && userId <= 0 {
+		return errors.New("invalid adminId and userId")
+	}
+	return this.Query(tx).
+		Pk(loginId).
+		Attr("type", LoginTypeWebAuthn).
+		Attr("adminId", adminId).
+		Attr("userId", userId).
+		Set("state", LoginStateDisabled).
+		UpdateQuickly()
+}
+
+// UpdateRecoveryCodes 重新设置恢复码，只保存哈希值
+func (this *LoginDAO) UpdateRecoveryCodes(tx *dbs.Tx, adminId int64, userId int64, hashes []string) error {
+	return this.UpdateLogin(tx, adminId, userId, LoginTypeRecoveryCodes, maps.Map{
+		"codes":     hashes,
+		"createdAt": time.Now().Unix(),
+	}, true)
+}
+
+// CountRecoveryCodes 计算剩余的恢复码数量
+func (this *LoginDAO) CountRecoveryCodes(tx *dbs.Tx, adminId int64, userId int64) (int, error) {
+	login, err := this.FindEnabledLoginWithType(tx, adminId, userId, LoginTypeRecoveryCodes)
+	if err != nil || login == nil || !login.IsOn {
+		return 0, err
+	}
+	return len(login.DecodeRecoveryCodes()), nil
+}
+
+// UseRecoveryCode 使用恢复码，每个恢复码只能使用一次
+func (this *LoginDAO) UseRecoveryCode(tx *dbs.Tx, adminId int64, userId int64, code string) (bool, error) {
+	if (adminId <= 0 && userId <= 0) || len(code) == 0 {
+		return false, nil
+	}
+	login, err := this.FindEnabledLoginWithType(tx, adminId, userId, LoginTypeRecoveryCodes)
+	if err != nil || login == nil || !login.IsOn {
+		return false, err
+	}
+
+	var hashes = login.DecodeRecoveryCodes()
+	var index = webauthnutils.MatchRecoveryCode(hashes, code)
+	if index < 0 {
+		return false, nil
+	}
+
+	// 在数据库中原子地删除当前恢复码，防止并发请求重复使用
+	rows, err := this.Query(tx).
+		Pk(login.Id).
+		Where("JSON_SEARCH(params, 'one', :hash, NULL, '$.codes') IS NOT NULL").
+		Param("hash", hashes[index]).
+		Set("params", dbs.SQL("JSON_REMOVE(params, JSON_UNQUOTE(JSON_SEARCH(params, 'one', :hash, NULL, '$.codes')))")).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CheckSecondFactor 检查管理员或用户是否已经设置了第二认证因素
+func (this *LoginDAO) CheckSecondFactor(tx *dbs.Tx, adminId int64, userId int64) (hasOTP bool, hasWebAuthn bool, err error) {
+	hasOTP, err = this.CheckLoginIsOn(tx, adminId, userId, LoginTypeOTP)
+	if err != nil {
+		return
+	}
+	hasWebAuthn, err = this.CheckLoginIsOn(tx, adminId, userId, LoginTypeWebAuthn)
+	return
+}
+
+// CheckNewPassword 检查新密码是否符合登录安全策略
+// currentPasswordHash 为当前正在使用的密码哈希值
+func (this *LoginDAO) CheckNewPassword(tx *dbs.Tx, adminId int64, userId int64, username string, currentPasswordHash string, password string) error {
+	policy, err := SharedLoginAttemptDAO.ReadLoginSecurityPolicy(tx)
+	if err != nil {
+		return err
+	}
+	var passwordPolicy = policy.Password
+	err = passwordutils.CheckPassword(passwordPolicy, username, password)
+	if err != nil {
+		return err
+	}
+
+	if !passwordPolicy.IsOn || passwordPolicy.HistorySize <= 0 || (adminId <= 0 && userId <= 0) {
+		return nil
+	}
+
+	var hashes = []string{}
+	if len(currentPasswordHash) > 0 {
+		hashes = append(hashes, currentPasswordHash)
+	}
+	login, err := this.FindEnabledLoginWithType(tx, adminId, userId, LoginTypePasswordHistory)
+	if err != nil {
+		return err
+	}
+	if login != nil {
+		hashes = append(hashes, login.DecodePasswordHistory()...)
+	}
+	if len(hashes) > passwordPolicy.HistorySize {
+		hashes = hashes[:passwordPolicy.HistorySize]
+	}
+
+	var passwordHash = stringutil.Md5(password)
+	for _, hash := range hashes {
+		if hash == passwordHash {
+			return &passwordutils.PolicyError{Message: "不能使用最近" + types.String(passwordPolicy.HistorySize) + "次使用过的密码"}
+		}
+	}
+	return nil
+}
+
+// RecordPasswordHistory 修改密码时记录旧密码，以便检查密码是否重复使用
+func (this *LoginDAO) RecordPasswordHistory(tx *dbs.Tx, adminId int64, userId int64, oldPasswordHash string) error {
+	if (adminId <= 0 && userId <= 0) || len(oldPasswordHash) == 0 {
+		return nil
+	}
+
+	login, err := this.FindEnabledLoginWithType(tx, adminId, userId, LoginTypePasswordHistory)
+	if err != nil {
+		return err
+	}
+	var hashes = []string{oldPasswordHash}
+	if login != nil {
+		for _, hash := range login.DecodePasswordHistory() {
+			if hash != oldPasswordHash {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+
+	// 总是保留最大数量，以便策略修改后仍然有效
+	if len(hashes) > passwordutils.MaxHistorySize {
+		hashes = hashes[:passwordutils.MaxHistorySize]
+	}
+	return this.UpdateLogin(tx, adminId, userId, LoginTypePasswordHistory, maps.Map{
+		"hashes": hashes,
+	}, true)
+}
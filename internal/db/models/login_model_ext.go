@@ -1 +1,55 @@
 package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/webauthnutils"
+	"github.com/iwind/TeaGo/maps"
+)
+
+// DecodeParams 解析参数
+func (this *Login) DecodeParams() maps.Map {
+	var params = maps.Map{}
+	if IsNotNull(this.Params) {
+		_ = json.Unmarshal(this.Params, &params)
+	}
+	return params
+}
+
+// DecodeWebAuthnCredential 解析WebAuthn凭证
+func (this *Login) DecodeWebAuthnCredential() (*webauthnutils.Credential, error) {
+	var params = struct {
+		Credential *webauthnutils.Credential `json:"credential"`
+	}{}
+	err := json.Unmarshal(this.Params, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Credential == nil || len(params.Credential.Id) == 0 {
+		return nil, errors.New("invalid webauthn credential")
+	}
+	return params.Credential, nil
+}
+
+// DecodeRecoveryCodes 解析恢复码哈希值
+func (this *Login) DecodeRecoveryCodes() []string {
+	var params = struct {
+		Codes []string `json:"codes"`
+	}{}
+	if IsNotNull(this.Params) {
+		_ = json.Unmarshal(this.Params, &params)
+	}
+	return params.Codes
+}
+
+// DecodePasswordHistory 解析最近使用过的密码哈希值，最近的在前
+func (this *Login) DecodePasswordHistory() []string {
+	var params = struct {
+		Hashes []string `json:"hashes"`
+	}{}
+	if IsNotNull(this.Params) {
+		_ = json.Unmarshal(this.Params, &params)
+	}
+	return params.Hashes
+}
@@ -5,6 +5,10 @@ import (
 	"errors"
 	"time"
 
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/sessionutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -12,7 +16,22 @@ import (
 	"github.com/iwind/TeaGo/types"
 )
 
-// TODO 定时清理过期的SESSION
+// SettingCodeLoginSessionConfig 登录会话设置代号
+const SettingCodeLoginSessionConfig = "loginSessionConfig"
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedLoginSessionDAO.CleanExpiredSessions(nil)
+				if err != nil {
+					remotelogs.Error("LoginSessionDAO", "clean expired sessions failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
 
 type LoginSessionDAO dbs.DAO
 
@@ -55,11 +74,13 @@ func (this *LoginSessionDAO) CreateSession(tx *dbs.Tx, sid string, ip string, ex
 		op.Id = oldSessionId
 	}
 
+	var now = time.Now().Unix()
 	op.Sid = sid
 	op.Ip = ip
 	op.Values = "{}"
 	op.ExpiresAt = expiresAt
-	op.CreatedAt = time.Now().Unix()
+	op.CreatedAt = now
+	op.LastSeenAt = now
 
 	if oldSessionId > 0 {
 		err := this.Save(tx, op)
@@ -77,6 +98,11 @@ func (this *LoginSessionDAO) WriteSessionValue(tx *dbs.Tx, sid string, key strin
 		return errors.New("invalid 'sid'")
 	}
 
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return err
+	}
+
 	// 是否存在
 	sessionOne, err := this.Query(tx).
 		Attr("sid", sid).
@@ -88,7 +114,7 @@ func (this *LoginSessionDAO) WriteSessionValue(tx *dbs.Tx, sid string, key strin
 	var valueMap = maps.Map{}
 	if sessionOne != nil {
 		var session = sessionOne.(*LoginSession)
-		if session.IsAvailable() {
+		if session.IsAvailableWithConfig(config) {
 			sessionId = int64(session.Id)
 
 			if !IsNull(session.Values) {
@@ -129,18 +155,26 @@ func (this *LoginSessionDAO) WriteSessionValue(tx *dbs.Tx, sid string, key strin
 		userId = types.Int64(value)
 	}
 
+	var now = time.Now().Unix()
 	if adminId > 0 || userId > 0 {
 		sessionOp.AdminId = adminId
 		sessionOp.UserId = userId
+
+		// 从登录时开始计算有效期
+		sessionOp.CreatedAt = now
 	}
+	sessionOp.LastSeenAt = now
 
 	// 写入数据
 	valueMap[key] = value
 	sessionOp.Values = valueMap.AsJSON()
 
 	// IP
-	if key == "@ip" {
+	switch key {
+	case "@ip":
 		sessionOp.Ip = value
+	case "@userAgent":
+		sessionOp.UserAgent = utils.LimitString(types.String(value), 512)
 	}
 
 	return this.Save(tx, sessionOp)
@@ -153,8 +187,18 @@ func (this *LoginSessionDAO) DeleteSession(tx *dbs.Tx, sid string) error {
 		DeleteQuickly()
 }
 
-// FindSession 查询SESSION
+// FindSession 查询SESSION，同时更新最后活跃时间
+// 已超时的SESSION会被删除，并返回nil
 func (this *LoginSessionDAO) FindSession(tx *dbs.Tx, sid string) (*LoginSession, error) {
+	if len(sid) == 0 {
+		return nil, nil
+	}
+
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
 	one, err := this.Query(tx).
 		Attr("sid", sid).
 		Find()
@@ -164,17 +208,200 @@ func (this *LoginSessionDAO) FindSession(tx *dbs.Tx, sid string) (*LoginSession,
 	var session = one.(*LoginSession)
 
 	// 不可用则删除
-	if !session.IsAvailable() {
+	if !session.IsAvailableWithConfig(config) {
 		err = this.Query(tx).
 			Pk(session.Id).
 			DeleteQuickly()
 		if err != nil {
 			return nil, err
 		}
+		return nil, nil
 	}
+
+	// 更新最后活跃时间
+	var now = time.Now().Unix()
+	if sessionutils.ShouldUpdateLastSeen(int64(session.LastSeenAt), now) {
+		err = this.Query(tx).
+			Pk(session.Id).
+			Set("lastSeenAt", now).
+			UpdateQuickly()
+		if err != nil {
+			return nil, err
+		}
+		session.LastSeenAt = uint64(now)
+	}
+
 	return session, nil
 }
 
+// FindEnabledSessionWithId 根据ID查找可用的SESSION
+func (this *LoginSessionDAO) FindEnabledSessionWithId(tx *dbs.Tx, sessionId int64) (*LoginSession, error) {
+	if sessionId <= 0 {
+		return nil, nil
+	}
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	one, err := this.Query(tx).
+		Pk(sessionId).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	var session = one.(*LoginSession)
+	if !session.IsAvailableWithConfig(config) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// FindAllActiveSessions 列出管理员或用户所有已登录的SESSION，最近活跃的在前
+func (this *LoginSessionDAO) FindAllActiveSessions(tx *dbs.Tx, adminId int64, userId int64) (result []*LoginSession, err error) {
+	if adminId <= 0 && userId <= 0 {
+		return nil, nil
+	}
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var query = this.Query(tx)
+	if adminId > 0 {
+		query.Attr("adminId", adminId)
+	} else {
+		query.Attr("userId", userId)
+	}
+	ones, err := query.
+		Desc("lastSeenAt").
+		DescPk().
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		var session = one.(*LoginSession)
+		if session.IsAvailableWithConfig(config) {
+			result = append(result, session)
+		}
+	}
+	return
+}
+
+// DeleteSessionWithId 根据ID删除SESSION
+func (this *LoginSessionDAO) DeleteSessionWithId(tx *dbs.Tx, sessionId int64) error {
+	if sessionId <= 0 {
+		return errors.New("invalid 'sessionId'")
+	}
+	return this.Query(tx).
+		Pk(sessionId).
+		DeleteQuickly()
+}
+
+// DeleteAllSessions 删除管理员或用户所有的SESSION，exceptSid 不为空时保留此SESSION
+func (this *LoginSessionDAO) DeleteAllSessions(tx *dbs.Tx, adminId int64, userId int64, exceptSid string) error {
+	if adminId <= 0 && userId <= 0 {
+		return nil
+	}
+	var query = this.Query(tx)
+	if adminId > 0 {
+		query.Attr("adminId", adminId)
+	} else {
+		query.Attr("userId", userId)
+	}
+	if len(exceptSid) > 0 {
+		query.Neq("sid", exceptSid)
+	}
+	return query.DeleteQuickly()
+}
+
+// RevokeSessionsAfterPasswordChanged 修改密码后退出所有登录
+func (this *LoginSessionDAO) RevokeSessionsAfterPasswordChanged(tx *dbs.Tx, adminId int64, userId int64) error {
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return err
+	}
+	if !config.RevokeOnPasswordChange {
+		return nil
+	}
+	return this.DeleteAllSessions(tx, adminId, userId, "")
+}
+
+// CleanExpiredSessions 清理过期的SESSION
+func (this *LoginSessionDAO) CleanExpiredSessions(tx *dbs.Tx) error {
+	config, err := this.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	var now = time.Now().Unix()
+	err = this.Query(tx).
+		Gt("expiresAt", 0).
+		Lte("expiresAt", now).
+		DeleteQuickly()
+	if err != nil {
+		return err
+	}
+
+	if config.AbsoluteTimeoutSeconds > 0 {
+		err = this.Query(tx).
+			Lte("createdAt", now-config.AbsoluteTimeoutSeconds).
+			DeleteQuickly()
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.IdleTimeoutSeconds > 0 {
+		err = this.Query(tx).
+			Where("GREATEST(createdAt, lastSeenAt)<=:maxLastSeenAt").
+			Param("maxLastSeenAt", now-config.IdleTimeoutSeconds).
+			DeleteQuickly()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadLoginSessionConfig 读取登录会话设置
+func (this *LoginSessionDAO) ReadLoginSessionConfig(tx *dbs.Tx) (*sessionutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeLoginSessionConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = sessionutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateLoginSessionConfig 修改登录会话设置
+func (this *LoginSessionDAO) UpdateLoginSessionConfig(tx *dbs.Tx, config *sessionutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeLoginSessionConfig, configJSON)
+}
+
+// ClearOldSessions 清理当前用户的其他SESSION
 func (this *LoginSessionDAO) ClearOldSessions(tx *dbs.Tx, adminId int64, userId int64, sid string, ip string) error {
 	// 删除此用户之前创建的SESSION
 	err := this.Query(tx).
@@ -20,6 +20,8 @@ func TestLoginSessionDAO_CreateSession(t *testing.T) {
 }
 
 func TestLoginSessionDAO_WriteSessionValue_Admin(t *testing.T) {
+	dbs.NotifyReady()
+
 	var dao = models.NewLoginSessionDAO()
 	var tx *dbs.Tx
 	err := dao.WriteSessionValue(tx, "123456", "adminId", 123)
@@ -29,6 +31,8 @@ func TestLoginSessionDAO_WriteSessionValue_Admin(t *testing.T) {
 }
 
 func TestLoginSessionDAO_WriteSessionValue_User(t *testing.T) {
+	dbs.NotifyReady()
+
 	var dao = models.NewLoginSessionDAO()
 	var tx *dbs.Tx
 	err := dao.WriteSessionValue(tx, "123456", "userId", 123)
@@ -38,6 +42,8 @@ func TestLoginSessionDAO_WriteSessionValue_User(t *testing.T) {
 }
 
 func TestLoginSessionDAO_WriteSessionValue(t *testing.T) {
+	dbs.NotifyReady()
+
 	var dao = models.NewLoginSessionDAO()
 	var tx *dbs.Tx
 	err := dao.WriteSessionValue(tx, "123456", "key1", "value1")
@@ -45,3 +51,34 @@ func TestLoginSessionDAO_WriteSessionValue(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLoginSessionDAO_FindAllActiveSessions(t *testing.T) {
+	dbs.NotifyReady()
+
+	var dao = models.NewLoginSessionDAO()
+	var tx *dbs.Tx
+	err := dao.WriteSessionValue(tx, "123456", "adminId", 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := dao.FindAllActiveSessions(tx, 123, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range sessions {
+		t.Log(session.Id, session.Ip, session.UserAgent, session.CreatedAt, session.LastSeenAt)
+	}
+
+	err = dao.DeleteAllSessions(tx, 123, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := dao.FindSession(tx, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session != nil {
+		t.Fatal("session should be revoked")
+	}
+}
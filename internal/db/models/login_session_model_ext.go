@@ -1,7 +1,24 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/sessionutils"
+)
 
 func (this *LoginSession) IsAvailable() bool {
 	return this.ExpiresAt == 0 || int64(this.ExpiresAt) > time.Now().Unix()
 }
+
+// IsAvailableWithConfig 检查是否过期，同时检查空闲超时和最长有效期
+func (this *LoginSession) IsAvailableWithConfig(config *sessionutils.Config) bool {
+	if !this.IsAvailable() {
+		return false
+	}
+
+	// 未登录的SESSION不受限制
+	if config == nil || (this.AdminId == 0 && this.UserId == 0) {
+		return true
+	}
+	return !config.IsExpired(int64(this.CreatedAt), int64(this.LastSeenAt), time.Now().Unix())
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	_ "github.com/go-sql-driver/mysql"
@@ -58,6 +59,11 @@ const (
 	MessageTypeConnectivity       MessageType = "Connectivity"       // 连通性
 	MessageTypeNodeSchedule       MessageType = "NodeSchedule"       // 节点调度信息
 	MessageTypeNodeOfflineDay     MessageType = "NodeOfflineDay"     // 节点到下线日期
+	MessageTypeLoginLocked        MessageType = "LoginLocked"        // 登录失败次数过多被锁定
+
+	MessageTypeUserIdentitySubmitted MessageType = "UserIdentitySubmitted" // 用户提交实名认证（管理员）
+	MessageTypeUserIdentityVerified  MessageType = "UserIdentityVerified"  // 实名认证审核通过（用户）
+	MessageTypeUserIdentityRejected  MessageType = "UserIdentityRejected"  // 实名认证审核未通过（用户）
 )
 
 type MessageDAO dbs.DAO
@@ -186,6 +192,14 @@ func (this *MessageDAO) CreateMessage(tx *dbs.Tx, adminId int64, userId int64, m
 		return err
 	}
 
+	// 发送到用户邮箱，发送失败不影响消息本身
+	if userId > 0 && adminId == 0 {
+		err = SharedUserEmailNotificationDAO.NotifyUserMessage(tx, userId, subject, body)
+		if err != nil {
+			remotelogs.Error("MessageDAO", "notify user '"+types.String(userId)+"' by email failed: "+err.Error())
+		}
+	}
+
 	return nil
 }
 
@@ -1,6 +1,11 @@
 package nameservers
 
 import (
+	"encoding/json"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -31,3 +36,141 @@ func init() {
 		SharedNSDomainDAO = NewNSDomainDAO()
 	})
 }
+
+// FindEnabledNSDomain 查找启用中的域名
+func (this *NSDomainDAO) FindEnabledNSDomain(tx *dbs.Tx, domainId int64) (*NSDomain, error) {
+	result, err := this.Query(tx).
+		Pk(domainId).
+		State(NSDomainStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NSDomain), err
+}
+
+// FindEnabledDomainWithName 根据名称查找启用中的域名
+// userId 为0表示不限用户
+func (this *NSDomainDAO) FindEnabledDomainWithName(tx *dbs.Tx, userId int64, name string) (*NSDomain, error) {
+	var query = this.Query(tx).
+		State(NSDomainStateEnabled).
+		Attr("name", strings.ToLower(name))
+	if userId > 0 {
+		query.Attr("userId", userId)
+	}
+	result, err := query.
+		DescPk().
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NSDomain), err
+}
+
+// FindAllEnabledDomainNames 查找所有启用中的域名名称
+// userId 为0表示不限用户
+func (this *NSDomainDAO) FindAllEnabledDomainNames(tx *dbs.Tx, userId int64) (result []string, err error) {
+	var query = this.Query(tx).
+		State(NSDomainStateEnabled).
+		Attr("isOn", true).
+		Result("name")
+	if userId > 0 {
+		query.Attr("userId", userId)
+	}
+	ones, err := query.
+		AscPk().
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		result = append(result, one.(*NSDomain).Name)
+	}
+	return
+}
+
+// FindDomainClusterId 查找域名所属集群ID
+func (this *NSDomainDAO) FindDomainClusterId(tx *dbs.Tx, domainId int64) (int64, error) {
+	return this.Query(tx).
+		Pk(domainId).
+		Result("clusterId").
+		FindInt64Col(0)
+}
+
+// NotifyUpdate 通知域名记录变更
+func (this *NSDomainDAO) NotifyUpdate(tx *dbs.Tx, domainId int64, taskType models.NodeTaskType) error {
+	clusterId, err := this.FindDomainClusterId(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if clusterId <= 0 {
+		return nil
+	}
+	return models.SharedNodeTaskDAO.CreateClusterTask(tx, nodeconfigs.NodeRoleDNS, clusterId, 0, 0, taskType)
+}
+
+// UpdateDomainDNSSEC 修改域名DNSSEC设置
+// 同时增加域名版本，以便DNS节点更新域名信息
+func (this *NSDomainDAO) UpdateDomainDNSSEC(tx *dbs.Tx, domainId int64, config *NSDomainDNSSECConfig) error {
+	if config == nil {
+		return nil
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+	return this.Query(tx).
+		Pk(domainId).
+		Set("dnssec", configJSON).
+		Set("version", version).
+		UpdateQuickly()
+}
+
+// IncreaseVersion 增加版本
+func (this *NSDomainDAO) IncreaseVersion(tx *dbs.Tx) (int64, error) {
+	return models.SharedSysLockerDAO.Increase(tx, "NS_DOMAIN_VERSION", 1)
+}
+
+// FindAllDomainIdsWithDNSSECActionDue 查找需要执行DNSSEC轮换操作的域名ID
+func (this *NSDomainDAO) FindAllDomainIdsWithDNSSECActionDue(tx *dbs.Tx, timestamp int64, size int64) (domainIds []int64, err error) {
+	ones, err := this.Query(tx).
+		State(NSDomainStateEnabled).
+		Attr("isOn", true).
+		Where("JSON_EXTRACT(dnssec, '$.isOn')=true").
+		Where("JSON_EXTRACT(dnssec, '$.nextActionAt')<=:timestamp").
+		Param("timestamp", timestamp).
+		ResultPk().
+		AscPk().
+		Limit(size).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		domainIds = append(domainIds, int64(one.(*NSDomain).Id))
+	}
+	return
+}
+
+// CheckUserDomain 检查用户是否拥有某个域名
+func (this *NSDomainDAO) CheckUserDomain(tx *dbs.Tx, userId int64, domainId int64) error {
+	if userId <= 0 || domainId <= 0 {
+		return models.ErrNotFound
+	}
+	b, err := this.Query(tx).
+		Pk(domainId).
+		Attr("userId", userId).
+		State(NSDomainStateEnabled).
+		Exist()
+	if err != nil {
+		return err
+	}
+	if !b {
+		return models.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package nameservers
+
+import "github.com/TeaOSLab/EdgeAPI/internal/utils/dnssecutils"
+
+type DNSSECRolloverState = string
+
+const (
+	DNSSECRolloverStateNone       DNSSECRolloverState = ""           // 没有在轮换
+	DNSSECRolloverStatePrepublish DNSSECRolloverState = "prepublish" // 新的ZSK已发布，等待传播
+	DNSSECRolloverStateRetiring   DNSSECRolloverState = "retiring"   // 新的ZSK已启用签名，旧的ZSK等待移除
+)
+
+const (
+	DefaultDNSSECZSKLifetimeDays     = 90            // 默认ZSK有效期
+	DefaultDNSSECPropagationSeconds  = 2 * 86400     // 默认传播等待时间，应该大于DNSKEY和签名记录的最大TTL
+	MinDNSSECZSKLifetimeDays         = 7             // 最小ZSK有效期
+	MaxDNSSECPropagationSeconds      = 30 * 86400    // 最大传播等待时间
+	dnssecRolloverMinIntervalSeconds = 3600          // 两次轮换操作最小间隔
+	dnssecKeySecretType              = "bindPrivate" // 私钥格式
+)
+
+// NSDomainDNSSECConfig 域名DNSSEC设置
+type NSDomainDNSSECConfig struct {
+	IsOn               bool                `json:"isOn"`               // 是否启用
+	Algorithm          string              `json:"algorithm"`          // 算法
+	ZSKLifetimeDays    int                 `json:"zskLifetimeDays"`    // ZSK有效期（天）
+	PropagationSeconds int64               `json:"propagationSeconds"` // 轮换时每一步的传播等待时间（秒）
+	RolloverState      DNSSECRolloverState `json:"rolloverState"`      // 轮换状态
+	NextActionAt       int64               `json:"nextActionAt"`       // 下一次执行轮换操作的时间
+	LastActionAt       int64               `json:"lastActionAt"`       // 上一次执行轮换操作的时间
+}
+
+// NewNSDomainDNSSECConfig 获取新的DNSSEC设置
+func NewNSDomainDNSSECConfig() *NSDomainDNSSECConfig {
+	return &NSDomainDNSSECConfig{
+		Algorithm:          dnssecutils.AlgorithmED25519,
+		ZSKLifetimeDays:    DefaultDNSSECZSKLifetimeDays,
+		PropagationSeconds: DefaultDNSSECPropagationSeconds,
+	}
+}
+
+// Init 初始化
+func (this *NSDomainDNSSECConfig) Init() {
+	if len(this.Algorithm) == 0 {
+		this.Algorithm = dnssecutils.AlgorithmED25519
+	}
+	if this.ZSKLifetimeDays <= 0 {
+		this.ZSKLifetimeDays = DefaultDNSSECZSKLifetimeDays
+	} else if this.ZSKLifetimeDays < MinDNSSECZSKLifetimeDays {
+		this.ZSKLifetimeDays = MinDNSSECZSKLifetimeDays
+	}
+	if this.PropagationSeconds <= 0 {
+		this.PropagationSeconds = DefaultDNSSECPropagationSeconds
+	} else if this.PropagationSeconds < dnssecRolloverMinIntervalSeconds {
+		this.PropagationSeconds = dnssecRolloverMinIntervalSeconds
+	} else if this.PropagationSeconds > MaxDNSSECPropagationSeconds {
+		this.PropagationSeconds = MaxDNSSECPropagationSeconds
+	}
+}
+
+// NextAction 下一步轮换操作的描述代号
+func (this *NSDomainDNSSECConfig) NextAction() string {
+	if !this.IsOn {
+		return ""
+	}
+	switch this.RolloverState {
+	case DNSSECRolloverStatePrepublish:
+		return "activateZSK"
+	case DNSSECRolloverStateRetiring:
+		return "removeZSK"
+	}
+	return "prepublishZSK"
+}
@@ -14,6 +14,7 @@ type NSDomain struct {
 	VerifyTXT          string   `field:"verifyTXT"`          // 验证用的TXT
 	VerifyExpiresAt    uint64   `field:"verifyExpiresAt"`    // 验证TXT过期时间
 	RecordsHealthCheck dbs.JSON `field:"recordsHealthCheck"` // 记录健康检查设置
+	Dnssec             dbs.JSON `field:"dnssec"`             // DNSSEC设置
 	CreatedAt          uint64   `field:"createdAt"`          // 创建时间
 	Version            uint64   `field:"version"`            // 版本号
 	Status             string   `field:"status"`             // 状态：none|verified
@@ -31,6 +32,7 @@ type NSDomainOperator struct {
 	VerifyTXT          any // 验证用的TXT
 	VerifyExpiresAt    any // 验证TXT过期时间
 	RecordsHealthCheck any // 记录健康检查设置
+	Dnssec             any // DNSSEC设置
 	CreatedAt          any // 创建时间
 	Version            any // 版本号
 	Status             any // 状态：none|verified
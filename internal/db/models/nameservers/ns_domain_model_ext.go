@@ -19,3 +19,18 @@ func (this *NSDomain) DecodeGroupIds() []int64 {
 	}
 	return result
 }
+
+// DecodeDNSSEC 解析DNSSEC设置
+func (this *NSDomain) DecodeDNSSEC() *NSDomainDNSSECConfig {
+	var config = NewNSDomainDNSSECConfig()
+	if models.IsNull(this.Dnssec) {
+		return config
+	}
+
+	err := json.Unmarshal(this.Dnssec, config)
+	if err != nil {
+		remotelogs.Error("NSDomain", "DecodeDNSSEC:"+err.Error())
+	}
+	config.Init()
+	return config
+}
@@ -0,0 +1,455 @@
+package nameservers
+
+import (
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/dnssecutils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
+)
+
+const (
+	NSKeyStateEnabled  = 1 // 已启用
+	NSKeyStateDisabled = 0 // 已禁用
+)
+
+type NSKeyKind = string
+
+const (
+	NSKeyKindTSIG NSKeyKind = "tsig"
+	NSKeyKindKSK  NSKeyKind = dnssecutils.KeyTypeKSK
+	NSKeyKindZSK  NSKeyKind = dnssecutils.KeyTypeZSK
+)
+
+type NSKeyStatus = string
+
+const (
+	NSKeyStatusPublished NSKeyStatus = "published" // 已发布，但不用于签名
+	NSKeyStatusActive    NSKeyStatus = "active"    // 已发布，并用于签名
+	NSKeyStatusRetired   NSKeyStatus = "retired"   // 已发布，但不再用于签名，等待移除
+)
+
+type NSKeyDAO dbs.DAO
+
+func NewNSKeyDAO() *NSKeyDAO {
+	return dbs.NewDAO(&NSKeyDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeNSKeys",
+			Model:  new(NSKey),
+			PkName: "id",
+		},
+	}).(*NSKeyDAO)
+}
+
+var SharedNSKeyDAO *NSKeyDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedNSKeyDAO = NewNSKeyDAO()
+	})
+}
+
+// EnableNSKey 启用条目
+func (this *NSKeyDAO) EnableNSKey(tx *dbs.Tx, id int64) error {
+	_, err := this.Query(tx).
+		Pk(id).
+		Set("state", NSKeyStateEnabled).
+		Update()
+	return err
+}
+
+// DisableNSKey 禁用条目
+func (this *NSKeyDAO) DisableNSKey(tx *dbs.Tx, id int64) error {
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+	_, err = this.Query(tx).
+		Pk(id).
+		Set("state", NSKeyStateDisabled).
+		Set("version", version).
+		Update()
+	return err
+}
+
+// FindEnabledNSKey 查找启用中的条目
+func (this *NSKeyDAO) FindEnabledNSKey(tx *dbs.Tx, id int64) (*NSKey, error) {
+	result, err := this.Query(tx).
+		Pk(id).
+		State(NSKeyStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NSKey), err
+}
+
+// FindAllEnabledDNSSECKeysWithDomainId 查找域名的所有DNSSEC密钥
+func (this *NSKeyDAO) FindAllEnabledDNSSECKeysWithDomainId(tx *dbs.Tx, domainId int64) (result []*NSKey, err error) {
+	_, err = this.Query(tx).
+		State(NSKeyStateEnabled).
+		Attr("domainId", domainId).
+		Attr("kind", []string{NSKeyKindKSK, NSKeyKindZSK}).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// ListDNSSECKeysAfterVersion 列出某个版本后的DNSSEC密钥，用于同步到DNS节点
+func (this *NSKeyDAO) ListDNSSECKeysAfterVersion(tx *dbs.Tx, version int64, size int64) (result []*NSKey, err error) {
+	if size <= 0 {
+		size = 10000
+	}
+
+	_, err = this.Query(tx).
+		// 这里不要设置状态参数，因为我们要知道哪些是删除的
+		Attr("kind", []string{NSKeyKindKSK, NSKeyKindZSK}).
+		Gt("version", version).
+		Asc("version").
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// EnableDomainDNSSEC 启用域名DNSSEC
+// 如果已经有相同算法的密钥则继续使用，否则重新生成KSK和ZSK
+// 使用相同算法重新启用时，会继续此前未完成的ZSK轮换
+func (this *NSKeyDAO) EnableDomainDNSSEC(tx *dbs.Tx, domainId int64, algorithm dnssecutils.Algorithm) error {
+	if !lists.ContainsString(dnssecutils.AllAlgorithms(), algorithm) {
+		return errors.New("unsupported algorithm '" + algorithm + "'")
+	}
+
+	domain, err := SharedNSDomainDAO.FindEnabledNSDomain(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		return models.ErrNotFound
+	}
+
+	keys, err := this.FindAllEnabledDNSSECKeysWithDomainId(tx, domainId)
+	if err != nil {
+		return err
+	}
+
+	var config = domain.DecodeDNSSEC()
+	var keepRollover = config.RolloverState != DNSSECRolloverStateNone && config.Algorithm == algorithm
+
+	var hasKSK, hasZSK bool
+	for _, key := range keys {
+		if key.Algo != algorithm {
+			// 算法不同的密钥不能混用
+			err = this.DisableNSKey(tx, int64(key.Id))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch key.Kind {
+		case NSKeyKindKSK:
+			hasKSK = true
+		case NSKeyKindZSK:
+			switch key.Status {
+			case NSKeyStatusActive:
+				hasZSK = true
+			case NSKeyStatusPublished, NSKeyStatusRetired:
+				// 没有进行中的轮换时，移除轮换遗留的密钥
+				if !keepRollover {
+					err = this.DisableNSKey(tx, int64(key.Id))
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// 重新启用停用DNSSEC时保留的密钥
+	err = this.updateDomainKeysIsOn(tx, domainId, true)
+	if err != nil {
+		return err
+	}
+
+	if !hasKSK {
+		_, err = this.createDNSSECKey(tx, domainId, domain.Name, NSKeyKindKSK, algorithm, NSKeyStatusActive)
+		if err != nil {
+			return err
+		}
+	}
+	if !hasZSK {
+		_, err = this.createDNSSECKey(tx, domainId, domain.Name, NSKeyKindZSK, algorithm, NSKeyStatusActive)
+		if err != nil {
+			return err
+		}
+	}
+
+	config.IsOn = true
+	config.Algorithm = algorithm
+	if keepRollover {
+		// 等待密钥重新传播后继续轮换
+		config.NextActionAt = time.Now().Unix() + config.PropagationSeconds
+	} else {
+		config.RolloverState = DNSSECRolloverStateNone
+		config.NextActionAt = time.Now().Unix() + int64(config.ZSKLifetimeDays)*86400
+	}
+	err = SharedNSDomainDAO.UpdateDomainDNSSEC(tx, domainId, config)
+	if err != nil {
+		return err
+	}
+
+	return SharedNSDomainDAO.NotifyUpdate(tx, domainId, models.NSNodeTaskTypeKeyChanged)
+}
+
+// DisableDomainDNSSEC 停用域名DNSSEC
+// 密钥会被保留但不再用于签名，以便在注册商删除DS记录之前重新启用
+func (this *NSKeyDAO) DisableDomainDNSSEC(tx *dbs.Tx, domainId int64) error {
+	domain, err := SharedNSDomainDAO.FindEnabledNSDomain(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		return models.ErrNotFound
+	}
+
+	err = this.updateDomainKeysIsOn(tx, domainId, false)
+	if err != nil {
+		return err
+	}
+
+	var config = domain.DecodeDNSSEC()
+	config.IsOn = false
+	config.NextActionAt = 0
+	err = SharedNSDomainDAO.UpdateDomainDNSSEC(tx, domainId, config)
+	if err != nil {
+		return err
+	}
+
+	return SharedNSDomainDAO.NotifyUpdate(tx, domainId, models.NSNodeTaskTypeKeyChanged)
+}
+
+// UpdateDomainDNSSECRollover 修改ZSK自动轮换设置
+func (this *NSKeyDAO) UpdateDomainDNSSECRollover(tx *dbs.Tx, domainId int64, zskLifetimeDays int, propagationSeconds int64) error {
+	domain, err := SharedNSDomainDAO.FindEnabledNSDomain(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		return models.ErrNotFound
+	}
+
+	var config = domain.DecodeDNSSEC()
+	config.ZSKLifetimeDays = zskLifetimeDays
+	config.PropagationSeconds = propagationSeconds
+	config.Init()
+
+	// 没有在轮换中时，根据新的有效期重新计算下次轮换时间
+	if config.IsOn && config.RolloverState == DNSSECRolloverStateNone {
+		var fromTime = config.LastActionAt
+		if fromTime <= 0 {
+			fromTime = time.Now().Unix()
+		}
+		config.NextActionAt = fromTime + int64(config.ZSKLifetimeDays)*86400
+	}
+
+	return SharedNSDomainDAO.UpdateDomainDNSSEC(tx, domainId, config)
+}
+
+// StartZSKRollover 立即开始ZSK轮换
+func (this *NSKeyDAO) StartZSKRollover(tx *dbs.Tx, domainId int64) error {
+	domain, err := SharedNSDomainDAO.FindEnabledNSDomain(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		return models.ErrNotFound
+	}
+
+	var config = domain.DecodeDNSSEC()
+	if !config.IsOn {
+		return errors.New("dnssec is not enabled")
+	}
+	if config.RolloverState != DNSSECRolloverStateNone {
+		return errors.New("zsk rollover is already in progress")
+	}
+
+	return this.AdvanceZSKRollover(tx, domainId)
+}
+
+// AdvanceZSKRollover 执行ZSK轮换的下一步操作（预发布方式）
+//  1. 发布新的ZSK，但不用于签名
+//  2. 等待传播后，新的ZSK开始签名，旧的ZSK停止签名
+//  3. 等待旧的签名过期后，移除旧的ZSK
+func (this *NSKeyDAO) AdvanceZSKRollover(tx *dbs.Tx, domainId int64) error {
+	domain, err := SharedNSDomainDAO.FindEnabledNSDomain(tx, domainId)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		return models.ErrNotFound
+	}
+
+	var config = domain.DecodeDNSSEC()
+	if !config.IsOn {
+		return nil
+	}
+
+	keys, err := this.FindAllEnabledDNSSECKeysWithDomainId(tx, domainId)
+	if err != nil {
+		return err
+	}
+
+	var now = time.Now().Unix()
+	switch config.RolloverState {
+	case DNSSECRolloverStateNone:
+		_, err = this.createDNSSECKey(tx, domainId, domain.Name, NSKeyKindZSK, config.Algorithm, NSKeyStatusPublished)
+		if err != nil {
+			return err
+		}
+		config.RolloverState = DNSSECRolloverStatePrepublish
+		config.NextActionAt = now + config.PropagationSeconds
+	case DNSSECRolloverStatePrepublish:
+		var hasPublished = false
+		for _, key := range keys {
+			if key.Kind == NSKeyKindZSK && key.Status == NSKeyStatusPublished {
+				hasPublished = true
+				break
+			}
+		}
+		if !hasPublished {
+			// 新的ZSK已丢失，重新开始
+			config.RolloverState = DNSSECRolloverStateNone
+			config.NextActionAt = now
+			break
+		}
+		for _, key := range keys {
+			if key.Kind != NSKeyKindZSK {
+				continue
+			}
+			switch key.Status {
+			case NSKeyStatusActive:
+				err = this.updateKeyStatus(tx, int64(key.Id), NSKeyStatusRetired)
+			case NSKeyStatusPublished:
+				err = this.updateKeyStatus(tx, int64(key.Id), NSKeyStatusActive)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		config.RolloverState = DNSSECRolloverStateRetiring
+		config.NextActionAt = now + config.PropagationSeconds
+	case DNSSECRolloverStateRetiring:
+		for _, key := range keys {
+			if key.Kind == NSKeyKindZSK && key.Status == NSKeyStatusRetired {
+				err = this.DisableNSKey(tx, int64(key.Id))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		config.RolloverState = DNSSECRolloverStateNone
+		config.NextActionAt = now + int64(config.ZSKLifetimeDays)*86400
+	default:
+		return errors.New("invalid rollover state '" + config.RolloverState + "'")
+	}
+	config.LastActionAt = now
+
+	err = SharedNSDomainDAO.UpdateDomainDNSSEC(tx, domainId, config)
+	if err != nil {
+		return err
+	}
+
+	return SharedNSDomainDAO.NotifyUpdate(tx, domainId, models.NSNodeTaskTypeKeyChanged)
+}
+
+// IncreaseVersion 增加版本
+func (this *NSKeyDAO) IncreaseVersion(tx *dbs.Tx) (int64, error) {
+	return models.SharedSysLockerDAO.Increase(tx, "NS_KEY_VERSION", 1)
+}
+
+// 生成并保存DNSSEC密钥
+func (this *NSKeyDAO) createDNSSECKey(tx *dbs.Tx, domainId int64, zone string, kind NSKeyKind, algorithm dnssecutils.Algorithm, status NSKeyStatus) (int64, error) {
+	key, err := dnssecutils.GenerateKey(zone, kind, algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var now = time.Now().Unix()
+	var op = NewNSKeyOperator()
+	op.DomainId = domainId
+	op.Name = "DNSSEC " + types.String(key.KeyTag)
+	op.Kind = kind
+	op.Algo = algorithm
+	op.Secret = key.PrivateKey
+	op.SecretType = dnssecKeySecretType
+	op.Flags = key.Flags
+	op.KeyTag = key.KeyTag
+	op.PublicKey = key.PublicKey
+	op.Status = status
+	op.CreatedAt = now
+	if status == NSKeyStatusActive {
+		op.ActivatedAt = now
+	}
+	op.IsOn = true
+	op.Version = version
+	op.State = NSKeyStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// 启用或停用域名的所有DNSSEC密钥，并增加版本以便同步到DNS节点
+func (this *NSKeyDAO) updateDomainKeysIsOn(tx *dbs.Tx, domainId int64, isOn bool) error {
+	keys, err := this.FindAllEnabledDNSSECKeysWithDomainId(tx, domainId)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.IsOn == isOn {
+			continue
+		}
+		version, err := this.IncreaseVersion(tx)
+		if err != nil {
+			return err
+		}
+		err = this.Query(tx).
+			Pk(key.Id).
+			Set("isOn", isOn).
+			Set("version", version).
+			UpdateQuickly()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 修改密钥状态
+func (this *NSKeyDAO) updateKeyStatus(tx *dbs.Tx, keyId int64, status NSKeyStatus) error {
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	var op = NewNSKeyOperator()
+	op.Id = keyId
+	op.Status = status
+	switch status {
+	case NSKeyStatusActive:
+		op.ActivatedAt = time.Now().Unix()
+	case NSKeyStatusRetired:
+		op.RetiredAt = time.Now().Unix()
+	}
+	op.Version = version
+	return this.Save(tx, op)
+}
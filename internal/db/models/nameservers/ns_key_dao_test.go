@@ -0,0 +1,42 @@
+package nameservers_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/nameservers"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/dnssecutils"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestNSKeyDAO_EnableDomainDNSSEC(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = nameservers.NewNSKeyDAO()
+	err := dao.EnableDomainDNSSEC(tx, 1, dnssecutils.AlgorithmED25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := dao.FindAllEnabledDNSSECKeysWithDomainId(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		t.Log(key.Kind, key.Status, key.KeyTag, key.Algo)
+	}
+}
+
+func TestNSKeyDAO_AdvanceZSKRollover(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = nameservers.NewNSKeyDAO()
+	err := dao.AdvanceZSKRollover(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
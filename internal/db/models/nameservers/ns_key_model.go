@@ -2,29 +2,45 @@ package nameservers
 
 // NSKey 密钥管理
 type NSKey struct {
-	Id         uint64 `field:"id"`         // ID
-	IsOn       bool   `field:"isOn"`       // 状态
-	Name       string `field:"name"`       // 名称
-	DomainId   uint64 `field:"domainId"`   // 域名ID
-	ZoneId     uint64 `field:"zoneId"`     // 子域ID
-	Algo       string `field:"algo"`       // 算法
-	Secret     string `field:"secret"`     // 密码
-	SecretType string `field:"secretType"` // 密码类型
-	Version    uint64 `field:"version"`    // 版本号
-	State      uint8  `field:"state"`      // 状态
+	Id          uint64 `field:"id"`          // ID
+	IsOn        bool   `field:"isOn"`        // 状态
+	Name        string `field:"name"`        // 名称
+	DomainId    uint64 `field:"domainId"`    // 域名ID
+	ZoneId      uint64 `field:"zoneId"`      // 子域ID
+	Kind        string `field:"kind"`        // 种类：tsig|ksk|zsk
+	Algo        string `field:"algo"`        // 算法
+	Secret      string `field:"secret"`      // 密码
+	SecretType  string `field:"secretType"`  // 密码类型
+	Flags       uint32 `field:"flags"`       // DNSKEY Flags
+	KeyTag      uint32 `field:"keyTag"`      // DNSKEY KeyTag
+	PublicKey   string `field:"publicKey"`   // DNSKEY公钥
+	Status      string `field:"status"`      // DNSSEC密钥状态：published|active|retired
+	CreatedAt   uint64 `field:"createdAt"`   // 创建时间
+	ActivatedAt uint64 `field:"activatedAt"` // 启用签名时间
+	RetiredAt   uint64 `field:"retiredAt"`   // 停止签名时间
+	Version     uint64 `field:"version"`     // 版本号
+	State       uint8  `field:"state"`       // 状态
 }
 
 type NSKeyOperator struct {
-	Id         interface{} // ID
-	IsOn       interface{} // 状态
-	Name       interface{} // 名称
-	DomainId   interface{} // 域名ID
-	ZoneId     interface{} // 子域ID
-	Algo       interface{} // 算法
-	Secret     interface{} // 密码
-	SecretType interface{} // 密码类型
-	Version    interface{} // 版本号
-	State      interface{} // 状态
+	Id          interface{} // ID
+	IsOn        interface{} // 状态
+	Name        interface{} // 名称
+	DomainId    interface{} // 域名ID
+	ZoneId      interface{} // 子域ID
+	Kind        interface{} // 种类：tsig|ksk|zsk
+	Algo        interface{} // 算法
+	Secret      interface{} // 密码
+	SecretType  interface{} // 密码类型
+	Flags       interface{} // DNSKEY Flags
+	KeyTag      interface{} // DNSKEY KeyTag
+	PublicKey   interface{} // DNSKEY公钥
+	Status      interface{} // DNSSEC密钥状态：published|active|retired
+	CreatedAt   interface{} // 创建时间
+	ActivatedAt interface{} // 启用签名时间
+	RetiredAt   interface{} // 停止签名时间
+	Version     interface{} // 版本号
+	State       interface{} // 状态
 }
 
 func NewNSKeyOperator() *NSKeyOperator {
@@ -1 +1,16 @@
 package nameservers
+
+import "github.com/TeaOSLab/EdgeAPI/internal/utils/dnssecutils"
+
+// IsDNSSEC 检查是否为DNSSEC密钥
+func (this *NSKey) IsDNSSEC() bool {
+	return this.Kind == NSKeyKindKSK || this.Kind == NSKeyKindZSK
+}
+
+// ComputeDS 计算KSK对应的DS记录
+func (this *NSKey) ComputeDS(zone string) ([]*dnssecutils.DS, error) {
+	if this.Kind != NSKeyKindKSK {
+		return nil, nil
+	}
+	return dnssecutils.ComputeDS(zone, this.Algo, uint16(this.Flags), this.PublicKey)
+}
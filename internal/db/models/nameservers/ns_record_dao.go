@@ -3,6 +3,11 @@
 package nameservers
 
 import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -45,11 +50,21 @@ func (this *NSRecordDAO) EnableNSRecord(tx *dbs.Tx, id uint64) error {
 
 // DisableNSRecord 禁用条目
 func (this *NSRecordDAO) DisableNSRecord(tx *dbs.Tx, id uint64) error {
-	_, err := this.Query(tx).
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = this.Query(tx).
 		Pk(id).
 		Set("state", NSRecordStateDisabled).
+		Set("version", version).
 		Update()
-	return err
+	if err != nil {
+		return err
+	}
+
+	return this.NotifyUpdate(tx, int64(id))
 }
 
 // FindEnabledNSRecord 查找启用中的条目
@@ -71,3 +86,134 @@ func (this *NSRecordDAO) FindNSRecordName(tx *dbs.Tx, id uint64) (string, error)
 		Result("name").
 		FindStringCol("")
 }
+
+// CreateRecord 创建记录
+func (this *NSRecordDAO) CreateRecord(tx *dbs.Tx, domainId int64, description string, name string, dnsType string, value string, ttl int32, routeIds []string) (int64, error) {
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var op = NewNSRecordOperator()
+	op.DomainId = domainId
+	op.Description = description
+	op.Name = strings.ToLower(name)
+	op.Type = strings.ToUpper(dnsType)
+	op.Value = value
+	op.Ttl = ttl
+
+	if len(routeIds) == 0 {
+		op.RouteIds = "[]"
+	} else {
+		routeIdsJSON, err := json.Marshal(routeIds)
+		if err != nil {
+			return 0, err
+		}
+		op.RouteIds = routeIdsJSON
+	}
+
+	op.IsOn = true
+	op.IsUp = true
+	op.CreatedAt = time.Now().Unix()
+	op.Version = version
+	op.State = NSRecordStateEnabled
+	recordId, err := this.SaveInt64(tx, op)
+	if err != nil {
+		return 0, err
+	}
+
+	err = SharedNSDomainDAO.NotifyUpdate(tx, domainId, models.NSNodeTaskTypeRecordChanged)
+	if err != nil {
+		return 0, err
+	}
+
+	return recordId, nil
+}
+
+// UpdateRecord 修改记录
+func (this *NSRecordDAO) UpdateRecord(tx *dbs.Tx, recordId int64, description string, name string, dnsType string, value string, ttl int32, routeIds []string, isOn bool) error {
+	if recordId <= 0 {
+		return models.ErrNotFound
+	}
+
+	version, err := this.IncreaseVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	var op = NewNSRecordOperator()
+	op.Id = recordId
+	op.Description = description
+	op.Name = strings.ToLower(name)
+	op.Type = strings.ToUpper(dnsType)
+	op.Value = value
+	op.Ttl = ttl
+	op.IsOn = isOn
+
+	if len(routeIds) == 0 {
+		op.RouteIds = "[]"
+	} else {
+		routeIdsJSON, err := json.Marshal(routeIds)
+		if err != nil {
+			return err
+		}
+		op.RouteIds = routeIdsJSON
+	}
+
+	op.Version = version
+	err = this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	return this.NotifyUpdate(tx, recordId)
+}
+
+// FindAllEnabledRecordsWithDomain 查找域名下的所有记录
+func (this *NSRecordDAO) FindAllEnabledRecordsWithDomain(tx *dbs.Tx, domainId int64) (result []*NSRecord, err error) {
+	_, err = this.Query(tx).
+		State(NSRecordStateEnabled).
+		Attr("domainId", domainId).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindAllEnabledRecordsWithName 根据名称和类型查找记录
+func (this *NSRecordDAO) FindAllEnabledRecordsWithName(tx *dbs.Tx, domainId int64, name string, dnsType string) (result []*NSRecord, err error) {
+	_, err = this.Query(tx).
+		State(NSRecordStateEnabled).
+		Attr("domainId", domainId).
+		Attr("name", strings.ToLower(name)).
+		Attr("type", strings.ToUpper(dnsType)).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindRecordDomainId 查找记录所属域名ID
+func (this *NSRecordDAO) FindRecordDomainId(tx *dbs.Tx, recordId int64) (int64, error) {
+	return this.Query(tx).
+		Pk(recordId).
+		Result("domainId").
+		FindInt64Col(0)
+}
+
+// IncreaseVersion 增加版本
+func (this *NSRecordDAO) IncreaseVersion(tx *dbs.Tx) (int64, error) {
+	return models.SharedSysLockerDAO.Increase(tx, "NS_RECORD_VERSION", 1)
+}
+
+// NotifyUpdate 通知记录更新
+func (this *NSRecordDAO) NotifyUpdate(tx *dbs.Tx, recordId int64) error {
+	domainId, err := this.FindRecordDomainId(tx, recordId)
+	if err != nil {
+		return err
+	}
+	if domainId <= 0 {
+		return nil
+	}
+	return SharedNSDomainDAO.NotifyUpdate(tx, domainId, models.NSNodeTaskTypeRecordChanged)
+}
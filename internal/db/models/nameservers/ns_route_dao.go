@@ -71,3 +71,16 @@ func (this *NSRouteDAO) FindNSRouteName(tx *dbs.Tx, id uint32) (string, error) {
 		Result("name").
 		FindStringCol("")
 }
+
+// FindAllEnabledPublicRoutes 查找所有公用的线路
+func (this *NSRouteDAO) FindAllEnabledPublicRoutes(tx *dbs.Tx) (result []*NSRoute, err error) {
+	_, err = this.Query(tx).
+		State(NSRouteStateEnabled).
+		Attr("isOn", true).
+		Where("(isPublic=1 OR (userId=0 AND domainId=0))").
+		Desc("order").
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
@@ -1 +1,12 @@
 package nameservers
+
+import "github.com/iwind/TeaGo/types"
+
+// RouteCode 获取线路代号
+// 没有设置代号的线路使用 id:ROUTE_ID 作为代号，和记录中的线路ID格式保持一致
+func (this *NSRoute) RouteCode() string {
+	if len(this.Code) > 0 {
+		return this.Code
+	}
+	return "id:" + types.String(this.Id)
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/oidcutils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// SettingCodeOIDCConfig OIDC登录设置代号
+const SettingCodeOIDCConfig = "oidcConfig"
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedOIDCLoginStateDAO.CleanExpiredStates(nil)
+				if err != nil {
+					remotelogs.Error("OIDCLoginStateDAO", "clean expired states failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+type OIDCLoginStateDAO dbs.DAO
+
+func NewOIDCLoginStateDAO() *OIDCLoginStateDAO {
+	return dbs.NewDAO(&OIDCLoginStateDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeOIDCLoginStates",
+			Model:  new(OIDCLoginState),
+			PkName: "id",
+		},
+	}).(*OIDCLoginStateDAO)
+}
+
+var SharedOIDCLoginStateDAO *OIDCLoginStateDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedOIDCLoginStateDAO = NewOIDCLoginStateDAO()
+	})
+}
+
+// CreateLoginState 开始登录流程，生成并保存state、nonce和PKCE校验值
+func (this *OIDCLoginStateDAO) CreateLoginState(tx *dbs.Tx, role oidcutils.Role, redirectURL string) (*OIDCLoginState, error) {
+	state, err := oidcutils.GenerateRandomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidcutils.GenerateRandomString()
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := oidcutils.GenerateRandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	var now = time.Now().Unix()
+	var op = NewOIDCLoginStateOperator()
+	op.Role = role
+	op.State = state
+	op.Nonce = nonce
+	op.CodeVerifier = codeVerifier
+	op.RedirectURL = redirectURL
+	op.CreatedAt = now
+	op.ExpiresAt = now + oidcutils.StateLifeSeconds
+	err = this.Save(tx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLoginState{
+		Role:         role,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RedirectURL:  redirectURL,
+		CreatedAt:    uint64(now),
+		ExpiresAt:    uint64(now + oidcutils.StateLifeSeconds),
+	}, nil
+}
+
+// ConsumeLoginState 查找并删除登录流程状态，每个state只能使用一次
+func (this *OIDCLoginStateDAO) ConsumeLoginState(tx *dbs.Tx, role oidcutils.Role, state string) (*OIDCLoginState, error) {
+	if len(state) == 0 {
+		return nil, nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("state", state).
+		Attr("role", role).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	var loginState = one.(*OIDCLoginState)
+
+	err = this.Query(tx).
+		Pk(loginState.Id).
+		DeleteQuickly()
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(loginState.ExpiresAt) < time.Now().Unix() {
+		return nil, nil
+	}
+	return loginState, nil
+}
+
+// CleanExpiredStates 清理过期的登录流程状态
+func (this *OIDCLoginStateDAO) CleanExpiredStates(tx *dbs.Tx) error {
+	return this.Query(tx).
+		Lt("expiresAt", time.Now().Unix()).
+		DeleteQuickly()
+}
+
+// ReadOIDCConfig 读取OIDC登录设置
+func (this *OIDCLoginStateDAO) ReadOIDCConfig(tx *dbs.Tx) (*oidcutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeOIDCConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = oidcutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateOIDCConfig 修改OIDC登录设置
+func (this *OIDCLoginStateDAO) UpdateOIDCConfig(tx *dbs.Tx, config *oidcutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeOIDCConfig, configJSON)
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/oidcutils"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestOIDCLoginStateDAO_ConsumeLoginState(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewOIDCLoginStateDAO()
+	loginState, err := dao.CreateLoginState(tx, oidcutils.RoleUser, "http://127.0.0.1:7788/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 角色不匹配
+	consumed, err := dao.ConsumeLoginState(tx, oidcutils.RoleAdmin, loginState.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed != nil {
+		t.Fatal("state should not be consumed by another role")
+	}
+
+	consumed, err = dao.ConsumeLoginState(tx, oidcutils.RoleUser, loginState.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed == nil || consumed.Nonce != loginState.Nonce {
+		t.Fatal("state should be consumed")
+	}
+
+	// 只能使用一次
+	consumed, err = dao.ConsumeLoginState(tx, oidcutils.RoleUser, loginState.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed != nil {
+		t.Fatal("state should be consumed only once")
+	}
+}
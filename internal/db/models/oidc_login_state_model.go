@@ -0,0 +1,28 @@
+package models
+
+// OIDCLoginState OIDC登录流程状态
+type OIDCLoginState struct {
+	Id           uint64 `field:"id"`           // ID
+	Role         string `field:"role"`         // 角色：admin|user
+	State        string `field:"state"`        // 状态值
+	Nonce        string `field:"nonce"`        // 随机值
+	CodeVerifier string `field:"codeVerifier"` // PKCE校验值
+	RedirectURL  string `field:"redirectURL"`  // 回调地址
+	CreatedAt    uint64 `field:"createdAt"`    // 创建时间
+	ExpiresAt    uint64 `field:"expiresAt"`    // 过期时间
+}
+
+type OIDCLoginStateOperator struct {
+	Id           interface{} // ID
+	Role         interface{} // 角色：admin|user
+	State        interface{} // 状态值
+	Nonce        interface{} // 随机值
+	CodeVerifier interface{} // PKCE校验值
+	RedirectURL  interface{} // 回调地址
+	CreatedAt    interface{} // 创建时间
+	ExpiresAt    interface{} // 过期时间
+}
+
+func NewOIDCLoginStateOperator() *OIDCLoginStateOperator {
+	return &OIDCLoginStateOperator{}
+}
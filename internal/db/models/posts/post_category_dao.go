@@ -1,6 +1,7 @@
 package posts
 
 import (
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -69,3 +70,77 @@ func (this *PostCategoryDAO) FindPostCategoryName(tx *dbs.Tx, categoryId int64)
 		Result("name").
 		FindStringCol("")
 }
+
+// CreateCategory 创建分类
+func (this *PostCategoryDAO) CreateCategory(tx *dbs.Tx, name string, code string) (int64, error) {
+	var op = NewPostCategoryOperator()
+	op.Name = name
+	op.Code = code
+	op.IsOn = true
+	op.State = PostCategoryStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// UpdateCategory 修改分类
+func (this *PostCategoryDAO) UpdateCategory(tx *dbs.Tx, categoryId int64, name string, code string, isOn bool) error {
+	if categoryId <= 0 {
+		return errors.New("invalid 'categoryId'")
+	}
+	var op = NewPostCategoryOperator()
+	op.Id = categoryId
+	op.Name = name
+	op.Code = code
+	op.IsOn = isOn
+	return this.Save(tx, op)
+}
+
+// FindAllPostCategories 列出所有分类
+func (this *PostCategoryDAO) FindAllPostCategories(tx *dbs.Tx) (result []*PostCategory, err error) {
+	_, err = this.Query(tx).
+		State(PostCategoryStateEnabled).
+		Desc("order").
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindAllAvailablePostCategories 列出所有启用的分类
+func (this *PostCategoryDAO) FindAllAvailablePostCategories(tx *dbs.Tx) (result []*PostCategory, err error) {
+	_, err = this.Query(tx).
+		State(PostCategoryStateEnabled).
+		Attr("isOn", true).
+		Desc("order").
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// ExistCategoryCode 检查代号是否已被其他分类使用
+func (this *PostCategoryDAO) ExistCategoryCode(tx *dbs.Tx, code string, excludeCategoryId int64) (bool, error) {
+	if len(code) == 0 {
+		return false, nil
+	}
+	var query = this.Query(tx).
+		State(PostCategoryStateEnabled).
+		Attr("code", code)
+	if excludeCategoryId > 0 {
+		query.Neq("id", excludeCategoryId)
+	}
+	return query.Exist()
+}
+
+// UpdateCategoryOrders 保存排序
+func (this *PostCategoryDAO) UpdateCategoryOrders(tx *dbs.Tx, categoryIds []int64) error {
+	for index, categoryId := range categoryIds {
+		_, err := this.Query(tx).
+			Pk(categoryId).
+			Set("order", len(categoryIds)-index).
+			Update()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
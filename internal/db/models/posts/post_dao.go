@@ -1,9 +1,18 @@
 package posts
 
 import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
 )
 
 const (
@@ -61,3 +70,290 @@ func (this *PostDAO) FindEnabledPost(tx *dbs.Tx, postId int64) (*Post, error) {
 	}
 	return result.(*Post), err
 }
+
+// CreatePost 创建文章，创建后为草稿状态
+func (this *PostDAO) CreatePost(tx *dbs.Tx, adminId int64, categoryId int64, productCode string, postType PostType, url string, subject string, body string, isPinned bool, audience *PostAudience) (int64, error) {
+	var op = NewPostOperator()
+	op.AdminId = adminId
+	op.CategoryId = categoryId
+	op.ProductCode = productCode
+	op.Type = postType
+	op.Url = url
+	op.Subject = subject
+	op.Body = body
+	op.IsPinned = isPinned
+	err := this.applyAudience(op, audience)
+	if err != nil {
+		return 0, err
+	}
+	op.IsPublished = false
+	op.CreatedAt = time.Now().Unix()
+	op.UpdatedAt = time.Now().Unix()
+	op.State = PostStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// UpdatePost 修改文章
+func (this *PostDAO) UpdatePost(tx *dbs.Tx, postId int64, categoryId int64, productCode string, postType PostType, url string, subject string, body string, isPinned bool, audience *PostAudience) error {
+	if postId <= 0 {
+		return errors.New("invalid 'postId'")
+	}
+	var op = NewPostOperator()
+	op.Id = postId
+	op.CategoryId = categoryId
+	op.ProductCode = productCode
+	op.Type = postType
+	op.Url = url
+	op.Subject = subject
+	op.Body = body
+	op.IsPinned = isPinned
+	err := this.applyAudience(op, audience)
+	if err != nil {
+		return err
+	}
+	op.UpdatedAt = time.Now().Unix()
+	return this.Save(tx, op)
+}
+
+// PublishPost 发布文章
+// publishAt 为发布时间，小于等于0时表示立即发布，大于当前时间时表示定时发布
+func (this *PostDAO) PublishPost(tx *dbs.Tx, postId int64, publishAt int64) error {
+	if publishAt <= 0 {
+		publishAt = time.Now().Unix()
+	}
+	return this.Query(tx).
+		Pk(postId).
+		Set("isPublished", true).
+		Set("publishedAt", publishAt).
+		UpdateQuickly()
+}
+
+// UnpublishPost 取消发布，文章重新变为草稿
+func (this *PostDAO) UnpublishPost(tx *dbs.Tx, postId int64) error {
+	return this.Query(tx).
+		Pk(postId).
+		Set("isPublished", false).
+		UpdateQuickly()
+}
+
+// UpdatePostIsPinned 设置是否置顶
+func (this *PostDAO) UpdatePostIsPinned(tx *dbs.Tx, postId int64, isPinned bool) error {
+	return this.Query(tx).
+		Pk(postId).
+		Set("isPinned", isPinned).
+		UpdateQuickly()
+}
+
+// CountPosts 计算文章数量
+func (this *PostDAO) CountPosts(tx *dbs.Tx, categoryId int64, productCode string, status PostStatus, keyword string) (int64, error) {
+	return this.adminQuery(tx, categoryId, productCode, status, keyword).
+		Count()
+}
+
+// ListPosts 列出单页文章
+func (this *PostDAO) ListPosts(tx *dbs.Tx, categoryId int64, productCode string, status PostStatus, keyword string, offset int64, size int64) (result []*Post, err error) {
+	_, err = this.adminQuery(tx, categoryId, productCode, status, keyword).
+		Desc("isPinned").
+		DescPk().
+		Offset(offset).
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CountPublishedPostsForUser 计算某个用户可以看到的已发布文章数量
+func (this *PostDAO) CountPublishedPostsForUser(tx *dbs.Tx, userId int64, categoryId int64, productCode string) (int64, error) {
+	query, err := this.userQuery(tx, userId, categoryId, productCode)
+	if err != nil {
+		return 0, err
+	}
+	return query.Count()
+}
+
+// ListPublishedPostsForUser 列出某个用户可以看到的单页已发布文章，置顶的文章排在前面
+func (this *PostDAO) ListPublishedPostsForUser(tx *dbs.Tx, userId int64, categoryId int64, productCode string, offset int64, size int64) (result []*Post, err error) {
+	query, err := this.userQuery(tx, userId, categoryId, productCode)
+	if err != nil {
+		return nil, err
+	}
+	_, err = query.
+		Desc("isPinned").
+		Desc("publishedAt").
+		DescPk().
+		Offset(offset).
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindPublishedPostForUser 查找某个用户可以看到的已发布文章
+func (this *PostDAO) FindPublishedPostForUser(tx *dbs.Tx, userId int64, postId int64) (*Post, error) {
+	query, err := this.userQuery(tx, userId, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	one, err := query.
+		Pk(postId).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*Post), nil
+}
+
+// CountUnreadPostsForUser 计算某个用户未读的文章数量
+func (this *PostDAO) CountUnreadPostsForUser(tx *dbs.Tx, userId int64, categoryId int64, productCode string) (int64, error) {
+	query, err := this.userQuery(tx, userId, categoryId, productCode)
+	if err != nil {
+		return 0, err
+	}
+	return this.unreadQuery(query, userId).
+		Count()
+}
+
+// MarkAllPostsReadForUser 将某个用户可以看到的所有文章设置为已读
+func (this *PostDAO) MarkAllPostsReadForUser(tx *dbs.Tx, userId int64, categoryId int64, productCode string) error {
+	query, err := this.userQuery(tx, userId, categoryId, productCode)
+	if err != nil {
+		return err
+	}
+	ones, err := this.unreadQuery(query, userId).
+		ResultPk().
+		FindAll()
+	if err != nil {
+		return err
+	}
+	for _, one := range ones {
+		err = SharedPostReadDAO.MarkRead(tx, userId, int64(one.(*Post).Id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 设置目标用户
+func (this *PostDAO) applyAudience(op *PostOperator, audience *PostAudience) error {
+	if audience == nil {
+		audience = &PostAudience{Type: PostAudienceTypeAll}
+	}
+
+	var clusterIds = []int64{}
+	var featureCodes = []string{}
+	switch audience.Type {
+	case PostAudienceTypeAll, "":
+		audience.Type = PostAudienceTypeAll
+	case PostAudienceTypeCluster:
+		if len(audience.ClusterIds) == 0 {
+			return errors.New("'clusterIds' should not be empty")
+		}
+		clusterIds = audience.ClusterIds
+	case PostAudienceTypeFeature:
+		if len(audience.FeatureCodes) == 0 {
+			return errors.New("'featureCodes' should not be empty")
+		}
+		featureCodes = audience.FeatureCodes
+	default:
+		return errors.New("invalid audience type '" + audience.Type + "'")
+	}
+
+	clusterIdsJSON, err := json.Marshal(clusterIds)
+	if err != nil {
+		return err
+	}
+	featureCodesJSON, err := json.Marshal(featureCodes)
+	if err != nil {
+		return err
+	}
+
+	op.AudienceType = audience.Type
+	op.AudienceClusterIds = clusterIdsJSON
+	op.AudienceFeatures = featureCodesJSON
+	return nil
+}
+
+// 管理员使用的查询
+func (this *PostDAO) adminQuery(tx *dbs.Tx, categoryId int64, productCode string, status PostStatus, keyword string) *dbs.Query {
+	var query = this.Query(tx).
+		State(PostStateEnabled)
+	if categoryId > 0 {
+		query.Attr("categoryId", categoryId)
+	}
+	if len(productCode) > 0 {
+		query.Attr("productCode", productCode)
+	}
+	switch status {
+	case PostStatusDraft:
+		query.Attr("isPublished", false)
+	case PostStatusPublished:
+		query.Attr("isPublished", true).
+			Lte("publishedAt", time.Now().Unix())
+	case PostStatusScheduled:
+		query.Attr("isPublished", true).
+			Gt("publishedAt", time.Now().Unix())
+	}
+	if len(keyword) > 0 {
+		query.Where("(subject LIKE :keyword OR body LIKE :keyword)").
+			Param("keyword", dbutils.QuoteLike(keyword))
+	}
+	return query
+}
+
+// 用户可以看到的文章查询
+func (this *PostDAO) userQuery(tx *dbs.Tx, userId int64, categoryId int64, productCode string) (*dbs.Query, error) {
+	var query = this.Query(tx).
+		State(PostStateEnabled).
+		Attr("isPublished", true).
+		Lte("publishedAt", time.Now().Unix()).
+		Where("(categoryId=0 OR categoryId IN (SELECT id FROM " + SharedPostCategoryDAO.Table + " WHERE isOn=1 AND state=1))")
+	if categoryId > 0 {
+		query.Attr("categoryId", categoryId)
+	}
+	if len(productCode) > 0 {
+		query.Attr("productCode", productCode)
+	}
+
+	// 目标用户
+	var audienceConds = []string{"audienceType IS NULL", "audienceType=''", "audienceType=:audienceTypeAll"}
+	query.Param("audienceTypeAll", PostAudienceTypeAll)
+	if userId > 0 {
+		clusterId, err := models.SharedUserDAO.FindUserClusterId(tx, userId)
+		if err != nil {
+			return nil, err
+		}
+		if clusterId > 0 {
+			audienceConds = append(audienceConds, "(audienceType=:audienceTypeCluster AND JSON_CONTAINS(audienceClusterIds, :audienceClusterId))")
+			query.Param("audienceTypeCluster", PostAudienceTypeCluster)
+			query.Param("audienceClusterId", types.String(clusterId))
+		}
+
+		features, err := models.SharedUserDAO.FindUserFeatures(tx, userId)
+		if err != nil {
+			return nil, err
+		}
+		if len(features) > 0 {
+			query.Param("audienceTypeFeature", PostAudienceTypeFeature)
+			for index, feature := range features {
+				featureJSON, err := json.Marshal(feature.Code)
+				if err != nil {
+					return nil, err
+				}
+				var param = "audienceFeature" + strconv.Itoa(index)
+				audienceConds = append(audienceConds, "(audienceType=:audienceTypeFeature AND JSON_CONTAINS(audienceFeatures, :"+param+"))")
+				query.Param(param, string(featureJSON))
+			}
+		}
+	}
+	query.Where("(" + strings.Join(audienceConds, " OR ") + ")")
+
+	return query, nil
+}
+
+// 只查询未读文章
+func (this *PostDAO) unreadQuery(query *dbs.Query, userId int64) *dbs.Query {
+	return query.
+		Where("id NOT IN (SELECT postId FROM "+SharedPostReadDAO.Table+" WHERE userId=:readUserId)").
+		Param("readUserId", userId)
+}
@@ -1,6 +1,37 @@
 package posts_test
 
 import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/posts"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
 )
+
+func TestPostDAO_ListPublishedPostsForUser(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = posts.NewPostDAO()
+
+	count, err := dao.CountPublishedPostsForUser(tx, 1, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("count:", count)
+
+	countUnread, err := dao.CountUnreadPostsForUser(tx, 1, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("unread:", countUnread)
+
+	postList, err := dao.ListPublishedPostsForUser(tx, 1, 0, "", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range postList {
+		t.Log(post.Id, post.Subject, post.IsPinned, post.PublishedAt)
+	}
+}
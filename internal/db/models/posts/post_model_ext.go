@@ -1 +1,66 @@
 package posts
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type PostType = string
+
+const (
+	PostTypeNormal PostType = "normal" // 普通文章
+	PostTypeURL    PostType = "url"    // 外部链接
+)
+
+type PostStatus = string
+
+const (
+	PostStatusDraft     PostStatus = "draft"     // 草稿
+	PostStatusPublished PostStatus = "published" // 已发布
+	PostStatusScheduled PostStatus = "scheduled" // 定时发布
+)
+
+type PostAudienceType = string
+
+const (
+	PostAudienceTypeAll     PostAudienceType = "all"     // 所有用户
+	PostAudienceTypeCluster PostAudienceType = "cluster" // 某些集群中的用户
+	PostAudienceTypeFeature PostAudienceType = "feature" // 拥有某些功能的用户
+)
+
+// PostAudience 文章目标用户
+type PostAudience struct {
+	Type         PostAudienceType // 类型
+	ClusterIds   []int64          // 集群ID
+	FeatureCodes []string         // 功能代号
+}
+
+// Status 文章当前状态
+func (this *Post) Status() PostStatus {
+	if !this.IsPublished {
+		return PostStatusDraft
+	}
+	if int64(this.PublishedAt) > time.Now().Unix() {
+		return PostStatusScheduled
+	}
+	return PostStatusPublished
+}
+
+// DecodeAudience 解析目标用户
+func (this *Post) DecodeAudience() *PostAudience {
+	var audience = &PostAudience{
+		Type:         this.AudienceType,
+		ClusterIds:   []int64{},
+		FeatureCodes: []string{},
+	}
+	if len(audience.Type) == 0 {
+		audience.Type = PostAudienceTypeAll
+	}
+	if len(this.AudienceClusterIds) > 0 {
+		_ = json.Unmarshal(this.AudienceClusterIds, &audience.ClusterIds)
+	}
+	if len(this.AudienceFeatures) > 0 {
+		_ = json.Unmarshal(this.AudienceFeatures, &audience.FeatureCodes)
+	}
+	return audience
+}
@@ -0,0 +1,75 @@
+package posts
+
+import (
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+)
+
+type PostReadDAO dbs.DAO
+
+func NewPostReadDAO() *PostReadDAO {
+	return dbs.NewDAO(&PostReadDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgePostReads",
+			Model:  new(PostRead),
+			PkName: "id",
+		},
+	}).(*PostReadDAO)
+}
+
+var SharedPostReadDAO *PostReadDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedPostReadDAO = NewPostReadDAO()
+	})
+}
+
+// MarkRead 设置文章为已读，需要在 (userId, postId) 上有唯一索引
+func (this *PostReadDAO) MarkRead(tx *dbs.Tx, userId int64, postId int64) error {
+	if userId <= 0 || postId <= 0 {
+		return nil
+	}
+	return this.Query(tx).
+		InsertOrUpdateQuickly(maps.Map{
+			"userId":    userId,
+			"postId":    postId,
+			"createdAt": time.Now().Unix(),
+		}, maps.Map{
+			"userId": userId, // 已读过的文章保持原来的阅读时间
+		})
+}
+
+// FindReadPostIds 从一组文章中查找用户已读的文章ID
+func (this *PostReadDAO) FindReadPostIds(tx *dbs.Tx, userId int64, postIds []int64) (map[int64]bool, error) {
+	var result = map[int64]bool{}
+	if userId <= 0 || len(postIds) == 0 {
+		return result, nil
+	}
+
+	ones, err := this.Query(tx).
+		Attr("userId", userId).
+		Attr("postId", postIds).
+		Result("postId").
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		result[int64(one.(*PostRead).PostId)] = true
+	}
+	return result, nil
+}
+
+// DeletePostReads 删除某个文章的所有阅读记录
+func (this *PostReadDAO) DeletePostReads(tx *dbs.Tx, postId int64) error {
+	_, err := this.Query(tx).
+		Attr("postId", postId).
+		Delete()
+	return err
+}
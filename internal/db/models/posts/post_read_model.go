@@ -0,0 +1,29 @@
+package posts
+
+import "github.com/iwind/TeaGo/dbs"
+
+const (
+	PostReadField_Id        dbs.FieldName = "id"        // ID
+	PostReadField_PostId    dbs.FieldName = "postId"    // 文章ID
+	PostReadField_UserId    dbs.FieldName = "userId"    // 用户ID
+	PostReadField_CreatedAt dbs.FieldName = "createdAt" // 阅读时间
+)
+
+// PostRead 用户文章阅读记录
+type PostRead struct {
+	Id        uint64 `field:"id"`        // ID
+	PostId    uint32 `field:"postId"`    // 文章ID
+	UserId    uint32 `field:"userId"`    // 用户ID
+	CreatedAt uint64 `field:"createdAt"` // 阅读时间
+}
+
+type PostReadOperator struct {
+	Id        any // ID
+	PostId    any // 文章ID
+	UserId    any // 用户ID
+	CreatedAt any // 阅读时间
+}
+
+func NewPostReadOperator() *PostReadOperator {
+	return &PostReadOperator{}
+}
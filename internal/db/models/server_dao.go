@@ -15,6 +15,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/regexputils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
@@ -803,7 +804,8 @@ func (this *ServerDAO) CountAllEnabledServers(tx *dbs.Tx) (int64, error) {
 // 参数：
 //
 //	groupId 分组ID，如果为-1，则搜索没有分组的服务
-func (this *ServerDAO) CountAllEnabledServersMatch(tx *dbs.Tx, groupId int64, keyword string, userId int64, clusterId int64, auditingFlag configutils.BoolState, protocolFamilies []string, userPlanId int64) (int64, error) {
+//	scope 子用户可以管理的服务范围，为nil时表示不限制
+func (this *ServerDAO) CountAllEnabledServersMatch(tx *dbs.Tx, groupId int64, keyword string, userId int64, clusterId int64, auditingFlag configutils.BoolState, protocolFamilies []string, userPlanId int64, scope *subuserutils.ServerScope) (int64, error) {
 	query := this.Query(tx).
 		State(ServerStateEnabled)
 	if groupId > 0 {
@@ -860,6 +862,7 @@ func (this *ServerDAO) CountAllEnabledServersMatch(tx *dbs.Tx, groupId int64, ke
 	if userPlanId > 0 {
 		query.Attr("userPlanId", userPlanId)
 	}
+	this.filterServerScope(query, scope)
 
 	return query.Count()
 }
@@ -868,7 +871,8 @@ func (this *ServerDAO) CountAllEnabledServersMatch(tx *dbs.Tx, groupId int64, ke
 // 参数：
 //
 //	groupId 分组ID，如果为-1，则搜索没有分组的服务
-func (this *ServerDAO) ListEnabledServersMatch(tx *dbs.Tx, offset int64, size int64, groupId int64, keyword string, userId int64, clusterId int64, auditingFlag int32, protocolFamilies []string, order string) (result []*Server, err error) {
+//	scope 子用户可以管理的服务范围，为nil时表示不限制
+func (this *ServerDAO) ListEnabledServersMatch(tx *dbs.Tx, offset int64, size int64, groupId int64, keyword string, userId int64, clusterId int64, auditingFlag int32, protocolFamilies []string, order string, scope *subuserutils.ServerScope) (result []*Server, err error) {
 	var query = this.Query(tx).
 		State(ServerStateEnabled).
 		Offset(offset).
@@ -924,6 +928,7 @@ func (this *ServerDAO) ListEnabledServersMatch(tx *dbs.Tx, offset int64, size in
 	if len(protocolConds) > 0 {
 		query.Where("(" + strings.Join(protocolConds, " OR ") + ")")
 	}
+	this.filterServerScope(query, scope)
 
 	// 排序
 	var timestamp = (time.Now().Unix()) / 300 * 300
@@ -1873,11 +1878,14 @@ func (this *ServerDAO) UpdateUserServersClusterId(tx *dbs.Tx, userId int64, oldC
 }
 
 // FindAllBasicServersWithUserId 查找用户的所有服务的基础信息
-func (this *ServerDAO) FindAllBasicServersWithUserId(tx *dbs.Tx, userId int64) (result []*Server, err error) {
-	_, err = this.Query(tx).
+// scope 子用户可以管理的服务范围，为nil时表示不限制
+func (this *ServerDAO) FindAllBasicServersWithUserId(tx *dbs.Tx, userId int64, scope *subuserutils.ServerScope) (result []*Server, err error) {
+	var query = this.Query(tx).
 		Result("id", "serverNames", "name", "isOn", "type", "groupIds", "clusterId", "dnsName").
 		State(ServerStateEnabled).
-		Attr("userId", userId).
+		Attr("userId", userId)
+	this.filterServerScope(query, scope)
+	_, err = query.
 		DescPk().
 		Slice(&result).
 		FindAll()
@@ -3191,3 +3199,23 @@ func (this *ServerDAO) FindUserServerByServerName(tx *dbs.Tx, serverName string)
 		FindAll()
 	return
 }
+
+// 限制子用户可以管理的服务范围
+func (this *ServerDAO) filterServerScope(query *dbs.Query, scope *subuserutils.ServerScope) {
+	if !scope.IsLimited() {
+		return
+	}
+
+	var conds = []string{}
+	if len(scope.ServerIds) > 0 {
+		var serverIdStrings = []string{}
+		for _, serverId := range scope.ServerIds {
+			serverIdStrings = append(serverIdStrings, numberutils.FormatInt64(serverId))
+		}
+		conds = append(conds, "id IN ("+strings.Join(serverIdStrings, ",")+")")
+	}
+	for _, groupId := range scope.ServerGroupIds {
+		conds = append(conds, "JSON_CONTAINS(groupIds, '"+numberutils.FormatInt64(groupId)+"')")
+	}
+	query.Where("(" + strings.Join(conds, " OR ") + ")")
+}
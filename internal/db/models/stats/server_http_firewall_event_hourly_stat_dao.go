@@ -0,0 +1,209 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package stats
+
+import (
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+type FirewallEventDimension = string
+
+const (
+	FirewallEventDimensionIP        FirewallEventDimension = "ip"
+	FirewallEventDimensionCountry   FirewallEventDimension = "country"
+	FirewallEventDimensionURL       FirewallEventDimension = "url"
+	FirewallEventDimensionUserAgent FirewallEventDimension = "userAgent"
+)
+
+// FirewallEventMaxValueLength 维度值最大长度
+const FirewallEventMaxValueLength = 255
+
+type ServerHTTPFirewallEventHourlyStatDAO dbs.DAO
+
+func init() {
+	dbs.OnReadyDone(func() {
+		// 清理数据任务
+		var ticker = time.NewTicker(time.Duration(rands.Int(24, 48)) * time.Hour)
+		goman.New(func() {
+			for range ticker.C {
+				err := SharedServerHTTPFirewallEventHourlyStatDAO.CleanDefaultDays(nil, 15) // 只保留N天
+				if err != nil {
+					remotelogs.Error("ServerHTTPFirewallEventHourlyStatDAO", "clean expired data failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+func NewServerHTTPFirewallEventHourlyStatDAO() *ServerHTTPFirewallEventHourlyStatDAO {
+	return dbs.NewDAO(&ServerHTTPFirewallEventHourlyStatDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeServerHTTPFirewallEventHourlyStats",
+			Model:  new(ServerHTTPFirewallEventHourlyStat),
+			PkName: "id",
+		},
+	}).(*ServerHTTPFirewallEventHourlyStatDAO)
+}
+
+var SharedServerHTTPFirewallEventHourlyStatDAO *ServerHTTPFirewallEventHourlyStatDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedServerHTTPFirewallEventHourlyStatDAO = NewServerHTTPFirewallEventHourlyStatDAO()
+	})
+}
+
+// IncreaseHourlyCount 增加数量
+// ipItemId 为事件产生的IP名单条目，为0表示没有产生条目
+func (this *ServerHTTPFirewallEventHourlyStatDAO) IncreaseHourlyCount(tx *dbs.Tx, serverId int64, dimension FirewallEventDimension, value string, firewallRuleGroupId int64, action string, ipItemId int64, hour string, count int64) error {
+	if len(hour) != 10 {
+		return errors.New("invalid hour '" + hour + "'")
+	}
+	if len(value) == 0 {
+		return nil
+	}
+	value = utils.LimitString(value, FirewallEventMaxValueLength)
+
+	err := this.Query(tx).
+		Param("count", count).
+		Param("ipItemId", ipItemId).
+		InsertOrUpdateQuickly(maps.Map{
+			"serverId":                serverId,
+			"day":                     hour[:8],
+			"hour":                    hour,
+			"dimension":               dimension,
+			"value":                   value,
+			"httpFirewallRuleGroupId": firewallRuleGroupId,
+			"action":                  action,
+			"ipItemId":                ipItemId,
+			"count":                   count,
+		}, maps.Map{
+			"count":    dbs.SQL("count+:count"),
+			"ipItemId": dbs.SQL("IF(:ipItemId>0, :ipItemId, ipItemId)"),
+		})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FindTopValues 查找某个维度下事件数量最多的值
+func (this *ServerHTTPFirewallEventHourlyStatDAO) FindTopValues(tx *dbs.Tx, userId int64, serverId int64, dimension FirewallEventDimension, hourFrom string, hourTo string, size int64) (result []*ServerHTTPFirewallEventHourlyStat, err error) {
+	var query = this.Query(tx).
+		Attr("dimension", dimension).
+		Between("hour", hourFrom, hourTo)
+	this.filterServer(query, userId, serverId)
+	_, err = query.
+		Group("value").
+		Result("value, SUM(count) AS count, MAX(ipItemId) AS ipItemId").
+		Desc("count").
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindHourlyActionStats 按小时和动作统计事件数量
+// ip 不为空时只统计此IP产生的事件
+func (this *ServerHTTPFirewallEventHourlyStatDAO) FindHourlyActionStats(tx *dbs.Tx, userId int64, serverId int64, ip string, hourFrom string, hourTo string) (result []*ServerHTTPFirewallEventHourlyStat, err error) {
+	var query = this.Query(tx).
+		Attr("dimension", FirewallEventDimensionIP).
+		Between("hour", hourFrom, hourTo)
+	if len(ip) > 0 {
+		query.Attr("value", ip)
+	}
+	this.filterServer(query, userId, serverId)
+	_, err = query.
+		Group("hour").
+		Group("action").
+		Result("hour, action, SUM(count) AS count, MAX(ipItemId) AS ipItemId").
+		Asc("hour").
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CountHourlyIPs 按小时统计攻击来源IP数量
+func (this *ServerHTTPFirewallEventHourlyStatDAO) CountHourlyIPs(tx *dbs.Tx, userId int64, serverId int64, hourFrom string, hourTo string) (map[string]int64, error) {
+	var query = this.Query(tx).
+		Attr("dimension", FirewallEventDimensionIP).
+		Between("hour", hourFrom, hourTo)
+	this.filterServer(query, userId, serverId)
+	ones, _, err := query.
+		Group("hour").
+		Result("hour, COUNT(DISTINCT value) AS countIPs").
+		FindOnes()
+	if err != nil {
+		return nil, err
+	}
+	var result = map[string]int64{} // hour => countIPs
+	for _, one := range ones {
+		result[one.GetString("hour")] = one.GetInt64("countIPs")
+	}
+	return result, nil
+}
+
+// FindTopHourlyValue 查找某个小时内事件数量最多的值
+func (this *ServerHTTPFirewallEventHourlyStatDAO) FindTopHourlyValue(tx *dbs.Tx, userId int64, serverId int64, dimension FirewallEventDimension, hour string) (*ServerHTTPFirewallEventHourlyStat, error) {
+	var query = this.Query(tx).
+		Attr("dimension", dimension).
+		Attr("hour", hour)
+	this.filterServer(query, userId, serverId)
+	one, err := query.
+		Group("value").
+		Result("value, SUM(count) AS count, MAX(ipItemId) AS ipItemId").
+		Desc("count").
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*ServerHTTPFirewallEventHourlyStat), nil
+}
+
+// CleanDays 清理历史数据
+func (this *ServerHTTPFirewallEventHourlyStatDAO) CleanDays(tx *dbs.Tx, days int) error {
+	var hour = timeutil.Format("Ymd00", time.Now().AddDate(0, 0, -days))
+	_, err := this.Query(tx).
+		Lt("hour", hour).
+		Delete()
+	return err
+}
+
+func (this *ServerHTTPFirewallEventHourlyStatDAO) CleanDefaultDays(tx *dbs.Tx, defaultDays int) error {
+	databaseConfig, err := models.SharedSysSettingDAO.ReadDatabaseConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	if databaseConfig != nil && databaseConfig.ServerHTTPFirewallEventHourlyStat.Clean.Days > 0 {
+		defaultDays = databaseConfig.ServerHTTPFirewallEventHourlyStat.Clean.Days
+	}
+	if defaultDays <= 0 {
+		defaultDays = 15
+	}
+
+	return this.CleanDays(tx, defaultDays)
+}
+
+// 筛选服务
+func (this *ServerHTTPFirewallEventHourlyStatDAO) filterServer(query *dbs.Query, userId int64, serverId int64) {
+	if serverId > 0 {
+		query.Attr("serverId", serverId)
+	} else if userId > 0 {
+		query.Where("serverId IN (SELECT id FROM "+models.SharedServerDAO.Table+" WHERE userId=:userId AND state=1)").
+			Param("userId", userId)
+	}
+}
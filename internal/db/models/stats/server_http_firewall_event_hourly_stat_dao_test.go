@@ -0,0 +1,30 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package stats
+
+import (
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+func TestServerHTTPFirewallEventHourlyStatDAO_IncreaseHourlyCount(t *testing.T) {
+	dbs.NotifyReady()
+
+	var hour = timeutil.Format("YmdH")
+	err := SharedServerHTTPFirewallEventHourlyStatDAO.IncreaseHourlyCount(nil, 1, FirewallEventDimensionIP, "192.168.1.100", 1, "block", 0, hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := SharedServerHTTPFirewallEventHourlyStatDAO.FindTopValues(nil, 0, 1, FirewallEventDimensionIP, hour, hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range stats {
+		t.Log(stat.Value, stat.Count, stat.IpItemId)
+	}
+}
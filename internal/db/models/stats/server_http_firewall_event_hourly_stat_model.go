@@ -0,0 +1,34 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package stats
+
+// ServerHTTPFirewallEventHourlyStat WAF事件小时统计
+type ServerHTTPFirewallEventHourlyStat struct {
+	Id                      uint64 `field:"id"`                      // ID
+	ServerId                uint32 `field:"serverId"`                // 服务ID
+	Day                     string `field:"day"`                     // YYYYMMDD
+	Hour                    string `field:"hour"`                    // YYYYMMDDHH
+	Dimension               string `field:"dimension"`               // 维度：ip|country|url|userAgent
+	Value                   string `field:"value"`                   // 维度值
+	HttpFirewallRuleGroupId uint32 `field:"httpFirewallRuleGroupId"` // WAF分组ID
+	Action                  string `field:"action"`                  // 采取的动作
+	IpItemId                uint64 `field:"ipItemId"`                // 产生的IP名单条目ID
+	Count                   uint64 `field:"count"`                   // 数量
+}
+
+type ServerHTTPFirewallEventHourlyStatOperator struct {
+	Id                      interface{} // ID
+	ServerId                interface{} // 服务ID
+	Day                     interface{} // YYYYMMDD
+	Hour                    interface{} // YYYYMMDDHH
+	Dimension               interface{} // 维度：ip|country|url|userAgent
+	Value                   interface{} // 维度值
+	HttpFirewallRuleGroupId interface{} // WAF分组ID
+	Action                  interface{} // 采取的动作
+	IpItemId                interface{} // 产生的IP名单条目ID
+	Count                   interface{} // 数量
+}
+
+func NewServerHTTPFirewallEventHourlyStatOperator() *ServerHTTPFirewallEventHourlyStatOperator {
+	return &ServerHTTPFirewallEventHourlyStatOperator{}
+}
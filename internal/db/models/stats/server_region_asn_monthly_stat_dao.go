@@ -0,0 +1,97 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package stats
+
+import (
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		// 清理数据任务
+		var ticker = time.NewTicker(time.Duration(rands.Int(24, 48)) * time.Hour)
+		goman.New(func() {
+			for range ticker.C {
+				err := SharedServerRegionASNMonthlyStatDAO.Clean(nil)
+				if err != nil {
+					remotelogs.Error("SharedServerRegionASNMonthlyStatDAO", "clean expired data failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+type ServerRegionASNMonthlyStatDAO dbs.DAO
+
+func NewServerRegionASNMonthlyStatDAO() *ServerRegionASNMonthlyStatDAO {
+	return dbs.NewDAO(&ServerRegionASNMonthlyStatDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeServerRegionASNMonthlyStats",
+			Model:  new(ServerRegionASNMonthlyStat),
+			PkName: "id",
+		},
+	}).(*ServerRegionASNMonthlyStatDAO)
+}
+
+var SharedServerRegionASNMonthlyStatDAO *ServerRegionASNMonthlyStatDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedServerRegionASNMonthlyStatDAO = NewServerRegionASNMonthlyStatDAO()
+	})
+}
+
+// IncreaseMonthlyCount 增加数量
+func (this *ServerRegionASNMonthlyStatDAO) IncreaseMonthlyCount(tx *dbs.Tx, serverId int64, asn uint32, month string, count int64) error {
+	if len(month) != 6 {
+		return errors.New("invalid month '" + month + "'")
+	}
+	err := this.Query(tx).
+		Param("count", count).
+		InsertOrUpdateQuickly(maps.Map{
+			"serverId": serverId,
+			"asn":      asn,
+			"month":    month,
+			"count":    count,
+		}, maps.Map{
+			"count": dbs.SQL("count+:count"),
+		})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListStats 查找单页数据
+func (this *ServerRegionASNMonthlyStatDAO) ListStats(tx *dbs.Tx, serverId int64, month string, offset int64, size int64) (result []*ServerRegionASNMonthlyStat, err error) {
+	query := this.Query(tx).
+		Attr("serverId", serverId).
+		Attr("month", month).
+		Offset(offset).
+		Limit(size).
+		Slice(&result).
+		Desc("count")
+	_, err = query.FindAll()
+	return
+}
+
+// Clean 清理统计数据
+func (this *ServerRegionASNMonthlyStatDAO) Clean(tx *dbs.Tx) error {
+	// 只保留两个月的
+	var month = timeutil.Format("Ym", time.Now().AddDate(0, -2, 0))
+	_, err := this.Query(tx).
+		Lte("month", month).
+		Delete()
+	return err
+}
@@ -0,0 +1,24 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package stats
+
+// ServerRegionASNMonthlyStat 服务用户ASN分布统计（按月）
+type ServerRegionASNMonthlyStat struct {
+	Id       uint64 `field:"id"`       // ID
+	ServerId uint32 `field:"serverId"` // 服务ID
+	Asn      uint32 `field:"asn"`      // AS号码
+	Month    string `field:"month"`    // 月份YYYYMM
+	Count    uint64 `field:"count"`    // 数量
+}
+
+type ServerRegionASNMonthlyStatOperator struct {
+	Id       interface{} // ID
+	ServerId interface{} // 服务ID
+	Asn      interface{} // AS号码
+	Month    interface{} // 月份YYYYMM
+	Count    interface{} // 数量
+}
+
+func NewServerRegionASNMonthlyStatOperator() *ServerRegionASNMonthlyStatOperator {
+	return &ServerRegionASNMonthlyStatOperator{}
+}
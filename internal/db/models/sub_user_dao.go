@@ -1,9 +1,16 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
+	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	stringutil "github.com/iwind/TeaGo/utils/string"
 )
 
 const (
@@ -69,3 +76,221 @@ func (this *SubUserDAO) FindSubUserName(tx *dbs.Tx, id uint32) (string, error) {
 		Result("name").
 		FindStringCol("")
 }
+
+// CreateSubUser 创建子用户
+func (this *SubUserDAO) CreateSubUser(tx *dbs.Tx, userId int64, name string, username string, password string, permissions *subuserutils.Permissions) (int64, error) {
+	if userId <= 0 {
+		return 0, errors.New("invalid 'userId'")
+	}
+	if len(password) == 0 {
+		return 0, errors.New("'password' should not be empty")
+	}
+
+	permissionsJSON, err := this.encodePermissions(permissions)
+	if err != nil {
+		return 0, err
+	}
+
+	var op = NewSubUserOperator()
+	op.UserId = userId
+	op.Name = name
+	op.Username = username
+	op.Password = stringutil.Md5(password)
+	op.Permissions = permissionsJSON
+	op.IsOn = true
+	op.CreatedAt = time.Now().Unix()
+	op.State = SubUserStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// UpdateSubUser 修改子用户，密码为空时表示不修改密码
+func (this *SubUserDAO) UpdateSubUser(tx *dbs.Tx, subUserId int64, name string, username string, password string, permissions *subuserutils.Permissions, isOn bool) error {
+	if subUserId <= 0 {
+		return errors.New("invalid 'subUserId'")
+	}
+
+	permissionsJSON, err := this.encodePermissions(permissions)
+	if err != nil {
+		return err
+	}
+
+	var op = NewSubUserOperator()
+	op.Id = subUserId
+	op.Name = name
+	op.Username = username
+	if len(password) > 0 {
+		op.Password = stringutil.Md5(password)
+	}
+	op.Permissions = permissionsJSON
+	op.IsOn = isOn
+	err = this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	// 停用后需要重新登录
+	if !isOn || len(password) > 0 {
+		return SharedAPIAccessTokenDAO.DeleteSubUserAccessTokens(tx, subUserId)
+	}
+	return nil
+}
+
+// UpdateSubUserOTP 修改子用户OTP设置
+func (this *SubUserDAO) UpdateSubUserOTP(tx *dbs.Tx, subUserId int64, config *SubUserOTPConfig) error {
+	if subUserId <= 0 {
+		return errors.New("invalid 'subUserId'")
+	}
+
+	var otpJSON = []byte("null")
+	if config != nil {
+		var err error
+		otpJSON, err = json.Marshal(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := this.Query(tx).
+		Pk(subUserId).
+		Set("otp", otpJSON).
+		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteSubUser 删除子用户
+func (this *SubUserDAO) DeleteSubUser(tx *dbs.Tx, subUserId int64) error {
+	if subUserId <= 0 {
+		return errors.New("invalid 'subUserId'")
+	}
+	err := this.Query(tx).
+		Pk(subUserId).
+		Set("state", SubUserStateDisabled).
+		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+	err = SharedUserAccessKeyDAO.DisableSubUserAccessKeys(tx, subUserId)
+	if err != nil {
+		return err
+	}
+	return SharedAPIAccessTokenDAO.DeleteSubUserAccessTokens(tx, subUserId)
+}
+
+// FindEnabledSubUserWithId 查找启用中的子用户
+func (this *SubUserDAO) FindEnabledSubUserWithId(tx *dbs.Tx, subUserId int64) (*SubUser, error) {
+	return this.FindEnabledSubUser(tx, uint32(subUserId))
+}
+
+// CheckUserSubUser 检查子用户是否属于某个用户
+func (this *SubUserDAO) CheckUserSubUser(tx *dbs.Tx, userId int64, subUserId int64) error {
+	exists, err := this.Query(tx).
+		Pk(subUserId).
+		Attr("userId", userId).
+		State(SubUserStateEnabled).
+		Exist()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindEnabledSubUserUserIdWithUsername 根据子用户名查找所属的主用户ID
+func (this *SubUserDAO) FindEnabledSubUserUserIdWithUsername(tx *dbs.Tx, username string) (int64, error) {
+	if len(username) == 0 {
+		return 0, nil
+	}
+	return this.Query(tx).
+		Attr("username", username).
+		State(SubUserStateEnabled).
+		Result("userId").
+		FindInt64Col(0)
+}
+
+// ExistSubUsername 检查用户名是否已被使用，子用户和主用户的用户名不能重复
+func (this *SubUserDAO) ExistSubUsername(tx *dbs.Tx, subUserId int64, username string) (bool, error) {
+	exists, err := this.Query(tx).
+		State(SubUserStateEnabled).
+		Attr("username", username).
+		Neq("id", subUserId).
+		Exist()
+	if err != nil || exists {
+		return exists, err
+	}
+	return SharedUserDAO.ExistUser(tx, 0, username)
+}
+
+// CountSubUsers 计算某个用户的子用户数量
+func (this *SubUserDAO) CountSubUsers(tx *dbs.Tx, userId int64, keyword string) (int64, error) {
+	var query = this.Query(tx).
+		Attr("userId", userId).
+		State(SubUserStateEnabled)
+	if len(keyword) > 0 {
+		query.Where("(name LIKE :keyword OR username LIKE :keyword)").
+			Param("keyword", dbutils.QuoteLike(keyword))
+	}
+	return query.Count()
+}
+
+// ListSubUsers 列出单页子用户
+func (this *SubUserDAO) ListSubUsers(tx *dbs.Tx, userId int64, keyword string, offset int64, size int64) (result []*SubUser, err error) {
+	var query = this.Query(tx).
+		Attr("userId", userId).
+		State(SubUserStateEnabled)
+	if len(keyword) > 0 {
+		query.Where("(name LIKE :keyword OR username LIKE :keyword)").
+			Param("keyword", dbutils.QuoteLike(keyword))
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CheckSubUserPassword 检查子用户名和密码，返回子用户ID和主用户ID
+func (this *SubUserDAO) CheckSubUserPassword(tx *dbs.Tx, username string, encryptedPassword string) (subUserId int64, userId int64, err error) {
+	if len(username) == 0 || len(encryptedPassword) == 0 {
+		return 0, 0, nil
+	}
+	one, err := this.Query(tx).
+		Attr("username", username).
+		Attr("password", encryptedPassword).
+		Attr("isOn", true).
+		State(SubUserStateEnabled).
+		Result("id", "userId").
+		Find()
+	if err != nil || one == nil {
+		return 0, 0, err
+	}
+	var subUser = one.(*SubUser)
+
+	// 检查主用户状态
+	user, err := SharedUserDAO.FindEnabledBasicUser(tx, int64(subUser.UserId))
+	if err != nil {
+		return 0, 0, err
+	}
+	if user == nil || !user.IsOn {
+		return 0, 0, nil
+	}
+
+	return int64(subUser.Id), int64(subUser.UserId), nil
+}
+
+func (this *SubUserDAO) encodePermissions(permissions *subuserutils.Permissions) ([]byte, error) {
+	if permissions == nil {
+		permissions = &subuserutils.Permissions{}
+	}
+	err := permissions.Init()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(permissions)
+}
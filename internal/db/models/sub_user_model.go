@@ -1,24 +1,32 @@
 package models
 
+import "github.com/iwind/TeaGo/dbs"
+
 // SubUser 子用户
 type SubUser struct {
-	Id       uint32 `field:"id"`       // ID
-	UserId   uint32 `field:"userId"`   // 所属主用户ID
-	IsOn     bool   `field:"isOn"`     // 是否启用
-	Name     string `field:"name"`     // 名称
-	Username string `field:"username"` // 用户名
-	Password string `field:"password"` // 密码
-	State    uint8  `field:"state"`    // 状态
+	Id          uint32   `field:"id"`          // ID
+	UserId      uint32   `field:"userId"`      // 所属主用户ID
+	IsOn        bool     `field:"isOn"`        // 是否启用
+	Name        string   `field:"name"`        // 名称
+	Username    string   `field:"username"`    // 用户名
+	Password    string   `field:"password"`    // 密码
+	Permissions dbs.JSON `field:"permissions"` // 权限设置
+	Otp         dbs.JSON `field:"otp"`         // OTP设置
+	CreatedAt   uint64   `field:"createdAt"`   // 创建时间
+	State       uint8    `field:"state"`       // 状态
 }
 
 type SubUserOperator struct {
-	Id       interface{} // ID
-	UserId   interface{} // 所属主用户ID
-	IsOn     interface{} // 是否启用
-	Name     interface{} // 名称
-	Username interface{} // 用户名
-	Password interface{} // 密码
-	State    interface{} // 状态
+	Id          interface{} // ID
+	UserId      interface{} // 所属主用户ID
+	IsOn        interface{} // 是否启用
+	Name        interface{} // 名称
+	Username    interface{} // 用户名
+	Password    interface{} // 密码
+	Permissions interface{} // 权限设置
+	Otp         interface{} // OTP设置
+	CreatedAt   interface{} // 创建时间
+	State       interface{} // 状态
 }
 
 func NewSubUserOperator() *SubUserOperator {
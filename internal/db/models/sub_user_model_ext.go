@@ -1 +1,38 @@
 package models
+
+import (
+	"encoding/json"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
+)
+
+// SubUserOTPConfig 子用户OTP设置
+type SubUserOTPConfig struct {
+	IsOn   bool   `json:"isOn"`   // 是否启用
+	Secret string `json:"secret"` // 密钥
+}
+
+// DecodePermissions 解析权限设置
+func (this *SubUser) DecodePermissions() (*subuserutils.Permissions, error) {
+	var permissions = &subuserutils.Permissions{}
+	if IsNotNull(this.Permissions) {
+		err := json.Unmarshal(this.Permissions, permissions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := permissions.Init()
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// DecodeOTP 解析OTP设置
+func (this *SubUser) DecodeOTP() *SubUserOTPConfig {
+	var config = &SubUserOTPConfig{}
+	if IsNotNull(this.Otp) {
+		_ = json.Unmarshal(this.Otp, config)
+	}
+	return config
+}
@@ -82,6 +82,33 @@ func (this *UserAccessKeyDAO) CreateAccessKey(tx *dbs.Tx, adminId int64, userId
 	return this.SaveInt64(tx, op)
 }
 
+// CreateSubUserAccessKey 为子用户创建Key
+func (this *UserAccessKeyDAO) CreateSubUserAccessKey(tx *dbs.Tx, userId int64, subUserId int64, description string) (int64, error) {
+	if userId <= 0 || subUserId <= 0 {
+		return 0, errors.New("invalid userId or subUserId")
+	}
+	var op = NewUserAccessKeyOperator()
+	op.UserId = userId
+	op.SubUserId = subUserId
+	op.Description = description
+	op.UniqueId = rands.String(16)
+	op.Secret = rands.String(32)
+	op.IsOn = true
+	op.State = UserAccessKeyStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// DisableSubUserAccessKeys 禁用子用户所有的Key
+func (this *UserAccessKeyDAO) DisableSubUserAccessKeys(tx *dbs.Tx, subUserId int64) error {
+	if subUserId <= 0 {
+		return nil
+	}
+	return this.Query(tx).
+		Attr("subUserId", subUserId).
+		Set("state", UserAccessKeyStateDisabled).
+		UpdateQuickly()
+}
+
 // FindAllEnabledAccessKeys 查找用户所有的Key
 func (this *UserAccessKeyDAO) FindAllEnabledAccessKeys(tx *dbs.Tx, adminId int64, userId int64) (result []*UserAccessKey, err error) {
 	_, err = this.Query(tx).
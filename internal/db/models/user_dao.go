@@ -102,6 +102,12 @@ func (this *UserDAO) DisableUser(tx *dbs.Tx, userId int64) error {
 		return err
 	}
 
+	// 退出所有登录
+	err = SharedLoginSessionDAO.DeleteAllSessions(tx, 0, userId, "")
+	if err != nil {
+		return err
+	}
+
 	return this.NotifyUpdate(tx, userId)
 }
 
@@ -256,7 +262,11 @@ func (this *UserDAO) UpdateUser(tx *dbs.Tx, userId int64, username string, passw
 	op.Id = userId
 	op.Username = username
 	if len(password) > 0 {
-		op.Password = stringutil.Md5(password)
+		passwordHash, err := this.prepareNewPassword(tx, userId, username, password)
+		if err != nil {
+			return err
+		}
+		op.Password = passwordHash
 	}
 	op.Fullname = fullname
 	op.Mobile = mobile
@@ -271,12 +281,26 @@ func (this *UserDAO) UpdateUser(tx *dbs.Tx, userId int64, username string, passw
 		return err
 	}
 
+	// 修改密码后退出所有登录
+	if len(password) > 0 && isOn {
+		err = SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, 0, userId)
+		if err != nil {
+			return err
+		}
+	}
+
 	// 删除AccessTokens
 	if !isOn {
 		err = SharedAPIAccessTokenDAO.DeleteAccessTokens(tx, 0, userId)
 		if err != nil {
 			return err
 		}
+
+		// 退出所有登录
+		err = SharedLoginSessionDAO.DeleteAllSessions(tx, 0, userId, "")
+		if err != nil {
+			return err
+		}
 	}
 
 	return this.NotifyUpdate(tx, userId)
@@ -304,9 +328,22 @@ func (this *UserDAO) UpdateUserLogin(tx *dbs.Tx, userId int64, username string,
 	op.Id = userId
 	op.Username = username
 	if len(password) > 0 {
-		op.Password = stringutil.Md5(password)
+		passwordHash, err := this.prepareNewPassword(tx, userId, username, password)
+		if err != nil {
+			return err
+		}
+		op.Password = passwordHash
 	}
-	return this.Save(tx, op)
+	err := this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	// 修改密码后退出所有登录
+	if len(password) > 0 {
+		return SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, 0, userId)
+	}
+	return nil
 }
 
 // UpdateUserPassword 修改用户密码
@@ -317,9 +354,22 @@ func (this *UserDAO) UpdateUserPassword(tx *dbs.Tx, userId int64, password strin
 	var op = NewUserOperator()
 	op.Id = userId
 	if len(password) > 0 {
-		op.Password = stringutil.Md5(password)
+		passwordHash, err := this.prepareNewPassword(tx, userId, "", password)
+		if err != nil {
+			return err
+		}
+		op.Password = passwordHash
 	}
-	return this.Save(tx, op)
+	err := this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	// 修改密码后退出所有登录
+	if len(password) > 0 {
+		return SharedLoginSessionDAO.RevokeSessionsAfterPasswordChanged(tx, 0, userId)
+	}
+	return nil
 }
 
 // CountAllEnabledUsers 计算用户数量
@@ -445,13 +495,14 @@ func (this *UserDAO) CheckUserEmailPassword(tx *dbs.Tx, verifiedEmail string, en
 		FindInt64Col(0)
 }
 
-// CheckUserMobilePassword 检查邮箱+密码
-func (this *UserDAO) CheckUserMobilePassword(tx *dbs.Tx, verifiedEmail string, encryptedPassword string) (int64, error) {
-	if len(verifiedEmail) == 0 || len(encryptedPassword) == 0 {
+// CheckUserMobilePassword 检查已验证手机号+密码
+func (this *UserDAO) CheckUserMobilePassword(tx *dbs.Tx, verifiedMobile string, encryptedPassword string) (int64, error) {
+	if len(verifiedMobile) == 0 || len(encryptedPassword) == 0 {
 		return 0, nil
 	}
 	return this.Query(tx).
-		Attr("verifiedMobile", verifiedEmail).
+		Attr("verifiedMobile", verifiedMobile).
+		Attr("mobileIsVerified", true).
 		Attr("password", encryptedPassword).
 		Attr("state", UserStateEnabled).
 		Attr("isOn", true).
@@ -781,3 +832,36 @@ func (this *UserDAO) NotifyUpdate(tx *dbs.Tx, userId int64) error {
 
 	return nil
 }
+
+// 检查新密码是否符合登录安全策略并记录旧密码，返回新密码的哈希值
+func (this *UserDAO) prepareNewPassword(tx *dbs.Tx, userId int64, username string, password string) (string, error) {
+	one, err := this.Query(tx).
+		Pk(userId).
+		Result("username", "password").
+		Find()
+	if err != nil {
+		return "", err
+	}
+	var oldPasswordHash string
+	if one != nil {
+		var user = one.(*User)
+		oldPasswordHash = user.Password
+		if len(username) == 0 {
+			username = user.Username
+		}
+	}
+
+	err = SharedLoginDAO.CheckNewPassword(tx, 0, userId, username, oldPasswordHash, password)
+	if err != nil {
+		return "", err
+	}
+
+	var passwordHash = stringutil.Md5(password)
+	if oldPasswordHash != passwordHash {
+		err = SharedLoginDAO.RecordPasswordHistory(tx, 0, userId, oldPasswordHash)
+		if err != nil {
+			return "", err
+		}
+	}
+	return passwordHash, nil
+}
@@ -1,11 +1,47 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+// SettingCodeEmailConfig 邮件发送设置代号
+const SettingCodeEmailConfig = "emailConfig"
+
+type UserEmailNotificationState = string
+
+const (
+	UserEmailNotificationStatePending UserEmailNotificationState = "pending" // 等待发送
+	UserEmailNotificationStateSent    UserEmailNotificationState = "sent"    // 已发送
+	UserEmailNotificationStateFailed  UserEmailNotificationState = "failed"  // 已放弃发送
 )
 
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedUserEmailNotificationDAO.CleanNotifications(nil)
+				if err != nil {
+					remotelogs.Error("UserEmailNotificationDAO", "clean notifications failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
 type UserEmailNotificationDAO dbs.DAO
 
 func NewUserEmailNotificationDAO() *UserEmailNotificationDAO {
@@ -26,3 +62,215 @@ func init() {
 		SharedUserEmailNotificationDAO = NewUserEmailNotificationDAO()
 	})
 }
+
+// CreateNotification 将邮件加入发送队列
+func (this *UserEmailNotificationDAO) CreateNotification(tx *dbs.Tx, userId int64, message *mailutils.Message) (int64, error) {
+	if message == nil {
+		return 0, errors.New("invalid message")
+	}
+	err := message.Validate()
+	if err != nil {
+		return 0, err
+	}
+
+	var op = NewUserEmailNotificationOperator()
+	op.UserId = userId
+	op.Email = message.To
+	op.Subject = utils.LimitString(message.Subject, 255)
+	op.Body = message.Body
+	op.IsHTML = message.IsHTML
+	op.IsSent = false
+	op.IsFailed = false
+	op.CountTries = 0
+	op.NextTryAt = time.Now().Unix()
+	op.CreatedAt = time.Now().Unix()
+	op.Day = timeutil.Format("Ymd")
+	err = this.Save(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	return types.Int64(op.Id), nil
+}
+
+// CreateNotificationWithTemplate 使用模板生成邮件并加入发送队列
+func (this *UserEmailNotificationDAO) CreateNotificationWithTemplate(tx *dbs.Tx, config *mailutils.Config, userId int64, email string, lang string, templateCode string, vars maps.Map) (int64, error) {
+	var template = config.FindTemplate(templateCode, lang)
+	if template == nil {
+		return 0, errors.New("could not find email template '" + templateCode + "'")
+	}
+	message, err := template.Render(email, vars)
+	if err != nil {
+		return 0, errors.New("render email template '" + templateCode + "' failed: " + err.Error())
+	}
+	return this.CreateNotification(tx, userId, message)
+}
+
+// NotifyUserMessage 将用户消息发送到用户已验证的邮箱
+func (this *UserEmailNotificationDAO) NotifyUserMessage(tx *dbs.Tx, userId int64, subject string, body string) error {
+	if userId <= 0 {
+		return nil
+	}
+
+	config, err := this.ReadEmailConfig(tx)
+	if err != nil {
+		return err
+	}
+	if !config.IsOn || !config.NotifyUserMessages {
+		return nil
+	}
+
+	user, err := SharedUserDAO.FindEnabledUser(tx, userId, nil)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.IsOn || user.EmailIsVerified == 0 || len(user.VerifiedEmail) == 0 {
+		return nil
+	}
+
+	var username = user.Fullname
+	if len(username) == 0 {
+		username = user.Username
+	}
+	_, err = this.CreateNotificationWithTemplate(tx, config, userId, user.VerifiedEmail, user.Lang, mailutils.TemplateUserMessage, maps.Map{
+		"Username": username,
+		"Subject":  subject,
+		"Body":     body,
+	})
+	return err
+}
+
+// FindPendingNotifications 查找等待发送的邮件
+func (this *UserEmailNotificationDAO) FindPendingNotifications(tx *dbs.Tx, size int64) (result []*UserEmailNotification, err error) {
+	_, err = this.Query(tx).
+		Attr("isSent", false).
+		Attr("isFailed", false).
+		Lte("nextTryAt", time.Now().Unix()).
+		Asc("id").
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// UpdateNotificationSent 设置邮件已发送
+func (this *UserEmailNotificationDAO) UpdateNotificationSent(tx *dbs.Tx, notificationId int64) error {
+	return this.Query(tx).
+		Pk(notificationId).
+		Set("isSent", true).
+		Set("sentAt", time.Now().Unix()).
+		Set("countTries", dbs.SQL("countTries+1")).
+		Set("error", "").
+		UpdateQuickly()
+}
+
+// UpdateNotificationFailed 记录发送失败，超出重试次数或者永久失败时放弃发送
+func (this *UserEmailNotificationDAO) UpdateNotificationFailed(tx *dbs.Tx, config *mailutils.Config, notification *UserEmailNotification, sendErr error) error {
+	var countTries = int(notification.CountTries) + 1
+	var isFailed = mailutils.IsPermanentError(sendErr) || countTries > config.MaxRetries
+	return this.Query(tx).
+		Pk(notification.Id).
+		Set("countTries", countTries).
+		Set("isFailed", isFailed).
+		Set("nextTryAt", time.Now().Unix()+int64(config.RetryDelaySeconds(countTries))).
+		Set("error", utils.LimitString(sendErr.Error(), 255)).
+		UpdateQuickly()
+}
+
+// RetryNotification 重新发送某个已放弃的邮件
+func (this *UserEmailNotificationDAO) RetryNotification(tx *dbs.Tx, notificationId int64) error {
+	return this.Query(tx).
+		Pk(notificationId).
+		Attr("isSent", false).
+		Set("isFailed", false).
+		Set("countTries", 0).
+		Set("nextTryAt", time.Now().Unix()).
+		Set("error", "").
+		UpdateQuickly()
+}
+
+// CountNotifications 计算队列中邮件数量
+func (this *UserEmailNotificationDAO) CountNotifications(tx *dbs.Tx, state UserEmailNotificationState, userId int64, email string) (int64, error) {
+	return this.stateQuery(tx, state, userId, email).
+		Count()
+}
+
+// ListNotifications 列出单页队列中的邮件
+func (this *UserEmailNotificationDAO) ListNotifications(tx *dbs.Tx, state UserEmailNotificationState, userId int64, email string, offset int64, size int64) (result []*UserEmailNotification, err error) {
+	_, err = this.stateQuery(tx, state, userId, email).
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CleanNotifications 清理已发送和已放弃的过期邮件
+func (this *UserEmailNotificationDAO) CleanNotifications(tx *dbs.Tx) error {
+	config, err := this.ReadEmailConfig(tx)
+	if err != nil {
+		return err
+	}
+	_, err = this.Query(tx).
+		Where("(isSent=1 OR isFailed=1)").
+		Lt("day", timeutil.Format("Ymd", time.Now().AddDate(0, 0, -config.KeepDays))).
+		Delete()
+	return err
+}
+
+// ReadEmailConfig 读取邮件发送设置
+func (this *UserEmailNotificationDAO) ReadEmailConfig(tx *dbs.Tx) (*mailutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeEmailConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = mailutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateEmailConfig 修改邮件发送设置
+func (this *UserEmailNotificationDAO) UpdateEmailConfig(tx *dbs.Tx, config *mailutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeEmailConfig, configJSON)
+}
+
+// 根据状态构造查询
+func (this *UserEmailNotificationDAO) stateQuery(tx *dbs.Tx, state UserEmailNotificationState, userId int64, email string) *dbs.Query {
+	var query = this.Query(tx)
+	switch state {
+	case UserEmailNotificationStatePending:
+		query.Attr("isSent", false).
+			Attr("isFailed", false)
+	case UserEmailNotificationStateSent:
+		query.Attr("isSent", true)
+	case UserEmailNotificationStateFailed:
+		query.Attr("isFailed", true)
+	}
+	if userId > 0 {
+		query.Attr("userId", userId)
+	}
+	if len(email) > 0 {
+		query.Attr("email", email)
+	}
+	return query
+}
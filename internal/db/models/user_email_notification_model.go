@@ -2,21 +2,37 @@ package models
 
 // UserEmailNotification 邮件通知队列
 type UserEmailNotification struct {
-	Id        uint64 `field:"id"`        // ID
-	Email     string `field:"email"`     // 邮箱地址
-	Subject   string `field:"subject"`   // 标题
-	Body      string `field:"body"`      // 内容
-	CreatedAt uint64 `field:"createdAt"` // 创建时间
-	Day       string `field:"day"`       // YYYYMMDD
+	Id         uint64 `field:"id"`         // ID
+	UserId     uint64 `field:"userId"`     // 用户ID
+	Email      string `field:"email"`      // 邮箱地址
+	Subject    string `field:"subject"`    // 标题
+	Body       string `field:"body"`       // 内容
+	IsHTML     bool   `field:"isHTML"`     // 内容是否为HTML
+	IsSent     bool   `field:"isSent"`     // 是否已发送
+	IsFailed   bool   `field:"isFailed"`   // 是否已放弃发送
+	CountTries uint32 `field:"countTries"` // 尝试发送次数
+	NextTryAt  uint64 `field:"nextTryAt"`  // 下次尝试发送时间
+	SentAt     uint64 `field:"sentAt"`     // 发送时间
+	Error      string `field:"error"`      // 最后一次发送失败的原因
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	Day        string `field:"day"`        // YYYYMMDD
 }
 
 type UserEmailNotificationOperator struct {
-	Id        any // ID
-	Email     any // 邮箱地址
-	Subject   any // 标题
-	Body      any // 内容
-	CreatedAt any // 创建时间
-	Day       any // YYYYMMDD
+	Id         any // ID
+	UserId     any // 用户ID
+	Email      any // 邮箱地址
+	Subject    any // 标题
+	Body       any // 内容
+	IsHTML     any // 内容是否为HTML
+	IsSent     any // 是否已发送
+	IsFailed   any // 是否已放弃发送
+	CountTries any // 尝试发送次数
+	NextTryAt  any // 下次尝试发送时间
+	SentAt     any // 发送时间
+	Error      any // 最后一次发送失败的原因
+	CreatedAt  any // 创建时间
+	Day        any // YYYYMMDD
 }
 
 func NewUserEmailNotificationOperator() *UserEmailNotificationOperator {
@@ -1,11 +1,39 @@
 package models
 
 import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
+	timeutil "github.com/iwind/TeaGo/utils/time"
 )
 
+// ErrEmailIsUsed 邮箱已经被其他用户验证
+var ErrEmailIsUsed = errors.New("the email address is using by other user")
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedUserEmailVerificationDAO.CleanExpiredVerifications(nil)
+				if err != nil {
+					remotelogs.Error("UserEmailVerificationDAO", "clean expired verifications failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
 type UserEmailVerificationDAO dbs.DAO
 
 func NewUserEmailVerificationDAO() *UserEmailVerificationDAO {
@@ -26,3 +54,141 @@ func init() {
 		SharedUserEmailVerificationDAO = NewUserEmailVerificationDAO()
 	})
 }
+
+// CreateVerification 创建邮箱验证，并将验证邮件加入发送队列
+func (this *UserEmailVerificationDAO) CreateVerification(tx *dbs.Tx, userId int64, email string) error {
+	if userId <= 0 {
+		return errors.New("invalid 'userId'")
+	}
+	email = strings.TrimSpace(email)
+	if len(email) == 0 {
+		return errors.New("'email' should not be empty")
+	}
+
+	config, err := SharedUserEmailNotificationDAO.ReadEmailConfig(tx)
+	if err != nil {
+		return err
+	}
+	if !config.IsOn {
+		return errors.New("email sending is not enabled")
+	}
+
+	user, err := SharedUserDAO.FindEnabledUser(tx, userId, nil)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+
+	var code = rands.HexString(32)
+	var now = time.Now().Unix()
+
+	// 此前未使用的验证链接失效
+	err = this.Query(tx).
+		Attr("userId", userId).
+		Attr("isVerified", false).
+		Set("expiresAt", now).
+		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+
+	var op = NewUserEmailVerificationOperator()
+	op.UserId = userId
+	op.Email = email
+	op.Code = code
+	op.CreatedAt = now
+	op.ExpiresAt = now + int64(config.VerificationLifeSeconds)
+	op.IsSent = true // 已加入发送队列
+	op.IsVerified = false
+	op.Day = timeutil.Format("Ymd")
+	err = this.Save(tx, op)
+	if err != nil {
+		return err
+	}
+
+	var username = user.Fullname
+	if len(username) == 0 {
+		username = user.Username
+	}
+	_, err = SharedUserEmailNotificationDAO.CreateNotificationWithTemplate(tx, config, userId, email, user.Lang, mailutils.TemplateVerifyEmail, maps.Map{
+		"Username":     username,
+		"Email":        email,
+		"Code":         code,
+		"Link":         config.UserPortalLink(mailutils.VerifyEmailPath, url.Values{"code": []string{code}}),
+		"ExpiresHours": (config.VerificationLifeSeconds + 3599) / 3600,
+	})
+	return err
+}
+
+// CountRecentVerifications 计算用户最近一段时间内请求验证的次数
+func (this *UserEmailVerificationDAO) CountRecentVerifications(tx *dbs.Tx, userId int64, seconds int64) (int64, error) {
+	return this.Query(tx).
+		Attr("userId", userId).
+		Gt("createdAt", time.Now().Unix()-seconds).
+		Count()
+}
+
+// VerifyEmail 使用验证码验证邮箱，验证码无效或者已过期时返回的userId为0
+func (this *UserEmailVerificationDAO) VerifyEmail(tx *dbs.Tx, code string) (userId int64, email string, err error) {
+	if len(code) == 0 {
+		return 0, "", nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("code", code).
+		Attr("isVerified", false).
+		Gt("expiresAt", time.Now().Unix()).
+		Find()
+	if err != nil || one == nil {
+		return 0, "", err
+	}
+	var verification = one.(*UserEmailVerification)
+	userId = int64(verification.UserId)
+	email = verification.Email
+
+	// 检查邮箱是否已被其他用户使用
+	emailUserId, err := SharedUserDAO.FindUserIdWithVerifiedEmail(tx, email)
+	if err != nil {
+		return 0, "", err
+	}
+	if emailUserId > 0 && emailUserId != userId {
+		return 0, "", ErrEmailIsUsed
+	}
+
+	err = this.Query(tx).
+		Pk(verification.Id).
+		Set("isVerified", true).
+		UpdateQuickly()
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = SharedUserDAO.UpdateUserVerifiedEmail(tx, userId, email)
+	if err != nil {
+		return 0, "", err
+	}
+	return userId, email, nil
+}
+
+// FindLatestVerification 查找用户最近一次请求的邮箱验证
+func (this *UserEmailVerificationDAO) FindLatestVerification(tx *dbs.Tx, userId int64) (*UserEmailVerification, error) {
+	one, err := this.Query(tx).
+		Attr("userId", userId).
+		DescPk().
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*UserEmailVerification), nil
+}
+
+// CleanExpiredVerifications 清理过期的邮箱验证
+func (this *UserEmailVerificationDAO) CleanExpiredVerifications(tx *dbs.Tx) error {
+	// 保留一天以便用户查看状态
+	_, err := this.Query(tx).
+		Lt("expiresAt", time.Now().Unix()-86400).
+		Delete()
+	return err
+}
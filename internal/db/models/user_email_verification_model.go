@@ -7,6 +7,7 @@ type UserEmailVerification struct {
 	UserId     uint64 `field:"userId"`     // 用户ID
 	Code       string `field:"code"`       // 激活码
 	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	ExpiresAt  uint64 `field:"expiresAt"`  // 过期时间
 	IsSent     bool   `field:"isSent"`     // 是否已发送
 	IsVerified bool   `field:"isVerified"` // 是否已激活
 	Day        string `field:"day"`        // YYYYMMDD
@@ -18,6 +19,7 @@ type UserEmailVerificationOperator struct {
 	UserId     any // 用户ID
 	Code       any // 激活码
 	CreatedAt  any // 创建时间
+	ExpiresAt  any // 过期时间
 	IsSent     any // 是否已发送
 	IsVerified any // 是否已激活
 	Day        any // YYYYMMDD
@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/identityutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/userconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
 )
 
 const (
@@ -15,6 +21,12 @@ const (
 	UserIdentityStateDisabled = 0 // 已禁用
 )
 
+// SettingCodeUserIdentityConfig 实名认证审核设置代号
+const SettingCodeUserIdentityConfig = "userIdentityConfig"
+
+// ErrUserIdentityIsNotSubmitted 认证信息不在审核中
+var ErrUserIdentityIsNotSubmitted = errors.New("identity status should be '" + userconfigs.UserIdentityStatusSubmitted + "'")
+
 type UserIdentityDAO dbs.DAO
 
 func NewUserIdentityDAO() *UserIdentityDAO {
@@ -116,12 +128,54 @@ func (this *UserIdentityDAO) UpdateUserIdentity(tx *dbs.Tx, identityId int64, id
 }
 
 // SubmitUserIdentity 提交审核
+// 提交后通知管理员，并在后台调用外部核验接口
 func (this *UserIdentityDAO) SubmitUserIdentity(tx *dbs.Tx, identityId int64) error {
-	return this.Query(tx).
+	err := this.Query(tx).
 		Pk(identityId).
 		Set("status", userconfigs.UserIdentityStatusSubmitted).
 		Set("submittedAt", time.Now().Unix()).
+		Set("hookResult", dbs.SQL("NULL")).
 		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+
+	config, err := this.ReadUserIdentityConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	if config.NotifyAdmins {
+		identity, err := this.FindEnabledUserIdentity(tx, identityId)
+		if err != nil {
+			return err
+		}
+		if identity != nil {
+			username, err := SharedUserDAO.FindUserFullname(tx, int64(identity.UserId))
+			if err != nil {
+				return err
+			}
+			var subject = "用户\"" + username + "\"提交了" + this.orgTypeName(identity.OrgType) + "实名认证信息，等待审核"
+			err = SharedMessageDAO.CreateMessage(tx, 0, 0, MessageTypeUserIdentitySubmitted, MessageLevelInfo, subject, subject, maps.Map{
+				"userId":         identity.UserId,
+				"userIdentityId": identityId,
+			}.AsJSON())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.Hook.IsOn {
+		goman.New(func() {
+			_, err := this.RunHook(nil, identityId)
+			if err != nil {
+				remotelogs.Error("UserIdentityDAO", "run hook for identity '"+types.String(identityId)+"' failed: "+err.Error())
+			}
+		})
+	}
+
+	return nil
 }
 
 // CancelUserIdentity 取消提交审核
@@ -135,30 +189,115 @@ func (this *UserIdentityDAO) CancelUserIdentity(tx *dbs.Tx, identityId int64) er
 
 // ResetUserIdentity 重置实名认证状态
 func (this *UserIdentityDAO) ResetUserIdentity(tx *dbs.Tx, identityId int64) error {
-	return this.Query(tx).
+	err := this.Query(tx).
 		Pk(identityId).
 		Set("status", userconfigs.UserIdentityStatusSubmitted).
 		Set("updatedAt", time.Now().Unix()).
 		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+
+	// 已通过的认证被重置后，相关功能需要立即更新
+	userId, err := this.findUserId(tx, identityId)
+	if err != nil {
+		return err
+	}
+	return SharedUserDAO.NotifyUpdate(tx, userId)
 }
 
 // RejectUserIdentity 拒绝
-func (this *UserIdentityDAO) RejectUserIdentity(tx *dbs.Tx, identityId int64, reason string) error {
-	return this.Query(tx).
+// reviewerId 为审核的管理员ID
+func (this *UserIdentityDAO) RejectUserIdentity(tx *dbs.Tx, identityId int64, reviewerId int64, reason string) error {
+	rowsAffected, err := this.Query(tx).
 		Pk(identityId).
+		Attr("status", userconfigs.UserIdentityStatusSubmitted).
 		Set("status", userconfigs.UserIdentityStatusRejected).
 		Set("rejectReason", reason).
 		Set("rejectedAt", time.Now().Unix()).
-		UpdateQuickly()
+		Set("reviewerId", reviewerId).
+		Update()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserIdentityIsNotSubmitted
+	}
+
+	identity, err := this.FindEnabledUserIdentity(tx, identityId)
+	if err != nil || identity == nil {
+		return err
+	}
+
+	var subject = this.orgTypeName(identity.OrgType) + "实名认证审核未通过"
+	var body = "你提交的" + this.orgTypeName(identity.OrgType) + "实名认证信息未通过审核"
+	if len(reason) > 0 {
+		body += "，原因：" + reason
+	}
+	body += "。请修改后重新提交。"
+	err = SharedMessageDAO.CreateMessage(tx, 0, int64(identity.UserId), MessageTypeUserIdentityRejected, MessageLevelWarning, subject, body, maps.Map{
+		"userIdentityId": identityId,
+	}.AsJSON())
+	if err != nil {
+		return err
+	}
+
+	return SharedUserDAO.NotifyUpdate(tx, int64(identity.UserId))
 }
 
 // VerifyUserIdentity 通过
-func (this *UserIdentityDAO) VerifyUserIdentity(tx *dbs.Tx, identityId int64) error {
-	return this.Query(tx).
+// reviewerId 为审核的管理员ID，为0时表示通过外部核验接口自动通过
+func (this *UserIdentityDAO) VerifyUserIdentity(tx *dbs.Tx, identityId int64, reviewerId int64) error {
+	return this.verifyUserIdentity(tx, identityId, reviewerId, nil)
+}
+
+// 通过审核
+// submittedIdentity 不为空时，只有认证信息在此之后没有被修改或者重新提交才能通过
+func (this *UserIdentityDAO) verifyUserIdentity(tx *dbs.Tx, identityId int64, reviewerId int64, submittedIdentity *UserIdentity) error {
+	var query = this.Query(tx).
 		Pk(identityId).
+		Attr("status", userconfigs.UserIdentityStatusSubmitted)
+	if submittedIdentity != nil {
+		query.
+			Attr("submittedAt", submittedIdentity.SubmittedAt).
+			Attr("type", submittedIdentity.Type).
+			Attr("realName", submittedIdentity.RealName).
+			Attr("number", submittedIdentity.Number)
+		if len(submittedIdentity.FileIds) > 0 {
+			query.
+				Where("(JSON_CONTAINS(fileIds, :fileIds) AND JSON_CONTAINS(:fileIds, fileIds))").
+				Param("fileIds", string(submittedIdentity.FileIds))
+		} else {
+			query.Where("fileIds IS NULL")
+		}
+	}
+	rowsAffected, err := query.
 		Set("status", userconfigs.UserIdentityStatusVerified).
 		Set("verifiedAt", time.Now().Unix()).
-		UpdateQuickly()
+		Set("reviewerId", reviewerId).
+		Update()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserIdentityIsNotSubmitted
+	}
+
+	identity, err := this.FindEnabledUserIdentity(tx, identityId)
+	if err != nil || identity == nil {
+		return err
+	}
+
+	var subject = this.orgTypeName(identity.OrgType) + "实名认证审核通过"
+	var body = "你提交的" + this.orgTypeName(identity.OrgType) + "实名认证信息已审核通过。"
+	err = SharedMessageDAO.CreateMessage(tx, 0, int64(identity.UserId), MessageTypeUserIdentityVerified, MessageLevelSuccess, subject, body, maps.Map{
+		"userIdentityId": identityId,
+	}.AsJSON())
+	if err != nil {
+		return err
+	}
+
+	return SharedUserDAO.NotifyUpdate(tx, int64(identity.UserId))
 }
 
 // CheckUserIdentity 检查用户认证
@@ -217,3 +356,151 @@ func (this *UserIdentityDAO) CheckUserIdentityStatus(tx *dbs.Tx, userId int64, s
 		State(UserIdentityStateEnabled).
 		Exist()
 }
+
+// CountUserIdentities 计算认证信息数量
+// minAgeSeconds 和 maxAgeSeconds 用来根据提交审核的时间筛选，为0表示不限制
+func (this *UserIdentityDAO) CountUserIdentities(tx *dbs.Tx, orgType userconfigs.UserIdentityOrgType, status userconfigs.UserIdentityStatus, minAgeSeconds int64, maxAgeSeconds int64) (int64, error) {
+	return this.listQuery(tx, orgType, status, minAgeSeconds, maxAgeSeconds).
+		Count()
+}
+
+// ListUserIdentities 列出单页认证信息
+// 审核中的认证信息按提交时间从早到晚排列
+func (this *UserIdentityDAO) ListUserIdentities(tx *dbs.Tx, orgType userconfigs.UserIdentityOrgType, status userconfigs.UserIdentityStatus, minAgeSeconds int64, maxAgeSeconds int64, offset int64, size int64) (result []*UserIdentity, err error) {
+	var query = this.listQuery(tx, orgType, status, minAgeSeconds, maxAgeSeconds)
+	if status == userconfigs.UserIdentityStatusSubmitted {
+		query.Asc("submittedAt").AscPk()
+	} else {
+		query.DescPk()
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// RunHook 调用外部核验接口并保存结果
+// 核验通过并且设置为自动通过时，直接通过审核
+func (this *UserIdentityDAO) RunHook(tx *dbs.Tx, identityId int64) (*identityutils.HookResult, error) {
+	config, err := this.ReadUserIdentityConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Hook.IsOn {
+		return nil, nil
+	}
+
+	identity, err := this.FindEnabledUserIdentity(tx, identityId)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+
+	var result = config.Hook.Call(&identityutils.HookRequest{
+		IdentityId: identityId,
+		UserId:     int64(identity.UserId),
+		OrgType:    identity.OrgType,
+		Type:       identity.Type,
+		RealName:   identity.RealName,
+		Number:     identity.Number,
+	})
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	// 核验期间重新提交的认证信息不使用此结果
+	err = this.Query(tx).
+		Pk(identityId).
+		Attr("submittedAt", identity.SubmittedAt).
+		Set("hookResult", resultJSON).
+		UpdateQuickly()
+	if err != nil {
+		return nil, err
+	}
+
+	if result.IsOk && config.Hook.AutoVerify && identity.Status == userconfigs.UserIdentityStatusSubmitted {
+		err = this.verifyUserIdentity(tx, identityId, 0, identity)
+		if err != nil && err != ErrUserIdentityIsNotSubmitted {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// ReadUserIdentityConfig 读取实名认证审核设置
+func (this *UserIdentityDAO) ReadUserIdentityConfig(tx *dbs.Tx) (*identityutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeUserIdentityConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = identityutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateUserIdentityConfig 修改实名认证审核设置
+func (this *UserIdentityDAO) UpdateUserIdentityConfig(tx *dbs.Tx, config *identityutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeUserIdentityConfig, configJSON)
+}
+
+// 构造列表查询
+func (this *UserIdentityDAO) listQuery(tx *dbs.Tx, orgType userconfigs.UserIdentityOrgType, status userconfigs.UserIdentityStatus, minAgeSeconds int64, maxAgeSeconds int64) *dbs.Query {
+	var query = this.Query(tx).
+		State(UserIdentityStateEnabled).
+		Where("userId IN (SELECT id FROM " + SharedUserDAO.Table + " WHERE state=1)")
+	if len(orgType) > 0 {
+		query.Attr("orgType", orgType)
+	}
+	if len(status) > 0 {
+		query.Attr("status", status)
+	}
+	var now = time.Now().Unix()
+	if minAgeSeconds > 0 {
+		query.Lte("submittedAt", now-minAgeSeconds)
+	}
+	if maxAgeSeconds > 0 {
+		query.Gte("submittedAt", now-maxAgeSeconds)
+	}
+	return query
+}
+
+// 查找认证信息所属用户ID
+func (this *UserIdentityDAO) findUserId(tx *dbs.Tx, identityId int64) (int64, error) {
+	return this.Query(tx).
+		Pk(identityId).
+		Result("userId").
+		FindInt64Col(0)
+}
+
+// 组织类型名称
+func (this *UserIdentityDAO) orgTypeName(orgType userconfigs.UserIdentityOrgType) string {
+	switch orgType {
+	case userconfigs.UserIdentityOrgTypeIndividual:
+		return "个人"
+	case userconfigs.UserIdentityOrgTypeEnterprise:
+		return "企业"
+	}
+	return ""
+}
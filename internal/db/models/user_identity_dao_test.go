@@ -1,6 +1,32 @@
 package models_test
 
 import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeCommon/pkg/userconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
 )
+
+func TestUserIdentityDAO_ListUserIdentities(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewUserIdentityDAO()
+
+	count, err := dao.CountUserIdentities(tx, userconfigs.UserIdentityOrgTypeIndividual, userconfigs.UserIdentityStatusSubmitted, 0, 86400*7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("count:", count)
+
+	identities, err := dao.ListUserIdentities(tx, "", userconfigs.UserIdentityStatusSubmitted, 3600, 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range identities {
+		t.Log(identity.Id, identity.UserId, identity.OrgType, identity.SubmittedAt)
+	}
+}
@@ -19,6 +19,8 @@ type UserIdentity struct {
 	RejectedAt   uint64   `field:"rejectedAt"`   // 拒绝时间
 	VerifiedAt   uint64   `field:"verifiedAt"`   // 认证时间
 	RejectReason string   `field:"rejectReason"` // 拒绝原因
+	ReviewerId   uint32   `field:"reviewerId"`   // 审核的管理员ID
+	HookResult   dbs.JSON `field:"hookResult"`   // 外部核验结果
 }
 
 type UserIdentityOperator struct {
@@ -37,6 +39,8 @@ type UserIdentityOperator struct {
 	RejectedAt   interface{} // 拒绝时间
 	VerifiedAt   interface{} // 认证时间
 	RejectReason interface{} // 拒绝原因
+	ReviewerId   interface{} // 审核的管理员ID
+	HookResult   interface{} // 外部核验结果
 }
 
 func NewUserIdentityOperator() *UserIdentityOperator {
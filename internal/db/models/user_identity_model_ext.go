@@ -1,6 +1,10 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/identityutils"
+)
 
 func (this *UserIdentity) DecodeFileIds() []int64 {
 	if len(this.FileIds) == 0 {
@@ -14,3 +18,17 @@ func (this *UserIdentity) DecodeFileIds() []int64 {
 	}
 	return result
 }
+
+// DecodeHookResult 解析外部核验结果
+func (this *UserIdentity) DecodeHookResult() *identityutils.HookResult {
+	if !IsNotNull(this.HookResult) {
+		return nil
+	}
+
+	var result = &identityutils.HookResult{}
+	err := json.Unmarshal(this.HookResult, result)
+	if err != nil {
+		return nil
+	}
+	return result
+}
@@ -1,11 +1,41 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/smsutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	timeutil "github.com/iwind/TeaGo/utils/time"
 )
 
+// SettingCodeSMSConfig 短信发送设置代号
+const SettingCodeSMSConfig = "smsConfig"
+
+// ErrMobileIsUsed 手机号已经被其他用户验证
+var ErrMobileIsUsed = errors.New("the mobile is using by other user")
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedUserMobileVerificationDAO.CleanVerifications(nil, 30)
+				if err != nil {
+					remotelogs.Error("UserMobileVerificationDAO", "clean verifications failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
 type UserMobileVerificationDAO dbs.DAO
 
 func NewUserMobileVerificationDAO() *UserMobileVerificationDAO {
@@ -26,3 +56,163 @@ func init() {
 		SharedUserMobileVerificationDAO = NewUserMobileVerificationDAO()
 	})
 }
+
+// CreateVerification 创建手机号验证，并立即发送验证码短信
+func (this *UserMobileVerificationDAO) CreateVerification(tx *dbs.Tx, userId int64, mobile string, ip string) error {
+	if userId <= 0 {
+		return errors.New("invalid 'userId'")
+	}
+	mobile = strings.TrimSpace(mobile)
+	if !utils.IsValidMobile(mobile) {
+		return errors.New("invalid 'mobile'")
+	}
+
+	config, err := this.ReadSMSConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	user, err := SharedUserDAO.FindEnabledUser(tx, userId, nil)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+
+	// 检查手机号是否已被其他用户使用
+	mobileUserId, err := SharedUserDAO.FindUserIdWithVerifiedMobile(tx, mobile)
+	if err != nil {
+		return err
+	}
+	if mobileUserId > 0 && mobileUserId != userId {
+		return ErrMobileIsUsed
+	}
+
+	err = SharedUserVerifyCodeDAO.CheckMobileCodeLimits(tx, config, mobile, ip)
+	if err != nil {
+		return err
+	}
+
+	code, err := SharedUserVerifyCodeDAO.SendMobileCode(tx, config, mobile, UserVerifyCodeTypeVerifyMobile, smsutils.SceneVerifyMobile, user.Lang, ip)
+	if err != nil {
+		return err
+	}
+
+	var op = NewUserMobileVerificationOperator()
+	op.UserId = userId
+	op.Mobile = mobile
+	op.Code = code
+	op.CreatedAt = time.Now().Unix()
+	op.IsSent = true
+	op.IsVerified = false
+	op.Day = timeutil.Format("Ymd")
+	return this.Save(tx, op)
+}
+
+// VerifyMobile 使用短信验证码验证用户手机号
+func (this *UserMobileVerificationDAO) VerifyMobile(tx *dbs.Tx, userId int64, mobile string, code string) (bool, error) {
+	mobile = strings.TrimSpace(mobile)
+	code = strings.TrimSpace(code)
+	if userId <= 0 || len(mobile) == 0 || len(code) == 0 {
+		return false, nil
+	}
+
+	mobileUserId, err := SharedUserDAO.FindUserIdWithVerifiedMobile(tx, mobile)
+	if err != nil {
+		return false, err
+	}
+	if mobileUserId > 0 && mobileUserId != userId {
+		return false, ErrMobileIsUsed
+	}
+
+	ok, err := SharedUserVerifyCodeDAO.UseCode(tx, "", mobile, UserVerifyCodeTypeVerifyMobile, code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// 验证码必须是由当前用户请求发送的
+	verificationId, err := this.Query(tx).
+		Attr("userId", userId).
+		Attr("mobile", mobile).
+		Attr("code", code).
+		Attr("isVerified", false).
+		ResultPk().
+		FindInt64Col(0)
+	if err != nil || verificationId <= 0 {
+		return false, err
+	}
+
+	err = this.Query(tx).
+		Pk(verificationId).
+		Set("isVerified", true).
+		UpdateQuickly()
+	if err != nil {
+		return false, err
+	}
+
+	err = SharedUserDAO.UpdateUserVerifiedMobile(tx, userId, mobile)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindLatestVerification 查找用户最近一次请求的手机号验证
+func (this *UserMobileVerificationDAO) FindLatestVerification(tx *dbs.Tx, userId int64) (*UserMobileVerification, error) {
+	one, err := this.Query(tx).
+		Attr("userId", userId).
+		DescPk().
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*UserMobileVerification), nil
+}
+
+// CleanVerifications 清理N天以前的验证记录
+func (this *UserMobileVerificationDAO) CleanVerifications(tx *dbs.Tx, days int) error {
+	if days <= 0 {
+		days = 30
+	}
+	_, err := this.Query(tx).
+		Lt("createdAt", time.Now().Unix()-int64(days)*86400).
+		Delete()
+	return err
+}
+
+// ReadSMSConfig 读取短信发送设置
+func (this *UserMobileVerificationDAO) ReadSMSConfig(tx *dbs.Tx) (*smsutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeSMSConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = smsutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateSMSConfig 修改短信发送设置
+func (this *UserMobileVerificationDAO) UpdateSMSConfig(tx *dbs.Tx, config *smsutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeSMSConfig, configJSON)
+}
@@ -1,11 +1,50 @@
 package models
 
 import (
+	"crypto/subtle"
+	"net/url"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/smsutils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+type UserVerifyCodeType = string
+
+const (
+	UserVerifyCodeTypeResetPassword UserVerifyCodeType = "resetPassword" // 重置密码
+	UserVerifyCodeTypeVerifyMobile  UserVerifyCodeType = "verifyMobile"  // 验证手机号
 )
 
+// ErrVerifyCodeTooFrequent 验证码发送过于频繁
+var ErrVerifyCodeTooFrequent = errors.New("verify codes are sent too frequently")
+
+// UserVerifyCodeMaxFails 单个验证码最多允许校验失败的次数，超过后验证码失效
+const UserVerifyCodeMaxFails = 5
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedUserVerifyCodeDAO.CleanExpiredCodes(nil)
+				if err != nil {
+					remotelogs.Error("UserVerifyCodeDAO", "clean expired codes failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
 type UserVerifyCodeDAO dbs.DAO
 
 func NewUserVerifyCodeDAO() *UserVerifyCodeDAO {
@@ -26,3 +65,273 @@ func init() {
 		SharedUserVerifyCodeDAO = NewUserVerifyCodeDAO()
 	})
 }
+
+// CreateCode 创建验证码，email和mobile只需要其中一个
+// 同一个邮箱或手机号的同类验证码只有最新的一个有效
+func (this *UserVerifyCodeDAO) CreateCode(tx *dbs.Tx, email string, mobile string, codeType UserVerifyCodeType, code string, lifeSeconds int64, ip string) error {
+	if len(email) == 0 && len(mobile) == 0 {
+		return errors.New("either 'email' or 'mobile' should not be empty")
+	}
+	if len(code) == 0 {
+		return errors.New("'code' should not be empty")
+	}
+	if lifeSeconds <= 0 {
+		return errors.New("invalid 'lifeSeconds'")
+	}
+
+	var now = time.Now().Unix()
+
+	// 此前未使用的验证码失效
+	err := this.Query(tx).
+		Attr("email", email).
+		Attr("mobile", mobile).
+		Attr("type", codeType).
+		Attr("isVerified", false).
+		Set("expiresAt", now).
+		UpdateQuickly()
+	if err != nil {
+		return err
+	}
+
+	var op = NewUserVerifyCodeOperator()
+	op.Email = email
+	op.Mobile = mobile
+	op.Code = code
+	op.Type = codeType
+	op.IsSent = true // 已加入发送队列
+	op.IsVerified = false
+	op.Ip = ip
+	op.CreatedAt = now
+	op.ExpiresAt = now + lifeSeconds
+	op.Day = timeutil.Format("Ymd")
+	return this.Save(tx, op)
+}
+
+// CreateResetPasswordEmail 创建重置密码验证码，并将邮件发送到用户已验证的邮箱
+func (this *UserVerifyCodeDAO) CreateResetPasswordEmail(tx *dbs.Tx, userId int64, ip string) error {
+	config, err := SharedUserEmailNotificationDAO.ReadEmailConfig(tx)
+	if err != nil {
+		return err
+	}
+	if !config.IsOn {
+		return errors.New("email sending is not enabled")
+	}
+
+	user, err := SharedUserDAO.FindEnabledUser(tx, userId, nil)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailIsVerified == 0 || len(user.VerifiedEmail) == 0 {
+		return ErrNotFound
+	}
+	var email = user.VerifiedEmail
+
+	var code = rands.HexString(32)
+	err = this.CreateCode(tx, email, "", UserVerifyCodeTypeResetPassword, code, int64(config.ResetPasswordLifeSeconds), ip)
+	if err != nil {
+		return err
+	}
+
+	var username = user.Fullname
+	if len(username) == 0 {
+		username = user.Username
+	}
+	_, err = SharedUserEmailNotificationDAO.CreateNotificationWithTemplate(tx, config, userId, email, user.Lang, mailutils.TemplateResetPassword, maps.Map{
+		"Username":       username,
+		"Email":          email,
+		"Code":           code,
+		"Link":           config.UserPortalLink(mailutils.ResetPasswordPath, url.Values{"email": []string{email}, "code": []string{code}}),
+		"ExpiresMinutes": (config.ResetPasswordLifeSeconds + 59) / 60,
+	})
+	return err
+}
+
+// CountRecentCodes 计算最近一段时间内发送的验证码数量
+func (this *UserVerifyCodeDAO) CountRecentCodes(tx *dbs.Tx, email string, mobile string, codeType UserVerifyCodeType, seconds int64) (int64, error) {
+	return this.Query(tx).
+		Attr("email", email).
+		Attr("mobile", mobile).
+		Attr("type", codeType).
+		Gt("createdAt", time.Now().Unix()-seconds).
+		Count()
+}
+
+// CountRecentCodesWithIP 计算最近一段时间内某个IP请求发送的验证码数量
+func (this *UserVerifyCodeDAO) CountRecentCodesWithIP(tx *dbs.Tx, ip string, seconds int64) (int64, error) {
+	if len(ip) == 0 {
+		return 0, nil
+	}
+	return this.Query(tx).
+		Attr("ip", ip).
+		Gt("createdAt", time.Now().Unix()-seconds).
+		Count()
+}
+
+// CheckMobileCodeLimits 检查是否可以向某个手机号发送验证码
+func (this *UserVerifyCodeDAO) CheckMobileCodeLimits(tx *dbs.Tx, config *smsutils.Config, mobile string, ip string) error {
+	if config.SendIntervalSeconds > 0 {
+		count, err := this.Query(tx).
+			Attr("mobile", mobile).
+			Gt("createdAt", time.Now().Unix()-int64(config.SendIntervalSeconds)).
+			Count()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrVerifyCodeTooFrequent
+		}
+	}
+
+	if config.MaxPerMobilePerDay > 0 {
+		count, err := this.Query(tx).
+			Attr("mobile", mobile).
+			Attr("day", timeutil.Format("Ymd")).
+			Count()
+		if err != nil {
+			return err
+		}
+		if count >= int64(config.MaxPerMobilePerDay) {
+			return ErrVerifyCodeTooFrequent
+		}
+	}
+
+	if config.MaxPerIPPerHour > 0 {
+		count, err := this.CountRecentCodesWithIP(tx, ip, 3600)
+		if err != nil {
+			return err
+		}
+		if count >= int64(config.MaxPerIPPerHour) {
+			return ErrVerifyCodeTooFrequent
+		}
+	}
+
+	return nil
+}
+
+// SendMobileCode 生成验证码并立即通过短信网关发送
+// 发送失败时验证码失效，但仍然计入发送次数限制
+func (this *UserVerifyCodeDAO) SendMobileCode(tx *dbs.Tx, config *smsutils.Config, mobile string, codeType UserVerifyCodeType, scene smsutils.Scene, lang string, ip string) (code string, err error) {
+	if !config.IsOn {
+		return "", errors.New("sms sending is not enabled")
+	}
+	gateway, err := config.NewGateway()
+	if err != nil {
+		return "", err
+	}
+
+	code, err = config.GenerateCode()
+	if err != nil {
+		return "", err
+	}
+
+	var content string
+	var template = config.FindTemplate(scene, lang)
+	if template != nil {
+		content, err = template.Render(code, config.CodeLifeSeconds)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = this.CreateCode(tx, "", mobile, codeType, code, int64(config.CodeLifeSeconds), ip)
+	if err != nil {
+		return "", err
+	}
+
+	sendErr := gateway.Send(&smsutils.Message{
+		Mobile:  mobile,
+		Scene:   scene,
+		Code:    code,
+		Content: content,
+	})
+	if sendErr != nil {
+		err = this.Query(tx).
+			Attr("mobile", mobile).
+			Attr("type", codeType).
+			Attr("code", code).
+			Set("isSent", false).
+			Set("expiresAt", time.Now().Unix()).
+			UpdateQuickly()
+		if err != nil {
+			return "", err
+		}
+		return "", errors.New("send sms failed: " + sendErr.Error())
+	}
+	return code, nil
+}
+
+// CreateResetPasswordSMS 创建重置密码验证码，并通过短信发送到用户已验证的手机号
+func (this *UserVerifyCodeDAO) CreateResetPasswordSMS(tx *dbs.Tx, userId int64, ip string) error {
+	config, err := SharedUserMobileVerificationDAO.ReadSMSConfig(tx)
+	if err != nil {
+		return err
+	}
+
+	user, err := SharedUserDAO.FindEnabledUser(tx, userId, nil)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.MobileIsVerified == 0 || len(user.VerifiedMobile) == 0 {
+		return ErrNotFound
+	}
+
+	err = this.CheckMobileCodeLimits(tx, config, user.VerifiedMobile, ip)
+	if err != nil {
+		return err
+	}
+	_, err = this.SendMobileCode(tx, config, user.VerifiedMobile, UserVerifyCodeTypeResetPassword, smsutils.SceneResetPassword, user.Lang, ip)
+	return err
+}
+
+// UseCode 检查并使用验证码，验证码只能使用一次
+// 只检查最新的一个验证码，校验失败次数过多时验证码失效，以防止暴力猜测
+func (this *UserVerifyCodeDAO) UseCode(tx *dbs.Tx, email string, mobile string, codeType UserVerifyCodeType, code string) (bool, error) {
+	if len(code) == 0 || (len(email) == 0 && len(mobile) == 0) {
+		return false, nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("email", email).
+		Attr("mobile", mobile).
+		Attr("type", codeType).
+		Attr("isVerified", false).
+		Gt("expiresAt", time.Now().Unix()).
+		DescPk().
+		Find()
+	if err != nil || one == nil {
+		return false, err
+	}
+	var verifyCode = one.(*UserVerifyCode)
+
+	// 失败次数过多时不再回退到更早的验证码
+	if verifyCode.CountFails >= UserVerifyCodeMaxFails {
+		return false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(verifyCode.Code), []byte(code)) != 1 {
+		err = this.Query(tx).
+			Pk(verifyCode.Id).
+			Set("countFails", dbs.SQL("countFails+1")).
+			UpdateQuickly()
+		return false, err
+	}
+
+	// 使用条件更新，避免同一个验证码被并发使用多次
+	rowsAffected, err := this.Query(tx).
+		Pk(verifyCode.Id).
+		Attr("isVerified", false).
+		Set("isVerified", true).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// CleanExpiredCodes 清理过期的验证码
+func (this *UserVerifyCodeDAO) CleanExpiredCodes(tx *dbs.Tx) error {
+	_, err := this.Query(tx).
+		Lt("expiresAt", time.Now().Unix()-86400).
+		Delete()
+	return err
+}
@@ -1,6 +1,98 @@
 package models_test
 
 import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
 )
+
+func TestUserVerifyCodeDAO_UseCode(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewUserVerifyCodeDAO()
+	const email = "verify-code-test@example.com"
+
+	err := dao.CreateCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, "old-code", 600, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.CreateCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, "new-code", 600, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧的验证码已失效
+	ok, err := dao.UseCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, "old-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("old code should be expired")
+	}
+
+	ok, err = dao.UseCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, "new-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("new code should be valid")
+	}
+
+	// 只能使用一次
+	ok, err = dao.UseCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, "new-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("code should be used only once")
+	}
+}
+
+func TestUserVerifyCodeDAO_UseCode_MaxFails(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewUserVerifyCodeDAO()
+	const mobile = "13800000000"
+
+	err := dao.CreateCode(tx, "", mobile, models.UserVerifyCodeTypeVerifyMobile, "654321", 600, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.CreateCode(tx, "", mobile, models.UserVerifyCodeTypeVerifyMobile, "123456", 600, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < models.UserVerifyCodeMaxFails; i++ {
+		ok, err := dao.UseCode(tx, "", mobile, models.UserVerifyCodeTypeVerifyMobile, "000000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("wrong code should not be valid")
+		}
+	}
+
+	// 失败次数过多后正确的验证码也失效
+	ok, err := dao.UseCode(tx, "", mobile, models.UserVerifyCodeTypeVerifyMobile, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("code should be expired after too many fails")
+	}
+
+	// 不能回退到更早的验证码
+	ok, err = dao.UseCode(tx, "", mobile, models.UserVerifyCodeTypeVerifyMobile, "654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("older code should not be used")
+	}
+}
@@ -9,6 +9,8 @@ type UserVerifyCode struct {
 	Type       string `field:"type"`       // 类型
 	IsSent     bool   `field:"isSent"`     // 是否已发送
 	IsVerified bool   `field:"isVerified"` // 是否已激活
+	CountFails uint32 `field:"countFails"` // 校验失败次数
+	Ip         string `field:"ip"`         // 请求发送的IP
 	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
 	ExpiresAt  uint64 `field:"expiresAt"`  // 过期时间
 	Day        string `field:"day"`        // YYYYMMDD
@@ -22,6 +24,8 @@ type UserVerifyCodeOperator struct {
 	Type       any // 类型
 	IsSent     any // 是否已发送
 	IsVerified any // 是否已激活
+	CountFails any // 校验失败次数
+	Ip         any // 请求发送的IP
 	CreatedAt  any // 创建时间
 	ExpiresAt  any // 过期时间
 	Day        any // YYYYMMDD
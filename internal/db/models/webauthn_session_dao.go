@@ -0,0 +1,157 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/webauthnutils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// SettingCodeWebAuthnConfig 第二认证因素设置代号
+const SettingCodeWebAuthnConfig = "webAuthnConfig"
+
+type WebAuthnSessionType = string
+
+const (
+	WebAuthnSessionTypeRegister WebAuthnSessionType = "register"
+	WebAuthnSessionTypeLogin    WebAuthnSessionType = "login"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			var ticker = time.NewTicker(1 * time.Hour)
+			for range ticker.C {
+				err := SharedWebAuthnSessionDAO.CleanExpiredSessions(nil)
+				if err != nil {
+					remotelogs.Error("WebAuthnSessionDAO", "clean expired sessions failed: "+err.Error())
+				}
+			}
+		})
+	})
+}
+
+type WebAuthnSessionDAO dbs.DAO
+
+func NewWebAuthnSessionDAO() *WebAuthnSessionDAO {
+	return dbs.NewDAO(&WebAuthnSessionDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeWebAuthnSessions",
+			Model:  new(WebAuthnSession),
+			PkName: "id",
+		},
+	}).(*WebAuthnSessionDAO)
+}
+
+var SharedWebAuthnSessionDAO *WebAuthnSessionDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedWebAuthnSessionDAO = NewWebAuthnSessionDAO()
+	})
+}
+
+// CreateSession 开始注册或认证流程，返回挑战值
+func (this *WebAuthnSessionDAO) CreateSession(tx *dbs.Tx, adminId int64, userId int64, sessionType WebAuthnSessionType) (challenge string, err error) {
+	if adminId <= 0 && userId <= 0 {
+		return "", errors.New("invalid adminId and userId")
+	}
+
+	challenge, err = webauthnutils.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	var now = time.Now().Unix()
+	var op = NewWebAuthnSessionOperator()
+	op.AdminId = adminId
+	op.UserId = userId
+	op.Type = sessionType
+	op.Challenge = challenge
+	op.CreatedAt = now
+	op.ExpiresAt = now + webauthnutils.ChallengeLifeSeconds
+	err = this.Save(tx, op)
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// ConsumeSession 查找并删除认证流程，每个挑战值只能使用一次
+func (this *WebAuthnSessionDAO) ConsumeSession(tx *dbs.Tx, adminId int64, userId int64, sessionType WebAuthnSessionType, challenge string) (bool, error) {
+	if len(challenge) == 0 || (adminId <= 0 && userId <= 0) {
+		return false, nil
+	}
+
+	one, err := this.Query(tx).
+		Attr("adminId", adminId).
+		Attr("userId", userId).
+		Attr("type", sessionType).
+		Attr("challenge", challenge).
+		Find()
+	if err != nil || one == nil {
+		return false, err
+	}
+	var session = one.(*WebAuthnSession)
+
+	err = this.Query(tx).
+		Pk(session.Id).
+		DeleteQuickly()
+	if err != nil {
+		return false, err
+	}
+
+	return int64(session.ExpiresAt) >= time.Now().Unix(), nil
+}
+
+// CleanExpiredSessions 清理过期的认证流程
+func (this *WebAuthnSessionDAO) CleanExpiredSessions(tx *dbs.Tx) error {
+	return this.Query(tx).
+		Lt("expiresAt", time.Now().Unix()).
+		DeleteQuickly()
+}
+
+// ReadWebAuthnConfig 读取第二认证因素设置
+func (this *WebAuthnSessionDAO) ReadWebAuthnConfig(tx *dbs.Tx) (*webauthnutils.Config, error) {
+	valueJSON, err := SharedSysSettingDAO.ReadSetting(tx, SettingCodeWebAuthnConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config = webauthnutils.DefaultConfig()
+	if IsNotNull(valueJSON) {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UpdateWebAuthnConfig 修改第二认证因素设置
+func (this *WebAuthnSessionDAO) UpdateWebAuthnConfig(tx *dbs.Tx, config *webauthnutils.Config) error {
+	if config == nil {
+		return errors.New("invalid config")
+	}
+	err := config.Init()
+	if err != nil {
+		return err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return SharedSysSettingDAO.UpdateSetting(tx, SettingCodeWebAuthnConfig, configJSON)
+}
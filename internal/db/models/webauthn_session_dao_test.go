@@ -0,0 +1,58 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestWebAuthnSessionDAO_ConsumeSession(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = models.NewWebAuthnSessionDAO()
+	challenge, err := dao.CreateSession(tx, 1, 0, models.WebAuthnSessionTypeLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 类型不匹配
+	ok, err := dao.ConsumeSession(tx, 1, 0, models.WebAuthnSessionTypeRegister, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("session should not be consumed by another type")
+	}
+
+	// 管理员不匹配
+	ok, err = dao.ConsumeSession(tx, 2, 0, models.WebAuthnSessionTypeLogin, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("session should not be consumed by another admin")
+	}
+
+	ok, err = dao.ConsumeSession(tx, 1, 0, models.WebAuthnSessionTypeLogin, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("session should be consumed")
+	}
+
+	// 只能使用一次
+	ok, err = dao.ConsumeSession(tx, 1, 0, models.WebAuthnSessionTypeLogin, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("session should be consumed only once")
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+// WebAuthnSession WebAuthn认证流程
+type WebAuthnSession struct {
+	Id        uint64 `field:"id"`        // ID
+	AdminId   uint32 `field:"adminId"`   // 管理员ID
+	UserId    uint32 `field:"userId"`    // 用户ID
+	Type      string `field:"type"`      // 类型：register|login
+	Challenge string `field:"challenge"` // 挑战值
+	CreatedAt uint64 `field:"createdAt"` // 创建时间
+	ExpiresAt uint64 `field:"expiresAt"` // 过期时间
+}
+
+type WebAuthnSessionOperator struct {
+	Id        interface{} // ID
+	AdminId   interface{} // 管理员ID
+	UserId    interface{} // 用户ID
+	Type      interface{} // 类型：register|login
+	Challenge interface{} // 挑战值
+	CreatedAt interface{} // 创建时间
+	ExpiresAt interface{} // 过期时间
+}
+
+func NewWebAuthnSessionOperator() *WebAuthnSessionOperator {
+	return &WebAuthnSessionOperator{}
+}
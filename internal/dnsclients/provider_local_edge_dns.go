@@ -0,0 +1,278 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+//go:build !plus
+
+package dnsclients
+
+import (
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/dns"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/nameservers"
+	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+)
+
+const LocalEdgeDNSDefaultRoute = "default"
+
+// LocalEdgeDNSProvider 和当前系统集成的EdgeDNS
+// 直接读写当前数据库中的域名和记录
+type LocalEdgeDNSProvider struct {
+	BaseProvider
+
+	ProviderId int64
+
+	userId int64 // 限定的用户ID，为0表示不限
+}
+
+// Auth 认证
+// 只能操作DNS服务商所属用户的域名，不使用参数中的用户ID，以防止越权访问
+func (this *LocalEdgeDNSProvider) Auth(params maps.Map) error {
+	this.userId = 0
+	if this.ProviderId <= 0 {
+		return nil
+	}
+
+	provider, err := dns.SharedDNSProviderDAO.FindEnabledDNSProvider(nil, this.ProviderId)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return errors.New("can not find dns provider '" + types.String(this.ProviderId) + "'")
+	}
+	this.userId = int64(provider.UserId)
+	return nil
+}
+
+// MaskParams 对参数进行掩码
+func (this *LocalEdgeDNSProvider) MaskParams(params maps.Map) {
+	// 没有需要掩码的参数
+}
+
+// GetDomains 获取所有域名列表
+func (this *LocalEdgeDNSProvider) GetDomains() (domains []string, err error) {
+	return nameservers.SharedNSDomainDAO.FindAllEnabledDomainNames(nil, this.userId)
+}
+
+// GetRecords 获取域名解析记录列表
+func (this *LocalEdgeDNSProvider) GetRecords(domain string) (records []*dnstypes.Record, err error) {
+	var tx *dbs.Tx
+	domainId, err := this.findDomainId(tx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if domainId <= 0 {
+		return nil, nil
+	}
+
+	nsRecords, err := nameservers.SharedNSRecordDAO.FindAllEnabledRecordsWithDomain(tx, domainId)
+	if err != nil {
+		return nil, err
+	}
+	for _, nsRecord := range nsRecords {
+		records = append(records, this.convertRecord(nsRecord))
+	}
+	return
+}
+
+// GetRoutes 读取域名支持的线路数据
+func (this *LocalEdgeDNSProvider) GetRoutes(domain string) (routes []*dnstypes.Route, err error) {
+	routes = append(routes, &dnstypes.Route{
+		Name: "默认线路",
+		Code: this.DefaultRoute(),
+	})
+
+	nsRoutes, err := nameservers.SharedNSRouteDAO.FindAllEnabledPublicRoutes(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, nsRoute := range nsRoutes {
+		routes = append(routes, &dnstypes.Route{
+			Name: nsRoute.Name,
+			Code: nsRoute.RouteCode(),
+		})
+	}
+	return
+}
+
+// QueryRecord 查询单个记录
+func (this *LocalEdgeDNSProvider) QueryRecord(domain string, name string, recordType dnstypes.RecordType) (*dnstypes.Record, error) {
+	records, err := this.QueryRecords(domain, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 {
+		return records[0], nil
+	}
+	return nil, nil
+}
+
+// QueryRecords 查询多个记录
+func (this *LocalEdgeDNSProvider) QueryRecords(domain string, name string, recordType dnstypes.RecordType) ([]*dnstypes.Record, error) {
+	var tx *dbs.Tx
+	domainId, err := this.findDomainId(tx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if domainId <= 0 {
+		return nil, errors.New("can not find domain '" + domain + "'")
+	}
+
+	if name == "@" {
+		name = ""
+	}
+
+	nsRecords, err := nameservers.SharedNSRecordDAO.FindAllEnabledRecordsWithName(tx, domainId, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	var result = []*dnstypes.Record{}
+	for _, nsRecord := range nsRecords {
+		result = append(result, this.convertRecord(nsRecord))
+	}
+	return result, nil
+}
+
+// AddRecord 设置记录
+func (this *LocalEdgeDNSProvider) AddRecord(domain string, newRecord *dnstypes.Record) error {
+	var tx *dbs.Tx
+	domainId, err := this.findDomainId(tx, domain)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+	if domainId <= 0 {
+		return this.WrapError(errors.New("can not find domain '"+domain+"'"), domain, newRecord)
+	}
+
+	if newRecord.Type == dnstypes.RecordTypeCNAME && !strings.HasSuffix(newRecord.Value, ".") {
+		newRecord.Value += "."
+	}
+
+	recordId, err := nameservers.SharedNSRecordDAO.CreateRecord(tx, domainId, "", newRecord.Name, newRecord.Type, newRecord.Value, this.fixTTL(newRecord.TTL), this.routeIds(newRecord.Route))
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+	newRecord.Id = types.String(recordId)
+
+	return nil
+}
+
+// UpdateRecord 修改记录
+func (this *LocalEdgeDNSProvider) UpdateRecord(domain string, record *dnstypes.Record, newRecord *dnstypes.Record) error {
+	var recordId = types.Int64(record.Id)
+	if recordId <= 0 {
+		return errors.New("record id required")
+	}
+	err := this.checkRecord(nil, domain, recordId)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+
+	if newRecord.Type == dnstypes.RecordTypeCNAME && !strings.HasSuffix(newRecord.Value, ".") {
+		newRecord.Value += "."
+	}
+
+	err = nameservers.SharedNSRecordDAO.UpdateRecord(nil, recordId, "", newRecord.Name, newRecord.Type, newRecord.Value, this.fixTTL(newRecord.TTL), this.routeIds(newRecord.Route), true)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+	newRecord.Id = record.Id
+
+	return nil
+}
+
+// DeleteRecord 删除记录
+func (this *LocalEdgeDNSProvider) DeleteRecord(domain string, record *dnstypes.Record) error {
+	var recordId = types.Int64(record.Id)
+	if recordId <= 0 {
+		return errors.New("record id required")
+	}
+	err := this.checkRecord(nil, domain, recordId)
+	if err != nil {
+		return this.WrapError(err, domain, record)
+	}
+	err = nameservers.SharedNSRecordDAO.DisableNSRecord(nil, uint64(recordId))
+	return this.WrapError(err, domain, record)
+}
+
+// DefaultRoute 默认线路
+func (this *LocalEdgeDNSProvider) DefaultRoute() string {
+	return LocalEdgeDNSDefaultRoute
+}
+
+// 查找域名ID
+func (this *LocalEdgeDNSProvider) findDomainId(tx *dbs.Tx, domain string) (int64, error) {
+	nsDomain, err := nameservers.SharedNSDomainDAO.FindEnabledDomainWithName(tx, this.userId, domain)
+	if err != nil {
+		return 0, err
+	}
+	if nsDomain == nil {
+		return 0, nil
+	}
+	return int64(nsDomain.Id), nil
+}
+
+// 检查记录是否属于某个域名
+func (this *LocalEdgeDNSProvider) checkRecord(tx *dbs.Tx, domain string, recordId int64) error {
+	domainId, err := this.findDomainId(tx, domain)
+	if err != nil {
+		return err
+	}
+	if domainId <= 0 {
+		return errors.New("can not find domain '" + domain + "'")
+	}
+
+	nsRecord, err := nameservers.SharedNSRecordDAO.FindEnabledNSRecord(tx, uint64(recordId))
+	if err != nil {
+		return err
+	}
+	if nsRecord == nil || int64(nsRecord.DomainId) != domainId {
+		return errors.New("can not find record '" + types.String(recordId) + "' in domain '" + domain + "'")
+	}
+	return nil
+}
+
+// 转换记录
+func (this *LocalEdgeDNSProvider) convertRecord(nsRecord *nameservers.NSRecord) *dnstypes.Record {
+	var routeCode = this.DefaultRoute()
+	var routeIds = nsRecord.DecodeRouteIds()
+	if len(routeIds) > 0 {
+		routeCode = routeIds[0]
+	}
+
+	var value = nsRecord.Value
+	if nsRecord.Type == dnstypes.RecordTypeCNAME && !strings.HasSuffix(value, ".") {
+		value += "."
+	}
+
+	return &dnstypes.Record{
+		Id:    types.String(nsRecord.Id),
+		Name:  nsRecord.Name,
+		Type:  nsRecord.Type,
+		Value: value,
+		Route: routeCode,
+		TTL:   types.Int32(nsRecord.Ttl),
+	}
+}
+
+// 线路代号转换为记录中的线路ID
+func (this *LocalEdgeDNSProvider) routeIds(routeCode string) []string {
+	if len(routeCode) == 0 || routeCode == this.DefaultRoute() {
+		return nil
+	}
+	return []string{routeCode}
+}
+
+// 修正TTL
+func (this *LocalEdgeDNSProvider) fixTTL(ttl int32) int32 {
+	if ttl <= 0 {
+		ttl = 600
+	}
+	var minTTL = this.MinTTL()
+	if minTTL > 0 && ttl < minTTL {
+		ttl = minTTL
+	}
+	return ttl
+}
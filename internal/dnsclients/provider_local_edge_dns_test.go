@@ -0,0 +1,78 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+//go:build !plus
+
+package dnsclients
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/maps"
+)
+
+func TestLocalEdgeDNSProvider_GetDomains(t *testing.T) {
+	dbs.NotifyReady()
+
+	var provider = &LocalEdgeDNSProvider{}
+	err := provider.Auth(maps.Map{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains, err := provider.GetDomains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(domains)
+}
+
+func TestLocalEdgeDNSProvider_GetRecords(t *testing.T) {
+	dbs.NotifyReady()
+
+	var provider = &LocalEdgeDNSProvider{}
+	records, err := provider.GetRecords("hello.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.PrintAsJSON(records, t)
+}
+
+func TestLocalEdgeDNSProvider_GetRoutes(t *testing.T) {
+	dbs.NotifyReady()
+
+	var provider = &LocalEdgeDNSProvider{}
+	routes, err := provider.GetRoutes("hello.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.PrintAsJSON(routes, t)
+}
+
+func TestLocalEdgeDNSProvider_AddRecord(t *testing.T) {
+	dbs.NotifyReady()
+
+	var provider = &LocalEdgeDNSProvider{}
+	var record = &dnstypes.Record{
+		Name:  "local",
+		Type:  dnstypes.RecordTypeA,
+		Value: "127.0.0.1",
+		Route: provider.DefaultRoute(),
+	}
+	err := provider.AddRecord("hello.com", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok, id:", record.Id)
+
+	records, err := provider.QueryRecords("hello.com", "local", dnstypes.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		err = provider.DeleteRecord("hello.com", r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
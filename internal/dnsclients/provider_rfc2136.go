@@ -0,0 +1,452 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package dnsclients
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"github.com/miekg/dns"
+)
+
+const RFC2136DefaultRoute = "default"
+
+// RFC2136Provider 使用RFC 2136动态更新（TSIG签名）的DNS服务
+// 适用于BIND、Knot、PowerDNS等自建权威DNS服务器
+type RFC2136Provider struct {
+	BaseProvider
+
+	ProviderId int64
+
+	server        string // host:port
+	transferAddr  string // AXFR服务器地址，为空时使用server
+	tsigKeyName   string
+	tsigSecret    string
+	tsigAlgorithm string
+	domains       []string
+	timeout       time.Duration
+}
+
+// Auth 认证
+// 参数：
+//   - server 服务器地址，比如 192.168.1.100:53
+//   - transferServer AXFR服务器地址，可选
+//   - tsigKeyName TSIG密钥名称
+//   - tsigSecret TSIG密钥（Base64）
+//   - tsigAlgorithm hmac-sha256|hmac-sha512
+//   - domains 托管的域名列表
+func (this *RFC2136Provider) Auth(params maps.Map) error {
+	this.server = this.fixAddr(params.GetString("server"))
+	if len(this.server) == 0 {
+		return errors.New("'server' should not be empty")
+	}
+
+	this.transferAddr = this.fixAddr(params.GetString("transferServer"))
+	if len(this.transferAddr) == 0 {
+		this.transferAddr = this.server
+	}
+
+	this.tsigKeyName = params.GetString("tsigKeyName")
+	if len(this.tsigKeyName) == 0 {
+		return errors.New("'tsigKeyName' should not be empty")
+	}
+	this.tsigKeyName = dns.Fqdn(strings.ToLower(this.tsigKeyName))
+
+	this.tsigSecret = params.GetString("tsigSecret")
+	if len(this.tsigSecret) == 0 {
+		return errors.New("'tsigSecret' should not be empty")
+	}
+	_, err := base64.StdEncoding.DecodeString(this.tsigSecret)
+	if err != nil {
+		return errors.New("'tsigSecret' should be a valid base64 string")
+	}
+
+	var algorithm = strings.ToLower(params.GetString("tsigAlgorithm"))
+	switch algorithm {
+	case "", "hmac-sha256":
+		this.tsigAlgorithm = dns.HmacSHA256
+	case "hmac-sha512":
+		this.tsigAlgorithm = dns.HmacSHA512
+	default:
+		return errors.New("unsupported 'tsigAlgorithm' '" + algorithm + "'")
+	}
+
+	// 域名可以是数组，也可以是每行一个域名的字符串
+	var rawDomains = params.GetSlice("domains")
+	if rawDomains == nil {
+		for _, domain := range strings.Split(params.GetString("domains"), "\n") {
+			rawDomains = append(rawDomains, domain)
+		}
+	}
+	this.domains = []string{}
+	for _, domain := range rawDomains {
+		var domainString = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(types.String(domain)), "."))
+		if len(domainString) > 0 {
+			this.domains = append(this.domains, domainString)
+		}
+	}
+
+	this.timeout = 10 * time.Second
+
+	return nil
+}
+
+// MaskParams 对参数进行掩码
+func (this *RFC2136Provider) MaskParams(params maps.Map) {
+	if params == nil {
+		return
+	}
+	params["tsigSecret"] = MaskString(params.GetString("tsigSecret"))
+}
+
+// GetDomains 获取所有域名列表
+// RFC 2136没有列出区域的方法，所以这里返回配置中的域名
+func (this *RFC2136Provider) GetDomains() (domains []string, err error) {
+	return this.domains, nil
+}
+
+// GetRecords 获取域名解析记录列表
+func (this *RFC2136Provider) GetRecords(domain string) (records []*dnstypes.Record, err error) {
+	var zone = dns.Fqdn(domain)
+
+	var msg = &dns.Msg{}
+	msg.SetAxfr(zone)
+	msg.SetTsig(this.tsigKeyName, this.tsigAlgorithm, 300, time.Now().Unix())
+
+	var transfer = &dns.Transfer{
+		DialTimeout:  this.timeout,
+		ReadTimeout:  this.timeout,
+		WriteTimeout: this.timeout,
+		TsigSecret:   map[string]string{this.tsigKeyName: this.tsigSecret},
+	}
+	envelopes, err := transfer.In(msg, this.transferAddr)
+	if err != nil {
+		return nil, fmt.Errorf("zone transfer failed: %w", err)
+	}
+
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("zone transfer failed: %w", envelope.Error)
+		}
+		for _, rr := range envelope.RR {
+			var record = this.convertRR(zone, rr)
+			if record != nil {
+				records = append(records, record)
+			}
+		}
+	}
+
+	// 写入缓存
+	if this.ProviderId > 0 {
+		sharedDomainRecordsCache.WriteDomainRecords(this.ProviderId, domain, records)
+	}
+
+	return
+}
+
+// GetRoutes 读取域名支持的线路数据
+func (this *RFC2136Provider) GetRoutes(domain string) (routes []*dnstypes.Route, err error) {
+	routes = []*dnstypes.Route{
+		{Name: "默认", Code: RFC2136DefaultRoute},
+	}
+	return
+}
+
+// QueryRecord 查询单个记录
+func (this *RFC2136Provider) QueryRecord(domain string, name string, recordType dnstypes.RecordType) (*dnstypes.Record, error) {
+	records, err := this.QueryRecords(domain, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 {
+		return records[0], nil
+	}
+	return nil, nil
+}
+
+// QueryRecords 查询多个记录
+func (this *RFC2136Provider) QueryRecords(domain string, name string, recordType dnstypes.RecordType) ([]*dnstypes.Record, error) {
+	if name == "@" {
+		name = ""
+	}
+
+	// 从缓存中读取
+	if this.ProviderId > 0 {
+		records, hasRecords, _ := sharedDomainRecordsCache.QueryDomainRecords(this.ProviderId, domain, name, recordType)
+		if hasRecords { // 有效的搜索
+			return records, nil
+		}
+	}
+
+	records, err := this.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []*dnstypes.Record{}
+	for _, record := range records {
+		if record.Name == name && record.Type == recordType {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// AddRecord 设置记录
+func (this *RFC2136Provider) AddRecord(domain string, newRecord *dnstypes.Record) error {
+	rr, err := this.composeRR(domain, newRecord)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+
+	var msg = &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(domain))
+	msg.Insert([]dns.RR{rr})
+	err = this.exchange(msg)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+
+	newRecord.Value = this.normalizeValue(newRecord.Type, newRecord.Value)
+	newRecord.Id = this.recordId(newRecord)
+	newRecord.TTL = int32(rr.Header().Ttl)
+	if len(newRecord.Route) == 0 {
+		newRecord.Route = RFC2136DefaultRoute
+	}
+
+	// 加入缓存
+	if this.ProviderId > 0 {
+		sharedDomainRecordsCache.AddDomainRecord(this.ProviderId, domain, newRecord)
+	}
+
+	return nil
+}
+
+// UpdateRecord 修改记录
+// 在同一个UPDATE消息中删除旧记录并添加新记录，以保证原子性
+func (this *RFC2136Provider) UpdateRecord(domain string, record *dnstypes.Record, newRecord *dnstypes.Record) error {
+	oldRR, err := this.composeRR(domain, record)
+	if err != nil {
+		return this.WrapError(err, domain, record)
+	}
+	newRR, err := this.composeRR(domain, newRecord)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+
+	var msg = &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(domain))
+	msg.Remove([]dns.RR{oldRR})
+	msg.Insert([]dns.RR{newRR})
+	err = this.exchange(msg)
+	if err != nil {
+		return this.WrapError(err, domain, newRecord)
+	}
+
+	// 删除旧的缓存
+	if this.ProviderId > 0 {
+		sharedDomainRecordsCache.DeleteDomainRecord(this.ProviderId, domain, record.Id)
+	}
+
+	newRecord.Value = this.normalizeValue(newRecord.Type, newRecord.Value)
+	newRecord.Id = this.recordId(newRecord)
+	newRecord.TTL = int32(newRR.Header().Ttl)
+	if len(newRecord.Route) == 0 {
+		newRecord.Route = RFC2136DefaultRoute
+	}
+
+	// 加入新的缓存
+	if this.ProviderId > 0 {
+		sharedDomainRecordsCache.AddDomainRecord(this.ProviderId, domain, newRecord)
+	}
+
+	return nil
+}
+
+// DeleteRecord 删除记录
+func (this *RFC2136Provider) DeleteRecord(domain string, record *dnstypes.Record) error {
+	rr, err := this.composeRR(domain, record)
+	if err != nil {
+		return this.WrapError(err, domain, record)
+	}
+
+	var msg = &dns.Msg{}
+	msg.SetUpdate(dns.Fqdn(domain))
+	msg.Remove([]dns.RR{rr})
+	err = this.exchange(msg)
+	if err != nil {
+		return this.WrapError(err, domain, record)
+	}
+
+	// 删除缓存
+	if this.ProviderId > 0 {
+		sharedDomainRecordsCache.DeleteDomainRecord(this.ProviderId, domain, record.Id)
+	}
+
+	return nil
+}
+
+// DefaultRoute 默认线路
+func (this *RFC2136Provider) DefaultRoute() string {
+	return RFC2136DefaultRoute
+}
+
+// 发送签名的UPDATE消息
+func (this *RFC2136Provider) exchange(msg *dns.Msg) error {
+	msg.SetTsig(this.tsigKeyName, this.tsigAlgorithm, 300, time.Now().Unix())
+
+	var client = &dns.Client{
+		Net:        "tcp",
+		Timeout:    this.timeout,
+		TsigSecret: map[string]string{this.tsigKeyName: this.tsigSecret},
+	}
+	resp, _, err := client.Exchange(msg, this.server)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return errors.New("empty response from server")
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return errors.New("server responded '" + dns.RcodeToString[resp.Rcode] + "'")
+	}
+	return nil
+}
+
+// 根据记录构造RR
+func (this *RFC2136Provider) composeRR(domain string, record *dnstypes.Record) (dns.RR, error) {
+	var fqdn = dns.Fqdn(domain)
+	if len(record.Name) > 0 && record.Name != "@" {
+		fqdn = dns.Fqdn(record.Name + "." + domain)
+	}
+
+	var ttl = record.TTL
+	if ttl <= 0 {
+		ttl = 600
+	}
+	var minTTL = this.MinTTL()
+	if minTTL > 0 && ttl < minTTL {
+		ttl = minTTL
+	}
+
+	var header = dns.RR_Header{
+		Name:   fqdn,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(ttl),
+		Rrtype: 0,
+	}
+
+	switch record.Type {
+	case dnstypes.RecordTypeA:
+		var ip = net.ParseIP(record.Value)
+		if ip == nil || ip.To4() == nil {
+			return nil, errors.New("invalid ipv4 '" + record.Value + "'")
+		}
+		header.Rrtype = dns.TypeA
+		return &dns.A{Hdr: header, A: ip.To4()}, nil
+	case dnstypes.RecordTypeAAAA:
+		var ip = net.ParseIP(record.Value)
+		if ip == nil || ip.To4() != nil {
+			return nil, errors.New("invalid ipv6 '" + record.Value + "'")
+		}
+		header.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: header, AAAA: ip}, nil
+	case dnstypes.RecordTypeCNAME:
+		header.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: header, Target: dns.Fqdn(record.Value)}, nil
+	case dnstypes.RecordTypeTXT:
+		header.Rrtype = dns.TypeTXT
+		return &dns.TXT{Hdr: header, Txt: this.splitTXT(record.Value)}, nil
+	}
+
+	return nil, errors.New("unsupported record type '" + record.Type + "'")
+}
+
+// 将RR转换为记录
+func (this *RFC2136Provider) convertRR(zone string, rr dns.RR) *dnstypes.Record {
+	var header = rr.Header()
+	var name = strings.ToLower(header.Name)
+	zone = strings.ToLower(zone)
+	if name == zone {
+		name = ""
+	} else {
+		name = strings.TrimSuffix(name, "."+zone)
+	}
+
+	var record = &dnstypes.Record{
+		Name:  name,
+		Route: RFC2136DefaultRoute,
+		TTL:   int32(header.Ttl),
+	}
+
+	switch value := rr.(type) {
+	case *dns.A:
+		record.Type = dnstypes.RecordTypeA
+		record.Value = value.A.String()
+	case *dns.AAAA:
+		record.Type = dnstypes.RecordTypeAAAA
+		record.Value = value.AAAA.String()
+	case *dns.CNAME:
+		record.Type = dnstypes.RecordTypeCNAME
+		record.Value = dns.Fqdn(value.Target)
+	case *dns.TXT:
+		record.Type = dnstypes.RecordTypeTXT
+		record.Value = strings.Join(value.Txt, "")
+	default:
+		return nil
+	}
+
+	record.Id = this.recordId(record)
+	return record
+}
+
+// 生成记录ID
+// RFC 2136中的记录没有ID，这里使用记录内容作为ID
+func (this *RFC2136Provider) recordId(record *dnstypes.Record) string {
+	return record.Name + "$" + record.Type + "$" + this.normalizeValue(record.Type, record.Value)
+}
+
+// 规范化记录值，CNAME的目标统一使用完整域名，以便读写时生成的记录ID一致
+func (this *RFC2136Provider) normalizeValue(recordType dnstypes.RecordType, value string) string {
+	if recordType == dnstypes.RecordTypeCNAME {
+		return dns.Fqdn(value)
+	}
+	return value
+}
+
+// TXT单个字符串最长255字节，超出时需要拆分
+func (this *RFC2136Provider) splitTXT(value string) []string {
+	if len(value) <= 255 {
+		return []string{value}
+	}
+	var result = []string{}
+	for len(value) > 255 {
+		result = append(result, value[:255])
+		value = value[255:]
+	}
+	if len(value) > 0 {
+		result = append(result, value)
+	}
+	return result
+}
+
+// 补充默认端口
+func (this *RFC2136Provider) fixAddr(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if len(addr) == 0 {
+		return ""
+	}
+	_, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(53))
+	}
+	return addr
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package dnsclients
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/maps"
+)
+
+func TestRFC2136Provider_Auth(t *testing.T) {
+	var provider = &RFC2136Provider{}
+	err := provider.Auth(maps.Map{
+		"server":        "127.0.0.1",
+		"tsigKeyName":   "edge-key",
+		"tsigSecret":    "c2VjcmV0c2VjcmV0c2VjcmV0",
+		"tsigAlgorithm": "hmac-sha512",
+		"domains":       "example.com\nexample.org.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.server != "127.0.0.1:53" {
+		t.Fatal("unexpected server:", provider.server)
+	}
+	domains, _ := provider.GetDomains()
+	if len(domains) != 2 || domains[1] != "example.org" {
+		t.Fatal("unexpected domains:", domains)
+	}
+
+	err = provider.Auth(maps.Map{
+		"server":        "127.0.0.1",
+		"tsigKeyName":   "edge-key",
+		"tsigSecret":    "c2VjcmV0c2VjcmV0c2VjcmV0",
+		"tsigAlgorithm": "hmac-md5",
+	})
+	if err == nil {
+		t.Fatal("'hmac-md5' should not be supported")
+	}
+	t.Log(err)
+}
+
+func TestRFC2136Provider_MaskParams(t *testing.T) {
+	var params = maps.Map{
+		"tsigSecret": "c2VjcmV0c2VjcmV0c2VjcmV0",
+	}
+	var provider = &RFC2136Provider{}
+	provider.MaskParams(params)
+	if !IsMasked(params.GetString("tsigSecret")) {
+		t.Fatal("secret should be masked")
+	}
+}
+
+func TestRFC2136Provider_ComposeRR(t *testing.T) {
+	var provider = &RFC2136Provider{}
+	provider.SetMinTTL(300)
+	for _, record := range []*dnstypes.Record{
+		{Name: "www", Type: dnstypes.RecordTypeA, Value: "1.2.3.4", TTL: 60},
+		{Name: "", Type: dnstypes.RecordTypeAAAA, Value: "::1"},
+		{Name: "cdn", Type: dnstypes.RecordTypeCNAME, Value: "edge.example.net"},
+		{Name: "_acme-challenge", Type: dnstypes.RecordTypeTXT, Value: "hello"},
+	} {
+		rr, err := provider.composeRR("example.com", record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rr.Header().Ttl < 300 {
+			t.Fatal("ttl should not be less than min ttl")
+		}
+		t.Log(rr.String())
+	}
+}
+
+func TestRFC2136Provider_RecordId(t *testing.T) {
+	var provider = &RFC2136Provider{}
+	var record = &dnstypes.Record{Name: "cdn", Type: dnstypes.RecordTypeCNAME, Value: "edge.example.net"}
+	rr, err := provider.composeRR("example.com", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var readRecord = provider.convertRR("example.com.", rr)
+	if readRecord == nil {
+		t.Fatal("record should not be nil")
+	}
+	if readRecord.Id != provider.recordId(record) {
+		t.Fatal("record id mismatch:", readRecord.Id, provider.recordId(record))
+	}
+}
+
+func TestRFC2136Provider_GetRecords(t *testing.T) {
+	provider, err := testRFC2136Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := provider.GetRecords("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.PrintAsJSON(records, t)
+}
+
+func TestRFC2136Provider_AddRecord(t *testing.T) {
+	provider, err := testRFC2136Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record = &dnstypes.Record{
+		Name:  "test",
+		Type:  dnstypes.RecordTypeA,
+		Value: "192.168.1.100",
+		Route: provider.DefaultRoute(),
+	}
+	err = provider.AddRecord("example.com", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok, id:", record.Id)
+}
+
+func TestRFC2136Provider_UpdateRecord(t *testing.T) {
+	provider, err := testRFC2136Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := provider.QueryRecord("example.com", "test", dnstypes.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil {
+		t.Log("not found")
+		return
+	}
+	var newRecord = record.Clone()
+	newRecord.Value = "192.168.1.101"
+	err = provider.UpdateRecord("example.com", record, newRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func TestRFC2136Provider_DeleteRecord(t *testing.T) {
+	provider, err := testRFC2136Provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := provider.QueryRecords("example.com", "test", dnstypes.RecordTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		err = provider.DeleteRecord("example.com", record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Log("ok")
+}
+
+func testRFC2136Provider() (ProviderInterface, error) {
+	var provider = &RFC2136Provider{}
+	err := provider.Auth(maps.Map{
+		"server":        "127.0.0.1:53",
+		"tsigKeyName":   "edge-key",
+		"tsigSecret":    "c2VjcmV0c2VjcmV0c2VjcmV0",
+		"tsigAlgorithm": "hmac-sha256",
+		"domains":       []string{"example.com"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
@@ -16,6 +16,7 @@ const (
 	ProviderTypeEdgeDNSAPI   ProviderType = "edgeDNSAPI"   // 通过API连接的EdgeDNS
 	ProviderTypeCustomHTTP   ProviderType = "customHTTP"   // 自定义HTTP接口
 	ProviderTypeDNSLA        ProviderType = "dnsla"        // DNSLA
+	ProviderTypeRFC2136      ProviderType = "rfc2136"      // RFC 2136动态更新
 )
 
 // FindAllProviderTypes 所有的服务商类型
@@ -55,6 +56,12 @@ func FindAllProviderTypes() []maps.Map {
 
 	typeMaps = filterTypeMaps(typeMaps)
 
+	typeMaps = append(typeMaps, maps.Map{
+		"name":        "RFC 2136动态更新",
+		"code":        ProviderTypeRFC2136,
+		"description": "通过RFC 2136动态更新（TSIG签名）和AXFR管理自建的BIND、Knot、PowerDNS等DNS服务器。",
+	})
+
 	typeMaps = append(typeMaps, maps.Map{
 		"name":        "自定义HTTP DNS",
 		"code":        ProviderTypeCustomHTTP,
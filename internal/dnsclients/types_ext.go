@@ -30,6 +30,10 @@ func FindProvider(providerType ProviderType, providerId int64) ProviderInterface
 		return &CustomHTTPProvider{
 			ProviderId: providerId,
 		}
+	case ProviderTypeLocalEdgeDNS:
+		return &LocalEdgeDNSProvider{
+			ProviderId: providerId,
+		}
 	case ProviderTypeEdgeDNSAPI:
 		return &EdgeDNSAPIProvider{
 			ProviderId: providerId,
@@ -38,11 +42,19 @@ func FindProvider(providerType ProviderType, providerId int64) ProviderInterface
 		return &DNSLaProvider{
 			ProviderId: providerId,
 		}
+	case ProviderTypeRFC2136:
+		return &RFC2136Provider{
+			ProviderId: providerId,
+		}
 	}
 
 	return nil
 }
 
 func filterTypeMaps(typeMaps []maps.Map) []maps.Map {
-	return typeMaps
+	return append(typeMaps, maps.Map{
+		"name":        "集成EdgeDNS",
+		"code":        ProviderTypeLocalEdgeDNS,
+		"description": "和当前系统集成的EdgeDNS，直接使用本系统中托管的域名和记录。",
+	})
 }
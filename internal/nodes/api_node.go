@@ -27,6 +27,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/goman"
 	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/setup"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
@@ -853,6 +854,9 @@ func (this *APINode) listenSock() error {
 
 // 服务过滤器
 func (this *APINode) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	// 记录调用信息，用于检查子用户权限
+	ctx = rpcutils.WithCall(ctx, info.FullMethod, req)
+
 	if teaconst.Debug {
 		var before = time.Now()
 		var traceCtx = rpc.NewContext(ctx)
@@ -8,6 +8,7 @@ import (
 
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services"
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services/clients"
+	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services/posts"
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services/users"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"google.golang.org/grpc"
@@ -165,6 +166,11 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterHTTPFirewallRuleSetServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		var instance = this.serviceInstance(&services.HTTPFirewallRulePackService{}).(*services.HTTPFirewallRulePackService)
+		pb.RegisterHTTPFirewallRulePackServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		var instance = this.serviceInstance(&services.DBNodeService{}).(*services.DBNodeService)
 		pb.RegisterDBNodeServiceServer(server, instance)
@@ -345,6 +351,41 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterUserAccessKeyServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		var instance = this.serviceInstance(&services.SubUserService{}).(*services.SubUserService)
+		pb.RegisterSubUserServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.OIDCService{}).(*services.OIDCService)
+		pb.RegisterOIDCServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.LDAPService{}).(*services.LDAPService)
+		pb.RegisterLDAPServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.WebAuthnService{}).(*services.WebAuthnService)
+		pb.RegisterWebAuthnServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.LoginAttemptService{}).(*services.LoginAttemptService)
+		pb.RegisterLoginAttemptServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.EmailService{}).(*services.EmailService)
+		pb.RegisterEmailServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&services.SMSService{}).(*services.SMSService)
+		pb.RegisterSMSServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		var instance = this.serviceInstance(&services.SysLockerService{}).(*services.SysLockerService)
 		pb.RegisterSysLockerServiceServer(server, instance)
@@ -385,6 +426,11 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterServerRegionProviderMonthlyStatServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		var instance = this.serviceInstance(&services.ServerRegionASNMonthlyStatService{}).(*services.ServerRegionASNMonthlyStatService)
+		pb.RegisterServerRegionASNMonthlyStatServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		var instance = this.serviceInstance(&clients.FormalClientSystemService{}).(*clients.FormalClientSystemService)
 		pb.RegisterFormalClientSystemServiceServer(server, instance)
@@ -405,6 +451,16 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterClientAgentServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		var instance = this.serviceInstance(&posts.PostCategoryService{}).(*posts.PostCategoryService)
+		pb.RegisterPostCategoryServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		var instance = this.serviceInstance(&posts.PostService{}).(*posts.PostService)
+		pb.RegisterPostServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		var instance = this.serviceInstance(&services.ServerClientSystemMonthlyStatService{}).(*services.ServerClientSystemMonthlyStatService)
 		pb.RegisterServerClientSystemMonthlyStatServiceServer(server, instance)
@@ -420,6 +476,11 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterServerHTTPFirewallDailyStatServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		var instance = this.serviceInstance(&services.ServerHTTPFirewallEventStatService{}).(*services.ServerHTTPFirewallEventStatService)
+		pb.RegisterServerHTTPFirewallEventStatServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		var instance = this.serviceInstance(&services.DNSTaskService{}).(*services.DNSTaskService)
 		pb.RegisterDNSTaskServiceServer(server, instance)
@@ -536,6 +597,12 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		this.rest(instance)
 	}
 
+	{
+		var instance = this.serviceInstance(&services.NSDNSSECService{}).(*services.NSDNSSECService)
+		pb.RegisterNSDNSSECServiceServer(server, instance)
+		this.rest(instance)
+	}
+
 	APINodeServicesRegister(this, server)
 
 	// TODO check service names
@@ -0,0 +1,98 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package nodes
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+func init() {
+	dbs.OnReady(func() {
+		goman.New(func() {
+			NewASNLibraryUpdater(10 * time.Minute).Start()
+		})
+	})
+}
+
+// ASNLibraryUpdater 从当前使用的IP库制品中加载ASN数据
+type ASNLibraryUpdater struct {
+	ticker    *time.Ticker
+	asnFileId int64
+}
+
+func NewASNLibraryUpdater(duration time.Duration) *ASNLibraryUpdater {
+	return &ASNLibraryUpdater{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (this *ASNLibraryUpdater) Start() {
+	err := this.Loop()
+	if err != nil {
+		remotelogs.Error("ASN_LIBRARY_UPDATER", err.Error())
+	}
+
+	for range this.ticker.C {
+		err = this.Loop()
+		if err != nil {
+			remotelogs.Error("ASN_LIBRARY_UPDATER", err.Error())
+		}
+	}
+}
+
+func (this *ASNLibraryUpdater) Loop() error {
+	artifact, err := models.SharedIPLibraryArtifactDAO.FindPublicArtifact(nil)
+	if err != nil {
+		return err
+	}
+
+	var asnFileId int64
+	if artifact != nil {
+		asnFileId = int64(artifact.AsnFileId)
+	}
+	if asnFileId == this.asnFileId {
+		return nil
+	}
+
+	if asnFileId <= 0 {
+		iplibraryutils.SetSharedASNLibrary(nil)
+		this.asnFileId = 0
+		return nil
+	}
+
+	var tx *dbs.Tx
+	chunkIds, err := models.SharedFileChunkDAO.FindAllFileChunkIds(tx, asnFileId)
+	if err != nil {
+		return err
+	}
+	var buf = &bytes.Buffer{}
+	for _, chunkId := range chunkIds {
+		chunk, err := models.SharedFileChunkDAO.FindFileChunk(tx, chunkId)
+		if err != nil {
+			return err
+		}
+		if chunk == nil {
+			return errors.New("can not find file chunk with chunk id '" + types.String(chunkId) + "'")
+		}
+		buf.Write(chunk.Data)
+	}
+
+	library, err := iplibraryutils.DecodeASNLibrary(buf)
+	if err != nil {
+		return errors.New("decode asn library failed: " + err.Error())
+	}
+	iplibraryutils.SetSharedASNLibrary(library)
+	this.asnFileId = asnFileId
+
+	remotelogs.Println("ASN_LIBRARY_UPDATER", "loaded "+types.String(library.Len())+" asn ranges")
+	return nil
+}
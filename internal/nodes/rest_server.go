@@ -147,7 +147,8 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 	}
 
 	// 上下文
-	var ctx = context.Background()
+	var ctx context.Context = context.Background()
+	var plainCtx *rpcutils.PlainContext
 
 	if serviceName != "APIAccessTokenService" || (methodName != "GetAPIAccessToken" && methodName != "getAPIAccessToken") {
 		// 校验TOKEN
@@ -184,9 +185,10 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 		}
 
 		if accessToken.UserId > 0 {
-			ctx = rpcutils.NewPlainContext("user", int64(accessToken.UserId))
+			plainCtx = rpcutils.NewPlainContext("user", int64(accessToken.UserId))
+			plainCtx.SubUserId = int64(accessToken.SubUserId)
 		} else if accessToken.AdminId > 0 {
-			ctx = rpcutils.NewPlainContext("admin", int64(accessToken.AdminId))
+			plainCtx = rpcutils.NewPlainContext("admin", int64(accessToken.AdminId))
 		} else {
 			// TODO 支持更多类型的角色
 			this.writeJSON(writer, maps.Map{
@@ -196,6 +198,8 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 			}, shouldPretty)
 			return
 		}
+		plainCtx.Method = serviceName + "/" + methodName
+		ctx = plainCtx
 	}
 
 	// TODO 可以设置最大可接收内容尺寸
@@ -228,6 +232,10 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if plainCtx != nil {
+		plainCtx.Request = reqValue
+	}
+
 	var result = method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(reqValue)})
 	var resultErr = result[1].Interface()
 	if resultErr != nil {
@@ -0,0 +1,375 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package posts
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/posts"
+	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+// PostService 文章服务
+type PostService struct {
+	services.BaseService
+}
+
+// CreatePost 创建文章，创建后为草稿状态
+func (this *PostService) CreatePost(ctx context.Context, req *pb.CreatePostRequest) (*pb.CreatePostResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = this.checkPost(tx, req.PostCategoryId, req.Type, req.Url, req.Subject, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	postId, err := posts.SharedPostDAO.CreatePost(tx, adminId, req.PostCategoryId, req.ProductCode, req.Type, req.Url, req.Subject, req.Body, req.IsPinned, &posts.PostAudience{
+		Type:         req.AudienceType,
+		ClusterIds:   req.AudienceClusterIds,
+		FeatureCodes: req.AudienceFeatureCodes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreatePostResponse{PostId: postId}, nil
+}
+
+// UpdatePost 修改文章
+func (this *PostService) UpdatePost(ctx context.Context, req *pb.UpdatePostRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = this.checkPost(tx, req.PostCategoryId, req.Type, req.Url, req.Subject, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = posts.SharedPostDAO.UpdatePost(tx, req.PostId, req.PostCategoryId, req.ProductCode, req.Type, req.Url, req.Subject, req.Body, req.IsPinned, &posts.PostAudience{
+		Type:         req.AudienceType,
+		ClusterIds:   req.AudienceClusterIds,
+		FeatureCodes: req.AudienceFeatureCodes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DeletePost 删除文章
+func (this *PostService) DeletePost(ctx context.Context, req *pb.DeletePostRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostDAO.DisablePost(tx, req.PostId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// PublishPost 发布文章
+// publishAt 小于等于0时表示立即发布，大于当前时间时表示定时发布
+func (this *PostService) PublishPost(ctx context.Context, req *pb.PublishPostRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostDAO.PublishPost(tx, req.PostId, req.PublishAt)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// UnpublishPost 取消发布
+func (this *PostService) UnpublishPost(ctx context.Context, req *pb.UnpublishPostRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostDAO.UnpublishPost(tx, req.PostId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// UpdatePostIsPinned 设置文章是否置顶
+func (this *PostService) UpdatePostIsPinned(ctx context.Context, req *pb.UpdatePostIsPinnedRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostDAO.UpdatePostIsPinned(tx, req.PostId, req.IsPinned)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// CountPosts 计算文章数量
+func (this *PostService) CountPosts(ctx context.Context, req *pb.CountPostsRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := posts.SharedPostDAO.CountPosts(tx, req.PostCategoryId, req.ProductCode, req.Status, req.Keyword)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListPosts 列出单页文章
+func (this *PostService) ListPosts(ctx context.Context, req *pb.ListPostsRequest) (*pb.ListPostsResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	postList, err := posts.SharedPostDAO.ListPosts(tx, req.PostCategoryId, req.ProductCode, req.Status, req.Keyword, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbPosts = []*pb.Post{}
+	var categoryMap = map[int64]*pb.PostCategory{} // categoryId => *pb.PostCategory
+	for _, post := range postList {
+		pbPost, err := this.convertPost(tx, post, categoryMap, false)
+		if err != nil {
+			return nil, err
+		}
+		pbPosts = append(pbPosts, pbPost)
+	}
+	return &pb.ListPostsResponse{Posts: pbPosts}, nil
+}
+
+// FindPost 查询单篇文章
+func (this *PostService) FindPost(ctx context.Context, req *pb.FindPostRequest) (*pb.FindPostResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	post, err := posts.SharedPostDAO.FindEnabledPost(tx, req.PostId)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return &pb.FindPostResponse{Post: nil}, nil
+	}
+	pbPost, err := this.convertPost(tx, post, map[int64]*pb.PostCategory{}, false)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindPostResponse{Post: pbPost}, nil
+}
+
+// CountPublishedPosts 计算当前用户可以看到的已发布文章数量
+func (this *PostService) CountPublishedPosts(ctx context.Context, req *pb.CountPublishedPostsRequest) (*pb.RPCCountResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := posts.SharedPostDAO.CountPublishedPostsForUser(tx, userId, req.PostCategoryId, req.ProductCode)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListPublishedPosts 列出当前用户可以看到的单页已发布文章
+func (this *PostService) ListPublishedPosts(ctx context.Context, req *pb.ListPublishedPostsRequest) (*pb.ListPublishedPostsResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	postList, err := posts.SharedPostDAO.ListPublishedPostsForUser(tx, userId, req.PostCategoryId, req.ProductCode, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var postIds = []int64{}
+	for _, post := range postList {
+		postIds = append(postIds, int64(post.Id))
+	}
+	readMap, err := posts.SharedPostReadDAO.FindReadPostIds(tx, userId, postIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbPosts = []*pb.Post{}
+	var categoryMap = map[int64]*pb.PostCategory{} // categoryId => *pb.PostCategory
+	for _, post := range postList {
+		pbPost, err := this.convertPost(tx, post, categoryMap, true)
+		if err != nil {
+			return nil, err
+		}
+		pbPost.IsRead = readMap[int64(post.Id)]
+		pbPosts = append(pbPosts, pbPost)
+	}
+	return &pb.ListPublishedPostsResponse{Posts: pbPosts}, nil
+}
+
+// ReadPost 阅读文章，并将其设置为已读
+func (this *PostService) ReadPost(ctx context.Context, req *pb.ReadPostRequest) (*pb.ReadPostResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	post, err := posts.SharedPostDAO.FindPublishedPostForUser(tx, userId, req.PostId)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return &pb.ReadPostResponse{Post: nil}, nil
+	}
+
+	err = posts.SharedPostReadDAO.MarkRead(tx, userId, int64(post.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	pbPost, err := this.convertPost(tx, post, map[int64]*pb.PostCategory{}, true)
+	if err != nil {
+		return nil, err
+	}
+	pbPost.IsRead = true
+	return &pb.ReadPostResponse{Post: pbPost}, nil
+}
+
+// CountUnreadPosts 计算当前用户未读的文章数量
+func (this *PostService) CountUnreadPosts(ctx context.Context, req *pb.CountUnreadPostsRequest) (*pb.RPCCountResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := posts.SharedPostDAO.CountUnreadPostsForUser(tx, userId, req.PostCategoryId, req.ProductCode)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// MarkAllPostsRead 将当前用户所有文章设置为已读
+func (this *PostService) MarkAllPostsRead(ctx context.Context, req *pb.MarkAllPostsReadRequest) (*pb.RPCSuccess, error) {
+	userId, err := this.ValidateUserNode(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostDAO.MarkAllPostsReadForUser(tx, userId, req.PostCategoryId, req.ProductCode)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// 检查文章参数
+func (this *PostService) checkPost(tx *dbs.Tx, categoryId int64, postType string, url string, subject string, body string) error {
+	if len(strings.TrimSpace(subject)) == 0 {
+		return errors.New("'subject' should not be empty")
+	}
+
+	switch postType {
+	case posts.PostTypeNormal:
+		if len(strings.TrimSpace(body)) == 0 {
+			return errors.New("'body' should not be empty")
+		}
+	case posts.PostTypeURL:
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return errors.New("'url' should start with 'http://' or 'https://'")
+		}
+	default:
+		return errors.New("invalid post type '" + postType + "'")
+	}
+
+	if categoryId > 0 {
+		category, err := posts.SharedPostCategoryDAO.FindEnabledPostCategory(tx, categoryId)
+		if err != nil {
+			return err
+		}
+		if category == nil {
+			return errors.New("can not find category with id '" + types.String(categoryId) + "'")
+		}
+	}
+	return nil
+}
+
+// 转换文章对象
+// forUser 为 true 时不返回目标用户等管理信息
+func (this *PostService) convertPost(tx *dbs.Tx, post *posts.Post, categoryMap map[int64]*pb.PostCategory, forUser bool) (*pb.Post, error) {
+	var categoryId = int64(post.CategoryId)
+	var pbCategory *pb.PostCategory
+	if categoryId > 0 {
+		cachedCategory, ok := categoryMap[categoryId]
+		if ok {
+			pbCategory = cachedCategory
+		} else {
+			category, err := posts.SharedPostCategoryDAO.FindEnabledPostCategory(tx, categoryId)
+			if err != nil {
+				return nil, err
+			}
+			if category != nil {
+				pbCategory = convertPostCategory(category)
+			}
+			categoryMap[categoryId] = pbCategory
+		}
+	}
+
+	var pbPost = &pb.Post{
+		Id:           int64(post.Id),
+		PostCategory: pbCategory,
+		ProductCode:  post.ProductCode,
+		Type:         post.Type,
+		Url:          post.Url,
+		Subject:      post.Subject,
+		Body:         post.Body,
+		IsPinned:     post.IsPinned,
+		PublishedAt:  int64(post.PublishedAt),
+		CreatedAt:    int64(post.CreatedAt),
+	}
+	if !forUser {
+		var audience = post.DecodeAudience()
+		pbPost.IsPublished = post.IsPublished
+		pbPost.Status = post.Status()
+		pbPost.UpdatedAt = int64(post.UpdatedAt)
+		pbPost.AudienceType = audience.Type
+		pbPost.AudienceClusterIds = audience.ClusterIds
+		pbPost.AudienceFeatureCodes = audience.FeatureCodes
+	}
+	return pbPost, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package posts
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/posts"
+	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+)
+
+// PostCategoryService 文章分类服务
+type PostCategoryService struct {
+	services.BaseService
+}
+
+// CreatePostCategory 创建分类
+func (this *PostCategoryService) CreatePostCategory(ctx context.Context, req *pb.CreatePostCategoryRequest) (*pb.CreatePostCategoryResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var name = strings.TrimSpace(req.Name)
+	if len(name) == 0 {
+		return nil, errors.New("'name' should not be empty")
+	}
+
+	var tx = this.NullTx()
+	var code = strings.TrimSpace(req.Code)
+	if len(code) > 0 {
+		exists, err := posts.SharedPostCategoryDAO.ExistCategoryCode(tx, code, 0)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errors.New("category code '" + code + "' already exists")
+		}
+	}
+
+	categoryId, err := posts.SharedPostCategoryDAO.CreateCategory(tx, name, code)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreatePostCategoryResponse{PostCategoryId: categoryId}, nil
+}
+
+// UpdatePostCategory 修改分类
+func (this *PostCategoryService) UpdatePostCategory(ctx context.Context, req *pb.UpdatePostCategoryRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var name = strings.TrimSpace(req.Name)
+	if len(name) == 0 {
+		return nil, errors.New("'name' should not be empty")
+	}
+
+	var tx = this.NullTx()
+	var code = strings.TrimSpace(req.Code)
+	if len(code) > 0 {
+		exists, err := posts.SharedPostCategoryDAO.ExistCategoryCode(tx, code, req.PostCategoryId)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errors.New("category code '" + code + "' already exists")
+		}
+	}
+
+	err = posts.SharedPostCategoryDAO.UpdateCategory(tx, req.PostCategoryId, name, code, req.IsOn)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DeletePostCategory 删除分类
+func (this *PostCategoryService) DeletePostCategory(ctx context.Context, req *pb.DeletePostCategoryRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostCategoryDAO.DisablePostCategory(tx, req.PostCategoryId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindAllPostCategories 列出所有分类
+func (this *PostCategoryService) FindAllPostCategories(ctx context.Context, req *pb.FindAllPostCategoriesRequest) (*pb.FindAllPostCategoriesResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	categories, err := posts.SharedPostCategoryDAO.FindAllPostCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+	var pbCategories = []*pb.PostCategory{}
+	for _, category := range categories {
+		pbCategories = append(pbCategories, convertPostCategory(category))
+	}
+	return &pb.FindAllPostCategoriesResponse{PostCategories: pbCategories}, nil
+}
+
+// FindAllAvailablePostCategories 列出所有可用分类
+func (this *PostCategoryService) FindAllAvailablePostCategories(ctx context.Context, req *pb.FindAllAvailablePostCategoriesRequest) (*pb.FindAllAvailablePostCategoriesResponse, error) {
+	_, _, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	categories, err := posts.SharedPostCategoryDAO.FindAllAvailablePostCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+	var pbCategories = []*pb.PostCategory{}
+	for _, category := range categories {
+		pbCategories = append(pbCategories, convertPostCategory(category))
+	}
+	return &pb.FindAllAvailablePostCategoriesResponse{PostCategories: pbCategories}, nil
+}
+
+// FindPostCategory 查找单个分类
+func (this *PostCategoryService) FindPostCategory(ctx context.Context, req *pb.FindPostCategoryRequest) (*pb.FindPostCategoryResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	category, err := posts.SharedPostCategoryDAO.FindEnabledPostCategory(tx, req.PostCategoryId)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return &pb.FindPostCategoryResponse{PostCategory: nil}, nil
+	}
+	return &pb.FindPostCategoryResponse{PostCategory: convertPostCategory(category)}, nil
+}
+
+// SortPostCategories 对分类进行排序
+func (this *PostCategoryService) SortPostCategories(ctx context.Context, req *pb.SortPostCategoriesRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = posts.SharedPostCategoryDAO.UpdateCategoryOrders(tx, req.PostCategoryIds)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+func convertPostCategory(category *posts.PostCategory) *pb.PostCategory {
+	return &pb.PostCategory{
+		Id:   int64(category.Id),
+		Name: category.Name,
+		Code: category.Code,
+		IsOn: category.IsOn,
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/tasks"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/systemconfigs"
@@ -42,6 +43,19 @@ func (this *AdminService) LoginAdmin(ctx context.Context, req *pb.LoginAdminRequ
 
 	var tx = this.NullTx()
 
+	// 检查登录失败次数
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckLogin(tx, models.LoginAttemptRoleAdmin, req.Username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return &pb.LoginAdminResponse{
+			AdminId: 0,
+			IsOk:    false,
+			Message: passwordutils.RetryMessage(retryAfter),
+		}, nil
+	}
+
 	adminId, err := models.SharedAdminDAO.CheckAdminPassword(tx, req.Username, req.Password)
 	if err != nil {
 		utils.PrintError(err)
@@ -49,6 +63,11 @@ func (this *AdminService) LoginAdmin(ctx context.Context, req *pb.LoginAdminRequ
 	}
 
 	if adminId <= 0 {
+		err = models.SharedLoginAttemptDAO.RecordLoginFailure(tx, models.LoginAttemptRoleAdmin, req.Username, req.Ip)
+		if err != nil {
+			return nil, err
+		}
+
 		return &pb.LoginAdminResponse{
 			AdminId: 0,
 			IsOk:    false,
@@ -56,6 +75,28 @@ func (this *AdminService) LoginAdmin(ctx context.Context, req *pb.LoginAdminRequ
 		}, nil
 	}
 
+	// 启用LDAP登录后，绑定了LDAP用户的管理员只能使用LDAP密码登录
+	ldapConfig, err := models.SharedLoginDAO.ReadLDAPConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	ldapLogin, err := models.SharedLoginDAO.FindEnabledLoginWithType(tx, adminId, 0, models.LoginTypeLDAP)
+	if err != nil {
+		return nil, err
+	}
+	if ldapConfig.IsOn && ldapLogin != nil && ldapLogin.IsOn {
+		return &pb.LoginAdminResponse{
+			AdminId: 0,
+			IsOk:    false,
+			Message: "当前账号已绑定LDAP用户，请使用LDAP密码登录",
+		}, nil
+	}
+
+	err = models.SharedLoginAttemptDAO.RecordPasswordSuccess(tx, models.LoginAttemptRoleAdmin, req.Username, adminId, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	return &pb.LoginAdminResponse{
 		AdminId: adminId,
 		IsOk:    true,
@@ -360,6 +401,12 @@ func (this *AdminService) CreateAdmin(ctx context.Context, req *pb.CreateAdminRe
 
 	var tx = this.NullTx()
 
+	// 检查密码是否符合登录安全策略
+	err = models.SharedLoginDAO.CheckNewPassword(tx, 0, 0, req.Username, "", req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	adminId, err := models.SharedAdminDAO.CreateAdmin(tx, req.Username, req.CanLogin, req.Password, req.Fullname, req.IsSuper, req.ModulesJSON)
 	if err != nil {
 		return nil, err
@@ -585,7 +632,7 @@ func (this *AdminService) ComposeAdminDashboard(ctx context.Context, req *pb.Com
 	result.CountServers = countServers
 
 	this.BeginTag(ctx, "SharedServerDAO.CountAllEnabledServersMatch")
-	countAuditingServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", 0, 0, configutils.BoolStateYes, nil, 0)
+	countAuditingServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", 0, 0, configutils.BoolStateYes, nil, 0, nil)
 	this.EndTag(ctx, "SharedServerDAO.CountAllEnabledServersMatch")
 	if err != nil {
 		return nil, err
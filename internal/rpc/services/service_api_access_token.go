@@ -35,11 +35,21 @@ func (this *APIAccessTokenService) GetAPIAccessToken(ctx context.Context, req *p
 	// 检查数据
 	switch req.Type {
 	case "user":
-		// TODO 将来支持子用户
 		if accessKey.UserId == 0 {
 			return nil, errors.New("access key not found")
 		}
 
+		// 检查子用户状态
+		if accessKey.SubUserId > 0 {
+			subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(tx, int64(accessKey.SubUserId))
+			if err != nil {
+				return nil, err
+			}
+			if subUser == nil || !subUser.IsOn || subUser.UserId != accessKey.UserId {
+				return nil, errors.New("the sub user is not available")
+			}
+		}
+
 		// 检查用户状态
 		user, err := models.SharedUserDAO.FindEnabledUser(tx, int64(accessKey.UserId), nil)
 		if err != nil {
@@ -72,7 +82,7 @@ func (this *APIAccessTokenService) GetAPIAccessToken(ctx context.Context, req *p
 	}
 
 	// 创建AccessToken
-	token, expiresAt, err := models.SharedAPIAccessTokenDAO.GenerateAccessToken(tx, int64(accessKey.AdminId), int64(accessKey.UserId))
+	token, expiresAt, err := models.SharedAPIAccessTokenDAO.GenerateAccessToken(tx, int64(accessKey.AdminId), int64(accessKey.UserId), int64(accessKey.SubUserId))
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +69,14 @@ func (this *BaseService) ValidateAdminAndUser(ctx context.Context, canRest bool)
 		return
 	}
 
+	// 检查子用户权限
+	if userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return
+		}
+	}
+
 	return
 }
 
@@ -93,6 +101,14 @@ func (this *BaseService) ValidateUserNode(ctx context.Context, canRest bool) (us
 	}
 
 	_, _, userId, err = rpcutils.ValidateRequest(ctx, rpcutils.UserTypeUser)
+	if err != nil {
+		return
+	}
+
+	// 检查子用户权限
+	if userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+	}
 	return
 }
 
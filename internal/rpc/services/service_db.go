@@ -2,9 +2,14 @@ package services
 
 import (
 	"context"
+	"io"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/setup"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/lists"
@@ -103,3 +108,238 @@ func (this *DBService) TruncateDBTable(ctx context.Context, req *pb.TruncateDBTa
 	}
 	return this.Success()
 }
+
+// 备份文件名只允许包含字母、数字和少量符号，防止访问备份目录之外的文件
+var dbBackupFilenameReg = regexp.MustCompile(`^[\w.-]+\.tar\.gz$`)
+
+// 每次下载备份文件的最大尺寸
+const dbBackupMaxChunkSize = 4 << 20
+
+// CreateDBBackup 创建数据库备份
+func (this *DBService) CreateDBBackup(ctx context.Context, req *pb.CreateDBBackupRequest) (*pb.CreateDBBackupResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbs.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := setup.MakeSQLBackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var filename = setup.SQLBackupFilename()
+	var tmpPath = dir + "/" + filename + ".tmp"
+	fp, err := setup.CreateSQLBackupFile(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := setup.NewSQLBackup(db).Backup(fp, &setup.SQLBackupOptions{
+		ExcludeStats:  req.ExcludeStats,
+		ExcludeLogs:   req.ExcludeLogs,
+		ExcludeTables: req.ExcludeTables,
+	})
+	_ = fp.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+	err = os.Rename(tmpPath, dir+"/"+filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pbBackup, err := this.composeDBBackup(filename, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateDBBackupResponse{DbBackup: pbBackup}, nil
+}
+
+// FindAllDBBackups 列出所有数据库备份
+func (this *DBService) FindAllDBBackups(ctx context.Context, req *pb.FindAllDBBackupsRequest) (*pb.FindAllDBBackupsResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbBackups = []*pb.DBBackup{}
+	entries, err := os.ReadDir(setup.SQLBackupDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &pb.FindAllDBBackupsResponse{DbBackups: pbBackups}, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !dbBackupFilenameReg.MatchString(entry.Name()) {
+			continue
+		}
+		manifest, err := this.readDBBackupManifest(entry.Name())
+		if err != nil {
+			// 跳过无法识别的文件
+			continue
+		}
+		pbBackup, err := this.composeDBBackup(entry.Name(), manifest)
+		if err != nil {
+			return nil, err
+		}
+		pbBackups = append(pbBackups, pbBackup)
+	}
+
+	// 最新的在前
+	sort.Slice(pbBackups, func(i, j int) bool {
+		return pbBackups[i].CreatedAt > pbBackups[j].CreatedAt
+	})
+
+	return &pb.FindAllDBBackupsResponse{DbBackups: pbBackups}, nil
+}
+
+// DownloadDBBackup 分段下载数据库备份文件
+func (this *DBService) DownloadDBBackup(ctx context.Context, req *pb.DownloadDBBackupRequest) (*pb.DownloadDBBackupResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := this.findDBBackupPath(req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var size = req.Size
+	if size <= 0 || size > dbBackupMaxChunkSize {
+		size = dbBackupMaxChunkSize
+	}
+	if req.Offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	stat, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var data = make([]byte, size)
+	n, err := fp.ReadAt(data, req.Offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &pb.DownloadDBBackupResponse{
+		Data:       data[:n],
+		TotalSize:  stat.Size(),
+		IsFinished: req.Offset+int64(n) >= stat.Size(),
+	}, nil
+}
+
+// RestoreDBBackup 从备份恢复数据库
+// 如果备份的版本比当前版本旧，恢复后会自动升级
+func (this *DBService) RestoreDBBackup(ctx context.Context, req *pb.RestoreDBBackupRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := this.findDBBackupPath(req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbs.Default()
+	if err != nil {
+		return nil, err
+	}
+	dbConfig, err := db.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = setup.NewSQLExecutor(dbConfig).Restore(path)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DeleteDBBackup 删除数据库备份
+func (this *DBService) DeleteDBBackup(ctx context.Context, req *pb.DeleteDBBackupRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := this.findDBBackupPath(req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// 检查并获取备份文件路径
+func (this *DBService) findDBBackupPath(filename string) (string, error) {
+	if !dbBackupFilenameReg.MatchString(filename) {
+		return "", errors.New("invalid backup filename '" + filename + "'")
+	}
+	var path = setup.SQLBackupDir() + "/" + filename
+	_, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("backup file '" + filename + "' not found")
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+func (this *DBService) readDBBackupManifest(filename string) (*setup.SQLBackupManifest, error) {
+	fp, err := os.Open(setup.SQLBackupDir() + "/" + filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	return setup.NewSQLBackup(nil).ReadManifest(fp)
+}
+
+func (this *DBService) composeDBBackup(filename string, manifest *setup.SQLBackupManifest) (*pb.DBBackup, error) {
+	stat, err := os.Stat(setup.SQLBackupDir() + "/" + filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var tableNames = []string{}
+	for _, table := range manifest.Tables {
+		tableNames = append(tableNames, table.Name)
+	}
+
+	return &pb.DBBackup{
+		Filename:       filename,
+		Size:           stat.Size(),
+		Version:        manifest.Version,
+		CreatedAt:      manifest.CreatedAt,
+		CountRows:      manifest.CountRows(),
+		TableNames:     tableNames,
+		ExcludedTables: manifest.ExcludedTables,
+		IsOlder:        manifest.IsOlder(),
+	}, nil
+}
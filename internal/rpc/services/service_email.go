@@ -0,0 +1,423 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+// 同一个用户或邮箱两次发送邮件的最小间隔
+const emailSendIntervalSeconds = 60
+
+var errInvalidVerifyCode = errors.New("invalid verify code")
+
+// EmailService 邮件发送相关服务
+type EmailService struct {
+	BaseService
+}
+
+// ReadEmailConfig 读取邮件发送设置
+func (this *EmailService) ReadEmailConfig(ctx context.Context, req *pb.ReadEmailConfigRequest) (*pb.ReadEmailConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedUserEmailNotificationDAO.ReadEmailConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不返回SMTP密码
+	config.Password = ""
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadEmailConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateEmailConfig 修改邮件发送设置
+func (this *EmailService) UpdateEmailConfig(ctx context.Context, req *pb.UpdateEmailConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedUserEmailNotificationDAO.UpdateEmailConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// SendTestEmail 使用邮件发送设置直接发送一封测试邮件，不经过发送队列
+func (this *EmailService) SendTestEmail(ctx context.Context, req *pb.SendTestEmailRequest) (*pb.SendTestEmailResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+	config.IsOn = true
+	err = config.Init()
+	if err != nil {
+		return &pb.SendTestEmailResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	var lang = mailutils.DefaultLang
+	admin, err := models.SharedAdminDAO.FindEnabledAdmin(this.NullTx(), adminId)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil && len(admin.Lang) > 0 {
+		lang = admin.Lang
+	}
+
+	message, err := config.FindTemplate(mailutils.TemplateTest, lang).Render(strings.TrimSpace(req.Email), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = message.Validate()
+	if err != nil {
+		return &pb.SendTestEmailResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	sender, err := mailutils.NewSender(config)
+	if err != nil {
+		return nil, err
+	}
+	err = sender.Send(message)
+	if err != nil {
+		return &pb.SendTestEmailResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+	return &pb.SendTestEmailResponse{IsOk: true}, nil
+}
+
+// CountEmailNotifications 计算邮件队列中的邮件数量
+func (this *EmailService) CountEmailNotifications(ctx context.Context, req *pb.CountEmailNotificationsRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedUserEmailNotificationDAO.CountNotifications(tx, req.State, req.UserId, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListEmailNotifications 列出单页邮件队列中的邮件
+func (this *EmailService) ListEmailNotifications(ctx context.Context, req *pb.ListEmailNotificationsRequest) (*pb.ListEmailNotificationsResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	notifications, err := models.SharedUserEmailNotificationDAO.ListNotifications(tx, req.State, req.UserId, req.Email, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbNotifications = []*pb.EmailNotification{}
+	for _, notification := range notifications {
+		pbNotifications = append(pbNotifications, &pb.EmailNotification{
+			Id:         int64(notification.Id),
+			UserId:     int64(notification.UserId),
+			Email:      notification.Email,
+			Subject:    notification.Subject,
+			Body:       notification.Body,
+			IsHTML:     notification.IsHTML,
+			IsSent:     notification.IsSent,
+			IsFailed:   notification.IsFailed,
+			CountTries: types.Int32(notification.CountTries),
+			NextTryAt:  int64(notification.NextTryAt),
+			SentAt:     int64(notification.SentAt),
+			Error:      notification.Error,
+			CreatedAt:  int64(notification.CreatedAt),
+		})
+	}
+	return &pb.ListEmailNotificationsResponse{EmailNotifications: pbNotifications}, nil
+}
+
+// RetryEmailNotification 重新发送已放弃的邮件
+func (this *EmailService) RetryEmailNotification(ctx context.Context, req *pb.RetryEmailNotificationRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedUserEmailNotificationDAO.RetryNotification(tx, req.EmailNotificationId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// SendUserEmailVerification 发送邮箱验证邮件给当前用户
+func (this *EmailService) SendUserEmailVerification(ctx context.Context, req *pb.SendUserEmailVerificationRequest) (*pb.SendUserEmailVerificationResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId <= 0 {
+		return nil, this.PermissionError()
+	}
+
+	var email = strings.TrimSpace(req.Email)
+	if !utils.ValidateEmail(email) {
+		return &pb.SendUserEmailVerificationResponse{
+			IsOk:    false,
+			Message: "请输入正确的邮箱地址",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+
+	// 检查邮箱是否已被使用
+	emailUserId, err := models.SharedUserDAO.FindUserIdWithVerifiedEmail(tx, email)
+	if err != nil {
+		return nil, err
+	}
+	if emailUserId > 0 && emailUserId != userId {
+		return &pb.SendUserEmailVerificationResponse{
+			IsOk:    false,
+			Message: "此邮箱已被其他用户使用",
+		}, nil
+	}
+
+	countRecent, err := models.SharedUserEmailVerificationDAO.CountRecentVerifications(tx, userId, emailSendIntervalSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if countRecent > 0 {
+		return &pb.SendUserEmailVerificationResponse{
+			IsOk:    false,
+			Message: "发送过于频繁，请稍后再试",
+		}, nil
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return models.SharedUserEmailVerificationDAO.CreateVerification(tx, userId, email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SendUserEmailVerificationResponse{IsOk: true}, nil
+}
+
+// VerifyUserEmail 使用邮件中的验证码验证邮箱，用户可以在未登录时验证
+func (this *EmailService) VerifyUserEmail(ctx context.Context, req *pb.VerifyUserEmailRequest) (*pb.VerifyUserEmailResponse, error) {
+	currentUserId, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var userId int64
+	var email string
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		verifiedUserId, verifiedEmail, err := models.SharedUserEmailVerificationDAO.VerifyEmail(tx, strings.TrimSpace(req.Code))
+		if err != nil {
+			return err
+		}
+
+		// 已登录时只能验证自己的邮箱
+		if verifiedUserId > 0 && currentUserId > 0 && verifiedUserId != currentUserId {
+			return errInvalidVerifyCode
+		}
+		userId = verifiedUserId
+		email = verifiedEmail
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailIsUsed):
+			return &pb.VerifyUserEmailResponse{
+				IsOk:    false,
+				Message: "此邮箱已被其他用户使用",
+			}, nil
+		case errors.Is(err, errInvalidVerifyCode):
+			userId = 0
+		default:
+			return nil, err
+		}
+	}
+	if userId <= 0 {
+		return &pb.VerifyUserEmailResponse{
+			IsOk:    false,
+			Message: "验证链接无效或者已过期，请重新发送验证邮件",
+		}, nil
+	}
+
+	return &pb.VerifyUserEmailResponse{
+		IsOk:   true,
+		UserId: userId,
+		Email:  email,
+	}, nil
+}
+
+// SendUserResetPasswordEmail 发送重置密码邮件
+// 为了避免泄露用户信息，邮箱不存在时也返回成功
+func (this *EmailService) SendUserResetPasswordEmail(ctx context.Context, req *pb.SendUserResetPasswordEmailRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var email = strings.TrimSpace(req.Email)
+	if !utils.ValidateEmail(email) {
+		return this.Success()
+	}
+
+	var tx = this.NullTx()
+	userId, err := models.SharedUserDAO.FindUserIdWithVerifiedEmail(tx, email)
+	if err != nil {
+		return nil, err
+	}
+	if userId <= 0 {
+		return this.Success()
+	}
+
+	countRecent, err := models.SharedUserVerifyCodeDAO.CountRecentCodes(tx, email, "", models.UserVerifyCodeTypeResetPassword, emailSendIntervalSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if countRecent > 0 {
+		return this.Success()
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return models.SharedUserVerifyCodeDAO.CreateResetPasswordEmail(tx, userId, req.Ip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// ResetUserPasswordWithCode 使用重置密码邮件中的验证码设置新密码
+func (this *EmailService) ResetUserPasswordWithCode(ctx context.Context, req *pb.ResetUserPasswordWithCodeRequest) (*pb.ResetUserPasswordWithCodeResponse, error) {
+	_, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var email = strings.TrimSpace(req.Email)
+	if len(req.Password) == 0 {
+		return &pb.ResetUserPasswordWithCodeResponse{
+			IsOk:    false,
+			Message: "请输入新密码",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+	userId, err := models.SharedUserDAO.FindUserIdWithVerifiedEmail(tx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var codeIsValid bool
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		if userId <= 0 {
+			return nil
+		}
+		ok, err := models.SharedUserVerifyCodeDAO.UseCode(tx, email, "", models.UserVerifyCodeTypeResetPassword, strings.TrimSpace(req.Code))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 不回滚，以便记录校验失败次数
+			return nil
+		}
+		codeIsValid = true
+
+		// 密码不符合要求时回滚，验证码仍然可以使用
+		return models.SharedUserDAO.UpdateUserPassword(tx, userId, req.Password)
+	})
+	if err == nil && !codeIsValid {
+		return &pb.ResetUserPasswordWithCodeResponse{
+			IsOk:    false,
+			Message: "验证码无效或者已过期，请重新发送重置密码邮件",
+		}, nil
+	}
+	if err != nil {
+		if passwordutils.IsPolicyError(err) {
+			return &pb.ResetUserPasswordWithCodeResponse{
+				IsOk:    false,
+				Message: err.Error(),
+			}, nil
+		}
+		return nil, err
+	}
+
+	// 解除登录锁定
+	user, err := models.SharedUserDAO.FindEnabledBasicUser(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		for _, username := range []string{user.Username, email} {
+			err = models.SharedLoginAttemptDAO.UnlockAccount(tx, models.LoginAttemptRoleUser, username)
+			if err != nil {
+				remotelogs.Error("EmailService", "unlock user '"+username+"' failed: "+err.Error())
+			}
+		}
+	}
+
+	return &pb.ResetUserPasswordWithCodeResponse{
+		IsOk:   true,
+		UserId: userId,
+	}, nil
+}
+
+func (this *EmailService) decodeConfig(configJSON []byte) (*mailutils.Config, error) {
+	var config = mailutils.DefaultConfig()
+	err := json.Unmarshal(configJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	// 没有填写密码时使用已保存的密码，以免在界面上回显密码
+	if len(config.Password) == 0 && len(config.Username) > 0 {
+		oldConfig, err := models.SharedUserEmailNotificationDAO.ReadEmailConfig(this.NullTx())
+		if err == nil && oldConfig.Username == config.Username && oldConfig.Host == config.Host {
+			config.Password = oldConfig.Password
+		}
+	}
+	return config, nil
+}
@@ -7,10 +7,12 @@ import (
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ipconfigs"
+	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/lists"
 )
 
@@ -670,6 +672,214 @@ func (this *HTTPFirewallPolicyService) ImportHTTPFirewallPolicy(ctx context.Cont
 	return this.Success()
 }
 
+// ExportHTTPFirewallPolicyDocument 导出策略文档
+func (this *HTTPFirewallPolicyService) ExportHTTPFirewallPolicyDocument(ctx context.Context, req *pb.ExportHTTPFirewallPolicyDocumentRequest) (*pb.ExportHTTPFirewallPolicyDocumentResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	if userId > 0 {
+		err = models.SharedHTTPFirewallPolicyDAO.CheckUserFirewallPolicy(tx, userId, req.HttpFirewallPolicyId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := models.SharedHTTPFirewallPolicyDAO.ExportFirewallPolicy(tx, req.HttpFirewallPolicyId)
+	if err != nil {
+		return nil, err
+	}
+	documentData, err := models.SharedHTTPFirewallPolicyDAO.EncodeFirewallPolicyDocument(document, req.Format)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExportHTTPFirewallPolicyDocumentResponse{DocumentData: documentData}, nil
+}
+
+// DiffHTTPFirewallPolicyDocument 对比策略文档和已有策略
+func (this *HTTPFirewallPolicyService) DiffHTTPFirewallPolicyDocument(ctx context.Context, req *pb.DiffHTTPFirewallPolicyDocumentRequest) (*pb.DiffHTTPFirewallPolicyDocumentResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	if userId > 0 {
+		err = models.SharedHTTPFirewallPolicyDAO.CheckUserFirewallPolicy(tx, userId, req.HttpFirewallPolicyId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := models.SharedHTTPFirewallPolicyDAO.DecodeFirewallPolicyDocument(req.DocumentData)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := models.SharedHTTPFirewallPolicyDAO.DiffFirewallPolicyDocument(tx, req.HttpFirewallPolicyId, document, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DiffHTTPFirewallPolicyDocumentResponse{HttpFirewallPolicyChanges: this.convertFirewallPolicyChanges(changes)}, nil
+}
+
+// ImportHTTPFirewallPolicyDocument 将策略文档合并或替换到已有策略中
+func (this *HTTPFirewallPolicyService) ImportHTTPFirewallPolicyDocument(ctx context.Context, req *pb.ImportHTTPFirewallPolicyDocumentRequest) (*pb.ImportHTTPFirewallPolicyDocumentResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if userId > 0 {
+		err = models.SharedHTTPFirewallPolicyDAO.CheckUserFirewallPolicy(nil, userId, req.HttpFirewallPolicyId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := models.SharedHTTPFirewallPolicyDAO.DecodeFirewallPolicyDocument(req.DocumentData)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*models.HTTPFirewallPolicyChange
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		changes, err = models.SharedHTTPFirewallPolicyDAO.ImportFirewallPolicyDocument(tx, req.HttpFirewallPolicyId, document, req.Mode)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ImportHTTPFirewallPolicyDocumentResponse{HttpFirewallPolicyChanges: this.convertFirewallPolicyChanges(changes)}, nil
+}
+
+func (this *HTTPFirewallPolicyService) convertFirewallPolicyChanges(changes []*models.HTTPFirewallPolicyChange) []*pb.HTTPFirewallPolicyChange {
+	var pbChanges = []*pb.HTTPFirewallPolicyChange{}
+	for _, change := range changes {
+		pbChanges = append(pbChanges, &pb.HTTPFirewallPolicyChange{
+			Action: change.Action,
+			Kind:   change.Kind,
+			Path:   change.Path,
+			Old:    change.Old,
+			New:    change.New,
+		})
+	}
+	return pbChanges
+}
+
+// SimulateHTTPFirewallPolicy 使用访问日志模拟WAF策略或规则集
+func (this *HTTPFirewallPolicyService) SimulateHTTPFirewallPolicy(ctx context.Context, req *pb.SimulateHTTPFirewallPolicyRequest) (*pb.SimulateHTTPFirewallPolicyResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	if userId > 0 {
+		if req.HttpFirewallPolicyId > 0 {
+			err = models.SharedHTTPFirewallPolicyDAO.CheckUserFirewallPolicy(tx, userId, req.HttpFirewallPolicyId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if req.HttpFirewallRuleSetId > 0 {
+			err = models.SharedHTTPFirewallRuleSetDAO.CheckUserRuleSet(tx, userId, req.HttpFirewallRuleSetId)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if req.ServerId > 0 {
+			err = models.SharedServerDAO.CheckUserServer(tx, userId, req.ServerId)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var options = &models.HTTPFirewallSimulationOptions{
+		PolicyId:    req.HttpFirewallPolicyId,
+		RuleSetId:   req.HttpFirewallRuleSetId,
+		ServerId:    req.ServerId,
+		UserId:      userId,
+		Day:         req.Day,
+		HourFrom:    req.HourFrom,
+		HourTo:      req.HourTo,
+		MaxRequests: int(req.MaxRequests),
+		MaxSamples:  int(req.MaxSamples),
+	}
+	if len(req.HttpFirewallRuleSetJSON) > 0 {
+		var setConfig = &firewallconfigs.HTTPFirewallRuleSet{}
+		err = json.Unmarshal(req.HttpFirewallRuleSetJSON, setConfig)
+		if err != nil {
+			return nil, errors.New("decode rule set failed: " + err.Error())
+		}
+		options.RuleSet = setConfig
+	}
+
+	result, err := models.SharedHTTPFirewallPolicyDAO.SimulateFirewall(tx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbRuleSets = []*pb.SimulateHTTPFirewallPolicyResponse_RuleSet{}
+	for _, setStat := range result.RuleSets {
+		var pbRules = []*pb.SimulateHTTPFirewallPolicyResponse_Rule{}
+		for _, ruleStat := range setStat.Rules {
+			var pbSamples = []*pb.SimulateHTTPFirewallPolicyResponse_Sample{}
+			for _, sample := range ruleStat.Samples {
+				pbSamples = append(pbSamples, &pb.SimulateHTTPFirewallPolicyResponse_Sample{
+					RequestId:  sample.RequestId,
+					ServerId:   sample.ServerId,
+					CreatedAt:  sample.CreatedAt,
+					RemoteAddr: sample.RemoteAddr,
+					Method:     sample.Method,
+					Url:        sample.URL,
+				})
+			}
+			pbRules = append(pbRules, &pb.SimulateHTTPFirewallPolicyResponse_Rule{
+				HttpFirewallRuleId: ruleStat.RuleId,
+				Summary:            ruleStat.Summary,
+				IsSupported:        ruleStat.IsSupported,
+				CountMatched:       ruleStat.CountMatched,
+				Samples:            pbSamples,
+			})
+		}
+		pbRuleSets = append(pbRuleSets, &pb.SimulateHTTPFirewallPolicyResponse_RuleSet{
+			HttpFirewallRuleSetId:   setStat.RuleSetId,
+			Name:                    setStat.RuleSetName,
+			HttpFirewallRuleGroupId: setStat.GroupId,
+			GroupName:               setStat.GroupName,
+			IsBlocking:              setStat.IsBlocking,
+			CountMatched:            setStat.CountMatched,
+			Rules:                   pbRules,
+		})
+	}
+
+	var pbServers = []*pb.SimulateHTTPFirewallPolicyResponse_Server{}
+	for _, serverStat := range result.Servers {
+		pbServers = append(pbServers, &pb.SimulateHTTPFirewallPolicyResponse_Server{
+			ServerId:      serverStat.ServerId,
+			CountRequests: serverStat.CountRequests,
+			CountMatched:  serverStat.CountMatched,
+			CountBlocked:  serverStat.CountBlocked,
+			BlockRate:     float32(serverStat.BlockRate),
+		})
+	}
+
+	return &pb.SimulateHTTPFirewallPolicyResponse{
+		CountRequests: result.CountRequests,
+		CountMatched:  result.CountMatched,
+		CountBlocked:  result.CountBlocked,
+		IsTruncated:   result.IsTruncated,
+		RuleSets:      pbRuleSets,
+		Servers:       pbServers,
+	}, nil
+}
+
 // CheckHTTPFirewallPolicyIPStatus 检查IP状态
 func (this *HTTPFirewallPolicyService) CheckHTTPFirewallPolicyIPStatus(ctx context.Context, req *pb.CheckHTTPFirewallPolicyIPStatusRequest) (*pb.CheckHTTPFirewallPolicyIPStatusResponse, error) {
 	_, userId, err := this.ValidateAdminAndUser(ctx, true)
@@ -932,6 +1142,28 @@ func (this *HTTPFirewallPolicyService) CheckHTTPFirewallPolicyIPStatus(ctx conte
 		}
 	}
 
+	// 检查封禁的ASN
+	if firewallPolicy.Inbound != nil &&
+		firewallPolicy.Inbound.IsOn &&
+		firewallPolicy.Inbound.Region != nil &&
+		firewallPolicy.Inbound.Region.IsOn &&
+		len(firewallPolicy.Inbound.Region.DenyASNs) > 0 {
+		var asn = iplibraryutils.LookupASN(req.Ip)
+		if asn != nil && lists.ContainsInt64(firewallPolicy.Inbound.Region.DenyASNs, int64(asn.Number)) {
+			return &pb.CheckHTTPFirewallPolicyIPStatusResponse{
+				IsOk:           true,
+				Error:          "",
+				IsFound:        true,
+				IsAllowed:      false,
+				IpList:         nil,
+				IpItem:         nil,
+				RegionCountry:  nil,
+				RegionProvince: nil,
+				Asn:            asn.String(),
+			}, nil
+		}
+	}
+
 	return &pb.CheckHTTPFirewallPolicyIPStatusResponse{
 		IsOk:           true,
 		Error:          "",
@@ -0,0 +1,277 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/rulepackutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// HTTPFirewallRulePackService WAF规则包服务
+type HTTPFirewallRulePackService struct {
+	BaseService
+}
+
+// ImportHTTPFirewallRulePack 导入规则包
+// 可以直接上传规则包内容，或者从API节点本地文件、内部镜像中导入
+func (this *HTTPFirewallRulePackService) ImportHTTPFirewallRulePack(ctx context.Context, req *pb.ImportHTTPFirewallRulePackRequest) (*pb.ImportHTTPFirewallRulePackResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	var packId int64
+	switch {
+	case len(req.PackData) > 0:
+		packId, err = models.SharedHTTPFirewallRulePackDAO.ImportRulePack(tx, adminId, req.PackData)
+	case len(req.Path) > 0:
+		packId, err = models.SharedHTTPFirewallRulePackDAO.ImportRulePackFromFile(tx, adminId, req.Path)
+	case len(req.Code) > 0 && len(req.Version) > 0:
+		packId, err = models.SharedHTTPFirewallRulePackDAO.ImportRulePackFromMirror(tx, adminId, req.Code, req.Version)
+	default:
+		return nil, errors.New("'packData', 'path' or 'code' and 'version' should be specified")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ImportHTTPFirewallRulePackResponse{HttpFirewallRulePackId: packId}, nil
+}
+
+// FindAllHTTPFirewallRulePacks 列出所有规则包
+func (this *HTTPFirewallRulePackService) FindAllHTTPFirewallRulePacks(ctx context.Context, req *pb.FindAllHTTPFirewallRulePacksRequest) (*pb.FindAllHTTPFirewallRulePacksResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	packs, err := models.SharedHTTPFirewallRulePackDAO.FindAllEnabledRulePacks(tx, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	var pbPacks = []*pb.HTTPFirewallRulePack{}
+	for _, pack := range packs {
+		pbPacks = append(pbPacks, &pb.HTTPFirewallRulePack{
+			Id:          int64(pack.Id),
+			Code:        pack.Code,
+			Name:        pack.Name,
+			Version:     pack.Version,
+			Description: pack.Description,
+			KeyId:       pack.KeyId,
+			IsSigned:    pack.IsSigned,
+			Digest:      pack.Digest,
+			CreatedAt:   int64(pack.CreatedAt),
+		})
+	}
+	return &pb.FindAllHTTPFirewallRulePacksResponse{HttpFirewallRulePacks: pbPacks}, nil
+}
+
+// DeleteHTTPFirewallRulePack 删除规则包版本
+func (this *HTTPFirewallRulePackService) DeleteHTTPFirewallRulePack(ctx context.Context, req *pb.DeleteHTTPFirewallRulePackRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedHTTPFirewallRulePackDAO.DisableHTTPFirewallRulePack(tx, req.HttpFirewallRulePackId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// ReadHTTPFirewallRulePackConfig 读取规则包设置
+func (this *HTTPFirewallRulePackService) ReadHTTPFirewallRulePackConfig(ctx context.Context, req *pb.ReadHTTPFirewallRulePackConfigRequest) (*pb.ReadHTTPFirewallRulePackConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedHTTPFirewallRulePackDAO.ReadRulePackConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	config.Mask()
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadHTTPFirewallRulePackConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateHTTPFirewallRulePackConfig 修改规则包设置
+func (this *HTTPFirewallRulePackService) UpdateHTTPFirewallRulePackConfig(ctx context.Context, req *pb.UpdateHTTPFirewallRulePackConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var config = rulepackutils.DefaultConfig()
+	err = json.Unmarshal(req.ConfigJSON, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	// 保留没有修改的认证信息
+	oldConfig, err := models.SharedHTTPFirewallRulePackDAO.ReadRulePackConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	config.UnmaskWith(oldConfig)
+
+	err = models.SharedHTTPFirewallRulePackDAO.UpdateRulePackConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// SubscribeHTTPFirewallRulePack 策略订阅规则包
+func (this *HTTPFirewallRulePackService) SubscribeHTTPFirewallRulePack(ctx context.Context, req *pb.SubscribeHTTPFirewallRulePackRequest) (*pb.SubscribeHTTPFirewallRulePackResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptionId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		subscriptionId, err = models.SharedHTTPFirewallRulePackSubscriptionDAO.Subscribe(tx, adminId, req.HttpFirewallPolicyId, req.Code, req.Version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SubscribeHTTPFirewallRulePackResponse{HttpFirewallRulePackSubscriptionId: subscriptionId}, nil
+}
+
+// UnsubscribeHTTPFirewallRulePack 取消订阅，策略中的分组会被保留
+func (this *HTTPFirewallRulePackService) UnsubscribeHTTPFirewallRulePack(ctx context.Context, req *pb.UnsubscribeHTTPFirewallRulePackRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedHTTPFirewallRulePackSubscriptionDAO.DisableSubscription(tx, req.HttpFirewallRulePackSubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindAllHTTPFirewallRulePackSubscriptions 列出策略订阅的规则包
+func (this *HTTPFirewallRulePackService) FindAllHTTPFirewallRulePackSubscriptions(ctx context.Context, req *pb.FindAllHTTPFirewallRulePackSubscriptionsRequest) (*pb.FindAllHTTPFirewallRulePackSubscriptionsResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	subscriptions, err := models.SharedHTTPFirewallRulePackSubscriptionDAO.FindAllEnabledSubscriptionsWithPolicyId(tx, req.HttpFirewallPolicyId)
+	if err != nil {
+		return nil, err
+	}
+	var pbSubscriptions = []*pb.HTTPFirewallRulePackSubscription{}
+	for _, subscription := range subscriptions {
+		// 最新版本
+		var latestVersion = ""
+		latestPack, err := models.SharedHTTPFirewallRulePackDAO.FindLatestRulePack(tx, subscription.PackCode)
+		if err != nil {
+			return nil, err
+		}
+		if latestPack != nil {
+			latestVersion = latestPack.Version
+		}
+
+		pbSubscriptions = append(pbSubscriptions, &pb.HTTPFirewallRulePackSubscription{
+			Id:                       int64(subscription.Id),
+			HttpFirewallPolicyId:     int64(subscription.PolicyId),
+			Code:                     subscription.PackCode,
+			Version:                  subscription.Version,
+			LatestVersion:            latestVersion,
+			HttpFirewallRuleGroupIds: append(subscription.FindGroupIds(true), subscription.FindGroupIds(false)...),
+			CreatedAt:                int64(subscription.CreatedAt),
+			UpdatedAt:                int64(subscription.UpdatedAt),
+		})
+	}
+	return &pb.FindAllHTTPFirewallRulePackSubscriptionsResponse{HttpFirewallRulePackSubscriptions: pbSubscriptions}, nil
+}
+
+// PreviewHTTPFirewallRulePackUpgrade 预览升级规则包后策略的变化
+func (this *HTTPFirewallRulePackService) PreviewHTTPFirewallRulePackUpgrade(ctx context.Context, req *pb.PreviewHTTPFirewallRulePackUpgradeRequest) (*pb.PreviewHTTPFirewallRulePackUpgradeResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	upgrade, err := models.SharedHTTPFirewallRulePackSubscriptionDAO.PreviewUpgrade(tx, req.HttpFirewallRulePackSubscriptionId, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PreviewHTTPFirewallRulePackUpgradeResponse{
+		FromVersion:               upgrade.FromVersion,
+		ToVersion:                 upgrade.ToVersion,
+		HttpFirewallPolicyChanges: this.convertRulePackChanges(upgrade.Changes),
+		Overrides:                 this.convertRulePackOverrides(upgrade.Overrides),
+	}, nil
+}
+
+// UpgradeHTTPFirewallRulePackSubscription 升级规则包，保留策略中的修改
+func (this *HTTPFirewallRulePackService) UpgradeHTTPFirewallRulePackSubscription(ctx context.Context, req *pb.UpgradeHTTPFirewallRulePackSubscriptionRequest) (*pb.UpgradeHTTPFirewallRulePackSubscriptionResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgrade *models.HTTPFirewallRulePackUpgrade
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		upgrade, err = models.SharedHTTPFirewallRulePackSubscriptionDAO.Upgrade(tx, req.HttpFirewallRulePackSubscriptionId, req.Version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpgradeHTTPFirewallRulePackSubscriptionResponse{
+		HttpFirewallPolicyChanges: this.convertRulePackChanges(upgrade.Changes),
+		Overrides:                 this.convertRulePackOverrides(upgrade.Overrides),
+	}, nil
+}
+
+func (this *HTTPFirewallRulePackService) convertRulePackChanges(changes []*models.HTTPFirewallPolicyChange) []*pb.HTTPFirewallPolicyChange {
+	var pbChanges = []*pb.HTTPFirewallPolicyChange{}
+	for _, change := range changes {
+		pbChanges = append(pbChanges, &pb.HTTPFirewallPolicyChange{
+			Action: change.Action,
+			Kind:   change.Kind,
+			Path:   change.Path,
+			Old:    change.Old,
+			New:    change.New,
+		})
+	}
+	return pbChanges
+}
+
+func (this *HTTPFirewallRulePackService) convertRulePackOverrides(overrides []*models.HTTPFirewallRulePackOverride) []*pb.HTTPFirewallRulePackOverride {
+	var pbOverrides = []*pb.HTTPFirewallRulePackOverride{}
+	for _, override := range overrides {
+		pbOverrides = append(pbOverrides, &pb.HTTPFirewallRulePackOverride{
+			Kind:  override.Kind,
+			Path:  override.Path,
+			Field: override.Field,
+			Value: override.Value,
+		})
+	}
+	return pbOverrides
+}
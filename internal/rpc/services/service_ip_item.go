@@ -3,16 +3,19 @@ package services
 import (
 	"context"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipitemutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iputils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/ipconfigs"
+	"github.com/iwind/TeaGo/types"
 )
 
 // IPItemService IP条目相关服务
@@ -28,7 +31,20 @@ func (this *IPItemService) CreateIPItem(ctx context.Context, req *pb.CreateIPIte
 		return nil, err
 	}
 
-	if len(req.Value) > 0 {
+	// 检查子用户权限
+	if userType == rpcutils.UserTypeUser && userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asnValue, isASN := models.SharedIPItemDAO.ParseASNValue(req.Value); isASN {
+		req.Value = asnValue
+		req.IpFrom = ""
+		req.IpTo = ""
+		req.Type = models.IPItemTypeASN
+	} else if len(req.Value) > 0 {
 		newValue, ipFrom, ipTo, ok := models.SharedIPItemDAO.ParseIPValue(req.Value)
 		if !ok {
 			return nil, errors.New("invalid 'value' format")
@@ -95,11 +111,24 @@ func (this *IPItemService) CreateIPItems(ctx context.Context, req *pb.CreateIPIt
 		return nil, err
 	}
 
+	// 检查子用户权限
+	if userType == rpcutils.UserTypeUser && userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var tx = this.NullTx()
 
 	// 校验
 	for _, item := range req.IpItems {
-		if len(item.Value) > 0 {
+		if asnValue, isASN := models.SharedIPItemDAO.ParseASNValue(item.Value); isASN {
+			item.Value = asnValue
+			item.IpFrom = ""
+			item.IpTo = ""
+			item.Type = models.IPItemTypeASN
+		} else if len(item.Value) > 0 {
 			newValue, ipFrom, ipTo, ok := models.SharedIPItemDAO.ParseIPValue(item.Value)
 			if !ok {
 				return nil, errors.New("invalid 'value': " + item.Value)
@@ -180,7 +209,12 @@ func (this *IPItemService) UpdateIPItem(ctx context.Context, req *pb.UpdateIPIte
 	var tx = this.NullTx()
 
 	// validate ip
-	if len(req.Value) > 0 {
+	if asnValue, isASN := models.SharedIPItemDAO.ParseASNValue(req.Value); isASN {
+		req.Value = asnValue
+		req.IpFrom = ""
+		req.IpTo = ""
+		req.Type = models.IPItemTypeASN
+	} else if len(req.Value) > 0 {
 		newValue, ipFrom, ipTo, ok := models.SharedIPItemDAO.ParseIPValue(req.Value)
 		if !ok {
 			return nil, errors.New("invalid 'value' format")
@@ -635,6 +669,142 @@ func (this *IPItemService) CheckIPItemStatus(ctx context.Context, req *pb.CheckI
 	}, nil
 }
 
+// LookupIPItems 在所有生效的名单中查找IP，并给出最终结论
+func (this *IPItemService) LookupIPItems(ctx context.Context, req *pb.LookupIPItemsRequest) (*pb.LookupIPItemsResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验IP
+	var ip = net.ParseIP(req.Ip)
+	if len(ip) == 0 {
+		return &pb.LookupIPItemsResponse{
+			IsOk:  false,
+			Error: "请输入正确的IP",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+
+	if req.ServerId > 0 {
+		serverName, err := models.SharedServerDAO.FindEnabledServerName(tx, req.ServerId)
+		if err != nil {
+			return nil, err
+		}
+		if len(serverName) == 0 {
+			return &pb.LookupIPItemsResponse{
+				IsOk:  false,
+				Error: "网站不存在",
+			}, nil
+		}
+	}
+
+	result, err := models.SharedIPItemDAO.LookupIP(tx, ip.String(), req.ServerId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbLists = []*pb.LookupIPItemsResponse_List{}
+	for _, list := range result.Lists {
+		pbLists = append(pbLists, &pb.LookupIPItemsResponse_List{
+			IpList:                &pb.IPList{Id: list.ListId, Name: list.ListName, Type: list.ListType},
+			Scope:                 list.Scope,
+			HttpFirewallPolicyId:  list.PolicyId,
+			HttpFirewallRuleSetId: list.RuleSetId,
+		})
+	}
+
+	var pbMatches = []*pb.LookupIPItemsResponse_Match{}
+	for _, match := range result.Matches {
+		var item = match.Item
+		if len(item.Type) == 0 {
+			item.Type = models.IPItemTypeIPv4
+		}
+
+		// 来源节点
+		var pbSourceNode *pb.Node
+		if item.SourceNodeId > 0 {
+			nodeName, err := models.SharedNodeDAO.FindNodeName(tx, int64(item.SourceNodeId))
+			if err != nil {
+				return nil, err
+			}
+			pbSourceNode = &pb.Node{
+				Id:   int64(item.SourceNodeId),
+				Name: nodeName,
+			}
+		}
+
+		// 来源网站
+		var pbSourceServer *pb.Server
+		if item.SourceServerId > 0 {
+			serverName, err := models.SharedServerDAO.FindEnabledServerName(tx, int64(item.SourceServerId))
+			if err != nil {
+				return nil, err
+			}
+			pbSourceServer = &pb.Server{
+				Id:   int64(item.SourceServerId),
+				Name: serverName,
+			}
+		}
+
+		// 来源WAF规则集
+		var pbSourceSet *pb.HTTPFirewallRuleSet
+		if item.SourceHTTPFirewallRuleSetId > 0 {
+			setName, err := models.SharedHTTPFirewallRuleSetDAO.FindHTTPFirewallRuleSetName(tx, int64(item.SourceHTTPFirewallRuleSetId))
+			if err != nil {
+				return nil, err
+			}
+			pbSourceSet = &pb.HTTPFirewallRuleSet{
+				Id:   int64(item.SourceHTTPFirewallRuleSetId),
+				Name: setName,
+			}
+		}
+
+		pbMatches = append(pbMatches, &pb.LookupIPItemsResponse_Match{
+			IpList: &pb.IPList{
+				Id:   match.List.ListId,
+				Name: match.List.ListName,
+				Type: match.List.ListType,
+			},
+			IpItem: &pb.IPItem{
+				Id:                            int64(item.Id),
+				Value:                         item.ComposeValue(),
+				IpFrom:                        item.IpFrom,
+				IpTo:                          item.IpTo,
+				CreatedAt:                     int64(item.CreatedAt),
+				ExpiredAt:                     int64(item.ExpiredAt),
+				Reason:                        item.Reason,
+				Type:                          item.Type,
+				EventLevel:                    item.EventLevel,
+				ListType:                      match.List.ListType,
+				NodeId:                        int64(item.NodeId),
+				ServerId:                      int64(item.ServerId),
+				SourceNodeId:                  int64(item.SourceNodeId),
+				SourceServerId:                int64(item.SourceServerId),
+				SourceHTTPFirewallPolicyId:    int64(item.SourceHTTPFirewallPolicyId),
+				SourceHTTPFirewallRuleGroupId: int64(item.SourceHTTPFirewallRuleGroupId),
+				SourceHTTPFirewallRuleSetId:   int64(item.SourceHTTPFirewallRuleSetId),
+				SourceServer:                  pbSourceServer,
+				SourceHTTPFirewallRuleSet:     pbSourceSet,
+			},
+			Scope:                 match.List.Scope,
+			HttpFirewallPolicyId:  match.List.PolicyId,
+			HttpFirewallRuleSetId: match.List.RuleSetId,
+			SourceNode:            pbSourceNode,
+			IsDecisive:            match.IsDecisive,
+		})
+	}
+
+	return &pb.LookupIPItemsResponse{
+		IsOk:      true,
+		Verdict:   result.Verdict,
+		IsAllowed: result.Verdict != models.IPLookupVerdictDeny,
+		IpLists:   pbLists,
+		Matches:   pbMatches,
+	}, nil
+}
+
 // ExistsEnabledIPItem 检查IP是否存在
 func (this *IPItemService) ExistsEnabledIPItem(ctx context.Context, req *pb.ExistsEnabledIPItemRequest) (*pb.ExistsEnabledIPItemResponse, error) {
 	_, err := this.ValidateAdmin(ctx)
@@ -923,3 +1093,105 @@ func (this *IPItemService) FindServerIdWithIPItemId(ctx context.Context, req *pb
 
 	return &pb.FindServerIdWithIPItemIdResponse{ServerId: 0}, nil
 }
+
+// ImportIPItems 从文件批量导入IP到名单
+// 支持 text、csv、json 格式，每行可以指定过期时间和原因；isDryRun 为 true 时只返回统计结果，不修改数据
+func (this *IPItemService) ImportIPItems(ctx context.Context, req *pb.ImportIPItemsRequest) (*pb.ImportIPItemsResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err := models.SharedIPListDAO.ExistsEnabledIPList(tx, req.IpListId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists && !firewallconfigs.IsGlobalListId(req.IpListId) {
+		return nil, errors.New("ip list '" + types.String(req.IpListId) + "' not found")
+	}
+
+	rows, rowErrors, err := ipitemutils.ParseImport(strings.ToLower(req.Format), req.Data, time.Now())
+	if err != nil {
+		return nil, errors.New("parse data failed: " + err.Error())
+	}
+
+	result, err := models.SharedIPItemDAO.ImportIPItems(tx, req.IpListId, rows, userId, req.IsDryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只返回前面一部分错误，防止数据量过大
+	const maxErrors = 100
+	var pbErrors = []string{}
+	for _, rowError := range rowErrors {
+		if len(pbErrors) >= maxErrors {
+			break
+		}
+		pbErrors = append(pbErrors, "line "+types.String(rowError.Line)+": "+rowError.Error)
+	}
+
+	return &pb.ImportIPItemsResponse{
+		CountRows:      int64(len(rows) + len(rowErrors)),
+		CountCreated:   int64(result.CountCreated),
+		CountUpdated:   int64(result.CountUpdated),
+		CountUnchanged: int64(result.CountUnchanged),
+		CountInvalid:   int64(len(rowErrors)),
+		Errors:         pbErrors,
+	}, nil
+}
+
+// ExportIPItems 导出名单中的所有IP
+// 支持 text、csv、json 格式，导出的内容可以直接重新导入
+func (this *IPItemService) ExportIPItems(ctx context.Context, req *pb.ExportIPItemsRequest) (*pb.ExportIPItemsResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items, err := models.SharedIPItemDAO.FindAllEnabledItemsWithListId(tx, req.IpListId)
+	if err != nil {
+		return nil, err
+	}
+
+	var exportItems = []*ipitemutils.ExportItem{}
+	for _, item := range items {
+		// 暂不支持导出“所有IP”类型
+		if item.Type == models.IPItemTypeAll {
+			continue
+		}
+		exportItems = append(exportItems, &ipitemutils.ExportItem{
+			Value:     item.ComposeValue(),
+			Type:      item.Type,
+			ExpiredAt: int64(item.ExpiredAt),
+			Reason:    item.Reason,
+			CreatedAt: int64(item.CreatedAt),
+		})
+	}
+
+	data, err := ipitemutils.Export(strings.ToLower(req.Format), exportItems)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExportIPItemsResponse{
+		Data:       data,
+		CountItems: int64(len(exportItems)),
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 )
@@ -188,7 +189,7 @@ func (this *IPLibraryService) LookupIPRegion(ctx context.Context, req *pb.Lookup
 		return &pb.LookupIPRegionResponse{IpRegion: nil}, nil
 	}
 
-	return &pb.LookupIPRegionResponse{IpRegion: &pb.IPRegion{
+	var pbRegion = &pb.IPRegion{
 		Country:    result.CountryName(),
 		Region:     "",
 		Province:   result.ProvinceName(),
@@ -200,7 +201,16 @@ func (this *IPLibraryService) LookupIPRegion(ctx context.Context, req *pb.Lookup
 		TownId:     result.TownId(),
 		ProviderId: result.ProviderId(),
 		Summary:    result.Summary(),
-	}}, nil
+	}
+
+	// ASN
+	var asn = iplibraryutils.LookupASN(req.Ip)
+	if asn != nil {
+		pbRegion.Asn = int64(asn.Number)
+		pbRegion.AsOrganization = asn.Organization
+	}
+
+	return &pb.LookupIPRegionResponse{IpRegion: pbRegion}, nil
 }
 
 // LookupIPRegions 查询一组IP信息
@@ -229,6 +239,13 @@ func (this *IPLibraryService) LookupIPRegions(ctx context.Context, req *pb.Looku
 					ProviderId: info.ProviderId(),
 					Summary:    info.Summary(),
 				}
+
+				// ASN
+				var asn = iplibraryutils.LookupASN(ip)
+				if asn != nil {
+					result[ip].Asn = int64(asn.Number)
+					result[ip].AsOrganization = asn.Organization
+				}
 			}
 		}
 	}
@@ -92,6 +92,7 @@ func (this *IPLibraryArtifactService) FindAllIPLibraryArtifacts(ctx context.Cont
 			Id:        int64(artifact.Id),
 			Name:      artifact.Name,
 			FileId:    int64(artifact.FileId),
+			AsnFileId: int64(artifact.AsnFileId),
 			CreatedAt: int64(artifact.CreatedAt),
 			MetaJSON:  artifact.Meta,
 			IsPublic:  artifact.IsPublic,
@@ -126,6 +127,7 @@ func (this *IPLibraryArtifactService) FindIPLibraryArtifact(ctx context.Context,
 		IpLibraryArtifact: &pb.IPLibraryArtifact{
 			Id:        int64(artifact.Id),
 			FileId:    int64(artifact.FileId),
+			AsnFileId: int64(artifact.AsnFileId),
 			CreatedAt: int64(artifact.CreatedAt),
 			MetaJSON:  artifact.Meta,
 			IsPublic:  artifact.IsPublic,
@@ -156,6 +158,7 @@ func (this *IPLibraryArtifactService) FindPublicIPLibraryArtifact(ctx context.Co
 		IpLibraryArtifact: &pb.IPLibraryArtifact{
 			Id:        int64(artifact.Id),
 			FileId:    int64(artifact.FileId),
+			AsnFileId: int64(artifact.AsnFileId),
 			CreatedAt: int64(artifact.CreatedAt),
 			MetaJSON:  artifact.Meta,
 			IsPublic:  artifact.IsPublic,
@@ -9,6 +9,7 @@ import (
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/regions"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/iwind/TeaGo/lists"
 	"github.com/iwind/TeaGo/types"
@@ -197,10 +198,19 @@ func (this *IPLibraryFileService) FindIPLibraryFile(ctx context.Context, req *pb
 		})
 	}
 
+	var pbASNs = []*pb.IPLibraryFile_ASN{}
+	for _, asn := range libraryFile.DecodeASNs() {
+		pbASNs = append(pbASNs, &pb.IPLibraryFile_ASN{
+			Number:       int64(asn.Number),
+			Organization: asn.Organization,
+		})
+	}
+
 	return &pb.FindIPLibraryFileResponse{
 		IpLibraryFile: &pb.IPLibraryFile{
 			Id:              int64(libraryFile.Id),
 			Name:            libraryFile.Name,
+			Format:          libraryFile.Format,
 			Template:        libraryFile.Template,
 			EmptyValues:     libraryFile.DecodeEmptyValues(),
 			FileId:          int64(libraryFile.FileId),
@@ -213,6 +223,7 @@ func (this *IPLibraryFileService) FindIPLibraryFile(ctx context.Context, req *pb
 			Cities:          pbCities,
 			Towns:           pbTowns,
 			ProviderNames:   pbProviderNames,
+			Asns:            pbASNs,
 		},
 	}, nil
 }
@@ -224,6 +235,19 @@ func (this *IPLibraryFileService) CreateIPLibraryFile(ctx context.Context, req *
 		return nil, err
 	}
 
+	var tx = this.NullTx()
+
+	// MMDB、xdb等二进制文件直接由API节点读取区域信息
+	if iplibraryutils.IsBinaryFormat(req.Format) {
+		libraryFileId, err := models.SharedIPLibraryFileDAO.CreateLibraryFileWithFormat(tx, req.Name, req.Format, req.Password, req.FileId)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.CreateIPLibraryFileResponse{
+			IpLibraryFileId: libraryFileId,
+		}, nil
+	}
+
 	var countries = []string{}
 	var provinces = [][2]string{}
 	var cities = [][3]string{}
@@ -255,7 +279,6 @@ func (this *IPLibraryFileService) CreateIPLibraryFile(ctx context.Context, req *
 		return nil, errors.New("decode providers failed: " + err.Error())
 	}
 
-	var tx = this.NullTx()
 	libraryFileId, err := models.SharedIPLibraryFileDAO.CreateLibraryFile(tx, req.Name, req.Template, req.EmptyValues, req.Password, req.FileId, countries, provinces, cities, towns, providers)
 	if err != nil {
 		return nil, err
@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
 	"github.com/iwind/TeaGo/lists"
@@ -146,6 +149,7 @@ func (this *IPListService) FindEnabledIPList(ctx context.Context, req *pb.FindEn
 		TimeoutJSON: list.Timeout,
 		Description: list.Description,
 		IsGlobal:    list.IsGlobal,
+		Source:      list.Source,
 	}}, nil
 }
 
@@ -212,6 +216,12 @@ func (this *IPListService) DeleteIPList(ctx context.Context, req *pb.DeleteIPLis
 		return nil, err
 	}
 
+	// 删除违规记录
+	err = models.SharedIPListOffenderDAO.DeleteOffendersWithListId(tx, req.IpListId)
+	if err != nil {
+		return nil, err
+	}
+
 	return this.Success()
 }
 
@@ -333,3 +343,253 @@ func (this *IPListService) FindIPListIdWithCode(ctx context.Context, req *pb.Fin
 		IpListId: listId,
 	}, nil
 }
+
+// UpdateIPListFeed 修改IP名单订阅源
+// 订阅源由API节点下载，所以只允许管理员设置
+func (this *IPListService) UpdateIPListFeed(ctx context.Context, req *pb.UpdateIPListFeedRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	var config *ipfeedutils.FeedConfig
+	if models.IsNotNull(req.FeedJSON) {
+		config = &ipfeedutils.FeedConfig{}
+		err = json.Unmarshal(req.FeedJSON, config)
+		if err != nil {
+			return nil, errors.New("decode 'feedJSON' failed: " + err.Error())
+		}
+
+		// 保留被掩码的认证信息
+		if ipfeedutils.IsMasked(config.AuthHeaderValue) {
+			list, err := models.SharedIPListDAO.FindEnabledIPList(tx, req.IpListId, nil)
+			if err != nil {
+				return nil, err
+			}
+			var oldConfig *ipfeedutils.FeedConfig
+			if list != nil {
+				oldConfig, err = list.DecodeFeed()
+				if err != nil {
+					return nil, err
+				}
+			}
+			config.UnmaskWith(oldConfig)
+		}
+	}
+
+	err = models.SharedIPListDAO.UpdateIPListFeed(tx, req.IpListId, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindIPListFeed 查找IP名单订阅源设置和同步状态
+func (this *IPListService) FindIPListFeed(ctx context.Context, req *pb.FindIPListFeedRequest) (*pb.FindIPListFeedResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	list, err := models.SharedIPListDAO.FindEnabledIPList(tx, req.IpListId, nil)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil || !list.IsFeed() {
+		return &pb.FindIPListFeedResponse{}, nil
+	}
+
+	config, err := list.DecodeFeed()
+	if err != nil {
+		return nil, err
+	}
+	var feedJSON []byte
+	if config != nil {
+		config.Mask()
+		feedJSON, err = json.Marshal(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statusJSON, err := json.Marshal(list.DecodeFeedStatus())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.FindIPListFeedResponse{
+		FeedJSON:       feedJSON,
+		FeedStatusJSON: statusJSON,
+	}, nil
+}
+
+// SyncIPListFeed 立即同步IP名单订阅源
+func (this *IPListService) SyncIPListFeed(ctx context.Context, req *pb.SyncIPListFeedRequest) (*pb.SyncIPListFeedResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	status, err := models.SharedIPListDAO.SyncIPListFeed(tx, req.IpListId)
+	if status == nil {
+		return nil, err
+	}
+
+	// 同步失败的原因记录在同步状态中
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SyncIPListFeedResponse{FeedStatusJSON: statusJSON}, nil
+}
+
+// UpdateIPListEscalation 修改IP名单封禁阶梯
+func (this *IPListService) UpdateIPListEscalation(ctx context.Context, req *pb.UpdateIPListEscalationRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var config *ipescalationutils.Config
+	if models.IsNotNull(req.EscalationJSON) {
+		config = &ipescalationutils.Config{}
+		err = json.Unmarshal(req.EscalationJSON, config)
+		if err != nil {
+			return nil, errors.New("decode 'escalationJSON' failed: " + err.Error())
+		}
+	}
+
+	err = models.SharedIPListDAO.UpdateIPListEscalation(tx, req.IpListId, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindIPListEscalation 查找IP名单封禁阶梯
+func (this *IPListService) FindIPListEscalation(ctx context.Context, req *pb.FindIPListEscalationRequest) (*pb.FindIPListEscalationResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := models.SharedIPListDAO.FindIPListEscalation(tx, req.IpListId)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return &pb.FindIPListEscalationResponse{}, nil
+	}
+	escalationJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindIPListEscalationResponse{EscalationJSON: escalationJSON}, nil
+}
+
+// CountIPListOffenders 计算IP名单违规记录数量
+func (this *IPListService) CountIPListOffenders(ctx context.Context, req *pb.CountIPListOffendersRequest) (*pb.RPCCountResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	count, err := models.SharedIPListOffenderDAO.CountOffenders(tx, req.IpListId, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListIPListOffenders 列出IP名单违规记录
+func (this *IPListService) ListIPListOffenders(ctx context.Context, req *pb.ListIPListOffendersRequest) (*pb.ListIPListOffendersResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, req.IpListId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	offenders, err := models.SharedIPListOffenderDAO.ListOffenders(tx, req.IpListId, req.Ip, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbOffenders = []*pb.IPListOffender{}
+	for _, offender := range offenders {
+		pbOffenders = append(pbOffenders, &pb.IPListOffender{
+			Id:         int64(offender.Id),
+			IpListId:   int64(offender.ListId),
+			Ip:         offender.Ip,
+			Count:      int32(offender.Count),
+			TotalCount: int32(offender.TotalCount),
+			ExpiredAt:  int64(offender.ExpiredAt),
+			ResetAt:    int64(offender.ResetAt),
+			CreatedAt:  int64(offender.CreatedAt),
+			UpdatedAt:  int64(offender.UpdatedAt),
+		})
+	}
+	return &pb.ListIPListOffendersResponse{IpListOffenders: pbOffenders}, nil
+}
+
+// DeleteIPListOffender 删除IP名单违规记录，下次违规时从第一个阶梯开始
+func (this *IPListService) DeleteIPListOffender(ctx context.Context, req *pb.DeleteIPListOffenderRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	offender, err := models.SharedIPListOffenderDAO.FindOffender(tx, req.IpListOffenderId)
+	if err != nil {
+		return nil, err
+	}
+	if offender == nil {
+		return this.Success()
+	}
+	if userId > 0 {
+		err = models.SharedIPListDAO.CheckUserIPList(tx, userId, int64(offender.ListId))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = models.SharedIPListOffenderDAO.DeleteOffender(tx, req.IpListOffenderId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
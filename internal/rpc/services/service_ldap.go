@@ -0,0 +1,375 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ldaputils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/rands"
+)
+
+// LDAPService LDAP登录相关服务
+type LDAPService struct {
+	BaseService
+}
+
+// ReadLDAPConfig 读取LDAP登录设置
+func (this *LDAPService) ReadLDAPConfig(ctx context.Context, req *pb.ReadLDAPConfigRequest) (*pb.ReadLDAPConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedLoginDAO.ReadLDAPConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不返回服务账号密码
+	config.BindPassword = ""
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadLDAPConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateLDAPConfig 修改LDAP登录设置
+func (this *LDAPService) UpdateLDAPConfig(ctx context.Context, req *pb.UpdateLDAPConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginDAO.UpdateLDAPConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// TestLDAPConfig 使用某个用户测试LDAP登录设置，不会修改任何管理员
+func (this *LDAPService) TestLDAPConfig(ctx context.Context, req *pb.TestLDAPConfigRequest) (*pb.TestLDAPConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+	config.IsOn = true
+	err = config.Init()
+	if err != nil {
+		return &pb.TestLDAPConfigResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	user, err := ldaputils.Authenticate(config, req.Username, req.Password)
+	if err != nil {
+		return &pb.TestLDAPConfigResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	modules, isSuper, matched := config.MatchGroups(user.Groups)
+	return &pb.TestLDAPConfigResponse{
+		IsOk:           true,
+		Dn:             user.DN,
+		Fullname:       user.Fullname,
+		Groups:         user.Groups,
+		ModuleCodes:    modules,
+		IsSuper:        isSuper,
+		IsGroupMatched: matched,
+	}, nil
+}
+
+// FindLDAPLoginStatus 查找是否启用了LDAP登录，用于在登录页切换登录方式
+func (this *LDAPService) FindLDAPLoginStatus(ctx context.Context, req *pb.FindLDAPLoginStatusRequest) (*pb.FindLDAPLoginStatusResponse, error) {
+	_, _, err := this.ValidateNodeId(ctx, rpcutils.UserTypeAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedLoginDAO.ReadLDAPConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindLDAPLoginStatusResponse{
+		IsOn: config.IsOn,
+	}, nil
+}
+
+// LoginAdminWithLDAP 使用LDAP登录管理员
+// 未绑定LDAP的本地管理员返回 TryLocal=true，管理平台可以继续使用 AdminService.LoginAdmin 登录，以便在目录不可用时仍然可以管理系统
+func (this *LDAPService) LoginAdminWithLDAP(ctx context.Context, req *pb.LoginAdminWithLDAPRequest) (*pb.LoginAdminWithLDAPResponse, error) {
+	_, _, err := this.ValidateNodeId(ctx, rpcutils.UserTypeAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	var username = strings.TrimSpace(req.Username)
+	if len(username) == 0 || len(req.Password) == 0 {
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:    false,
+			Message: "请输入正确的用户名密码",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedLoginDAO.ReadLDAPConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.IsOn {
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:     false,
+			TryLocal: true,
+		}, nil
+	}
+
+	login, err := models.SharedLoginDAO.FindLDAPAdminLogin(tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只有未绑定LDAP的管理员才能继续使用本地密码登录
+	var tryLocal = login == nil
+
+	// 检查登录失败次数
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckLogin(tx, models.LoginAttemptRoleAdmin, username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:    false,
+			Message: passwordutils.RetryMessage(retryAfter),
+		}, nil
+	}
+
+	user, err := ldaputils.Authenticate(config, username, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ldaputils.ErrInvalidCredentials):
+		case errors.Is(err, ldaputils.ErrUserNotFound):
+			if login != nil {
+				// 已从目录中删除
+				_, err = models.SharedLoginDAO.SyncLDAPAdmin(tx, config, login, nil)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			remotelogs.Warn("LDAP", "authenticate '"+username+"' failed: "+err.Error())
+			return &pb.LoginAdminWithLDAPResponse{
+				IsOk:     false,
+				Message:  "LDAP服务器连接失败，请联系系统管理员",
+				TryLocal: tryLocal,
+			}, nil
+		}
+
+		// 可以使用本地密码登录时，由 AdminService.LoginAdmin 记录失败次数，避免重复计数
+		if !tryLocal {
+			err = models.SharedLoginAttemptDAO.RecordLoginFailure(tx, models.LoginAttemptRoleAdmin, username, req.Ip)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:     false,
+			Message:  "请输入正确的用户名密码",
+			TryLocal: tryLocal,
+		}, nil
+	}
+
+	var adminId int64
+	var isOn bool
+	var message string
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		if login == nil {
+			login, message, err = this.createAdmin(tx, config, user)
+			if err != nil || login == nil {
+				return err
+			}
+		}
+
+		adminId = int64(login.AdminId)
+		isOn, err = models.SharedLoginDAO.SyncLDAPAdmin(tx, config, login, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if adminId <= 0 {
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:     false,
+			Message:  message,
+			TryLocal: tryLocal,
+		}, nil
+	}
+
+	// 检查管理员状态
+	if isOn {
+		admin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, adminId)
+		if err != nil {
+			return nil, err
+		}
+		isOn = admin != nil && admin.IsOn && admin.CanLogin
+	}
+	if !isOn {
+		return &pb.LoginAdminWithLDAPResponse{
+			IsOk:    false,
+			Message: "当前账号没有登录权限",
+		}, nil
+	}
+
+	err = models.SharedLoginAttemptDAO.RecordPasswordSuccess(tx, models.LoginAttemptRoleAdmin, username, adminId, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginAdminWithLDAPResponse{
+		IsOk:    true,
+		AdminId: adminId,
+	}, nil
+}
+
+// BindLDAPAdmin 绑定LDAP用户到管理员，Username为空时表示解除绑定
+func (this *LDAPService) BindLDAPAdmin(ctx context.Context, req *pb.BindLDAPAdminRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AdminId <= 0 {
+		return nil, errors.New("invalid 'adminId'")
+	}
+
+	var tx = this.NullTx()
+	var username = strings.TrimSpace(req.Username)
+	if len(username) == 0 {
+		err = models.SharedLoginDAO.DisableLoginWithType(tx, req.AdminId, 0, models.LoginTypeLDAP)
+		if err != nil {
+			return nil, err
+		}
+		return this.Success()
+	}
+
+	err = models.SharedLoginDAO.BindLDAPIdentity(tx, req.AdminId, username, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindLDAPAdmin 查找管理员绑定的LDAP用户
+func (this *LDAPService) FindLDAPAdmin(ctx context.Context, req *pb.FindLDAPAdminRequest) (*pb.FindLDAPAdminResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AdminId <= 0 {
+		return &pb.FindLDAPAdminResponse{}, nil
+	}
+
+	var tx = this.NullTx()
+	login, err := models.SharedLoginDAO.FindEnabledLoginWithType(tx, req.AdminId, 0, models.LoginTypeLDAP)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil || !login.IsOn {
+		return &pb.FindLDAPAdminResponse{}, nil
+	}
+	var params = login.DecodeParams()
+	return &pb.FindLDAPAdminResponse{
+		Username:       params.GetString("username"),
+		Dn:             params.GetString("dn"),
+		DisabledBySync: params.GetBool("disabledBySync"),
+	}, nil
+}
+
+func (this *LDAPService) decodeConfig(configJSON []byte) (*ldaputils.Config, error) {
+	var config = ldaputils.DefaultConfig()
+	err := json.Unmarshal(configJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	// 没有填写密码时使用已保存的密码，以免在界面上回显密码
+	if len(config.BindPassword) == 0 && len(config.BindDN) > 0 {
+		oldConfig, err := models.SharedLoginDAO.ReadLDAPConfig(this.NullTx())
+		if err == nil && oldConfig.BindDN == config.BindDN {
+			config.BindPassword = oldConfig.BindPassword
+		}
+	}
+	return config, nil
+}
+
+// 首次登录时自动创建管理员
+func (this *LDAPService) createAdmin(tx *dbs.Tx, config *ldaputils.Config, user *ldaputils.User) (login *models.Login, message string, err error) {
+	if !config.AutoCreate {
+		return nil, "当前LDAP用户没有开通管理员账号", nil
+	}
+
+	if _, _, matched := config.MatchGroups(user.Groups); !matched && config.RequireGroup {
+		return nil, "当前账号没有登录权限", nil
+	}
+
+	// 不覆盖同名的本地管理员
+	exists, err := models.SharedAdminDAO.CheckAdminUsername(tx, 0, user.Username)
+	if err != nil {
+		return nil, "", err
+	}
+	if exists {
+		return nil, "用户名和本地管理员重复，请联系系统管理员绑定账号", nil
+	}
+
+	var fullname = user.Fullname
+	if len(fullname) == 0 {
+		fullname = user.Username
+	}
+
+	// 使用随机密码，只能通过LDAP登录
+	adminId, err := models.SharedAdminDAO.CreateAdmin(tx, user.Username, true, rands.HexString(32), fullname, false, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	err = models.SharedLoginDAO.BindLDAPIdentity(tx, adminId, user.Username, user.DN, false)
+	if err != nil {
+		return nil, "", err
+	}
+	login, err = models.SharedLoginDAO.FindLDAPAdminLogin(tx, user.Username)
+	if err != nil {
+		return nil, "", err
+	}
+	if login == nil {
+		return nil, "", errors.New("bind ldap user failed")
+	}
+	return login, "", nil
+}
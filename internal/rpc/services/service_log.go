@@ -23,6 +23,14 @@ func (this *LogService) CreateLog(ctx context.Context, req *pb.CreateLogRequest)
 		return nil, err
 	}
 
+	// 检查子用户权限
+	if userType == rpcutils.UserTypeUser && userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var tx = this.NullTx()
 
 	// i18n
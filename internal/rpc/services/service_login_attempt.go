@@ -0,0 +1,183 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+)
+
+// LoginAttemptService 登录安全策略和登录失败限制相关服务
+type LoginAttemptService struct {
+	BaseService
+}
+
+// ReadLoginSecurityPolicy 读取登录安全策略
+func (this *LoginAttemptService) ReadLoginSecurityPolicy(ctx context.Context, req *pb.ReadLoginSecurityPolicyRequest) (*pb.ReadLoginSecurityPolicyResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	policy, err := models.SharedLoginAttemptDAO.ReadLoginSecurityPolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadLoginSecurityPolicyResponse{PolicyJSON: policyJSON}, nil
+}
+
+// UpdateLoginSecurityPolicy 修改登录安全策略
+func (this *LoginAttemptService) UpdateLoginSecurityPolicy(ctx context.Context, req *pb.UpdateLoginSecurityPolicyRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy = passwordutils.DefaultPolicy()
+	err = json.Unmarshal(req.PolicyJSON, policy)
+	if err != nil {
+		return nil, errors.New("decode policy failed: " + err.Error())
+	}
+
+	// 检查泄露密码列表文件是否可以读取
+	if policy.Password != nil && len(policy.Password.BreachListFile) > 0 {
+		_, err = passwordutils.IsBreached(policy.Password.BreachListFile, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginAttemptDAO.UpdateLoginSecurityPolicy(tx, policy)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// CheckLoginAttempt 在验证密码或第二认证因素之前检查是否允许尝试登录
+// 管理平台检查管理员账号，用户平台检查用户账号
+func (this *LoginAttemptService) CheckLoginAttempt(ctx context.Context, req *pb.CheckLoginAttemptRequest) (*pb.CheckLoginAttemptResponse, error) {
+	role, err := this.validateLoginNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckLogin(tx, role, req.Username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter <= 0 {
+		return &pb.CheckLoginAttemptResponse{IsOk: true}, nil
+	}
+	return &pb.CheckLoginAttemptResponse{
+		IsOk:       false,
+		RetryAfter: retryAfter,
+		Message:    passwordutils.RetryMessage(retryAfter),
+	}, nil
+}
+
+// ReportSecondFactorFailure 报告第二认证因素（比如OTP动态密码）验证失败
+func (this *LoginAttemptService) ReportSecondFactorFailure(ctx context.Context, req *pb.ReportSecondFactorFailureRequest) (*pb.RPCSuccess, error) {
+	adminId, userId, err := this.validateLoginAccount(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginAttemptDAO.RecordSecondFactorFailure(tx, adminId, userId, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// ReportSecondFactorSuccess 报告第二认证因素验证成功，清除账号的登录失败记录
+func (this *LoginAttemptService) ReportSecondFactorSuccess(ctx context.Context, req *pb.ReportSecondFactorSuccessRequest) (*pb.RPCSuccess, error) {
+	adminId, userId, err := this.validateLoginAccount(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginAttemptDAO.RecordSecondFactorSuccess(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// UnlockLoginAttempt 解除账号或IP的登录锁定
+func (this *LoginAttemptService) UnlockLoginAttempt(ctx context.Context, req *pb.UnlockLoginAttemptRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if len(req.Username) > 0 {
+		switch req.Role {
+		case models.LoginAttemptRoleAdmin, models.LoginAttemptRoleUser, models.LoginAttemptRoleSubUser:
+		default:
+			return nil, errors.New("invalid role '" + req.Role + "'")
+		}
+		err = models.SharedLoginAttemptDAO.UnlockAccount(tx, req.Role, req.Username)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(req.Ip) > 0 {
+		err = models.SharedLoginAttemptDAO.UnlockIP(tx, req.Ip)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return this.Success()
+}
+
+// 根据调用的节点确定登录角色
+func (this *LoginAttemptService) validateLoginNode(ctx context.Context) (models.LoginAttemptRole, error) {
+	nodeRole, _, err := this.ValidateNodeId(ctx, rpcutils.UserTypeAdmin, rpcutils.UserTypeUser)
+	if err != nil {
+		return "", err
+	}
+	switch nodeRole {
+	case rpcutils.UserTypeAdmin:
+		return models.LoginAttemptRoleAdmin, nil
+	case rpcutils.UserTypeUser:
+		return models.LoginAttemptRoleUser, nil
+	}
+	return "", errors.New("invalid role '" + nodeRole + "'")
+}
+
+// 管理平台只能报告管理员，用户平台只能报告用户
+func (this *LoginAttemptService) validateLoginAccount(ctx context.Context, adminId int64, userId int64) (int64, int64, error) {
+	role, err := this.validateLoginNode(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch role {
+	case models.LoginAttemptRoleAdmin:
+		if adminId <= 0 {
+			return 0, 0, errors.New("invalid 'adminId'")
+		}
+		return adminId, 0, nil
+	default:
+		if userId <= 0 {
+			return 0, 0, errors.New("invalid 'userId'")
+		}
+		return 0, userId, nil
+	}
+}
@@ -4,10 +4,13 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/sessionutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
 )
 
 // LoginSessionService 登录SESSION服务
@@ -113,3 +116,161 @@ func (this *LoginSessionService) ClearOldLoginSessions(ctx context.Context, req
 
 	return this.Success()
 }
+
+// FindAllActiveLoginSessions 列出管理员或用户所有已登录的SESSION
+// 管理员可以查看自己和用户的SESSION，超级管理员可以查看其他管理员的SESSION；用户只能查看自己的SESSION
+func (this *LoginSessionService) FindAllActiveLoginSessions(ctx context.Context, req *pb.FindAllActiveLoginSessionsRequest) (*pb.FindAllActiveLoginSessionsResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	targetAdminId, targetUserId, err := this.checkSessionOwner(tx, adminId, userId, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := models.SharedLoginSessionDAO.FindAllActiveSessions(tx, targetAdminId, targetUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbSessions = []*pb.ActiveLoginSession{}
+	for _, session := range sessions {
+		pbSessions = append(pbSessions, &pb.ActiveLoginSession{
+			Id:         int64(session.Id),
+			AdminId:    int64(session.AdminId),
+			UserId:     int64(session.UserId),
+			Ip:         session.Ip,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  int64(session.CreatedAt),
+			LastSeenAt: int64(session.LastSeenAt),
+			ExpiresAt:  int64(session.ExpiresAt),
+			IsCurrent:  len(req.CurrentSid) > 0 && session.Sid == req.CurrentSid,
+		})
+	}
+	return &pb.FindAllActiveLoginSessionsResponse{ActiveLoginSessions: pbSessions}, nil
+}
+
+// RevokeLoginSession 注销某个SESSION，立即生效
+func (this *LoginSessionService) RevokeLoginSession(ctx context.Context, req *pb.RevokeLoginSessionRequest) (*pb.RPCSuccess, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	session, err := models.SharedLoginSessionDAO.FindEnabledSessionWithId(tx, req.LoginSessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || (session.AdminId == 0 && session.UserId == 0) {
+		return this.Success()
+	}
+
+	_, _, err = this.checkSessionOwner(tx, adminId, userId, int64(session.AdminId), int64(session.UserId))
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.SharedLoginSessionDAO.DeleteSessionWithId(tx, int64(session.Id))
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// RevokeAllLoginSessions 注销管理员或用户所有的SESSION，ExceptSid 不为空时保留此SESSION（通常为当前SESSION）
+func (this *LoginSessionService) RevokeAllLoginSessions(ctx context.Context, req *pb.RevokeAllLoginSessionsRequest) (*pb.RPCSuccess, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	targetAdminId, targetUserId, err := this.checkSessionOwner(tx, adminId, userId, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.SharedLoginSessionDAO.DeleteAllSessions(tx, targetAdminId, targetUserId, req.ExceptSid)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// ReadLoginSessionConfig 读取登录会话设置
+func (this *LoginSessionService) ReadLoginSessionConfig(ctx context.Context, req *pb.ReadLoginSessionConfigRequest) (*pb.ReadLoginSessionConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedLoginSessionDAO.ReadLoginSessionConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadLoginSessionConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateLoginSessionConfig 修改登录会话设置
+func (this *LoginSessionService) UpdateLoginSessionConfig(ctx context.Context, req *pb.UpdateLoginSessionConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var config = sessionutils.DefaultConfig()
+	err = json.Unmarshal(req.ConfigJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginSessionDAO.UpdateLoginSessionConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// 检查是否可以管理某个管理员或用户的SESSION，返回要管理的管理员ID和用户ID
+func (this *LoginSessionService) checkSessionOwner(tx *dbs.Tx, adminId int64, userId int64, targetAdminId int64, targetUserId int64) (int64, int64, error) {
+	// 用户只能管理自己的SESSION
+	if userId > 0 {
+		if targetAdminId > 0 || (targetUserId > 0 && targetUserId != userId) {
+			return 0, 0, this.PermissionError()
+		}
+		return 0, userId, nil
+	}
+
+	if adminId <= 0 {
+		return 0, 0, this.PermissionError()
+	}
+
+	if targetAdminId <= 0 && targetUserId <= 0 {
+		return adminId, 0, nil
+	}
+
+	// 只有超级管理员才能管理其他管理员的SESSION
+	if targetAdminId > 0 {
+		if targetAdminId != adminId {
+			isSuper, err := models.SharedAdminDAO.CheckSuperAdmin(tx, adminId)
+			if err != nil {
+				return 0, 0, err
+			}
+			if !isSuper {
+				return 0, 0, this.PermissionError()
+			}
+		}
+		return targetAdminId, 0, nil
+	}
+	return 0, targetUserId, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/nameservers"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// NSDNSSECService DNSSEC密钥管理服务
+type NSDNSSECService struct {
+	BaseService
+}
+
+// EnableNSDomainDNSSEC 启用域名DNSSEC
+func (this *NSDNSSECService) EnableNSDomainDNSSEC(ctx context.Context, req *pb.EnableNSDomainDNSSECRequest) (*pb.RPCSuccess, error) {
+	err := this.validateDomain(ctx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return nameservers.SharedNSKeyDAO.EnableDomainDNSSEC(tx, req.NsDomainId, req.Algorithm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DisableNSDomainDNSSEC 停用域名DNSSEC
+func (this *NSDNSSECService) DisableNSDomainDNSSEC(ctx context.Context, req *pb.DisableNSDomainDNSSECRequest) (*pb.RPCSuccess, error) {
+	err := this.validateDomain(ctx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = nameservers.SharedNSKeyDAO.DisableDomainDNSSEC(tx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// UpdateNSDomainDNSSECRollover 修改ZSK自动轮换设置
+func (this *NSDNSSECService) UpdateNSDomainDNSSECRollover(ctx context.Context, req *pb.UpdateNSDomainDNSSECRolloverRequest) (*pb.RPCSuccess, error) {
+	err := this.validateDomain(ctx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = nameservers.SharedNSKeyDAO.UpdateDomainDNSSECRollover(tx, req.NsDomainId, int(req.ZskLifetimeDays), req.PropagationSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// RolloverNSDomainZSK 立即开始轮换ZSK
+func (this *NSDNSSECService) RolloverNSDomainZSK(ctx context.Context, req *pb.RolloverNSDomainZSKRequest) (*pb.RPCSuccess, error) {
+	err := this.validateDomain(ctx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return nameservers.SharedNSKeyDAO.StartZSKRollover(tx, req.NsDomainId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindNSDomainDNSSEC 查找域名DNSSEC设置、密钥、DS记录和轮换状态
+func (this *NSDNSSECService) FindNSDomainDNSSEC(ctx context.Context, req *pb.FindNSDomainDNSSECRequest) (*pb.FindNSDomainDNSSECResponse, error) {
+	err := this.validateDomain(ctx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	domain, err := nameservers.SharedNSDomainDAO.FindEnabledNSDomain(tx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+	if domain == nil {
+		return &pb.FindNSDomainDNSSECResponse{}, nil
+	}
+	var config = domain.DecodeDNSSEC()
+
+	keys, err := nameservers.SharedNSKeyDAO.FindAllEnabledDNSSECKeysWithDomainId(tx, req.NsDomainId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbKeys = []*pb.NSDNSSECKey{}
+	var pbDSRecords = []*pb.NSDNSSECDSRecord{}
+	for _, key := range keys {
+		pbKeys = append(pbKeys, &pb.NSDNSSECKey{
+			Id:          int64(key.Id),
+			Kind:        key.Kind,
+			Algorithm:   key.Algo,
+			Flags:       int32(key.Flags),
+			KeyTag:      int32(key.KeyTag),
+			PublicKey:   key.PublicKey,
+			Status:      key.Status,
+			CreatedAt:   int64(key.CreatedAt),
+			ActivatedAt: int64(key.ActivatedAt),
+			RetiredAt:   int64(key.RetiredAt),
+		})
+
+		dsList, err := key.ComputeDS(domain.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ds := range dsList {
+			pbDSRecords = append(pbDSRecords, &pb.NSDNSSECDSRecord{
+				KeyTag:     int32(ds.KeyTag),
+				Algorithm:  int32(ds.Algorithm),
+				DigestType: int32(ds.DigestType),
+				Digest:     ds.Digest,
+				Value:      ds.String(),
+			})
+		}
+	}
+
+	return &pb.FindNSDomainDNSSECResponse{
+		IsOn:               config.IsOn,
+		Algorithm:          config.Algorithm,
+		ZskLifetimeDays:    int32(config.ZSKLifetimeDays),
+		PropagationSeconds: config.PropagationSeconds,
+		RolloverState:      config.RolloverState,
+		NextAction:         config.NextAction(),
+		NextActionAt:       config.NextActionAt,
+		LastActionAt:       config.LastActionAt,
+		NsDNSSECKeys:       pbKeys,
+		NsDNSSECDSRecords:  pbDSRecords,
+	}, nil
+}
+
+// ListNSDNSSECKeysAfterVersion 根据版本列出DNSSEC密钥，供DNS节点签名使用
+func (this *NSDNSSECService) ListNSDNSSECKeysAfterVersion(ctx context.Context, req *pb.ListNSDNSSECKeysAfterVersionRequest) (*pb.ListNSDNSSECKeysAfterVersionResponse, error) {
+	_, err := this.ValidateNSNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	keys, err := nameservers.SharedNSKeyDAO.ListDNSSECKeysAfterVersion(tx, req.Version, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbKeys = []*pb.NSDNSSECKey{}
+	for _, key := range keys {
+		pbKeys = append(pbKeys, &pb.NSDNSSECKey{
+			Id:          int64(key.Id),
+			NsDomainId:  int64(key.DomainId),
+			Kind:        key.Kind,
+			Algorithm:   key.Algo,
+			Flags:       int32(key.Flags),
+			KeyTag:      int32(key.KeyTag),
+			PublicKey:   key.PublicKey,
+			PrivateKey:  key.Secret,
+			Status:      key.Status,
+			CreatedAt:   int64(key.CreatedAt),
+			ActivatedAt: int64(key.ActivatedAt),
+			RetiredAt:   int64(key.RetiredAt),
+			IsOn:        key.IsOn,
+			IsDeleted:   key.State == nameservers.NSKeyStateDisabled,
+			Version:     int64(key.Version),
+		})
+	}
+	return &pb.ListNSDNSSECKeysAfterVersionResponse{NsDNSSECKeys: pbKeys}, nil
+}
+
+// 校验域名权限
+func (this *NSDNSSECService) validateDomain(ctx context.Context, domainId int64) error {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return err
+	}
+	if domainId <= 0 {
+		return errors.New("invalid 'nsDomainId'")
+	}
+	if userId > 0 {
+		return nameservers.SharedNSDomainDAO.CheckUserDomain(nil, userId, domainId)
+	}
+	return nil
+}
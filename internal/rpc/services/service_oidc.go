@@ -0,0 +1,384 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/oidcutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/rands"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+)
+
+var oidcUsernameReg = regexp.MustCompile(`^[a-zA-Z0-9_.@-]{3,50}$`)
+
+// OIDCService OIDC单点登录相关服务
+type OIDCService struct {
+	BaseService
+}
+
+// ReadOIDCConfig 读取OIDC登录设置
+func (this *OIDCService) ReadOIDCConfig(ctx context.Context, req *pb.ReadOIDCConfigRequest) (*pb.ReadOIDCConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedOIDCLoginStateDAO.ReadOIDCConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadOIDCConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateOIDCConfig 修改OIDC登录设置
+func (this *OIDCService) UpdateOIDCConfig(ctx context.Context, req *pb.UpdateOIDCConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var config = oidcutils.DefaultConfig()
+	err = json.Unmarshal(req.ConfigJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedOIDCLoginStateDAO.UpdateOIDCConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindOIDCLoginStatus 查找当前角色是否可以使用OIDC登录，用于在登录页显示登录按钮
+func (this *OIDCService) FindOIDCLoginStatus(ctx context.Context, req *pb.FindOIDCLoginStatusRequest) (*pb.FindOIDCLoginStatusResponse, error) {
+	role, err := this.validateLoginNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedOIDCLoginStateDAO.ReadOIDCConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindOIDCLoginStatusResponse{
+		IsOn: config.AllowRole(role),
+		Name: config.Name,
+	}, nil
+}
+
+// BeginOIDCLogin 开始OIDC登录，返回跳转到身份提供方的URL
+func (this *OIDCService) BeginOIDCLogin(ctx context.Context, req *pb.BeginOIDCLoginRequest) (*pb.BeginOIDCLoginResponse, error) {
+	role, err := this.validateLoginNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(req.RedirectURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, errors.New("invalid 'redirectURL'")
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedOIDCLoginStateDAO.ReadOIDCConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.AllowRole(role) {
+		return nil, errors.New("oidc login is not enabled")
+	}
+
+	discovery, err := oidcutils.Discover(config)
+	if err != nil {
+		return nil, err
+	}
+
+	loginState, err := models.SharedOIDCLoginStateDAO.CreateLoginState(tx, role, req.RedirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := oidcutils.ComposeAuthURL(discovery, config, loginState.RedirectURL, loginState.State, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.BeginOIDCLoginResponse{
+		AuthURL: authURL,
+		State:   loginState.State,
+	}, nil
+}
+
+// FinishOIDCLogin 完成OIDC登录回调，返回对应的管理员或用户
+func (this *OIDCService) FinishOIDCLogin(ctx context.Context, req *pb.FinishOIDCLoginRequest) (*pb.FinishOIDCLoginResponse, error) {
+	role, err := this.validateLoginNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	// 每个state只能使用一次
+	loginState, err := models.SharedOIDCLoginStateDAO.ConsumeLoginState(tx, role, req.State)
+	if err != nil {
+		return nil, err
+	}
+	if loginState == nil {
+		return &pb.FinishOIDCLoginResponse{
+			IsOk:    false,
+			Message: "登录请求已失效，请重新登录",
+		}, nil
+	}
+
+	config, err := models.SharedOIDCLoginStateDAO.ReadOIDCConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.AllowRole(role) {
+		return &pb.FinishOIDCLoginResponse{
+			IsOk:    false,
+			Message: "系统未启用单点登录",
+		}, nil
+	}
+
+	identity, err := oidcutils.Authenticate(config, req.Code, loginState.RedirectURL, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		remotelogs.Warn("OIDC", "authenticate failed: "+err.Error())
+		return &pb.FinishOIDCLoginResponse{
+			IsOk:    false,
+			Message: "身份认证失败，请重新登录",
+		}, nil
+	}
+
+	var adminId int64
+	var userId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		adminId, userId, err = this.findOrCreateAccount(tx, role, config, identity, req.Ip)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查账号状态
+	switch role {
+	case oidcutils.RoleAdmin:
+		if adminId > 0 {
+			admin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, adminId)
+			if err != nil {
+				return nil, err
+			}
+			if admin == nil || !admin.IsOn || !admin.CanLogin {
+				adminId = 0
+			}
+		}
+		if adminId <= 0 {
+			return &pb.FinishOIDCLoginResponse{
+				IsOk:    false,
+				Message: "当前身份没有绑定可用的管理员账号",
+			}, nil
+		}
+	case oidcutils.RoleUser:
+		if userId > 0 {
+			user, err := models.SharedUserDAO.FindEnabledBasicUser(tx, userId)
+			if err != nil {
+				return nil, err
+			}
+			if user == nil || !user.IsOn {
+				userId = 0
+			}
+		}
+		if userId <= 0 {
+			return &pb.FinishOIDCLoginResponse{
+				IsOk:    false,
+				Message: "当前身份没有绑定可用的用户账号",
+			}, nil
+		}
+	}
+
+	return &pb.FinishOIDCLoginResponse{
+		IsOk:    true,
+		AdminId: adminId,
+		UserId:  userId,
+	}, nil
+}
+
+// BindOIDCIdentity 绑定OIDC身份到管理员或用户，Subject为空时表示解除绑定
+func (this *OIDCService) BindOIDCIdentity(ctx context.Context, req *pb.BindOIDCIdentityRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AdminId <= 0 && req.UserId <= 0 {
+		return nil, errors.New("either 'adminId' or 'userId' should be greater than 0")
+	}
+	if req.AdminId > 0 {
+		req.UserId = 0
+	}
+
+	var tx = this.NullTx()
+	if len(req.Subject) == 0 {
+		err = models.SharedLoginDAO.DisableLoginWithType(tx, req.AdminId, req.UserId, models.LoginTypeOIDC)
+		if err != nil {
+			return nil, err
+		}
+		return this.Success()
+	}
+
+	config, err := models.SharedOIDCLoginStateDAO.ReadOIDCConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Issuer) == 0 {
+		return nil, errors.New("please config oidc issuer first")
+	}
+
+	err = models.SharedLoginDAO.BindOIDCIdentity(tx, req.AdminId, req.UserId, config.Issuer, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindOIDCIdentity 查找管理员或用户绑定的OIDC身份
+func (this *OIDCService) FindOIDCIdentity(ctx context.Context, req *pb.FindOIDCIdentityRequest) (*pb.FindOIDCIdentityResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.AdminId = 0
+		req.UserId = userId
+	}
+	if req.AdminId <= 0 && req.UserId <= 0 {
+		return &pb.FindOIDCIdentityResponse{}, nil
+	}
+
+	var tx = this.NullTx()
+	login, err := models.SharedLoginDAO.FindEnabledLoginWithType(tx, req.AdminId, req.UserId, models.LoginTypeOIDC)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil || !login.IsOn {
+		return &pb.FindOIDCIdentityResponse{}, nil
+	}
+	var params = login.DecodeParams()
+	return &pb.FindOIDCIdentityResponse{
+		Issuer:  params.GetString("issuer"),
+		Subject: params.GetString("subject"),
+	}, nil
+}
+
+// 校验调用登录接口的节点，返回登录角色
+func (this *OIDCService) validateLoginNode(ctx context.Context) (oidcutils.Role, error) {
+	nodeRole, _, err := this.ValidateNodeId(ctx, rpcutils.UserTypeAdmin, rpcutils.UserTypeUser)
+	if err != nil {
+		return "", err
+	}
+	switch nodeRole {
+	case rpcutils.UserTypeAdmin:
+		return oidcutils.RoleAdmin, nil
+	case rpcutils.UserTypeUser:
+		return oidcutils.RoleUser, nil
+	}
+	return "", errors.New("invalid role '" + nodeRole + "'")
+}
+
+// 查找身份对应的账号，按照设置匹配已有用户或者自动创建用户
+// 管理员只能使用通过BindOIDCIdentity()绑定的身份登录
+func (this *OIDCService) findOrCreateAccount(tx *dbs.Tx, role oidcutils.Role, config *oidcutils.Config, identity *oidcutils.Identity, ip string) (adminId int64, userId int64, err error) {
+	var isAdmin = role == oidcutils.RoleAdmin
+
+	// 已绑定的身份
+	adminId, userId, err = models.SharedLoginDAO.FindOIDCIdentity(tx, isAdmin, config.Issuer, identity.Subject)
+	if err != nil || adminId > 0 || userId > 0 {
+		return
+	}
+
+	// 不自动匹配管理员
+	if isAdmin {
+		return
+	}
+
+	// 匹配已有用户
+	switch config.MatchField {
+	case oidcutils.MatchFieldUsername:
+		if len(identity.Username) > 0 {
+			userId, err = models.SharedUserDAO.FindEnabledUserIdWithUsername(tx, identity.Username)
+			if err != nil {
+				return
+			}
+		}
+	case oidcutils.MatchFieldEmail:
+		// 只匹配身份提供方已验证的邮箱
+		if len(identity.Email) > 0 && identity.Claims["email_verified"] == true {
+			userId, err = models.SharedUserDAO.FindUserIdWithVerifiedEmail(tx, identity.Email)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// 自动创建用户
+	if userId <= 0 && config.Provision != nil && config.Provision.IsOn {
+		userId, err = this.provisionUser(tx, config, identity, ip)
+		if err != nil {
+			return
+		}
+	}
+
+	if userId > 0 {
+		err = models.SharedLoginDAO.BindOIDCIdentity(tx, 0, userId, config.Issuer, identity.Subject)
+	}
+	return
+}
+
+// 自动创建用户
+func (this *OIDCService) provisionUser(tx *dbs.Tx, config *oidcutils.Config, identity *oidcutils.Identity, ip string) (int64, error) {
+	var username = identity.Username
+	if !oidcUsernameReg.MatchString(username) {
+		username = "oidc_" + stringutil.Md5(config.Issuer + "@" + identity.Subject)[:12]
+	}
+
+	// 用户名重复时增加随机后缀
+	var baseUsername = username
+	for i := 0; i < 5; i++ {
+		exists, err := models.SharedUserDAO.ExistUser(tx, 0, username)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			break
+		}
+		if i == 4 {
+			return 0, errors.New("can not generate unique username for '" + identity.Subject + "'")
+		}
+		username = baseUsername + "_" + rands.HexString(6)
+	}
+
+	var fullname = identity.Fullname
+	if len(fullname) == 0 {
+		fullname = username
+	}
+
+	// 使用随机密码，用户只能通过单点登录，或者之后自行重置密码
+	return models.SharedUserDAO.CreateUser(tx, username, rands.HexString(32), fullname, "", "", identity.Email, "", "oidc", config.Provision.ClusterId, config.Provision.Features, ip, true)
+}
@@ -13,9 +13,13 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/clients"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/dns"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/stats"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/domainutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/sslconfigs"
@@ -1488,13 +1492,20 @@ func (this *ServerService) CountAllEnabledServersMatch(ctx context.Context, req
 		return nil, err
 	}
 
+	var scope *subuserutils.ServerScope
 	if userId > 0 {
 		req.UserId = userId
+
+		// 子用户只能查看授权的服务
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var tx = this.NullTx()
 
-	count, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, req.ServerGroupId, req.Keyword, req.UserId, req.NodeClusterId, types.Int8(req.AuditingFlag), utils.SplitStrings(req.ProtocolFamily, ","), req.UserPlanId)
+	count, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, req.ServerGroupId, req.Keyword, req.UserId, req.NodeClusterId, types.Int8(req.AuditingFlag), utils.SplitStrings(req.ProtocolFamily, ","), req.UserPlanId, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -1513,9 +1524,16 @@ func (this *ServerService) ListEnabledServersMatch(ctx context.Context, req *pb.
 	var tx = this.NullTx()
 
 	var fromUser = false
+	var scope *subuserutils.ServerScope
 	if userId > 0 {
 		fromUser = true
 		req.UserId = userId
+
+		// 子用户只能查看授权的服务
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var order = ""
@@ -1533,7 +1551,7 @@ func (this *ServerService) ListEnabledServersMatch(ctx context.Context, req *pb.
 		order = "attackRequestsDesc"
 	}
 
-	servers, err := models.SharedServerDAO.ListEnabledServersMatch(tx, req.Offset, req.Size, req.ServerGroupId, req.Keyword, req.UserId, req.NodeClusterId, req.AuditingFlag, utils.SplitStrings(req.ProtocolFamily, ","), order)
+	servers, err := models.SharedServerDAO.ListEnabledServersMatch(tx, req.Offset, req.Size, req.ServerGroupId, req.Keyword, req.UserId, req.NodeClusterId, req.AuditingFlag, utils.SplitStrings(req.ProtocolFamily, ","), order, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -2236,11 +2254,18 @@ func (this *ServerService) FindAllEnabledServerNamesWithUserId(ctx context.Conte
 	}
 
 	var tx = this.NullTx()
+	var scope *subuserutils.ServerScope
 	if userId > 0 {
 		req.UserId = userId
+
+		// 子用户只能查看授权的服务
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	servers, err := models.SharedServerDAO.FindAllBasicServersWithUserId(tx, req.UserId)
+	servers, err := models.SharedServerDAO.FindAllBasicServersWithUserId(tx, req.UserId, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -2317,12 +2342,19 @@ func (this *ServerService) FindAllUserServers(ctx context.Context, req *pb.FindA
 		return nil, err
 	}
 
+	var scope *subuserutils.ServerScope
 	if userId > 0 {
 		req.UserId = userId
+
+		// 子用户只能查看授权的服务
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var tx = this.NullTx()
-	servers, err := models.SharedServerDAO.FindAllBasicServersWithUserId(tx, req.UserId)
+	servers, err := models.SharedServerDAO.FindAllBasicServersWithUserId(tx, req.UserId, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -2349,12 +2381,19 @@ func (this *ServerService) CountAllUserServers(ctx context.Context, req *pb.Coun
 		return nil, err
 	}
 
+	var scope *subuserutils.ServerScope
 	if userId > 0 {
 		req.UserId = userId
+
+		// 子用户只能查看授权的服务
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var tx = this.NullTx()
-	countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", req.UserId, 0, configutils.BoolStateAll, nil, req.UserPlanId)
+	countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", req.UserId, 0, configutils.BoolStateAll, nil, req.UserPlanId, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -2560,6 +2599,16 @@ func (this *ServerService) UploadServerHTTPRequestStat(ctx context.Context, req
 		}
 	}
 
+	// ASN
+	for _, result := range req.RegionASNs {
+		if result.Asn > 0 {
+			var asnKey = fmt.Sprintf("%d@%d@%s", result.ServerId, result.Asn, month)
+			serverStatLocker.Lock()
+			serverHTTPASNStatMap[asnKey] += result.Count
+			serverStatLocker.Unlock()
+		}
+	}
+
 	// OS
 	for _, result := range req.Systems {
 		err := func() error {
@@ -2639,6 +2688,55 @@ func (this *ServerService) UploadServerHTTPRequestStat(ctx context.Context, req
 		}
 	}
 
+	// 防火墙事件
+	for _, event := range req.HttpFirewallEvents {
+		if event.ServerId <= 0 || event.Count <= 0 || len(event.Ip) == 0 {
+			continue
+		}
+
+		var hour = day + timeutil.Format("H")
+		if event.CreatedAt > 0 {
+			hour = timeutil.FormatTime("YmdH", event.CreatedAt)
+		}
+
+		var dimensionValues = map[string]string{
+			stats.FirewallEventDimensionIP:        event.Ip,
+			stats.FirewallEventDimensionURL:       event.Url,
+			stats.FirewallEventDimensionUserAgent: event.UserAgent,
+		}
+		var ipRegion = iplibrary.LookupIP(event.Ip)
+		if ipRegion != nil && ipRegion.IsOk() && ipRegion.CountryId() > 0 {
+			dimensionValues[stats.FirewallEventDimensionCountry] = types.String(ipRegion.CountryId())
+		}
+
+		serverStatLocker.Lock()
+		for dimension, value := range dimensionValues {
+			if len(value) == 0 {
+				continue
+			}
+			var key = serverHTTPFirewallEventKey{
+				ServerId:            event.ServerId,
+				Dimension:           dimension,
+				Value:               value,
+				FirewallRuleGroupId: event.HttpFirewallRuleGroupId,
+				Action:              event.Action,
+				Hour:                hour,
+			}
+			stat, ok := serverHTTPFirewallEventStatMap[key]
+			if !ok {
+				stat = &serverHTTPFirewallEventStat{}
+				serverHTTPFirewallEventStatMap[key] = stat
+			}
+			stat.Count += event.Count
+
+			// 只有IP维度关联产生的IP名单条目
+			if dimension == stats.FirewallEventDimensionIP && event.IpItemId > 0 {
+				stat.IPItemId = event.IpItemId
+			}
+		}
+		serverStatLocker.Unlock()
+	}
+
 	return this.Success()
 }
 
@@ -3028,7 +3126,7 @@ func (this *ServerService) UpdateServerUserPlan(ctx context.Context, req *pb.Upd
 		}
 
 		if plan.TotalServers > 0 {
-			countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", userId, 0, configutils.BoolStateAll, nil, req.UserPlanId)
+			countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", userId, 0, configutils.BoolStateAll, nil, req.UserPlanId, nil)
 			if err != nil {
 				return nil, err
 			}
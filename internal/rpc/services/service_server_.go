@@ -33,11 +33,29 @@ var serverHTTPCountryStatMap = map[string]*TrafficStat{}    // serverId@countryI
 var serverHTTPProvinceStatMap = map[string]int64{}          // serverId@provinceId@month => count
 var serverHTTPCityStatMap = map[string]int64{}              // serverId@cityId@month => count
 var serverHTTPProviderStatMap = map[string]int64{}          // serverId@providerId@month => count
+var serverHTTPASNStatMap = map[string]int64{}               // serverId@asn@month => count
 var serverHTTPSystemStatMap = map[string]int64{}            // serverId@systemId@version@month => count
 var serverHTTPBrowserStatMap = map[string]int64{}           // serverId@browserId@version@month => count
 var serverHTTPFirewallRuleGroupStatMap = map[string]int64{} // serverId@firewallRuleGroupId@action@day => count
+var serverHTTPFirewallEventStatMap = map[serverHTTPFirewallEventKey]*serverHTTPFirewallEventStat{}
 var serverStatLocker = sync.Mutex{}
 
+// WAF事件统计
+// 维度值（URL、User-Agent等）中可能含有@，所以不使用字符串作为键
+type serverHTTPFirewallEventKey struct {
+	ServerId            int64
+	Dimension           string
+	Value               string
+	FirewallRuleGroupId int64
+	Action              string
+	Hour                string
+}
+
+type serverHTTPFirewallEventStat struct {
+	IPItemId int64
+	Count    int64
+}
+
 func init() {
 	var service = new(ServerService)
 
@@ -153,6 +171,24 @@ func (this *ServerService) dumpServerHTTPStats() error {
 		}
 	}
 
+	// ASN
+	{
+		serverStatLocker.Lock()
+		var m = serverHTTPASNStatMap
+		serverHTTPASNStatMap = map[string]int64{}
+		serverStatLocker.Unlock()
+		for k, count := range m {
+			pieces := strings.Split(k, "@")
+			if len(pieces) != 3 {
+				continue
+			}
+			err := stats.SharedServerRegionASNMonthlyStatDAO.IncreaseMonthlyCount(nil, types.Int64(pieces[0]), types.Uint32(pieces[1]), pieces[2], count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// 操作系统
 	{
 		serverStatLocker.Lock()
@@ -215,5 +251,19 @@ func (this *ServerService) dumpServerHTTPStats() error {
 		}
 	}
 
+	// 防火墙事件
+	{
+		serverStatLocker.Lock()
+		var m = serverHTTPFirewallEventStatMap
+		serverHTTPFirewallEventStatMap = map[serverHTTPFirewallEventKey]*serverHTTPFirewallEventStat{}
+		serverStatLocker.Unlock()
+		for key, stat := range m {
+			err := stats.SharedServerHTTPFirewallEventHourlyStatDAO.IncreaseHourlyCount(nil, key.ServerId, key.Dimension, key.Value, key.FirewallRuleGroupId, key.Action, stat.IPItemId, key.Hour, stat.Count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
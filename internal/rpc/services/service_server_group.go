@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 )
@@ -91,8 +93,15 @@ func (this *ServerGroupService) FindAllEnabledServerGroups(ctx context.Context,
 		return nil, err
 	}
 
+	// 子用户只能查看授权的分组
+	var scope *subuserutils.ServerScope
 	if adminId > 0 {
 		userId = req.UserId
+	} else {
+		scope, err = rpcutils.FindSubUserServerScope(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var tx = this.NullTx()
@@ -103,6 +112,9 @@ func (this *ServerGroupService) FindAllEnabledServerGroups(ctx context.Context,
 	}
 	var result = []*pb.ServerGroup{}
 	for _, group := range groups {
+		if !scope.AllowServerGroup(int64(group.Id)) {
+			continue
+		}
 		result = append(result, &pb.ServerGroup{
 			Id:   int64(group.Id),
 			IsOn: group.IsOn,
@@ -0,0 +1,237 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/regions"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/stats"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+// 单次查询最多的小时数，和 utils.RangeHours() 的限制保持一致
+const maxFirewallEventTimelineHours = 96
+
+// ServerHTTPFirewallEventStatService WAF事件统计
+type ServerHTTPFirewallEventStatService struct {
+	BaseService
+}
+
+// FindServerHTTPFirewallEventTimeline 查询WAF事件时间线
+func (this *ServerHTTPFirewallEventStatService) FindServerHTTPFirewallEventTimeline(ctx context.Context, req *pb.FindServerHTTPFirewallEventTimelineRequest) (*pb.FindServerHTTPFirewallEventTimelineResponse, error) {
+	userId, err := this.validateFirewallEventRequest(ctx, req.UserId, req.ServerId)
+	if err != nil {
+		return nil, err
+	}
+
+	hourFrom, hourTo, err := this.composeFirewallEventHours(req.HourFrom, req.HourTo)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := utils.RangeHours(hourFrom, hourTo)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+
+	actionStats, err := stats.SharedServerHTTPFirewallEventHourlyStatDAO.FindHourlyActionStats(tx, userId, req.ServerId, req.Ip, hourFrom, hourTo)
+	if err != nil {
+		return nil, err
+	}
+
+	var pointMap = map[string]*pb.FindServerHTTPFirewallEventTimelineResponse_Point{} // hour => point
+	for _, stat := range actionStats {
+		point, ok := pointMap[stat.Hour]
+		if !ok {
+			point = &pb.FindServerHTTPFirewallEventTimelineResponse_Point{Hour: stat.Hour}
+			pointMap[stat.Hour] = point
+		}
+		point.Count += int64(stat.Count)
+		point.Actions = append(point.Actions, &pb.FindServerHTTPFirewallEventTimelineResponse_ActionStat{
+			Action: stat.Action,
+			Count:  int64(stat.Count),
+		})
+		if stat.IpItemId > 0 {
+			point.IpItemId = int64(stat.IpItemId)
+		}
+	}
+
+	// 来源IP数量和Top IP只在查看整体时间线时需要
+	if len(req.Ip) == 0 {
+		countIPsMap, err := stats.SharedServerHTTPFirewallEventHourlyStatDAO.CountHourlyIPs(tx, userId, req.ServerId, hourFrom, hourTo)
+		if err != nil {
+			return nil, err
+		}
+		for hour, point := range pointMap {
+			point.CountIPs = countIPsMap[hour]
+
+			topStat, err := stats.SharedServerHTTPFirewallEventHourlyStatDAO.FindTopHourlyValue(tx, userId, req.ServerId, stats.FirewallEventDimensionIP, hour)
+			if err != nil {
+				return nil, err
+			}
+			if topStat != nil {
+				point.TopIP = topStat.Value
+				point.TopIPCount = int64(topStat.Count)
+			}
+		}
+	}
+
+	var pbPoints = []*pb.FindServerHTTPFirewallEventTimelineResponse_Point{}
+	for _, hour := range hours {
+		point, ok := pointMap[hour]
+		if !ok {
+			point = &pb.FindServerHTTPFirewallEventTimelineResponse_Point{Hour: hour}
+		}
+		pbPoints = append(pbPoints, point)
+	}
+
+	return &pb.FindServerHTTPFirewallEventTimelineResponse{Points: pbPoints}, nil
+}
+
+// FindTopServerHTTPFirewallEventStats 查询WAF事件的Top攻击来源
+func (this *ServerHTTPFirewallEventStatService) FindTopServerHTTPFirewallEventStats(ctx context.Context, req *pb.FindTopServerHTTPFirewallEventStatsRequest) (*pb.FindTopServerHTTPFirewallEventStatsResponse, error) {
+	userId, err := this.validateFirewallEventRequest(ctx, req.UserId, req.ServerId)
+	if err != nil {
+		return nil, err
+	}
+
+	hourFrom, hourTo, err := this.composeFirewallEventHours(req.HourFrom, req.HourTo)
+	if err != nil {
+		return nil, err
+	}
+
+	var size = req.Size
+	if size <= 0 {
+		size = 10
+	} else if size > 100 {
+		size = 100
+	}
+
+	var tx = this.NullTx()
+	var resp = &pb.FindTopServerHTTPFirewallEventStatsResponse{}
+	for _, dimension := range []string{stats.FirewallEventDimensionIP, stats.FirewallEventDimensionCountry, stats.FirewallEventDimensionURL, stats.FirewallEventDimensionUserAgent} {
+		topStats, err := stats.SharedServerHTTPFirewallEventHourlyStatDAO.FindTopValues(tx, userId, req.ServerId, dimension, hourFrom, hourTo, size)
+		if err != nil {
+			return nil, err
+		}
+
+		var pbStats = []*pb.FindTopServerHTTPFirewallEventStatsResponse_Stat{}
+		for _, stat := range topStats {
+			pbStat, err := this.composeFirewallEventStat(tx, dimension, stat)
+			if err != nil {
+				return nil, err
+			}
+			if pbStat != nil {
+				pbStats = append(pbStats, pbStat)
+			}
+		}
+
+		switch dimension {
+		case stats.FirewallEventDimensionIP:
+			resp.TopIPs = pbStats
+		case stats.FirewallEventDimensionCountry:
+			resp.TopCountries = pbStats
+		case stats.FirewallEventDimensionURL:
+			resp.TopURLs = pbStats
+		case stats.FirewallEventDimensionUserAgent:
+			resp.TopUserAgents = pbStats
+		}
+	}
+
+	return resp, nil
+}
+
+// 校验请求，返回需要筛选的用户ID
+func (this *ServerHTTPFirewallEventStatService) validateFirewallEventRequest(ctx context.Context, reqUserId int64, serverId int64) (userId int64, err error) {
+	_, userId, err = this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if userId > 0 {
+		if reqUserId > 0 && reqUserId != userId {
+			return 0, this.PermissionError()
+		}
+		if serverId > 0 {
+			err = models.SharedServerDAO.CheckUserServer(nil, userId, serverId)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return userId, nil
+	}
+	return reqUserId, nil
+}
+
+// 检查小时范围，默认为最近24小时
+func (this *ServerHTTPFirewallEventStatService) composeFirewallEventHours(hourFrom string, hourTo string) (string, string, error) {
+	if len(hourTo) == 0 {
+		hourTo = timeutil.Format("YmdH")
+	}
+	if len(hourFrom) == 0 {
+		hourFrom = timeutil.Format("YmdH", time.Now().Add(-23*time.Hour))
+	}
+	if len(hourFrom) != 10 || len(hourTo) != 10 {
+		return "", "", errors.New("invalid hour range '" + hourFrom + "' - '" + hourTo + "'")
+	}
+	if hourFrom > hourTo {
+		hourFrom, hourTo = hourTo, hourFrom
+	}
+
+	fromTime, err := time.ParseInLocation("2006010215", hourFrom, time.Local)
+	if err != nil {
+		return "", "", errors.New("invalid hour '" + hourFrom + "'")
+	}
+	toTime, err := time.ParseInLocation("2006010215", hourTo, time.Local)
+	if err != nil {
+		return "", "", errors.New("invalid hour '" + hourTo + "'")
+	}
+	if toTime.Sub(fromTime) >= maxFirewallEventTimelineHours*time.Hour {
+		return "", "", errors.New("hour range should not be more than " + types.String(maxFirewallEventTimelineHours) + " hours")
+	}
+	return hourFrom, hourTo, nil
+}
+
+// 组合统计数据
+func (this *ServerHTTPFirewallEventStatService) composeFirewallEventStat(tx *dbs.Tx, dimension string, stat *stats.ServerHTTPFirewallEventHourlyStat) (*pb.FindTopServerHTTPFirewallEventStatsResponse_Stat, error) {
+	var pbStat = &pb.FindTopServerHTTPFirewallEventStatsResponse_Stat{
+		Value: stat.Value,
+		Name:  stat.Value,
+		Count: int64(stat.Count),
+	}
+
+	switch dimension {
+	case stats.FirewallEventDimensionCountry:
+		countryName, err := regions.SharedRegionCountryDAO.FindRegionCountryName(tx, types.Int64(stat.Value))
+		if err != nil {
+			return nil, err
+		}
+		if len(countryName) == 0 {
+			return nil, nil
+		}
+		pbStat.Name = countryName
+	case stats.FirewallEventDimensionIP:
+		// 关联产生的IP名单条目
+		if stat.IpItemId > 0 {
+			ipItem, err := models.SharedIPItemDAO.FindEnabledIPItem(tx, int64(stat.IpItemId))
+			if err != nil {
+				return nil, err
+			}
+			if ipItem != nil {
+				pbStat.IpItemId = int64(ipItem.Id)
+				pbStat.IpListId = int64(ipItem.ListId)
+			}
+		}
+	}
+
+	return pbStat, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/stats"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+)
+
+// ServerRegionASNMonthlyStatService ASN月份统计
+type ServerRegionASNMonthlyStatService struct {
+	BaseService
+}
+
+// FindTopServerRegionASNMonthlyStats 查找前N个ASN
+func (this *ServerRegionASNMonthlyStatService) FindTopServerRegionASNMonthlyStats(ctx context.Context, req *pb.FindTopServerRegionASNMonthlyStatsRequest) (*pb.FindTopServerRegionASNMonthlyStatsResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if userId > 0 {
+		err = models.SharedServerDAO.CheckUserServer(nil, userId, req.ServerId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tx = this.NullTx()
+	statList, err := stats.SharedServerRegionASNMonthlyStatDAO.ListStats(tx, req.ServerId, req.Month, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbStats = []*pb.FindTopServerRegionASNMonthlyStatsResponse_Stat{}
+	for _, stat := range statList {
+		var asn = iplibraryutils.FindSharedASN(stat.Asn)
+		var organization = ""
+		if asn != nil {
+			organization = asn.Organization
+		}
+		pbStats = append(pbStats, &pb.FindTopServerRegionASNMonthlyStatsResponse_Stat{
+			Asn:          iplibraryutils.FormatASN(stat.Asn),
+			Organization: organization,
+			Count:        int64(stat.Count),
+		})
+	}
+	return &pb.FindTopServerRegionASNMonthlyStatsResponse{Stats: pbStats}, nil
+}
@@ -0,0 +1,380 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/smsutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+)
+
+// SMSService 短信发送相关服务
+type SMSService struct {
+	BaseService
+}
+
+// FindAllSMSGatewayTypes 查找所有短信网关类型
+func (this *SMSService) FindAllSMSGatewayTypes(ctx context.Context, req *pb.FindAllSMSGatewayTypesRequest) (*pb.FindAllSMSGatewayTypesResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbGatewayTypes = []*pb.FindAllSMSGatewayTypesResponse_GatewayType{}
+	for _, t := range smsutils.FindAllGatewayTypes() {
+		pbGatewayTypes = append(pbGatewayTypes, &pb.FindAllSMSGatewayTypesResponse_GatewayType{
+			Name:        t.GetString("name"),
+			Code:        t.GetString("code"),
+			Description: t.GetString("description"),
+		})
+	}
+	return &pb.FindAllSMSGatewayTypesResponse{GatewayTypes: pbGatewayTypes}, nil
+}
+
+// ReadSMSConfig 读取短信发送设置
+func (this *SMSService) ReadSMSConfig(ctx context.Context, req *pb.ReadSMSConfigRequest) (*pb.ReadSMSConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedUserMobileVerificationDAO.ReadSMSConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 对网关密钥进行掩码
+	gateway, err := smsutils.NewGateway(config.GatewayType)
+	if err == nil {
+		gateway.MaskParams(config.GatewayParams)
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadSMSConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateSMSConfig 修改短信发送设置
+func (this *SMSService) UpdateSMSConfig(ctx context.Context, req *pb.UpdateSMSConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedUserMobileVerificationDAO.UpdateSMSConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// SendTestSMS 使用短信发送设置直接发送一条测试短信
+func (this *SMSService) SendTestSMS(ctx context.Context, req *pb.SendTestSMSRequest) (*pb.SendTestSMSResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mobile = strings.TrimSpace(req.Mobile)
+	if len(mobile) == 0 {
+		return &pb.SendTestSMSResponse{
+			IsOk:    false,
+			Message: "请输入接收测试短信的手机号",
+		}, nil
+	}
+
+	config, err := this.decodeConfig(req.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+	config.IsOn = true
+	err = config.Init()
+	if err != nil {
+		return &pb.SendTestSMSResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	var lang = smsutils.DefaultLang
+	admin, err := models.SharedAdminDAO.FindEnabledAdmin(this.NullTx(), adminId)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil && len(admin.Lang) > 0 {
+		lang = admin.Lang
+	}
+
+	code, err := config.GenerateCode()
+	if err != nil {
+		return nil, err
+	}
+	content, err := config.FindTemplate(smsutils.SceneTest, lang).Render(code, config.CodeLifeSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := config.NewGateway()
+	if err != nil {
+		return &pb.SendTestSMSResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+	err = gateway.Send(&smsutils.Message{
+		Mobile:  mobile,
+		Scene:   smsutils.SceneTest,
+		Code:    code,
+		Content: content,
+	})
+	if err != nil {
+		return &pb.SendTestSMSResponse{
+			IsOk:    false,
+			Message: err.Error(),
+		}, nil
+	}
+	return &pb.SendTestSMSResponse{IsOk: true}, nil
+}
+
+// SendUserMobileVerification 发送手机号验证码给当前用户
+func (this *SMSService) SendUserMobileVerification(ctx context.Context, req *pb.SendUserMobileVerificationRequest) (*pb.SendUserMobileVerificationResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId <= 0 {
+		return nil, this.PermissionError()
+	}
+
+	var mobile = strings.TrimSpace(req.Mobile)
+	if !utils.IsValidMobile(mobile) {
+		return &pb.SendUserMobileVerificationResponse{
+			IsOk:    false,
+			Message: "请输入正确的手机号",
+		}, nil
+	}
+
+	// 短信网关调用比较慢，这里不使用事务
+	err = models.SharedUserMobileVerificationDAO.CreateVerification(this.NullTx(), userId, mobile, req.Ip)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrMobileIsUsed):
+			return &pb.SendUserMobileVerificationResponse{
+				IsOk:    false,
+				Message: "此手机号已被其他用户使用",
+			}, nil
+		case errors.Is(err, models.ErrVerifyCodeTooFrequent):
+			return &pb.SendUserMobileVerificationResponse{
+				IsOk:    false,
+				Message: "发送过于频繁，请稍后再试",
+			}, nil
+		}
+		return nil, err
+	}
+	return &pb.SendUserMobileVerificationResponse{IsOk: true}, nil
+}
+
+// VerifyUserMobile 使用短信验证码验证当前用户的手机号
+func (this *SMSService) VerifyUserMobile(ctx context.Context, req *pb.VerifyUserMobileRequest) (*pb.VerifyUserMobileResponse, error) {
+	userId, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId <= 0 {
+		return nil, this.PermissionError()
+	}
+
+	var ok bool
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		ok, err = models.SharedUserMobileVerificationDAO.VerifyMobile(tx, userId, req.Mobile, req.Code)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrMobileIsUsed) {
+			return &pb.VerifyUserMobileResponse{
+				IsOk:    false,
+				Message: "此手机号已被其他用户使用",
+			}, nil
+		}
+		return nil, err
+	}
+	if !ok {
+		return &pb.VerifyUserMobileResponse{
+			IsOk:    false,
+			Message: "验证码无效或者已过期，请重新发送验证码",
+		}, nil
+	}
+	return &pb.VerifyUserMobileResponse{IsOk: true}, nil
+}
+
+// SendUserResetPasswordSMS 发送重置密码验证码短信
+// 为了避免泄露用户信息，手机号不存在时也返回成功
+func (this *SMSService) SendUserResetPasswordSMS(ctx context.Context, req *pb.SendUserResetPasswordSMSRequest) (*pb.SendUserResetPasswordSMSResponse, error) {
+	_, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var mobile = strings.TrimSpace(req.Mobile)
+	if !utils.IsValidMobile(mobile) {
+		return &pb.SendUserResetPasswordSMSResponse{
+			IsOk:    false,
+			Message: "请输入正确的手机号",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+
+	// 先检查IP限制，此时不涉及手机号是否存在
+	config, err := models.SharedUserMobileVerificationDAO.ReadSMSConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.IsOn {
+		return &pb.SendUserResetPasswordSMSResponse{
+			IsOk:    false,
+			Message: "系统未启用短信发送",
+		}, nil
+	}
+	if config.MaxPerIPPerHour > 0 {
+		countIP, err := models.SharedUserVerifyCodeDAO.CountRecentCodesWithIP(tx, req.Ip, 3600)
+		if err != nil {
+			return nil, err
+		}
+		if countIP >= int64(config.MaxPerIPPerHour) {
+			return &pb.SendUserResetPasswordSMSResponse{
+				IsOk:    false,
+				Message: "发送过于频繁，请稍后再试",
+			}, nil
+		}
+	}
+
+	userId, err := models.SharedUserDAO.FindUserIdWithVerifiedMobile(tx, mobile)
+	if err != nil {
+		return nil, err
+	}
+	if userId <= 0 {
+		return &pb.SendUserResetPasswordSMSResponse{IsOk: true}, nil
+	}
+
+	err = models.SharedUserVerifyCodeDAO.CreateResetPasswordSMS(tx, userId, req.Ip)
+	if err != nil {
+		if errors.Is(err, models.ErrVerifyCodeTooFrequent) || errors.Is(err, models.ErrNotFound) {
+			return &pb.SendUserResetPasswordSMSResponse{IsOk: true}, nil
+		}
+		return nil, err
+	}
+	return &pb.SendUserResetPasswordSMSResponse{IsOk: true}, nil
+}
+
+// ResetUserPasswordWithSMSCode 使用短信验证码设置新密码
+func (this *SMSService) ResetUserPasswordWithSMSCode(ctx context.Context, req *pb.ResetUserPasswordWithSMSCodeRequest) (*pb.ResetUserPasswordWithSMSCodeResponse, error) {
+	_, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var mobile = strings.TrimSpace(req.Mobile)
+	if len(req.Password) == 0 {
+		return &pb.ResetUserPasswordWithSMSCodeResponse{
+			IsOk:    false,
+			Message: "请输入新密码",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+	userId, err := models.SharedUserDAO.FindUserIdWithVerifiedMobile(tx, mobile)
+	if err != nil {
+		return nil, err
+	}
+
+	var codeIsValid bool
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		if userId <= 0 {
+			return nil
+		}
+		ok, err := models.SharedUserVerifyCodeDAO.UseCode(tx, "", mobile, models.UserVerifyCodeTypeResetPassword, strings.TrimSpace(req.Code))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 不回滚，以便记录校验失败次数
+			return nil
+		}
+		codeIsValid = true
+
+		// 密码不符合要求时回滚，验证码仍然可以使用
+		return models.SharedUserDAO.UpdateUserPassword(tx, userId, req.Password)
+	})
+	if err == nil && !codeIsValid {
+		return &pb.ResetUserPasswordWithSMSCodeResponse{
+			IsOk:    false,
+			Message: "验证码无效或者已过期，请重新发送验证码",
+		}, nil
+	}
+	if err != nil {
+		if passwordutils.IsPolicyError(err) {
+			return &pb.ResetUserPasswordWithSMSCodeResponse{
+				IsOk:    false,
+				Message: err.Error(),
+			}, nil
+		}
+		return nil, err
+	}
+
+	// 解除登录锁定
+	user, err := models.SharedUserDAO.FindEnabledBasicUser(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		for _, username := range []string{user.Username, mobile} {
+			err = models.SharedLoginAttemptDAO.UnlockAccount(tx, models.LoginAttemptRoleUser, username)
+			if err != nil {
+				remotelogs.Error("SMSService", "unlock user '"+username+"' failed: "+err.Error())
+			}
+		}
+	}
+
+	return &pb.ResetUserPasswordWithSMSCodeResponse{
+		IsOk:   true,
+		UserId: userId,
+	}, nil
+}
+
+func (this *SMSService) decodeConfig(configJSON []byte) (*smsutils.Config, error) {
+	var config = smsutils.DefaultConfig()
+	err := json.Unmarshal(configJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	// 恢复被掩码的网关参数
+	if config.GatewayParams == nil {
+		config.GatewayParams = maps.Map{}
+	}
+	oldConfig, err := models.SharedUserMobileVerificationDAO.ReadSMSConfig(this.NullTx())
+	if err == nil && oldConfig.GatewayType == config.GatewayType {
+		smsutils.UnmaskParams(oldConfig.GatewayParams, config.GatewayParams)
+	}
+	return config, nil
+}
@@ -82,11 +82,19 @@ func (this *SSLPolicyService) UpdateSSLPolicy(ctx context.Context, req *pb.Updat
 func (this *SSLPolicyService) FindEnabledSSLPolicyConfig(ctx context.Context, req *pb.FindEnabledSSLPolicyConfigRequest) (*pb.FindEnabledSSLPolicyConfigResponse, error) {
 	// 校验请求
 	// 这里不使用validateAdminAndUser()，是因为我们允许用户ID为0的时候也可以调用
-	_, _, _, err := rpcutils.ValidateRequest(ctx, rpcutils.UserTypeAdmin, rpcutils.UserTypeUser)
+	userType, _, userId, err := rpcutils.ValidateRequest(ctx, rpcutils.UserTypeAdmin, rpcutils.UserTypeUser)
 	if err != nil {
 		return nil, err
 	}
 
+	// 检查子用户权限
+	if userType == rpcutils.UserTypeUser && userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var tx = this.NullTx()
 
 	config, err := models.SharedSSLPolicyDAO.ComposePolicyConfig(tx, req.SslPolicyId, req.IgnoreData, nil, nil)
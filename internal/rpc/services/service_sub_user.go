@@ -0,0 +1,404 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/otputils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// SubUserService 子用户相关服务
+type SubUserService struct {
+	BaseService
+}
+
+// CreateSubUser 创建子用户
+func (this *SubUserService) CreateSubUser(ctx context.Context, req *pb.CreateSubUserRequest) (*pb.CreateSubUserResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.UserId = userId
+	}
+	if req.UserId <= 0 {
+		return nil, errors.New("invalid 'userId'")
+	}
+	if len(req.Username) == 0 {
+		return nil, errors.New("'username' should not be empty")
+	}
+
+	permissions, err := this.decodePermissions(req.PermissionsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	exists, err := models.SharedSubUserDAO.ExistSubUsername(tx, 0, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.New("the username '" + req.Username + "' has been used")
+	}
+
+	subUserId, err := models.SharedSubUserDAO.CreateSubUser(tx, req.UserId, req.Name, req.Username, req.Password, permissions)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateSubUserResponse{SubUserId: subUserId}, nil
+}
+
+// UpdateSubUser 修改子用户
+func (this *SubUserService) UpdateSubUser(ctx context.Context, req *pb.UpdateSubUserRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Username) == 0 {
+		return nil, errors.New("'username' should not be empty")
+	}
+
+	permissions, err := this.decodePermissions(req.PermissionsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		err = this.checkSubUser(tx, userId, req.SubUserId)
+		if err != nil {
+			return err
+		}
+
+		exists, err := models.SharedSubUserDAO.ExistSubUsername(tx, req.SubUserId, req.Username)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("the username '" + req.Username + "' has been used")
+		}
+
+		return models.SharedSubUserDAO.UpdateSubUser(tx, req.SubUserId, req.Name, req.Username, req.Password, permissions, req.IsOn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DeleteSubUser 删除子用户
+func (this *SubUserService) DeleteSubUser(ctx context.Context, req *pb.DeleteSubUserRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		err = this.checkSubUser(tx, userId, req.SubUserId)
+		if err != nil {
+			return err
+		}
+		return models.SharedSubUserDAO.DeleteSubUser(tx, req.SubUserId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// CountSubUsers 计算子用户数量
+func (this *SubUserService) CountSubUsers(ctx context.Context, req *pb.CountSubUsersRequest) (*pb.RPCCountResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.UserId = userId
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedSubUserDAO.CountSubUsers(tx, req.UserId, req.Keyword)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListSubUsers 列出单页子用户
+func (this *SubUserService) ListSubUsers(ctx context.Context, req *pb.ListSubUsersRequest) (*pb.ListSubUsersResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.UserId = userId
+	}
+
+	var tx = this.NullTx()
+	subUsers, err := models.SharedSubUserDAO.ListSubUsers(tx, req.UserId, req.Keyword, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbSubUsers = []*pb.SubUser{}
+	for _, subUser := range subUsers {
+		pbSubUsers = append(pbSubUsers, this.convertSubUser(subUser))
+	}
+	return &pb.ListSubUsersResponse{SubUsers: pbSubUsers}, nil
+}
+
+// FindSubUser 查找单个子用户
+func (this *SubUserService) FindSubUser(ctx context.Context, req *pb.FindSubUserRequest) (*pb.FindSubUserResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 {
+		err = models.SharedSubUserDAO.CheckUserSubUser(tx, userId, req.SubUserId)
+		if err != nil {
+			if err == models.ErrNotFound {
+				return &pb.FindSubUserResponse{SubUser: nil}, nil
+			}
+			return nil, err
+		}
+	}
+
+	subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(tx, req.SubUserId)
+	if err != nil {
+		return nil, err
+	}
+	if subUser == nil {
+		return &pb.FindSubUserResponse{SubUser: nil}, nil
+	}
+	return &pb.FindSubUserResponse{SubUser: this.convertSubUser(subUser)}, nil
+}
+
+// UpdateSubUserOTP 启用或停用子用户OTP，启用时会生成新的密钥
+func (this *SubUserService) UpdateSubUserOTP(ctx context.Context, req *pb.UpdateSubUserOTPRequest) (*pb.UpdateSubUserOTPResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = this.checkSubUser(tx, userId, req.SubUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.IsOn {
+		err = models.SharedSubUserDAO.UpdateSubUserOTP(tx, req.SubUserId, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.UpdateSubUserOTPResponse{}, nil
+	}
+
+	subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(tx, req.SubUserId)
+	if err != nil {
+		return nil, err
+	}
+	if subUser == nil {
+		return nil, errors.New("sub user not found")
+	}
+
+	secret, err := otputils.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = models.SharedSubUserDAO.UpdateSubUserOTP(tx, req.SubUserId, &models.SubUserOTPConfig{
+		IsOn:   true,
+		Secret: secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateSubUserOTPResponse{
+		Secret: secret,
+		OtpURL: otputils.ComposeURL(teaconst.GlobalProductName, subUser.Username, secret),
+	}, nil
+}
+
+// FindAllSubUserModules 查找所有可以授权给子用户的模块
+func (this *SubUserService) FindAllSubUserModules(ctx context.Context, req *pb.FindAllSubUserModulesRequest) (*pb.FindAllSubUserModulesResponse, error) {
+	_, _, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	modulesJSON, err := json.Marshal(subuserutils.FindAllModules())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindAllSubUserModulesResponse{ModulesJSON: modulesJSON}, nil
+}
+
+// LoginSubUser 子用户登录
+func (this *SubUserService) LoginSubUser(ctx context.Context, req *pb.LoginSubUserRequest) (*pb.LoginSubUserResponse, error) {
+	_, err := this.ValidateUserNode(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Username) == 0 || len(req.Password) == 0 {
+		return &pb.LoginSubUserResponse{
+			IsOk:    false,
+			Message: "请输入正确的用户名密码",
+		}, nil
+	}
+
+	var tx = this.NullTx()
+
+	// 检查登录失败次数
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckLogin(tx, models.LoginAttemptRoleSubUser, req.Username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return &pb.LoginSubUserResponse{
+			IsOk:    false,
+			Message: passwordutils.RetryMessage(retryAfter),
+		}, nil
+	}
+
+	subUserId, userId, err := models.SharedSubUserDAO.CheckSubUserPassword(tx, req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if subUserId <= 0 {
+		err = models.SharedLoginAttemptDAO.RecordLoginFailure(tx, models.LoginAttemptRoleSubUser, req.Username, req.Ip)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.LoginSubUserResponse{
+			IsOk:    false,
+			Message: "请输入正确的用户名密码",
+		}, nil
+	}
+
+	subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(tx, subUserId)
+	if err != nil {
+		return nil, err
+	}
+	if subUser == nil {
+		return &pb.LoginSubUserResponse{
+			IsOk:    false,
+			Message: "请输入正确的用户名密码",
+		}, nil
+	}
+
+	// 校验OTP动态码
+	var otpConfig = subUser.DecodeOTP()
+	if otpConfig.IsOn && len(otpConfig.Secret) > 0 {
+		if len(req.OtpCode) == 0 {
+			return &pb.LoginSubUserResponse{
+				IsOk:       false,
+				RequireOTP: true,
+				Message:    "请输入OTP动态密码",
+			}, nil
+		}
+		if !otputils.Verify(otpConfig.Secret, req.OtpCode, time.Now().Unix()) {
+			err = models.SharedLoginAttemptDAO.RecordLoginFailure(tx, models.LoginAttemptRoleSubUser, req.Username, req.Ip)
+			if err != nil {
+				return nil, err
+			}
+			return &pb.LoginSubUserResponse{
+				IsOk:       false,
+				RequireOTP: true,
+				Message:    "OTP动态密码错误",
+			}, nil
+		}
+	}
+
+	err = models.SharedLoginAttemptDAO.RecordLoginSuccess(tx, models.LoginAttemptRoleSubUser, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginSubUserResponse{
+		SubUserId: subUserId,
+		UserId:    userId,
+		IsOk:      true,
+	}, nil
+}
+
+// CreateSubUserAccessKey 为子用户创建AccessKey
+func (this *SubUserService) CreateSubUserAccessKey(ctx context.Context, req *pb.CreateSubUserAccessKeyRequest) (*pb.CreateSubUserAccessKeyResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = this.checkSubUser(tx, userId, req.SubUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(tx, req.SubUserId)
+	if err != nil {
+		return nil, err
+	}
+	if subUser == nil {
+		return nil, errors.New("sub user not found")
+	}
+
+	userAccessKeyId, err := models.SharedUserAccessKeyDAO.CreateSubUserAccessKey(tx, int64(subUser.UserId), req.SubUserId, req.Description)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateSubUserAccessKeyResponse{UserAccessKeyId: userAccessKeyId}, nil
+}
+
+// 检查用户是否可以管理子用户
+func (this *SubUserService) checkSubUser(tx *dbs.Tx, userId int64, subUserId int64) error {
+	if subUserId <= 0 {
+		return errors.New("invalid 'subUserId'")
+	}
+	if userId > 0 {
+		return models.SharedSubUserDAO.CheckUserSubUser(tx, userId, subUserId)
+	}
+	return nil
+}
+
+// 解析权限设置
+func (this *SubUserService) decodePermissions(permissionsJSON []byte) (*subuserutils.Permissions, error) {
+	var permissions = &subuserutils.Permissions{}
+	if len(permissionsJSON) > 0 {
+		err := json.Unmarshal(permissionsJSON, permissions)
+		if err != nil {
+			return nil, errors.New("decode permissions failed: " + err.Error())
+		}
+	}
+	err := permissions.Init()
+	if err != nil {
+		return nil, errors.New("validate permissions failed: " + err.Error())
+	}
+	return permissions, nil
+}
+
+func (this *SubUserService) convertSubUser(subUser *models.SubUser) *pb.SubUser {
+	return &pb.SubUser{
+		Id:              int64(subUser.Id),
+		UserId:          int64(subUser.UserId),
+		IsOn:            subUser.IsOn,
+		Name:            subUser.Name,
+		Username:        subUser.Username,
+		PermissionsJSON: subUser.Permissions,
+		OtpIsOn:         subUser.DecodeOTP().IsOn,
+		CreatedAt:       int64(subUser.CreatedAt),
+	}
+}
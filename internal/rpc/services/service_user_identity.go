@@ -4,11 +4,16 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/identityutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeCommon/pkg/userconfigs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
 )
 
 // UserIdentityService 用户身份认证服务
@@ -37,6 +42,13 @@ func (this *UserIdentityService) CreateUserIdentity(ctx context.Context, req *pb
 	}
 
 	var tx = this.NullTx()
+
+	// 检查证件文件
+	err = this.checkUserFiles(tx, userId, req.FileIds)
+	if err != nil {
+		return nil, err
+	}
+
 	identityId, err := models.SharedUserIdentityDAO.CreateUserIdentity(tx, userId, req.OrgType, req.Type, req.RealName, req.Number, req.FileIds)
 	if err != nil {
 		return nil, err
@@ -71,20 +83,7 @@ func (this *UserIdentityService) FindEnabledUserIdentity(ctx context.Context, re
 	}
 
 	return &pb.FindEnabledUserIdentityResponse{
-		UserIdentity: &pb.UserIdentity{
-			Id:           int64(identity.Id),
-			Type:         identity.Type,
-			RealName:     identity.RealName,
-			Number:       identity.Number,
-			FileIds:      identity.DecodeFileIds(),
-			Status:       identity.Status,
-			CreatedAt:    int64(identity.CreatedAt),
-			UpdatedAt:    int64(identity.UpdatedAt),
-			SubmittedAt:  int64(identity.SubmittedAt),
-			RejectedAt:   int64(identity.RejectedAt),
-			VerifiedAt:   int64(identity.VerifiedAt),
-			RejectReason: identity.RejectReason,
-		},
+		UserIdentity: this.convertUserIdentity(identity, userId == 0),
 	}, nil
 }
 
@@ -111,20 +110,7 @@ func (this *UserIdentityService) FindEnabledUserIdentityWithOrgType(ctx context.
 	}
 
 	return &pb.FindEnabledUserIdentityWithOrgTypeResponse{
-		UserIdentity: &pb.UserIdentity{
-			Id:           int64(identity.Id),
-			Type:         identity.Type,
-			RealName:     identity.RealName,
-			Number:       identity.Number,
-			FileIds:      identity.DecodeFileIds(),
-			Status:       identity.Status,
-			CreatedAt:    int64(identity.CreatedAt),
-			UpdatedAt:    int64(identity.UpdatedAt),
-			SubmittedAt:  int64(identity.SubmittedAt),
-			RejectedAt:   int64(identity.RejectedAt),
-			VerifiedAt:   int64(identity.VerifiedAt),
-			RejectReason: identity.RejectReason,
-		},
+		UserIdentity: this.convertUserIdentity(identity, userId == 0),
 	}, nil
 }
 
@@ -185,6 +171,12 @@ func (this *UserIdentityService) UpdateUserIdentity(ctx context.Context, req *pb
 		return nil, errors.New("identity status should be '" + userconfigs.UserIdentityStatusNone + "' instead of '" + status + "'")
 	}
 
+	// 检查证件文件
+	err = this.checkUserFiles(tx, userId, req.FileIds)
+	if err != nil {
+		return nil, err
+	}
+
 	err = models.SharedUserIdentityDAO.UpdateUserIdentity(tx, req.UserIdentityId, req.Type, req.RealName, req.Number, req.FileIds)
 	if err != nil {
 		return nil, err
@@ -275,14 +267,32 @@ func (this *UserIdentityService) ResetUserIdentity(ctx context.Context, req *pb.
 }
 
 // RejectUserIdentity 拒绝用户身份认证信息
+// 可以使用拒绝原因模板代号，也可以直接填写拒绝原因
 func (this *UserIdentityService) RejectUserIdentity(ctx context.Context, req *pb.RejectUserIdentityRequest) (*pb.RPCSuccess, error) {
-	_, err := this.ValidateAdmin(ctx)
+	adminId, err := this.ValidateAdmin(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var tx = this.NullTx()
 
+	var reason = strings.TrimSpace(req.Reason)
+	if len(req.ReasonCode) > 0 {
+		config, err := models.SharedUserIdentityDAO.ReadUserIdentityConfig(tx)
+		if err != nil {
+			return nil, err
+		}
+		var rejectReason = config.FindRejectReason(req.ReasonCode)
+		if rejectReason == nil {
+			return nil, errors.New("could not find reject reason with code '" + req.ReasonCode + "'")
+		}
+		if len(reason) > 0 {
+			reason = rejectReason.Text + "：" + reason
+		} else {
+			reason = rejectReason.Text
+		}
+	}
+
 	// 检查状态
 	status, err := models.SharedUserIdentityDAO.FindUserIdentityStatus(tx, req.UserIdentityId)
 	if err != nil {
@@ -292,7 +302,9 @@ func (this *UserIdentityService) RejectUserIdentity(ctx context.Context, req *pb
 		return nil, errors.New("identity status should be '" + userconfigs.UserIdentityStatusSubmitted + "' instead of '" + status + "'")
 	}
 
-	err = models.SharedUserIdentityDAO.RejectUserIdentity(tx, req.UserIdentityId, req.Reason)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return models.SharedUserIdentityDAO.RejectUserIdentity(tx, req.UserIdentityId, adminId, reason)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +314,7 @@ func (this *UserIdentityService) RejectUserIdentity(ctx context.Context, req *pb
 
 // VerifyUserIdentity 通过用户身份认证信息
 func (this *UserIdentityService) VerifyUserIdentity(ctx context.Context, req *pb.VerifyUserIdentityRequest) (*pb.RPCSuccess, error) {
-	_, err := this.ValidateAdmin(ctx)
+	adminId, err := this.ValidateAdmin(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -318,10 +330,231 @@ func (this *UserIdentityService) VerifyUserIdentity(ctx context.Context, req *pb
 		return nil, errors.New("identity status should be '" + userconfigs.UserIdentityStatusSubmitted + "' instead of '" + status + "'")
 	}
 
-	err = models.SharedUserIdentityDAO.VerifyUserIdentity(tx, req.UserIdentityId)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		return models.SharedUserIdentityDAO.VerifyUserIdentity(tx, req.UserIdentityId, adminId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return this.Success()
+}
+
+// CountUserIdentities 计算审核队列中的认证信息数量
+func (this *UserIdentityService) CountUserIdentities(ctx context.Context, req *pb.CountUserIdentitiesRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedUserIdentityDAO.CountUserIdentities(tx, req.OrgType, req.Status, req.MinAgeSeconds, req.MaxAgeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListUserIdentities 列出审核队列中单页认证信息
+func (this *UserIdentityService) ListUserIdentities(ctx context.Context, req *pb.ListUserIdentitiesRequest) (*pb.ListUserIdentitiesResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	identities, err := models.SharedUserIdentityDAO.ListUserIdentities(tx, req.OrgType, req.Status, req.MinAgeSeconds, req.MaxAgeSeconds, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbIdentities = []*pb.UserIdentity{}
+	for _, identity := range identities {
+		var pbIdentity = this.convertUserIdentity(identity, true)
+
+		// 用户
+		user, err := models.SharedUserDAO.FindEnabledBasicUser(tx, int64(identity.UserId))
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			pbIdentity.User = &pb.User{
+				Id:       int64(user.Id),
+				Username: user.Username,
+				Fullname: user.Fullname,
+			}
+		}
+
+		// 审核人
+		if identity.ReviewerId > 0 {
+			reviewerName, err := models.SharedAdminDAO.FindAdminFullname(tx, int64(identity.ReviewerId))
+			if err != nil {
+				return nil, err
+			}
+			pbIdentity.ReviewerName = reviewerName
+		}
+
+		pbIdentities = append(pbIdentities, pbIdentity)
+	}
+	return &pb.ListUserIdentitiesResponse{UserIdentities: pbIdentities}, nil
+}
+
+// FindUserIdentityFiles 查找认证信息中的证件文件
+// 文件内容可以通过 FileChunkService 下载
+func (this *UserIdentityService) FindUserIdentityFiles(ctx context.Context, req *pb.FindUserIdentityFilesRequest) (*pb.FindUserIdentityFilesResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	identity, err := models.SharedUserIdentityDAO.FindEnabledUserIdentity(tx, req.UserIdentityId)
+	if err != nil {
+		return nil, err
+	}
+	if identity == nil {
+		return &pb.FindUserIdentityFilesResponse{}, nil
+	}
+
+	var pbFiles = []*pb.FindUserIdentityFilesResponse_IdentityFile{}
+	for _, fileId := range identity.DecodeFileIds() {
+		file, err := models.SharedFileDAO.FindEnabledFile(tx, fileId)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil || int64(file.UserId) != int64(identity.UserId) {
+			continue
+		}
+
+		chunkIds, err := models.SharedFileChunkDAO.FindAllFileChunkIds(tx, fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		pbFiles = append(pbFiles, &pb.FindUserIdentityFilesResponse_IdentityFile{
+			File: &pb.File{
+				Id:        int64(file.Id),
+				Filename:  file.Filename,
+				Size:      int64(file.Size),
+				CreatedAt: int64(file.CreatedAt),
+				IsPublic:  file.IsPublic,
+				MimeType:  file.MimeType,
+				Type:      file.Type,
+			},
+			FileChunkIds: chunkIds,
+		})
+	}
+	return &pb.FindUserIdentityFilesResponse{IdentityFiles: pbFiles}, nil
+}
+
+// RunUserIdentityHook 手动调用外部核验接口
+func (this *UserIdentityService) RunUserIdentityHook(ctx context.Context, req *pb.RunUserIdentityHookRequest) (*pb.RunUserIdentityHookResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	result, err := models.SharedUserIdentityDAO.RunHook(tx, req.UserIdentityId)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errors.New("identity verification hook is not enabled")
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RunUserIdentityHookResponse{HookResultJSON: resultJSON}, nil
+}
+
+// ReadUserIdentityConfig 读取实名认证审核设置
+func (this *UserIdentityService) ReadUserIdentityConfig(ctx context.Context, req *pb.ReadUserIdentityConfigRequest) (*pb.ReadUserIdentityConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedUserIdentityDAO.ReadUserIdentityConfig(tx)
 	if err != nil {
 		return nil, err
 	}
+	config.Mask()
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadUserIdentityConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateUserIdentityConfig 修改实名认证审核设置
+func (this *UserIdentityService) UpdateUserIdentityConfig(ctx context.Context, req *pb.UpdateUserIdentityConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var config = identityutils.DefaultConfig()
+	err = json.Unmarshal(req.ConfigJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	var tx = this.NullTx()
 
+	// 保留没有修改的Header值
+	oldConfig, err := models.SharedUserIdentityDAO.ReadUserIdentityConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	config.UnmaskWith(oldConfig)
+
+	err = models.SharedUserIdentityDAO.UpdateUserIdentityConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
 	return this.Success()
 }
+
+// 检查证件文件是否属于当前用户
+func (this *UserIdentityService) checkUserFiles(tx *dbs.Tx, userId int64, fileIds []int64) error {
+	for _, fileId := range fileIds {
+		err := models.SharedFileDAO.CheckUserFile(tx, userId, fileId)
+		if err != nil {
+			if err == models.ErrNotFound {
+				return errors.New("invalid file '" + types.String(fileId) + "'")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// 转换认证信息，forAdmin 为 true 时包含审核相关信息
+func (this *UserIdentityService) convertUserIdentity(identity *models.UserIdentity, forAdmin bool) *pb.UserIdentity {
+	var pbIdentity = &pb.UserIdentity{
+		Id:           int64(identity.Id),
+		UserId:       int64(identity.UserId),
+		OrgType:      identity.OrgType,
+		Type:         identity.Type,
+		RealName:     identity.RealName,
+		Number:       identity.Number,
+		FileIds:      identity.DecodeFileIds(),
+		Status:       identity.Status,
+		CreatedAt:    int64(identity.CreatedAt),
+		UpdatedAt:    int64(identity.UpdatedAt),
+		SubmittedAt:  int64(identity.SubmittedAt),
+		RejectedAt:   int64(identity.RejectedAt),
+		VerifiedAt:   int64(identity.VerifiedAt),
+		RejectReason: identity.RejectReason,
+	}
+	if forAdmin {
+		pbIdentity.ReviewerId = int64(identity.ReviewerId)
+		if models.IsNotNull(identity.HookResult) {
+			pbIdentity.HookResultJSON = identity.HookResult
+		}
+	}
+	return pbIdentity
+}
@@ -0,0 +1,488 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/webauthnutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+// WebAuthnService WebAuthn和第二认证因素相关服务
+type WebAuthnService struct {
+	BaseService
+}
+
+// ReadWebAuthnConfig 读取第二认证因素设置
+func (this *WebAuthnService) ReadWebAuthnConfig(ctx context.Context, req *pb.ReadWebAuthnConfigRequest) (*pb.ReadWebAuthnConfigResponse, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedWebAuthnSessionDAO.ReadWebAuthnConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReadWebAuthnConfigResponse{ConfigJSON: configJSON}, nil
+}
+
+// UpdateWebAuthnConfig 修改第二认证因素设置
+func (this *WebAuthnService) UpdateWebAuthnConfig(ctx context.Context, req *pb.UpdateWebAuthnConfigRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var config = webauthnutils.DefaultConfig()
+	err = json.Unmarshal(req.ConfigJSON, config)
+	if err != nil {
+		return nil, errors.New("decode config failed: " + err.Error())
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedWebAuthnSessionDAO.UpdateWebAuthnConfig(tx, config)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// BeginWebAuthnRegistration 开始为当前管理员或用户注册凭证，返回浏览器需要的选项
+func (this *WebAuthnService) BeginWebAuthnRegistration(ctx context.Context, req *pb.BeginWebAuthnRegistrationRequest) (*pb.BeginWebAuthnRegistrationResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		adminId = 0
+	}
+
+	var tx = this.NullTx()
+	config, err := this.readEnabledConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	name, displayName, err := this.findAccountName(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 排除已经注册过的认证器
+	credentials, err := this.findCredentials(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := models.SharedWebAuthnSessionDAO.CreateSession(tx, adminId, userId, models.WebAuthnSessionTypeRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	optionsJSON, err := json.Marshal(webauthnutils.NewCreationOptions(config, challenge, this.composeUserHandle(adminId, userId), name, displayName, credentials))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BeginWebAuthnRegistrationResponse{OptionsJSON: optionsJSON}, nil
+}
+
+// FinishWebAuthnRegistration 完成凭证注册
+func (this *WebAuthnService) FinishWebAuthnRegistration(ctx context.Context, req *pb.FinishWebAuthnRegistrationRequest) (*pb.FinishWebAuthnRegistrationResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		adminId = 0
+	}
+
+	var name = strings.TrimSpace(req.Name)
+	if len(name) == 0 {
+		return nil, errors.New("'name' should not be empty")
+	}
+	if len([]rune(name)) > 50 {
+		return nil, errors.New("'name' should not be longer than 50 characters")
+	}
+
+	var tx = this.NullTx()
+	config, err := this.readEnabledConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := webauthnutils.ParseChallenge(req.CredentialJSON)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := models.SharedWebAuthnSessionDAO.ConsumeSession(tx, adminId, userId, models.WebAuthnSessionTypeRegister, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("the registration has expired, please try again")
+	}
+
+	credential, err := webauthnutils.VerifyRegistration(config, challenge, req.CredentialJSON)
+	if err != nil {
+		return nil, errors.New("verify credential failed: " + err.Error())
+	}
+
+	loginId, err := models.SharedLoginDAO.CreateWebAuthnCredential(tx, adminId, userId, name, credential)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FinishWebAuthnRegistrationResponse{WebAuthnCredentialId: loginId}, nil
+}
+
+// FindAllWebAuthnCredentials 查找管理员或用户的所有凭证
+func (this *WebAuthnService) FindAllWebAuthnCredentials(ctx context.Context, req *pb.FindAllWebAuthnCredentialsRequest) (*pb.FindAllWebAuthnCredentialsResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.AdminId = 0
+		req.UserId = userId
+	}
+
+	var tx = this.NullTx()
+	logins, err := models.SharedLoginDAO.FindAllWebAuthnCredentials(tx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbCredentials = []*pb.WebAuthnCredential{}
+	for _, login := range logins {
+		credential, err := login.DecodeWebAuthnCredential()
+		if err != nil {
+			continue
+		}
+		var params = login.DecodeParams()
+		pbCredentials = append(pbCredentials, &pb.WebAuthnCredential{
+			Id:             int64(login.Id),
+			Name:           params.GetString("name"),
+			CreatedAt:      params.GetInt64("createdAt"),
+			LastUsedAt:     params.GetInt64("lastUsedAt"),
+			BackupEligible: credential.BackupEligible,
+			BackupState:    credential.BackupState,
+			Transports:     credential.Transports,
+		})
+	}
+	return &pb.FindAllWebAuthnCredentialsResponse{WebAuthnCredentials: pbCredentials}, nil
+}
+
+// DeleteWebAuthnCredential 删除凭证
+func (this *WebAuthnService) DeleteWebAuthnCredential(ctx context.Context, req *pb.DeleteWebAuthnCredentialRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		req.AdminId = 0
+		req.UserId = userId
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginDAO.DeleteWebAuthnCredential(tx, req.AdminId, req.UserId, req.WebAuthnCredentialId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// GenerateRecoveryCodes 为当前管理员或用户重新生成恢复码，旧的恢复码会失效
+// 恢复码明文只在这里返回一次
+func (this *WebAuthnService) GenerateRecoveryCodes(ctx context.Context, req *pb.GenerateRecoveryCodesRequest) (*pb.GenerateRecoveryCodesResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if userId > 0 {
+		adminId = 0
+	}
+
+	codes, hashes, err := webauthnutils.GenerateRecoveryCodes(webauthnutils.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedLoginDAO.UpdateRecoveryCodes(tx, adminId, userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GenerateRecoveryCodesResponse{Codes: codes}, nil
+}
+
+// FindSecondFactorStatus 登录时查找管理员或用户的第二认证因素状态
+func (this *WebAuthnService) FindSecondFactorStatus(ctx context.Context, req *pb.FindSecondFactorStatusRequest) (*pb.FindSecondFactorStatusResponse, error) {
+	adminId, userId, err := this.validateLoginNode(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := models.SharedWebAuthnSessionDAO.ReadWebAuthnConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	hasOTP, hasWebAuthn, err := models.SharedLoginDAO.CheckSecondFactor(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+	// 关闭WebAuthn之后已注册的凭证暂时不能使用
+	hasWebAuthn = hasWebAuthn && config.IsOn
+
+	countRecoveryCodes, err := models.SharedLoginDAO.CountRecoveryCodes(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var isRequired = (adminId > 0 && config.RequireForAdmins) || (userId > 0 && config.RequireForUsers)
+	return &pb.FindSecondFactorStatusResponse{
+		IsRequired:         isRequired,
+		HasOTP:             hasOTP,
+		HasWebAuthn:        hasWebAuthn,
+		CountRecoveryCodes: int32(countRecoveryCodes),
+		MustEnroll:         isRequired && !hasOTP && !hasWebAuthn, // 需要在登录后立即设置第二认证因素
+	}, nil
+}
+
+// BeginWebAuthnLogin 在密码校验通过后开始WebAuthn认证，返回浏览器需要的选项
+func (this *WebAuthnService) BeginWebAuthnLogin(ctx context.Context, req *pb.BeginWebAuthnLoginRequest) (*pb.BeginWebAuthnLoginResponse, error) {
+	adminId, userId, err := this.validateLoginNode(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := this.readEnabledConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := this.findCredentials(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		return nil, errors.New("no webauthn credentials registered")
+	}
+
+	challenge, err := models.SharedWebAuthnSessionDAO.CreateSession(tx, adminId, userId, models.WebAuthnSessionTypeLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	optionsJSON, err := json.Marshal(webauthnutils.NewRequestOptions(config, challenge, credentials))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BeginWebAuthnLoginResponse{OptionsJSON: optionsJSON}, nil
+}
+
+// FinishWebAuthnLogin 校验WebAuthn认证结果
+func (this *WebAuthnService) FinishWebAuthnLogin(ctx context.Context, req *pb.FinishWebAuthnLoginRequest) (*pb.FinishWebAuthnLoginResponse, error) {
+	adminId, userId, err := this.validateLoginNode(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	config, err := this.readEnabledConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var failResp = &pb.FinishWebAuthnLoginResponse{
+		IsOk:    false,
+		Message: "安全密钥认证失败，请重试",
+	}
+
+	challenge, err := webauthnutils.ParseChallenge(req.CredentialJSON)
+	if err != nil {
+		return failResp, nil
+	}
+	ok, err := models.SharedWebAuthnSessionDAO.ConsumeSession(tx, adminId, userId, models.WebAuthnSessionTypeLogin, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &pb.FinishWebAuthnLoginResponse{
+			IsOk:    false,
+			Message: "认证请求已失效，请重新登录",
+		}, nil
+	}
+
+	credentialId, err := webauthnutils.ParseCredentialId(req.CredentialJSON)
+	if err != nil {
+		return failResp, nil
+	}
+	login, err := models.SharedLoginDAO.FindWebAuthnCredential(tx, adminId, userId, credentialId)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil {
+		return failResp, nil
+	}
+	credential, err := login.DecodeWebAuthnCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := webauthnutils.VerifyAssertion(config, challenge, credential, this.composeUserHandle(adminId, userId), req.CredentialJSON)
+	if err != nil {
+		if errors.Is(err, webauthnutils.ErrSignCountRegression) {
+			remotelogs.Warn("WebAuthn", "sign count regression of credential '"+types.String(login.Id)+"', the authenticator may be cloned")
+		}
+		return failResp, nil
+	}
+
+	err = models.SharedLoginDAO.UpdateWebAuthnCredentialUsage(tx, login, result.SignCount, result.BackupState)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.SharedLoginAttemptDAO.RecordSecondFactorSuccess(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FinishWebAuthnLoginResponse{IsOk: true}, nil
+}
+
+// VerifyRecoveryCode 在无法使用第二认证因素时使用恢复码登录，每个恢复码只能使用一次
+func (this *WebAuthnService) VerifyRecoveryCode(ctx context.Context, req *pb.VerifyRecoveryCodeRequest) (*pb.VerifyRecoveryCodeResponse, error) {
+	adminId, userId, err := this.validateLoginNode(ctx, req.AdminId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查登录失败次数
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckSecondFactorLogin(this.NullTx(), adminId, userId, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return &pb.VerifyRecoveryCodeResponse{
+			IsOk:    false,
+			Message: passwordutils.RetryMessage(retryAfter),
+		}, nil
+	}
+
+	var ok bool
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		ok, err = models.SharedLoginDAO.UseRecoveryCode(tx, adminId, userId, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return models.SharedLoginAttemptDAO.RecordSecondFactorFailure(tx, adminId, userId, req.Ip)
+		}
+		return models.SharedLoginAttemptDAO.RecordSecondFactorSuccess(tx, adminId, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &pb.VerifyRecoveryCodeResponse{
+			IsOk:    false,
+			Message: "恢复码错误或者已经使用过",
+		}, nil
+	}
+	return &pb.VerifyRecoveryCodeResponse{IsOk: true}, nil
+}
+
+// 校验调用登录接口的节点，管理平台只能操作管理员，用户平台只能操作用户
+func (this *WebAuthnService) validateLoginNode(ctx context.Context, adminId int64, userId int64) (int64, int64, error) {
+	nodeRole, _, err := this.ValidateNodeId(ctx, rpcutils.UserTypeAdmin, rpcutils.UserTypeUser)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch nodeRole {
+	case rpcutils.UserTypeAdmin:
+		if adminId <= 0 {
+			return 0, 0, errors.New("invalid 'adminId'")
+		}
+		return adminId, 0, nil
+	case rpcutils.UserTypeUser:
+		if userId <= 0 {
+			return 0, 0, errors.New("invalid 'userId'")
+		}
+		return 0, userId, nil
+	}
+	return 0, 0, errors.New("invalid role '" + nodeRole + "'")
+}
+
+func (this *WebAuthnService) readEnabledConfig(tx *dbs.Tx) (*webauthnutils.Config, error) {
+	config, err := models.SharedWebAuthnSessionDAO.ReadWebAuthnConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !config.IsOn {
+		return nil, errors.New("webauthn is not enabled")
+	}
+	return config, nil
+}
+
+func (this *WebAuthnService) findCredentials(tx *dbs.Tx, adminId int64, userId int64) ([]*webauthnutils.Credential, error) {
+	logins, err := models.SharedLoginDAO.FindAllWebAuthnCredentials(tx, adminId, userId)
+	if err != nil {
+		return nil, err
+	}
+	var credentials = []*webauthnutils.Credential{}
+	for _, login := range logins {
+		credential, err := login.DecodeWebAuthnCredential()
+		if err != nil {
+			continue
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+func (this *WebAuthnService) findAccountName(tx *dbs.Tx, adminId int64, userId int64) (name string, displayName string, err error) {
+	if adminId > 0 {
+		admin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, adminId)
+		if err != nil {
+			return "", "", err
+		}
+		if admin == nil {
+			return "", "", errors.New("can not find admin '" + types.String(adminId) + "'")
+		}
+		return admin.Username, admin.Fullname, nil
+	}
+
+	user, err := models.SharedUserDAO.FindEnabledBasicUser(tx, userId)
+	if err != nil {
+		return "", "", err
+	}
+	if user == nil {
+		return "", "", errors.New("can not find user '" + types.String(userId) + "'")
+	}
+	return user.Username, user.Fullname, nil
+}
+
+// 凭证中的用户标识，管理员和用户使用不同的前缀，不包含个人信息
+func (this *WebAuthnService) composeUserHandle(adminId int64, userId int64) []byte {
+	if adminId > 0 {
+		return []byte("admin_" + types.String(adminId))
+	}
+	return []byte("user_" + types.String(userId))
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
@@ -35,6 +36,12 @@ func (this *UserService) CreateUser(ctx context.Context, req *pb.CreateUserReque
 
 	var tx = this.NullTx()
 
+	// 检查密码是否符合登录安全策略
+	err = models.SharedLoginDAO.CheckNewPassword(tx, 0, 0, req.Username, "", req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	userId, err := models.SharedUserDAO.CreateUser(tx, req.Username, req.Password, req.Fullname, req.Mobile, req.Tel, req.Email, req.Remark, req.Source, req.NodeClusterId, nil, "", true)
 	if err != nil {
 		return nil, err
@@ -282,6 +289,14 @@ func (this *UserService) CheckUserUsername(ctx context.Context, req *pb.CheckUse
 		return nil, this.PermissionError()
 	}
 
+	// 检查子用户权限
+	if userType == rpcutils.UserTypeUser && userId > 0 {
+		err = rpcutils.CheckSubUser(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var tx = this.NullTx()
 
 	b, err := models.SharedUserDAO.ExistUser(tx, req.UserId, req.Username)
@@ -320,6 +335,19 @@ func (this *UserService) LoginUser(ctx context.Context, req *pb.LoginUserRequest
 
 	var tx = this.NullTx()
 
+	// 检查登录失败次数
+	retryAfter, err := models.SharedLoginAttemptDAO.CheckLogin(tx, models.LoginAttemptRoleUser, req.Username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return &pb.LoginUserResponse{
+			UserId:  0,
+			IsOk:    false,
+			Message: passwordutils.RetryMessage(retryAfter),
+		}, nil
+	}
+
 	// 邮箱登录
 	var registerConfig *userconfigs.UserRegisterConfig
 	if strings.Contains(req.Username, "@") {
@@ -336,6 +364,10 @@ func (this *UserService) LoginUser(ctx context.Context, req *pb.LoginUserRequest
 				return nil, err
 			}
 			if userId > 0 {
+				err = models.SharedLoginAttemptDAO.RecordPasswordSuccess(tx, models.LoginAttemptRoleUser, req.Username, 0, userId)
+				if err != nil {
+					return nil, err
+				}
 				return &pb.LoginUserResponse{
 					UserId: userId,
 					IsOk:   true,
@@ -359,6 +391,10 @@ func (this *UserService) LoginUser(ctx context.Context, req *pb.LoginUserRequest
 				return nil, err
 			}
 			if userId > 0 {
+				err = models.SharedLoginAttemptDAO.RecordPasswordSuccess(tx, models.LoginAttemptRoleUser, req.Username, 0, userId)
+				if err != nil {
+					return nil, err
+				}
 				return &pb.LoginUserResponse{
 					UserId: userId,
 					IsOk:   true,
@@ -375,6 +411,11 @@ func (this *UserService) LoginUser(ctx context.Context, req *pb.LoginUserRequest
 	}
 
 	if userId <= 0 {
+		err = models.SharedLoginAttemptDAO.RecordLoginFailure(tx, models.LoginAttemptRoleUser, req.Username, req.Ip)
+		if err != nil {
+			return nil, err
+		}
+
 		return &pb.LoginUserResponse{
 			UserId:  0,
 			IsOk:    false,
@@ -382,6 +423,11 @@ func (this *UserService) LoginUser(ctx context.Context, req *pb.LoginUserRequest
 		}, nil
 	}
 
+	err = models.SharedLoginAttemptDAO.RecordPasswordSuccess(tx, models.LoginAttemptRoleUser, req.Username, 0, userId)
+	if err != nil {
+		return nil, err
+	}
+
 	return &pb.LoginUserResponse{
 		UserId: userId,
 		IsOk:   true,
@@ -447,7 +493,7 @@ func (this *UserService) ComposeUserDashboard(ctx context.Context, req *pb.Compo
 	}
 
 	// 网站数量
-	countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", req.UserId, 0, configutils.BoolStateAll, []string{}, 0)
+	countServers, err := models.SharedServerDAO.CountAllEnabledServersMatch(tx, 0, "", req.UserId, 0, configutils.BoolStateAll, []string{}, 0, nil)
 	if err != nil {
 		return nil, err
 	}
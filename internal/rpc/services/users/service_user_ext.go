@@ -8,6 +8,7 @@ import (
 	"errors"
 
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
 	"github.com/iwind/TeaGo/dbs"
 )
@@ -60,6 +61,12 @@ func (this *UserService) RegisterUser(ctx context.Context, req *pb.RegisterUserR
 		return nil, errors.New("the registration has been disabled")
 	}
 
+	// 检查密码是否符合登录安全策略
+	err = models.SharedLoginDAO.CheckNewPassword(tx, 0, 0, req.Username, "", req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	var requireEmailVerification = false
 	var createdUserId int64
 	err = this.RunTx(func(tx *dbs.Tx) error {
@@ -85,6 +92,19 @@ func (this *UserService) RegisterUser(ctx context.Context, req *pb.RegisterUserR
 	if err != nil {
 		return nil, err
 	}
+
+	// 发送邮箱验证邮件，发送失败时用户可以在登录后重新发送
+	if registerConfig.EmailVerification.IsOn && len(req.Email) > 0 {
+		err = this.RunTx(func(tx *dbs.Tx) error {
+			return models.SharedUserEmailVerificationDAO.CreateVerification(tx, createdUserId, req.Email)
+		})
+		if err != nil {
+			remotelogs.Warn("UserService", "send verification email to '"+req.Email+"' failed: "+err.Error())
+		} else {
+			requireEmailVerification = true
+		}
+	}
+
 	return &pb.RegisterUserResponse{
 		UserId:                   createdUserId,
 		RequireEmailVerification: requireEmailVerification,
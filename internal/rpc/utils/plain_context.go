@@ -14,8 +14,12 @@ func IsRest(ctx context.Context) bool {
 }
 
 type PlainContext struct {
-	UserType string
-	UserId   int64
+	UserType  string
+	UserId    int64
+	SubUserId int64 // 子用户ID
+
+	Method  string      // 调用的方法，格式为 Service/Method
+	Request interface{} // 请求对象
 
 	ctx context.Context
 }
@@ -0,0 +1,513 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rpcutils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/encrypt"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"google.golang.org/grpc/metadata"
+)
+
+type callContextKey struct{}
+
+// 当前调用的方法和请求
+type callInfo struct {
+	method  string
+	request interface{}
+}
+
+// WithCall 在上下文中记录当前调用的方法和请求，用于检查子用户权限
+func WithCall(ctx context.Context, fullMethod string, req interface{}) context.Context {
+	return context.WithValue(ctx, callContextKey{}, &callInfo{
+		method:  fullMethod,
+		request: req,
+	})
+}
+
+// FindCall 查找当前调用的方法和请求
+func FindCall(ctx context.Context) (method string, req interface{}) {
+	plainCtx, ok := ctx.(*PlainContext)
+	if ok {
+		return plainCtx.Method, plainCtx.Request
+	}
+
+	call, ok := ctx.Value(callContextKey{}).(*callInfo)
+	if ok && call != nil {
+		return call.method, call.request
+	}
+	return "", nil
+}
+
+// FindSubUserId 查找当前请求的子用户ID，不是子用户时返回0
+func FindSubUserId(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		return 0, nil
+	}
+
+	plainCtx, ok := ctx.(*PlainContext)
+	if ok {
+		return plainCtx.SubUserId, nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, nil
+	}
+	var nodeIds = md.Get("nodeid")
+	var tokens = md.Get("token")
+	if len(nodeIds) == 0 || len(nodeIds[0]) == 0 || len(tokens) == 0 || len(tokens[0]) == 0 {
+		return 0, nil
+	}
+	var nodeId = nodeIds[0]
+
+	apiToken, err := models.SharedApiTokenDAO.FindEnabledTokenWithNodeCacheable(nil, nodeId)
+	if err != nil {
+		return 0, err
+	}
+	if apiToken == nil || apiToken.Role != UserTypeUser {
+		return 0, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(tokens[0])
+	if err != nil {
+		return 0, err
+	}
+	method, err := encrypt.NewMethodInstance(teaconst.EncryptMethod, apiToken.Secret, nodeId)
+	if err != nil {
+		return 0, err
+	}
+	data, err = method.Decrypt(data)
+	if err != nil {
+		return 0, err
+	}
+
+	var m = maps.Map{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return 0, errors.New("decode token error: " + err.Error())
+	}
+	return m.GetInt64("subUserId"), nil
+}
+
+// FindSubUserPermissions 查找当前请求的子用户权限，不是子用户时返回nil
+// 不使用缓存，以便子用户被停用或修改权限后在所有API节点上立即生效
+func FindSubUserPermissions(ctx context.Context, userId int64) (*subuserutils.Permissions, error) {
+	subUserId, err := FindSubUserId(ctx)
+	if err != nil || subUserId <= 0 {
+		return nil, err
+	}
+
+	subUser, err := models.SharedSubUserDAO.FindEnabledSubUserWithId(nil, subUserId)
+	if err != nil {
+		return nil, err
+	}
+	if subUser == nil || !subUser.IsOn || int64(subUser.UserId) != userId {
+		return nil, errors.New("permission denied: the sub user is not available")
+	}
+	return subUser.DecodePermissions()
+}
+
+// FindSubUserServerScope 查找当前请求的子用户可以管理的服务范围，不是子用户或者不限制时返回nil
+func FindSubUserServerScope(ctx context.Context, userId int64) (*subuserutils.ServerScope, error) {
+	permissions, err := FindSubUserPermissions(ctx, userId)
+	if err != nil || permissions == nil {
+		return nil, err
+	}
+	if !permissions.ServerScope.IsLimited() {
+		return nil, nil
+	}
+	return permissions.ServerScope, nil
+}
+
+// CheckSubUser 检查子用户是否可以调用当前方法，以及是否可以操作请求中的服务、服务分组和它们的配置
+func CheckSubUser(ctx context.Context, userId int64) error {
+	permissions, err := FindSubUserPermissions(ctx, userId)
+	if err != nil || permissions == nil {
+		return err
+	}
+
+	fullMethod, req := FindCall(ctx)
+	if len(fullMethod) == 0 {
+		return errors.New("permission denied: unknown method")
+	}
+	if !permissions.AllowMethod(fullMethod) {
+		return errors.New("permission denied: the sub user can not call '" + fullMethod + "'")
+	}
+
+	var scope = permissions.ServerScope
+	if !scope.IsLimited() || req == nil {
+		return nil
+	}
+
+	var reqValue = reflect.Indirect(reflect.ValueOf(req))
+	if reqValue.Kind() != reflect.Struct {
+		return nil
+	}
+
+	// 无法解析到服务的配置
+	for _, fieldName := range subUserDeniedFields {
+		if findInt64Field(reqValue, fieldName) > 0 {
+			return errors.New("permission denied: the sub user can not access '" + fieldName + "'")
+		}
+	}
+
+	// 服务
+	var serverIds = []int64{}
+	if serverId := findInt64Field(reqValue, "ServerId"); serverId > 0 {
+		serverIds = append(serverIds, serverId)
+	}
+	serverIds = append(serverIds, findInt64SliceField(reqValue, "ServerIds")...)
+
+	// 服务分组
+	var serverGroupIds = []int64{}
+	if serverGroupId := findInt64Field(reqValue, "ServerGroupId"); serverGroupId > 0 {
+		serverGroupIds = append(serverGroupIds, serverGroupId)
+	}
+	serverGroupIds = append(serverGroupIds, findInt64SliceField(reqValue, "ServerGroupIds")...)
+
+	// 服务相关的配置
+	resolvedServerIds, resolvedServerGroupIds, err := resolveSubUserRequestServers(reqValue)
+	if err != nil {
+		return err
+	}
+	serverIds = append(serverIds, resolvedServerIds...)
+	serverGroupIds = append(serverGroupIds, resolvedServerGroupIds...)
+
+	// IP名单、WAF规则、证书等配置
+	ownerServerIds, ownerServerGroupIds, err := resolveSubUserRequestOwners(reqValue)
+	if err != nil {
+		return err
+	}
+	serverIds = append(serverIds, ownerServerIds...)
+	serverGroupIds = append(serverGroupIds, ownerServerGroupIds...)
+
+	for _, serverId := range serverIds {
+		groupIds, err := models.SharedServerDAO.FindServerGroupIds(nil, serverId)
+		if err != nil {
+			return err
+		}
+		if !scope.AllowServer(serverId, groupIds) {
+			return errors.New("permission denied: the sub user can not access the server")
+		}
+	}
+	for _, serverGroupId := range serverGroupIds {
+		if !scope.AllowServerGroup(serverGroupId) {
+			return errors.New("permission denied: the sub user can not access the server group")
+		}
+	}
+
+	return nil
+}
+
+// 无法解析到所属服务的配置ID字段，限制了服务范围的子用户不能操作
+var subUserDeniedFields = []string{"HeaderId", "NodeClusterId"}
+
+// 可以被多个服务共用的配置ID字段，必须能解析到所属的服务或服务分组，否则限制了服务范围的子用户不能操作
+func resolveSubUserRequestOwners(reqValue reflect.Value) (serverIds []int64, serverGroupIds []int64, err error) {
+	if len(findInt64SliceField(reqValue, "NodeClusterIds")) > 0 {
+		return nil, nil, errors.New("permission denied: the sub user can not access 'NodeClusterIds'")
+	}
+
+	var fieldFinders = []struct {
+		fieldNames []string
+		finder     func(id int64) (serverIds []int64, serverGroupIds []int64, err error)
+	}{
+		{[]string{"IpListId", "IpListIds"}, findIPListOwners},
+		{[]string{"IpItemId", "IpItemIds"}, findIPItemOwners},
+		{[]string{"FirewallRuleGroupId", "HttpFirewallRuleGroupId"}, findFirewallRuleGroupOwners},
+		{[]string{"FirewallRuleSetId", "HttpFirewallRuleSetId"}, findFirewallRuleSetOwners},
+		{[]string{"SslCertId", "SslCertIds"}, findSSLCertOwners},
+	}
+	for _, fieldFinder := range fieldFinders {
+		for _, fieldName := range fieldFinder.fieldNames {
+			var ids = appendPositive(findInt64SliceField(reqValue, fieldName), findInt64Field(reqValue, fieldName))
+			for _, id := range ids {
+				if id <= 0 {
+					continue
+				}
+				ownerServerIds, ownerServerGroupIds, findErr := fieldFinder.finder(id)
+				if findErr != nil {
+					return nil, nil, findErr
+				}
+				if len(ownerServerIds) == 0 && len(ownerServerGroupIds) == 0 {
+					return nil, nil, errors.New("permission denied: the sub user can not access '" + fieldName + "'")
+				}
+				serverIds = append(serverIds, ownerServerIds...)
+				serverGroupIds = append(serverGroupIds, ownerServerGroupIds...)
+			}
+		}
+	}
+	return
+}
+
+// 解析请求中的配置所属的服务和服务分组
+// 尚未被任何服务和分组使用的配置不返回结果
+func resolveSubUserRequestServers(reqValue reflect.Value) (serverIds []int64, serverGroupIds []int64, err error) {
+	var webIds = []int64{}
+	var addWebId = func(webId int64, err error) error {
+		if err != nil {
+			return err
+		}
+		if webId > 0 {
+			webIds = append(webIds, webId)
+		}
+		return nil
+	}
+
+	// Web
+	for _, fieldName := range []string{"HttpWebId", "WebId"} {
+		if webId := findInt64Field(reqValue, fieldName); webId > 0 {
+			webIds = append(webIds, webId)
+		}
+	}
+
+	// Web中的配置
+	var webFieldFinders = map[string]func(tx *dbs.Tx, id int64) (int64, error){
+		"HttpHeaderPolicyId": models.SharedHTTPWebDAO.FindEnabledWebIdWithHeaderPolicyId,
+		"HttpPageId":         models.SharedHTTPWebDAO.FindEnabledWebIdWithPageId,
+		"RewriteRuleId":      models.SharedHTTPWebDAO.FindEnabledWebIdWithRewriteRuleId,
+		"WebsocketId":        models.SharedHTTPWebDAO.FindEnabledWebIdWithWebsocketId,
+		"HttpFastcgiId":      models.SharedHTTPWebDAO.FindEnabledWebIdWithFastcgiId,
+		"HttpAuthPolicyId":   models.SharedHTTPWebDAO.FindEnabledWebIdWithHTTPAuthPolicyId,
+		"LocationId":         models.SharedHTTPWebDAO.FindEnabledWebIdWithLocationId,
+		"ParentId":           models.SharedHTTPWebDAO.FindEnabledWebIdWithLocationId,
+	}
+	for fieldName, finder := range webFieldFinders {
+		if id := findInt64Field(reqValue, fieldName); id > 0 {
+			err = addWebId(finder(nil, id))
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// 缓存策略和WAF策略
+	var policyFinders = map[string]func(tx *dbs.Tx, id int64) ([]int64, error){
+		"HttpCachePolicyId":    models.SharedHTTPWebDAO.FindAllWebIdsWithCachePolicyId,
+		"HttpFirewallPolicyId": models.SharedHTTPWebDAO.FindAllWebIdsWithHTTPFirewallPolicyId,
+	}
+	for fieldName, finder := range policyFinders {
+		if policyId := findInt64Field(reqValue, fieldName); policyId > 0 {
+			policyWebIds, findErr := finder(nil, policyId)
+			if findErr != nil {
+				return nil, nil, findErr
+			}
+			webIds = append(webIds, policyWebIds...)
+		}
+	}
+
+	// 源站和反向代理
+	var reverseProxyIds = appendPositive(nil, findInt64Field(reqValue, "ReverseProxyId"))
+	if originId := findInt64Field(reqValue, "OriginId"); originId > 0 {
+		reverseProxyId, findErr := models.SharedReverseProxyDAO.FindReverseProxyContainsOriginId(nil, originId)
+		if findErr != nil {
+			return nil, nil, findErr
+		}
+		reverseProxyIds = appendPositive(reverseProxyIds, reverseProxyId)
+	}
+	for _, reverseProxyId := range reverseProxyIds {
+		serverId, groupId, webId, findErr := findReverseProxyOwner(reverseProxyId)
+		if findErr != nil {
+			return nil, nil, findErr
+		}
+		serverIds = appendPositive(serverIds, serverId)
+		serverGroupIds = appendPositive(serverGroupIds, groupId)
+		webIds = appendPositive(webIds, webId)
+	}
+
+	// SSL策略
+	if sslPolicyId := findInt64Field(reqValue, "SslPolicyId"); sslPolicyId > 0 {
+		policyServerIds, findErr := models.SharedServerDAO.FindAllEnabledServerIdsWithSSLPolicyIds(nil, []int64{sslPolicyId})
+		if findErr != nil {
+			return nil, nil, findErr
+		}
+		serverIds = append(serverIds, policyServerIds...)
+	}
+
+	// 将Web转换为服务或者服务分组
+	webServerIds, webServerGroupIds, err := findWebOwners(webIds)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverIds = append(serverIds, webServerIds...)
+	serverGroupIds = append(serverGroupIds, webServerGroupIds...)
+
+	return
+}
+
+// 查找Web所属的服务或者服务分组
+func findWebOwners(webIds []int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	for _, webId := range webIds {
+		serverId, findErr := models.SharedHTTPWebDAO.FindWebServerId(nil, webId)
+		if findErr != nil {
+			return nil, nil, findErr
+		}
+		if serverId > 0 {
+			serverIds = append(serverIds, serverId)
+			continue
+		}
+
+		groupId, findErr := models.SharedHTTPWebDAO.FindWebServerGroupId(nil, webId)
+		if findErr != nil {
+			return nil, nil, findErr
+		}
+		serverGroupIds = appendPositive(serverGroupIds, groupId)
+	}
+	return
+}
+
+// 查找使用WAF策略的服务和服务分组
+func findFirewallPolicyOwners(policyId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	serverId, err := models.SharedHTTPFirewallPolicyDAO.FindServerIdWithFirewallPolicyId(nil, policyId)
+	if err != nil {
+		return
+	}
+	serverIds = appendPositive(serverIds, serverId)
+
+	webIds, err := models.SharedHTTPWebDAO.FindAllWebIdsWithHTTPFirewallPolicyId(nil, policyId)
+	if err != nil {
+		return
+	}
+	webServerIds, webServerGroupIds, err := findWebOwners(webIds)
+	if err != nil {
+		return
+	}
+	serverIds = append(serverIds, webServerIds...)
+	serverGroupIds = append(serverGroupIds, webServerGroupIds...)
+	return
+}
+
+// 查找WAF规则分组所属的服务和服务分组
+func findFirewallRuleGroupOwners(ruleGroupId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	policyId, err := models.SharedHTTPFirewallPolicyDAO.FindEnabledFirewallPolicyIdWithRuleGroupId(nil, ruleGroupId)
+	if err != nil || policyId <= 0 {
+		return
+	}
+	return findFirewallPolicyOwners(policyId)
+}
+
+// 查找WAF规则集所属的服务和服务分组
+func findFirewallRuleSetOwners(ruleSetId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	ruleGroupId, err := models.SharedHTTPFirewallRuleGroupDAO.FindRuleGroupIdWithRuleSetId(nil, ruleSetId)
+	if err != nil || ruleGroupId <= 0 {
+		return
+	}
+	return findFirewallRuleGroupOwners(ruleGroupId)
+}
+
+// 查找IP名单所属的服务和服务分组，包括直接属于服务的名单、WAF策略中引用的名单和WAF规则集中记录IP使用的名单
+func findIPListOwners(listId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	serverId, err := models.SharedIPListDAO.FindServerIdWithListId(nil, listId)
+	if err != nil {
+		return
+	}
+	serverIds = appendPositive(serverIds, serverId)
+
+	var appendOwners = func(ownerServerIds []int64, ownerServerGroupIds []int64, err error) error {
+		if err != nil {
+			return err
+		}
+		serverIds = append(serverIds, ownerServerIds...)
+		serverGroupIds = append(serverGroupIds, ownerServerGroupIds...)
+		return nil
+	}
+
+	policyIds, err := models.SharedHTTPFirewallPolicyDAO.FindEnabledFirewallPolicyIdsWithIPListId(nil, listId)
+	if err != nil {
+		return
+	}
+	for _, policyId := range policyIds {
+		err = appendOwners(findFirewallPolicyOwners(policyId))
+		if err != nil {
+			return
+		}
+	}
+
+	ruleSetIds, err := models.SharedHTTPFirewallRuleSetDAO.FindAllEnabledRuleSetIdsWithIPListId(nil, listId)
+	if err != nil {
+		return
+	}
+	for _, ruleSetId := range ruleSetIds {
+		err = appendOwners(findFirewallRuleSetOwners(ruleSetId))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 查找IP条目所属的服务和服务分组
+func findIPItemOwners(itemId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	listId, err := models.SharedIPItemDAO.FindItemListId(nil, itemId)
+	if err != nil || listId <= 0 {
+		return
+	}
+	return findIPListOwners(listId)
+}
+
+// 查找使用证书的服务
+func findSSLCertOwners(certId int64) (serverIds []int64, serverGroupIds []int64, err error) {
+	policyIds, err := models.SharedSSLPolicyDAO.FindAllEnabledPolicyIdsWithCertId(nil, certId)
+	if err != nil || len(policyIds) == 0 {
+		return
+	}
+	serverIds, err = models.SharedServerDAO.FindAllEnabledServerIdsWithSSLPolicyIds(nil, policyIds)
+	return
+}
+
+// 查找使用反向代理的服务、服务分组或者路由规则所在的Web
+func findReverseProxyOwner(reverseProxyId int64) (serverId int64, serverGroupId int64, webId int64, err error) {
+	serverId, err = models.SharedServerDAO.FindEnabledServerIdWithReverseProxyId(nil, reverseProxyId)
+	if err != nil || serverId > 0 {
+		return
+	}
+
+	serverGroupId, err = models.SharedServerGroupDAO.FindEnabledGroupIdWithReverseProxyId(nil, reverseProxyId)
+	if err != nil || serverGroupId > 0 {
+		return
+	}
+
+	locationId, err := models.SharedHTTPLocationDAO.FindEnabledLocationIdWithReverseProxyId(nil, reverseProxyId)
+	if err != nil || locationId <= 0 {
+		return
+	}
+	webId, err = models.SharedHTTPWebDAO.FindEnabledWebIdWithLocationId(nil, locationId)
+	return
+}
+
+func appendPositive(ids []int64, id int64) []int64 {
+	if id > 0 {
+		return append(ids, id)
+	}
+	return ids
+}
+
+func findInt64Field(structValue reflect.Value, fieldName string) int64 {
+	var field = structValue.FieldByName(fieldName)
+	if !field.IsValid() || field.Kind() != reflect.Int64 {
+		return 0
+	}
+	return field.Int()
+}
+
+func findInt64SliceField(structValue reflect.Value, fieldName string) []int64 {
+	var field = structValue.FieldByName(fieldName)
+	if !field.IsValid() || field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.Int64 {
+		return nil
+	}
+	var result = []int64{}
+	for i := 0; i < field.Len(); i++ {
+		result = append(result, field.Index(i).Int())
+	}
+	return result
+}
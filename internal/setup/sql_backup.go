@@ -0,0 +1,784 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package setup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+)
+
+const (
+	SQLBackupManifestFile = "manifest.json"
+	SQLBackupSchemaFile   = "schema.json"
+	SQLBackupFileExt      = ".tar.gz"
+
+	sqlBackupTablesDir  = "tables/"
+	sqlBackupInsertSize = 200 // 恢复时每次插入的行数
+	sqlBackupMaxRetries = 3   // 导出过程中结构发生变化时的最大重试次数
+)
+
+var errSQLBackupSchemaChanged = errors.New("schema changed during backup")
+
+// SQLBackupDir 默认的备份目录
+func SQLBackupDir() string {
+	return Tea.Root + "/data/backups"
+}
+
+// MakeSQLBackupDir 创建备份目录
+// 备份中包含密码和密钥等敏感信息，所以只允许当前用户访问
+func MakeSQLBackupDir() (string, error) {
+	var dir = SQLBackupDir()
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// 修正以前版本创建的目录权限
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// CreateSQLBackupFile 创建只有当前用户可以读写的备份文件
+func CreateSQLBackupFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
+
+// SQLBackupFilename 生成备份文件名
+func SQLBackupFilename() string {
+	return "edge-api-" + teaconst.Version + "-" + timeutil.Format("YmdHis") + SQLBackupFileExt
+}
+
+var sqlBackupStatsTableReg = regexp.MustCompile(`(?i)Stats(_\w+)?$`)
+var sqlBackupLogsTableReg = regexp.MustCompile(`(?i)Logs(_\w+)?$`)
+
+// SQLBackupOptions 备份选项
+type SQLBackupOptions struct {
+	ExcludeStats  bool     `json:"excludeStats"`  // 排除统计数据表
+	ExcludeLogs   bool     `json:"excludeLogs"`   // 排除日志表
+	ExcludeTables []string `json:"excludeTables"` // 排除的其他表
+}
+
+// IsExcluded 判断某个表是否被排除
+func (this *SQLBackupOptions) IsExcluded(tableName string) bool {
+	if this == nil {
+		return false
+	}
+
+	for _, excludedTable := range this.ExcludeTables {
+		if strings.EqualFold(excludedTable, tableName) {
+			return true
+		}
+	}
+
+	if this.ExcludeStats && (sqlBackupStatsTableReg.MatchString(tableName) || strings.EqualFold(tableName, "edgeNodeValues")) {
+		return true
+	}
+
+	// 订单日志属于账务数据，不作为日志处理
+	if this.ExcludeLogs && sqlBackupLogsTableReg.MatchString(tableName) && !strings.EqualFold(tableName, "edgeUserOrderLogs") {
+		return true
+	}
+
+	return false
+}
+
+// SQLBackupManifest 备份清单
+type SQLBackupManifest struct {
+	Version        string            `json:"version"`        // 备份时的API节点版本，也是数据库结构版本
+	CreatedAt      int64             `json:"createdAt"`      // 创建时间
+	DBName         string            `json:"dbName"`         // 数据库名
+	Options        *SQLBackupOptions `json:"options"`        // 备份选项
+	Tables         []*SQLBackupTable `json:"tables"`         // 已备份的表
+	ExcludedTables []string          `json:"excludedTables"` // 被排除的表
+	SchemaSHA256   string            `json:"schemaSHA256"`   // 结构文件校验和
+}
+
+// CountRows 备份的总行数
+func (this *SQLBackupManifest) CountRows() (count int64) {
+	for _, table := range this.Tables {
+		count += table.Rows
+	}
+	return
+}
+
+// IsOlder 备份是否比当前版本旧
+func (this *SQLBackupManifest) IsOlder() bool {
+	return stringutil.VersionCompare(this.Version, teaconst.Version) < 0
+}
+
+// SQLBackupTable 单个表的备份信息
+type SQLBackupTable struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`    // 在归档中的文件名
+	Columns []string `json:"columns"` // 字段列表
+	Rows    int64    `json:"rows"`    // 行数
+	Size    int64    `json:"size"`    // 文件尺寸
+	SHA256  string   `json:"sha256"`  // 文件校验和
+}
+
+// 二进制字段值
+type sqlBackupBinaryValue struct {
+	Base64 string `json:"base64"`
+}
+
+// SQLBackup 数据库逻辑备份和恢复
+// 备份文件为tar.gz格式，依次包含 manifest.json、schema.json 和 tables/*.jsonl，每个表文件中一行对应一条记录
+type SQLBackup struct {
+	db        *dbs.DB
+	logWriter io.Writer
+}
+
+func NewSQLBackup(db *dbs.DB) *SQLBackup {
+	return &SQLBackup{
+		db: db,
+	}
+}
+
+func (this *SQLBackup) SetLogWriter(logWriter io.Writer) {
+	this.logWriter = logWriter
+}
+
+// Backup 备份数据库到writer
+// 所有表的结构和数据都在同一个一致性快照中读取
+func (this *SQLBackup) Backup(writer io.Writer, options *SQLBackupOptions) (*SQLBackupManifest, error) {
+	if options == nil {
+		options = &SQLBackupOptions{}
+	}
+
+	// 先将每个表的数据写入临时文件，以便计算尺寸和校验和
+	tmpDir, err := os.MkdirTemp("", "edge-api-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	var schema *SQLDumpResult
+	var manifest *SQLBackupManifest
+	for retries := 0; ; retries++ {
+		// 结构
+		schema, err = NewSQLDump().Dump(this.db, false)
+		if err != nil {
+			return nil, fmt.Errorf("dump schema failed: %w", err)
+		}
+
+		manifest = &SQLBackupManifest{
+			Version:        teaconst.Version,
+			CreatedAt:      time.Now().Unix(),
+			DBName:         this.db.Name(),
+			Options:        options,
+			Tables:         []*SQLBackupTable{},
+			ExcludedTables: []string{},
+		}
+
+		var tables = []*SQLTable{}
+		for _, table := range schema.Tables {
+			if options.IsExcluded(table.Name) {
+				manifest.ExcludedTables = append(manifest.ExcludedTables, table.Name)
+				continue
+			}
+			tables = append(tables, table)
+		}
+
+		err = this.dumpTables(tmpDir, tables, manifest)
+		if err == errSQLBackupSchemaChanged && retries < sqlBackupMaxRetries {
+			this.log("schema changed during backup, retrying ...")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	manifest.SchemaSHA256 = this.sum(schemaJSON)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// 写入归档
+	var gzipWriter = gzip.NewWriter(writer)
+	var tarWriter = tar.NewWriter(gzipWriter)
+	err = this.writeTarData(tarWriter, SQLBackupManifestFile, manifestJSON)
+	if err != nil {
+		return nil, err
+	}
+	err = this.writeTarData(tarWriter, SQLBackupSchemaFile, schemaJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range manifest.Tables {
+		err = this.writeTarFile(tarWriter, table.File, tmpDir+"/"+table.Name+".jsonl")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tarWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// ReadManifest 读取备份清单，不校验数据
+func (this *SQLBackup) ReadManifest(reader io.Reader) (*SQLBackupManifest, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup file: %w", err)
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+
+	var tarReader = tar.NewReader(gzipReader)
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup file: %w", err)
+	}
+	if header.Name != SQLBackupManifestFile {
+		return nil, errors.New("invalid backup file: '" + SQLBackupManifestFile + "' not found")
+	}
+	return this.decodeManifest(tarReader)
+}
+
+// Verify 校验备份文件中所有文件的校验和
+func (this *SQLBackup) Verify(reader io.Reader) (*SQLBackupManifest, error) {
+	var manifest *SQLBackupManifest
+	err := this.walk(reader, func(m *SQLBackupManifest) error {
+		manifest = m
+		return nil
+	}, func(schema *SQLDumpResult) error {
+		return nil
+	}, func(table *SQLBackupTable, reader io.Reader) error {
+		var hash = sha256.New()
+		_, err := io.Copy(hash, reader)
+		if err != nil {
+			return err
+		}
+		if fmt.Sprintf("%x", hash.Sum(nil)) != table.SHA256 {
+			return errors.New("checksum mismatch for table '" + table.Name + "'")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Restore 从备份文件恢复数据
+// 会先校验整个文件，然后将数据导入到当前的数据库结构中：
+// 当前不存在的表按备份时的结构创建，已有的表不会删除或修改任何字段，备份之后新增的字段使用默认值，当前已不存在的字段会被忽略；
+// 所有表的数据在同一个事务中导入，失败时已有数据保持不变。
+// 备份中不包含的表（比如被排除的统计表和日志表）保持不变。
+// 恢复之后如果备份版本比当前版本旧，需要调用方继续执行升级。
+func (this *SQLBackup) Restore(archiveFile string) (*SQLBackupManifest, error) {
+	// 校验
+	fp, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := this.Verify(fp)
+	_ = fp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("verify backup failed: %w", err)
+	}
+
+	if stringutil.VersionCompare(manifest.Version, teaconst.Version) > 0 {
+		return nil, errors.New("the backup was created by a newer version '" + manifest.Version + "', current version is '" + teaconst.Version + "'")
+	}
+
+	// 导入
+	fp, err = os.Open(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	var tx *dbs.Tx
+	var currentSchema *SQLDumpResult
+	err = this.walk(fp, func(m *SQLBackupManifest) error {
+		return nil
+	}, func(schema *SQLDumpResult) error {
+		this.log("restoring schema of version " + manifest.Version + " ...")
+		var schemaErr error
+		currentSchema, schemaErr = this.createMissingTables(schema)
+		if schemaErr != nil {
+			return schemaErr
+		}
+
+		// 建表语句会隐式提交事务，所以在建表之后再开始事务
+		tx, schemaErr = this.db.Begin()
+		return schemaErr
+	}, func(table *SQLBackupTable, reader io.Reader) error {
+		var currentTable = currentSchema.FindTable(table.Name)
+		if currentTable == nil {
+			return errors.New("can not find table '" + table.Name + "' in current database")
+		}
+		this.log("restoring table '" + table.Name + "', " + types.String(table.Rows) + " rows ...")
+		return this.restoreTable(tx, table, currentTable, reader)
+	})
+	if err != nil {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+		return nil, err
+	}
+	if tx != nil {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// 创建当前数据库中不存在的表，已有的表保持不变，返回创建之后的数据库结构
+func (this *SQLBackup) createMissingTables(schema *SQLDumpResult) (*SQLDumpResult, error) {
+	currentSchema, err := NewSQLDump().Dump(this.db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var hasNewTables = false
+	for _, table := range schema.Tables {
+		if currentSchema.FindTable(table.Name) != nil {
+			continue
+		}
+		this.log("creating table '" + table.Name + "' ...")
+		_, err = this.db.Exec(table.Definition)
+		if err != nil {
+			return nil, fmt.Errorf("create table '%s' failed: %w", table.Name, err)
+		}
+		hasNewTables = true
+	}
+	if !hasNewTables {
+		return currentSchema, nil
+	}
+	return NewSQLDump().Dump(this.db, false)
+}
+
+// 在一致性快照中导出所有表
+// 会先锁定所有表的结构，并确认结构和导出的结构一致，以免结构和数据不匹配
+func (this *SQLBackup) dumpTables(dir string, tables []*SQLTable, manifest *SQLBackupManifest) error {
+	var ctx = context.Background()
+	conn, err := this.db.Raw().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, err = conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(ctx, "COMMIT")
+	}()
+
+	// 读取表后，事务结束之前其他连接无法修改表结构
+	for _, table := range tables {
+		rows, err := conn.QueryContext(ctx, "SELECT 1 FROM `"+table.Name+"` LIMIT 0")
+		if err != nil {
+			return fmt.Errorf("lock table '%s' failed: %w", table.Name, err)
+		}
+		_ = rows.Close()
+	}
+	for _, table := range tables {
+		var name string
+		var definition string
+		err = conn.QueryRowContext(ctx, "SHOW CREATE TABLE `"+table.Name+"`").Scan(&name, &definition)
+		if err != nil {
+			return err
+		}
+		if sqlAutoIncrementReg.ReplaceAllString(definition, "") != table.Definition {
+			return errSQLBackupSchemaChanged
+		}
+	}
+
+	for _, table := range tables {
+		this.log("dumping table '" + table.Name + "' ...")
+		backupTable, err := this.dumpTable(ctx, conn, dir, table.Name)
+		if err != nil {
+			if strings.Contains(err.Error(), "Table definition has changed") {
+				return errSQLBackupSchemaChanged
+			}
+			return fmt.Errorf("dump table '%s' failed: %w", table.Name, err)
+		}
+		manifest.Tables = append(manifest.Tables, backupTable)
+	}
+	return nil
+}
+
+func (this *SQLBackup) dumpTable(ctx context.Context, conn *sql.Conn, dir string, tableName string) (*SQLBackupTable, error) {
+	fp, err := CreateSQLBackupFile(dir + "/" + tableName + ".jsonl")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	var hash = sha256.New()
+	var counter = &sqlBackupCounter{}
+	var bufWriter = bufio.NewWriter(io.MultiWriter(fp, hash, counter))
+	var encoder = json.NewEncoder(bufWriter)
+
+	rows, err := conn.QueryContext(ctx, "SELECT * FROM `"+tableName+"`")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var table = &SQLBackupTable{
+		Name:    tableName,
+		File:    sqlBackupTablesDir + tableName + ".jsonl",
+		Columns: columns,
+	}
+
+	var rawValues = make([]sql.RawBytes, len(columns))
+	var dest = make([]any, len(columns))
+	for i := range rawValues {
+		dest[i] = &rawValues[i]
+	}
+	var values = make([]any, len(columns))
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		for i, rawValue := range rawValues {
+			if rawValue == nil {
+				values[i] = nil
+			} else if utf8.Valid(rawValue) {
+				values[i] = string(rawValue)
+			} else {
+				values[i] = &sqlBackupBinaryValue{Base64: base64.StdEncoding.EncodeToString(rawValue)}
+			}
+		}
+		err = encoder.Encode(values)
+		if err != nil {
+			return nil, err
+		}
+		table.Rows++
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bufWriter.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	table.Size = counter.n
+	table.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+	return table, nil
+}
+
+// 恢复单个表
+// 只导入当前表中仍然存在的字段
+func (this *SQLBackup) restoreTable(tx *dbs.Tx, table *SQLBackupTable, currentTable *SQLTable, reader io.Reader) error {
+	// 这里不使用TRUNCATE，因为TRUNCATE会隐式提交事务
+	_, err := tx.Exec("DELETE FROM `" + table.Name + "`")
+	if err != nil {
+		return err
+	}
+
+	var quotedColumns = []string{}
+	var columnIndexes = []int{}
+	for index, column := range table.Columns {
+		if currentTable.FindField(column) == nil {
+			this.log("  skip column '" + column + "' that no longer exists")
+			continue
+		}
+		quotedColumns = append(quotedColumns, "`"+column+"`")
+		columnIndexes = append(columnIndexes, index)
+	}
+	if len(quotedColumns) == 0 {
+		return nil
+	}
+
+	var placeholder = "(" + strings.TrimSuffix(strings.Repeat("?, ", len(quotedColumns)), ", ") + ")"
+	var prefix = "INSERT INTO `" + table.Name + "` (" + strings.Join(quotedColumns, ", ") + ") VALUES "
+
+	var countRows = 0
+	var args = []any{}
+	var flush = func() error {
+		if countRows == 0 {
+			return nil
+		}
+		_, err := tx.Exec(prefix+strings.TrimSuffix(strings.Repeat(placeholder+", ", countRows), ", "), args...)
+		countRows = 0
+		args = args[:0]
+		return err
+	}
+
+	var decoder = json.NewDecoder(reader)
+	for {
+		var values = []json.RawMessage{}
+		err = decoder.Decode(&values)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if len(values) != len(table.Columns) {
+			return errors.New("invalid row in table '" + table.Name + "': expected " + types.String(len(table.Columns)) + " values, got " + types.String(len(values)))
+		}
+		for _, index := range columnIndexes {
+			value, err := this.decodeValue(values[index])
+			if err != nil {
+				return err
+			}
+			args = append(args, value)
+		}
+		countRows++
+		if countRows >= sqlBackupInsertSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+func (this *SQLBackup) decodeValue(rawValue json.RawMessage) (any, error) {
+	if len(rawValue) == 0 || string(rawValue) == "null" {
+		return nil, nil
+	}
+	if rawValue[0] == '{' {
+		var binaryValue = &sqlBackupBinaryValue{}
+		err := json.Unmarshal(rawValue, binaryValue)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(binaryValue.Base64)
+	}
+	var s string
+	err := json.Unmarshal(rawValue, &s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 按顺序读取归档中的文件
+func (this *SQLBackup) walk(reader io.Reader, onManifest func(manifest *SQLBackupManifest) error, onSchema func(schema *SQLDumpResult) error, onTable func(table *SQLBackupTable, reader io.Reader) error) error {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return fmt.Errorf("invalid backup file: %w", err)
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+
+	var tarReader = tar.NewReader(gzipReader)
+	var manifest *SQLBackupManifest
+	var foundSchema = false
+	var foundTables = map[string]bool{}
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		switch {
+		case header.Name == SQLBackupManifestFile:
+			manifest, err = this.decodeManifest(tarReader)
+			if err != nil {
+				return err
+			}
+			err = onManifest(manifest)
+			if err != nil {
+				return err
+			}
+		case header.Name == SQLBackupSchemaFile:
+			if manifest == nil {
+				return errors.New("invalid backup file: '" + SQLBackupManifestFile + "' should be the first file")
+			}
+			schemaJSON, err := io.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+			if this.sum(schemaJSON) != manifest.SchemaSHA256 {
+				return errors.New("checksum mismatch for '" + SQLBackupSchemaFile + "'")
+			}
+			var schema = &SQLDumpResult{}
+			err = json.Unmarshal(schemaJSON, schema)
+			if err != nil {
+				return fmt.Errorf("decode schema failed: %w", err)
+			}
+			foundSchema = true
+			err = onSchema(schema)
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(header.Name, sqlBackupTablesDir):
+			if manifest == nil || !foundSchema {
+				return errors.New("invalid backup file: table data should be after manifest and schema")
+			}
+			var table = this.findTable(manifest, header.Name)
+			if table == nil {
+				return errors.New("invalid backup file: unknown file '" + header.Name + "'")
+			}
+			foundTables[table.Name] = true
+			err = onTable(table, tarReader)
+			if err != nil {
+				return fmt.Errorf("table '%s': %w", table.Name, err)
+			}
+		}
+	}
+
+	if manifest == nil {
+		return errors.New("invalid backup file: '" + SQLBackupManifestFile + "' not found")
+	}
+	if !foundSchema {
+		return errors.New("invalid backup file: '" + SQLBackupSchemaFile + "' not found")
+	}
+	for _, table := range manifest.Tables {
+		if !foundTables[table.Name] {
+			return errors.New("invalid backup file: data of table '" + table.Name + "' not found")
+		}
+	}
+	return nil
+}
+
+func (this *SQLBackup) decodeManifest(reader io.Reader) (*SQLBackupManifest, error) {
+	var manifest = &SQLBackupManifest{}
+	err := json.NewDecoder(reader).Decode(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest failed: %w", err)
+	}
+	if len(manifest.Version) == 0 {
+		return nil, errors.New("invalid manifest: version is empty")
+	}
+	return manifest, nil
+}
+
+func (this *SQLBackup) findTable(manifest *SQLBackupManifest, file string) *SQLBackupTable {
+	for _, table := range manifest.Tables {
+		if table.File == file {
+			return table
+		}
+	}
+	return nil
+}
+
+func (this *SQLBackup) writeTarData(tarWriter *tar.Writer, name string, data []byte) error {
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(data)
+	return err
+}
+
+func (this *SQLBackup) writeTarFile(tarWriter *tar.Writer, name string, path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	stat, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, fp)
+	return err
+}
+
+func (this *SQLBackup) sum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func (this *SQLBackup) log(message string) {
+	if this.logWriter != nil {
+		_, _ = this.logWriter.Write([]byte(message + "\n"))
+	}
+}
+
+// 计算写入的字节数
+type sqlBackupCounter struct {
+	n int64
+}
+
+func (this *sqlBackupCounter) Write(p []byte) (int, error) {
+	this.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,63 @@
+package setup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestSQLBackupOptions_IsExcluded(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var options = &SQLBackupOptions{
+		ExcludeStats:  true,
+		ExcludeLogs:   true,
+		ExcludeTables: []string{"edgeLoginSessions"},
+	}
+	a.IsTrue(options.IsExcluded("edgeServerDailyStats"))
+	a.IsTrue(options.IsExcluded("edgeServerDomainHourlyStats_1"))
+	a.IsTrue(options.IsExcluded("edgeNodeValues"))
+	a.IsTrue(options.IsExcluded("edgeNodeLogs"))
+	a.IsTrue(options.IsExcluded("edgeloginsessions"))
+	a.IsFalse(options.IsExcluded("edgeServerStatBoards"))
+	a.IsFalse(options.IsExcluded("edgeUserOrderLogs"))
+	a.IsFalse(options.IsExcluded("edgeServers"))
+
+	var nilOptions *SQLBackupOptions
+	a.IsFalse(nilOptions.IsExcluded("edgeServerDailyStats"))
+}
+
+func TestSQLBackup_Backup(t *testing.T) {
+	db, err := dbs.NewInstanceFromConfig(&dbs.DBConfig{
+		Driver: "mysql",
+		Dsn:    "root:123456@tcp(127.0.0.1:3306)/db_edge?charset=utf8mb4&timeout=30s",
+		Prefix: "edge",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var buf = &bytes.Buffer{}
+	var backup = NewSQLBackup(db)
+	manifest, err := backup.Backup(buf, &SQLBackupOptions{
+		ExcludeStats: true,
+		ExcludeLogs:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("tables:", len(manifest.Tables), "rows:", manifest.CountRows(), "size:", buf.Len())
+
+	verifiedManifest, err := backup.Verify(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifiedManifest.CountRows() != manifest.CountRows() {
+		t.Fatal("rows mismatch")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/dbs"
@@ -85,6 +86,8 @@ func (this *SQLDump) SetLogWriter(logWriter io.Writer) {
 	this.logWriter = logWriter
 }
 
+var sqlAutoIncrementReg = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
 // Dump 导出数据
 func (this *SQLDump) Dump(db *dbs.DB, includingRecords bool) (result *SQLDumpResult, err error) {
 	result = &SQLDumpResult{}
@@ -99,8 +102,6 @@ func (this *SQLDump) Dump(db *dbs.DB, includingRecords bool) (result *SQLDumpRes
 		return nil, err
 	}
 
-	var autoIncrementReg = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
-
 	for _, table := range fullTableMap {
 		var tableName = table.Name
 
@@ -116,7 +117,7 @@ func (this *SQLDump) Dump(db *dbs.DB, includingRecords bool) (result *SQLDumpRes
 			Name:       table.Name,
 			Engine:     table.Engine,
 			Charset:    table.Collation,
-			Definition: autoIncrementReg.ReplaceAllString(table.Code, ""),
+			Definition: sqlAutoIncrementReg.ReplaceAllString(table.Code, ""),
 		}
 
 		// 字段
@@ -251,61 +252,161 @@ func (this *SQLDump) Apply(db *dbs.DB, newResult *SQLDumpResult, showLog bool) (
 	return nil, sqlErrors[0]
 }
 
+// ApplyWithJournal 逐个执行升级操作，并将结果记录到升级日志中
+// 已经完成的操作在重新执行时会被跳过；单个操作失败不会中止其他操作，所有失败的操作都会在结果中返回
+func (this *SQLDump) ApplyWithJournal(db *dbs.DB, newResult *SQLDumpResult, showLog bool) (result *SQLApplyResult, err error) {
+	var journal = NewSQLJournal(db)
+	err = journal.Init()
+	if err != nil {
+		return nil, fmt.Errorf("init journal failed: %w", err)
+	}
+
+	plan, err := this.Plan(db, newResult)
+	if err != nil {
+		return nil, err
+	}
+
+	doneOpIds, err := journal.FindDoneOpIds(plan.Version)
+	if err != nil {
+		return nil, fmt.Errorf("read journal failed: %w", err)
+	}
+
+	result = &SQLApplyResult{
+		Version:  plan.Version,
+		CountOps: len(plan.Ops),
+	}
+
+	for index, op := range plan.Ops {
+		if doneOpIds[op.Id] {
+			result.CountSkipped++
+			continue
+		}
+
+		if showLog && op.IsDDL() {
+			this.log("[" + types.String(index+1) + "/" + types.String(len(plan.Ops)) + "] " + op.Description)
+		}
+
+		var before = time.Now()
+		var opErr = this.executeOp(db, op)
+		err = journal.Record(plan.Version, op, opErr, time.Since(before))
+		if err != nil {
+			return result, err
+		}
+		if opErr != nil {
+			result.FailedOps = append(result.FailedOps, &SQLOpError{
+				Op:    op,
+				Error: opErr.Error(),
+			})
+			if showLog {
+				this.log("  ERROR: " + opErr.Error())
+			}
+			continue
+		}
+		result.CountDone++
+	}
+
+	if !result.IsOk() {
+		return result, fmt.Errorf("%d of %d operations failed, first error: %s", len(result.FailedOps), len(plan.Ops), result.FailedOps[0].Error)
+	}
+
+	// 升级数据
+	err = UpgradeSQLData(db)
+	if err != nil {
+		return result, errors.New("upgrade data failed: " + err.Error())
+	}
+
+	return result, nil
+}
+
 func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bool, queue chan *sqlItem) (ops []string, err error) {
-	var execSQL = func(sqlString string, args ...any) {
-		queue <- &sqlItem{
-			sqlString: sqlString,
-			args:      args,
+	plan, err := this.Plan(db, newResult)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range plan.Ops {
+		ops = append(ops, op.Description)
+
+		// 不记录详细的记录日志，防止小白用户误解日志内容
+		if showLog && op.IsDDL() {
+			this.log(op.Description)
+		}
+
+		if op.isAsync {
+			for _, stmt := range op.Statements {
+				queue <- &sqlItem{
+					sqlString: stmt.SQL,
+					args:      stmt.Args,
+				}
+			}
+			continue
+		}
+
+		err = this.executeOp(db, op)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	return
+}
+
+// Plan 对比当前数据库和新的结构，生成升级计划，但不执行
+func (this *SQLDump) Plan(db *dbs.DB, newResult *SQLDumpResult) (plan *SQLPlan, err error) {
+	plan = &SQLPlan{
+		Version: ComposeSQLVersion(),
+	}
+
 	currentResult, err := this.Dump(db, false)
 	if err != nil {
 		return nil, err
 	}
 
-	// 新增表格
+	tableSizes, err := this.findTableSizes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var addOp = func(op *SQLOp) {
+		var size = tableSizes[strings.ToLower(op.Table)]
+		if size != nil {
+			op.TableRows = size.rows
+			op.TableBytes = size.bytes
+		}
+		op.init()
+		plan.Ops = append(plan.Ops, op)
+	}
+
 	for _, newTable := range newResult.Tables {
 		var oldTable = currentResult.FindTable(newTable.Name)
 		if oldTable == nil {
-			var op = "+ table " + newTable.Name
-			ops = append(ops, op)
-			if showLog {
-				this.log(op)
-			}
-			if len(newTable.Records) == 0 {
-				execSQL(newTable.Definition)
-			} else {
-				_, err = db.Exec(newTable.Definition)
-				if err != nil {
-					return nil, errors.New("'" + op + "' failed: " + err.Error())
-				}
-			}
+			// 新增表格
+			addOp(&SQLOp{
+				Type:        SQLOpTypeCreateTable,
+				Table:       newTable.Name,
+				Description: "+ table " + newTable.Name,
+				Statements:  []*SQLStatement{{SQL: newTable.Definition}},
+				isAsync:     len(newTable.Records) == 0,
+			})
 		} else if oldTable.Definition != newTable.Definition {
 			// 对比字段
 			// +
 			for _, newField := range newTable.Fields {
 				var oldField = oldTable.FindField(newField.Name)
 				if oldField == nil {
-					var op = "+ " + newTable.Name + " " + newField.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + newTable.Name + " ADD `" + newField.Name + "` " + newField.Definition)
-					if err != nil {
-						return nil, errors.New("'" + op + "' failed: " + err.Error())
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeAddField,
+						Table:       newTable.Name,
+						Description: "+ " + newTable.Name + " " + newField.Name,
+						Statements:  []*SQLStatement{{SQL: "ALTER TABLE " + newTable.Name + " ADD `" + newField.Name + "` " + newField.Definition}},
+					})
 				} else if !newField.EqualDefinition(oldField.Definition) {
-					var op = "* " + newTable.Name + " " + newField.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + newTable.Name + " MODIFY `" + newField.Name + "` " + newField.Definition)
-					if err != nil {
-						return nil, errors.New("'" + op + "' failed: " + err.Error())
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeModifyField,
+						Table:       newTable.Name,
+						Description: "* " + newTable.Name + " " + newField.Name,
+						Statements:  []*SQLStatement{{SQL: "ALTER TABLE " + newTable.Name + " MODIFY `" + newField.Name + "` " + newField.Definition}},
+					})
 				}
 			}
 
@@ -314,35 +415,22 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 			for _, newIndex := range newTable.Indexes {
 				var oldIndex = oldTable.FindIndex(newIndex.Name)
 				if oldIndex == nil {
-					var op = "+ index " + newTable.Name + " " + newIndex.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + newTable.Name + " ADD " + newIndex.Definition)
-					if err != nil {
-						err = this.tryCreateIndex(err, db, newTable.Name, newIndex.Definition)
-						if err != nil {
-							return nil, errors.New("'" + op + "' failed: " + err.Error())
-						}
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeAddIndex,
+						Table:       newTable.Name,
+						Description: "+ index " + newTable.Name + " " + newIndex.Name,
+						Statements:  []*SQLStatement{{SQL: "ALTER TABLE " + newTable.Name + " ADD " + newIndex.Definition, isIndex: true}},
+					})
 				} else if oldIndex.Definition != newIndex.Definition {
-					var op = "* index " + newTable.Name + " " + newIndex.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + newTable.Name + " DROP KEY " + newIndex.Name)
-					if err != nil {
-						return nil, errors.New("'" + op + "' drop old key failed: " + err.Error())
-					}
-					_, err = db.Exec("ALTER TABLE " + newTable.Name + " ADD " + newIndex.Definition)
-					if err != nil {
-						err = this.tryCreateIndex(err, db, newTable.Name, newIndex.Definition)
-						if err != nil {
-							return nil, errors.New("'" + op + "' failed: " + err.Error())
-						}
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeModifyIndex,
+						Table:       newTable.Name,
+						Description: "* index " + newTable.Name + " " + newIndex.Name,
+						Statements: []*SQLStatement{
+							{SQL: "ALTER TABLE " + newTable.Name + " DROP KEY " + newIndex.Name},
+							{SQL: "ALTER TABLE " + newTable.Name + " ADD " + newIndex.Definition, isIndex: true},
+						},
+					})
 				}
 			}
 
@@ -350,15 +438,12 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 			for _, oldIndex := range oldTable.Indexes {
 				var newIndex = newTable.FindIndex(oldIndex.Name)
 				if newIndex == nil {
-					var op = "- index " + oldTable.Name + " " + oldIndex.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + oldTable.Name + " DROP KEY " + oldIndex.Name)
-					if err != nil {
-						return nil, errors.New("'" + op + "' failed: " + err.Error())
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeDropIndex,
+						Table:       oldTable.Name,
+						Description: "- index " + oldTable.Name + " " + oldIndex.Name,
+						Statements:  []*SQLStatement{{SQL: "ALTER TABLE " + oldTable.Name + " DROP KEY " + oldIndex.Name}},
+					})
 				}
 			}
 
@@ -367,15 +452,12 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 			for _, oldField := range oldTable.Fields {
 				var newField = newTable.FindField(oldField.Name)
 				if newField == nil {
-					var op = "- field " + oldTable.Name + " " + oldField.Name
-					ops = append(ops, op)
-					if showLog {
-						this.log(op)
-					}
-					_, err = db.Exec("ALTER TABLE " + oldTable.Name + " DROP COLUMN `" + oldField.Name + "`")
-					if err != nil {
-						return nil, errors.New("'" + op + "' failed: " + err.Error())
-					}
+					addOp(&SQLOp{
+						Type:        SQLOpTypeDropField,
+						Table:       oldTable.Name,
+						Description: "- field " + oldTable.Name + " " + oldField.Name,
+						Statements:  []*SQLStatement{{SQL: "ALTER TABLE " + oldTable.Name + " DROP COLUMN `" + oldField.Name + "`"}},
+					})
 				}
 			}
 		}
@@ -387,10 +469,17 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 			var queryArgs = []string{}
 			var queryValues = []any{}
 			var valueStrings = []string{}
+			var hasMissingUniqueFields = false
 			for _, field := range record.UniqueFields {
+				valueStrings = append(valueStrings, record.Values[field])
+
+				// 字段将在同一次升级中添加，当前表中还不能用此字段查询
+				if oldTable != nil && oldTable.FindField(field) == nil {
+					hasMissingUniqueFields = true
+					continue
+				}
 				queryArgs = append(queryArgs, field+"=?")
 				queryValues = append(queryValues, record.Values[field])
-				valueStrings = append(valueStrings, record.Values[field])
 			}
 
 			var recordId int64
@@ -403,26 +492,30 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 
 			var one maps.Map
 
-			if newRecordsTable != nil && newRecordsTable.IgnoreId {
-				one, err = db.FindOne("SELECT * FROM "+newTable.Name+" WHERE (("+strings.Join(queryArgs, " AND ")+"))", queryValues...)
-			} else {
-				queryValues = append(queryValues, recordId)
-				one, err = db.FindOne("SELECT * FROM "+newTable.Name+" WHERE (("+strings.Join(queryArgs, " AND ")+") OR id=?)", queryValues...)
-			}
+			// 新的表格中还没有数据，不需要查询
+			if oldTable != nil {
+				if newRecordsTable != nil && newRecordsTable.IgnoreId {
+					// 唯一字段还不存在时，表中不可能有相同的记录，直接插入
+					if !hasMissingUniqueFields {
+						one, err = db.FindOne("SELECT * FROM "+newTable.Name+" WHERE (("+strings.Join(queryArgs, " AND ")+"))", queryValues...)
+					}
+				} else if hasMissingUniqueFields || len(queryArgs) == 0 {
+					one, err = db.FindOne("SELECT * FROM "+newTable.Name+" WHERE id=?", recordId)
+				} else {
+					queryValues = append(queryValues, recordId)
+					one, err = db.FindOne("SELECT * FROM "+newTable.Name+" WHERE (("+strings.Join(queryArgs, " AND ")+") OR id=?)", queryValues...)
+				}
 
-			if err != nil {
-				return nil, err
+				if err != nil {
+					return nil, err
+				}
 			}
+
 			if one == nil {
-				ops = append(ops, "+ record "+newTable.Name+" "+strings.Join(valueStrings, ", "))
-				if showLog {
-					// 不记录详细日志，防止小白用户误解日志内容
-					// this.log("+ record " + newTable.Name + " " + strings.Join(valueStrings, ", "))
-				}
 				var params = []string{}
 				var args = []string{}
 				var values = []any{}
-				for k, v := range record.Values {
+				for _, k := range this.sortedKeys(record.Values) {
 					// 需要排除的字段
 					if lists.ContainsString(record.ExceptFields, k) {
 						continue
@@ -434,19 +527,20 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 
 					params = append(params, "`"+k+"`")
 					args = append(args, "?")
-					values = append(values, v)
+					values = append(values, record.Values[k])
 				}
 
-				execSQL("INSERT INTO "+newTable.Name+" ("+strings.Join(params, ", ")+") VALUES ("+strings.Join(args, ", ")+")", values...)
-			} else if !record.ValuesEquals(one) {
-				ops = append(ops, "* record "+newTable.Name+" "+strings.Join(valueStrings, ", "))
-				if showLog {
-					// 不记录详细日志，防止小白用户误解日志内容
-					// this.log("* record " + newTable.Name + " " + strings.Join(valueStrings, ", "))
-				}
+				addOp(&SQLOp{
+					Type:        SQLOpTypeInsertRecord,
+					Table:       newTable.Name,
+					Description: "+ record " + newTable.Name + " " + strings.Join(valueStrings, ", "),
+					Statements:  []*SQLStatement{{SQL: "INSERT INTO " + newTable.Name + " (" + strings.Join(params, ", ") + ") VALUES (" + strings.Join(args, ", ") + ")", Args: values}},
+					isAsync:     true,
+				})
+			} else if !record.ValuesEquals(one) || this.hasMissingFields(record, one) {
 				var args = []string{}
 				var values = []any{}
-				for k, v := range record.Values {
+				for _, k := range this.sortedKeys(record.Values) {
 					if k == "id" {
 						continue
 					}
@@ -457,11 +551,17 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 					}
 
 					args = append(args, "`"+k+"`"+"=?")
-					values = append(values, v)
+					values = append(values, record.Values[k])
 				}
 				values = append(values, one.GetInt("id"))
 
-				execSQL("UPDATE "+newTable.Name+" SET "+strings.Join(args, ", ")+" WHERE id=?", values...)
+				addOp(&SQLOp{
+					Type:        SQLOpTypeUpdateRecord,
+					Table:       newTable.Name,
+					Description: "* record " + newTable.Name + " " + strings.Join(valueStrings, ", "),
+					Statements:  []*SQLStatement{{SQL: "UPDATE " + newTable.Name + " SET " + strings.Join(args, ", ") + " WHERE id=?", Args: values}},
+					isAsync:     true,
+				})
 			}
 		}
 	}
@@ -472,6 +572,67 @@ func (this *SQLDump) applyQueue(db *dbs.DB, newResult *SQLDumpResult, showLog bo
 	return
 }
 
+// 执行单个操作
+func (this *SQLDump) executeOp(db *dbs.DB, op *SQLOp) error {
+	for index, stmt := range op.Statements {
+		_, err := db.Exec(stmt.SQL, stmt.Args...)
+		if err != nil && stmt.isIndex {
+			err = this.tryCreateIndex(err, db, op.Table, strings.TrimPrefix(stmt.SQL, "ALTER TABLE "+op.Table+" ADD "))
+		}
+		if err != nil {
+			if op.Type == SQLOpTypeModifyIndex && index == 0 {
+				return errors.New("'" + op.Description + "' drop old key failed: " + err.Error())
+			}
+			return errors.New("'" + op.Description + "' failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+type sqlTableSize struct {
+	rows  int64
+	bytes int64
+}
+
+// 估算所有表的尺寸
+func (this *SQLDump) findTableSizes(db *dbs.DB) (map[string]*sqlTableSize, error) {
+	var result = map[string]*sqlTableSize{}
+	ones, _, err := db.FindOnes("SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH, INDEX_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA=DATABASE()")
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		result[strings.ToLower(one.GetString("TABLE_NAME"))] = &sqlTableSize{
+			rows:  one.GetInt64("TABLE_ROWS"),
+			bytes: one.GetInt64("DATA_LENGTH") + one.GetInt64("INDEX_LENGTH"),
+		}
+	}
+	return result, nil
+}
+
+// 检查记录中是否有当前表中还不存在的字段（字段将在同一次升级中添加）
+func (this *SQLDump) hasMissingFields(record *SQLRecord, one maps.Map) bool {
+	for k := range record.Values {
+		if lists.ContainsString(record.ExceptFields, k) {
+			continue
+		}
+		if !one.Has(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// 对字段名排序，以便生成稳定的语句
+func (this *SQLDump) sortedKeys(values map[string]string) []string {
+	var keys = []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // 查找所有表的完整信息
 func (this *SQLDump) findFullTables(db *dbs.DB, tableNames []string) ([]*dbs.Table, error) {
 	var fullTables = []*dbs.Table{}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
 )
 
 func TestSQLDump_Dump(t *testing.T) {
@@ -98,3 +99,105 @@ func TestSQLDump_Apply(t *testing.T) {
 	}**/
 	_ = ops
 }
+
+func TestSQLDump_Plan(t *testing.T) {
+	db, err := dbs.NewInstanceFromConfig(&dbs.DBConfig{
+		Driver: "mysql",
+		Dsn:    "root:123456@tcp(127.0.0.1:3306)/db_edge?charset=utf8mb4&timeout=30s",
+		Prefix: "edge",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var dump = NewSQLDump()
+	result, err := dump.Dump(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := dump.Plan(db, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 和自身比较，不应该有结构变更
+	if plan.CountDDL() > 0 {
+		t.Fatal("should not have schema changes, but got:\n" + plan.String())
+	}
+	t.Log(plan.String())
+}
+
+func TestSQLDump_Plan_RecordWithNewField(t *testing.T) {
+	db, err := dbs.NewInstanceFromConfig(&dbs.DBConfig{
+		Driver: "mysql",
+		Dsn:    "root:123456@tcp(127.0.0.1:3306)/db_edge?charset=utf8mb4&timeout=30s",
+		Prefix: "edge",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	const tableName = "edgeTestPlanRecords"
+	_, err = db.Exec("CREATE TABLE " + tableName + " (`id` int(11) unsigned NOT NULL AUTO_INCREMENT, `name` varchar(255) DEFAULT NULL, PRIMARY KEY (`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.Exec("DROP TABLE " + tableName)
+	}()
+	_, err = db.Exec("INSERT INTO " + tableName + " (`id`, `name`) VALUES (1, 'old')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump = NewSQLDump()
+	currentResult, err := dump.Dump(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var table = currentResult.FindTable(tableName)
+	if table == nil {
+		t.Fatal("can not find table '" + tableName + "'")
+	}
+
+	// 在同一次升级中增加字段，并增加以此字段为唯一字段的记录
+	table.Definition += " -- new"
+	table.Fields = append(table.Fields, &SQLField{
+		Name:       "code",
+		Definition: "varchar(64) DEFAULT NULL",
+	})
+	table.Records = []*SQLRecord{
+		{Values: map[string]string{"id": "1", "name": "old", "code": "a"}, UniqueFields: []string{"code"}},
+		{Values: map[string]string{"id": "2", "name": "new", "code": "b"}, UniqueFields: []string{"code"}},
+	}
+
+	plan, err := dump.Plan(db, &SQLDumpResult{Tables: []*SQLTable{table}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(plan.String())
+
+	for _, op := range plan.Ops {
+		err = dump.executeOp(db, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id, code := range map[int64]string{1: "a", 2: "b"} {
+		col, err := db.FindCol(0, "SELECT code FROM "+tableName+" WHERE id=?", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if types.String(col) != code {
+			t.Fatal("record", id, "expected code", code, "but got", col)
+		}
+	}
+}
@@ -67,10 +67,9 @@ func (this *SQLExecutor) Run(showLog bool) error {
 		showLog = true
 	}
 
-	var sqlResult = &SQLDumpResult{}
-	err = json.Unmarshal(sqlData, sqlResult)
+	sqlResult, err := this.decodeSQLData()
 	if err != nil {
-		return fmt.Errorf("decode sql data failed: %w", err)
+		return err
 	}
 
 	_, err = sqlDump.Apply(db, sqlResult, showLog)
@@ -87,6 +86,141 @@ func (this *SQLExecutor) Run(showLog bool) error {
 	return nil
 }
 
+// Plan 生成升级计划，但不执行
+func (this *SQLExecutor) Plan() (*SQLPlan, error) {
+	db, err := dbs.NewInstanceFromConfig(this.dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	sqlResult, err := this.decodeSQLData()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLDump().Plan(db, sqlResult)
+}
+
+// RunResumable 逐个执行升级操作，并记录到升级日志中，中断后可以继续执行
+func (this *SQLExecutor) RunResumable(showLog bool) (*SQLApplyResult, error) {
+	db, err := dbs.NewInstanceFromConfig(this.dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// prevent default configure loading
+	var globalConfig = dbs.GlobalConfig()
+	if globalConfig != nil && len(globalConfig.DBs) == 0 {
+		globalConfig.DBs = map[string]*dbs.DBConfig{Tea.Env: this.dbConfig}
+	}
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var sqlDump = NewSQLDump()
+	sqlDump.SetLogWriter(this.logWriter)
+	if this.logWriter != nil {
+		showLog = true
+	}
+
+	sqlResult, err := this.decodeSQLData()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := sqlDump.ApplyWithJournal(db, sqlResult, showLog)
+	if err != nil {
+		return result, err
+	}
+
+	// 检查数据
+	err = this.checkData(db)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Backup 备份数据库
+func (this *SQLExecutor) Backup(writer io.Writer, options *SQLBackupOptions) (*SQLBackupManifest, error) {
+	db, err := dbs.NewInstanceFromConfig(this.dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var backup = NewSQLBackup(db)
+	backup.SetLogWriter(this.logWriter)
+	return backup.Backup(writer, options)
+}
+
+// Restore 从备份文件恢复数据库
+// 如果备份时的版本比当前版本旧，恢复后自动升级数据库结构和数据
+func (this *SQLExecutor) Restore(archiveFile string) (*SQLBackupManifest, error) {
+	db, err := dbs.NewInstanceFromConfig(this.dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// prevent default configure loading
+	var globalConfig = dbs.GlobalConfig()
+	if globalConfig != nil && len(globalConfig.DBs) == 0 {
+		globalConfig.DBs = map[string]*dbs.DBConfig{Tea.Env: this.dbConfig}
+	}
+
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var backup = NewSQLBackup(db)
+	backup.SetLogWriter(this.logWriter)
+	manifest, err := backup.Restore(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if !manifest.IsOlder() {
+		return manifest, nil
+	}
+
+	// 升级到当前版本
+	sqlResult, err := this.decodeSQLData()
+	if err != nil {
+		return manifest, err
+	}
+
+	var sqlDump = NewSQLDump()
+	sqlDump.SetLogWriter(this.logWriter)
+	_, err = sqlDump.Apply(db, sqlResult, this.logWriter != nil)
+	if err != nil {
+		return manifest, fmt.Errorf("upgrade from version '%s' failed: %w", manifest.Version, err)
+	}
+
+	err = this.checkData(db)
+	if err != nil {
+		return manifest, err
+	}
+
+	return manifest, nil
+}
+
+// 读取内置的数据库结构
+func (this *SQLExecutor) decodeSQLData() (*SQLDumpResult, error) {
+	var sqlResult = &SQLDumpResult{}
+	err := json.Unmarshal(sqlData, sqlResult)
+	if err != nil {
+		return nil, fmt.Errorf("decode sql data failed: %w", err)
+	}
+	return sqlResult, nil
+}
+
 // 检查数据
 func (this *SQLExecutor) checkData(db *dbs.DB) error {
 	// 检查管理员平台节点
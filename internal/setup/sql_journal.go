@@ -0,0 +1,81 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package setup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+const sqlJournalTableName = "edgeSQLMigrations"
+
+type SQLJournalStatus = string
+
+const (
+	SQLJournalStatusDone   SQLJournalStatus = "done"
+	SQLJournalStatusFailed SQLJournalStatus = "failed"
+)
+
+// SQLJournal 升级操作日志
+// 每个完成的操作都会记录下来，中断后重新执行时跳过已经完成的操作
+type SQLJournal struct {
+	db *dbs.DB
+}
+
+func NewSQLJournal(db *dbs.DB) *SQLJournal {
+	return &SQLJournal{db: db}
+}
+
+// Init 初始化日志表
+func (this *SQLJournal) Init() error {
+	_, err := this.db.Exec("CREATE TABLE IF NOT EXISTS `" + sqlJournalTableName + "` (\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',\n" +
+		"  `version` varchar(32) DEFAULT NULL COMMENT '目标版本',\n" +
+		"  `opId` varchar(64) DEFAULT NULL COMMENT '操作ID',\n" +
+		"  `opType` varchar(32) DEFAULT NULL COMMENT '操作类型',\n" +
+		"  `tableName` varchar(255) DEFAULT NULL COMMENT '表名',\n" +
+		"  `description` varchar(1024) DEFAULT NULL COMMENT '描述',\n" +
+		"  `status` varchar(16) DEFAULT NULL COMMENT '状态：done|failed',\n" +
+		"  `error` text COMMENT '错误信息',\n" +
+		"  `costMs` bigint(20) unsigned DEFAULT '0' COMMENT '耗时（毫秒）',\n" +
+		"  `createdAt` bigint(11) unsigned DEFAULT '0' COMMENT '创建时间',\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `version_opId` (`version`,`opId`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='数据库升级日志';")
+	return err
+}
+
+// FindDoneOpIds 查找某个版本已经完成的操作
+func (this *SQLJournal) FindDoneOpIds(version string) (map[string]bool, error) {
+	ones, _, err := this.db.FindOnes("SELECT opId FROM `"+sqlJournalTableName+"` WHERE version=? AND status=?", version, SQLJournalStatusDone)
+	if err != nil {
+		return nil, err
+	}
+	var result = map[string]bool{}
+	for _, one := range ones {
+		result[one.GetString("opId")] = true
+	}
+	return result, nil
+}
+
+// Record 记录操作结果
+func (this *SQLJournal) Record(version string, op *SQLOp, opErr error, cost time.Duration) error {
+	var status = SQLJournalStatusDone
+	var errString = ""
+	if opErr != nil {
+		status = SQLJournalStatusFailed
+		errString = opErr.Error()
+	}
+
+	var description = utils.LimitString(op.Description, 1024)
+
+	_, err := this.db.Exec("INSERT INTO `"+sqlJournalTableName+"` (`version`, `opId`, `opType`, `tableName`, `description`, `status`, `error`, `costMs`, `createdAt`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `status`=VALUES(`status`), `error`=VALUES(`error`), `costMs`=VALUES(`costMs`), `createdAt`=VALUES(`createdAt`)",
+		version, op.Id, op.Type, op.Table, description, status, errString, cost.Milliseconds(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("write journal failed: %w", err)
+	}
+	return nil
+}
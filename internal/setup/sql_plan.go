@@ -0,0 +1,155 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package setup
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/sizes"
+	"github.com/iwind/TeaGo/types"
+)
+
+type SQLOpType = string
+
+const (
+	SQLOpTypeCreateTable  SQLOpType = "createTable"
+	SQLOpTypeAddField     SQLOpType = "addField"
+	SQLOpTypeModifyField  SQLOpType = "modifyField"
+	SQLOpTypeDropField    SQLOpType = "dropField"
+	SQLOpTypeAddIndex     SQLOpType = "addIndex"
+	SQLOpTypeModifyIndex  SQLOpType = "modifyIndex"
+	SQLOpTypeDropIndex    SQLOpType = "dropIndex"
+	SQLOpTypeInsertRecord SQLOpType = "insertRecord"
+	SQLOpTypeUpdateRecord SQLOpType = "updateRecord"
+)
+
+// 超过此行数的表执行DDL时给出提示
+const sqlPlanLargeTableRows = 1_000_000
+
+// SQLStatement 单条SQL语句
+type SQLStatement struct {
+	SQL  string `json:"sql"`
+	Args []any  `json:"args,omitempty"`
+
+	isIndex bool // 是否为添加索引语句，失败时需要尝试修复
+}
+
+// SQLOp 升级时的单个操作
+type SQLOp struct {
+	Id          string          `json:"id"`          // 操作ID，根据操作内容生成
+	Type        SQLOpType       `json:"type"`        // 操作类型
+	Table       string          `json:"table"`       // 表名
+	Description string          `json:"description"` // 描述
+	Statements  []*SQLStatement `json:"statements"`  // 需要执行的语句
+	TableRows   int64           `json:"tableRows"`   // 估算的表行数
+	TableBytes  int64           `json:"tableBytes"`  // 估算的表尺寸（数据+索引）
+
+	isAsync bool // 是否可以放入并发队列执行
+}
+
+// IsDDL 是否为结构变更
+func (this *SQLOp) IsDDL() bool {
+	return this.Type != SQLOpTypeInsertRecord && this.Type != SQLOpTypeUpdateRecord
+}
+
+// IsLargeTable 是否为大表上的结构变更
+func (this *SQLOp) IsLargeTable() bool {
+	return this.IsDDL() && this.Type != SQLOpTypeCreateTable && this.TableRows >= sqlPlanLargeTableRows
+}
+
+// 生成操作ID
+func (this *SQLOp) init() {
+	var h = sha1.New()
+	h.Write([]byte(this.Type + "\n" + this.Table + "\n"))
+	for _, stmt := range this.Statements {
+		h.Write([]byte(stmt.SQL + "\n"))
+		if len(stmt.Args) > 0 {
+			argsJSON, _ := json.Marshal(stmt.Args)
+			h.Write(argsJSON)
+		}
+	}
+	this.Id = fmt.Sprintf("%x", h.Sum(nil))[:20]
+}
+
+// SQLPlan 升级计划
+type SQLPlan struct {
+	Version string   `json:"version"` // 目标版本
+	Ops     []*SQLOp `json:"ops"`
+}
+
+// CountDDL 结构变更数量
+func (this *SQLPlan) CountDDL() (count int) {
+	for _, op := range this.Ops {
+		if op.IsDDL() {
+			count++
+		}
+	}
+	return
+}
+
+// String 转换为可读的文本
+func (this *SQLPlan) String() string {
+	if len(this.Ops) == 0 {
+		return "-- nothing to do, schema is up to date (" + this.Version + ")\n"
+	}
+
+	var builder = &strings.Builder{}
+	builder.WriteString("-- upgrade plan to version " + this.Version + ": " + types.String(len(this.Ops)) + " operations, " + types.String(this.CountDDL()) + " schema changes\n")
+	for index, op := range this.Ops {
+		builder.WriteString("\n-- [" + types.String(index+1) + "] " + op.Description + " (id: " + op.Id + ")")
+		if op.Type != SQLOpTypeCreateTable {
+			builder.WriteString(", table rows: ~" + types.String(op.TableRows) + ", size: ~" + this.formatBytes(op.TableBytes))
+		}
+		if op.IsLargeTable() {
+			builder.WriteString(", WARNING: large table, this may take a long time")
+		}
+		builder.WriteString("\n")
+		for _, stmt := range op.Statements {
+			builder.WriteString(stmt.SQL)
+			if !strings.HasSuffix(stmt.SQL, ";") {
+				builder.WriteString(";")
+			}
+			if len(stmt.Args) > 0 {
+				argsJSON, _ := json.Marshal(stmt.Args)
+				builder.WriteString(" -- args: " + string(argsJSON))
+			}
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+func (this *SQLPlan) formatBytes(bytes int64) string {
+	switch {
+	case bytes >= sizes.G:
+		return fmt.Sprintf("%.2fGiB", float64(bytes)/float64(sizes.G))
+	case bytes >= sizes.M:
+		return fmt.Sprintf("%.2fMiB", float64(bytes)/float64(sizes.M))
+	case bytes >= sizes.K:
+		return fmt.Sprintf("%.2fKiB", float64(bytes)/float64(sizes.K))
+	}
+	return types.String(bytes) + "B"
+}
+
+// SQLApplyResult 执行升级计划的结果
+type SQLApplyResult struct {
+	Version      string        `json:"version"`
+	CountOps     int           `json:"countOps"`
+	CountDone    int           `json:"countDone"`
+	CountSkipped int           `json:"countSkipped"` // 之前已经完成而跳过的操作数
+	FailedOps    []*SQLOpError `json:"failedOps"`
+}
+
+// IsOk 是否全部成功
+func (this *SQLApplyResult) IsOk() bool {
+	return len(this.FailedOps) == 0
+}
+
+// SQLOpError 单个操作的错误
+type SQLOpError struct {
+	Op    *SQLOp `json:"op"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			NewEmailSendTask(10 * time.Second).Start()
+		})
+	})
+}
+
+// EmailSendTask 发送邮件队列中的邮件
+type EmailSendTask struct {
+	BaseTask
+
+	ticker *time.Ticker
+}
+
+func NewEmailSendTask(duration time.Duration) *EmailSendTask {
+	return &EmailSendTask{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (this *EmailSendTask) Start() {
+	for range this.ticker.C {
+		err := this.Loop()
+		if err != nil {
+			this.logErr("EmailSendTask", err.Error())
+		}
+	}
+}
+
+func (this *EmailSendTask) Loop() error {
+	// 检查是否为主节点
+	if !this.IsPrimaryNode() {
+		return nil
+	}
+
+	var tx *dbs.Tx
+	config, err := models.SharedUserEmailNotificationDAO.ReadEmailConfig(tx)
+	if err != nil {
+		return fmt.Errorf("read email config failed: %w", err)
+	}
+	if !config.IsOn {
+		return nil
+	}
+
+	notifications, err := models.SharedUserEmailNotificationDAO.FindPendingNotifications(tx, 100)
+	if err != nil {
+		return fmt.Errorf("find pending notifications failed: %w", err)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	sender, err := mailutils.NewSender(config)
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		var sendErr = sender.Send(&mailutils.Message{
+			To:      notification.Email,
+			Subject: notification.Subject,
+			Body:    notification.Body,
+			IsHTML:  notification.IsHTML,
+		})
+		if sendErr == nil {
+			err = models.SharedUserEmailNotificationDAO.UpdateNotificationSent(tx, int64(notification.Id))
+		} else {
+			remotelogs.Warn("EmailSendTask", "send email '"+types.String(notification.Id)+"' to '"+notification.Email+"' failed: "+sendErr.Error())
+			err = models.SharedUserEmailNotificationDAO.UpdateNotificationFailed(tx, config, notification, sendErr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
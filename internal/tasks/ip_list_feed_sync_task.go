@@ -0,0 +1,67 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			NewIPListFeedSyncTask(1 * time.Minute).Start()
+		})
+	})
+}
+
+// IPListFeedSyncTask IP名单订阅源同步任务
+type IPListFeedSyncTask struct {
+	BaseTask
+
+	ticker *time.Ticker
+}
+
+func NewIPListFeedSyncTask(duration time.Duration) *IPListFeedSyncTask {
+	return &IPListFeedSyncTask{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (this *IPListFeedSyncTask) Start() {
+	for range this.ticker.C {
+		err := this.Loop()
+		if err != nil {
+			this.logErr("IPListFeedSyncTask", err.Error())
+		}
+	}
+}
+
+func (this *IPListFeedSyncTask) Loop() error {
+	// 检查是否为主节点
+	if !this.IsPrimaryNode() {
+		return nil
+	}
+
+	var tx *dbs.Tx
+	listIds, err := models.SharedIPListDAO.FindAllFeedListIdsToSync(tx, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("find feed lists failed: %w", err)
+	}
+
+	for _, listId := range listIds {
+		_, err = models.SharedIPListDAO.SyncIPListFeed(tx, listId)
+		if err != nil {
+			// 单个名单失败不影响其他名单，错误信息已经记录在名单同步状态中
+			remotelogs.Error("IPListFeedSyncTask", "sync feed of ip list '"+types.String(listId)+"' failed: "+err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ldaputils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			NewLDAPAdminSyncTask(5 * time.Minute).Start()
+		})
+	})
+}
+
+// LDAPAdminSyncTask 同步LDAP管理员状态，禁用已经从目录中删除的管理员
+type LDAPAdminSyncTask struct {
+	BaseTask
+
+	ticker     *time.Ticker
+	lastSyncAt int64
+}
+
+func NewLDAPAdminSyncTask(duration time.Duration) *LDAPAdminSyncTask {
+	return &LDAPAdminSyncTask{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (this *LDAPAdminSyncTask) Start() {
+	for range this.ticker.C {
+		err := this.Loop()
+		if err != nil {
+			this.logErr("LDAPAdminSyncTask", err.Error())
+		}
+	}
+}
+
+func (this *LDAPAdminSyncTask) Loop() error {
+	// 检查是否为主节点
+	if !this.IsPrimaryNode() {
+		return nil
+	}
+
+	var tx *dbs.Tx
+	config, err := models.SharedLoginDAO.ReadLDAPConfig(tx)
+	if err != nil {
+		return fmt.Errorf("read ldap config failed: %w", err)
+	}
+	if !config.IsOn {
+		return nil
+	}
+
+	var now = time.Now().Unix()
+	if this.lastSyncAt > 0 && now-this.lastSyncAt < int64(config.SyncIntervalSeconds) {
+		return nil
+	}
+	this.lastSyncAt = now
+
+	logins, err := models.SharedLoginDAO.FindAllLDAPAdminLogins(tx)
+	if err != nil {
+		return fmt.Errorf("find ldap admins failed: %w", err)
+	}
+	if len(logins) == 0 {
+		return nil
+	}
+
+	conn, err := ldaputils.Open(config)
+	if err != nil {
+		// 目录服务器不可用时不改变管理员状态
+		return fmt.Errorf("connect to ldap server failed: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, login := range logins {
+		user, err := conn.FindUser(config, login.DecodeParams().GetString("username"))
+		if err != nil {
+			if !errors.Is(err, ldaputils.ErrUserNotFound) {
+				return fmt.Errorf("find ldap user failed: %w", err)
+			}
+
+			// 已从目录中删除
+			user = nil
+		}
+
+		_, err = models.SharedLoginDAO.SyncLDAPAdmin(tx, config, login, user)
+		if err != nil {
+			remotelogs.Error("LDAPAdminSyncTask", "sync admin '"+types.String(login.AdminId)+"' failed: "+err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/nameservers"
+	"github.com/TeaOSLab/EdgeAPI/internal/goman"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		goman.New(func() {
+			NewNSDNSSECRolloverTask(10 * time.Minute).Start()
+		})
+	})
+}
+
+// NSDNSSECRolloverTask DNSSEC ZSK自动轮换任务
+type NSDNSSECRolloverTask struct {
+	BaseTask
+
+	ticker *time.Ticker
+}
+
+func NewNSDNSSECRolloverTask(duration time.Duration) *NSDNSSECRolloverTask {
+	return &NSDNSSECRolloverTask{
+		ticker: time.NewTicker(duration),
+	}
+}
+
+func (this *NSDNSSECRolloverTask) Start() {
+	for range this.ticker.C {
+		err := this.Loop()
+		if err != nil {
+			this.logErr("NSDNSSECRolloverTask", err.Error())
+		}
+	}
+}
+
+func (this *NSDNSSECRolloverTask) Loop() error {
+	// 检查是否为主节点
+	if !this.IsPrimaryNode() {
+		return nil
+	}
+
+	var tx *dbs.Tx
+	domainIds, err := nameservers.SharedNSDomainDAO.FindAllDomainIdsWithDNSSECActionDue(tx, time.Now().Unix(), 100)
+	if err != nil {
+		return fmt.Errorf("find domains failed: %w", err)
+	}
+
+	for _, domainId := range domainIds {
+		err = nameservers.SharedNSKeyDAO.AdvanceZSKRollover(tx, domainId)
+		if err != nil {
+			// 单个域名失败不影响其他域名
+			remotelogs.Error("NSDNSSECRolloverTask", "rollover zsk for domain '"+types.String(domainId)+"' failed: "+err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package tasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/tasks"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+func TestNSDNSSECRolloverTask_Loop(t *testing.T) {
+	dbs.NotifyReady()
+
+	var task = tasks.NewNSDNSSECRolloverTask(1 * time.Minute)
+	err := task.Loop()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
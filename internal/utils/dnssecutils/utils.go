@@ -0,0 +1,158 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package dnssecutils
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type Algorithm = string
+
+const (
+	AlgorithmECDSAP256SHA256 Algorithm = "ECDSAP256SHA256"
+	AlgorithmED25519         Algorithm = "ED25519"
+)
+
+type KeyType = string
+
+const (
+	KeyTypeKSK KeyType = "ksk" // 密钥签名密钥
+	KeyTypeZSK KeyType = "zsk" // 区域签名密钥
+)
+
+// Key 生成的DNSSEC密钥
+type Key struct {
+	Type       KeyType
+	Algorithm  Algorithm
+	KeyTag     uint16
+	Flags      uint16
+	PublicKey  string // DNSKEY中的公钥，Base64
+	PrivateKey string // BIND私钥格式
+}
+
+// DS 提交给注册商的DS记录
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     string
+}
+
+// String 转换为DS记录值
+func (this *DS) String() string {
+	return (&dns.DS{
+		KeyTag:     this.KeyTag,
+		Algorithm:  this.Algorithm,
+		DigestType: this.DigestType,
+		Digest:     this.Digest,
+	}).String()
+}
+
+// AllAlgorithms 所有支持的算法
+func AllAlgorithms() []Algorithm {
+	return []Algorithm{AlgorithmECDSAP256SHA256, AlgorithmED25519}
+}
+
+// GenerateKey 为某个区域生成密钥
+func GenerateKey(zone string, keyType KeyType, algorithm Algorithm) (*Key, error) {
+	algorithmCode, bits, err := algorithmCodeAndBits(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uint16 = dns.ZONE
+	switch keyType {
+	case KeyTypeKSK:
+		flags |= dns.SEP
+	case KeyTypeZSK:
+	default:
+		return nil, errors.New("invalid key type '" + keyType + "'")
+	}
+
+	var dnsKey = composeDNSKEY(zone, flags, algorithmCode, "")
+	privateKey, err := dnsKey.Generate(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:       keyType,
+		Algorithm:  algorithm,
+		KeyTag:     dnsKey.KeyTag(),
+		Flags:      flags,
+		PublicKey:  dnsKey.PublicKey,
+		PrivateKey: dnsKey.PrivateKeyString(privateKey),
+	}, nil
+}
+
+// ComputeDS 根据KSK计算DS记录
+func ComputeDS(zone string, algorithm Algorithm, flags uint16, publicKey string) ([]*DS, error) {
+	algorithmCode, _, err := algorithmCodeAndBits(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var dnsKey = composeDNSKEY(zone, flags, algorithmCode, publicKey)
+
+	var result = []*DS{}
+	for _, digestType := range []uint8{dns.SHA256, dns.SHA384} {
+		var ds = dnsKey.ToDS(digestType)
+		if ds == nil {
+			return nil, errors.New("compute DS failed")
+		}
+		result = append(result, &DS{
+			KeyTag:     ds.KeyTag,
+			Algorithm:  ds.Algorithm,
+			DigestType: ds.DigestType,
+			Digest:     strings.ToUpper(ds.Digest),
+		})
+	}
+	return result, nil
+}
+
+// ComputeKeyTag 计算公钥的KeyTag
+func ComputeKeyTag(zone string, algorithm Algorithm, flags uint16, publicKey string) (uint16, error) {
+	algorithmCode, _, err := algorithmCodeAndBits(algorithm)
+	if err != nil {
+		return 0, err
+	}
+	return composeDNSKEY(zone, flags, algorithmCode, publicKey).KeyTag(), nil
+}
+
+// ParsePrivateKey 读取私钥，用于校验
+func ParsePrivateKey(zone string, algorithm Algorithm, flags uint16, publicKey string, privateKey string) (crypto.PrivateKey, error) {
+	algorithmCode, _, err := algorithmCodeAndBits(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var dnsKey = composeDNSKEY(zone, flags, algorithmCode, publicKey)
+	return dnsKey.ReadPrivateKey(strings.NewReader(privateKey), "")
+}
+
+func composeDNSKEY(zone string, flags uint16, algorithmCode uint8, publicKey string) *dns.DNSKEY {
+	return &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(strings.ToLower(zone)),
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithmCode,
+		PublicKey: publicKey,
+	}
+}
+
+func algorithmCodeAndBits(algorithm Algorithm) (code uint8, bits int, err error) {
+	switch algorithm {
+	case AlgorithmECDSAP256SHA256:
+		return dns.ECDSAP256SHA256, 256, nil
+	case AlgorithmED25519:
+		return dns.ED25519, 256, nil
+	}
+	return 0, 0, errors.New("unsupported algorithm '" + algorithm + "'")
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package dnssecutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/dnssecutils"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, algorithm := range dnssecutils.AllAlgorithms() {
+		for _, keyType := range []dnssecutils.KeyType{dnssecutils.KeyTypeKSK, dnssecutils.KeyTypeZSK} {
+			key, err := dnssecutils.GenerateKey("example.com", keyType, algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Log(algorithm, keyType, key.KeyTag, key.Flags, key.PublicKey)
+
+			keyTag, err := dnssecutils.ComputeKeyTag("example.com", algorithm, key.Flags, key.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keyTag != key.KeyTag {
+				t.Fatal("key tag mismatch")
+			}
+
+			_, err = dnssecutils.ParsePrivateKey("example.com", algorithm, key.Flags, key.PublicKey, key.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestGenerateKey_Invalid(t *testing.T) {
+	_, err := dnssecutils.GenerateKey("example.com", dnssecutils.KeyTypeKSK, "RSAMD5")
+	if err == nil {
+		t.Fatal("'RSAMD5' should not be supported")
+	}
+	_, err = dnssecutils.GenerateKey("example.com", "abc", dnssecutils.AlgorithmED25519)
+	if err == nil {
+		t.Fatal("'abc' should be invalid key type")
+	}
+}
+
+func TestComputeDS(t *testing.T) {
+	key, err := dnssecutils.GenerateKey("example.com", dnssecutils.KeyTypeKSK, dnssecutils.AlgorithmECDSAP256SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsList, err := dnssecutils.ComputeDS("example.com", key.Algorithm, key.Flags, key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dsList) != 2 {
+		t.Fatal("should compute 2 DS records")
+	}
+	for _, ds := range dsList {
+		if ds.KeyTag != key.KeyTag {
+			t.Fatal("key tag mismatch")
+		}
+		t.Log(ds.String())
+	}
+}
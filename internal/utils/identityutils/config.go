@@ -0,0 +1,188 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package identityutils
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const DefaultHookTimeoutSeconds = 10
+
+// RejectReason 拒绝原因模板
+type RejectReason struct {
+	Code string `yaml:"code" json:"code"` // 代号
+	Text string `yaml:"text" json:"text"` // 原因描述
+}
+
+// HookConfig 外部核验接口设置
+type HookConfig struct {
+	IsOn           bool              `yaml:"isOn" json:"isOn"`                     // 是否启用
+	URL            string            `yaml:"url" json:"url"`                       // 接口地址
+	Headers        map[string]string `yaml:"headers" json:"headers"`               // 附加的请求Header，可以用来传递密钥
+	TimeoutSeconds int               `yaml:"timeoutSeconds" json:"timeoutSeconds"` // 超时时间
+	AutoVerify     bool              `yaml:"autoVerify" json:"autoVerify"`         // 核验通过后是否自动通过审核
+}
+
+// Init 校验并初始化
+func (this *HookConfig) Init() error {
+	if this.Headers == nil {
+		this.Headers = map[string]string{}
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultHookTimeoutSeconds
+	}
+	this.URL = strings.TrimSpace(this.URL)
+	if !this.IsOn {
+		return nil
+	}
+	if len(this.URL) == 0 {
+		return errors.New("hook 'url' should not be empty")
+	}
+	u, err := url.Parse(this.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("invalid hook 'url'")
+	}
+	return nil
+}
+
+// Mask 对Header值进行掩码，以便返回给界面
+func (this *HookConfig) Mask() {
+	var headers = map[string]string{}
+	for name, value := range this.Headers {
+		headers[name] = MaskString(value)
+	}
+	this.Headers = headers
+}
+
+// UnmaskWith Header值为掩码后的值时，使用旧的设置中同名Header的值
+func (this *HookConfig) UnmaskWith(oldConfig *HookConfig) {
+	for name, value := range this.Headers {
+		if !IsMasked(value) {
+			continue
+		}
+		if oldConfig != nil && oldConfig.Headers != nil {
+			oldValue, ok := oldConfig.Headers[name]
+			if ok {
+				this.Headers[name] = oldValue
+				continue
+			}
+		}
+		this.Headers[name] = ""
+	}
+}
+
+// MaskString 对字符串进行掩码
+func MaskString(s string) string {
+	var l = len(s)
+	if l == 0 {
+		return ""
+	}
+	if l < 8 {
+		return strings.Repeat("*", l)
+	}
+	return s[:4] + strings.Repeat("*", l-4)
+}
+
+// IsMasked 判断字符串是否被掩码
+func IsMasked(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	return s == strings.Repeat("*", len(s)) || strings.HasSuffix(s, "**")
+}
+
+// Config 实名认证审核设置
+type Config struct {
+	RejectReasons []*RejectReason `yaml:"rejectReasons" json:"rejectReasons"` // 拒绝原因模板
+	NotifyAdmins  bool            `yaml:"notifyAdmins" json:"notifyAdmins"`   // 用户提交审核时是否通知管理员
+	Hook          *HookConfig     `yaml:"hook" json:"hook"`                   // 外部核验接口
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		RejectReasons: DefaultRejectReasons(),
+		NotifyAdmins:  true,
+		Hook:          &HookConfig{},
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	var reasons = []*RejectReason{}
+	var codes = map[string]bool{}
+	for _, reason := range this.RejectReasons {
+		if reason == nil {
+			continue
+		}
+		reason.Code = strings.TrimSpace(reason.Code)
+		reason.Text = strings.TrimSpace(reason.Text)
+		if len(reason.Code) == 0 || len(reason.Text) == 0 {
+			return errors.New("reject reason 'code' and 'text' should not be empty")
+		}
+		if codes[reason.Code] {
+			return errors.New("duplicate reject reason code '" + reason.Code + "'")
+		}
+		codes[reason.Code] = true
+		reasons = append(reasons, reason)
+	}
+	this.RejectReasons = reasons
+
+	if this.Hook == nil {
+		this.Hook = &HookConfig{}
+	}
+	return this.Hook.Init()
+}
+
+// Mask 对敏感信息进行掩码，以便返回给界面
+func (this *Config) Mask() {
+	if this.Hook != nil {
+		this.Hook.Mask()
+	}
+}
+
+// UnmaskWith 敏感信息为掩码后的值时，使用旧的设置中的值
+func (this *Config) UnmaskWith(oldConfig *Config) {
+	if this.Hook == nil {
+		return
+	}
+	if oldConfig == nil {
+		this.Hook.UnmaskWith(nil)
+		return
+	}
+	this.Hook.UnmaskWith(oldConfig.Hook)
+}
+
+// FindRejectReason 根据代号查找拒绝原因模板
+func (this *Config) FindRejectReason(code string) *RejectReason {
+	for _, reason := range this.RejectReasons {
+		if reason.Code == code {
+			return reason
+		}
+	}
+	return nil
+}
+
+// DefaultRejectReasons 默认的拒绝原因模板
+func DefaultRejectReasons() []*RejectReason {
+	return []*RejectReason{
+		{
+			Code: "unclear",
+			Text: "证件照片不清晰，请重新上传清晰完整的照片",
+		},
+		{
+			Code: "mismatch",
+			Text: "填写的姓名或证件号码与证件照片不一致",
+		},
+		{
+			Code: "expired",
+			Text: "证件已过期，请使用有效期内的证件",
+		},
+		{
+			Code: "incomplete",
+			Text: "证件材料不完整，请上传所有需要的证件照片",
+		},
+	}
+}
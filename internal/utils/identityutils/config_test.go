@@ -0,0 +1,38 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package identityutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/identityutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestConfig_Mask(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var oldConfig = identityutils.DefaultConfig()
+	oldConfig.Hook.Headers = map[string]string{
+		"X-Api-Key": "1234567890abcdef",
+		"X-Token":   "abc",
+	}
+
+	var config = identityutils.DefaultConfig()
+	config.Hook.Headers = map[string]string{
+		"X-Api-Key": oldConfig.Hook.Headers["X-Api-Key"],
+		"X-Token":   oldConfig.Hook.Headers["X-Token"],
+	}
+	config.Mask()
+	a.IsTrue(config.Hook.Headers["X-Api-Key"] == "1234************")
+	a.IsTrue(config.Hook.Headers["X-Token"] == "***")
+	a.IsTrue(oldConfig.Hook.Headers["X-Api-Key"] == "1234567890abcdef")
+
+	// 修改其中一个Header，增加一个新的Header
+	config.Hook.Headers["X-Token"] = "def"
+	config.Hook.Headers["X-New"] = "****"
+	config.UnmaskWith(oldConfig)
+	a.IsTrue(config.Hook.Headers["X-Api-Key"] == "1234567890abcdef")
+	a.IsTrue(config.Hook.Headers["X-Token"] == "def")
+	a.IsTrue(config.Hook.Headers["X-New"] == "")
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package identityutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HookRequest 发送给外部核验接口的内容
+type HookRequest struct {
+	IdentityId int64  `json:"identityId"` // 认证信息ID
+	UserId     int64  `json:"userId"`     // 用户ID
+	OrgType    string `json:"orgType"`    // 组织类型
+	Type       string `json:"type"`       // 证件类型
+	RealName   string `json:"realName"`   // 真实姓名或企业名称
+	Number     string `json:"number"`     // 证件号码
+}
+
+// HookResult 外部核验接口返回的结果
+// 接口需要返回 {"isOk": true|false, "message": "..."} 格式的JSON
+type HookResult struct {
+	IsOk      bool   `json:"isOk"`      // 是否核验通过
+	Message   string `json:"message"`   // 说明
+	Error     string `json:"error"`     // 调用接口时发生的错误
+	CheckedAt int64  `json:"checkedAt"` // 核验时间
+}
+
+// Call 调用外部核验接口
+// 接口无法访问或者返回的内容不正确时，返回的结果中包含错误信息
+func (this *HookConfig) Call(req *HookRequest) *HookResult {
+	var result = &HookResult{
+		CheckedAt: time.Now().Unix(),
+	}
+	err := this.call(req, result)
+	if err != nil {
+		result.IsOk = false
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (this *HookConfig) call(req *HookRequest, result *HookResult) error {
+	if !this.IsOn {
+		return errors.New("hook is not enabled")
+	}
+
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, this.URL, bytes.NewReader(reqJSON))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range this.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	var timeoutSeconds = this.TimeoutSeconds
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DefaultHookTimeoutSeconds
+	}
+	var client = &http.Client{
+		Timeout: time.Duration(timeoutSeconds) * time.Second,
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("invalid response status '" + strconv.Itoa(resp.StatusCode) + "'")
+	}
+
+	var respResult = &HookResult{}
+	err = json.Unmarshal(respData, respResult)
+	if err != nil {
+		return errors.New("decode response failed: " + err.Error())
+	}
+	result.IsOk = respResult.IsOk
+	result.Message = respResult.Message
+	return nil
+}
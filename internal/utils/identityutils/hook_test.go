@@ -0,0 +1,75 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package identityutils_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/identityutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestHookConfig_Call(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req = &identityutils.HookRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		if req.Number == "110101199001011234" {
+			_, _ = w.Write([]byte(`{"isOk":true,"message":"matched"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"isOk":false,"message":"name and number mismatch"}`))
+		}
+	}))
+	defer server.Close()
+
+	var hook = &identityutils.HookConfig{
+		IsOn:    true,
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+	}
+	a.IsNil(hook.Init())
+
+	var result = hook.Call(&identityutils.HookRequest{RealName: "张三", Number: "110101199001011234"})
+	a.IsTrue(result.IsOk)
+	a.IsTrue(result.Message == "matched")
+	a.IsTrue(len(result.Error) == 0)
+
+	result = hook.Call(&identityutils.HookRequest{RealName: "张三", Number: "110101199001019999"})
+	a.IsFalse(result.IsOk)
+	a.IsTrue(len(result.Error) == 0)
+
+	// 接口返回错误
+	hook.Headers = nil
+	result = hook.Call(&identityutils.HookRequest{Number: "110101199001011234"})
+	a.IsFalse(result.IsOk)
+	a.IsTrue(len(result.Error) > 0)
+	t.Log(result.Error)
+}
+
+func TestConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = identityutils.DefaultConfig()
+	a.IsNil(config.Init())
+	a.IsNotNil(config.FindRejectReason("unclear"))
+	a.IsNil(config.FindRejectReason("unknown"))
+
+	config.RejectReasons = append(config.RejectReasons, &identityutils.RejectReason{Code: "unclear", Text: "duplicate"})
+	a.IsNotNil(config.Init())
+
+	config = identityutils.DefaultConfig()
+	config.Hook.IsOn = true
+	a.IsNotNil(config.Init())
+	config.Hook.URL = "ftp://example.com"
+	a.IsNotNil(config.Init())
+	config.Hook.URL = "https://example.com/verify"
+	a.IsNil(config.Init())
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipescalationutils
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	DefaultWindowSeconds = 86400 // 默认重复违规判定时间
+	MaxSteps             = 32    // 最多阶梯数量
+)
+
+// Step 封禁阶梯
+type Step struct {
+	Timeout int64 `yaml:"timeout" json:"timeout"` // 封禁时长（秒），0表示永久
+}
+
+// IsPermanent 是否永久封禁
+func (this *Step) IsPermanent() bool {
+	return this.Timeout <= 0
+}
+
+// Config 名单封禁阶梯配置
+// 比如第一次封禁10分钟，24小时内再次违规封禁1小时，第三次封禁1天，之后永久封禁
+type Config struct {
+	IsOn          bool    `yaml:"isOn" json:"isOn"`                   // 是否启用
+	Steps         []*Step `yaml:"steps" json:"steps"`                 // 阶梯，依次使用，超出后一直使用最后一个阶梯
+	WindowSeconds int64   `yaml:"windowSeconds" json:"windowSeconds"` // 上一次封禁结束后多长时间内再次违规视为重复违规，超出后重新计数
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	if len(this.Steps) == 0 {
+		return errors.New("'steps' should not be empty")
+	}
+	if len(this.Steps) > MaxSteps {
+		return errors.New("'steps' should not be more than " + strconv.Itoa(MaxSteps))
+	}
+	for index, step := range this.Steps {
+		if step == nil {
+			return errors.New("invalid step at " + strconv.Itoa(index))
+		}
+		if step.Timeout < 0 {
+			step.Timeout = 0
+		}
+
+		// 永久封禁之后不会再有违规记录，所以必须是最后一个阶梯
+		if step.IsPermanent() && index != len(this.Steps)-1 {
+			return errors.New("permanent step should be the last one")
+		}
+	}
+	if this.WindowSeconds <= 0 {
+		this.WindowSeconds = DefaultWindowSeconds
+	}
+	return nil
+}
+
+// FindStep 根据违规次数查找对应的阶梯，count从1开始
+func (this *Config) FindStep(count int) *Step {
+	if len(this.Steps) == 0 {
+		return nil
+	}
+	if count <= 0 {
+		count = 1
+	}
+	if count > len(this.Steps) {
+		return this.Steps[len(this.Steps)-1]
+	}
+	return this.Steps[count-1]
+}
+
+// ComputeExpiredAt 计算第count次违规的过期时间，返回0表示永久封禁
+func (this *Config) ComputeExpiredAt(count int, now int64) int64 {
+	var step = this.FindStep(count)
+	if step == nil || step.IsPermanent() {
+		return 0
+	}
+	return now + step.Timeout
+}
+
+// ComputeResetAt 计算违规计数重置时间，返回0表示永不重置
+func (this *Config) ComputeResetAt(expiredAt int64) int64 {
+	if expiredAt <= 0 {
+		return 0
+	}
+	var windowSeconds = this.WindowSeconds
+	if windowSeconds <= 0 {
+		windowSeconds = DefaultWindowSeconds
+	}
+	return expiredAt + windowSeconds
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipescalationutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipescalationutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsNotNil((&ipescalationutils.Config{}).Init())
+	a.IsNotNil((&ipescalationutils.Config{Steps: []*ipescalationutils.Step{{Timeout: 0}, {Timeout: 600}}}).Init())
+
+	var config = &ipescalationutils.Config{Steps: []*ipescalationutils.Step{{Timeout: 600}, {Timeout: -1}}}
+	a.IsNil(config.Init())
+	a.IsTrue(config.WindowSeconds == ipescalationutils.DefaultWindowSeconds)
+	a.IsTrue(config.Steps[1].IsPermanent())
+}
+
+func TestConfig_ComputeExpiredAt(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &ipescalationutils.Config{
+		IsOn: true,
+		Steps: []*ipescalationutils.Step{
+			{Timeout: 600},
+			{Timeout: 3600},
+			{Timeout: 86400},
+			{Timeout: 0},
+		},
+	}
+	a.IsNil(config.Init())
+
+	var now int64 = 1_000_000
+	a.IsTrue(config.ComputeExpiredAt(0, now) == now+600)
+	a.IsTrue(config.ComputeExpiredAt(1, now) == now+600)
+	a.IsTrue(config.ComputeExpiredAt(2, now) == now+3600)
+	a.IsTrue(config.ComputeExpiredAt(3, now) == now+86400)
+	a.IsTrue(config.ComputeExpiredAt(4, now) == 0)
+	a.IsTrue(config.ComputeExpiredAt(100, now) == 0)
+
+	a.IsTrue(config.ComputeResetAt(now+600) == now+600+86400)
+	a.IsTrue(config.ComputeResetAt(0) == 0)
+}
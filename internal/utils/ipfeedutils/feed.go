@@ -0,0 +1,212 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipfeedutils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/iwind/TeaGo/maps"
+)
+
+type Format = string
+
+const (
+	FormatPlain        Format = "plain"        // 每行一个IP、CIDR或IP范围，支持 # 注释
+	FormatSpamhausDrop Format = "spamhausDrop" // Spamhaus DROP格式，使用 ; 注释，每行第一列为CIDR
+	FormatCSV          Format = "csv"          // CSV中的某一列
+	FormatJSON         Format = "json"         // JSON中某个路径的值
+)
+
+const (
+	DefaultRefreshSeconds = 3600
+	MinRefreshSeconds     = 60
+	DefaultTimeoutSeconds = 60
+
+	MaxBodySize = 64 << 20 // 订阅源内容最大尺寸
+)
+
+// FindAllFormats 所有支持的格式
+func FindAllFormats() []maps.Map {
+	return []maps.Map{
+		{"name": "纯文本", "code": FormatPlain, "description": "每行一个IP、CIDR或IP范围，以#开头的为注释"},
+		{"name": "Spamhaus DROP", "code": FormatSpamhausDrop, "description": "每行第一列为CIDR，以;开头的为注释"},
+		{"name": "CSV", "code": FormatCSV, "description": "读取CSV中的某一列"},
+		{"name": "JSON", "code": FormatJSON, "description": "读取JSON中某个路径的值，比如 prefixes.*.ip_prefix"},
+	}
+}
+
+// FeedConfig 订阅源配置
+type FeedConfig struct {
+	URL             string `yaml:"url" json:"url"`                         // 订阅源URL
+	Format          Format `yaml:"format" json:"format"`                   // 格式
+	CSVColumn       string `yaml:"csvColumn" json:"csvColumn"`             // CSV列序号（从0开始）或列名
+	CSVHasHeader    bool   `yaml:"csvHasHeader" json:"csvHasHeader"`       // CSV是否有表头
+	JSONPath        string `yaml:"jsonPath" json:"jsonPath"`               // JSON路径
+	RefreshSeconds  int    `yaml:"refreshSeconds" json:"refreshSeconds"`   // 刷新间隔
+	TimeoutSeconds  int    `yaml:"timeoutSeconds" json:"timeoutSeconds"`   // 下载超时时间
+	AuthHeaderName  string `yaml:"authHeaderName" json:"authHeaderName"`   // 认证Header名称，比如 Authorization
+	AuthHeaderValue string `yaml:"authHeaderValue" json:"authHeaderValue"` // 认证Header值
+}
+
+// Init 校验并初始化
+func (this *FeedConfig) Init() error {
+	this.URL = strings.TrimSpace(this.URL)
+	if len(this.URL) == 0 {
+		return errors.New("'url' should not be empty")
+	}
+	u, err := url.Parse(this.URL)
+	if err != nil {
+		return fmt.Errorf("invalid 'url': %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("invalid 'url': scheme should be 'http' or 'https'")
+	}
+
+	switch this.Format {
+	case "":
+		this.Format = FormatPlain
+	case FormatPlain, FormatSpamhausDrop, FormatCSV, FormatJSON:
+	default:
+		return errors.New("unknown format '" + this.Format + "'")
+	}
+
+	if this.RefreshSeconds <= 0 {
+		this.RefreshSeconds = DefaultRefreshSeconds
+	} else if this.RefreshSeconds < MinRefreshSeconds {
+		this.RefreshSeconds = MinRefreshSeconds
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+
+	if len(this.AuthHeaderValue) > 0 && len(this.AuthHeaderName) == 0 {
+		this.AuthHeaderName = "Authorization"
+	}
+
+	return nil
+}
+
+// Mask 对认证信息进行掩码，以便返回给界面
+func (this *FeedConfig) Mask() {
+	this.AuthHeaderValue = MaskString(this.AuthHeaderValue)
+}
+
+// UnmaskWith 认证信息为掩码后的值时，使用旧的设置中的值
+func (this *FeedConfig) UnmaskWith(oldConfig *FeedConfig) {
+	if !IsMasked(this.AuthHeaderValue) {
+		return
+	}
+	if oldConfig == nil {
+		this.AuthHeaderValue = ""
+		return
+	}
+	this.AuthHeaderValue = oldConfig.AuthHeaderValue
+}
+
+// MaskString 对字符串进行掩码
+func MaskString(s string) string {
+	var l = len(s)
+	if l == 0 {
+		return ""
+	}
+	if l < 8 {
+		return strings.Repeat("*", l)
+	}
+	return s[:4] + strings.Repeat("*", l-4)
+}
+
+// IsMasked 判断字符串是否被掩码
+func IsMasked(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	return s == strings.Repeat("*", len(s)) || strings.HasSuffix(s, "**")
+}
+
+// FetchResult 下载结果
+type FetchResult struct {
+	Values       []string // 解析出的值
+	CountInvalid int      // 无法识别的行数
+	ETag         string
+	LastModified string
+	NotModified  bool // 内容未改变
+}
+
+// Fetch 下载并解析订阅源
+// etag和lastModified为上次下载时返回的值，用来避免重复下载未改变的内容
+func Fetch(config *FeedConfig, etag string, lastModified string) (*FetchResult, error) {
+	if config == nil {
+		return nil, errors.New("invalid feed config")
+	}
+	err := config.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", teaconst.ProcessName+"/"+teaconst.Version)
+	if len(config.AuthHeaderName) > 0 {
+		req.Header.Set(config.AuthHeaderName, config.AuthHeaderValue)
+	}
+	if len(etag) > 0 {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	var client = &http.Client{
+		Timeout: time.Duration(config.TimeoutSeconds) * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var result = &FetchResult{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBodySize {
+		return nil, fmt.Errorf("feed is too large, should be less than %d bytes", MaxBodySize)
+	}
+
+	result.Values, result.CountInvalid, err = Parse(config, data)
+	if err != nil {
+		return nil, fmt.Errorf("parse feed failed: %w", err)
+	}
+	return result, nil
+}
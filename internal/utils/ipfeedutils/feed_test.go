@@ -0,0 +1,158 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipfeedutils_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestParse_Plain(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	values, countInvalid, err := ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatPlain}, []byte(`# comment
+1.2.3.4
+1.2.3.0/24 # inline comment
+192.168.1.5/24
+
+10.0.0.2-10.0.0.1
+2001:db8::1
+1.2.3.4
+not-an-ip
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(values)
+	a.IsTrue(len(values) == 5)
+	a.IsTrue(values[2] == "192.168.1.0/24")
+	a.IsTrue(values[3] == "10.0.0.1-10.0.0.2")
+	a.IsTrue(countInvalid == 1)
+}
+
+func TestParse_SpamhausDrop(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	values, _, err := ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatSpamhausDrop}, []byte(`; Spamhaus DROP List 2024/01/01
+; Last-Modified: Mon, 01 Jan 2024 00:00:00 GMT
+1.10.16.0/20 ; SBL256894
+1.19.0.0/16 ; SBL434604
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(values) == 2)
+	a.IsTrue(values[0] == "1.10.16.0/20")
+}
+
+func TestParse_CSV(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var data = []byte(`id,ip,reason
+1,1.1.1.1,spam
+2,"2.2.2.0/24",scan
+`)
+	values, _, err := ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatCSV, CSVColumn: "ip", CSVHasHeader: true}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(values) == 2)
+
+	values, _, err = ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatCSV, CSVColumn: "1", CSVHasHeader: true}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(values) == 2)
+	a.IsTrue(values[1] == "2.2.2.0/24")
+}
+
+func TestParse_JSON(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	values, _, err := ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatJSON, JSONPath: "prefixes.*.ip_prefix"}, []byte(`{
+	"prefixes": [
+		{"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2"},
+		{"ip_prefix": "13.34.37.64/27", "region": "ap-southeast-4"},
+		{"region": "none"}
+	]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(values) == 2)
+
+	values, _, err = ipfeedutils.Parse(&ipfeedutils.FeedConfig{Format: ipfeedutils.FormatJSON}, []byte(`["1.1.1.1", "2.2.2.2"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(values) == 2)
+}
+
+func TestFetch(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Token") != "123456" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", `"v1"`)
+		_, _ = writer.Write([]byte("1.1.1.1\n2.2.2.0/24\n"))
+	}))
+	defer server.Close()
+
+	var config = &ipfeedutils.FeedConfig{
+		URL:             server.URL,
+		AuthHeaderName:  "X-Token",
+		AuthHeaderValue: "123456",
+	}
+	result, err := ipfeedutils.Fetch(config, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(result.Values) == 2)
+	a.IsTrue(result.ETag == `"v1"`)
+
+	result, err = ipfeedutils.Fetch(config, result.ETag, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(result.NotModified)
+
+	config.AuthHeaderValue = "wrong"
+	_, err = ipfeedutils.Fetch(config, "", "")
+	a.IsNotNil(err)
+}
+
+func TestFeedConfig_Mask(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var oldConfig = &ipfeedutils.FeedConfig{
+		AuthHeaderName:  "Authorization",
+		AuthHeaderValue: "Bearer 1234567890",
+	}
+
+	var config = &ipfeedutils.FeedConfig{
+		AuthHeaderName:  oldConfig.AuthHeaderName,
+		AuthHeaderValue: oldConfig.AuthHeaderValue,
+	}
+	config.Mask()
+	a.IsTrue(config.AuthHeaderValue != oldConfig.AuthHeaderValue)
+	a.IsTrue(ipfeedutils.IsMasked(config.AuthHeaderValue))
+
+	config.UnmaskWith(oldConfig)
+	a.IsTrue(config.AuthHeaderValue == oldConfig.AuthHeaderValue)
+
+	// 修改为新值
+	config.AuthHeaderValue = "Bearer abc"
+	config.UnmaskWith(oldConfig)
+	a.IsTrue(config.AuthHeaderValue == "Bearer abc")
+}
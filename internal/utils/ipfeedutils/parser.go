@@ -0,0 +1,236 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipfeedutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/iwind/TeaGo/types"
+)
+
+// Parse 解析订阅源内容，返回去重后的IP、CIDR或IP范围（ip1-ip2）
+// 无法识别的行会被忽略，并计入 countInvalid
+func Parse(config *FeedConfig, data []byte) (values []string, countInvalid int, err error) {
+	if config == nil {
+		return nil, 0, errors.New("invalid feed config")
+	}
+
+	var rawValues []string
+	switch config.Format {
+	case FormatPlain, "":
+		rawValues, err = parseLines(data, []string{"#", "//"})
+	case FormatSpamhausDrop:
+		rawValues, err = parseLines(data, []string{";", "#"})
+	case FormatCSV:
+		rawValues, err = parseCSV(data, config.CSVColumn, config.CSVHasHeader)
+	case FormatJSON:
+		rawValues, err = parseJSON(data, config.JSONPath)
+	default:
+		return nil, 0, errors.New("unknown feed format '" + config.Format + "'")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var valueMap = map[string]bool{}
+	for _, rawValue := range rawValues {
+		value, ok := NormalizeValue(rawValue)
+		if !ok {
+			countInvalid++
+			continue
+		}
+		if valueMap[value] {
+			continue
+		}
+		valueMap[value] = true
+		values = append(values, value)
+	}
+	return
+}
+
+// NormalizeValue 规范化单个IP、CIDR或IP范围
+func NormalizeValue(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return "", false
+	}
+
+	// ip/mask
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", false
+		}
+		return ipNet.String(), true
+	}
+
+	// ip1-ip2
+	if strings.Contains(value, "-") {
+		var pieces = strings.SplitN(value, "-", 2)
+		var ipFrom = net.ParseIP(strings.TrimSpace(pieces[0]))
+		var ipTo = net.ParseIP(strings.TrimSpace(pieces[1]))
+		if ipFrom == nil || ipTo == nil {
+			return "", false
+		}
+		if (ipFrom.To4() == nil) != (ipTo.To4() == nil) {
+			return "", false
+		}
+		if bytes.Compare(ipFrom.To16(), ipTo.To16()) > 0 {
+			ipFrom, ipTo = ipTo, ipFrom
+		}
+		if ipFrom.Equal(ipTo) {
+			return ipFrom.String(), true
+		}
+		return ipFrom.String() + "-" + ipTo.String(), true
+	}
+
+	var ip = net.ParseIP(value)
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// 按行解析，去除注释
+func parseLines(data []byte, commentPrefixes []string) (result []string, err error) {
+	var scanner = bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var line = scanner.Text()
+		for _, prefix := range commentPrefixes {
+			var index = strings.Index(line, prefix)
+			if index >= 0 {
+				line = line[:index]
+			}
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// 只取第一列，比如 "1.2.3.0/24 SBL123"
+		var fields = strings.Fields(line)
+		result = append(result, fields[0])
+	}
+	err = scanner.Err()
+	return
+}
+
+// 解析CSV中的某一列
+// column 可以是从0开始的列序号，或者在有表头时使用列名
+func parseCSV(data []byte, column string, hasHeader bool) (result []string, err error) {
+	var reader = csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var columnIndex = -1
+	if len(column) == 0 {
+		columnIndex = 0
+	} else if types.Int(column) > 0 || column == "0" {
+		columnIndex = types.Int(column)
+	}
+
+	var isFirst = true
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if isFirst {
+			isFirst = false
+			if hasHeader {
+				if columnIndex < 0 {
+					for index, name := range record {
+						if strings.EqualFold(strings.TrimSpace(name), column) {
+							columnIndex = index
+							break
+						}
+					}
+				}
+				continue
+			}
+		}
+
+		if columnIndex < 0 {
+			return nil, errors.New("csv column '" + column + "' not found")
+		}
+		if columnIndex < len(record) {
+			result = append(result, record[columnIndex])
+		}
+	}
+	return
+}
+
+// 根据路径解析JSON中的值
+// 路径使用点（.）分隔，数组使用星号（*）表示，比如 "prefixes.*.ip_prefix"；路径为空时表示顶层为字符串数组
+func parseJSON(data []byte, path string) (result []string, err error) {
+	var root any
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []string
+	path = strings.Trim(strings.TrimSpace(path), ".")
+	if len(path) > 0 {
+		pieces = strings.Split(path, ".")
+	}
+	collectJSON(root, pieces, &result)
+	return
+}
+
+func collectJSON(value any, pieces []string, result *[]string) {
+	if len(pieces) == 0 {
+		switch v := value.(type) {
+		case string:
+			*result = append(*result, v)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					*result = append(*result, s)
+				}
+			}
+		}
+		return
+	}
+
+	var piece = pieces[0]
+	switch v := value.(type) {
+	case []any:
+		if piece == "*" {
+			for _, item := range v {
+				collectJSON(item, pieces[1:], result)
+			}
+		} else {
+			var index = types.Int(piece)
+			if (index > 0 || piece == "0") && index < len(v) {
+				collectJSON(v[index], pieces[1:], result)
+			}
+		}
+	case map[string]any:
+		if piece == "*" {
+			for _, item := range v {
+				collectJSON(item, pieces[1:], result)
+			}
+		} else {
+			item, ok := v[piece]
+			if ok {
+				collectJSON(item, pieces[1:], result)
+			}
+		}
+	}
+}
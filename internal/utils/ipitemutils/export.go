@@ -0,0 +1,79 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipitemutils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iwind/TeaGo/types"
+)
+
+// ExportItem 导出的条目
+type ExportItem struct {
+	Value     string `json:"value"`
+	Type      string `json:"type"`
+	ExpiredAt int64  `json:"expiredAt"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Export 导出条目
+// 导出的数据可以直接使用 ParseImport 重新导入
+func Export(format Format, items []*ExportItem) ([]byte, error) {
+	var buf = &bytes.Buffer{}
+	switch format {
+	case FormatText, "":
+		for _, item := range items {
+			buf.WriteString(item.Value)
+			if item.ExpiredAt > 0 || len(item.Reason) > 0 {
+				buf.WriteString(",")
+				if item.ExpiredAt > 0 {
+					buf.WriteString(time.Unix(item.ExpiredAt, 0).Format(expiryTimeLayout))
+				}
+				if len(item.Reason) > 0 {
+					// 原因中不能有换行
+					buf.WriteString("," + strings.Join(strings.Fields(item.Reason), " "))
+				}
+			}
+			buf.WriteString("\n")
+		}
+	case FormatCSV:
+		var writer = csv.NewWriter(buf)
+		err := writer.Write([]string{"value", "expiredAt", "reason", "type", "createdAt"})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var expiredAt = ""
+			if item.ExpiredAt > 0 {
+				expiredAt = types.String(item.ExpiredAt)
+			}
+			err = writer.Write([]string{item.Value, expiredAt, item.Reason, item.Type, types.String(item.CreatedAt)})
+			if err != nil {
+				return nil, err
+			}
+		}
+		writer.Flush()
+		err = writer.Error()
+		if err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		if items == nil {
+			items = []*ExportItem{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	default:
+		return nil, errors.New("unknown format '" + format + "'")
+	}
+	return buf.Bytes(), nil
+}
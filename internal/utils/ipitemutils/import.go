@@ -0,0 +1,284 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipitemutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
+	"github.com/iwind/TeaGo/types"
+)
+
+type Format = string
+
+const (
+	FormatText Format = "text" // 每行一条：IP[,过期时间[,原因]]
+	FormatCSV  Format = "csv"  // 可以有表头：value,expiredAt,reason
+	FormatJSON Format = "json" // [{"value":"", "expiredAt":0, "reason":""}]
+)
+
+const expiryTimeLayout = "2006-01-02 15:04:05"
+
+var expiryTimestampReg = regexp.MustCompile(`^\d+$`)
+var expiryDurationReg = regexp.MustCompile(`^(\d+)\s*([smhdw])$`)
+
+// Row 导入的单行数据
+type Row struct {
+	Line      int    `json:"line"`      // 行号，从1开始
+	Value     string `json:"value"`     // 规范化后的IP、CIDR或IP范围
+	ExpiredAt int64  `json:"expiredAt"` // 过期时间，0表示不过期
+	Reason    string `json:"reason"`    // 原因
+}
+
+// RowError 无法导入的行
+type RowError struct {
+	Line  int    `json:"line"`
+	Raw   string `json:"raw"`
+	Error string `json:"error"`
+}
+
+// ParseImport 解析导入的数据
+// 同一个IP出现多次时以最后一次为准；无法识别的行会返回在 rowErrors 中
+func ParseImport(format Format, data []byte, now time.Time) (rows []*Row, rowErrors []*RowError, err error) {
+	var rawRows []*rawRow
+	switch format {
+	case FormatText, "":
+		rawRows, err = readTextRows(data)
+	case FormatCSV:
+		rawRows, err = readCSVRows(data)
+	case FormatJSON:
+		rawRows, err = readJSONRows(data)
+	default:
+		return nil, nil, errors.New("unknown format '" + format + "'")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var indexMap = map[string]int{} // value => index in rows
+	for _, rawRow := range rawRows {
+		value, ok := NormalizeValue(rawRow.value)
+		if !ok {
+			rowErrors = append(rowErrors, &RowError{Line: rawRow.line, Raw: rawRow.raw, Error: "invalid ip '" + rawRow.value + "'"})
+			continue
+		}
+
+		expiredAt, err := ParseExpiry(rawRow.expiry, now)
+		if err != nil {
+			rowErrors = append(rowErrors, &RowError{Line: rawRow.line, Raw: rawRow.raw, Error: err.Error()})
+			continue
+		}
+		if expiredAt > 0 && expiredAt <= now.Unix() {
+			rowErrors = append(rowErrors, &RowError{Line: rawRow.line, Raw: rawRow.raw, Error: "already expired"})
+			continue
+		}
+
+		var row = &Row{
+			Line:      rawRow.line,
+			Value:     value,
+			ExpiredAt: expiredAt,
+			Reason:    strings.TrimSpace(rawRow.reason),
+		}
+		index, ok := indexMap[value]
+		if ok {
+			rows[index] = row
+		} else {
+			indexMap[value] = len(rows)
+			rows = append(rows, row)
+		}
+	}
+	return
+}
+
+// NormalizeValue 规范化单个IP、CIDR、IP范围或者ASN（比如AS12345）
+func NormalizeValue(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		number, ok := iplibraryutils.ParseASN(value)
+		if !ok {
+			return "", false
+		}
+		return iplibraryutils.FormatASN(number), true
+	}
+	return ipfeedutils.NormalizeValue(value)
+}
+
+// ParseExpiry 解析过期时间
+// 支持：空或0（不过期）、Unix时间戳、"2006-01-02"、"2006-01-02 15:04:05"，以及相对时间比如"30m"、"12h"、"7d"、"2w"
+func ParseExpiry(expiry string, now time.Time) (int64, error) {
+	expiry = strings.TrimSpace(expiry)
+	if len(expiry) == 0 || expiry == "0" {
+		return 0, nil
+	}
+
+	// timestamp
+	if expiryTimestampReg.MatchString(expiry) {
+		return types.Int64(expiry), nil
+	}
+
+	// duration
+	var matches = expiryDurationReg.FindStringSubmatch(strings.ToLower(expiry))
+	if len(matches) == 3 {
+		var count = types.Int64(matches[1])
+		var unit time.Duration
+		switch matches[2] {
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		}
+		return now.Add(time.Duration(count) * unit).Unix(), nil
+	}
+
+	for _, layout := range []string{expiryTimeLayout, "2006-01-02 15:04", "2006-01-02", time.RFC3339} {
+		t, err := time.ParseInLocation(layout, expiry, now.Location())
+		if err == nil {
+			return t.Unix(), nil
+		}
+	}
+
+	return 0, errors.New("invalid expiry '" + expiry + "'")
+}
+
+type rawRow struct {
+	line   int
+	raw    string
+	value  string
+	expiry string
+	reason string
+}
+
+func readTextRows(data []byte) (result []*rawRow, err error) {
+	var scanner = bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var lineNo = 0
+	for scanner.Scan() {
+		lineNo++
+		var line = strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// 原因中可以包含逗号
+		var pieces = strings.SplitN(line, ",", 3)
+		if len(pieces) == 1 {
+			pieces = strings.SplitN(line, "\t", 3)
+		}
+		var row = &rawRow{
+			line:  lineNo,
+			raw:   line,
+			value: strings.TrimSpace(pieces[0]),
+		}
+		if len(pieces) > 1 {
+			row.expiry = pieces[1]
+		}
+		if len(pieces) > 2 {
+			row.reason = pieces[2]
+		}
+		result = append(result, row)
+	}
+	err = scanner.Err()
+	return
+}
+
+func readCSVRows(data []byte) (result []*rawRow, err error) {
+	var reader = csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var valueIndex, expiryIndex, reasonIndex = 0, 1, 2
+	var isFirst = true
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		// 表头
+		if isFirst {
+			isFirst = false
+			if lookupColumn(record, "value") >= 0 {
+				valueIndex = lookupColumn(record, "value")
+				expiryIndex = lookupColumn(record, "expiredAt")
+				reasonIndex = lookupColumn(record, "reason")
+				continue
+			}
+		}
+
+		var row = &rawRow{
+			line: line,
+			raw:  strings.Join(record, ","),
+		}
+		if valueIndex >= 0 && valueIndex < len(record) {
+			row.value = strings.TrimSpace(record[valueIndex])
+		}
+		if expiryIndex >= 0 && expiryIndex < len(record) {
+			row.expiry = record[expiryIndex]
+		}
+		if reasonIndex >= 0 && reasonIndex < len(record) {
+			row.reason = record[reasonIndex]
+		}
+		result = append(result, row)
+	}
+	return
+}
+
+func readJSONRows(data []byte) (result []*rawRow, err error) {
+	var items = []map[string]any{}
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&items)
+	if err != nil {
+		return nil, err
+	}
+	for index, item := range items {
+		var row = &rawRow{
+			line:   index + 1,
+			value:  jsonString(item["value"]),
+			expiry: jsonString(item["expiredAt"]),
+			reason: jsonString(item["reason"]),
+		}
+		row.raw = row.value
+		result = append(result, row)
+	}
+	return
+}
+
+func jsonString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+func lookupColumn(header []string, name string) int {
+	for index, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), name) {
+			return index
+		}
+	}
+	return -1
+}
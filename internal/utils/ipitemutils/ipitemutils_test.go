@@ -0,0 +1,109 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ipitemutils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipitemutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestParseExpiry(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for _, expiry := range []string{"", "0", "1893456000", "7d", "2h", "2025-01-01", "2025-01-01 12:00:00"} {
+		expiredAt, err := ipitemutils.ParseExpiry(expiry, now)
+		if err != nil {
+			t.Fatal(expiry, err)
+		}
+		t.Log(expiry, "=>", expiredAt)
+	}
+
+	expiredAt, _ := ipitemutils.ParseExpiry("7d", now)
+	a.IsTrue(expiredAt == now.Unix()+7*86400)
+
+	_, err := ipitemutils.ParseExpiry("tomorrow", now)
+	a.IsNotNil(err)
+}
+
+func TestParseImport_Text(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	rows, rowErrors, err := ipitemutils.ParseImport(ipitemutils.FormatText, []byte(`# comment
+1.1.1.1
+2.2.2.0/24, 7d, scanner, from log
+3.3.3.1-3.3.3.10,,manual
+1.1.1.1,,duplicated
+bad-ip
+4.4.4.4, 2000-01-01
+`), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(rows) == 3)
+	a.IsTrue(rows[0].Reason == "duplicated")
+	a.IsTrue(rows[1].Reason == "scanner, from log")
+	a.IsTrue(rows[1].ExpiredAt > 0)
+	a.IsTrue(len(rowErrors) == 2)
+	a.IsTrue(rowErrors[0].Line == 6)
+}
+
+func TestExport_Roundtrip(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var items = []*ipitemutils.ExportItem{
+		{Value: "1.1.1.1", Type: "ipv4"},
+		{Value: "2.2.2.0/24", Type: "ipv4", ExpiredAt: time.Now().Unix() + 3600, Reason: "scanner, \"bad\""},
+	}
+	for _, format := range []string{ipitemutils.FormatText, ipitemutils.FormatCSV, ipitemutils.FormatJSON} {
+		data, err := ipitemutils.Export(format, items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(format + ":\n" + string(data))
+
+		rows, rowErrors, err := ipitemutils.ParseImport(format, data, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(len(rowErrors) == 0)
+		a.IsTrue(len(rows) == 2)
+		a.IsTrue(rows[1].Reason == items[1].Reason)
+		a.IsTrue(rows[1].ExpiredAt == items[1].ExpiredAt)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, value := range []string{"1.1.1.1", "2.2.2.0/24", "3.3.3.1-3.3.3.10", "AS13335", "as13335"} {
+		newValue, ok := ipitemutils.NormalizeValue(value)
+		a.IsTrue(ok)
+		t.Log(value, "=>", newValue)
+	}
+
+	newValue, _ := ipitemutils.NormalizeValue("as13335")
+	a.IsTrue(newValue == "AS13335")
+
+	for _, value := range []string{"", "AS", "ASx", "AS0", "13335"} {
+		_, ok := ipitemutils.NormalizeValue(value)
+		a.IsFalse(ok)
+	}
+
+	// 导出的ASN条目可以重新导入
+	data, err := ipitemutils.Export(ipitemutils.FormatCSV, []*ipitemutils.ExportItem{
+		{Value: "AS13335", Type: "asn"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, rowErrors, err := ipitemutils.ParseImport(ipitemutils.FormatCSV, data, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(rowErrors) == 0)
+	a.IsTrue(len(rows) == 1 && rows[0].Value == "AS13335")
+}
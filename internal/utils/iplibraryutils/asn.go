@@ -0,0 +1,299 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ASN 自治系统
+type ASN struct {
+	Number       uint32 `json:"number"`       // AS号码
+	Organization string `json:"organization"` // 所属组织
+}
+
+// String 转换为 "AS12345" 的形式
+func (this *ASN) String() string {
+	return FormatASN(this.Number)
+}
+
+// FormatASN 格式化AS号码
+func FormatASN(number uint32) string {
+	return "AS" + strconv.FormatUint(uint64(number), 10)
+}
+
+// ParseASN 解析 "AS12345"、"as12345" 或者 "12345" 形式的AS号码
+func ParseASN(value string) (number uint32, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		value = value[2:]
+	}
+	if len(value) == 0 || len(value) > 10 {
+		return 0, false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+type asnRange struct {
+	from   []byte
+	to     []byte
+	number uint32
+}
+
+// ASNLibrary IP到ASN的对照库
+// 序列化格式为gzip压缩的文本，先是 "#number\torganization" 行，再是 "ipFrom\tipTo\tnumber" 行
+type ASNLibrary struct {
+	ranges    []*asnRange
+	asnMap    map[uint32]*ASN // number => *ASN
+	isSorted  bool
+	rangeKeys map[string]bool
+}
+
+func NewASNLibrary() *ASNLibrary {
+	return &ASNLibrary{
+		asnMap:    map[uint32]*ASN{},
+		rangeKeys: map[string]bool{},
+	}
+}
+
+// Add 添加IP范围
+func (this *ASNLibrary) Add(ipFrom string, ipTo string, number uint32, organization string) error {
+	if number == 0 {
+		return nil
+	}
+
+	var from = ipBytes(ipFrom)
+	var to = ipBytes(ipTo)
+	if from == nil || to == nil || len(from) != len(to) {
+		return errors.New("invalid ip range '" + ipFrom + "-" + ipTo + "'")
+	}
+	if bytes.Compare(from, to) > 0 {
+		from, to = to, from
+	}
+
+	var rangeKey = string(from) + string(to)
+	if this.rangeKeys[rangeKey] {
+		return nil
+	}
+	this.rangeKeys[rangeKey] = true
+
+	this.ranges = append(this.ranges, &asnRange{
+		from:   from,
+		to:     to,
+		number: number,
+	})
+	this.isSorted = false
+
+	asn, ok := this.asnMap[number]
+	if !ok {
+		this.asnMap[number] = &ASN{
+			Number:       number,
+			Organization: organization,
+		}
+	} else if len(asn.Organization) == 0 {
+		asn.Organization = organization
+	}
+	return nil
+}
+
+// Len 范围数量
+func (this *ASNLibrary) Len() int {
+	return len(this.ranges)
+}
+
+// ASNs 所有的ASN，按号码排序
+func (this *ASNLibrary) ASNs() []*ASN {
+	var result = []*ASN{}
+	for _, asn := range this.asnMap {
+		result = append(result, asn)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Number < result[j].Number
+	})
+	return result
+}
+
+// FindASN 根据号码查找ASN
+func (this *ASNLibrary) FindASN(number uint32) *ASN {
+	return this.asnMap[number]
+}
+
+// Lookup 查找IP所属的ASN
+func (this *ASNLibrary) Lookup(ip string) *ASN {
+	if !this.isSorted {
+		return nil
+	}
+
+	var ipData = ipBytes(ip)
+	if ipData == nil {
+		return nil
+	}
+
+	// 找到第一个 to >= ip 的范围
+	var index = sort.Search(len(this.ranges), func(i int) bool {
+		var r = this.ranges[i]
+		if len(r.to) != len(ipData) {
+			return len(r.to) > len(ipData)
+		}
+		return bytes.Compare(r.to, ipData) >= 0
+	})
+	if index >= len(this.ranges) {
+		return nil
+	}
+	var r = this.ranges[index]
+	if len(r.from) != len(ipData) || bytes.Compare(r.from, ipData) > 0 {
+		return nil
+	}
+	return this.asnMap[r.number]
+}
+
+// Sort 排序，在查询之前必须调用
+func (this *ASNLibrary) Sort() {
+	sort.Slice(this.ranges, func(i, j int) bool {
+		var r1 = this.ranges[i]
+		var r2 = this.ranges[j]
+		if len(r1.from) != len(r2.from) {
+			return len(r1.from) < len(r2.from)
+		}
+		return bytes.Compare(r1.from, r2.from) < 0
+	})
+	this.isSorted = true
+}
+
+// Encode 序列化
+func (this *ASNLibrary) Encode(writer io.Writer) error {
+	if !this.isSorted {
+		this.Sort()
+	}
+
+	var gzipWriter = gzip.NewWriter(writer)
+	var bufWriter = bufio.NewWriter(gzipWriter)
+	for _, asn := range this.ASNs() {
+		_, err := bufWriter.WriteString("#" + strconv.FormatUint(uint64(asn.Number), 10) + "\t" + strings.ReplaceAll(asn.Organization, "\n", " ") + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range this.ranges {
+		_, err := bufWriter.WriteString(net.IP(r.from).String() + "\t" + net.IP(r.to).String() + "\t" + strconv.FormatUint(uint64(r.number), 10) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	err := bufWriter.Flush()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// DecodeASNLibrary 反序列化
+func DecodeASNLibrary(reader io.Reader) (*ASNLibrary, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+
+	var library = NewASNLibrary()
+	var organizationMap = map[uint32]string{} // number => organization
+	var scanner = bufio.NewScanner(gzipReader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '#' {
+			var pieces = strings.SplitN(line[1:], "\t", 2)
+			number, ok := ParseASN(pieces[0])
+			if ok && len(pieces) == 2 {
+				organizationMap[number] = pieces[1]
+			}
+			continue
+		}
+		var pieces = strings.Split(line, "\t")
+		if len(pieces) != 3 {
+			return nil, errors.New("invalid asn library line '" + line + "'")
+		}
+		number, ok := ParseASN(pieces[2])
+		if !ok {
+			return nil, errors.New("invalid asn library line '" + line + "'")
+		}
+		err = library.Add(pieces[0], pieces[1], number, organizationMap[number])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	library.rangeKeys = map[string]bool{}
+	library.Sort()
+	return library, nil
+}
+
+func ipBytes(ip string) []byte {
+	var netIP = net.ParseIP(ip)
+	if netIP == nil {
+		return nil
+	}
+	if ip4 := netIP.To4(); ip4 != nil {
+		return ip4
+	}
+	return netIP
+}
+
+var sharedASNLibrary *ASNLibrary
+var sharedASNLocker = &sync.RWMutex{}
+
+// SetSharedASNLibrary 设置当前使用的ASN库
+func SetSharedASNLibrary(library *ASNLibrary) {
+	sharedASNLocker.Lock()
+	sharedASNLibrary = library
+	sharedASNLocker.Unlock()
+}
+
+// LookupASN 使用当前ASN库查找IP所属的ASN
+func LookupASN(ip string) *ASN {
+	sharedASNLocker.RLock()
+	var library = sharedASNLibrary
+	sharedASNLocker.RUnlock()
+	if library == nil {
+		return nil
+	}
+	return library.Lookup(ip)
+}
+
+// FindSharedASN 使用当前ASN库查找某个ASN
+func FindSharedASN(number uint32) *ASN {
+	sharedASNLocker.RLock()
+	var library = sharedASNLibrary
+	sharedASNLocker.RUnlock()
+	if library == nil {
+		return nil
+	}
+	return library.FindASN(number)
+}
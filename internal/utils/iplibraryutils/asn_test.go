@@ -0,0 +1,93 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/iplibraryutils"
+)
+
+func TestParseASN(t *testing.T) {
+	for value, expected := range map[string]uint32{
+		"AS12345":     12345,
+		"as13335":     13335,
+		" 4134 ":      4134,
+		"AS":          0,
+		"ASabc":       0,
+		"0":           0,
+		"4294967296":  0,
+		"AS-1":        0,
+		"192.168.1.1": 0,
+	} {
+		number, ok := iplibraryutils.ParseASN(value)
+		if number != expected || ok != (expected > 0) {
+			t.Fatal(value, "=>", number, ok)
+		}
+	}
+}
+
+func TestASNLibrary(t *testing.T) {
+	var library = iplibraryutils.NewASNLibrary()
+	for _, r := range []struct {
+		from   string
+		to     string
+		number uint32
+		org    string
+	}{
+		{"1.1.1.0", "1.1.1.255", 13335, "Cloudflare"},
+		{"8.8.8.0", "8.8.8.255", 15169, "Google"},
+		{"1.0.0.0", "1.0.0.255", 13335, ""},
+		{"2606:4700::", "2606:4700:ffff:ffff:ffff:ffff:ffff:ffff", 13335, ""},
+	} {
+		err := library.Add(r.from, r.to, r.number, r.org)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf = &bytes.Buffer{}
+	err := library.Encode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedLibrary, err := iplibraryutils.DecodeASNLibrary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedLibrary.Len() != 4 || len(decodedLibrary.ASNs()) != 2 {
+		t.Fatal("unexpected library:", decodedLibrary.Len(), len(decodedLibrary.ASNs()))
+	}
+
+	for ip, expected := range map[string]string{
+		"1.1.1.1":            "AS13335",
+		"1.0.0.1":            "AS13335",
+		"8.8.8.8":            "AS15169",
+		"8.8.9.1":            "",
+		"0.0.0.1":            "",
+		"2606:4700::1111":    "AS13335",
+		"2001:4860::8888":    "",
+		"::ffff:8.8.8.8":     "AS15169",
+		"invalid ip address": "",
+	} {
+		var asn = decodedLibrary.Lookup(ip)
+		var result = ""
+		if asn != nil {
+			result = asn.String()
+			if asn.Organization == "" {
+				t.Fatal("organization should not be empty:", ip)
+			}
+		}
+		if result != expected {
+			t.Fatal(ip, "=>", result, "expected:", expected)
+		}
+	}
+
+	iplibraryutils.SetSharedASNLibrary(decodedLibrary)
+	if iplibraryutils.LookupASN("8.8.8.8") == nil {
+		t.Fatal("shared library should work")
+	}
+	iplibraryutils.SetSharedASNLibrary(nil)
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import (
+	"bytes"
+	"errors"
+)
+
+type Format = string
+
+const (
+	FormatTemplate Format = "template" // 使用模板的文本文件
+	FormatMMDB     Format = "mmdb"     // MaxMind GeoLite2/GeoIP2 City或Country
+	FormatXDB      Format = "xdb"      // ip2region xdb
+)
+
+// FindAllFormats 所有支持的格式
+func FindAllFormats() []Format {
+	return []Format{FormatTemplate, FormatMMDB, FormatXDB}
+}
+
+// IsBinaryFormat 是否为不需要模板的二进制格式
+func IsBinaryFormat(format Format) bool {
+	return format == FormatMMDB || format == FormatXDB
+}
+
+// DetectFormat 根据文件内容检测格式
+func DetectFormat(data []byte) Format {
+	if bytes.LastIndex(data, mmdbMetadataMarker) >= 0 {
+		return FormatMMDB
+	}
+	if len(data) >= xdbSegmentIndexOffset {
+		_, _, err := decodeXDBHeader(data)
+		if err == nil {
+			return FormatXDB
+		}
+	}
+	return FormatTemplate
+}
+
+// Read 依次读取二进制IP库文件中的记录
+func Read(format Format, path string, iterator func(record *Record) error) error {
+	switch format {
+	case FormatMMDB:
+		return ReadMMDB(path, iterator)
+	case FormatXDB:
+		return ReadXDBFile(path, iterator)
+	}
+	return errors.New("unsupported format '" + format + "'")
+}
+
+// Summarize 统计二进制IP库文件中的区域和运营商名称
+func Summarize(format Format, path string) (*Summary, error) {
+	var summary = NewSummary()
+	err := Read(format, path, func(record *Record) error {
+		summary.Add(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// 名称语言优先顺序
+var mmdbLanguages = []string{"zh-CN", "en"}
+
+type mmdbNames struct {
+	Names map[string]string `maxminddb:"names"`
+}
+
+type mmdbRecord struct {
+	Country           mmdbNames   `maxminddb:"country"`
+	RegisteredCountry mmdbNames   `maxminddb:"registered_country"`
+	Subdivisions      []mmdbNames `maxminddb:"subdivisions"`
+	City              mmdbNames   `maxminddb:"city"`
+	Traits            mmdbASN     `maxminddb:"traits"`
+
+	// GeoLite2-ASN、GeoIP2-ISP
+	ASNumber       uint32 `maxminddb:"autonomous_system_number"`
+	ASOrganization string `maxminddb:"autonomous_system_organization"`
+	ISP            string `maxminddb:"isp"`
+}
+
+type mmdbASN struct {
+	ASNumber       uint32 `maxminddb:"autonomous_system_number"`
+	ASOrganization string `maxminddb:"autonomous_system_organization"`
+	ISP            string `maxminddb:"isp"`
+}
+
+// ReadMMDB 读取MaxMind GeoLite2/GeoIP2 City、Country、ASN或ISP数据库
+func ReadMMDB(path string, iterator func(record *Record) error) error {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("open mmdb failed: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var databaseType = reader.Metadata.DatabaseType
+	if !strings.Contains(databaseType, "City") &&
+		!strings.Contains(databaseType, "Country") &&
+		!strings.Contains(databaseType, "ASN") &&
+		!strings.Contains(databaseType, "ISP") {
+		return errors.New("unsupported mmdb database type '" + databaseType + "', only City, Country, ASN and ISP databases are supported")
+	}
+
+	var networks = reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var mmdbRecord = &mmdbRecord{}
+		network, err := networks.Network(mmdbRecord)
+		if err != nil {
+			return fmt.Errorf("decode mmdb record failed: %w", err)
+		}
+
+		ipFrom, ipTo := networkRange(network)
+		var record = &Record{
+			IPFrom:  ipFrom,
+			IPTo:    ipTo,
+			Country: mmdbRecord.Country.name(),
+		}
+		if len(record.Country) == 0 {
+			record.Country = mmdbRecord.RegisteredCountry.name()
+		}
+		if len(mmdbRecord.Subdivisions) > 0 {
+			record.Province = mmdbRecord.Subdivisions[0].name()
+		}
+		record.City = mmdbRecord.City.name()
+
+		// ASN
+		for _, asn := range []mmdbASN{{
+			ASNumber:       mmdbRecord.ASNumber,
+			ASOrganization: mmdbRecord.ASOrganization,
+			ISP:            mmdbRecord.ISP,
+		}, mmdbRecord.Traits} {
+			if asn.ASNumber > 0 {
+				record.ASN = asn.ASNumber
+				record.Organization = asn.ASOrganization
+				if len(asn.ISP) > 0 {
+					record.Provider = asn.ISP
+				}
+				break
+			}
+		}
+
+		err = iterator(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return networks.Err()
+}
+
+func (this mmdbNames) name() string {
+	for _, lang := range mmdbLanguages {
+		var name = this.Names[lang]
+		if len(name) > 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// 计算网段的开始和结束IP
+func networkRange(network *net.IPNet) (ipFrom string, ipTo string) {
+	var ip = network.IP
+	if ip4 := ip.To4(); ip4 != nil && len(network.Mask) == net.IPv4len {
+		ip = ip4
+	}
+	var lastIP = make(net.IP, len(ip))
+	for i := range ip {
+		var maskByte byte = 0xFF
+		if i < len(network.Mask) {
+			maskByte = network.Mask[i]
+		}
+		lastIP[i] = ip[i] | ^maskByte
+	}
+	return ip.String(), lastIP.String()
+}
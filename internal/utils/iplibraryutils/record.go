@@ -0,0 +1,119 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import "strings"
+
+// Record 从IP库中读取的一条记录
+type Record struct {
+	IPFrom   string
+	IPTo     string
+	Country  string
+	Province string
+	City     string
+	Town     string
+	Provider string
+
+	ASN          uint32 // AS号码
+	Organization string // AS所属组织
+}
+
+// Summary 统计IP库中出现的区域和运营商名称
+// 结果用于创建IP库文件，以便在生成之前检查缺失的区域
+type Summary struct {
+	countries []string
+	provinces [][2]string
+	cities    [][3]string
+	towns     [][4]string
+	providers []string
+	asns      []*ASN
+
+	keyMap map[string]bool // key => bool
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		countries: []string{},
+		provinces: [][2]string{},
+		cities:    [][3]string{},
+		towns:     [][4]string{},
+		providers: []string{},
+		asns:      []*ASN{},
+		keyMap:    map[string]bool{},
+	}
+}
+
+// Add 添加记录
+func (this *Summary) Add(record *Record) {
+	if len(record.Country) > 0 {
+		if this.addKey("country", record.Country) {
+			this.countries = append(this.countries, record.Country)
+		}
+
+		if len(record.Province) > 0 {
+			if this.addKey("province", record.Country, record.Province) {
+				this.provinces = append(this.provinces, [2]string{record.Country, record.Province})
+			}
+
+			if len(record.City) > 0 {
+				if this.addKey("city", record.Country, record.Province, record.City) {
+					this.cities = append(this.cities, [3]string{record.Country, record.Province, record.City})
+				}
+
+				if len(record.Town) > 0 {
+					if this.addKey("town", record.Country, record.Province, record.City, record.Town) {
+						this.towns = append(this.towns, [4]string{record.Country, record.Province, record.City, record.Town})
+					}
+				}
+			}
+		}
+	}
+
+	if len(record.Provider) > 0 {
+		if this.addKey("provider", record.Provider) {
+			this.providers = append(this.providers, record.Provider)
+		}
+	}
+
+	if record.ASN > 0 {
+		if this.addKey("asn", FormatASN(record.ASN)) {
+			this.asns = append(this.asns, &ASN{
+				Number:       record.ASN,
+				Organization: record.Organization,
+			})
+		}
+	}
+}
+
+func (this *Summary) Countries() []string {
+	return this.countries
+}
+
+func (this *Summary) Provinces() [][2]string {
+	return this.provinces
+}
+
+func (this *Summary) Cities() [][3]string {
+	return this.cities
+}
+
+func (this *Summary) Towns() [][4]string {
+	return this.towns
+}
+
+func (this *Summary) Providers() []string {
+	return this.providers
+}
+
+func (this *Summary) ASNs() []*ASN {
+	return this.asns
+}
+
+func (this *Summary) addKey(pieces ...string) bool {
+	var key = strings.Join(pieces, "\x00")
+	if this.keyMap[key] {
+		return false
+	}
+	this.keyMap[key] = true
+	return true
+}
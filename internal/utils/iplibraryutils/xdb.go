@@ -0,0 +1,109 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// ip2region xdb文件结构：
+// | header(256) | vector index(256*256*8) | region data | segment index |
+// 每个segment index为14字节：startIP(4) + endIP(4) + dataLen(2) + dataPtr(4)，均为小端序
+const (
+	xdbHeaderSize         = 256
+	xdbVectorIndexSize    = 256 * 256 * 8
+	xdbSegmentIndexOffset = xdbHeaderSize + xdbVectorIndexSize
+	xdbSegmentIndexSize   = 14
+)
+
+// ReadXDBFile 读取ip2region xdb文件
+func ReadXDBFile(path string, iterator func(record *Record) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ReadXDB(data, iterator)
+}
+
+// ReadXDB 读取ip2region xdb数据
+// 区域信息格式为"国家|区域|省份|城市|ISP"或者"国家|省份|城市|ISP"，其中"0"表示空值
+func ReadXDB(data []byte, iterator func(record *Record) error) error {
+	startPtr, endPtr, err := decodeXDBHeader(data)
+	if err != nil {
+		return err
+	}
+
+	var ipFrom = make(net.IP, net.IPv4len)
+	var ipTo = make(net.IP, net.IPv4len)
+	for ptr := startPtr; ptr <= endPtr; ptr += xdbSegmentIndexSize {
+		var segment = data[ptr : ptr+xdbSegmentIndexSize]
+		binary.BigEndian.PutUint32(ipFrom, binary.LittleEndian.Uint32(segment[0:4]))
+		binary.BigEndian.PutUint32(ipTo, binary.LittleEndian.Uint32(segment[4:8]))
+		var dataLen = int(binary.LittleEndian.Uint16(segment[8:10]))
+		var dataPtr = int(binary.LittleEndian.Uint32(segment[10:14]))
+		if dataPtr+dataLen > len(data) {
+			return errors.New("invalid xdb file: region data out of range")
+		}
+
+		var record = parseXDBRegion(string(data[dataPtr : dataPtr+dataLen]))
+		record.IPFrom = ipFrom.String()
+		record.IPTo = ipTo.String()
+		err = iterator(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 解析文件头，返回segment index的开始和结束位置
+func decodeXDBHeader(data []byte) (startPtr int, endPtr int, err error) {
+	if len(data) < xdbSegmentIndexOffset {
+		return 0, 0, errors.New("invalid xdb file: file too small")
+	}
+
+	startPtr = int(binary.LittleEndian.Uint32(data[8:12]))
+	endPtr = int(binary.LittleEndian.Uint32(data[12:16]))
+	if startPtr < xdbSegmentIndexOffset ||
+		endPtr < startPtr ||
+		endPtr+xdbSegmentIndexSize > len(data) ||
+		(endPtr-startPtr)%xdbSegmentIndexSize != 0 {
+		return 0, 0, errors.New("invalid xdb file: bad segment index pointers, only IPv4 xdb files are supported")
+	}
+	return startPtr, endPtr, nil
+}
+
+func parseXDBRegion(region string) *Record {
+	var pieces = strings.Split(region, "|")
+	for index, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if piece == "0" {
+			piece = ""
+		}
+		pieces[index] = piece
+	}
+
+	var record = &Record{}
+	switch len(pieces) {
+	case 5: // 国家|区域|省份|城市|ISP
+		record.Country = pieces[0]
+		record.Province = pieces[2]
+		record.City = pieces[3]
+		record.Provider = pieces[4]
+	case 4: // 国家|省份|城市|ISP
+		record.Country = pieces[0]
+		record.Province = pieces[1]
+		record.City = pieces[2]
+		record.Provider = pieces[3]
+	default:
+		if len(pieces) > 0 {
+			record.Country = pieces[0]
+		}
+	}
+	return record
+}
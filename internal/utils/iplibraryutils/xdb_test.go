@@ -0,0 +1,108 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package iplibraryutils
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func buildTestXDB(segments [][3]any) []byte {
+	var data = make([]byte, xdbSegmentIndexOffset)
+
+	// region data
+	var pointers = []int{}
+	for _, segment := range segments {
+		pointers = append(pointers, len(data))
+		data = append(data, []byte(segment[2].(string))...)
+	}
+
+	// segment index
+	var startPtr = len(data)
+	for index, segment := range segments {
+		var buf = make([]byte, xdbSegmentIndexSize)
+		binary.LittleEndian.PutUint32(buf[0:4], binary.BigEndian.Uint32(net.ParseIP(segment[0].(string)).To4()))
+		binary.LittleEndian.PutUint32(buf[4:8], binary.BigEndian.Uint32(net.ParseIP(segment[1].(string)).To4()))
+		binary.LittleEndian.PutUint16(buf[8:10], uint16(len(segment[2].(string))))
+		binary.LittleEndian.PutUint32(buf[10:14], uint32(pointers[index]))
+		data = append(data, buf...)
+	}
+	var endPtr = len(data) - xdbSegmentIndexSize
+
+	binary.LittleEndian.PutUint16(data[0:2], 2)
+	binary.LittleEndian.PutUint32(data[8:12], uint32(startPtr))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(endPtr))
+	return data
+}
+
+func TestReadXDB(t *testing.T) {
+	var data = buildTestXDB([][3]any{
+		{"0.0.0.0", "1.0.0.255", "0|0|0|内网IP|内网IP"},
+		{"1.0.1.0", "1.0.3.255", "中国|0|福建省|福州市|电信"},
+		{"1.0.4.0", "1.0.7.255", "澳大利亚|0|维多利亚|墨尔本|0"},
+		{"1.0.8.0", "1.0.15.255", "中国|广东省|广州市|电信"},
+	})
+
+	if DetectFormat(data) != FormatXDB {
+		t.Fatal("should detect xdb format")
+	}
+
+	var records = []*Record{}
+	var summary = NewSummary()
+	err := ReadXDB(data, func(record *Record) error {
+		records = append(records, record)
+		summary.Add(record)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatal("expect 4 records, but got", len(records))
+	}
+
+	var record = records[1]
+	if record.IPFrom != "1.0.1.0" || record.IPTo != "1.0.3.255" || record.Country != "中国" || record.Province != "福建省" || record.City != "福州市" || record.Provider != "电信" {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if records[2].Provider != "" {
+		t.Fatalf("'0' should be treated as empty: %+v", records[2])
+	}
+	if records[3].Province != "广东省" || records[3].City != "广州市" {
+		t.Fatalf("unexpected 4 pieces record: %+v", records[3])
+	}
+
+	if len(summary.Countries()) != 2 || len(summary.Provinces()) != 3 || len(summary.Cities()) != 3 || len(summary.Providers()) != 2 {
+		t.Fatal("unexpected summary:", summary.Countries(), summary.Provinces(), summary.Cities(), summary.Providers())
+	}
+}
+
+func TestReadXDB_Invalid(t *testing.T) {
+	err := ReadXDB([]byte("hello"), func(record *Record) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if DetectFormat([]byte("hello")) != FormatTemplate {
+		t.Fatal("should be template format")
+	}
+}
+
+func TestNetworkRange(t *testing.T) {
+	for _, cidr := range [][3]string{
+		{"192.168.1.0/24", "192.168.1.0", "192.168.1.255"},
+		{"10.0.0.0/8", "10.0.0.0", "10.255.255.255"},
+		{"2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+	} {
+		_, network, err := net.ParseCIDR(cidr[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipFrom, ipTo := networkRange(network)
+		if ipFrom != cidr[1] || ipTo != cidr[2] {
+			t.Fatal(cidr[0], "=>", ipFrom, ipTo)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"errors"
+	"strings"
+)
+
+// User 目录中的用户
+type User struct {
+	DN       string
+	Username string
+	Fullname string
+	Groups   []string
+}
+
+// Open 连接服务器并使用服务账号认证
+func Open(config *Config) (*Conn, error) {
+	if !config.IsOn {
+		return nil, errors.New("ldap login is not enabled")
+	}
+
+	conn, err := Dial(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.BindDN) > 0 {
+		err = conn.Bind(config.BindDN, config.BindPassword)
+		if err != nil {
+			_ = conn.Close()
+			if errors.Is(err, ErrInvalidCredentials) {
+				return nil, errors.New("bind with service account failed: invalid credentials")
+			}
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// FindUser 查找用户，找不到时返回 ErrUserNotFound
+func (this *Conn) FindUser(config *Config, username string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if len(username) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	var filter = strings.ReplaceAll(config.UserFilter, UsernamePlaceholder, EscapeFilter(username))
+	entries, err := this.Search(config.BaseDN, filter, []string{config.FullnameAttribute, config.GroupAttribute}, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+	if len(entries) > 1 {
+		return nil, errors.New("found multiple entries for user '" + username + "', please check 'userFilter'")
+	}
+
+	var entry = entries[0]
+	return &User{
+		DN:       entry.DN,
+		Username: username,
+		Fullname: entry.GetAttribute(config.FullnameAttribute),
+		Groups:   entry.GetAttributes(config.GroupAttribute),
+	}, nil
+}
+
+// Authenticate 校验用户名和密码
+func Authenticate(config *Config, username string, password string) (*User, error) {
+	if len(password) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := Open(config)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	user, err := conn.FindUser(config, username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(user.DN, password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
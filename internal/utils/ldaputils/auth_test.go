@@ -0,0 +1,210 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/iwind/TeaGo/assert"
+)
+
+type mockUser struct {
+	dn       string
+	password string
+	fullname string
+	groups   []string
+}
+
+// 本地模拟的目录服务器，只支持简单的相等过滤器
+type mockServer struct {
+	listener net.Listener
+	users    map[string]*mockUser // username => user
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server = &mockServer{
+		listener: listener,
+		users: map[string]*mockUser{
+			"svc": {
+				dn:       "CN=svc,OU=Service,DC=example,DC=com",
+				password: "svc-secret",
+			},
+			"alice": {
+				dn:       "CN=Alice,OU=Users,DC=example,DC=com",
+				password: "alice-secret",
+				fullname: "Alice Liu",
+				groups:   []string{"CN=Ops,OU=Groups,DC=example,DC=com", "CN=Finance,OU=Groups,DC=example,DC=com"},
+			},
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(conn)
+		}
+	}()
+	return server
+}
+
+func (this *mockServer) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var write = func(messageId int64, op *packet) {
+		_, _ = conn.Write(newSequence(newInteger(messageId), op).Bytes())
+	}
+	var result = func(tag byte, code int64) *packet {
+		return newPacket(classApplication, true, tag, newEnumerated(code), newString(""), newString(""))
+	}
+
+	for {
+		message, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		var messageId = message.Child(0).Int()
+		var op = message.Child(1)
+		switch {
+		case op.Is(classApplication, opBindRequest):
+			var code int64 = resultInvalidCredentials
+			for _, user := range this.users {
+				if user.dn == op.Child(1).String() && user.password == op.Child(2).String() {
+					code = resultSuccess
+				}
+			}
+			write(messageId, result(opBindResponse, code))
+		case op.Is(classApplication, opSearchRequest):
+			var filter = op.Child(6)
+			if filter.Is(classContext, filterEqualityMatch) && filter.Child(0).String() == "sAMAccountName" {
+				user, ok := this.users[filter.Child(1).String()]
+				if ok {
+					write(messageId, newPacket(classApplication, true, opSearchEntry,
+						newString(user.dn),
+						newSequence(
+							newSequence(newString("displayName"), newSet(newString(user.fullname))),
+							newSequence(newString("memberOf"), newSet(func() []*packet {
+								var result = []*packet{}
+								for _, group := range user.groups {
+									result = append(result, newString(group))
+								}
+								return result
+							}()...)),
+						),
+					))
+				}
+			}
+			write(messageId, result(opSearchDone, resultSuccess))
+		case op.Is(classApplication, opUnbindRequest):
+			return
+		}
+	}
+}
+
+func (this *mockServer) config() *Config {
+	var config = DefaultConfig()
+	config.IsOn = true
+	config.URL = "ldap://" + this.listener.Addr().String()
+	config.BindDN = "CN=svc,OU=Service,DC=example,DC=com"
+	config.BindPassword = "svc-secret"
+	config.BaseDN = "DC=example,DC=com"
+	config.GroupMappings = []*GroupMapping{
+		{Group: "Ops", Modules: []string{"servers", "clusters"}},
+		{Group: "CN=Finance,OU=Groups,DC=example,DC=com", Modules: []string{"finance", "servers"}},
+		{Group: "Admins", IsSuper: true},
+	}
+	return config
+}
+
+func TestAuthenticate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = newMockServer(t)
+	defer func() {
+		_ = server.listener.Close()
+	}()
+
+	var config = server.config()
+	a.IsNil(config.Init())
+
+	user, err := Authenticate(config, "alice", "alice-secret")
+	a.IsNil(err)
+	if user != nil {
+		a.IsTrue(user.DN == "CN=Alice,OU=Users,DC=example,DC=com")
+		a.IsTrue(user.Fullname == "Alice Liu")
+		a.IsTrue(len(user.Groups) == 2)
+
+		modules, isSuper, matched := config.MatchGroups(user.Groups)
+		a.IsTrue(matched)
+		a.IsFalse(isSuper)
+		a.IsTrue(strings.Join(modules, ",") == "servers,clusters,finance")
+	}
+
+	_, err = Authenticate(config, "alice", "wrong")
+	a.IsTrue(errors.Is(err, ErrInvalidCredentials))
+
+	_, err = Authenticate(config, "alice", "")
+	a.IsTrue(errors.Is(err, ErrInvalidCredentials))
+
+	_, err = Authenticate(config, "bob", "bob-secret")
+	a.IsTrue(errors.Is(err, ErrUserNotFound))
+
+	// 注入的过滤器会被转义
+	_, err = Authenticate(config, "*", "alice-secret")
+	a.IsTrue(errors.Is(err, ErrUserNotFound))
+
+	// 服务账号密码错误
+	config.BindPassword = "wrong"
+	_, err = Authenticate(config, "alice", "alice-secret")
+	a.IsNotNil(err)
+	a.IsFalse(errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = DefaultConfig()
+	a.IsNil(config.Init())
+
+	config.IsOn = true
+	a.IsNotNil(config.Init())
+
+	config.URL = "http://dc.example.com"
+	config.BaseDN = "DC=example,DC=com"
+	a.IsNotNil(config.Init())
+
+	config.URL = "ldaps://dc.example.com"
+	a.IsNil(config.Init())
+	a.IsTrue(config.host == "dc.example.com:636")
+
+	config.StartTLS = true
+	a.IsNotNil(config.Init())
+
+	config.URL = "ldap://dc.example.com"
+	a.IsNil(config.Init())
+	a.IsTrue(config.host == "dc.example.com:389")
+
+	config.CACert = "invalid"
+	a.IsNotNil(config.Init())
+	config.CACert = ""
+
+	config.UserFilter = "(uid=alice)"
+	a.IsNotNil(config.Init())
+}
+
+func TestParseCN(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(ParseCN("CN=Ops,OU=Groups,DC=example,DC=com") == "Ops")
+	a.IsTrue(ParseCN(`CN=Ops\, Team,OU=Groups`) == "Ops, Team")
+	a.IsTrue(ParseCN("Ops") == "")
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"errors"
+	"io"
+)
+
+// 这里只实现了LDAP协议需要用到的BER编码子集
+
+const (
+	classUniversal   byte = 0x00
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+
+	flagConstructed byte = 0x20
+)
+
+const (
+	tagBoolean     byte = 1
+	tagInteger     byte = 2
+	tagOctetString byte = 4
+	tagEnumerated  byte = 10
+	tagSequence    byte = 16
+	tagSet         byte = 17
+)
+
+const maxPacketSize = 16 << 20
+
+var errInvalidPacket = errors.New("invalid ber packet")
+
+type packet struct {
+	Class       byte
+	Constructed bool
+	Tag         byte
+	Value       []byte    // 简单类型的值
+	Children    []*packet // 复合类型的子元素
+}
+
+func newPacket(class byte, constructed bool, tag byte, children ...*packet) *packet {
+	return &packet{
+		Class:       class,
+		Constructed: constructed,
+		Tag:         tag,
+		Children:    children,
+	}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newPacket(classUniversal, true, tagSequence, children...)
+}
+
+func newSet(children ...*packet) *packet {
+	return newPacket(classUniversal, true, tagSet, children...)
+}
+
+func newString(s string) *packet {
+	return &packet{Class: classUniversal, Tag: tagOctetString, Value: []byte(s)}
+}
+
+func newInteger(v int64) *packet {
+	return &packet{Class: classUniversal, Tag: tagInteger, Value: encodeInteger(v)}
+}
+
+func newEnumerated(v int64) *packet {
+	return &packet{Class: classUniversal, Tag: tagEnumerated, Value: encodeInteger(v)}
+}
+
+func newBoolean(b bool) *packet {
+	if b {
+		return &packet{Class: classUniversal, Tag: tagBoolean, Value: []byte{0xff}}
+	}
+	return &packet{Class: classUniversal, Tag: tagBoolean, Value: []byte{0x00}}
+}
+
+func newContextString(tag byte, s string) *packet {
+	return &packet{Class: classContext, Tag: tag, Value: []byte(s)}
+}
+
+// Is 检查类型
+func (this *packet) Is(class byte, tag byte) bool {
+	return this.Class == class && this.Tag == tag
+}
+
+// String 读取字符串值
+func (this *packet) String() string {
+	return string(this.Value)
+}
+
+// Int 读取整数值
+func (this *packet) Int() int64 {
+	return decodeInteger(this.Value)
+}
+
+// Child 读取子元素
+func (this *packet) Child(index int) *packet {
+	if index < 0 || index >= len(this.Children) {
+		return &packet{}
+	}
+	return this.Children[index]
+}
+
+// Bytes 编码
+func (this *packet) Bytes() []byte {
+	var content = this.Value
+	if this.Constructed {
+		content = nil
+		for _, child := range this.Children {
+			content = append(content, child.Bytes()...)
+		}
+	}
+
+	var tag = this.Class | (this.Tag & 0x1f)
+	if this.Constructed {
+		tag |= flagConstructed
+	}
+	var result = []byte{tag}
+	result = append(result, encodeLength(len(content))...)
+	return append(result, content...)
+}
+
+// 解析单个元素，返回元素和使用的字节数
+func decodePacket(data []byte) (*packet, int, error) {
+	if len(data) < 2 {
+		return nil, 0, errInvalidPacket
+	}
+	var p = &packet{
+		Class:       data[0] & 0xc0,
+		Constructed: data[0]&flagConstructed != 0,
+		Tag:         data[0] & 0x1f,
+	}
+	if p.Tag == 0x1f {
+		// 不支持多字节的tag
+		return nil, 0, errInvalidPacket
+	}
+
+	length, lengthSize, err := decodeLength(data[1:])
+	if err != nil {
+		return nil, 0, err
+	}
+	var offset = 1 + lengthSize
+	if length > len(data)-offset {
+		return nil, 0, errInvalidPacket
+	}
+	var content = data[offset : offset+length]
+
+	if p.Constructed {
+		for len(content) > 0 {
+			child, size, err := decodePacket(content)
+			if err != nil {
+				return nil, 0, err
+			}
+			p.Children = append(p.Children, child)
+			content = content[size:]
+		}
+	} else {
+		p.Value = content
+	}
+	return p, offset + length, nil
+}
+
+// 从数据流中读取单个元素
+func readPacket(reader io.Reader) (*packet, error) {
+	var header = make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var data = header
+	if header[1]&0x80 != 0 {
+		var n = int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errInvalidPacket
+		}
+		var lengthBytes = make([]byte, n)
+		_, err = io.ReadFull(reader, lengthBytes)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, lengthBytes...)
+	}
+
+	length, _, err := decodeLength(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	if length > maxPacketSize {
+		return nil, errors.New("ber packet too large")
+	}
+
+	var content = make([]byte, length)
+	_, err = io.ReadFull(reader, content)
+	if err != nil {
+		return nil, err
+	}
+
+	p, _, err := decodePacket(append(data, content...))
+	return p, err
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var result = []byte{}
+	for length > 0 {
+		result = append([]byte{byte(length)}, result...)
+		length >>= 8
+	}
+	return append([]byte{0x80 | byte(len(result))}, result...)
+}
+
+func decodeLength(data []byte) (length int, size int, err error) {
+	if len(data) == 0 {
+		return 0, 0, errInvalidPacket
+	}
+	if data[0]&0x80 == 0 {
+		return int(data[0]), 1, nil
+	}
+	var n = int(data[0] & 0x7f)
+	if n == 0 || n > 4 || len(data) < n+1 {
+		// 不支持不定长编码
+		return 0, 0, errInvalidPacket
+	}
+	for i := 1; i <= n; i++ {
+		length = length<<8 | int(data[i])
+	}
+	return length, n + 1, nil
+}
+
+func encodeInteger(v int64) []byte {
+	var result = []byte{}
+	for {
+		result = append([]byte{byte(v)}, result...)
+		v >>= 8
+		if (v == 0 && result[0]&0x80 == 0) || (v == -1 && result[0]&0x80 != 0) {
+			break
+		}
+	}
+	return result
+}
+
+func decodeInteger(data []byte) int64 {
+	if len(data) == 0 || len(data) > 8 {
+		return 0
+	}
+	var v int64
+	if data[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, b := range data {
+		v = v<<8 | int64(b)
+	}
+	return v
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/iwind/TeaGo/lists"
+)
+
+const (
+	DefaultTimeoutSeconds      = 10
+	DefaultSyncIntervalSeconds = 3600
+	DefaultUserFilter          = "(sAMAccountName={username})"
+	DefaultFullnameAttribute   = "displayName"
+	DefaultGroupAttribute      = "memberOf"
+
+	UsernamePlaceholder = "{username}"
+)
+
+// GroupMapping LDAP分组和管理员模块的对应关系
+type GroupMapping struct {
+	Group   string   `yaml:"group" json:"group"`     // 分组DN或CN
+	Modules []string `yaml:"modules" json:"modules"` // 可以访问的模块代号
+	IsSuper bool     `yaml:"isSuper" json:"isSuper"` // 是否为超级管理员
+}
+
+// Config LDAP登录设置
+type Config struct {
+	IsOn                 bool            `yaml:"isOn" json:"isOn"`                                 // 是否启用
+	URL                  string          `yaml:"url" json:"url"`                                   // 服务器地址，比如 ldap://dc.example.com:389 或 ldaps://dc.example.com:636
+	StartTLS             bool            `yaml:"startTLS" json:"startTLS"`                         // 是否使用StartTLS
+	CACert               string          `yaml:"caCert" json:"caCert"`                             // CA证书（PEM格式），为空时使用系统证书
+	InsecureSkipVerify   bool            `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`     // 是否跳过证书校验
+	BindDN               string          `yaml:"bindDN" json:"bindDN"`                             // 用来查询用户的服务账号DN，为空时使用匿名查询
+	BindPassword         string          `yaml:"bindPassword" json:"bindPassword"`                 // 服务账号密码
+	BaseDN               string          `yaml:"baseDN" json:"baseDN"`                             // 查询用户的起始DN
+	UserFilter           string          `yaml:"userFilter" json:"userFilter"`                     // 查询用户的过滤器，其中 {username} 会被替换为用户名
+	FullnameAttribute    string          `yaml:"fullnameAttribute" json:"fullnameAttribute"`       // 全名属性
+	GroupAttribute       string          `yaml:"groupAttribute" json:"groupAttribute"`             // 分组属性
+	GroupMappings        []*GroupMapping `yaml:"groupMappings" json:"groupMappings"`               // 分组对应关系
+	RequireGroup         bool            `yaml:"requireGroup" json:"requireGroup"`                 // 是否只允许匹配到分组的用户登录
+	OverwritePermissions bool            `yaml:"overwritePermissions" json:"overwritePermissions"` // 是否使用分组对应关系覆盖管理员已有的模块和超级管理员权限，不开启时只增加权限
+	AutoCreate           bool            `yaml:"autoCreate" json:"autoCreate"`                     // 首次登录时是否自动创建管理员
+	SyncIntervalSeconds  int             `yaml:"syncIntervalSeconds" json:"syncIntervalSeconds"`   // 同步目录状态的间隔
+	TimeoutSeconds       int             `yaml:"timeoutSeconds" json:"timeoutSeconds"`             // 超时时间
+
+	host      string
+	useTLS    bool
+	tlsConfig *tls.Config
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		UserFilter:          DefaultUserFilter,
+		FullnameAttribute:   DefaultFullnameAttribute,
+		GroupAttribute:      DefaultGroupAttribute,
+		RequireGroup:        true,
+		SyncIntervalSeconds: DefaultSyncIntervalSeconds,
+		TimeoutSeconds:      DefaultTimeoutSeconds,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	this.URL = strings.TrimSpace(this.URL)
+	this.BaseDN = strings.TrimSpace(this.BaseDN)
+	this.UserFilter = strings.TrimSpace(this.UserFilter)
+
+	if len(this.UserFilter) == 0 {
+		this.UserFilter = DefaultUserFilter
+	}
+	if len(this.FullnameAttribute) == 0 {
+		this.FullnameAttribute = DefaultFullnameAttribute
+	}
+	if len(this.GroupAttribute) == 0 {
+		this.GroupAttribute = DefaultGroupAttribute
+	}
+	if this.SyncIntervalSeconds <= 0 {
+		this.SyncIntervalSeconds = DefaultSyncIntervalSeconds
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+
+	var mappings = []*GroupMapping{}
+	for _, mapping := range this.GroupMappings {
+		if mapping == nil {
+			continue
+		}
+		mapping.Group = strings.TrimSpace(mapping.Group)
+		if len(mapping.Group) == 0 {
+			continue
+		}
+		mappings = append(mappings, mapping)
+	}
+	this.GroupMappings = mappings
+
+	if !this.IsOn {
+		return nil
+	}
+
+	if len(this.URL) == 0 {
+		return errors.New("'url' should not be empty")
+	}
+	u, err := url.Parse(this.URL)
+	if err != nil {
+		return fmt.Errorf("invalid 'url': %w", err)
+	}
+	var defaultPort string
+	switch u.Scheme {
+	case "ldap":
+		defaultPort = "389"
+		this.useTLS = false
+	case "ldaps":
+		defaultPort = "636"
+		this.useTLS = true
+		if this.StartTLS {
+			return errors.New("'startTLS' can not be used with 'ldaps://'")
+		}
+	default:
+		return errors.New("invalid 'url': scheme should be 'ldap' or 'ldaps'")
+	}
+	if len(u.Hostname()) == 0 {
+		return errors.New("invalid 'url': host should not be empty")
+	}
+	var port = u.Port()
+	if len(port) == 0 {
+		port = defaultPort
+	}
+	this.host = net.JoinHostPort(u.Hostname(), port)
+
+	if len(this.BaseDN) == 0 {
+		return errors.New("'baseDN' should not be empty")
+	}
+	if !strings.Contains(this.UserFilter, UsernamePlaceholder) {
+		return errors.New("'userFilter' should contain '" + UsernamePlaceholder + "'")
+	}
+	_, err = compileFilter(strings.ReplaceAll(this.UserFilter, UsernamePlaceholder, "test"))
+	if err != nil {
+		return fmt.Errorf("invalid 'userFilter': %w", err)
+	}
+	if len(this.BindDN) > 0 && len(this.BindPassword) == 0 {
+		return errors.New("'bindPassword' should not be empty")
+	}
+
+	this.tlsConfig = &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: this.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if len(strings.TrimSpace(this.CACert)) > 0 {
+		var pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(this.CACert)) {
+			return errors.New("invalid 'caCert': no valid certificates found")
+		}
+		this.tlsConfig.RootCAs = pool
+	}
+
+	return nil
+}
+
+// MatchGroups 根据用户所属分组计算可以访问的模块
+func (this *Config) MatchGroups(groups []string) (modules []string, isSuper bool, matched bool) {
+	modules = []string{}
+	for _, mapping := range this.GroupMappings {
+		if !matchGroup(mapping.Group, groups) {
+			continue
+		}
+		matched = true
+		if mapping.IsSuper {
+			isSuper = true
+		}
+		for _, module := range mapping.Modules {
+			if len(module) > 0 && !lists.ContainsString(modules, module) {
+				modules = append(modules, module)
+			}
+		}
+	}
+	return
+}
+
+// 检查分组是否匹配，分组可以是完整的DN，也可以只是CN
+func matchGroup(group string, groups []string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(group, g) || strings.EqualFold(group, ParseCN(g)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCN 从DN中读取第一个RDN的值，比如 CN=Ops,OU=Groups,DC=example,DC=com 中的 Ops
+func ParseCN(dn string) string {
+	var first = dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+			continue
+		}
+		if dn[i] == ',' {
+			first = dn[:i]
+			break
+		}
+	}
+	var index = strings.IndexByte(first, '=')
+	if index < 0 {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(first[index+1:], "\\", ""))
+}
@@ -0,0 +1,298 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 协议操作（RFC 4511）
+const (
+	opBindRequest            byte = 0
+	opBindResponse           byte = 1
+	opUnbindRequest          byte = 2
+	opSearchRequest          byte = 3
+	opSearchEntry            byte = 4
+	opSearchDone             byte = 5
+	opSearchReference        byte = 19
+	opExtendedRequest        byte = 23
+	opExtendedResponse       byte = 24
+	startTLSOID                   = "1.3.6.1.4.1.1466.20037"
+	ldapVersion                   = 3
+	scopeWholeSubtree             = 2
+	derefAlways                   = 3
+	resultSuccess                 = 0
+	resultSizeLimit               = 4
+	resultInvalidCredentials      = 49
+	resultNoSuchObject            = 32
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrEmptyPassword      = errors.New("password should not be empty")
+)
+
+// ResultError 服务器返回的错误
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (this *ResultError) Error() string {
+	if len(this.Message) > 0 {
+		return fmt.Sprintf("ldap result code %d: %s", this.Code, this.Message)
+	}
+	return fmt.Sprintf("ldap result code %d", this.Code)
+}
+
+// Entry 查询到的条目
+type Entry struct {
+	DN         string
+	Attributes map[string][]string // 属性名均为小写
+}
+
+// GetAttribute 读取某个属性的第一个值
+func (this *Entry) GetAttribute(name string) string {
+	var values = this.Attributes[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// GetAttributes 读取某个属性的所有值
+func (this *Entry) GetAttributes(name string) []string {
+	return this.Attributes[strings.ToLower(name)]
+}
+
+// Conn LDAP连接
+type Conn struct {
+	rawConn   net.Conn
+	timeout   time.Duration
+	messageId int64
+}
+
+// Dial 连接服务器，如果设置了StartTLS则在连接后立即升级为TLS连接
+func Dial(config *Config) (*Conn, error) {
+	if len(config.host) == 0 {
+		return nil, errors.New("config should be initialized before dial")
+	}
+
+	var timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	var dialer = &net.Dialer{Timeout: timeout}
+
+	var rawConn net.Conn
+	var err error
+	if config.useTLS {
+		rawConn, err = tls.DialWithDialer(dialer, "tcp", config.host, config.tlsConfig.Clone())
+	} else {
+		rawConn, err = dialer.Dial("tcp", config.host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var conn = &Conn{
+		rawConn: rawConn,
+		timeout: timeout,
+	}
+
+	if config.StartTLS && !config.useTLS {
+		err = conn.startTLS(config.tlsConfig.Clone())
+		if err != nil {
+			_ = rawConn.Close()
+			return nil, fmt.Errorf("start tls failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// Bind 使用DN和密码认证
+// 为了防止未认证绑定（RFC 4513 5.1.2）被当作登录成功，这里不允许空密码
+func (this *Conn) Bind(dn string, password string) error {
+	if len(password) == 0 {
+		return ErrEmptyPassword
+	}
+
+	response, err := this.call(newPacket(classApplication, true, opBindRequest,
+		newInteger(ldapVersion),
+		newString(dn),
+		newContextString(0, password),
+	), opBindResponse)
+	if err != nil {
+		return err
+	}
+
+	err = parseResult(response)
+	if err != nil {
+		var resultErr *ResultError
+		if errors.As(err, &resultErr) && resultErr.Code == resultInvalidCredentials {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// Search 在子树中查询条目
+func (this *Conn) Search(baseDN string, filter string, attributes []string, sizeLimit int) ([]*Entry, error) {
+	filterPacket, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributesPacket = newSequence()
+	for _, attr := range attributes {
+		attributesPacket.Children = append(attributesPacket.Children, newString(attr))
+	}
+
+	messageId, err := this.send(newPacket(classApplication, true, opSearchRequest,
+		newString(baseDN),
+		newEnumerated(scopeWholeSubtree),
+		newEnumerated(derefAlways),
+		newInteger(int64(sizeLimit)),
+		newInteger(int64(this.timeout/time.Second)),
+		newBoolean(false),
+		filterPacket,
+		attributesPacket,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries = []*Entry{}
+	for {
+		id, op, err := this.receive()
+		if err != nil {
+			return nil, err
+		}
+		if id != messageId {
+			continue
+		}
+
+		switch {
+		case op.Is(classApplication, opSearchEntry):
+			entries = append(entries, parseEntry(op))
+		case op.Is(classApplication, opSearchReference):
+			// 不跟随引用
+		case op.Is(classApplication, opSearchDone):
+			err = parseResult(op)
+			if err != nil {
+				var resultErr *ResultError
+				if errors.As(err, &resultErr) {
+					switch resultErr.Code {
+					case resultNoSuchObject:
+						return entries, nil
+					case resultSizeLimit:
+						if len(entries) > 0 {
+							return entries, nil
+						}
+					}
+				}
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errors.New("unexpected search response")
+		}
+	}
+}
+
+// Close 断开连接
+func (this *Conn) Close() error {
+	_, _ = this.send(&packet{Class: classApplication, Tag: opUnbindRequest})
+	return this.rawConn.Close()
+}
+
+func (this *Conn) startTLS(tlsConfig *tls.Config) error {
+	response, err := this.call(newPacket(classApplication, true, opExtendedRequest,
+		newContextString(0, startTLSOID),
+	), opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	err = parseResult(response)
+	if err != nil {
+		return err
+	}
+
+	var tlsConn = tls.Client(this.rawConn, tlsConfig)
+	_ = tlsConn.SetDeadline(time.Now().Add(this.timeout))
+	err = tlsConn.Handshake()
+	if err != nil {
+		return err
+	}
+	this.rawConn = tlsConn
+	return nil
+}
+
+// 发送请求并等待单个响应
+func (this *Conn) call(op *packet, responseOp byte) (*packet, error) {
+	messageId, err := this.send(op)
+	if err != nil {
+		return nil, err
+	}
+	id, response, err := this.receive()
+	if err != nil {
+		return nil, err
+	}
+	if id != messageId || !response.Is(classApplication, responseOp) {
+		return nil, errors.New("unexpected response")
+	}
+	return response, nil
+}
+
+func (this *Conn) send(op *packet) (messageId int64, err error) {
+	this.messageId++
+	messageId = this.messageId
+	_ = this.rawConn.SetWriteDeadline(time.Now().Add(this.timeout))
+	_, err = this.rawConn.Write(newSequence(newInteger(messageId), op).Bytes())
+	return
+}
+
+func (this *Conn) receive() (messageId int64, op *packet, err error) {
+	_ = this.rawConn.SetReadDeadline(time.Now().Add(this.timeout))
+	message, err := readPacket(this.rawConn)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !message.Is(classUniversal, tagSequence) || len(message.Children) < 2 {
+		return 0, nil, errInvalidPacket
+	}
+	return message.Child(0).Int(), message.Child(1), nil
+}
+
+func parseResult(op *packet) error {
+	if len(op.Children) < 3 {
+		return errInvalidPacket
+	}
+	var code = op.Child(0).Int()
+	if code == resultSuccess {
+		return nil
+	}
+	return &ResultError{
+		Code:    code,
+		Message: op.Child(2).String(),
+	}
+}
+
+func parseEntry(op *packet) *Entry {
+	var entry = &Entry{
+		DN:         op.Child(0).String(),
+		Attributes: map[string][]string{},
+	}
+	for _, attr := range op.Child(1).Children {
+		var name = strings.ToLower(attr.Child(0).String())
+		for _, value := range attr.Child(1).Children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.String())
+		}
+	}
+	return entry
+}
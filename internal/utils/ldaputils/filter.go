@@ -0,0 +1,202 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// 过滤器类型（RFC 4511）
+const (
+	filterAnd             byte = 0
+	filterOr              byte = 1
+	filterNot             byte = 2
+	filterEqualityMatch   byte = 3
+	filterSubstrings      byte = 4
+	filterGreaterOrEqual  byte = 5
+	filterLessOrEqual     byte = 6
+	filterPresent         byte = 7
+	filterApproxMatch     byte = 8
+	substringInitial      byte = 0
+	substringAny          byte = 1
+	substringFinal        byte = 2
+	maxFilterNestingDepth      = 32
+)
+
+// EscapeFilter 转义过滤器中的值（RFC 4515）
+func EscapeFilter(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		var c = value[i]
+		switch c {
+		case '\\', '*', '(', ')', 0:
+			builder.WriteString("\\" + hex.EncodeToString([]byte{c}))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// 编译过滤器字符串
+func compileFilter(filter string) (*packet, error) {
+	filter = strings.TrimSpace(filter)
+	if len(filter) == 0 {
+		return nil, errors.New("empty filter")
+	}
+	if filter[0] != '(' {
+		filter = "(" + filter + ")"
+	}
+	p, pos, err := parseFilter(filter, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(filter) {
+		return nil, errors.New("invalid filter: unexpected '" + filter[pos:] + "'")
+	}
+	return p, nil
+}
+
+func parseFilter(filter string, pos int, depth int) (*packet, int, error) {
+	if depth > maxFilterNestingDepth {
+		return nil, 0, errors.New("invalid filter: nesting too deep")
+	}
+	if pos >= len(filter) || filter[pos] != '(' {
+		return nil, 0, errors.New("invalid filter: expect '('")
+	}
+	pos++
+	if pos >= len(filter) {
+		return nil, 0, errors.New("invalid filter: unexpected end")
+	}
+
+	switch filter[pos] {
+	case '&', '|':
+		var tag = filterAnd
+		if filter[pos] == '|' {
+			tag = filterOr
+		}
+		pos++
+		var p = newPacket(classContext, true, tag)
+		for pos < len(filter) && filter[pos] != ')' {
+			child, newPos, err := parseFilter(filter, pos, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			p.Children = append(p.Children, child)
+			pos = newPos
+		}
+		if pos >= len(filter) || len(p.Children) == 0 {
+			return nil, 0, errors.New("invalid filter: unexpected end")
+		}
+		return p, pos + 1, nil
+	case '!':
+		child, newPos, err := parseFilter(filter, pos+1, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if newPos >= len(filter) || filter[newPos] != ')' {
+			return nil, 0, errors.New("invalid filter: expect ')'")
+		}
+		return newPacket(classContext, true, filterNot, child), newPos + 1, nil
+	}
+
+	var end = strings.IndexByte(filter[pos:], ')')
+	if end < 0 {
+		return nil, 0, errors.New("invalid filter: expect ')'")
+	}
+	p, err := parseFilterItem(filter[pos : pos+end])
+	if err != nil {
+		return nil, 0, err
+	}
+	return p, pos + end + 1, nil
+}
+
+func parseFilterItem(item string) (*packet, error) {
+	var index = strings.IndexByte(item, '=')
+	if index <= 0 {
+		return nil, errors.New("invalid filter item '" + item + "'")
+	}
+	var attr = item[:index]
+	var value = item[index+1:]
+
+	var tag = filterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+		attr = attr[:len(attr)-1]
+	case '<':
+		tag = filterLessOrEqual
+		attr = attr[:len(attr)-1]
+	case '~':
+		tag = filterApproxMatch
+		attr = attr[:len(attr)-1]
+	}
+	if len(attr) == 0 {
+		return nil, errors.New("invalid filter item '" + item + "'")
+	}
+
+	if tag == filterEqualityMatch {
+		if value == "*" {
+			return &packet{Class: classContext, Tag: filterPresent, Value: []byte(attr)}, nil
+		}
+		if strings.Contains(value, "*") {
+			return parseSubstrings(attr, value)
+		}
+	}
+
+	unescaped, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return newPacket(classContext, true, tag, newString(attr), newString(unescaped)), nil
+}
+
+func parseSubstrings(attr string, value string) (*packet, error) {
+	var pieces = strings.Split(value, "*")
+	var substrings = newSequence()
+	for i, piece := range pieces {
+		if len(piece) == 0 {
+			continue
+		}
+		unescaped, err := unescapeFilterValue(piece)
+		if err != nil {
+			return nil, err
+		}
+		var tag = substringAny
+		if i == 0 {
+			tag = substringInitial
+		} else if i == len(pieces)-1 {
+			tag = substringFinal
+		}
+		substrings.Children = append(substrings.Children, newContextString(tag, unescaped))
+	}
+	if len(substrings.Children) == 0 {
+		return nil, errors.New("invalid substrings filter '" + value + "'")
+	}
+	return newPacket(classContext, true, filterSubstrings, newString(attr), substrings), nil
+}
+
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var result = []byte{}
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			result = append(result, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", errors.New("invalid escape in filter value '" + value + "'")
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("invalid escape in filter value '" + value + "'")
+		}
+		result = append(result, b...)
+		i += 2
+	}
+	return string(result), nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package ldaputils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(EscapeFilter("alice") == "alice")
+	a.IsTrue(EscapeFilter("*)(uid=*") == `\2a\29\28uid=\2a`)
+	a.IsTrue(EscapeFilter(`a\b`) == `a\5cb`)
+}
+
+func TestCompileFilter(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, filter := range []string{
+		"(uid=alice)",
+		"uid=alice",
+		"(&(objectClass=person)(sAMAccountName=alice))",
+		"(|(uid=a*)(cn=*b*c)(!(mail=*)))",
+		"(uidNumber>=1000)",
+		"(cn~=alice)",
+		`(cn=a\2ab)`,
+	} {
+		p, err := compileFilter(filter)
+		a.IsNil(err)
+		if p != nil {
+			// 编码后能重新解析
+			decoded, _, err := decodePacket(p.Bytes())
+			a.IsNil(err)
+			if decoded != nil {
+				a.IsTrue(bytes.Equal(decoded.Bytes(), p.Bytes()))
+			}
+		}
+	}
+
+	for _, filter := range []string{
+		"",
+		"(uid=alice",
+		"(&)",
+		"(=alice)",
+		`(cn=a\zz)`,
+		"(uid=alice))",
+	} {
+		_, err := compileFilter(filter)
+		a.IsNotNil(err)
+	}
+
+	p, err := compileFilter("(cn=a*b*c)")
+	a.IsNil(err)
+	a.IsTrue(p.Is(classContext, filterSubstrings))
+	var substrings = p.Child(1).Children
+	a.IsTrue(len(substrings) == 3)
+	a.IsTrue(substrings[0].Tag == substringInitial && substrings[0].String() == "a")
+	a.IsTrue(substrings[1].Tag == substringAny && substrings[1].String() == "b")
+	a.IsTrue(substrings[2].Tag == substringFinal && substrings[2].String() == "c")
+
+	p, err = compileFilter(`(cn=a\2ab)`)
+	a.IsNil(err)
+	a.IsTrue(p.Is(classContext, filterEqualityMatch))
+	a.IsTrue(p.Child(1).String() == "a*b")
+}
+
+func TestInteger(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, 65535, -1, -128, -129, 1 << 40} {
+		a.IsTrue(decodeInteger(encodeInteger(v)) == v)
+	}
+	a.IsTrue(bytes.Equal(encodeInteger(128), []byte{0x00, 0x80}))
+}
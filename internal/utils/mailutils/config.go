@@ -0,0 +1,220 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+const (
+	ModeSMTP = "smtp" // 通过SMTP服务器发送
+	ModeFile = "file" // 写入本地目录，用于测试
+
+	SecurityNone     = "none"     // 不加密
+	SecuritySTARTTLS = "starttls" // 使用STARTTLS升级连接
+	SecurityTLS      = "tls"      // 直接使用TLS连接
+
+	DefaultTimeoutSeconds           = 10
+	DefaultMaxRetries               = 5
+	DefaultVerificationLifeSeconds  = 86400
+	DefaultResetPasswordLifeSeconds = 1800
+	DefaultKeepDays                 = 30
+	MinRetryDelaySeconds            = 60
+	MaxRetryDelaySeconds            = 3600
+
+	VerifyEmailPath   = "/email/verify"   // 用户平台中验证邮箱的路径
+	ResetPasswordPath = "/password/reset" // 用户平台中重置密码的路径
+)
+
+// Config 邮件发送设置
+type Config struct {
+	IsOn               bool   `yaml:"isOn" json:"isOn"`                             // 是否启用
+	Mode               string `yaml:"mode" json:"mode"`                             // 发送方式：smtp|file
+	Host               string `yaml:"host" json:"host"`                             // SMTP服务器地址
+	Port               int    `yaml:"port" json:"port"`                             // SMTP服务器端口，为0时根据加密方式自动选择
+	Security           string `yaml:"security" json:"security"`                     // 加密方式：none|starttls|tls
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify"` // 是否跳过证书校验
+	Username           string `yaml:"username" json:"username"`                     // SMTP用户名，为空时不认证
+	Password           string `yaml:"password" json:"password"`                     // SMTP密码
+	From               string `yaml:"from" json:"from"`                             // 发件人地址
+	FromName           string `yaml:"fromName" json:"fromName"`                     // 发件人名称
+	DropDir            string `yaml:"dropDir" json:"dropDir"`                       // 写入邮件文件的目录，仅用于file方式
+	TimeoutSeconds     int    `yaml:"timeoutSeconds" json:"timeoutSeconds"`         // 超时时间
+	MaxRetries         int    `yaml:"maxRetries" json:"maxRetries"`                 // 发送失败后最多重试次数
+	KeepDays           int    `yaml:"keepDays" json:"keepDays"`                     // 已发送邮件在队列中保留的天数
+
+	UserPortalURL            string `yaml:"userPortalURL" json:"userPortalURL"`                       // 用户平台访问地址，用于生成邮件中的链接，比如 https://user.example.com
+	VerificationLifeSeconds  int    `yaml:"verificationLifeSeconds" json:"verificationLifeSeconds"`   // 邮箱验证链接有效期
+	ResetPasswordLifeSeconds int    `yaml:"resetPasswordLifeSeconds" json:"resetPasswordLifeSeconds"` // 重置密码验证码有效期
+	NotifyUserMessages       bool   `yaml:"notifyUserMessages" json:"notifyUserMessages"`             // 是否将用户消息发送到用户已验证的邮箱
+
+	Templates []*Template `yaml:"templates" json:"templates"` // 自定义模板，未定义的模板使用系统默认模板
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		Mode:                     ModeSMTP,
+		Security:                 SecuritySTARTTLS,
+		TimeoutSeconds:           DefaultTimeoutSeconds,
+		MaxRetries:               DefaultMaxRetries,
+		KeepDays:                 DefaultKeepDays,
+		VerificationLifeSeconds:  DefaultVerificationLifeSeconds,
+		ResetPasswordLifeSeconds: DefaultResetPasswordLifeSeconds,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	this.Mode = strings.TrimSpace(this.Mode)
+	this.Host = strings.TrimSpace(this.Host)
+	this.Security = strings.ToLower(strings.TrimSpace(this.Security))
+	this.From = strings.TrimSpace(this.From)
+	this.FromName = strings.TrimSpace(this.FromName)
+	this.DropDir = strings.TrimSpace(this.DropDir)
+	this.UserPortalURL = strings.TrimRight(strings.TrimSpace(this.UserPortalURL), "/")
+
+	if len(this.Mode) == 0 {
+		this.Mode = ModeSMTP
+	}
+	if len(this.Security) == 0 {
+		this.Security = SecuritySTARTTLS
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if this.MaxRetries < 0 {
+		this.MaxRetries = 0
+	}
+	if this.KeepDays <= 0 {
+		this.KeepDays = DefaultKeepDays
+	}
+	if this.VerificationLifeSeconds <= 0 {
+		this.VerificationLifeSeconds = DefaultVerificationLifeSeconds
+	}
+	if this.ResetPasswordLifeSeconds <= 0 {
+		this.ResetPasswordLifeSeconds = DefaultResetPasswordLifeSeconds
+	}
+
+	var templates = []*Template{}
+	for _, template := range this.Templates {
+		if template == nil {
+			continue
+		}
+		err := template.Init()
+		if err != nil {
+			return err
+		}
+		templates = append(templates, template)
+	}
+	this.Templates = templates
+
+	if len(this.UserPortalURL) > 0 {
+		u, err := url.Parse(this.UserPortalURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return errors.New("invalid 'userPortalURL': should be like 'https://user.example.com'")
+		}
+	}
+
+	if !this.IsOn {
+		return nil
+	}
+
+	switch this.Mode {
+	case ModeSMTP:
+		if len(this.Host) == 0 {
+			return errors.New("'host' should not be empty")
+		}
+		switch this.Security {
+		case SecurityNone, SecuritySTARTTLS, SecurityTLS:
+		default:
+			return errors.New("invalid 'security': should be 'none', 'starttls' or 'tls'")
+		}
+		if this.Port < 0 || this.Port > 65535 {
+			return errors.New("invalid 'port'")
+		}
+	case ModeFile:
+		if len(this.DropDir) == 0 {
+			return errors.New("'dropDir' should not be empty")
+		}
+	default:
+		return errors.New("invalid 'mode': should be 'smtp' or 'file'")
+	}
+
+	if len(this.From) == 0 {
+		return errors.New("'from' should not be empty")
+	}
+	_, err := mail.ParseAddress(this.From)
+	if err != nil {
+		return errors.New("invalid 'from': " + err.Error())
+	}
+
+	return nil
+}
+
+// SMTPPort 实际使用的SMTP端口
+func (this *Config) SMTPPort() int {
+	if this.Port > 0 {
+		return this.Port
+	}
+	switch this.Security {
+	case SecurityTLS:
+		return 465
+	case SecuritySTARTTLS:
+		return 587
+	}
+	return 25
+}
+
+// RetryDelaySeconds 第几次发送失败后需要等待的时间，每次失败等待时间加倍
+func (this *Config) RetryDelaySeconds(countTries int) int {
+	var delay = MinRetryDelaySeconds
+	for i := 1; i < countTries; i++ {
+		delay *= 2
+		if delay >= MaxRetryDelaySeconds {
+			return MaxRetryDelaySeconds
+		}
+	}
+	return delay
+}
+
+// UserPortalLink 生成用户平台中的链接，未设置用户平台地址时返回空
+func (this *Config) UserPortalLink(path string, query url.Values) string {
+	if len(this.UserPortalURL) == 0 {
+		return ""
+	}
+	var link = this.UserPortalURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// FindTemplate 查找某个语言的模板
+// 自定义模板优先于系统默认模板，找不到对应语言时使用默认语言
+func (this *Config) FindTemplate(code string, lang string) *Template {
+	var defaultTemplates = DefaultTemplates()
+	for _, l := range []string{lang, DefaultLang} {
+		var template = matchTemplate(this.Templates, code, l)
+		if template != nil {
+			return template
+		}
+		template = matchTemplate(defaultTemplates, code, l)
+		if template != nil {
+			return template
+		}
+	}
+	return nil
+}
+
+func (this *Config) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         this.Host,
+		InsecureSkipVerify: this.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+}
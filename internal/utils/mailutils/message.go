@@ -0,0 +1,95 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message 邮件
+type Message struct {
+	To      string // 收件人地址
+	Subject string // 标题
+	Body    string // 内容
+	IsHTML  bool   // 内容是否为HTML
+}
+
+// Validate 校验收件人和标题
+func (this *Message) Validate() error {
+	if len(this.To) == 0 {
+		return errors.New("'to' should not be empty")
+	}
+	address, err := mail.ParseAddress(this.To)
+	if err != nil || address.Address != this.To {
+		return errors.New("invalid 'to' address '" + this.To + "'")
+	}
+	if strings.ContainsAny(this.Subject, "\r\n") {
+		return errors.New("invalid 'subject': should not contain line breaks")
+	}
+	return nil
+}
+
+// Encode 生成符合RFC 5322的邮件内容
+func (this *Message) Encode(from string, fromName string, now time.Time) ([]byte, error) {
+	err := this.Validate()
+	if err != nil {
+		return nil, err
+	}
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, errors.New("invalid 'from' address '" + from + "'")
+	}
+	if len(fromName) > 0 {
+		fromAddress.Name = fromName
+	}
+
+	var contentType = "text/plain; charset=UTF-8"
+	if this.IsHTML {
+		contentType = "text/html; charset=UTF-8"
+	}
+
+	var buf = &bytes.Buffer{}
+	var writeHeader = func(name string, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	writeHeader("From", fromAddress.String())
+	writeHeader("To", (&mail.Address{Address: this.To}).String())
+	writeHeader("Subject", mime.BEncoding.Encode("UTF-8", this.Subject))
+	writeHeader("Date", now.Format(time.RFC1123Z))
+	writeHeader("Message-ID", newMessageId(fromAddress.Address))
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", contentType)
+	writeHeader("Content-Transfer-Encoding", "base64")
+	buf.WriteString("\r\n")
+
+	// 每行76个字符
+	var body = base64.StdEncoding.EncodeToString([]byte(this.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	if len(body) > 0 {
+		buf.WriteString(body + "\r\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newMessageId(from string) string {
+	var domain = "localhost"
+	var index = strings.LastIndex(from, "@")
+	if index >= 0 && index < len(from)-1 {
+		domain = from[index+1:]
+	}
+	var randomBytes = make([]byte, 16)
+	_, _ = rand.Read(randomBytes)
+	return "<" + hex.EncodeToString(randomBytes) + "@" + domain + ">"
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sender 邮件发送器
+type Sender interface {
+	// Send 发送邮件
+	Send(message *Message) error
+}
+
+// NewSender 根据设置获取发送器
+func NewSender(config *Config) (Sender, error) {
+	if config == nil {
+		return nil, errors.New("invalid config")
+	}
+	switch config.Mode {
+	case ModeSMTP:
+		return &SMTPSender{config: config}, nil
+	case ModeFile:
+		return &FileSender{config: config}, nil
+	}
+	return nil, errors.New("invalid mode '" + config.Mode + "'")
+}
+
+// RejectedError 邮件被服务器永久拒绝，比如收件人不存在，重试也不会成功
+type RejectedError struct {
+	Err error
+}
+
+func (this *RejectedError) Error() string {
+	return "rejected by server: " + this.Err.Error()
+}
+
+func (this *RejectedError) Unwrap() error {
+	return this.Err
+}
+
+// IsPermanentError 判断是否为不需要重试的错误
+func IsPermanentError(err error) bool {
+	var rejectedErr *RejectedError
+	return errors.As(err, &rejectedErr)
+}
+
+// 收件人或者邮件内容的5xx错误表示永久失败，认证等其他错误可能在修改设置后恢复
+func checkRejected(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return &RejectedError{Err: err}
+	}
+	return err
+}
+
+// SMTPSender 通过SMTP服务器发送邮件
+type SMTPSender struct {
+	config *Config
+}
+
+// Send 发送邮件
+func (this *SMTPSender) Send(message *Message) error {
+	data, err := message.Encode(this.config.From, this.config.FromName, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var timeout = time.Duration(this.config.TimeoutSeconds) * time.Second
+	var addr = net.JoinHostPort(this.config.Host, strconv.Itoa(this.config.SMTPPort()))
+	var dialer = &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	if this.config.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, this.config.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to '%s' failed: %w", addr, err)
+	}
+
+	// 整个会话的超时时间
+	_ = conn.SetDeadline(time.Now().Add(timeout * 3))
+
+	client, err := smtp.NewClient(conn, this.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if this.config.Security == SecuritySTARTTLS {
+		ok, _ := client.Extension("STARTTLS")
+		if !ok {
+			return errors.New("the server does not support STARTTLS")
+		}
+		err = client.StartTLS(this.config.tlsConfig())
+		if err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if len(this.config.Username) > 0 {
+		ok, mechanisms := client.Extension("AUTH")
+		if !ok {
+			return errors.New("the server does not support AUTH")
+		}
+		var auth smtp.Auth
+		if containsMechanism(mechanisms, "PLAIN") {
+			auth = smtp.PlainAuth("", this.config.Username, this.config.Password, this.config.Host)
+		} else if containsMechanism(mechanisms, "LOGIN") {
+			auth = &loginAuth{
+				username: this.config.Username,
+				password: this.config.Password,
+				host:     this.config.Host,
+			}
+		} else {
+			return errors.New("no supported AUTH mechanisms in '" + mechanisms + "'")
+		}
+		err = client.Auth(auth)
+		if err != nil {
+			return fmt.Errorf("auth failed: %w", err)
+		}
+	}
+
+	fromAddress, err := mail.ParseAddress(this.config.From)
+	if err != nil {
+		return err
+	}
+	err = client.Mail(fromAddress.Address)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(message.To)
+	if err != nil {
+		return checkRejected(err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		_ = writer.Close()
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return checkRejected(err)
+	}
+
+	// 邮件已经被服务器接受，忽略退出时的错误
+	_ = client.Quit()
+	return nil
+}
+
+// FileSender 将邮件写入本地目录，每封邮件一个 .eml 文件，用于测试
+type FileSender struct {
+	config *Config
+}
+
+// Send 发送邮件
+func (this *FileSender) Send(message *Message) error {
+	var now = time.Now()
+	data, err := message.Encode(this.config.From, this.config.FromName, now)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(this.config.DropDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var randomBytes = make([]byte, 4)
+	_, _ = rand.Read(randomBytes)
+	var filename = now.Format("20060102-150405.000000000") + "-" + hex.EncodeToString(randomBytes) + ".eml"
+	var path = filepath.Join(this.config.DropDir, filename)
+
+	// 先写入临时文件，避免读取方读到不完整的邮件
+	var tmpPath = path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// LOGIN认证，用于不支持PLAIN的服务器
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (this *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// 和 smtp.PlainAuth 一样，不允许在未加密的连接上发送密码
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != this.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (this *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	var prompt = strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(this.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(this.password), nil
+	}
+	return nil, errors.New("unexpected server challenge '" + string(fromServer) + "'")
+}
+
+func containsMechanism(mechanisms string, mechanism string) bool {
+	for _, m := range strings.Fields(mechanisms) {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
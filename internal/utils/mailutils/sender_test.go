@@ -0,0 +1,243 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+// 用于测试的简单SMTP服务器，收件人为 unknown@ 开头时拒绝
+func startTestSMTPServer(t *testing.T, username string, password string) (port int, received chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	received = make(chan string, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSMTPConn(conn, username, password, received)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func serveTestSMTPConn(conn net.Conn, username string, password string, received chan string) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var reader = bufio.NewReader(conn)
+	var reply = func(s string) {
+		_, _ = conn.Write([]byte(s + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		var command = strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH PLAIN "):
+			data, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			if string(data) == "\x00"+username+"\x00"+password {
+				reply("235 OK")
+			} else {
+				reply("535 authentication failed")
+			}
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if strings.Contains(command, "<UNKNOWN@") {
+				reply("550 no such user")
+			} else {
+				reply("250 OK")
+			}
+		case command == "DATA":
+			reply("354 go ahead")
+			var builder = &strings.Builder{}
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				builder.WriteString(dataLine)
+			}
+			received <- builder.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	port, received := startTestSMTPServer(t, "mailer", "123456")
+
+	var config = mailutils.DefaultConfig()
+	config.IsOn = true
+	config.Host = "127.0.0.1"
+	config.Port = port
+	config.Security = mailutils.SecurityNone
+	config.Username = "mailer"
+	config.Password = "123456"
+	config.From = "noreply@example.com"
+	config.FromName = "GoEdge"
+	a.IsNil(config.Init())
+
+	sender, err := mailutils.NewSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(&mailutils.Message{
+		To:      "user@example.com",
+		Subject: "测试邮件",
+		Body:    "Hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data = <-received
+	t.Log(data)
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := new(mail.AddressParser).Parse(msg.Header.Get("From"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(from.Name == "GoEdge")
+	a.IsTrue(from.Address == "noreply@example.com")
+
+	// 收件人被拒绝
+	err = sender.Send(&mailutils.Message{
+		To:      "unknown@example.com",
+		Subject: "Test",
+		Body:    "Hello",
+	})
+	a.IsNotNil(err)
+	a.IsTrue(mailutils.IsPermanentError(err))
+
+	// 认证失败可以在修改设置后重试
+	config.Password = "654321"
+	err = sender.Send(&mailutils.Message{
+		To:      "user@example.com",
+		Subject: "Test",
+		Body:    "Hello",
+	})
+	a.IsNotNil(err)
+	a.IsFalse(mailutils.IsPermanentError(err))
+}
+
+func TestSMTPSender_STARTTLSNotSupported(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	port, _ := startTestSMTPServer(t, "", "")
+
+	var config = mailutils.DefaultConfig()
+	config.IsOn = true
+	config.Host = "127.0.0.1"
+	config.Port = port
+	config.Security = mailutils.SecuritySTARTTLS
+	config.From = "noreply@example.com"
+	a.IsNil(config.Init())
+
+	sender, err := mailutils.NewSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(&mailutils.Message{
+		To:      "user@example.com",
+		Subject: "Test",
+		Body:    "Hello",
+	})
+	t.Log(err)
+	a.IsNotNil(err)
+}
+
+func TestFileSender_Send(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = mailutils.DefaultConfig()
+	config.IsOn = true
+	config.Mode = mailutils.ModeFile
+	config.DropDir = filepath.Join(t.TempDir(), "mails")
+	config.From = "noreply@example.com"
+	a.IsNil(config.Init())
+
+	sender, err := mailutils.NewSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = sender.Send(&mailutils.Message{
+			To:      "user@example.com",
+			Subject: "Test " + strconv.Itoa(i),
+			Body:    strings.Repeat("Hello, World. ", 20),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.DropDir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(files) == 3)
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(msg.Header.Get("To") == "<user@example.com>")
+	a.IsTrue(msg.Header.Get("Content-Transfer-Encoding") == "base64")
+}
+
+func TestMessage_Validate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsNil((&mailutils.Message{To: "user@example.com", Subject: "Test"}).Validate())
+	a.IsNotNil((&mailutils.Message{To: "", Subject: "Test"}).Validate())
+	a.IsNotNil((&mailutils.Message{To: "User <user@example.com>", Subject: "Test"}).Validate())
+	a.IsNotNil((&mailutils.Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Test"}).Validate())
+	a.IsNotNil((&mailutils.Message{To: "user@example.com", Subject: "Test\r\nBcc: other@example.com"}).Validate())
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	DefaultLang = "zh-cn"
+
+	TemplateVerifyEmail   = "verifyEmail"   // 邮箱验证
+	TemplateResetPassword = "resetPassword" // 重置密码
+	TemplateUserMessage   = "userMessage"   // 用户消息通知
+	TemplateTest          = "test"          // 测试邮件
+)
+
+// Template 邮件模板
+// 标题和内容使用Go模板语法，比如 {{.Link}}，HTML内容中的变量会自动转义
+type Template struct {
+	Code    string `yaml:"code" json:"code"`       // 模板代号
+	Lang    string `yaml:"lang" json:"lang"`       // 语言代号，比如 zh-cn、en-us
+	Subject string `yaml:"subject" json:"subject"` // 标题
+	Body    string `yaml:"body" json:"body"`       // 内容
+	IsHTML  bool   `yaml:"isHTML" json:"isHTML"`   // 内容是否为HTML
+}
+
+// Init 校验并初始化
+func (this *Template) Init() error {
+	this.Code = strings.TrimSpace(this.Code)
+	this.Lang = strings.ToLower(strings.TrimSpace(this.Lang))
+	if len(this.Code) == 0 {
+		return errors.New("template 'code' should not be empty")
+	}
+	if len(this.Lang) == 0 {
+		this.Lang = DefaultLang
+	}
+	if len(strings.TrimSpace(this.Subject)) == 0 {
+		return errors.New("template '" + this.Code + "' 'subject' should not be empty")
+	}
+
+	_, err := texttemplate.New("").Parse(this.Subject)
+	if err != nil {
+		return errors.New("template '" + this.Code + "' parse subject failed: " + err.Error())
+	}
+	if this.IsHTML {
+		_, err = htmltemplate.New("").Parse(this.Body)
+	} else {
+		_, err = texttemplate.New("").Parse(this.Body)
+	}
+	if err != nil {
+		return errors.New("template '" + this.Code + "' parse body failed: " + err.Error())
+	}
+	return nil
+}
+
+// Render 使用变量生成邮件
+func (this *Template) Render(to string, vars map[string]any) (*Message, error) {
+	subjectTemplate, err := texttemplate.New("").Parse(this.Subject)
+	if err != nil {
+		return nil, err
+	}
+	var subjectBuffer = &bytes.Buffer{}
+	err = subjectTemplate.Execute(subjectBuffer, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyBuffer = &bytes.Buffer{}
+	if this.IsHTML {
+		bodyTemplate, err := htmltemplate.New("").Parse(this.Body)
+		if err != nil {
+			return nil, err
+		}
+		err = bodyTemplate.Execute(bodyBuffer, vars)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bodyTemplate, err := texttemplate.New("").Parse(this.Body)
+		if err != nil {
+			return nil, err
+		}
+		err = bodyTemplate.Execute(bodyBuffer, vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 标题中不能有换行
+	var subject = strings.Join(strings.Fields(subjectBuffer.String()), " ")
+
+	return &Message{
+		To:      to,
+		Subject: subject,
+		Body:    bodyBuffer.String(),
+		IsHTML:  this.IsHTML,
+	}, nil
+}
+
+// 查找匹配语言的模板，优先完全匹配，然后匹配同一语种，比如 en 和 en-us
+func matchTemplate(templates []*Template, code string, lang string) *Template {
+	lang = strings.ToLower(lang)
+	var primaryLang, _, _ = strings.Cut(lang, "-")
+	var found *Template
+	for _, template := range templates {
+		if template.Code != code {
+			continue
+		}
+		if template.Lang == lang {
+			return template
+		}
+		if found == nil {
+			templatePrimaryLang, _, _ := strings.Cut(template.Lang, "-")
+			if templatePrimaryLang == primaryLang {
+				found = template
+			}
+		}
+	}
+	return found
+}
+
+// DefaultTemplates 系统默认模板
+//
+// 可用变量：
+//   - verifyEmail: Username, Email, Code, Link, ExpiresHours
+//   - resetPassword: Username, Email, Code, Link, ExpiresMinutes
+//   - userMessage: Username, Subject, Body
+//   - test: 无
+func DefaultTemplates() []*Template {
+	return []*Template{
+		{
+			Code:    TemplateVerifyEmail,
+			Lang:    "zh-cn",
+			Subject: "请验证您的邮箱",
+			Body: `{{.Username}}，您好：
+
+请点击以下链接验证您的邮箱 {{.Email}}：
+{{.Link}}
+
+如果链接无法打开，请在验证页面输入验证码：{{.Code}}
+此链接 {{.ExpiresHours}} 小时内有效。如果这不是您本人的操作，请忽略此邮件。
+`,
+		},
+		{
+			Code:    TemplateVerifyEmail,
+			Lang:    "en-us",
+			Subject: "Please verify your email address",
+			Body: `Hi {{.Username}},
+
+Please open the link below to verify your email address {{.Email}}:
+{{.Link}}
+
+If the link does not work, enter this code on the verification page: {{.Code}}
+The link expires in {{.ExpiresHours}} hour(s). If you did not request this, please ignore this email.
+`,
+		},
+		{
+			Code:    TemplateResetPassword,
+			Lang:    "zh-cn",
+			Subject: "重置密码",
+			Body: `{{.Username}}，您好：
+
+我们收到了重置您账号密码的请求，请点击以下链接设置新密码：
+{{.Link}}
+
+重置密码验证码：{{.Code}}
+此验证码 {{.ExpiresMinutes}} 分钟内有效。如果这不是您本人的操作，请忽略此邮件，您的密码不会被修改。
+`,
+		},
+		{
+			Code:    TemplateResetPassword,
+			Lang:    "en-us",
+			Subject: "Reset your password",
+			Body: `Hi {{.Username}},
+
+We received a request to reset the password of your account. Open the link below to set a new password:
+{{.Link}}
+
+Reset code: {{.Code}}
+The code expires in {{.ExpiresMinutes}} minute(s). If you did not request this, please ignore this email and your password will not be changed.
+`,
+		},
+		{
+			Code:    TemplateUserMessage,
+			Lang:    "zh-cn",
+			Subject: "[通知] {{.Subject}}",
+			Body: `{{.Username}}，您好：
+
+{{.Body}}
+`,
+		},
+		{
+			Code:    TemplateUserMessage,
+			Lang:    "en-us",
+			Subject: "[Notice] {{.Subject}}",
+			Body: `Hi {{.Username}},
+
+{{.Body}}
+`,
+		},
+		{
+			Code:    TemplateTest,
+			Lang:    "zh-cn",
+			Subject: "测试邮件",
+			Body:    "这是一封测试邮件，收到此邮件说明邮件发送设置正确。\n",
+		},
+		{
+			Code:    TemplateTest,
+			Lang:    "en-us",
+			Subject: "Test email",
+			Body:    "This is a test email. If you received it, the email settings are correct.\n",
+		},
+	}
+}
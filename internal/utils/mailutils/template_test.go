@@ -0,0 +1,107 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package mailutils_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/mailutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestConfig_FindTemplate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = mailutils.DefaultConfig()
+	config.Templates = []*mailutils.Template{
+		{
+			Code:    mailutils.TemplateVerifyEmail,
+			Lang:    "en",
+			Subject: "Custom verification",
+			Body:    "{{.Link}}",
+		},
+	}
+	a.IsNil(config.Init())
+
+	// 同一语种的自定义模板优先
+	var template = config.FindTemplate(mailutils.TemplateVerifyEmail, "en-us")
+	a.IsNotNil(template)
+	a.IsTrue(template.Subject == "Custom verification")
+
+	// 没有自定义模板时使用系统默认模板
+	template = config.FindTemplate(mailutils.TemplateVerifyEmail, "zh-cn")
+	a.IsNotNil(template)
+	a.IsTrue(template.Lang == "zh-cn")
+
+	// 未知语言使用默认语言
+	template = config.FindTemplate(mailutils.TemplateResetPassword, "fr-fr")
+	a.IsNotNil(template)
+	a.IsTrue(template.Lang == mailutils.DefaultLang)
+
+	a.IsNil(config.FindTemplate("unknown", "zh-cn"))
+}
+
+func TestTemplate_Render(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var template = &mailutils.Template{
+		Code:    "test",
+		Subject: "Hello\n{{.Username}}",
+		Body:    `<a href="{{.Link}}">{{.Username}}</a>`,
+		IsHTML:  true,
+	}
+	a.IsNil(template.Init())
+
+	message, err := template.Render("user@example.com", map[string]any{
+		"Username": "<b>Lily</b>",
+		"Link":     "https://user.example.com/email/verify?code=123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(message.Subject)
+	t.Log(message.Body)
+	a.IsTrue(message.Subject == "Hello <b>Lily</b>")
+	a.IsTrue(message.Body == `<a href="https://user.example.com/email/verify?code=123">&lt;b&gt;Lily&lt;/b&gt;</a>`)
+	a.IsTrue(message.IsHTML)
+
+	var invalidTemplate = &mailutils.Template{
+		Code:    "test",
+		Subject: "{{.Username",
+	}
+	a.IsNotNil(invalidTemplate.Init())
+}
+
+func TestConfig_RetryDelaySeconds(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = mailutils.DefaultConfig()
+	a.IsNil(config.Init())
+	for _, countTries := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8} {
+		t.Log(countTries, "=>", config.RetryDelaySeconds(countTries))
+	}
+	a.IsTrue(config.RetryDelaySeconds(1) == mailutils.MinRetryDelaySeconds)
+	a.IsTrue(config.RetryDelaySeconds(2) == mailutils.MinRetryDelaySeconds*2)
+	a.IsTrue(config.RetryDelaySeconds(100) == mailutils.MaxRetryDelaySeconds)
+}
+
+func TestConfig_UserPortalLink(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = mailutils.DefaultConfig()
+	a.IsNil(config.Init())
+	a.IsTrue(config.UserPortalLink(mailutils.VerifyEmailPath, nil) == "")
+
+	config.UserPortalURL = "https://user.example.com/"
+	a.IsNil(config.Init())
+	var link = config.UserPortalLink(mailutils.ResetPasswordPath, url.Values{
+		"email": []string{"a+b@example.com"},
+		"code":  []string{"123"},
+	})
+	t.Log(link)
+	a.IsTrue(link == "https://user.example.com/password/reset?code=123&email=a%2Bb%40example.com")
+
+	config.UserPortalURL = "user.example.com"
+	a.IsNotNil(config.Init())
+}
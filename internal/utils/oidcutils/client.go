@@ -0,0 +1,247 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package oidcutils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+)
+
+const maxResponseSize = 1 << 20
+
+// Discovery 身份提供方元数据
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse 授权码换取的令牌
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Identity 登录用户的身份信息
+type Identity struct {
+	Subject  string
+	Username string
+	Email    string
+	Fullname string
+	Claims   Claims
+}
+
+// GenerateRandomString 生成随机字符串，用于state、nonce和PKCE
+func GenerateRandomString() (string, error) {
+	var data = make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ComputeCodeChallenge 计算PKCE的code_challenge（S256）
+func ComputeCodeChallenge(codeVerifier string) string {
+	var sum = sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Discover 获取身份提供方元数据
+func Discover(config *Config) (*Discovery, error) {
+	var discovery = &Discovery{}
+	err := getJSON(config, config.Issuer+"/.well-known/openid-configuration", discovery)
+	if err != nil {
+		return nil, fmt.Errorf("discover failed: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != config.Issuer {
+		return nil, errors.New("discover failed: issuer mismatch '" + discovery.Issuer + "'")
+	}
+	if len(discovery.AuthorizationEndpoint) == 0 || len(discovery.TokenEndpoint) == 0 || len(discovery.JWKSURI) == 0 {
+		return nil, errors.New("discover failed: missing endpoints")
+	}
+	return discovery, nil
+}
+
+// ComposeAuthURL 构造跳转到身份提供方的认证URL
+func ComposeAuthURL(discovery *Discovery, config *Config, redirectURL string, state string, nonce string, codeVerifier string) (string, error) {
+	u, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	var query = u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientId)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", strings.Join(config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", ComputeCodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// ExchangeCode 使用授权码换取令牌
+func ExchangeCode(discovery *Discovery, config *Config, code string, redirectURL string, codeVerifier string) (*TokenResponse, error) {
+	var form = url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("client_id", config.ClientId)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(config.ClientId), url.QueryEscape(config.ClientSecret))
+	}
+
+	var token = &TokenResponse{}
+	err = doJSON(config, req, token)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code failed: %w", err)
+	}
+	if len(token.IDToken) == 0 {
+		return nil, errors.New("exchange code failed: no 'id_token' in response")
+	}
+	return token, nil
+}
+
+// FetchJWKS 获取身份提供方的公钥
+func FetchJWKS(discovery *Discovery, config *Config) (*JWKS, error) {
+	var jwks = &JWKS{}
+	err := getJSON(config, discovery.JWKSURI, jwks)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks failed: %w", err)
+	}
+	return jwks, nil
+}
+
+// FetchUserinfo 获取用户信息
+func FetchUserinfo(discovery *Discovery, config *Config, accessToken string) (Claims, error) {
+	req, err := http.NewRequest(http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var claims = Claims{}
+	err = doJSON(config, req, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("fetch userinfo failed: %w", err)
+	}
+	return claims, nil
+}
+
+// Authenticate 完成回调：换取令牌、校验ID Token并解析身份
+func Authenticate(config *Config, code string, redirectURL string, codeVerifier string, nonce string) (*Identity, error) {
+	if len(code) == 0 {
+		return nil, errors.New("'code' should not be empty")
+	}
+
+	discovery, err := Discover(config)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ExchangeCode(discovery, config, code, redirectURL, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	jwks, err := FetchJWKS(discovery, config)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := VerifyIDToken(token.IDToken, jwks, config, nonce, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	// ID Token中没有的字段从userinfo中补充
+	if len(discovery.UserinfoEndpoint) > 0 && len(token.AccessToken) > 0 &&
+		(len(claims.GetString(config.Claims.Username)) == 0 || len(claims.GetString(config.Claims.Email)) == 0) {
+		userinfo, err := FetchUserinfo(discovery, config, token.AccessToken)
+		if err == nil && userinfo.GetString("sub") == claims.GetString("sub") {
+			for k, v := range userinfo {
+				_, ok := claims[k]
+				if !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	var identity = &Identity{
+		Subject:  claims.GetString(config.Claims.Subject),
+		Username: claims.GetString(config.Claims.Username),
+		Email:    claims.GetString(config.Claims.Email),
+		Fullname: claims.GetString(config.Claims.Fullname),
+		Claims:   claims,
+	}
+	if len(identity.Subject) == 0 {
+		return nil, errors.New("can not find subject in claims")
+	}
+	return identity, nil
+}
+
+func getJSON(config *Config, rawURL string, result any) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(config, req, result)
+}
+
+func doJSON(config *Config, req *http.Request, result any) error {
+	req.Header.Set("User-Agent", teaconst.ProcessName+"/"+teaconst.Version)
+	req.Header.Set("Accept", "application/json")
+
+	var timeoutSeconds = config.TimeoutSeconds
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DefaultTimeoutSeconds
+	}
+	var client = &http.Client{
+		Timeout: time.Duration(timeoutSeconds) * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid response status '%d': %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package oidcutils_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/oidcutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+// 本地模拟的身份提供方
+type mockIdP struct {
+	server     *httptest.Server
+	privateKey *rsa.PrivateKey
+
+	locker sync.Mutex
+	codes  map[string]url.Values // code => 认证请求参数
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var idp = &mockIdP{
+		privateKey: privateKey,
+		codes:      map[string]url.Values{},
+	}
+
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(writer http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(writer http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"keys": []map[string]any{
+				{
+					"kty": "RSA",
+					"kid": "key1",
+					"use": "sig",
+					"alg": "RS256",
+					"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(writer http.ResponseWriter, req *http.Request) {
+		clientId, clientSecret, _ := req.BasicAuth()
+		if clientId != "edge" || clientSecret != "secret" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = req.ParseForm()
+
+		idp.locker.Lock()
+		params, ok := idp.codes[req.PostForm.Get("code")]
+		delete(idp.codes, req.PostForm.Get("code"))
+		idp.locker.Unlock()
+		if !ok || params.Get("redirect_uri") != req.PostForm.Get("redirect_uri") {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// PKCE
+		if oidcutils.ComputeCodeChallenge(req.PostForm.Get("code_verifier")) != params.Get("code_challenge") {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"id_token": idp.sign(t, map[string]any{
+				"iss":   idp.server.URL,
+				"sub":   "u-100",
+				"aud":   "edge",
+				"exp":   time.Now().Unix() + 300,
+				"iat":   time.Now().Unix(),
+				"nonce": params.Get("nonce"),
+				"name":  "Edge User",
+			}),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(writer http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer access-token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"sub":                "u-100",
+			"preferred_username": "edge-user",
+			"email":              "edge@example.com",
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// 模拟用户在身份提供方登录成功后返回code
+func (this *mockIdP) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code = "code-" + u.Query().Get("state")
+	this.locker.Lock()
+	this.codes[code] = u.Query()
+	this.locker.Unlock()
+	return code
+}
+
+func (this *mockIdP) sign(t *testing.T, claims map[string]any) string {
+	headerJSON, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "key1", "typ": "JWT"})
+	payloadJSON, _ := json.Marshal(claims)
+	var input = base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	var sum = sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, this.privateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (this *mockIdP) config() *oidcutils.Config {
+	var config = oidcutils.DefaultConfig()
+	config.IsOn = true
+	config.Issuer = this.server.URL
+	config.ClientId = "edge"
+	config.ClientSecret = "secret"
+	config.UserIsOn = true
+	return config
+}
+
+func TestAuthenticate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var idp = newMockIdP(t)
+	defer idp.server.Close()
+
+	var config = idp.config()
+	a.IsNil(config.Init())
+	a.IsTrue(config.AllowRole(oidcutils.RoleUser))
+	a.IsFalse(config.AllowRole(oidcutils.RoleAdmin))
+
+	discovery, err := oidcutils.Discover(config)
+	a.IsNil(err)
+
+	state, _ := oidcutils.GenerateRandomString()
+	nonce, _ := oidcutils.GenerateRandomString()
+	verifier, _ := oidcutils.GenerateRandomString()
+	const redirectURL = "http://127.0.0.1:7788/oidc/callback"
+
+	authURL, err := oidcutils.ComposeAuthURL(discovery, config, redirectURL, state, nonce, verifier)
+	a.IsNil(err)
+	a.IsTrue(strings.Contains(authURL, "code_challenge_method=S256"))
+
+	// 正常登录
+	identity, err := oidcutils.Authenticate(config, idp.authorize(t, authURL), redirectURL, verifier, nonce)
+	a.IsNil(err)
+	a.IsTrue(identity.Subject == "u-100")
+	a.IsTrue(identity.Username == "edge-user")
+	a.IsTrue(identity.Email == "edge@example.com")
+	a.IsTrue(identity.Fullname == "Edge User")
+
+	// code只能使用一次
+	var code = idp.authorize(t, authURL)
+	_, err = oidcutils.Authenticate(config, code, redirectURL, verifier, nonce)
+	a.IsNil(err)
+	_, err = oidcutils.Authenticate(config, code, redirectURL, verifier, nonce)
+	a.IsNotNil(err)
+
+	// 错误的PKCE
+	_, err = oidcutils.Authenticate(config, idp.authorize(t, authURL), redirectURL, verifier+"x", nonce)
+	a.IsNotNil(err)
+
+	// 错误的nonce
+	_, err = oidcutils.Authenticate(config, idp.authorize(t, authURL), redirectURL, verifier, nonce+"x")
+	a.IsNotNil(err)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var idp = newMockIdP(t)
+	defer idp.server.Close()
+
+	var config = idp.config()
+	a.IsNil(config.Init())
+
+	discovery, err := oidcutils.Discover(config)
+	a.IsNil(err)
+	jwks, err := oidcutils.FetchJWKS(discovery, config)
+	a.IsNil(err)
+
+	var now = time.Now().Unix()
+	var claims = map[string]any{
+		"iss":   idp.server.URL,
+		"sub":   "u-100",
+		"aud":   []string{"edge", "other"},
+		"exp":   now + 300,
+		"nonce": "n1",
+	}
+	_, err = oidcutils.VerifyIDToken(idp.sign(t, claims), jwks, config, "n1", now)
+	a.IsNil(err)
+
+	// 过期
+	_, err = oidcutils.VerifyIDToken(idp.sign(t, claims), jwks, config, "n1", now+3600)
+	a.IsNotNil(err)
+
+	// 错误的aud
+	claims["aud"] = "other"
+	_, err = oidcutils.VerifyIDToken(idp.sign(t, claims), jwks, config, "n1", now)
+	a.IsNotNil(err)
+
+	// 不允许alg=none
+	var pieces = strings.Split(idp.sign(t, claims), ".")
+	var noneHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	_, err = oidcutils.VerifyIDToken(noneHeader+"."+pieces[1]+".", jwks, config, "n1", now)
+	a.IsNotNil(err)
+}
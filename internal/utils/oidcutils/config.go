@@ -0,0 +1,144 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package oidcutils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/iwind/TeaGo/lists"
+)
+
+type Role = string
+
+const (
+	RoleAdmin Role = "admin" // 管理员
+	RoleUser  Role = "user"  // 用户
+)
+
+type MatchField = string
+
+const (
+	MatchFieldNone     MatchField = ""         // 不匹配已有账号，只能使用已绑定的身份登录
+	MatchFieldUsername MatchField = "username" // 使用用户名匹配已有账号
+	MatchFieldEmail    MatchField = "email"    // 使用邮箱匹配已有账号
+)
+
+const (
+	DefaultTimeoutSeconds = 10
+	StateLifeSeconds      = 600 // 登录流程的有效期
+)
+
+// ClaimMapping 身份声明对应关系
+type ClaimMapping struct {
+	Subject  string `yaml:"subject" json:"subject"`   // 唯一标识，默认为 sub
+	Username string `yaml:"username" json:"username"` // 用户名，默认为 preferred_username
+	Email    string `yaml:"email" json:"email"`       // 邮箱，默认为 email
+	Fullname string `yaml:"fullname" json:"fullname"` // 全名，默认为 name
+}
+
+// ProvisionConfig 自动创建用户设置
+type ProvisionConfig struct {
+	IsOn      bool     `yaml:"isOn" json:"isOn"`           // 是否启用
+	ClusterId int64    `yaml:"clusterId" json:"clusterId"` // 默认集群
+	Features  []string `yaml:"features" json:"features"`   // 默认开通的功能
+}
+
+// Config OIDC登录设置
+type Config struct {
+	IsOn           bool             `yaml:"isOn" json:"isOn"`                     // 是否启用
+	Name           string           `yaml:"name" json:"name"`                     // 登录按钮上显示的名称
+	Issuer         string           `yaml:"issuer" json:"issuer"`                 // 身份提供方Issuer
+	ClientId       string           `yaml:"clientId" json:"clientId"`             // 客户端ID
+	ClientSecret   string           `yaml:"clientSecret" json:"clientSecret"`     // 客户端密钥
+	Scopes         []string         `yaml:"scopes" json:"scopes"`                 // 申请的权限范围
+	Claims         *ClaimMapping    `yaml:"claims" json:"claims"`                 // 身份声明对应关系
+	AdminIsOn      bool             `yaml:"adminIsOn" json:"adminIsOn"`           // 管理员是否可以使用
+	UserIsOn       bool             `yaml:"userIsOn" json:"userIsOn"`             // 用户是否可以使用
+	MatchField     MatchField       `yaml:"matchField" json:"matchField"`         // 匹配已有用户的字段，管理员需要手动绑定身份
+	Provision      *ProvisionConfig `yaml:"provision" json:"provision"`           // 自动创建用户设置
+	TimeoutSeconds int              `yaml:"timeoutSeconds" json:"timeoutSeconds"` // 请求超时时间
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		Name:   "SSO",
+		Scopes: []string{"openid", "profile", "email"},
+		Claims: &ClaimMapping{},
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	this.Issuer = strings.TrimRight(strings.TrimSpace(this.Issuer), "/")
+	this.ClientId = strings.TrimSpace(this.ClientId)
+
+	if this.IsOn {
+		if len(this.Issuer) == 0 {
+			return errors.New("'issuer' should not be empty")
+		}
+		u, err := url.Parse(this.Issuer)
+		if err != nil {
+			return fmt.Errorf("invalid 'issuer': %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("invalid 'issuer': scheme should be 'http' or 'https'")
+		}
+		if len(this.ClientId) == 0 {
+			return errors.New("'clientId' should not be empty")
+		}
+	}
+
+	if !lists.ContainsString(this.Scopes, "openid") {
+		this.Scopes = append([]string{"openid"}, this.Scopes...)
+	}
+
+	if this.Claims == nil {
+		this.Claims = &ClaimMapping{}
+	}
+	if len(this.Claims.Subject) == 0 {
+		this.Claims.Subject = "sub"
+	}
+	if len(this.Claims.Username) == 0 {
+		this.Claims.Username = "preferred_username"
+	}
+	if len(this.Claims.Email) == 0 {
+		this.Claims.Email = "email"
+	}
+	if len(this.Claims.Fullname) == 0 {
+		this.Claims.Fullname = "name"
+	}
+
+	switch this.MatchField {
+	case MatchFieldNone, MatchFieldUsername, MatchFieldEmail:
+	default:
+		return errors.New("invalid 'matchField': '" + this.MatchField + "'")
+	}
+
+	if this.Provision == nil {
+		this.Provision = &ProvisionConfig{}
+	}
+
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+
+	return nil
+}
+
+// AllowRole 检查某个角色是否可以使用
+func (this *Config) AllowRole(role Role) bool {
+	if !this.IsOn {
+		return false
+	}
+	switch role {
+	case RoleAdmin:
+		return this.AdminIsOn
+	case RoleUser:
+		return this.UserIsOn
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package oidcutils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/iwind/TeaGo/types"
+)
+
+// 允许的时钟误差
+const clockSkewSeconds = 60
+
+// Claims 身份声明
+type Claims map[string]any
+
+// GetString 读取字符串声明
+func (this Claims) GetString(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+	value, ok := this[name]
+	if !ok || value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return types.String(int64(v))
+	}
+	return types.String(value)
+}
+
+// GetInt64 读取整数声明
+func (this Claims) GetInt64(name string) int64 {
+	value, ok := this[name]
+	if !ok || value == nil {
+		return 0
+	}
+	return types.Int64(value)
+}
+
+// HasAudience 检查aud中是否包含某个客户端
+func (this Claims) HasAudience(clientId string) bool {
+	switch aud := this["aud"].(type) {
+	case string:
+		return aud == clientId
+	case []any:
+		for _, item := range aud {
+			if s, ok := item.(string); ok && s == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JWK 单个公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKS 公钥集合
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// FindKeys 根据kid查找公钥，kid为空时返回所有公钥
+func (this *JWKS) FindKeys(kid string) []*JWK {
+	var result = []*JWK{}
+	for _, key := range this.Keys {
+		if key == nil || (len(key.Use) > 0 && key.Use != "sig") {
+			continue
+		}
+		if len(kid) == 0 || key.Kid == kid {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// VerifyIDToken 校验ID Token签名和声明
+func VerifyIDToken(rawToken string, jwks *JWKS, config *Config, nonce string, now int64) (Claims, error) {
+	var pieces = strings.Split(rawToken, ".")
+	if len(pieces) != 3 {
+		return nil, errors.New("invalid id token: malformed")
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(pieces[0])
+	if err != nil {
+		return nil, errors.New("invalid id token: decode header failed")
+	}
+	var header = &jwtHeader{}
+	err = json.Unmarshal(headerData, header)
+	if err != nil {
+		return nil, errors.New("invalid id token: decode header failed")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(pieces[2])
+	if err != nil {
+		return nil, errors.New("invalid id token: decode signature failed")
+	}
+
+	// 签名
+	var signingInput = []byte(pieces[0] + "." + pieces[1])
+	err = verifySignature(header, signingInput, signature, jwks, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// 声明
+	payloadData, err := base64.RawURLEncoding.DecodeString(pieces[1])
+	if err != nil {
+		return nil, errors.New("invalid id token: decode payload failed")
+	}
+	var claims = Claims{}
+	err = json.Unmarshal(payloadData, &claims)
+	if err != nil {
+		return nil, errors.New("invalid id token: decode payload failed")
+	}
+
+	if strings.TrimRight(claims.GetString("iss"), "/") != config.Issuer {
+		return nil, errors.New("invalid id token: issuer mismatch")
+	}
+	if !claims.HasAudience(config.ClientId) {
+		return nil, errors.New("invalid id token: audience mismatch")
+	}
+	if azp := claims.GetString("azp"); len(azp) > 0 && azp != config.ClientId {
+		return nil, errors.New("invalid id token: authorized party mismatch")
+	}
+	var exp = claims.GetInt64("exp")
+	if exp <= 0 || exp+clockSkewSeconds < now {
+		return nil, errors.New("invalid id token: expired")
+	}
+	if iat := claims.GetInt64("iat"); iat > now+clockSkewSeconds {
+		return nil, errors.New("invalid id token: issued in the future")
+	}
+	if claims.GetString("nonce") != nonce || len(nonce) == 0 {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func verifySignature(header *jwtHeader, signingInput []byte, signature []byte, jwks *JWKS, config *Config) error {
+	switch header.Alg {
+	case "HS256":
+		if len(config.ClientSecret) == 0 {
+			return errors.New("invalid id token: 'HS256' requires client secret")
+		}
+		var mac = hmac.New(sha256.New, []byte(config.ClientSecret))
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid id token: signature mismatch")
+		}
+		return nil
+	case "RS256", "RS384", "RS512", "ES256", "ES384":
+	default:
+		// 不允许 none 等算法
+		return errors.New("invalid id token: unsupported algorithm '" + header.Alg + "'")
+	}
+
+	if jwks == nil {
+		return errors.New("invalid id token: no public keys")
+	}
+
+	hash, digest := hashInput(header.Alg, signingInput)
+	for _, key := range jwks.FindKeys(header.Kid) {
+		if len(key.Alg) > 0 && key.Alg != header.Alg {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			if !strings.HasPrefix(header.Alg, "RS") {
+				continue
+			}
+			publicKey, err := parseRSAKey(key)
+			if err != nil {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(publicKey, hash, digest, signature) == nil {
+				return nil
+			}
+		case "EC":
+			if !strings.HasPrefix(header.Alg, "ES") {
+				continue
+			}
+			publicKey, err := parseECKey(key)
+			if err != nil {
+				continue
+			}
+			var size = (publicKey.Curve.Params().BitSize + 7) / 8
+			if len(signature) != size*2 {
+				continue
+			}
+			var r = new(big.Int).SetBytes(signature[:size])
+			var s = new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(publicKey, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return errors.New("invalid id token: signature mismatch")
+}
+
+func hashInput(alg string, input []byte) (crypto.Hash, []byte) {
+	switch alg {
+	case "RS384", "ES384":
+		var sum = sha512.Sum384(input)
+		return crypto.SHA384, sum[:]
+	case "RS512":
+		var sum = sha512.Sum512(input)
+		return crypto.SHA512, sum[:]
+	}
+	var sum = sha256.Sum256(input)
+	return crypto.SHA256, sum[:]
+}
+
+func parseRSAKey(key *JWK) (*rsa.PublicKey, error) {
+	nData, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	eData, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+	var e = new(big.Int).SetBytes(eData)
+	if !e.IsInt64() || e.Int64() <= 1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nData),
+		E: int(e.Int64()),
+	}, nil
+}
+
+func parseECKey(key *JWK) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch key.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, errors.New("unsupported curve '" + key.Crv + "'")
+	}
+	xData, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, err
+	}
+	yData, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey = &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xData),
+		Y:     new(big.Int).SetBytes(yData),
+	}
+	if !curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, errors.New("invalid point")
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package otputils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultPeriod = 30 // 每个动态码的有效时间（秒）
+	DefaultDigits = 6  // 动态码位数
+	DefaultSkew   = 1  // 允许前后误差的周期数
+)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成随机密钥，使用Base32编码
+func GenerateSecret() (string, error) {
+	var data = make([]byte, 20)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base32Encoding.EncodeToString(data), nil
+}
+
+// ComputeCode 计算某个时间的动态码（RFC 6238）
+func ComputeCode(secret string, timestamp int64) (string, error) {
+	key, err := base32Encoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+
+	var counter = make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(timestamp/DefaultPeriod))
+
+	var mac = hmac.New(sha1.New, key)
+	mac.Write(counter)
+	var sum = mac.Sum(nil)
+
+	var offset = sum[len(sum)-1] & 0x0f
+	var value = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1_000_000), nil
+}
+
+// Verify 校验动态码，允许前后 DefaultSkew 个周期的误差
+func Verify(secret string, code string, timestamp int64) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != DefaultDigits {
+		return false
+	}
+	for i := -DefaultSkew; i <= DefaultSkew; i++ {
+		expected, err := ComputeCode(secret, timestamp+int64(i*DefaultPeriod))
+		if err != nil {
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ComposeURL 生成用于扫码绑定的URL
+func ComposeURL(issuer string, account string, secret string) string {
+	var label = url.PathEscape(issuer + ":" + account)
+	var query = url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
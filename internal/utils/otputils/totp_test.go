@@ -0,0 +1,40 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package otputils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/otputils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestComputeCode(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// RFC 6238 测试向量：密钥为 "12345678901234567890"
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := otputils.ComputeCode(secret, 59)
+	a.IsNil(err)
+	a.IsTrue(code == "287082")
+
+	code, err = otputils.ComputeCode(secret, 1111111109)
+	a.IsNil(err)
+	a.IsTrue(code == "081804")
+}
+
+func TestVerify(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	secret, err := otputils.GenerateSecret()
+	a.IsNil(err)
+
+	var now int64 = 1_700_000_000
+	code, err := otputils.ComputeCode(secret, now)
+	a.IsNil(err)
+	a.IsTrue(otputils.Verify(secret, code, now))
+	a.IsTrue(otputils.Verify(secret, code, now+otputils.DefaultPeriod))
+	a.IsFalse(otputils.Verify(secret, code, now+10*otputils.DefaultPeriod))
+	a.IsFalse(otputils.Verify(secret, "", now))
+	a.IsFalse(otputils.Verify("!!!", code, now))
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package passwordutils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PolicyError 密码不符合规则
+type PolicyError struct {
+	Message string
+}
+
+func (this *PolicyError) Error() string {
+	return this.Message
+}
+
+// IsPolicyError 判断是否为密码规则错误
+func IsPolicyError(err error) bool {
+	var policyErr *PolicyError
+	return errors.As(err, &policyErr)
+}
+
+func newPolicyError(message string) error {
+	return &PolicyError{Message: message}
+}
+
+// CheckPassword 检查密码是否符合规则
+func CheckPassword(policy *PasswordPolicy, username string, password string) error {
+	if policy == nil || !policy.IsOn {
+		return nil
+	}
+
+	if len([]rune(password)) < policy.MinLength {
+		return newPolicyError("密码长度不能小于" + strconv.Itoa(policy.MinLength) + "个字符")
+	}
+
+	if policy.MinClasses > 1 && CountClasses(password) < policy.MinClasses {
+		return newPolicyError("密码需要至少包含小写字母、大写字母、数字、其他字符中的" + strconv.Itoa(policy.MinClasses) + "种")
+	}
+
+	if policy.ForbidUsername {
+		username = strings.TrimSpace(username)
+		if len(username) > 0 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+			return newPolicyError("密码中不能包含用户名")
+		}
+	}
+
+	if len(policy.BreachListFile) > 0 {
+		breached, err := IsBreached(policy.BreachListFile, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return newPolicyError("此密码已出现在泄露密码列表中，请更换其他密码")
+		}
+	}
+
+	return nil
+}
+
+// CountClasses 计算密码中包含的字符种类数量
+func CountClasses(password string) int {
+	var hasLower, hasUpper, hasDigit, hasOther bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasOther = true
+		}
+	}
+
+	var count = 0
+	for _, b := range []bool{hasLower, hasUpper, hasDigit, hasOther} {
+		if b {
+			count++
+		}
+	}
+	return count
+}
+
+// IsBreached 检查密码是否在泄露密码列表文件中
+// 文件中每行一个明文密码，或者一个SHA1值（可以带有":出现次数"后缀，和常见的泄露密码库格式相同）；以#开头的行为注释
+func IsBreached(file string, password string) (bool, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return false, errors.New("open breach list file failed: " + err.Error())
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	var sum = sha1.Sum([]byte(password))
+	var passwordSHA1 = strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var scanner = bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for scanner.Scan() {
+		var line = strings.TrimRight(scanner.Text(), "\r")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == password {
+			return true, nil
+		}
+
+		var hash = line
+		var index = strings.IndexByte(hash, ':')
+		if index >= 0 {
+			hash = hash[:index]
+		}
+		if len(hash) == sha1.Size*2 && strings.EqualFold(hash, passwordSHA1) {
+			return true, nil
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return false, errors.New("read breach list file failed: " + err.Error())
+	}
+	return false, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package passwordutils_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/passwordutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func sha1Hex(s string) string {
+	var sum = sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckPassword(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var policy = passwordutils.DefaultPolicy()
+	a.IsNil(policy.Init())
+
+	var passwordPolicy = policy.Password
+	passwordPolicy.MinClasses = 3
+
+	a.IsTrue(passwordutils.IsPolicyError(passwordutils.CheckPassword(passwordPolicy, "admin", "Ab1")))
+	a.IsTrue(passwordutils.IsPolicyError(passwordutils.CheckPassword(passwordPolicy, "admin", "abcdefgh1")))
+	a.IsTrue(passwordutils.IsPolicyError(passwordutils.CheckPassword(passwordPolicy, "admin", "MyAdmin123")))
+	a.IsNil(passwordutils.CheckPassword(passwordPolicy, "admin", "Abcdefgh1"))
+	a.IsNil(passwordutils.CheckPassword(passwordPolicy, "admin", "abcdefg-1"))
+
+	passwordPolicy.IsOn = false
+	a.IsNil(passwordutils.CheckPassword(passwordPolicy, "admin", "1"))
+}
+
+func TestCheckPassword_BreachList(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var file = filepath.Join(t.TempDir(), "breach.txt")
+	err := os.WriteFile(file, []byte(`# comment
+Password123
+`+sha1Hex("Summer2024!")+`:120
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var policy = passwordutils.DefaultPolicy()
+	a.IsNil(policy.Init())
+	policy.Password.BreachListFile = file
+
+	a.IsTrue(passwordutils.IsPolicyError(passwordutils.CheckPassword(policy.Password, "admin", "Password123")))
+	a.IsTrue(passwordutils.IsPolicyError(passwordutils.CheckPassword(policy.Password, "admin", "Summer2024!")))
+	a.IsNil(passwordutils.CheckPassword(policy.Password, "admin", "Winter2024!"))
+
+	// 文件不存在
+	policy.Password.BreachListFile = file + ".missing"
+	err = passwordutils.CheckPassword(policy.Password, "admin", "Winter2024!")
+	a.IsNotNil(err)
+	a.IsFalse(passwordutils.IsPolicyError(err))
+}
+
+func TestCountClasses(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(passwordutils.CountClasses("") == 0)
+	a.IsTrue(passwordutils.CountClasses("abc") == 1)
+	a.IsTrue(passwordutils.CountClasses("abcABC") == 2)
+	a.IsTrue(passwordutils.CountClasses("abcABC123") == 3)
+	a.IsTrue(passwordutils.CountClasses("abcABC123#") == 4)
+}
+
+func TestThrottlePolicy_ComputeDelay(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var policy = passwordutils.DefaultPolicy()
+	a.IsNil(policy.Init())
+
+	var throttle = policy.Throttle
+	for _, countFails := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10} {
+		t.Log(countFails, "=>", throttle.ComputeDelay(countFails))
+	}
+	a.IsTrue(throttle.ComputeDelay(2) == 0)
+	a.IsTrue(throttle.ComputeDelay(3) == 1)
+	a.IsTrue(throttle.ComputeDelay(4) == 2)
+	a.IsTrue(throttle.ComputeDelay(100) == throttle.MaxDelaySeconds)
+
+	throttle.IsOn = false
+	a.IsTrue(throttle.ComputeDelay(100) == 0)
+}
+
+func TestRetryMessage(t *testing.T) {
+	for _, retryAfter := range []int64{1, 30, 119, 120, 900} {
+		t.Log(retryAfter, "=>", passwordutils.RetryMessage(retryAfter))
+	}
+}
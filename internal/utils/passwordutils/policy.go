@@ -0,0 +1,142 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package passwordutils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMinLength       = 8
+	DefaultMaxAccountFails = 5
+	DefaultMaxIPFails      = 30
+	DefaultWindowSeconds   = 900
+	DefaultLockSeconds     = 900
+	DefaultDelayAfterFails = 3
+	DefaultMaxDelaySeconds = 30
+
+	MaxHistorySize = 24 // 最多保留的历史密码数量
+)
+
+// Policy 登录安全策略
+type Policy struct {
+	Password *PasswordPolicy `yaml:"password" json:"password"` // 密码规则
+	Throttle *ThrottlePolicy `yaml:"throttle" json:"throttle"` // 登录失败限制
+}
+
+// PasswordPolicy 密码规则
+type PasswordPolicy struct {
+	IsOn           bool   `yaml:"isOn" json:"isOn"`                     // 是否启用
+	MinLength      int    `yaml:"minLength" json:"minLength"`           // 最小长度
+	MinClasses     int    `yaml:"minClasses" json:"minClasses"`         // 至少包含几类字符：小写字母、大写字母、数字、其他字符
+	ForbidUsername bool   `yaml:"forbidUsername" json:"forbidUsername"` // 是否禁止密码中包含用户名
+	BreachListFile string `yaml:"breachListFile" json:"breachListFile"` // 泄露密码列表文件，每行一个明文密码或者SHA1值
+	HistorySize    int    `yaml:"historySize" json:"historySize"`       // 不能和最近几次使用过的密码相同，0表示不限制
+}
+
+// ThrottlePolicy 登录失败限制
+type ThrottlePolicy struct {
+	IsOn            bool `yaml:"isOn" json:"isOn"`                       // 是否启用
+	MaxAccountFails int  `yaml:"maxAccountFails" json:"maxAccountFails"` // 单个账号在统计周期内允许的最大失败次数，超出后锁定
+	MaxIPFails      int  `yaml:"maxIPFails" json:"maxIPFails"`           // 单个IP在统计周期内允许的最大失败次数，超出后锁定
+	WindowSeconds   int  `yaml:"windowSeconds" json:"windowSeconds"`     // 统计周期
+	LockSeconds     int  `yaml:"lockSeconds" json:"lockSeconds"`         // 锁定时长
+	DelayAfterFails int  `yaml:"delayAfterFails" json:"delayAfterFails"` // 失败几次后开始要求等待
+	MaxDelaySeconds int  `yaml:"maxDelaySeconds" json:"maxDelaySeconds"` // 最长等待时间
+}
+
+// DefaultPolicy 默认策略
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Password: &PasswordPolicy{
+			IsOn:           true,
+			MinLength:      DefaultMinLength,
+			MinClasses:     1,
+			ForbidUsername: true,
+		},
+		Throttle: &ThrottlePolicy{
+			IsOn:            true,
+			MaxAccountFails: DefaultMaxAccountFails,
+			MaxIPFails:      DefaultMaxIPFails,
+			WindowSeconds:   DefaultWindowSeconds,
+			LockSeconds:     DefaultLockSeconds,
+			DelayAfterFails: DefaultDelayAfterFails,
+			MaxDelaySeconds: DefaultMaxDelaySeconds,
+		},
+	}
+}
+
+// Init 校验并初始化
+func (this *Policy) Init() error {
+	var defaultPolicy = DefaultPolicy()
+	if this.Password == nil {
+		this.Password = defaultPolicy.Password
+	}
+	if this.Throttle == nil {
+		this.Throttle = defaultPolicy.Throttle
+	}
+
+	// 密码规则
+	var password = this.Password
+	if password.MinLength < 0 {
+		password.MinLength = 0
+	}
+	if password.MinClasses < 0 || password.MinClasses > 4 {
+		return errors.New("'minClasses' should be between 0 and 4")
+	}
+	if password.HistorySize < 0 {
+		password.HistorySize = 0
+	} else if password.HistorySize > MaxHistorySize {
+		password.HistorySize = MaxHistorySize
+	}
+	password.BreachListFile = strings.TrimSpace(password.BreachListFile)
+
+	// 登录失败限制
+	var throttle = this.Throttle
+	if throttle.MaxAccountFails < 0 {
+		throttle.MaxAccountFails = 0
+	}
+	if throttle.MaxIPFails < 0 {
+		throttle.MaxIPFails = 0
+	}
+	if throttle.WindowSeconds <= 0 {
+		throttle.WindowSeconds = DefaultWindowSeconds
+	}
+	if throttle.LockSeconds <= 0 {
+		throttle.LockSeconds = DefaultLockSeconds
+	}
+	if throttle.DelayAfterFails < 0 {
+		throttle.DelayAfterFails = 0
+	}
+	if throttle.MaxDelaySeconds < 0 {
+		throttle.MaxDelaySeconds = 0
+	}
+
+	return nil
+}
+
+// ComputeDelay 计算失败若干次之后需要等待的时间（秒）
+// 从第 DelayAfterFails 次失败开始，每次失败等待时间加倍，最长不超过 MaxDelaySeconds
+func (this *ThrottlePolicy) ComputeDelay(countFails int) int {
+	if !this.IsOn || this.DelayAfterFails <= 0 || this.MaxDelaySeconds <= 0 || countFails < this.DelayAfterFails {
+		return 0
+	}
+	var delay = 1
+	for i := this.DelayAfterFails; i < countFails; i++ {
+		delay *= 2
+		if delay >= this.MaxDelaySeconds {
+			return this.MaxDelaySeconds
+		}
+	}
+	return delay
+}
+
+// RetryMessage 登录被限制时的提示信息
+func RetryMessage(retryAfter int64) string {
+	if retryAfter >= 120 {
+		return "登录失败次数过多，请" + strconv.FormatInt((retryAfter+59)/60, 10) + "分钟后再试"
+	}
+	return "登录失败次数过多，请" + strconv.FormatInt(retryAfter, 10) + "秒后再试"
+}
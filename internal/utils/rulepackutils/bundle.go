@@ -0,0 +1,136 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var codeReg = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// Bundle 签名后的规则包
+// 签名针对 payload 的原始字节，所以 payload 在传输过程中不能被重新编码
+type Bundle struct {
+	Payload   json.RawMessage `json:"payload"`
+	KeyId     string          `json:"keyId"`
+	Signature string          `json:"signature"` // 使用 Ed25519 签名后的 Base64 编码
+}
+
+// Header 规则包的基本信息，和规则分组一起放在 payload 中
+type Header struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	PublishedAt int64  `json:"publishedAt"`
+}
+
+// Validate 校验基本信息
+func (this *Header) Validate() error {
+	if !codeReg.MatchString(this.Code) {
+		return errors.New("invalid rule pack code '" + this.Code + "'")
+	}
+	if len(this.Name) == 0 {
+		return errors.New("rule pack name should not be empty")
+	}
+	if !ValidateVersion(this.Version) {
+		return errors.New("invalid rule pack version '" + this.Version + "'")
+	}
+	return nil
+}
+
+// ParseBundle 解析规则包
+func ParseBundle(data []byte) (*Bundle, *Header, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil, errors.New("rule pack should not be empty")
+	}
+	if len(data) > MaxBundleSize {
+		return nil, nil, fmt.Errorf("rule pack is too large, should be less than %d bytes", MaxBundleSize)
+	}
+
+	var bundle = &Bundle{}
+	err := json.Unmarshal(data, bundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode rule pack failed: %w", err)
+	}
+	if len(bundle.Payload) == 0 {
+		return nil, nil, errors.New("rule pack 'payload' should not be empty")
+	}
+
+	var header = &Header{}
+	err = json.Unmarshal(bundle.Payload, header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode rule pack payload failed: %w", err)
+	}
+	err = header.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bundle, header, nil
+}
+
+// IsSigned 是否已签名
+func (this *Bundle) IsSigned() bool {
+	return len(this.Signature) > 0
+}
+
+// Verify 使用受信任的公钥校验签名
+func (this *Bundle) Verify(publicKeys []*PublicKey) error {
+	if !this.IsSigned() {
+		return errors.New("rule pack is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(this.Signature)
+	if err != nil {
+		return errors.New("invalid rule pack signature")
+	}
+
+	var foundKey = false
+	for _, publicKey := range publicKeys {
+		if publicKey.KeyId != this.KeyId {
+			continue
+		}
+		foundKey = true
+
+		key, err := publicKey.Decode()
+		if err != nil {
+			return err
+		}
+		if ed25519.Verify(key, this.Payload, signature) {
+			return nil
+		}
+	}
+	if !foundKey {
+		return errors.New("rule pack is signed by untrusted key '" + this.KeyId + "'")
+	}
+	return errors.New("rule pack signature verification failed")
+}
+
+// Digest 计算 payload 的摘要，用来判断同一个版本的内容是否一致
+func (this *Bundle) Digest() string {
+	var sum = sha256.Sum256(this.Payload)
+	return fmt.Sprintf("%x", sum)
+}
+
+// Sign 对 payload 签名并生成规则包
+func Sign(payload []byte, keyId string, privateKey ed25519.PrivateKey) ([]byte, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid private key")
+	}
+	if !json.Valid(payload) {
+		return nil, errors.New("payload should be a valid json")
+	}
+	return json.Marshal(&Bundle{
+		Payload:   payload,
+		KeyId:     keyId,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, payload)),
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/rulepackutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestBundle_Verify(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload = []byte(`{"code":"owasp","name":"OWASP","version":"1.2.0","inbound":[]}`)
+	data, err := rulepackutils.Sign(payload, "official", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, header, err := rulepackutils.ParseBundle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(header.Code == "owasp")
+	a.IsTrue(header.Version == "1.2.0")
+	a.IsTrue(bundle.IsSigned())
+
+	var trustedKeys = []*rulepackutils.PublicKey{{KeyId: "official", Key: base64.StdEncoding.EncodeToString(publicKey)}}
+	a.IsNil(bundle.Verify(trustedKeys))
+
+	// 未受信任的公钥
+	a.IsNotNil(bundle.Verify([]*rulepackutils.PublicKey{{KeyId: "other", Key: base64.StdEncoding.EncodeToString(publicKey)}}))
+
+	// 内容被修改
+	bundle.Payload = []byte(`{"code":"owasp","name":"OWASP","version":"1.2.1","inbound":[]}`)
+	a.IsNotNil(bundle.Verify(trustedKeys))
+}
+
+func TestParseBundle_Invalid(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, data := range []string{
+		``,
+		`{}`,
+		`{"payload":{"code":"owasp","name":"OWASP","version":"v1"}}`,
+		`{"payload":{"code":"../owasp","name":"OWASP","version":"1.0"}}`,
+		`{"payload":{"code":"owasp","version":"1.0"}}`,
+	} {
+		_, _, err := rulepackutils.ParseBundle([]byte(data))
+		a.IsNotNil(err)
+	}
+
+	bundle, _, err := rulepackutils.ParseBundle([]byte(`{"payload":{"code":"owasp","name":"OWASP","version":"1.0"}}`))
+	a.IsNil(err)
+	a.IsFalse(bundle.IsSigned())
+}
+
+func TestCompareVersion(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(rulepackutils.CompareVersion("1.2.0", "1.2") == 0)
+	a.IsTrue(rulepackutils.CompareVersion("1.10.0", "1.9.9") == 1)
+	a.IsTrue(rulepackutils.CompareVersion("1.0", "1.0.1") == -1)
+}
+
+func TestFetch(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/packs/owasp/1.2.0.json" || req.Header.Get("Authorization") != "Bearer 123" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = writer.Write([]byte(`{"payload":{"code":"owasp","name":"OWASP","version":"1.2.0"}}`))
+	}))
+	defer server.Close()
+
+	var config = &rulepackutils.Config{
+		MirrorURL:       server.URL + "/packs/",
+		AuthHeaderValue: "Bearer 123",
+	}
+	data, err := rulepackutils.Fetch(config, "owasp", "1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, header, err := rulepackutils.ParseBundle(data)
+	a.IsNil(err)
+	a.IsTrue(header.Version == "1.2.0")
+
+	_, err = rulepackutils.Fetch(config, "owasp", "1.3.0")
+	a.IsNotNil(err)
+}
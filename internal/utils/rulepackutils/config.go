@@ -0,0 +1,125 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/ipfeedutils"
+)
+
+const (
+	DefaultTimeoutSeconds = 60
+	MaxBundleSize         = 32 << 20 // 规则包最大尺寸
+)
+
+// Config 规则包设置
+type Config struct {
+	MirrorURL       string       `yaml:"mirrorURL" json:"mirrorURL"`             // 内部镜像地址，支持 ${code} 和 ${version} 变量，没有变量时自动加上 /${code}/${version}.json
+	AuthHeaderName  string       `yaml:"authHeaderName" json:"authHeaderName"`   // 访问镜像时的认证Header名称
+	AuthHeaderValue string       `yaml:"authHeaderValue" json:"authHeaderValue"` // 访问镜像时的认证Header值
+	TimeoutSeconds  int          `yaml:"timeoutSeconds" json:"timeoutSeconds"`   // 下载超时时间
+	PublicKeys      []*PublicKey `yaml:"publicKeys" json:"publicKeys"`           // 受信任的公钥
+	AllowUnsigned   bool         `yaml:"allowUnsigned" json:"allowUnsigned"`     // 是否允许导入未签名的规则包
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		TimeoutSeconds: DefaultTimeoutSeconds,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	this.MirrorURL = strings.TrimSpace(this.MirrorURL)
+	if len(this.MirrorURL) > 0 {
+		u, err := url.Parse(this.MirrorURL)
+		if err != nil {
+			return fmt.Errorf("invalid 'mirrorURL': %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("invalid 'mirrorURL': scheme should be 'http' or 'https'")
+		}
+	}
+
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if len(this.AuthHeaderValue) > 0 && len(this.AuthHeaderName) == 0 {
+		this.AuthHeaderName = "Authorization"
+	}
+
+	var keyIdMap = map[string]bool{}
+	for _, publicKey := range this.PublicKeys {
+		if publicKey == nil {
+			return errors.New("invalid public key")
+		}
+		_, err := publicKey.Decode()
+		if err != nil {
+			return err
+		}
+		if keyIdMap[publicKey.KeyId] {
+			return errors.New("duplicated public key id '" + publicKey.KeyId + "'")
+		}
+		keyIdMap[publicKey.KeyId] = true
+	}
+
+	return nil
+}
+
+// Mask 对认证信息进行掩码，以便返回给界面
+func (this *Config) Mask() {
+	this.AuthHeaderValue = ipfeedutils.MaskString(this.AuthHeaderValue)
+}
+
+// UnmaskWith 认证信息为掩码后的值时，使用旧的设置中的值
+func (this *Config) UnmaskWith(oldConfig *Config) {
+	if !ipfeedutils.IsMasked(this.AuthHeaderValue) {
+		return
+	}
+	if oldConfig == nil {
+		this.AuthHeaderValue = ""
+		return
+	}
+	this.AuthHeaderValue = oldConfig.AuthHeaderValue
+}
+
+// ComposeMirrorURL 组合某个规则包版本的下载地址
+func (this *Config) ComposeMirrorURL(code string, version string) (string, error) {
+	if len(this.MirrorURL) == 0 {
+		return "", errors.New("rule pack mirror has not been configured")
+	}
+	if !codeReg.MatchString(code) {
+		return "", errors.New("invalid rule pack code '" + code + "'")
+	}
+	if !ValidateVersion(version) {
+		return "", errors.New("invalid rule pack version '" + version + "'")
+	}
+
+	var mirrorURL = this.MirrorURL
+	if !strings.Contains(mirrorURL, "${code}") && !strings.Contains(mirrorURL, "${version}") {
+		mirrorURL = strings.TrimRight(mirrorURL, "/") + "/${code}/${version}.json"
+	}
+	return strings.NewReplacer("${code}", url.PathEscape(code), "${version}", url.PathEscape(version)).Replace(mirrorURL), nil
+}
+
+// PublicKey 受信任的公钥
+type PublicKey struct {
+	KeyId string `yaml:"keyId" json:"keyId"`
+	Key   string `yaml:"key" json:"key"` // Base64编码的 Ed25519 公钥
+}
+
+// Decode 解析公钥
+func (this *PublicKey) Decode() (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(this.Key))
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key '" + this.KeyId + "'")
+	}
+	return data, nil
+}
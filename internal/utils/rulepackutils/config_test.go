@@ -0,0 +1,34 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/rulepackutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestConfig_Mask(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var oldConfig = &rulepackutils.Config{
+		AuthHeaderName:  "Authorization",
+		AuthHeaderValue: "Bearer 1234567890",
+	}
+
+	var config = &rulepackutils.Config{
+		AuthHeaderName:  oldConfig.AuthHeaderName,
+		AuthHeaderValue: oldConfig.AuthHeaderValue,
+	}
+	config.Mask()
+	a.IsTrue(config.AuthHeaderValue != oldConfig.AuthHeaderValue)
+
+	config.UnmaskWith(oldConfig)
+	a.IsTrue(config.AuthHeaderValue == oldConfig.AuthHeaderValue)
+
+	// 修改为新值
+	config.AuthHeaderValue = "Bearer abc"
+	config.UnmaskWith(oldConfig)
+	a.IsTrue(config.AuthHeaderValue == "Bearer abc")
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+)
+
+// LoadFile 从API节点本地文件中读取规则包
+func LoadFile(path string) ([]byte, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	return readLimited(fp)
+}
+
+// Fetch 从内部镜像中下载规则包
+func Fetch(config *Config, code string, version string) ([]byte, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	err := config.Init()
+	if err != nil {
+		return nil, err
+	}
+	mirrorURL, err := config.ComposeMirrorURL(code, version)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, mirrorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", teaconst.ProcessName+"/"+teaconst.Version)
+	if len(config.AuthHeaderName) > 0 {
+		req.Header.Set(config.AuthHeaderName, config.AuthHeaderValue)
+	}
+
+	var client = &http.Client{
+		Timeout: time.Duration(config.TimeoutSeconds) * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return readLimited(resp.Body)
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, MaxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBundleSize {
+		return nil, fmt.Errorf("rule pack is too large, should be less than %d bytes", MaxBundleSize)
+	}
+	return data, nil
+}
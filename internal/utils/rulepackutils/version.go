@@ -0,0 +1,38 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package rulepackutils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionReg = regexp.MustCompile(`^\d+(\.\d+){0,3}$`)
+
+// ValidateVersion 检查版本号格式，比如 1.2.3
+func ValidateVersion(version string) bool {
+	return versionReg.MatchString(version)
+}
+
+// CompareVersion 对比版本号，version1 > version2 时返回 1，相等时返回 0，否则返回 -1
+func CompareVersion(version1 string, version2 string) int {
+	var pieces1 = strings.Split(version1, ".")
+	var pieces2 = strings.Split(version2, ".")
+	for i := 0; i < len(pieces1) || i < len(pieces2); i++ {
+		var v1, v2 int64
+		if i < len(pieces1) {
+			v1, _ = strconv.ParseInt(pieces1[i], 10, 64)
+		}
+		if i < len(pieces2) {
+			v2, _ = strconv.ParseInt(pieces2[i], 10, 64)
+		}
+		if v1 > v2 {
+			return 1
+		}
+		if v1 < v2 {
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package sessionutils
+
+const (
+	DefaultIdleTimeoutSeconds     = 2 * 3600   // 默认空闲超时时间
+	DefaultAbsoluteTimeoutSeconds = 30 * 86400 // 默认最长有效期
+
+	LastSeenUpdateInterval = 60 // 更新最后活跃时间的最小间隔（秒），避免每次请求都写数据库
+)
+
+// Config 登录会话设置
+type Config struct {
+	IdleTimeoutSeconds     int64 `yaml:"idleTimeoutSeconds" json:"idleTimeoutSeconds"`         // 空闲超时时间，超过此时间没有活动则需要重新登录，0表示不限制
+	AbsoluteTimeoutSeconds int64 `yaml:"absoluteTimeoutSeconds" json:"absoluteTimeoutSeconds"` // 最长有效期，从登录开始计算，0表示不限制
+	RevokeOnPasswordChange bool  `yaml:"revokeOnPasswordChange" json:"revokeOnPasswordChange"` // 修改密码后是否退出所有登录
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		IdleTimeoutSeconds:     DefaultIdleTimeoutSeconds,
+		AbsoluteTimeoutSeconds: DefaultAbsoluteTimeoutSeconds,
+		RevokeOnPasswordChange: true,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	if this.IdleTimeoutSeconds < 0 {
+		this.IdleTimeoutSeconds = 0
+	}
+	if this.AbsoluteTimeoutSeconds < 0 {
+		this.AbsoluteTimeoutSeconds = 0
+	}
+	return nil
+}
+
+// IsExpired 检查会话是否已超时
+// createdAt 为登录时间，lastSeenAt 为最后活跃时间，为0时使用登录时间
+func (this *Config) IsExpired(createdAt int64, lastSeenAt int64, now int64) bool {
+	if this.AbsoluteTimeoutSeconds > 0 && createdAt > 0 && createdAt+this.AbsoluteTimeoutSeconds <= now {
+		return true
+	}
+	if lastSeenAt <= 0 {
+		lastSeenAt = createdAt
+	}
+	if this.IdleTimeoutSeconds > 0 && lastSeenAt > 0 && lastSeenAt+this.IdleTimeoutSeconds <= now {
+		return true
+	}
+	return false
+}
+
+// ShouldUpdateLastSeen 检查是否需要更新最后活跃时间
+func ShouldUpdateLastSeen(lastSeenAt int64, now int64) bool {
+	return now-lastSeenAt >= LastSeenUpdateInterval
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package sessionutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/sessionutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestConfig_IsExpired(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = sessionutils.DefaultConfig()
+	config.IdleTimeoutSeconds = 600
+	config.AbsoluteTimeoutSeconds = 3600
+	a.IsNil(config.Init())
+
+	const now = 1_700_000_000
+	a.IsFalse(config.IsExpired(now-100, 0, now))
+	a.IsTrue(config.IsExpired(now-600, 0, now))         // 登录后没有活动
+	a.IsFalse(config.IsExpired(now-1200, now-100, now)) // 一直在活动
+	a.IsTrue(config.IsExpired(now-1200, now-700, now))  // 空闲超时
+	a.IsTrue(config.IsExpired(now-3600, now-10, now))   // 超过最长有效期
+
+	// 不限制
+	config.IdleTimeoutSeconds = 0
+	config.AbsoluteTimeoutSeconds = 0
+	a.IsFalse(config.IsExpired(now-86400*365, 0, now))
+}
+
+func TestShouldUpdateLastSeen(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	const now = 1_700_000_000
+	a.IsFalse(sessionutils.ShouldUpdateLastSeen(now-10, now))
+	a.IsTrue(sessionutils.ShouldUpdateLastSeen(now-sessionutils.LastSeenUpdateInterval, now))
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/iwind/TeaGo/maps"
+)
+
+const (
+	DefaultCodeLength          = 6
+	DefaultCodeLifeSeconds     = 600
+	DefaultSendIntervalSeconds = 60
+	DefaultMaxPerMobilePerDay  = 10
+	DefaultMaxPerIPPerHour     = 20
+	DefaultTimeoutSeconds      = 10
+
+	MinCodeLength = 4
+	MaxCodeLength = 10
+)
+
+// Config 短信发送设置
+type Config struct {
+	IsOn          bool        `yaml:"isOn" json:"isOn"`                   // 是否启用
+	GatewayType   GatewayType `yaml:"gatewayType" json:"gatewayType"`     // 短信网关类型
+	GatewayParams maps.Map    `yaml:"gatewayParams" json:"gatewayParams"` // 短信网关参数
+
+	CodeLength          int `yaml:"codeLength" json:"codeLength"`                   // 验证码长度
+	CodeLifeSeconds     int `yaml:"codeLifeSeconds" json:"codeLifeSeconds"`         // 验证码有效期
+	SendIntervalSeconds int `yaml:"sendIntervalSeconds" json:"sendIntervalSeconds"` // 同一个手机号两次发送的最小间隔
+	MaxPerMobilePerDay  int `yaml:"maxPerMobilePerDay" json:"maxPerMobilePerDay"`   // 同一个手机号每天最多发送次数，0表示不限制
+	MaxPerIPPerHour     int `yaml:"maxPerIPPerHour" json:"maxPerIPPerHour"`         // 同一个IP每小时最多发送次数，0表示不限制
+
+	Templates []*Template `yaml:"templates" json:"templates"` // 自定义短信内容模板，仅用于需要发送完整内容的网关
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		GatewayType:         GatewayTypeHTTP,
+		GatewayParams:       maps.Map{},
+		CodeLength:          DefaultCodeLength,
+		CodeLifeSeconds:     DefaultCodeLifeSeconds,
+		SendIntervalSeconds: DefaultSendIntervalSeconds,
+		MaxPerMobilePerDay:  DefaultMaxPerMobilePerDay,
+		MaxPerIPPerHour:     DefaultMaxPerIPPerHour,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	if this.GatewayParams == nil {
+		this.GatewayParams = maps.Map{}
+	}
+	if this.CodeLength <= 0 {
+		this.CodeLength = DefaultCodeLength
+	} else if this.CodeLength < MinCodeLength || this.CodeLength > MaxCodeLength {
+		return errors.New("'codeLength' should be between 4 and 10")
+	}
+	if this.CodeLifeSeconds <= 0 {
+		this.CodeLifeSeconds = DefaultCodeLifeSeconds
+	}
+	if this.SendIntervalSeconds < 0 {
+		this.SendIntervalSeconds = 0
+	}
+	if this.MaxPerMobilePerDay < 0 {
+		this.MaxPerMobilePerDay = 0
+	}
+	if this.MaxPerIPPerHour < 0 {
+		this.MaxPerIPPerHour = 0
+	}
+
+	var templates = []*Template{}
+	for _, template := range this.Templates {
+		if template == nil {
+			continue
+		}
+		err := template.Init()
+		if err != nil {
+			return err
+		}
+		templates = append(templates, template)
+	}
+	this.Templates = templates
+
+	if !this.IsOn {
+		return nil
+	}
+
+	// 检查网关参数
+	_, err := this.NewGateway()
+	return err
+}
+
+// NewGateway 根据设置获取短信网关
+func (this *Config) NewGateway() (GatewayInterface, error) {
+	gateway, err := NewGateway(this.GatewayType)
+	if err != nil {
+		return nil, err
+	}
+	err = gateway.Init(this.GatewayParams)
+	if err != nil {
+		return nil, err
+	}
+	return gateway, nil
+}
+
+// FindTemplate 查找某个场景和语言的短信内容模板
+// 自定义模板优先于系统默认模板，找不到对应语言时使用默认语言
+func (this *Config) FindTemplate(scene Scene, lang string) *Template {
+	var defaultTemplates = DefaultTemplates()
+	for _, l := range []string{lang, DefaultLang} {
+		var template = matchTemplate(this.Templates, scene, l)
+		if template != nil {
+			return template
+		}
+		template = matchTemplate(defaultTemplates, scene, l)
+		if template != nil {
+			return template
+		}
+	}
+	return nil
+}
+
+// GenerateCode 生成数字验证码
+func (this *Config) GenerateCode() (string, error) {
+	var builder = &strings.Builder{}
+	var max = big.NewInt(10)
+	for i := 0; i < this.CodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(byte('0' + n.Int64()))
+	}
+	return builder.String(), nil
+}
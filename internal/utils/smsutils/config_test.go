@@ -0,0 +1,84 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/smsutils"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+)
+
+func TestConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = smsutils.DefaultConfig()
+	a.IsNil(config.Init())
+
+	// 启用时需要检查网关参数
+	config.IsOn = true
+	a.IsNotNil(config.Init())
+
+	config.GatewayParams = maps.Map{"url": "http://127.0.0.1/send"}
+	a.IsNil(config.Init())
+
+	config.CodeLength = 20
+	a.IsNotNil(config.Init())
+}
+
+func TestConfig_GenerateCode(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = smsutils.DefaultConfig()
+	config.CodeLength = 8
+	a.IsNil(config.Init())
+
+	for i := 0; i < 100; i++ {
+		code, err := config.GenerateCode()
+		a.IsNil(err)
+		a.IsTrue(len(code) == 8)
+		a.IsTrue(strings.Trim(code, "0123456789") == "")
+	}
+}
+
+func TestConfig_FindTemplate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = smsutils.DefaultConfig()
+	config.Templates = []*smsutils.Template{
+		{
+			Scene:   smsutils.SceneVerifyMobile,
+			Lang:    "en",
+			Content: "Code: {{.Code}}",
+		},
+	}
+	a.IsNil(config.Init())
+
+	// 同一语种的自定义模板优先
+	var template = config.FindTemplate(smsutils.SceneVerifyMobile, "en-us")
+	a.IsNotNil(template)
+	content, err := template.Render("123456", 600)
+	a.IsNil(err)
+	a.IsTrue(content == "Code: 123456")
+
+	// 未知语言使用默认语言
+	template = config.FindTemplate(smsutils.SceneResetPassword, "fr-fr")
+	a.IsNotNil(template)
+	a.IsTrue(template.Lang == smsutils.DefaultLang)
+	content, err = template.Render("123456", 600)
+	a.IsNil(err)
+	a.IsTrue(strings.Contains(content, "123456"))
+	a.IsTrue(strings.Contains(content, "10分钟"))
+}
+
+func TestUnmaskParams(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var oldParams = maps.Map{"accessKeyId": "id", "accessKeySecret": "secret-123456"}
+	var newParams = maps.Map{"accessKeyId": "id2", "accessKeySecret": smsutils.MaskString("secret-123456")}
+	smsutils.UnmaskParams(oldParams, newParams)
+	a.IsTrue(newParams.GetString("accessKeyId") == "id2")
+	a.IsTrue(newParams.GetString("accessKeySecret") == "secret-123456")
+}
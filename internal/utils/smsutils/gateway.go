@@ -0,0 +1,111 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/iwind/TeaGo/maps"
+)
+
+type GatewayType = string
+
+// 短信网关类型
+const (
+	GatewayTypeHTTP   GatewayType = "http"   // 通用HTTP接口
+	GatewayTypeAliyun GatewayType = "aliyun" // 阿里云短信
+)
+
+// Message 验证码短信
+type Message struct {
+	Mobile  string // 手机号
+	Scene   Scene  // 场景
+	Code    string // 验证码
+	Content string // 根据模板生成的完整内容
+}
+
+// GatewayInterface 短信网关接口
+type GatewayInterface interface {
+	// Init 使用参数初始化
+	Init(params maps.Map) error
+
+	// MaskParams 对参数进行掩码
+	MaskParams(params maps.Map)
+
+	// Send 发送短信
+	Send(message *Message) error
+}
+
+// FindAllGatewayTypes 所有的短信网关类型
+func FindAllGatewayTypes() []maps.Map {
+	return []maps.Map{
+		{
+			"name":        "阿里云短信",
+			"code":        GatewayTypeAliyun,
+			"description": "通过阿里云短信服务发送，需要事先在阿里云控制台申请签名和模板，模板中的验证码变量名为code。",
+		},
+		{
+			"name":        "自定义HTTP接口",
+			"code":        GatewayTypeHTTP,
+			"description": "通过自定义的HTTP接口发送，URL和请求内容中可以使用${mobile}、${code}、${content}、${scene}变量。",
+		},
+	}
+}
+
+// FindGatewayTypeName 查找短信网关类型名称
+func FindGatewayTypeName(gatewayType GatewayType) string {
+	for _, t := range FindAllGatewayTypes() {
+		if t.GetString("code") == gatewayType {
+			return t.GetString("name")
+		}
+	}
+	return ""
+}
+
+// NewGateway 根据类型获取短信网关
+func NewGateway(gatewayType GatewayType) (GatewayInterface, error) {
+	switch gatewayType {
+	case GatewayTypeHTTP:
+		return &HTTPGateway{}, nil
+	case GatewayTypeAliyun:
+		return &AliyunGateway{}, nil
+	}
+	return nil, errors.New("invalid gateway type '" + gatewayType + "'")
+}
+
+// MaskString 对字符串进行掩码
+func MaskString(s string) string {
+	var l = len(s)
+	if l == 0 {
+		return ""
+	}
+	if l < 8 {
+		return strings.Repeat("*", l)
+	}
+	return s[:4] + strings.Repeat("*", l-4)
+}
+
+// IsMasked 判断字符串是否被掩码
+func IsMasked(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	return s == strings.Repeat("*", len(s)) || strings.HasSuffix(s, "**")
+}
+
+// UnmaskParams 使用旧的参数恢复被掩码的参数
+func UnmaskParams(oldParams maps.Map, newParams maps.Map) {
+	if oldParams == nil || newParams == nil {
+		return
+	}
+	for k, v := range newParams {
+		s, ok := v.(string)
+		if ok && IsMasked(s) {
+			var oldV = oldParams.GetString(k)
+			if len(oldV) > 0 {
+				newParams[k] = oldV
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/dysmsapi"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+)
+
+const (
+	aliyunDefaultRegionId = "cn-hangzhou"
+	aliyunDefaultEndpoint = "dysmsapi.aliyuncs.com"
+)
+
+// AliyunGateway 阿里云短信
+type AliyunGateway struct {
+	accessKeyId     string
+	accessKeySecret string
+	regionId        string
+	signName        string
+	templateCode    string
+	templateCodes   map[Scene]string
+	scheme          string
+	endpoint        string
+	timeout         time.Duration
+}
+
+// Init 使用参数初始化
+// 参数：
+//   - accessKeyId
+//   - accessKeySecret
+//   - signName 短信签名
+//   - templateCode 默认的短信模板代号
+//   - templateCodes 不同场景使用的模板代号，比如 {"resetPassword": "SMS_123"}
+//   - regionId 区域，默认为cn-hangzhou
+//   - endpoint 接口地址，默认为dysmsapi.aliyuncs.com，可以使用 http://host:port 形式的地址
+//   - timeoutSeconds 超时时间
+func (this *AliyunGateway) Init(params maps.Map) error {
+	this.accessKeyId = strings.TrimSpace(params.GetString("accessKeyId"))
+	this.accessKeySecret = strings.TrimSpace(params.GetString("accessKeySecret"))
+	this.signName = strings.TrimSpace(params.GetString("signName"))
+	this.templateCode = strings.TrimSpace(params.GetString("templateCode"))
+	this.regionId = strings.TrimSpace(params.GetString("regionId"))
+
+	if len(this.accessKeyId) == 0 {
+		return errors.New("'accessKeyId' should not be empty")
+	}
+	if len(this.accessKeySecret) == 0 {
+		return errors.New("'accessKeySecret' should not be empty")
+	}
+	if len(this.signName) == 0 {
+		return errors.New("'signName' should not be empty")
+	}
+
+	this.templateCodes = map[Scene]string{}
+	for scene, code := range params.GetMap("templateCodes") {
+		var codeString = strings.TrimSpace(types.String(code))
+		if len(codeString) > 0 {
+			this.templateCodes[scene] = codeString
+		}
+	}
+	if len(this.templateCode) == 0 && len(this.templateCodes) == 0 {
+		return errors.New("'templateCode' should not be empty")
+	}
+
+	if len(this.regionId) == 0 {
+		this.regionId = aliyunDefaultRegionId
+	}
+
+	this.scheme = requests.HTTPS
+	this.endpoint = strings.TrimSpace(params.GetString("endpoint"))
+	if len(this.endpoint) == 0 {
+		this.endpoint = aliyunDefaultEndpoint
+	} else if strings.HasPrefix(this.endpoint, "http://") {
+		this.scheme = requests.HTTP
+		this.endpoint = strings.TrimPrefix(this.endpoint, "http://")
+	} else {
+		this.endpoint = strings.TrimPrefix(this.endpoint, "https://")
+	}
+	this.endpoint = strings.TrimRight(this.endpoint, "/")
+
+	var timeoutSeconds = params.GetInt("timeoutSeconds")
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DefaultTimeoutSeconds
+	}
+	this.timeout = time.Duration(timeoutSeconds) * time.Second
+
+	return nil
+}
+
+// MaskParams 对参数进行掩码
+func (this *AliyunGateway) MaskParams(params maps.Map) {
+	if params == nil {
+		return
+	}
+	params["accessKeySecret"] = MaskString(params.GetString("accessKeySecret"))
+}
+
+// Send 发送短信
+func (this *AliyunGateway) Send(message *Message) error {
+	var templateCode = this.templateCodes[message.Scene]
+	if len(templateCode) == 0 {
+		templateCode = this.templateCode
+	}
+	if len(templateCode) == 0 {
+		return errors.New("no template code for scene '" + message.Scene + "'")
+	}
+
+	client, err := dysmsapi.NewClientWithAccessKey(this.regionId, this.accessKeyId, this.accessKeySecret)
+	if err != nil {
+		return err
+	}
+	client.SetConnectTimeout(this.timeout)
+	client.SetReadTimeout(this.timeout)
+
+	templateParamJSON, err := json.Marshal(map[string]string{
+		"code": message.Code,
+	})
+	if err != nil {
+		return err
+	}
+
+	var req = dysmsapi.CreateSendSmsRequest()
+	req.Scheme = this.scheme
+	req.Domain = this.endpoint
+	req.PhoneNumbers = message.Mobile
+	req.SignName = this.signName
+	req.TemplateCode = templateCode
+	req.TemplateParam = string(templateParamJSON)
+
+	resp, err := client.SendSms(req)
+	if err != nil {
+		return err
+	}
+	if resp.Code != "OK" {
+		return errors.New("send failed: " + resp.Code + ": " + resp.Message)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+)
+
+const (
+	httpContentTypeJSON = "application/json"
+	httpContentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// HTTPGateway 通过自定义HTTP接口发送短信
+type HTTPGateway struct {
+	url            string
+	method         string
+	contentType    string
+	body           string
+	headers        map[string]string
+	successKeyword string
+
+	client *http.Client
+}
+
+// Init 使用参数初始化
+// 参数：
+//   - url 接口地址
+//   - method 请求方法，GET或POST，默认为POST
+//   - contentType 请求内容类型，默认为application/json
+//   - body 请求内容模板
+//   - headers 附加的请求Header
+//   - successKeyword 响应内容中包含此关键词时表示发送成功，为空时只检查状态码
+//   - timeoutSeconds 超时时间
+func (this *HTTPGateway) Init(params maps.Map) error {
+	this.url = strings.TrimSpace(params.GetString("url"))
+	if len(this.url) == 0 {
+		return errors.New("'url' should not be empty")
+	}
+	u, err := url.Parse(this.url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("invalid 'url'")
+	}
+
+	this.method = strings.ToUpper(strings.TrimSpace(params.GetString("method")))
+	if len(this.method) == 0 {
+		this.method = http.MethodPost
+	}
+	if this.method != http.MethodGet && this.method != http.MethodPost {
+		return errors.New("invalid 'method': should be 'GET' or 'POST'")
+	}
+
+	this.contentType = strings.TrimSpace(params.GetString("contentType"))
+	if len(this.contentType) == 0 {
+		this.contentType = httpContentTypeJSON
+	}
+	this.body = params.GetString("body")
+	this.successKeyword = params.GetString("successKeyword")
+
+	this.headers = map[string]string{}
+	for k, v := range params.GetMap("headers") {
+		this.headers[k] = types.String(v)
+	}
+
+	var timeoutSeconds = params.GetInt("timeoutSeconds")
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DefaultTimeoutSeconds
+	}
+	this.client = &http.Client{
+		Timeout: time.Duration(timeoutSeconds) * time.Second,
+	}
+
+	return nil
+}
+
+// MaskParams 对参数进行掩码
+func (this *HTTPGateway) MaskParams(params maps.Map) {
+	// 接口地址和请求内容中可能包含密钥，但是不好区分，这里暂时不掩码
+}
+
+// Send 发送短信
+func (this *HTTPGateway) Send(message *Message) error {
+	var vars = map[string]string{
+		"mobile":  message.Mobile,
+		"code":    message.Code,
+		"content": message.Content,
+		"scene":   message.Scene,
+	}
+
+	var reqURL = replaceVars(this.url, vars, url.QueryEscape)
+
+	var bodyReader io.Reader
+	if this.method == http.MethodPost && len(this.body) > 0 {
+		var body string
+		switch {
+		case strings.HasPrefix(this.contentType, httpContentTypeJSON):
+			body = replaceVars(this.body, vars, jsonEscape)
+		case strings.HasPrefix(this.contentType, httpContentTypeForm):
+			body = replaceVars(this.body, vars, url.QueryEscape)
+		default:
+			body = replaceVars(this.body, vars, nil)
+		}
+		bodyReader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(this.method, reqURL, bodyReader)
+	if err != nil {
+		return err
+	}
+	if bodyReader != nil {
+		req.Header.Set("Content-Type", this.contentType)
+	}
+	for k, v := range this.headers {
+		req.Header.Set(k, replaceVars(v, vars, nil))
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("invalid response status '" + strconv.Itoa(resp.StatusCode) + "': " + string(respData))
+	}
+	if len(this.successKeyword) > 0 && !strings.Contains(string(respData), this.successKeyword) {
+		return errors.New("send failed: " + string(respData))
+	}
+	return nil
+}
+
+// 替换 ${name} 形式的变量，变量值中的 ${...} 不会被再次替换
+func replaceVars(s string, vars map[string]string, escape func(string) string) string {
+	var pairs = []string{}
+	for name, value := range vars {
+		if escape != nil {
+			value = escape(value)
+		}
+		pairs = append(pairs, "${"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// 转义为JSON字符串中的内容，不包含两边的引号
+func jsonEscape(s string) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(data[1 : len(data)-1])
+}
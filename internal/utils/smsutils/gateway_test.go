@@ -0,0 +1,119 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/smsutils"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/maps"
+)
+
+func TestHTTPGateway_Send(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var lastQuery string
+	var lastBody []byte
+	var lastToken string
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.RawQuery
+		lastBody, _ = io.ReadAll(r.Body)
+		lastToken = r.Header.Get("X-Token")
+		if r.URL.Query().Get("mobile") == "13800000000" {
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"status":"error"}`))
+		}
+	}))
+	defer server.Close()
+
+	var gateway = &smsutils.HTTPGateway{}
+	a.IsNil(gateway.Init(maps.Map{
+		"url":            server.URL + "/send?mobile=${mobile}",
+		"body":           `{"content":"${content}","code":"${code}"}`,
+		"headers":        maps.Map{"X-Token": "abc"},
+		"successKeyword": `"ok"`,
+	}))
+
+	var message = &smsutils.Message{
+		Mobile:  "13800000000",
+		Scene:   smsutils.SceneVerifyMobile,
+		Code:    "123456",
+		Content: `验证码 "123456" ${code}`,
+	}
+	a.IsNil(gateway.Send(message))
+	a.IsTrue(lastQuery == "mobile=13800000000")
+	a.IsTrue(lastToken == "abc")
+
+	var body = map[string]string{}
+	a.IsNil(json.Unmarshal(lastBody, &body))
+	a.IsTrue(body["content"] == message.Content)
+	a.IsTrue(body["code"] == "123456")
+
+	// 响应中没有成功关键词
+	message.Mobile = "13900000000"
+	a.IsNotNil(gateway.Send(message))
+}
+
+func TestAliyunGateway_Send(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var lastParams = map[string]string{}
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		for k := range r.Form {
+			lastParams[k] = r.Form.Get(k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("PhoneNumbers") == "13800000000" {
+			_, _ = w.Write([]byte(`{"RequestId":"1","BizId":"2","Code":"OK","Message":"OK"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"RequestId":"1","Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"limited"}`))
+		}
+	}))
+	defer server.Close()
+
+	var gateway = &smsutils.AliyunGateway{}
+	a.IsNotNil(gateway.Init(maps.Map{"accessKeyId": "id"}))
+	a.IsNil(gateway.Init(maps.Map{
+		"accessKeyId":     "id",
+		"accessKeySecret": "secret",
+		"signName":        "GoEdge",
+		"templateCode":    "SMS_1",
+		"templateCodes":   maps.Map{smsutils.SceneResetPassword: "SMS_2"},
+		"endpoint":        server.URL,
+	}))
+
+	a.IsNil(gateway.Send(&smsutils.Message{
+		Mobile: "13800000000",
+		Scene:  smsutils.SceneResetPassword,
+		Code:   "123456",
+	}))
+	a.IsTrue(lastParams["SignName"] == "GoEdge")
+	a.IsTrue(lastParams["TemplateCode"] == "SMS_2")
+	a.IsTrue(lastParams["TemplateParam"] == `{"code":"123456"}`)
+
+	err := gateway.Send(&smsutils.Message{
+		Mobile: "13900000000",
+		Scene:  smsutils.SceneVerifyMobile,
+		Code:   "123456",
+	})
+	a.IsNotNil(err)
+	a.IsTrue(lastParams["TemplateCode"] == "SMS_1")
+	t.Log(err)
+}
+
+func TestAliyunGateway_MaskParams(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var params = maps.Map{"accessKeyId": "id", "accessKeySecret": "secret-123456"}
+	var gateway = &smsutils.AliyunGateway{}
+	gateway.MaskParams(params)
+	a.IsTrue(params.GetString("accessKeyId") == "id")
+	a.IsTrue(smsutils.IsMasked(params.GetString("accessKeySecret")))
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package smsutils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+)
+
+const DefaultLang = "zh-cn"
+
+type Scene = string
+
+const (
+	SceneVerifyMobile  Scene = "verifyMobile"  // 验证手机号
+	SceneResetPassword Scene = "resetPassword" // 重置密码
+	SceneTest          Scene = "test"          // 测试短信
+)
+
+// Template 短信内容模板，使用Go模板语法，可用变量：Code、Minutes
+type Template struct {
+	Scene   Scene  `yaml:"scene" json:"scene"`     // 场景
+	Lang    string `yaml:"lang" json:"lang"`       // 语言代号，比如 zh-cn、en-us
+	Content string `yaml:"content" json:"content"` // 内容
+}
+
+// Init 校验并初始化
+func (this *Template) Init() error {
+	this.Scene = strings.TrimSpace(this.Scene)
+	this.Lang = strings.ToLower(strings.TrimSpace(this.Lang))
+	if len(this.Scene) == 0 {
+		return errors.New("template 'scene' should not be empty")
+	}
+	if len(this.Lang) == 0 {
+		this.Lang = DefaultLang
+	}
+	if len(strings.TrimSpace(this.Content)) == 0 {
+		return errors.New("template '" + this.Scene + "' 'content' should not be empty")
+	}
+	_, err := template.New("").Parse(this.Content)
+	if err != nil {
+		return errors.New("template '" + this.Scene + "' parse content failed: " + err.Error())
+	}
+	return nil
+}
+
+// Render 生成短信内容
+func (this *Template) Render(code string, lifeSeconds int) (string, error) {
+	t, err := template.New("").Parse(this.Content)
+	if err != nil {
+		return "", err
+	}
+	var buf = &bytes.Buffer{}
+	err = t.Execute(buf, map[string]any{
+		"Code":    code,
+		"Minutes": (lifeSeconds + 59) / 60,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// 查找匹配语言的模板，优先完全匹配，然后匹配同一语种
+func matchTemplate(templates []*Template, scene Scene, lang string) *Template {
+	lang = strings.ToLower(lang)
+	var primaryLang, _, _ = strings.Cut(lang, "-")
+	var found *Template
+	for _, t := range templates {
+		if t.Scene != scene {
+			continue
+		}
+		if t.Lang == lang {
+			return t
+		}
+		if found == nil {
+			templatePrimaryLang, _, _ := strings.Cut(t.Lang, "-")
+			if templatePrimaryLang == primaryLang {
+				found = t
+			}
+		}
+	}
+	return found
+}
+
+// DefaultTemplates 系统默认模板
+func DefaultTemplates() []*Template {
+	return []*Template{
+		{
+			Scene:   SceneVerifyMobile,
+			Lang:    "zh-cn",
+			Content: "您的手机号验证码为：{{.Code}}，{{.Minutes}}分钟内有效，请勿泄露给他人。",
+		},
+		{
+			Scene:   SceneVerifyMobile,
+			Lang:    "en-us",
+			Content: "Your verification code is {{.Code}}. It expires in {{.Minutes}} minute(s). Do not share it with anyone.",
+		},
+		{
+			Scene:   SceneResetPassword,
+			Lang:    "zh-cn",
+			Content: "您正在重置密码，验证码为：{{.Code}}，{{.Minutes}}分钟内有效。如非本人操作，请忽略此短信。",
+		},
+		{
+			Scene:   SceneResetPassword,
+			Lang:    "en-us",
+			Content: "Your password reset code is {{.Code}}. It expires in {{.Minutes}} minute(s). If you did not request this, please ignore this message.",
+		},
+		{
+			Scene:   SceneTest,
+			Lang:    "zh-cn",
+			Content: "这是一条测试短信，验证码为：{{.Code}}。",
+		},
+		{
+			Scene:   SceneTest,
+			Lang:    "en-us",
+			Content: "This is a test message. Code: {{.Code}}.",
+		},
+	}
+}
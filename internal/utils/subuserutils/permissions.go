@@ -0,0 +1,309 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package subuserutils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/maps"
+)
+
+type ModuleCode = string
+
+const (
+	ModuleServers  ModuleCode = "servers"  // 网站服务
+	ModuleSSL      ModuleCode = "ssl"      // 证书
+	ModuleFirewall ModuleCode = "firewall" // WAF和IP名单
+	ModuleDNS      ModuleCode = "dns"      // 域名解析
+	ModuleStats    ModuleCode = "stats"    // 统计
+	ModuleLogs     ModuleCode = "logs"     // 访问日志
+	ModuleFinance  ModuleCode = "finance"  // 财务和套餐
+
+	ModuleAccount ModuleCode = "account" // 账号设置，只有主用户可以操作，不能授权给子用户
+)
+
+// FindAllModules 所有可以授权给子用户的模块
+func FindAllModules() []maps.Map {
+	return []maps.Map{
+		{"name": "网站服务", "code": ModuleServers, "description": "网站服务、分组、源站、缓存等设置"},
+		{"name": "证书", "code": ModuleSSL, "description": "SSL证书和证书申请"},
+		{"name": "安全防护", "code": ModuleFirewall, "description": "WAF策略和IP名单"},
+		{"name": "域名解析", "code": ModuleDNS, "description": "域名解析相关设置"},
+		{"name": "统计", "code": ModuleStats, "description": "流量、请求数和攻击统计"},
+		{"name": "访问日志", "code": ModuleLogs, "description": "查看访问日志"},
+		{"name": "财务", "code": ModuleFinance, "description": "套餐和账单"},
+	}
+}
+
+// IsValidModule 检查模块代号是否可以授权
+func IsValidModule(code ModuleCode) bool {
+	for _, module := range FindAllModules() {
+		if module.GetString("code") == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RPC服务和模块的对应关系，不在此列表中的服务子用户默认不能调用
+var serviceModuleMap = map[string]ModuleCode{
+	"ServerService":                      ModuleServers,
+	"ServerGroupService":                 ModuleServers,
+	"HTTPWebService":                     ModuleServers,
+	"HTTPLocationService":                ModuleServers,
+	"HTTPHeaderPolicyService":            ModuleServers,
+	"HTTPHeaderService":                  ModuleServers,
+	"HTTPPageService":                    ModuleServers,
+	"HTTPRewriteRuleService":             ModuleServers,
+	"HTTPGzipService":                    ModuleServers,
+	"HTTPWebsocketService":               ModuleServers,
+	"HTTPFastcgiService":                 ModuleServers,
+	"HTTPAuthPolicyService":              ModuleServers,
+	"HTTPCachePolicyService":             ModuleServers,
+	"HTTPCacheTaskService":               ModuleServers,
+	"HTTPCacheTaskKeyService":            ModuleServers,
+	"OriginService":                      ModuleServers,
+	"ReverseProxyService":                ModuleServers,
+	"SSLCertService":                     ModuleSSL,
+	"SSLPolicyService":                   ModuleSSL,
+	"ACMEUserService":                    ModuleSSL,
+	"ACMETaskService":                    ModuleSSL,
+	"ACMEProviderAccountService":         ModuleSSL,
+	"HTTPFirewallPolicyService":          ModuleFirewall,
+	"HTTPFirewallRuleGroupService":       ModuleFirewall,
+	"HTTPFirewallRuleSetService":         ModuleFirewall,
+	"IPListService":                      ModuleFirewall,
+	"IPItemService":                      ModuleFirewall,
+	"FirewallService":                    ModuleFirewall,
+	"DNSDomainService":                   ModuleDNS,
+	"DNSProviderService":                 ModuleDNS,
+	"DNSService":                         ModuleDNS,
+	"NSDNSSECService":                    ModuleDNS,
+	"ServerDailyStatService":             ModuleStats,
+	"ServerBandwidthStatService":         ModuleStats,
+	"ServerStatBoardService":             ModuleStats,
+	"ServerStatBoardChartService":        ModuleStats,
+	"ServerDomainHourlyStatService":      ModuleStats,
+	"TrafficDailyStatService":            ModuleStats,
+	"MetricStatService":                  ModuleStats,
+	"MetricChartService":                 ModuleStats,
+	"HTTPAccessLogService":               ModuleLogs,
+	"UserPlanService":                    ModuleFinance,
+	"UserBillService":                    ModuleFinance,
+	"UserOrderService":                   ModuleFinance,
+	"UserAccountService":                 ModuleFinance,
+	"UserAccountLogService":              ModuleFinance,
+	"PlanService":                        ModuleFinance,
+	"SubUserService":                     ModuleAccount,
+	"UserAccessKeyService":               ModuleAccount,
+	"LoginService":                       ModuleAccount,
+	"LoginSessionService":                ModuleAccount,
+	"UserIdentityService":                ModuleAccount,
+	"OIDCService":                        ModuleAccount,
+	"WebAuthnService":                    ModuleAccount,
+	"MessageService":                     ModuleAccount,
+	"UserService":                        ModuleAccount,
+	"ServerHTTPFirewallDailyStatService": ModuleStats,
+	"ServerHTTPFirewallEventStatService": ModuleStats,
+}
+
+// FindServiceModule 查找RPC服务所属模块
+func FindServiceModule(serviceName string) (module ModuleCode, ok bool) {
+	module, ok = serviceModuleMap[serviceName]
+	if ok {
+		return
+	}
+
+	// 各种统计服务
+	if strings.HasPrefix(serviceName, "ServerRegion") || strings.HasPrefix(serviceName, "ServerClient") {
+		if strings.HasSuffix(serviceName, "StatService") {
+			return ModuleStats, true
+		}
+	}
+	return "", false
+}
+
+// 所有子用户都可以读取的公共服务
+var commonReadServices = []string{
+	"RegionCountryService",
+	"RegionProvinceService",
+	"RegionCityService",
+	"RegionTownService",
+	"RegionProviderService",
+}
+
+// 所有子用户都可以调用的方法，优先于服务所属模块的设置
+var commonMethods = []string{
+	"APINodeService/FindAllEnabledAPINodes",
+	"APINodeService/FindCurrentAPINodeVersion",
+	"UserService/FindEnabledUser",
+	"UserService/FindUserFeatures",
+	"UserService/FindUserNodeClusterId",
+	"UserService/ComposeUserDashboard",
+	"MessageService/CountUnreadMessages",
+	"MessageService/ListUnreadMessages",
+	"LogService/CreateLog",
+	"PostService/ListPublishedPosts",
+	"PostService/CountPublishedPosts",
+	"PostService/CountUnreadPosts",
+	"PostService/ReadPost",
+	"PostCategoryService/FindAllAvailablePostCategories",
+}
+
+// 只读方法的前缀
+var readMethodPrefixes = []string{"Find", "List", "Count", "Exists", "Lookup", "Sum", "Compose"}
+
+// 虽然以只读方法的前缀开头，但会修改数据的方法前缀
+var writeMethodPrefixes = []string{"FindAndInit"}
+
+// 不以只读方法的前缀开头的只读方法
+var readMethods = []string{
+	"CheckServerNameDuplicationInNodeCluster",
+	"CheckServerNameInServer",
+	"CheckUserServersState",
+	"CheckIPItemStatus",
+	"CheckHTTPFirewallPolicyIPStatus",
+	"ExportIPItems",
+	"ExportHTTPFirewallPolicyDocument",
+	"ValidateHTTPCacheTaskKeys",
+}
+
+// IsReadMethod 判断是否为只读方法
+func IsReadMethod(methodName string) bool {
+	if lists.ContainsString(readMethods, methodName) {
+		return true
+	}
+	for _, prefix := range writeMethodPrefixes {
+		if strings.HasPrefix(methodName, prefix) {
+			return false
+		}
+	}
+	for _, prefix := range readMethodPrefixes {
+		if strings.HasPrefix(methodName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMethod 解析RPC方法，支持 /pb.ServerService/FindEnabledServer 和 ServerService/FindEnabledServer 两种格式
+func ParseMethod(fullMethod string) (serviceName string, methodName string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	var index = strings.LastIndex(fullMethod, "/")
+	if index < 0 {
+		return "", fullMethod
+	}
+	serviceName = fullMethod[:index]
+	methodName = fullMethod[index+1:]
+
+	// 去除包名
+	var dotIndex = strings.LastIndex(serviceName, ".")
+	if dotIndex >= 0 {
+		serviceName = serviceName[dotIndex+1:]
+	}
+	return
+}
+
+// ModulePermission 模块权限
+type ModulePermission struct {
+	Code       ModuleCode `yaml:"code" json:"code"`             // 模块代号
+	IsReadonly bool       `yaml:"isReadonly" json:"isReadonly"` // 是否只读
+}
+
+// ServerScope 子用户可以管理的服务范围，都为空时表示不限制
+type ServerScope struct {
+	ServerIds      []int64 `yaml:"serverIds" json:"serverIds"`           // 服务ID
+	ServerGroupIds []int64 `yaml:"serverGroupIds" json:"serverGroupIds"` // 服务分组ID
+}
+
+// IsLimited 是否有限制
+func (this *ServerScope) IsLimited() bool {
+	return this != nil && (len(this.ServerIds) > 0 || len(this.ServerGroupIds) > 0)
+}
+
+// AllowServer 检查是否可以管理某个服务
+func (this *ServerScope) AllowServer(serverId int64, serverGroupIds []int64) bool {
+	if !this.IsLimited() {
+		return true
+	}
+	if lists.ContainsInt64(this.ServerIds, serverId) {
+		return true
+	}
+	for _, groupId := range serverGroupIds {
+		if lists.ContainsInt64(this.ServerGroupIds, groupId) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowServerGroup 检查是否可以管理某个服务分组
+func (this *ServerScope) AllowServerGroup(serverGroupId int64) bool {
+	if !this.IsLimited() {
+		return true
+	}
+	return lists.ContainsInt64(this.ServerGroupIds, serverGroupId)
+}
+
+// Permissions 子用户权限
+type Permissions struct {
+	Modules     []*ModulePermission `yaml:"modules" json:"modules"`         // 可以访问的模块
+	ServerScope *ServerScope        `yaml:"serverScope" json:"serverScope"` // 服务范围
+}
+
+// Init 校验并初始化
+func (this *Permissions) Init() error {
+	var moduleCodes = []string{}
+	for _, module := range this.Modules {
+		if module == nil {
+			return errors.New("invalid module")
+		}
+		if !IsValidModule(module.Code) {
+			return errors.New("invalid module '" + module.Code + "'")
+		}
+		if lists.ContainsString(moduleCodes, module.Code) {
+			return errors.New("duplicated module '" + module.Code + "'")
+		}
+		moduleCodes = append(moduleCodes, module.Code)
+	}
+	if this.ServerScope == nil {
+		this.ServerScope = &ServerScope{}
+	}
+	return nil
+}
+
+// FindModule 查找模块权限
+func (this *Permissions) FindModule(code ModuleCode) *ModulePermission {
+	for _, module := range this.Modules {
+		if module != nil && module.Code == code {
+			return module
+		}
+	}
+	return nil
+}
+
+// AllowMethod 检查是否可以调用某个RPC方法
+func (this *Permissions) AllowMethod(fullMethod string) bool {
+	serviceName, methodName := ParseMethod(fullMethod)
+	if lists.ContainsString(commonMethods, serviceName+"/"+methodName) {
+		return true
+	}
+	var isRead = IsReadMethod(methodName)
+
+	moduleCode, ok := FindServiceModule(serviceName)
+	if !ok {
+		// 公共服务只允许读取，其他服务不允许调用
+		return isRead && lists.ContainsString(commonReadServices, serviceName)
+	}
+	if moduleCode == ModuleAccount {
+		return false
+	}
+
+	var module = this.FindModule(moduleCode)
+	if module == nil {
+		return false
+	}
+	return isRead || !module.IsReadonly
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package subuserutils_test
+
+import (
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/subuserutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+func TestParseMethod(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	serviceName, methodName := subuserutils.ParseMethod("/pb.ServerService/FindEnabledServer")
+	a.IsTrue(serviceName == "ServerService")
+	a.IsTrue(methodName == "FindEnabledServer")
+
+	serviceName, methodName = subuserutils.ParseMethod("ServerService/updateServerName")
+	a.IsTrue(serviceName == "ServerService")
+	a.IsTrue(methodName == "updateServerName")
+}
+
+func TestPermissions_AllowMethod(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var permissions = &subuserutils.Permissions{
+		Modules: []*subuserutils.ModulePermission{
+			{Code: subuserutils.ModuleServers},
+			{Code: subuserutils.ModuleStats, IsReadonly: true},
+		},
+	}
+	a.IsNil(permissions.Init())
+
+	a.IsTrue(permissions.AllowMethod("/pb.ServerService/UpdateServerName"))
+	a.IsTrue(permissions.AllowMethod("/pb.ServerDailyStatService/FindLatestServerDailyStats"))
+	a.IsTrue(permissions.AllowMethod("/pb.ServerRegionCountryMonthlyStatService/FindTopServerRegionCountryMonthlyStats"))
+	a.IsFalse(permissions.AllowMethod("/pb.ServerStatBoardService/DeleteServerStatBoard"))
+	a.IsFalse(permissions.AllowMethod("/pb.SSLCertService/FindEnabledSSLCertConfig"))
+	a.IsFalse(permissions.AllowMethod("/pb.UserBillService/FindUserBill"))
+	a.IsFalse(permissions.AllowMethod("/pb.UserOrderService/FindEnabledUserOrder"))
+
+	// 公共服务
+	a.IsTrue(permissions.AllowMethod("/pb.RegionCountryService/FindAllRegionCountries"))
+	a.IsFalse(permissions.AllowMethod("/pb.UserService/UpdateUserInfo"))
+	a.IsTrue(permissions.AllowMethod("/pb.UserService/FindEnabledUser"))
+	a.IsTrue(permissions.AllowMethod("/pb.MessageService/CountUnreadMessages"))
+	a.IsFalse(permissions.AllowMethod("/pb.MessageService/ReadAllMessages"))
+	a.IsFalse(permissions.AllowMethod("/pb.MessageService/ReadMessage"))
+	a.IsFalse(permissions.AllowMethod("/pb.NodeService/FindEnabledNode"))
+	a.IsTrue(permissions.AllowMethod("/pb.PostService/ReadPost"))
+	a.IsFalse(permissions.AllowMethod("/pb.PostService/DeletePost"))
+
+	// 账号设置
+	a.IsFalse(permissions.AllowMethod("/pb.SubUserService/ListSubUsers"))
+	a.IsFalse(permissions.AllowMethod("/pb.UserAccessKeyService/CreateUserAccessKey"))
+
+	a.IsNotNil((&subuserutils.Permissions{Modules: []*subuserutils.ModulePermission{{Code: subuserutils.ModuleAccount}}}).Init())
+}
+
+func TestIsReadMethod(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsTrue(subuserutils.IsReadMethod("FindEnabledServer"))
+	a.IsTrue(subuserutils.IsReadMethod("CheckUserServersState"))
+	a.IsFalse(subuserutils.IsReadMethod("FindAndInitServerWebConfig"))
+	a.IsFalse(subuserutils.IsReadMethod("ReadAllMessages"))
+	a.IsFalse(subuserutils.IsReadMethod("CheckUserEmail"))
+	a.IsFalse(subuserutils.IsReadMethod("ValidateUserNode"))
+}
+
+func TestServerScope_AllowServer(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var emptyScope = &subuserutils.ServerScope{}
+	a.IsTrue(emptyScope.AllowServer(1, nil))
+	a.IsTrue(emptyScope.AllowServerGroup(1))
+
+	var scope = &subuserutils.ServerScope{
+		ServerIds:      []int64{1, 2},
+		ServerGroupIds: []int64{10},
+	}
+	a.IsTrue(scope.AllowServer(1, nil))
+	a.IsTrue(scope.AllowServer(3, []int64{10}))
+	a.IsFalse(scope.AllowServer(3, []int64{11}))
+	a.IsTrue(scope.AllowServerGroup(10))
+	a.IsFalse(scope.AllowServerGroup(11))
+}
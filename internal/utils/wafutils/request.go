@@ -0,0 +1,188 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package wafutils
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request 从访问日志中还原的请求
+type Request struct {
+	RequestId     string
+	ServerId      int64
+	CreatedAt     int64
+	Method        string
+	Scheme        string
+	Proto         string
+	Host          string
+	URI           string // 包含查询参数的URI
+	Path          string
+	RemoteAddr    string
+	RawRemoteAddr string
+	UserAgent     string
+	Referer       string
+	ContentType   string
+	Length        int64
+	Header        http.Header
+	Body          []byte
+
+	Country  string
+	Province string
+	City     string
+	Provider string
+
+	args    url.Values
+	cookies map[string]string
+}
+
+// URL 完整的URL
+func (this *Request) URL() string {
+	var scheme = this.Scheme
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	return scheme + "://" + this.Host + this.URI
+}
+
+// ParamValue 读取检查点对应的值
+// 不支持的检查点（比如需要统计或者上下文状态的检查点）返回 ok=false
+func (this *Request) ParamValue(param string) (value string, ok bool) {
+	prefix, key, ok := ParseParam(param)
+	if !ok {
+		return "", false
+	}
+
+	switch prefix {
+	case "requestURI":
+		return this.URI, true
+	case "requestPath":
+		return this.Path, true
+	case "requestMethod":
+		return this.Method, true
+	case "requestScheme":
+		return this.Scheme, true
+	case "requestProto":
+		return this.Proto, true
+	case "requestHost", "host":
+		return this.Host, true
+	case "remoteAddr", "requestRealIP":
+		return this.RemoteAddr, true
+	case "rawRemoteAddr":
+		if len(this.RawRemoteAddr) > 0 {
+			return this.RawRemoteAddr, true
+		}
+		return this.RemoteAddr, true
+	case "userAgent", "requestUserAgent":
+		return this.UserAgent, true
+	case "referer", "requestReferer":
+		return this.Referer, true
+	case "contentType", "requestContentType":
+		return this.ContentType, true
+	case "requestLength":
+		return strconv.FormatInt(this.Length, 10), true
+	case "requestBody":
+		return string(this.Body), true
+	case "requestAll":
+		return this.URI + "\n" + string(this.Body), true
+	case "args":
+		var index = strings.Index(this.URI, "?")
+		if index < 0 {
+			return "", true
+		}
+		return this.URI[index+1:], true
+	case "arg":
+		return strings.Join(this.queryArgs()[key], ","), true
+	case "cookies", "cookie":
+		if prefix == "cookies" || len(key) == 0 {
+			return this.Header.Get("Cookie"), true
+		}
+		return this.cookieMap()[key], true
+	case "headers":
+		return this.composeHeaders(), true
+	case "headerNames":
+		var names = []string{}
+		for name := range this.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, "\n"), true
+	case "requestHeader", "header":
+		if len(key) == 0 {
+			return this.composeHeaders(), true
+		}
+		return strings.Join(this.Header.Values(key), ";"), true
+	case "requestGeoCountryName":
+		return this.Country, true
+	case "requestGeoProvinceName":
+		return this.Province, true
+	case "requestGeoCityName":
+		return this.City, true
+	case "requestISPName":
+		return this.Provider, true
+	}
+
+	return "", false
+}
+
+func (this *Request) queryArgs() url.Values {
+	if this.args != nil {
+		return this.args
+	}
+	this.args = url.Values{}
+	var index = strings.Index(this.URI, "?")
+	if index >= 0 {
+		args, err := url.ParseQuery(this.URI[index+1:])
+		if err == nil {
+			this.args = args
+		}
+	}
+	return this.args
+}
+
+func (this *Request) cookieMap() map[string]string {
+	if this.cookies != nil {
+		return this.cookies
+	}
+	this.cookies = map[string]string{}
+	var req = &http.Request{Header: http.Header{"Cookie": this.Header.Values("Cookie")}}
+	for _, cookie := range req.Cookies() {
+		this.cookies[cookie.Name] = cookie.Value
+	}
+	return this.cookies
+}
+
+func (this *Request) composeHeaders() string {
+	var names = []string{}
+	for name := range this.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines = []string{}
+	for _, name := range names {
+		for _, value := range this.Header[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseParam 解析 ${prefix.key} 形式的检查点
+func ParseParam(param string) (prefix string, key string, ok bool) {
+	if !strings.HasPrefix(param, "${") || !strings.HasSuffix(param, "}") {
+		return "", "", false
+	}
+	var name = param[2 : len(param)-1]
+	if len(name) == 0 {
+		return "", "", false
+	}
+	var index = strings.Index(name, ".")
+	if index < 0 {
+		return name, "", true
+	}
+	return name[:index], name[index+1:], true
+}
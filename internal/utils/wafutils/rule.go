@@ -0,0 +1,381 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package wafutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule 用于模拟的规则
+// 和边缘节点中的规则相比，这里只支持可以从访问日志中还原的检查点，以及不依赖外部库的操作符
+type Rule struct {
+	Id                int64
+	Param             string
+	Filters           []string // 参数过滤器代号
+	Operator          string
+	Value             string
+	IsCaseInsensitive bool
+
+	isSupported bool
+	reg         *regexp.Regexp
+	values      []string
+	ipFrom      net.IP
+	ipTo        net.IP
+	ipNet       *net.IPNet
+}
+
+// Init 初始化
+func (this *Rule) Init() error {
+	this.isSupported = false
+
+	var value = this.Value
+	if this.IsCaseInsensitive {
+		value = strings.ToLower(value)
+	}
+
+	switch this.Operator {
+	case "match", "not match":
+		var expr = this.Value
+		if this.IsCaseInsensitive && !strings.HasPrefix(expr, "(?i)") {
+			expr = "(?i)" + expr
+		}
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return errors.New("invalid regexp '" + this.Value + "': " + err.Error())
+		}
+		this.reg = reg
+	case "wildcard match", "wildcard not match":
+		var expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(this.Value), `\*`, ".*") + "$"
+		if this.IsCaseInsensitive {
+			expr = "(?i)" + expr
+		}
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		this.reg = reg
+	case "contains any", "contains all", "contains any word", "contains all words", "not contains any word", "in ip list":
+		this.values = []string{}
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) > 0 {
+				this.values = append(this.values, line)
+			}
+		}
+	case "contains binary", "not contains binary":
+		data, err := base64.StdEncoding.DecodeString(this.Value)
+		if err != nil {
+			return errors.New("invalid binary value: " + err.Error())
+		}
+		this.values = []string{string(data)}
+	case "eq ip", "gt ip", "gte ip", "lt ip", "lte ip":
+		this.ipFrom = net.ParseIP(this.Value)
+		if this.ipFrom == nil {
+			return errors.New("invalid ip '" + this.Value + "'")
+		}
+	case "ip range", "not ip range":
+		if strings.Contains(this.Value, "/") {
+			_, ipNet, err := net.ParseCIDR(this.Value)
+			if err != nil {
+				return err
+			}
+			this.ipNet = ipNet
+		} else {
+			var pieces = strings.FieldsFunc(this.Value, func(r rune) bool {
+				return r == ',' || r == '-'
+			})
+			if len(pieces) != 2 {
+				return errors.New("invalid ip range '" + this.Value + "'")
+			}
+			this.ipFrom = net.ParseIP(strings.TrimSpace(pieces[0]))
+			this.ipTo = net.ParseIP(strings.TrimSpace(pieces[1]))
+			if this.ipFrom == nil || this.ipTo == nil {
+				return errors.New("invalid ip range '" + this.Value + "'")
+			}
+		}
+	case "gt", "gte", "lt", "lte", "eq", "neq",
+		"eq string", "neq string", "contains", "not contains", "prefix", "suffix",
+		"version gt", "version lt", "version range":
+	default:
+		// 比如 contains sql injection、contains xss 等需要边缘节点上的检测库
+		return nil
+	}
+
+	_, _, ok := ParseParam(this.Param)
+	if !ok {
+		return nil
+	}
+	var req = &Request{}
+	_, ok = req.ParamValue(this.Param)
+	if !ok {
+		return nil
+	}
+	for _, filter := range this.Filters {
+		if !isSupportedFilter(filter) {
+			return nil
+		}
+	}
+
+	this.isSupported = true
+	return nil
+}
+
+// IsSupported 是否支持模拟
+func (this *Rule) IsSupported() bool {
+	return this.isSupported
+}
+
+// Summary 规则描述
+func (this *Rule) Summary() string {
+	var summary = this.Param
+	if len(this.Filters) > 0 {
+		summary += " | " + strings.Join(this.Filters, " | ")
+	}
+	summary += " " + this.Operator + " " + strconv.Quote(this.Value)
+	if this.IsCaseInsensitive {
+		summary += " (case insensitive)"
+	}
+	return summary
+}
+
+// Match 检查请求是否匹配规则
+func (this *Rule) Match(req *Request) bool {
+	if !this.isSupported {
+		return false
+	}
+
+	value, ok := req.ParamValue(this.Param)
+	if !ok {
+		return false
+	}
+	for _, filter := range this.Filters {
+		value = applyFilter(filter, value)
+	}
+
+	var ruleValue = this.Value
+	var compareValue = value
+	if this.IsCaseInsensitive {
+		ruleValue = strings.ToLower(ruleValue)
+		compareValue = strings.ToLower(compareValue)
+	}
+
+	switch this.Operator {
+	case "gt":
+		return parseFloat(value) > parseFloat(this.Value)
+	case "gte":
+		return parseFloat(value) >= parseFloat(this.Value)
+	case "lt":
+		return parseFloat(value) < parseFloat(this.Value)
+	case "lte":
+		return parseFloat(value) <= parseFloat(this.Value)
+	case "eq":
+		return parseFloat(value) == parseFloat(this.Value)
+	case "neq":
+		return parseFloat(value) != parseFloat(this.Value)
+	case "eq string":
+		return compareValue == ruleValue
+	case "neq string":
+		return compareValue != ruleValue
+	case "match", "wildcard match":
+		return this.reg.MatchString(value)
+	case "not match", "wildcard not match":
+		return !this.reg.MatchString(value)
+	case "contains":
+		return strings.Contains(compareValue, ruleValue)
+	case "not contains":
+		return !strings.Contains(compareValue, ruleValue)
+	case "prefix":
+		return strings.HasPrefix(compareValue, ruleValue)
+	case "suffix":
+		return strings.HasSuffix(compareValue, ruleValue)
+	case "contains any":
+		for _, v := range this.values {
+			if strings.Contains(compareValue, v) {
+				return true
+			}
+		}
+		return false
+	case "contains all":
+		for _, v := range this.values {
+			if !strings.Contains(compareValue, v) {
+				return false
+			}
+		}
+		return len(this.values) > 0
+	case "contains any word", "not contains any word":
+		var found = false
+		for _, v := range this.values {
+			if containsWord(compareValue, v) {
+				found = true
+				break
+			}
+		}
+		if this.Operator == "not contains any word" {
+			return !found
+		}
+		return found
+	case "contains all words":
+		for _, v := range this.values {
+			if !containsWord(compareValue, v) {
+				return false
+			}
+		}
+		return len(this.values) > 0
+	case "contains binary":
+		return bytes.Contains([]byte(value), []byte(this.values[0]))
+	case "not contains binary":
+		return !bytes.Contains([]byte(value), []byte(this.values[0]))
+	case "in ip list":
+		for _, v := range this.values {
+			if v == compareValue {
+				return true
+			}
+		}
+		return false
+	case "eq ip", "gt ip", "gte ip", "lt ip", "lte ip":
+		var ip = net.ParseIP(value)
+		if ip == nil {
+			return false
+		}
+		var result = compareIP(ip, this.ipFrom)
+		switch this.Operator {
+		case "eq ip":
+			return result == 0
+		case "gt ip":
+			return result > 0
+		case "gte ip":
+			return result >= 0
+		case "lt ip":
+			return result < 0
+		default:
+			return result <= 0
+		}
+	case "ip range", "not ip range":
+		var ip = net.ParseIP(value)
+		if ip == nil {
+			return this.Operator == "not ip range"
+		}
+		var inRange bool
+		if this.ipNet != nil {
+			inRange = this.ipNet.Contains(ip)
+		} else {
+			inRange = compareIP(ip, this.ipFrom) >= 0 && compareIP(ip, this.ipTo) <= 0
+		}
+		if this.Operator == "not ip range" {
+			return !inRange
+		}
+		return inRange
+	case "version gt":
+		return compareVersion(value, this.Value) > 0
+	case "version lt":
+		return compareVersion(value, this.Value) < 0
+	case "version range":
+		var pieces = strings.SplitN(this.Value, ",", 2)
+		if len(pieces) != 2 {
+			return false
+		}
+		return compareVersion(value, strings.TrimSpace(pieces[0])) >= 0 && compareVersion(value, strings.TrimSpace(pieces[1])) <= 0
+	}
+
+	return false
+}
+
+func isSupportedFilter(filter string) bool {
+	switch filter {
+	case "urlDecode", "urlEncode", "base64Decode", "base64Encode", "length", "trim", "toLowerCase", "toUpperCase":
+		return true
+	}
+	return false
+}
+
+func applyFilter(filter string, value string) string {
+	switch filter {
+	case "urlDecode":
+		decoded, err := url.QueryUnescape(value)
+		if err == nil {
+			return decoded
+		}
+	case "urlEncode":
+		return url.QueryEscape(value)
+	case "base64Decode":
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err == nil {
+			return string(decoded)
+		}
+	case "base64Encode":
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	case "length":
+		return strconv.Itoa(len(value))
+	case "trim":
+		return strings.TrimSpace(value)
+	case "toLowerCase":
+		return strings.ToLower(value)
+	case "toUpperCase":
+		return strings.ToUpper(value)
+	}
+	return value
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return f
+}
+
+func containsWord(value string, word string) bool {
+	for {
+		var index = strings.Index(value, word)
+		if index < 0 {
+			return false
+		}
+		var end = index + len(word)
+		if (index == 0 || !isWordByte(value[index-1])) && (end == len(value) || !isWordByte(value[end])) {
+			return true
+		}
+		value = value[index+1:]
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func compareIP(ip1 net.IP, ip2 net.IP) int {
+	if ip4 := ip1.To4(); ip4 != nil {
+		ip1 = ip4
+	}
+	if ip4 := ip2.To4(); ip4 != nil {
+		ip2 = ip4
+	}
+	if len(ip1) != len(ip2) {
+		return len(ip1) - len(ip2)
+	}
+	return bytes.Compare(ip1, ip2)
+}
+
+func compareVersion(version1 string, version2 string) int {
+	var pieces1 = strings.Split(strings.TrimSpace(version1), ".")
+	var pieces2 = strings.Split(strings.TrimSpace(version2), ".")
+	for i := 0; i < len(pieces1) || i < len(pieces2); i++ {
+		var v1, v2 int64
+		if i < len(pieces1) {
+			v1, _ = strconv.ParseInt(pieces1[i], 10, 64)
+		}
+		if i < len(pieces2) {
+			v2, _ = strconv.ParseInt(pieces2[i], 10, 64)
+		}
+		if v1 != v2 {
+			if v1 > v2 {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package wafutils
+
+// 会终止后续规则检查的动作
+var finalActionCodes = map[string]bool{
+	"block":     true,
+	"captcha":   true,
+	"js_cookie": true,
+	"page":      true,
+	"get_302":   true,
+	"post_307":  true,
+	"redirect":  true,
+	"allow":     true,
+}
+
+// RuleSet 用于模拟的规则集
+type RuleSet struct {
+	Id          int64
+	Name        string
+	GroupId     int64
+	GroupName   string
+	Connector   string // and|or
+	Rules       []*Rule
+	ActionCodes []string
+}
+
+// Init 初始化
+func (this *RuleSet) Init() error {
+	for _, rule := range this.Rules {
+		err := rule.Init()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnsupportedRules 无法模拟的规则
+func (this *RuleSet) UnsupportedRules() []*Rule {
+	var result = []*Rule{}
+	for _, rule := range this.Rules {
+		if !rule.IsSupported() {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// Match 检查请求是否匹配规则集，返回匹配的规则
+// 使用 and 连接时，包含不支持的规则的规则集永远不会匹配
+func (this *RuleSet) Match(req *Request) (matchedRules []*Rule, ok bool) {
+	if len(this.Rules) == 0 {
+		return nil, false
+	}
+
+	if this.Connector == "and" {
+		for _, rule := range this.Rules {
+			if !rule.Match(req) {
+				return nil, false
+			}
+		}
+		return this.Rules, true
+	}
+
+	for _, rule := range this.Rules {
+		if rule.Match(req) {
+			return []*Rule{rule}, true
+		}
+	}
+	return nil, false
+}
+
+// IsFinal 匹配后是否终止后续规则集的检查
+func (this *RuleSet) IsFinal() bool {
+	for _, code := range this.ActionCodes {
+		if finalActionCodes[code] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocking 匹配后请求是否会被拦截
+func (this *RuleSet) IsBlocking() bool {
+	for _, code := range this.ActionCodes {
+		if code == "allow" {
+			return false
+		}
+		if finalActionCodes[code] {
+			return true
+		}
+	}
+	return false
+}
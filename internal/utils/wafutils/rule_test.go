@@ -0,0 +1,105 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package wafutils_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/wafutils"
+)
+
+func TestRule_Match(t *testing.T) {
+	var req = &wafutils.Request{
+		Method:     http.MethodGet,
+		Host:       "example.com",
+		URI:        "/search?q=union+select&page=2",
+		Path:       "/search",
+		RemoteAddr: "192.168.1.100",
+		UserAgent:  "curl/8.0.1",
+		Header: http.Header{
+			"Cookie":     []string{"sid=abc; lang=zh"},
+			"User-Agent": []string{"curl/8.0.1"},
+		},
+		Country: "中国",
+	}
+
+	for _, testCase := range []struct {
+		rule    *wafutils.Rule
+		matched bool
+	}{
+		{&wafutils.Rule{Param: "${requestPath}", Operator: "eq string", Value: "/search"}, true},
+		{&wafutils.Rule{Param: "${requestPath}", Operator: "prefix", Value: "/SEA", IsCaseInsensitive: true}, true},
+		{&wafutils.Rule{Param: "${arg.q}", Operator: "match", Value: `union\s+select`}, true},
+		{&wafutils.Rule{Param: "${arg.page}", Operator: "gt", Value: "1"}, true},
+		{&wafutils.Rule{Param: "${arg.page}", Operator: "gt", Value: "2"}, false},
+		{&wafutils.Rule{Param: "${userAgent}", Operator: "contains any", Value: "python\ncurl"}, true},
+		{&wafutils.Rule{Param: "${userAgent}", Operator: "version gt", Value: "7"}, false},
+		{&wafutils.Rule{Param: "${cookie.sid}", Operator: "eq string", Value: "abc"}, true},
+		{&wafutils.Rule{Param: "${requestHeader.User-Agent}", Operator: "wildcard match", Value: "curl/*"}, true},
+		{&wafutils.Rule{Param: "${remoteAddr}", Operator: "ip range", Value: "192.168.1.0/24"}, true},
+		{&wafutils.Rule{Param: "${remoteAddr}", Operator: "ip range", Value: "192.168.2.1-192.168.2.255"}, false},
+		{&wafutils.Rule{Param: "${remoteAddr}", Operator: "gt ip", Value: "192.168.1.99"}, true},
+		{&wafutils.Rule{Param: "${requestGeoCountryName}", Operator: "eq string", Value: "中国"}, true},
+		{&wafutils.Rule{Param: "${requestURI}", Operator: "contains words", Value: "select"}, false},
+		{&wafutils.Rule{Param: "${requestURI}", Operator: "contains any word", Value: "sel"}, false},
+		{&wafutils.Rule{Param: "${arg.q}", Operator: "contains any word", Value: "select"}, true},
+		{&wafutils.Rule{Param: "${requestURI}", Operator: "contains sql injection"}, false},
+		{&wafutils.Rule{Param: "${cc2}", Operator: "gt", Value: "10"}, false},
+	} {
+		err := testCase.rule.Init()
+		if err != nil {
+			t.Fatal(testCase.rule.Summary(), err)
+		}
+		if testCase.rule.Match(req) != testCase.matched {
+			t.Fatal(testCase.rule.Summary(), "expected:", testCase.matched)
+		}
+	}
+}
+
+func TestRuleSet_Match(t *testing.T) {
+	var req = &wafutils.Request{
+		URI:  "/admin/login.php",
+		Path: "/admin/login.php",
+	}
+
+	var set = &wafutils.RuleSet{
+		Connector: "and",
+		Rules: []*wafutils.Rule{
+			{Param: "${requestPath}", Operator: "prefix", Value: "/admin"},
+			{Param: "${requestPath}", Operator: "suffix", Value: ".php"},
+		},
+		ActionCodes: []string{"tag", "block"},
+	}
+	err := set.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchedRules, ok := set.Match(req)
+	if !ok || len(matchedRules) != 2 {
+		t.Fatal("should match")
+	}
+	if !set.IsFinal() || !set.IsBlocking() {
+		t.Fatal("should be final and blocking")
+	}
+
+	// 包含不支持的规则
+	set.Rules = append(set.Rules, &wafutils.Rule{Param: "${requestURI}", Operator: "contains xss"})
+	err = set.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.UnsupportedRules()) != 1 {
+		t.Fatal("should have one unsupported rule")
+	}
+	_, ok = set.Match(req)
+	if ok {
+		t.Fatal("should not match")
+	}
+
+	set.Connector = "or"
+	matchedRules, ok = set.Match(req)
+	if !ok || len(matchedRules) != 1 {
+		t.Fatal("should match first rule")
+	}
+}
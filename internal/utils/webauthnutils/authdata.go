@@ -0,0 +1,82 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 认证器数据标志位
+const (
+	FlagUserPresent     byte = 0x01 // UP
+	FlagUserVerified    byte = 0x04 // UV
+	FlagBackupEligible  byte = 0x08 // BE
+	FlagBackupState     byte = 0x10 // BS
+	FlagAttestedData    byte = 0x40 // AT
+	FlagExtensionData   byte = 0x80 // ED
+	maxCredentialIdSize      = 1023
+)
+
+// AuthenticatorData 认证器数据
+type AuthenticatorData struct {
+	RPIdHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialId []byte
+	PublicKey    []byte // COSE格式的公钥原始数据
+}
+
+// HasFlag 检查标志位
+func (this *AuthenticatorData) HasFlag(flag byte) bool {
+	return this.Flags&flag == flag
+}
+
+// ParseAuthenticatorData 解析认证器数据
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	var authData = &AuthenticatorData{
+		RPIdHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	var rest = data[37:]
+
+	if authData.HasFlag(FlagAttestedData) {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		authData.AAGUID = rest[:16]
+		var idSize = int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idSize == 0 || idSize > maxCredentialIdSize || idSize > len(rest) {
+			return nil, errors.New("invalid credential id")
+		}
+		authData.CredentialId = rest[:idSize]
+		rest = rest[idSize:]
+
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.New("invalid credential public key: " + err.Error())
+		}
+		authData.PublicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.HasFlag(FlagExtensionData) {
+		_, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.New("invalid extension data: " + err.Error())
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) > 0 {
+		return nil, errors.New("unexpected data after authenticator data")
+	}
+	return authData, nil
+}
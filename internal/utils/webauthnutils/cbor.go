@@ -0,0 +1,169 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 这里只实现了WebAuthn需要用到的CBOR解码子集（RFC 8949）
+
+const (
+	cborUnsigned  = 0
+	cborNegative  = 1
+	cborBytes     = 2
+	cborText      = 3
+	cborArray     = 4
+	cborMap       = 5
+	cborTag       = 6
+	cborSimple    = 7
+	maxCBORDepth  = 16
+	maxCBORLength = 1 << 20
+)
+
+var errInvalidCBOR = errors.New("invalid cbor data")
+
+// 解码单个CBOR值，返回值和剩余的数据
+// 整数解码为int64，字节串解码为[]byte，文本解码为string，数组解码为[]any，映射解码为map[any]any
+func decodeCBOR(data []byte) (value any, rest []byte, err error) {
+	return decodeCBORValue(data, 0)
+}
+
+func decodeCBORValue(data []byte, depth int) (value any, rest []byte, err error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("cbor data nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errInvalidCBOR
+	}
+
+	var major = data[0] >> 5
+	var info = data[0] & 0x1f
+	data = data[1:]
+
+	// 简单值
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, errors.New("unsupported cbor simple value")
+	}
+
+	argument, data, err := readCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if argument > 1<<63-1 {
+			return nil, nil, errInvalidCBOR
+		}
+		return int64(argument), data, nil
+	case cborNegative:
+		if argument > 1<<63-1 {
+			return nil, nil, errInvalidCBOR
+		}
+		return -1 - int64(argument), data, nil
+	case cborBytes, cborText:
+		if argument > maxCBORLength || argument > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		var b = data[:argument]
+		if major == cborText {
+			return string(b), data[argument:], nil
+		}
+		return append([]byte{}, b...), data[argument:], nil
+	case cborArray:
+		if argument > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		var result = make([]any, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			var item any
+			item, data, err = decodeCBORValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			result = append(result, item)
+		}
+		return result, data, nil
+	case cborMap:
+		if argument > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		var result = map[any]any{}
+		for i := uint64(0); i < argument; i++ {
+			var key, item any
+			key, data, err = decodeCBORValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("unsupported cbor map key")
+			}
+			item, data, err = decodeCBORValue(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := result[key]; ok {
+				return nil, nil, errors.New("duplicate cbor map key")
+			}
+			result[key] = item
+		}
+		return result, data, nil
+	case cborTag:
+		// 忽略标签，只读取内容
+		return decodeCBORValue(data, depth+1)
+	}
+	return nil, nil, errInvalidCBOR
+}
+
+func readCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errInvalidCBOR
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errInvalidCBOR
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errInvalidCBOR
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errInvalidCBOR
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+
+	// 不支持不定长编码
+	return 0, nil, errInvalidCBOR
+}
+
+// 从映射中读取值
+func cborMapInt(m map[any]any, key any) (int64, bool) {
+	v, ok := m[key].(int64)
+	return v, ok
+}
+
+func cborMapBytes(m map[any]any, key any) ([]byte, bool) {
+	v, ok := m[key].([]byte)
+	return v, ok
+}
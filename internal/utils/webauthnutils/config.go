@@ -0,0 +1,113 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+type UserVerification = string
+
+const (
+	UserVerificationRequired    UserVerification = "required"
+	UserVerificationPreferred   UserVerification = "preferred"
+	UserVerificationDiscouraged UserVerification = "discouraged"
+)
+
+const (
+	DefaultTimeoutSeconds = 300
+	ChallengeLifeSeconds  = 300 // 认证流程的有效期
+	RecoveryCodeCount     = 10  // 每次生成的恢复码数量
+)
+
+// Config 第二认证因素设置
+type Config struct {
+	IsOn             bool             `yaml:"isOn" json:"isOn"`                         // 是否启用WebAuthn
+	RPId             string           `yaml:"rpId" json:"rpId"`                         // 依赖方ID，通常为管理平台和用户平台共同的域名
+	RPName           string           `yaml:"rpName" json:"rpName"`                     // 依赖方名称
+	Origins          []string         `yaml:"origins" json:"origins"`                   // 允许的来源，比如 https://admin.example.com
+	UserVerification UserVerification `yaml:"userVerification" json:"userVerification"` // 用户验证要求
+	TimeoutSeconds   int              `yaml:"timeoutSeconds" json:"timeoutSeconds"`     // 浏览器等待用户操作的超时时间
+
+	RequireForAdmins bool `yaml:"requireForAdmins" json:"requireForAdmins"` // 是否要求所有管理员使用第二认证因素（OTP或WebAuthn）
+	RequireForUsers  bool `yaml:"requireForUsers" json:"requireForUsers"`   // 是否要求所有用户使用第二认证因素（OTP或WebAuthn）
+}
+
+// DefaultConfig 默认设置
+func DefaultConfig() *Config {
+	return &Config{
+		RPName:           "GoEdge",
+		UserVerification: UserVerificationPreferred,
+		TimeoutSeconds:   DefaultTimeoutSeconds,
+	}
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	this.RPId = strings.ToLower(strings.TrimSpace(this.RPId))
+	if len(this.RPName) == 0 {
+		this.RPName = this.RPId
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+
+	switch this.UserVerification {
+	case "":
+		this.UserVerification = UserVerificationPreferred
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	default:
+		return errors.New("invalid 'userVerification': '" + this.UserVerification + "'")
+	}
+
+	var origins = []string{}
+	for _, origin := range this.Origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if len(origin) > 0 {
+			origins = append(origins, origin)
+		}
+	}
+	this.Origins = origins
+
+	if !this.IsOn {
+		return nil
+	}
+
+	if len(this.RPId) == 0 {
+		return errors.New("'rpId' should not be empty")
+	}
+	if len(this.Origins) == 0 {
+		return errors.New("'origins' should not be empty")
+	}
+	for _, origin := range this.Origins {
+		u, err := url.Parse(origin)
+		if err != nil || len(u.Host) == 0 || (len(u.Path) > 0 && u.Path != "/") {
+			return errors.New("invalid origin '" + origin + "'")
+		}
+
+		// 浏览器只允许在localhost上使用http
+		var hostname = strings.ToLower(u.Hostname())
+		if u.Scheme != "https" && !(u.Scheme == "http" && hostname == "localhost") {
+			return errors.New("invalid origin '" + origin + "': scheme should be 'https'")
+		}
+
+		// 来源的域名需要和RPId相同或者是RPId的子域名
+		if hostname != this.RPId && !strings.HasSuffix(hostname, "."+this.RPId) {
+			return errors.New("invalid origin '" + origin + "': host does not match rpId '" + this.RPId + "'")
+		}
+	}
+
+	return nil
+}
+
+// AllowOrigin 检查来源是否允许
+func (this *Config) AllowOrigin(origin string) bool {
+	for _, allowedOrigin := range this.Origins {
+		if strings.EqualFold(allowedOrigin, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+	"strconv"
+)
+
+// COSE算法（RFC 8152）
+const (
+	AlgES256 int64 = -7
+	AlgES384 int64 = -35
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms 支持的算法，按照优先级排列
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgES384, AlgRS256}
+
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveP384    = 2
+	coseCurveEd25519 = 6
+)
+
+// PublicKey 凭证公钥
+type PublicKey struct {
+	Algorithm int64
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey 解析COSE格式的公钥
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("unexpected data after public key")
+	}
+	m, ok := value.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid public key")
+	}
+	return parsePublicKeyMap(m)
+}
+
+func parsePublicKeyMap(m map[any]any) (*PublicKey, error) {
+	keyType, _ := cborMapInt(m, int64(1))
+	alg, ok := cborMapInt(m, int64(3))
+	if !ok {
+		return nil, errors.New("public key algorithm is missing")
+	}
+
+	switch keyType {
+	case coseKeyTypeEC2:
+		crv, _ := cborMapInt(m, int64(-1))
+		x, _ := cborMapBytes(m, int64(-2))
+		y, _ := cborMapBytes(m, int64(-3))
+
+		var curve elliptic.Curve
+		switch {
+		case crv == coseCurveP256 && alg == AlgES256:
+			curve = elliptic.P256()
+		case crv == coseCurveP384 && alg == AlgES384:
+			curve = elliptic.P384()
+		default:
+			return nil, errors.New("unsupported ec2 curve '" + strconv.FormatInt(crv, 10) + "' with algorithm '" + strconv.FormatInt(alg, 10) + "'")
+		}
+		var size = (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec2 public key")
+		}
+		var key = &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid ec2 public key: point is not on curve")
+		}
+		return &PublicKey{Algorithm: alg, key: key}, nil
+	case coseKeyTypeOKP:
+		crv, _ := cborMapInt(m, int64(-1))
+		x, _ := cborMapBytes(m, int64(-2))
+		if crv != coseCurveEd25519 || alg != AlgEdDSA || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported okp public key")
+		}
+		return &PublicKey{Algorithm: alg, key: ed25519.PublicKey(x)}, nil
+	case coseKeyTypeRSA:
+		n, _ := cborMapBytes(m, int64(-1))
+		e, _ := cborMapBytes(m, int64(-2))
+		if alg != AlgRS256 || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("unsupported rsa public key")
+		}
+		var exponent = 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &PublicKey{Algorithm: alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: exponent,
+		}}, nil
+	}
+	return nil, errors.New("unsupported key type '" + strconv.FormatInt(keyType, 10) + "'")
+}
+
+// Verify 校验签名
+func (this *PublicKey) Verify(data []byte, signature []byte) error {
+	var ok bool
+	switch key := this.key.(type) {
+	case *ecdsa.PublicKey:
+		if this.Algorithm == AlgES384 {
+			var sum = sha512.Sum384(data)
+			ok = ecdsa.VerifyASN1(key, sum[:], signature)
+		} else {
+			var sum = sha256.Sum256(data)
+			ok = ecdsa.VerifyASN1(key, sum[:], signature)
+		}
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		var sum = sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature) == nil
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// 去掉了容易混淆的字符
+const recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// GenerateRecoveryCodes 生成恢复码，返回明文和对应的哈希值，明文只显示一次，只保存哈希值
+func GenerateRecoveryCodes(count int) (codes []string, hashes []string, err error) {
+	// 丢弃超出字母表整数倍的随机数，避免取模造成的分布不均
+	var limit = 256 - 256%len(recoveryCodeAlphabet)
+	var b = make([]byte, 1)
+	for i := 0; i < count; i++ {
+		var builder strings.Builder
+		for builder.Len() < 11 {
+			if builder.Len() == 5 {
+				builder.WriteByte('-')
+				continue
+			}
+			_, err = rand.Read(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			if int(b[0]) >= limit {
+				continue
+			}
+			builder.WriteByte(recoveryCodeAlphabet[int(b[0])%len(recoveryCodeAlphabet)])
+		}
+		var code = builder.String()
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return
+}
+
+// HashRecoveryCode 计算恢复码的哈希值，忽略大小写、空格和连接符
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	var sum = sha256.Sum256([]byte("recovery:" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchRecoveryCode 查找恢复码对应的哈希值位置，找不到时返回-1
+func MatchRecoveryCode(hashes []string, code string) int {
+	var hash = HashRecoveryCode(code)
+	var result = -1
+	for index, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			result = index
+		}
+	}
+	return result
+}
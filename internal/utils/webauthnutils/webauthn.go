@@ -0,0 +1,443 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/iwind/TeaGo/lists"
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+var ErrSignCountRegression = errors.New("sign count regression, the authenticator may be cloned")
+
+// Credential 已注册的凭证
+type Credential struct {
+	Id                []byte   `json:"id"`
+	PublicKey         []byte   `json:"publicKey"` // COSE格式
+	Algorithm         int64    `json:"algorithm"`
+	SignCount         uint32   `json:"signCount"`
+	AAGUID            []byte   `json:"aaguid"`
+	BackupEligible    bool     `json:"backupEligible"` // 是否可以备份（比如同步的通行密钥）
+	BackupState       bool     `json:"backupState"`    // 当前是否已经备份
+	Transports        []string `json:"transports"`
+	AttestationFormat string   `json:"attestationFormat"`
+}
+
+// AssertionResult 认证结果
+type AssertionResult struct {
+	SignCount    uint32
+	BackupState  bool
+	UserVerified bool
+}
+
+// CredentialDescriptor 凭证描述
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	Id         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CreationOptions 注册凭证选项，对应浏览器的 PublicKeyCredentialCreationOptionsJSON
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		Id          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                     `json:"timeout"`
+	ExcludeCredentials     []*CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions 认证选项，对应浏览器的 PublicKeyCredentialRequestOptionsJSON
+type RequestOptions struct {
+	Challenge        string                  `json:"challenge"`
+	Timeout          int                     `json:"timeout"`
+	RPId             string                  `json:"rpId"`
+	AllowCredentials []*CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                  `json:"userVerification"`
+}
+
+// 浏览器返回的凭证，对应 PublicKeyCredential.toJSON()
+type publicKeyCredential struct {
+	Id       string `json:"id"`
+	RawId    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+		AuthenticatorData string   `json:"authenticatorData"`
+		Signature         string   `json:"signature"`
+		UserHandle        string   `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// NewChallenge 生成随机挑战值
+func NewChallenge() (string, error) {
+	var b = make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBase64URL(b), nil
+}
+
+// EncodeBase64URL 使用WebAuthn约定的格式编码
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64URL 解码，兼容带填充的格式
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewCreationOptions 生成注册凭证选项
+func NewCreationOptions(config *Config, challenge string, userHandle []byte, name string, displayName string, excludeCredentials []*Credential) *CreationOptions {
+	var options = &CreationOptions{
+		Challenge:   challenge,
+		Timeout:     config.TimeoutSeconds * 1000,
+		Attestation: "none",
+	}
+	options.RP.Id = config.RPId
+	options.RP.Name = config.RPName
+	options.User.Id = EncodeBase64URL(userHandle)
+	options.User.Name = name
+	options.User.DisplayName = displayName
+	for _, alg := range SupportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int64  `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	options.ExcludeCredentials = composeDescriptors(excludeCredentials)
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = config.UserVerification
+	return options
+}
+
+// NewRequestOptions 生成认证选项
+func NewRequestOptions(config *Config, challenge string, allowCredentials []*Credential) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          config.TimeoutSeconds * 1000,
+		RPId:             config.RPId,
+		AllowCredentials: composeDescriptors(allowCredentials),
+		UserVerification: config.UserVerification,
+	}
+}
+
+// ParseChallenge 从浏览器返回的凭证中读取挑战值，用于查找对应的认证流程
+func ParseChallenge(credentialJSON []byte) (string, error) {
+	credential, err := parseCredential(credentialJSON)
+	if err != nil {
+		return "", err
+	}
+	clientDataJSON, err := DecodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return "", errors.New("invalid clientDataJSON")
+	}
+	var data = &clientData{}
+	err = json.Unmarshal(clientDataJSON, data)
+	if err != nil {
+		return "", errors.New("invalid clientDataJSON: " + err.Error())
+	}
+	return data.Challenge, nil
+}
+
+// ParseCredentialId 从浏览器返回的凭证中读取凭证ID
+func ParseCredentialId(credentialJSON []byte) ([]byte, error) {
+	credential, err := parseCredential(credentialJSON)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBase64URL(credential.RawId)
+}
+
+// VerifyRegistration 校验注册凭证
+func VerifyRegistration(config *Config, challenge string, credentialJSON []byte) (*Credential, error) {
+	credential, err := parseCredential(credentialJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := verifyClientData(config, ceremonyCreate, challenge, credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := DecodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid attestationObject")
+	}
+	value, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) > 0 {
+		return nil, errors.New("invalid attestationObject")
+	}
+	attestation, ok := value.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid attestationObject")
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[any]any)
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := verifyAuthenticatorData(config, rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.HasFlag(FlagAttestedData) {
+		return nil, errors.New("attested credential data is missing")
+	}
+
+	rawId, err := DecodeBase64URL(credential.RawId)
+	if err != nil || !bytes.Equal(rawId, authData.CredentialId) {
+		return nil, errors.New("credential id mismatch")
+	}
+
+	publicKey, err := ParsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !lists.ContainsInt64(SupportedAlgorithms, publicKey.Algorithm) {
+		return nil, errors.New("unsupported algorithm")
+	}
+
+	// 我们请求的证明类型为none，这里只校验签名的正确性，不校验证书链
+	var clientDataHash = sha256.Sum256(clientDataJSON)
+	var signedData = append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) > 0 {
+			return nil, errors.New("invalid 'none' attestation statement")
+		}
+	case "packed":
+		err = verifyPackedAttestation(statement, publicKey, signedData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Credential{
+		Id:                rawId,
+		PublicKey:         authData.PublicKey,
+		Algorithm:         publicKey.Algorithm,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.AAGUID,
+		BackupEligible:    authData.HasFlag(FlagBackupEligible),
+		BackupState:       authData.HasFlag(FlagBackupState),
+		Transports:        credential.Response.Transports,
+		AttestationFormat: format,
+	}, nil
+}
+
+// VerifyAssertion 校验认证结果
+func VerifyAssertion(config *Config, challenge string, storedCredential *Credential, userHandle []byte, credentialJSON []byte) (*AssertionResult, error) {
+	credential, err := parseCredential(credentialJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	rawId, err := DecodeBase64URL(credential.RawId)
+	if err != nil || !bytes.Equal(rawId, storedCredential.Id) {
+		return nil, errors.New("credential id mismatch")
+	}
+
+	if len(credential.Response.UserHandle) > 0 {
+		handle, err := DecodeBase64URL(credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, userHandle) {
+			return nil, errors.New("user handle mismatch")
+		}
+	}
+
+	clientDataJSON, err := verifyClientData(config, ceremonyGet, challenge, credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := DecodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.New("invalid authenticatorData")
+	}
+	authData, err := verifyAuthenticatorData(config, rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 是否可以备份的属性在凭证创建后不能改变
+	if authData.HasFlag(FlagBackupEligible) != storedCredential.BackupEligible {
+		return nil, errors.New("backup eligibility mismatch")
+	}
+
+	signature, err := DecodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+	publicKey, err := ParsePublicKey(storedCredential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var clientDataHash = sha256.Sum256(clientDataJSON)
+	err = publicKey.Verify(append(append([]byte{}, rawAuthData...), clientDataHash[:]...), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// 计数器为0时表示认证器不支持计数
+	if (authData.SignCount > 0 || storedCredential.SignCount > 0) && authData.SignCount <= storedCredential.SignCount {
+		return nil, ErrSignCountRegression
+	}
+
+	return &AssertionResult{
+		SignCount:    authData.SignCount,
+		BackupState:  authData.HasFlag(FlagBackupState),
+		UserVerified: authData.HasFlag(FlagUserVerified),
+	}, nil
+}
+
+func parseCredential(credentialJSON []byte) (*publicKeyCredential, error) {
+	var credential = &publicKeyCredential{}
+	err := json.Unmarshal(credentialJSON, credential)
+	if err != nil {
+		return nil, errors.New("decode credential failed: " + err.Error())
+	}
+	if credential.Type != "public-key" {
+		return nil, errors.New("invalid credential type '" + credential.Type + "'")
+	}
+	if len(credential.RawId) == 0 {
+		credential.RawId = credential.Id
+	}
+	return credential, nil
+}
+
+func verifyClientData(config *Config, ceremony string, challenge string, encodedClientData string) ([]byte, error) {
+	clientDataJSON, err := DecodeBase64URL(encodedClientData)
+	if err != nil {
+		return nil, errors.New("invalid clientDataJSON")
+	}
+	var data = &clientData{}
+	err = json.Unmarshal(clientDataJSON, data)
+	if err != nil {
+		return nil, errors.New("invalid clientDataJSON: " + err.Error())
+	}
+	if data.Type != ceremony {
+		return nil, errors.New("invalid client data type '" + data.Type + "'")
+	}
+	if len(challenge) == 0 || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return nil, errors.New("challenge mismatch")
+	}
+	if data.CrossOrigin {
+		return nil, errors.New("cross origin request is not allowed")
+	}
+	if !config.AllowOrigin(data.Origin) {
+		return nil, errors.New("origin '" + data.Origin + "' is not allowed")
+	}
+	return clientDataJSON, nil
+}
+
+func verifyAuthenticatorData(config *Config, rawAuthData []byte) (*AuthenticatorData, error) {
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	var rpIdHash = sha256.Sum256([]byte(config.RPId))
+	if !bytes.Equal(authData.RPIdHash, rpIdHash[:]) {
+		return nil, errors.New("rpId hash mismatch")
+	}
+	if !authData.HasFlag(FlagUserPresent) {
+		return nil, errors.New("user is not present")
+	}
+	if config.UserVerification == UserVerificationRequired && !authData.HasFlag(FlagUserVerified) {
+		return nil, errors.New("user is not verified")
+	}
+	if authData.HasFlag(FlagBackupState) && !authData.HasFlag(FlagBackupEligible) {
+		return nil, errors.New("invalid backup flags")
+	}
+	return authData, nil
+}
+
+func verifyPackedAttestation(statement map[any]any, publicKey *PublicKey, signedData []byte) error {
+	alg, _ := cborMapInt(statement, "alg")
+	signature, _ := cborMapBytes(statement, "sig")
+	if len(signature) == 0 {
+		return errors.New("invalid 'packed' attestation statement")
+	}
+
+	x5c, hasCertificates := statement["x5c"].([]any)
+	if !hasCertificates {
+		// 自证明
+		if alg != publicKey.Algorithm {
+			return errors.New("attestation algorithm mismatch")
+		}
+		return publicKey.Verify(signedData, signature)
+	}
+
+	if len(x5c) == 0 {
+		return errors.New("invalid 'packed' attestation certificates")
+	}
+	certData, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return errors.New("invalid 'packed' attestation certificate: " + err.Error())
+	}
+	var signatureAlgorithm x509.SignatureAlgorithm
+	switch alg {
+	case AlgES256:
+		signatureAlgorithm = x509.ECDSAWithSHA256
+	case AlgES384:
+		signatureAlgorithm = x509.ECDSAWithSHA384
+	case AlgRS256:
+		signatureAlgorithm = x509.SHA256WithRSA
+	case AlgEdDSA:
+		signatureAlgorithm = x509.PureEd25519
+	default:
+		return errors.New("unsupported attestation algorithm")
+	}
+	return cert.CheckSignature(signatureAlgorithm, signedData, signature)
+}
+
+func composeDescriptors(credentials []*Credential) []*CredentialDescriptor {
+	var result = []*CredentialDescriptor{}
+	for _, credential := range credentials {
+		result = append(result, &CredentialDescriptor{
+			Type:       "public-key",
+			Id:         EncodeBase64URL(credential.Id),
+			Transports: credential.Transports,
+		})
+	}
+	return result
+}
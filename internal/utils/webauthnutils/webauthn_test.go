@@ -0,0 +1,310 @@
+// Copyright 2024 GoEdge CDN goedge.cdn@gmail.com. All rights reserved. Official site: https://goedge.cloud .
+
+package webauthnutils_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/webauthnutils"
+	"github.com/iwind/TeaGo/assert"
+)
+
+// 简单的CBOR编码，只用于测试
+func encodeCBOR(value any) []byte {
+	var header = func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 256:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 65536:
+			var b = []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		}
+		var b = []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return header(1, uint64(-1-v))
+		}
+		return header(0, uint64(v))
+	case int64:
+		return encodeCBOR(int(v))
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case []any:
+		var result = header(4, uint64(len(v)))
+		for _, item := range v {
+			result = append(result, encodeCBOR(item)...)
+		}
+		return result
+	case map[any]any:
+		var keys = []any{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return string(encodeCBOR(keys[i])) < string(encodeCBOR(keys[j]))
+		})
+		var result = header(5, uint64(len(v)))
+		for _, key := range keys {
+			result = append(result, encodeCBOR(key)...)
+			result = append(result, encodeCBOR(v[key])...)
+		}
+		return result
+	}
+	panic("unsupported type")
+}
+
+// 模拟的认证器
+type mockAuthenticator struct {
+	credentialId []byte
+	signer       crypto.Signer
+	alg          int64
+	flags        byte
+	signCount    uint32
+}
+
+func newMockAuthenticator(alg int64) *mockAuthenticator {
+	var signer crypto.Signer
+	switch alg {
+	case webauthnutils.AlgES256:
+		signer, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthnutils.AlgEdDSA:
+		_, signer, _ = ed25519.GenerateKey(rand.Reader)
+	}
+	var credentialId = make([]byte, 16)
+	_, _ = rand.Read(credentialId)
+	return &mockAuthenticator{
+		credentialId: credentialId,
+		signer:       signer,
+		alg:          alg,
+		flags:        webauthnutils.FlagUserPresent | webauthnutils.FlagUserVerified | webauthnutils.FlagBackupEligible,
+	}
+}
+
+func (this *mockAuthenticator) coseKey() []byte {
+	switch key := this.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		var x = make([]byte, 32)
+		var y = make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return encodeCBOR(map[any]any{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	case ed25519.PublicKey:
+		return encodeCBOR(map[any]any{1: 1, 3: -8, -1: 6, -2: []byte(key)})
+	}
+	return nil
+}
+
+func (this *mockAuthenticator) authData(rpId string, attested bool) []byte {
+	var rpIdHash = sha256.Sum256([]byte(rpId))
+	var data = append([]byte{}, rpIdHash[:]...)
+	var flags = this.flags
+	if attested {
+		flags |= webauthnutils.FlagAttestedData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, this.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(this.credentialId)))
+		data = append(data, this.credentialId...)
+		data = append(data, this.coseKey()...)
+	}
+	return data
+}
+
+func (this *mockAuthenticator) sign(data []byte) []byte {
+	var digest = data
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if this.alg == webauthnutils.AlgES256 {
+		var sum = sha256.Sum256(data)
+		digest = sum[:]
+		opts = crypto.SHA256
+	}
+	signature, err := this.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
+
+func (this *mockAuthenticator) clientData(ceremony string, challenge string, origin string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    origin,
+	})
+	return data
+}
+
+func (this *mockAuthenticator) create(rpId string, challenge string, origin string) []byte {
+	var attestationObject = encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": this.authData(rpId, true),
+	})
+	credentialJSON, _ := json.Marshal(map[string]any{
+		"id":    webauthnutils.EncodeBase64URL(this.credentialId),
+		"rawId": webauthnutils.EncodeBase64URL(this.credentialId),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthnutils.EncodeBase64URL(this.clientData("webauthn.create", challenge, origin)),
+			"attestationObject": webauthnutils.EncodeBase64URL(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+	return credentialJSON
+}
+
+func (this *mockAuthenticator) get(rpId string, challenge string, origin string, userHandle []byte) []byte {
+	this.signCount++
+	var authData = this.authData(rpId, false)
+	var clientDataJSON = this.clientData("webauthn.get", challenge, origin)
+	var clientDataHash = sha256.Sum256(clientDataJSON)
+	var signature = this.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+	credentialJSON, _ := json.Marshal(map[string]any{
+		"id":    webauthnutils.EncodeBase64URL(this.credentialId),
+		"rawId": webauthnutils.EncodeBase64URL(this.credentialId),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthnutils.EncodeBase64URL(clientDataJSON),
+			"authenticatorData": webauthnutils.EncodeBase64URL(authData),
+			"signature":         webauthnutils.EncodeBase64URL(signature),
+			"userHandle":        webauthnutils.EncodeBase64URL(userHandle),
+		},
+	})
+	return credentialJSON
+}
+
+func testConfig(t *testing.T) *webauthnutils.Config {
+	var config = webauthnutils.DefaultConfig()
+	config.IsOn = true
+	config.RPId = "example.com"
+	config.Origins = []string{"https://admin.example.com"}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	var config = testConfig(t)
+	const origin = "https://admin.example.com"
+	var userHandle = []byte("admin_1")
+
+	for _, alg := range []int64{webauthnutils.AlgES256, webauthnutils.AlgEdDSA} {
+		var authenticator = newMockAuthenticator(alg)
+
+		// 注册
+		challenge, err := webauthnutils.NewChallenge()
+		a.IsNil(err)
+		var credentialJSON = authenticator.create(config.RPId, challenge, origin)
+
+		parsedChallenge, err := webauthnutils.ParseChallenge(credentialJSON)
+		a.IsNil(err)
+		a.IsTrue(parsedChallenge == challenge)
+
+		_, err = webauthnutils.VerifyRegistration(config, challenge+"x", credentialJSON)
+		a.IsNotNil(err)
+
+		credential, err := webauthnutils.VerifyRegistration(config, challenge, credentialJSON)
+		a.IsNil(err)
+		if credential == nil {
+			continue
+		}
+		a.IsTrue(credential.Algorithm == alg)
+		a.IsTrue(credential.BackupEligible)
+		a.IsFalse(credential.BackupState)
+
+		// 认证
+		challenge, _ = webauthnutils.NewChallenge()
+		result, err := webauthnutils.VerifyAssertion(config, challenge, credential, userHandle, authenticator.get(config.RPId, challenge, origin, userHandle))
+		a.IsNil(err)
+		if result != nil {
+			a.IsTrue(result.SignCount == 1)
+			a.IsTrue(result.UserVerified)
+			credential.SignCount = result.SignCount
+		}
+
+		// 不允许的来源
+		challenge, _ = webauthnutils.NewChallenge()
+		_, err = webauthnutils.VerifyAssertion(config, challenge, credential, userHandle, authenticator.get(config.RPId, challenge, "https://evil.com", userHandle))
+		a.IsNotNil(err)
+
+		// 错误的RPId
+		challenge, _ = webauthnutils.NewChallenge()
+		_, err = webauthnutils.VerifyAssertion(config, challenge, credential, userHandle, authenticator.get("evil.com", challenge, origin, userHandle))
+		a.IsNotNil(err)
+
+		// 错误的用户
+		challenge, _ = webauthnutils.NewChallenge()
+		_, err = webauthnutils.VerifyAssertion(config, challenge, credential, []byte("admin_2"), authenticator.get(config.RPId, challenge, origin, userHandle))
+		a.IsNotNil(err)
+
+		// 计数器回退
+		credential.SignCount = 100
+		challenge, _ = webauthnutils.NewChallenge()
+		_, err = webauthnutils.VerifyAssertion(config, challenge, credential, userHandle, authenticator.get(config.RPId, challenge, origin, userHandle))
+		a.IsTrue(errors.Is(err, webauthnutils.ErrSignCountRegression))
+	}
+}
+
+func TestConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = webauthnutils.DefaultConfig()
+	a.IsNil(config.Init())
+
+	config.IsOn = true
+	a.IsNotNil(config.Init())
+
+	config.RPId = "example.com"
+	config.Origins = []string{"https://admin.example.com/"}
+	a.IsNil(config.Init())
+	a.IsTrue(config.AllowOrigin("https://admin.example.com"))
+	a.IsFalse(config.AllowOrigin("https://user.example.com"))
+
+	config.Origins = []string{"http://admin.example.com"}
+	a.IsNotNil(config.Init())
+
+	config.Origins = []string{"https://example.org"}
+	a.IsNotNil(config.Init())
+
+	config.Origins = []string{"https://evilexample.com"}
+	a.IsNotNil(config.Init())
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	codes, hashes, err := webauthnutils.GenerateRecoveryCodes(webauthnutils.RecoveryCodeCount)
+	a.IsNil(err)
+	a.IsTrue(len(codes) == webauthnutils.RecoveryCodeCount)
+	a.IsTrue(len(codes[0]) == 11)
+	t.Log(codes)
+
+	a.IsTrue(webauthnutils.MatchRecoveryCode(hashes, codes[3]) == 3)
+	a.IsTrue(webauthnutils.MatchRecoveryCode(hashes, " "+codes[3][:5]+codes[3][6:]) == 3)
+	a.IsTrue(webauthnutils.MatchRecoveryCode(hashes, "aaaaa-aaaaa") == -1)
+}